@@ -0,0 +1,181 @@
+// Package accesstoken holds the primitives shared by melius, which issues access
+// tokens, and the services verifying them: the claims of the tokens, their JWT and
+// PASETO formats, JSON Web Keys and DPoP proofs. It depends on nothing of melius,
+// so verifying tokens does not pull in its configuration nor its storage.
+package accesstoken
+
+import (
+	"encoding/json"
+	"maps"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Types of principals. Users are people, service accounts are machines.
+const (
+	PrincipalUser           = "user"
+	PrincipalServiceAccount = "service_account"
+)
+
+// Claims are the claims carried by access tokens.
+// The subject is the immutable user ID, the username is informational only
+// because it can change during the lifetime of the token. Tokens of service
+// accounts have the service account ID as subject and its name as username.
+// Tokens obtained by token exchange are addressed to a downstream audience and
+// may be limited to a space separated scope. ClientID is the client the token
+// was issued to, if any. Extra holds the claims added by claim mappers.
+type Claims struct {
+	Username   string         `json:"username"`
+	Roles      []string       `json:"roles,omitempty"`
+	Attributes map[string]any `json:"attrs,omitempty"`
+	SessionID  string         `json:"sid,omitempty"`
+	// AuthTime is when the user last presented their credentials, which stays
+	// the same when tokens are issued without authenticating again.
+	AuthTime *jwt.NumericDate `json:"auth_time,omitempty"`
+	ACR      string           `json:"acr,omitempty"`
+	AMR      []string         `json:"amr,omitempty"`
+	// PrincipalType is empty in the tokens of users.
+	PrincipalType string `json:"pty,omitempty"`
+	// Actor identifies the administrator impersonating the user, or the service
+	// account the token was exchanged for.
+	Actor *Actor `json:"act,omitempty"`
+	Scope string `json:"scope,omitempty"`
+	// Confirmation binds sender-constrained tokens to the key of their client.
+	Confirmation *Confirmation  `json:"cnf,omitempty"`
+	ClientID     string         `json:"client_id,omitempty"`
+	Extra        map[string]any `json:"-"`
+	jwt.RegisteredClaims
+}
+
+// NewClaims returns the claims of an access token for the given user.
+func NewClaims(userID uint, username string) Claims {
+	return Claims{
+		Username: username,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject: strconv.FormatUint(uint64(userID), 10),
+		},
+	}
+}
+
+// NewServiceAccountClaims returns the claims of an access token for the given service account.
+func NewServiceAccountClaims(id uint, name string) Claims {
+	return Claims{
+		Username:      name,
+		PrincipalType: PrincipalServiceAccount,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject: strconv.FormatUint(uint64(id), 10),
+		},
+	}
+}
+
+// Authenticated records that the user authenticated at the given time, with the
+// assurance level acr reached through the methods amr.
+func (c *Claims) Authenticated(at time.Time, acr string, amr ...string) {
+	c.AuthTime = jwt.NewNumericDate(at)
+	c.ACR = acr
+	c.AMR = amr
+}
+
+// Actor is the act claim of RFC 8693, the party acting on behalf of the subject of
+// a token. Actors may themselves act for another party, forming a chain.
+// PrincipalType is empty for users, like in Claims.
+type Actor struct {
+	Subject       string `json:"sub"`
+	Username      string `json:"username,omitempty"`
+	PrincipalType string `json:"pty,omitempty"`
+	Actor         *Actor `json:"act,omitempty"`
+}
+
+// Impersonator returns the first user of the actor chain, skipping the service
+// accounts the token was exchanged for, or nil when no user acts for the subject.
+func (a *Actor) Impersonator() *Actor {
+	for ; a != nil; a = a.Actor {
+		if a.PrincipalType != PrincipalServiceAccount {
+			return a
+		}
+	}
+	return nil
+}
+
+// Confirmation is the cnf claim of RFC 7800. JKT is the thumbprint of the public key
+// the token is bound to, whose private key must sign a DPoP proof with every request.
+type Confirmation struct {
+	JKT string `json:"jkt"`
+}
+
+// Bind binds the token to the key of thumbprint jkt, when not empty.
+func (c *Claims) Bind(jkt string) {
+	if jkt != "" {
+		c.Confirmation = &Confirmation{JKT: jkt}
+	}
+}
+
+// TokenType returns the token_type of the token in token responses.
+func (c *Claims) TokenType() string {
+	if c.Confirmation != nil {
+		return "DPoP"
+	}
+	return "Bearer"
+}
+
+// ownClaims are the names of the claims of melius, which Extra claims cannot replace.
+var ownClaims = claimNames(reflect.TypeOf(Claims{}))
+
+// claimNames returns the JSON names of the fields of the struct t, including the
+// fields of embedded structs.
+func claimNames(t reflect.Type) map[string]bool {
+	names := map[string]bool{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous {
+			maps.Copy(names, claimNames(field.Type))
+			continue
+		}
+		if name, _, _ := strings.Cut(field.Tag.Get("json"), ","); name != "" && name != "-" {
+			names[name] = true
+		}
+	}
+	return names
+}
+
+// MarshalJSON encodes the claims along with their Extra claims.
+func (c Claims) MarshalJSON() ([]byte, error) {
+	type plain Claims
+	encoded, err := json.Marshal(plain(c))
+	if err != nil || len(c.Extra) == 0 {
+		return encoded, err
+	}
+
+	var fields map[string]any
+	if err := json.Unmarshal(encoded, &fields); err != nil {
+		return nil, err
+	}
+	for name, value := range c.Extra {
+		if !ownClaims[name] {
+			fields[name] = value
+		}
+	}
+	return json.Marshal(fields)
+}
+
+// UnmarshalJSON decodes the claims, keeping the claims unknown to melius as Extra claims.
+func (c *Claims) UnmarshalJSON(data []byte) error {
+	type plain Claims
+	if err := json.Unmarshal(data, (*plain)(c)); err != nil {
+		return err
+	}
+
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	maps.DeleteFunc(fields, func(name string, _ any) bool { return ownClaims[name] })
+	if len(fields) > 0 {
+		c.Extra = fields
+	}
+	return nil
+}
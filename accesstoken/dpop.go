@@ -0,0 +1,191 @@
+package accesstoken
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// DPoPProofMaxAge is how old a DPoP proof may be. Its jti is remembered as long.
+	DPoPProofMaxAge = 5 * time.Minute
+	// dpopClockSkew tolerates proofs issued slightly in the future by a client clock.
+	dpopClockSkew = 30 * time.Second
+)
+
+// dpopMethods are the signing algorithms accepted for DPoP proofs.
+var dpopMethods = []string{
+	"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA",
+}
+
+// ReplayCache remembers the jti of DPoP proofs and client assertions so each is used only once.
+type ReplayCache interface {
+	// Seen reports whether jti was already seen, and remembers it until expiresAt otherwise.
+	Seen(jti string, expiresAt time.Time) bool
+}
+
+// memoryReplayCache is a ReplayCache in memory, suitable for a single instance.
+type memoryReplayCache struct {
+	mu        sync.Mutex
+	seen      map[string]time.Time
+	nextSweep time.Time
+}
+
+// NewReplayCache returns a ReplayCache kept in memory.
+func NewReplayCache() ReplayCache {
+	return &memoryReplayCache{seen: map[string]time.Time{}}
+}
+
+func (rc *memoryReplayCache) Seen(jti string, expiresAt time.Time) bool {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	now := time.Now()
+	if now.After(rc.nextSweep) {
+		for id, until := range rc.seen {
+			if now.After(until) {
+				delete(rc.seen, id)
+			}
+		}
+		rc.nextSweep = now.Add(time.Minute)
+	}
+
+	if until, ok := rc.seen[jti]; ok && now.Before(until) {
+		return true
+	}
+	rc.seen[jti] = expiresAt
+	return false
+}
+
+// dpopClaims are the claims of a DPoP proof.
+type dpopClaims struct {
+	HTM string `json:"htm"`
+	HTU string `json:"htu"`
+	ATH string `json:"ath,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// VerifyDPoPProof verifies the DPoP proof of RFC 9449 sent with a request of method to
+// rawURL, and returns the thumbprint of the public key that signed it. accessToken is
+// the token sent along with the proof, whose hash the proof must carry, and is empty
+// at the token endpoint.
+func VerifyDPoPProof(proof, method, rawURL, accessToken string, replay ReplayCache) (string, error) {
+	var (
+		claims dpopClaims
+		jkt    string
+	)
+	parser := jwt.NewParser(jwt.WithValidMethods(dpopMethods))
+	_, err := parser.ParseWithClaims(proof, &claims, func(token *jwt.Token) (any, error) {
+		if typ, _ := token.Header["typ"].(string); typ != "dpop+jwt" {
+			return nil, errors.New("proof must be of type dpop+jwt")
+		}
+		jwk, ok := token.Header["jwk"].(map[string]any)
+		if !ok {
+			return nil, errors.New("proof must carry its public key")
+		}
+
+		key, thumbprint, err := ParseJWK(jwk)
+		if err != nil {
+			return nil, err
+		}
+		jkt = thumbprint
+		return key, nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("invalid DPoP proof: %w", err)
+	}
+
+	now := time.Now()
+	switch {
+	case claims.ID == "" || claims.IssuedAt == nil:
+		return "", errors.New("DPoP proof must have a jti and an iat")
+	case claims.IssuedAt.Before(now.Add(-DPoPProofMaxAge)) || claims.IssuedAt.After(now.Add(dpopClockSkew)):
+		return "", errors.New("DPoP proof is too old or from the future")
+	case claims.HTM != method:
+		return "", errors.New("DPoP proof was made for another method")
+	case !sameURL(claims.HTU, rawURL):
+		return "", errors.New("DPoP proof was made for another URL")
+	}
+
+	if accessToken != "" {
+		sum := sha256.Sum256([]byte(accessToken))
+		if claims.ATH != base64.RawURLEncoding.EncodeToString(sum[:]) {
+			return "", errors.New("DPoP proof was made for another access token")
+		}
+	}
+
+	if replay.Seen(jkt+"/"+claims.ID, claims.IssuedAt.Add(DPoPProofMaxAge+dpopClockSkew)) {
+		return "", errors.New("DPoP proof was already used")
+	}
+	return jkt, nil
+}
+
+// TrustedProxies are the networks of the reverse proxies trusted to tell the scheme
+// of the requests they forward by the X-Forwarded-Proto header.
+type TrustedProxies []netip.Prefix
+
+// ParseTrustedProxies parses the IP addresses and CIDR ranges of trusted proxies.
+func ParseTrustedProxies(proxies []string) (TrustedProxies, error) {
+	trusted := make(TrustedProxies, 0, len(proxies))
+	for _, proxy := range proxies {
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(proxy)
+			if addrErr != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", proxy)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		trusted = append(trusted, prefix.Masked())
+	}
+	return trusted, nil
+}
+
+// Trusts reports whether r was received from one of the trusted proxies.
+func (p TrustedProxies) Trusts(r *http.Request) bool {
+	addrPort, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	addr := addrPort.Addr().Unmap()
+	return slices.ContainsFunc(p, func(prefix netip.Prefix) bool { return prefix.Contains(addr) })
+}
+
+// RequestURL returns the URL the client addressed with r, without query nor fragment,
+// as signed in the htu of DPoP proofs. The scheme is https for requests received over
+// TLS. TLS terminated by a proxy is recognized by the X-Forwarded-Proto header, which
+// is ignored unless r was received from one of proxies, since clients can set it.
+func RequestURL(r *http.Request, proxies TrustedProxies) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" && proxies.Trusts(r) {
+		scheme = proto
+	}
+	return scheme + "://" + r.Host + r.URL.Path
+}
+
+// sameURL compares the htu of a proof to the URL of the request, ignoring the query,
+// the fragment and the case of the scheme and host.
+func sameURL(htu, rawURL string) bool {
+	a, err := url.Parse(htu)
+	if err != nil {
+		return false
+	}
+	b, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(a.Scheme, b.Scheme) && strings.EqualFold(a.Host, b.Host) && a.Path == b.Path
+}
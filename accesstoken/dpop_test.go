@@ -0,0 +1,46 @@
+package accesstoken_test
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ryanpujo/melius/accesstoken"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestURL(t *testing.T) {
+	proxies, err := accesstoken.ParseTrustedProxies([]string{"10.0.0.0/8", "::1"})
+	require.NoError(t, err)
+
+	tableTest := map[string]struct {
+		remoteAddr string
+		forwarded  string
+		tls        bool
+		expected   string
+	}{
+		"plain":                      {remoteAddr: "192.0.2.1:1234", expected: "http://melius.test/oauth/token"},
+		"tls":                        {remoteAddr: "192.0.2.1:1234", tls: true, expected: "https://melius.test/oauth/token"},
+		"forwarded by trusted proxy": {remoteAddr: "10.1.2.3:1234", forwarded: "https", expected: "https://melius.test/oauth/token"},
+		"forwarded by trusted ipv6":  {remoteAddr: "[::1]:1234", forwarded: "https", expected: "https://melius.test/oauth/token"},
+		"forwarded by client":        {remoteAddr: "192.0.2.1:1234", forwarded: "https", expected: "http://melius.test/oauth/token"},
+		"downgraded by client":       {remoteAddr: "192.0.2.1:1234", forwarded: "http", tls: true, expected: "https://melius.test/oauth/token"},
+	}
+	for name, tc := range tableTest {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "http://melius.test/oauth/token?x=1", nil)
+			r.RemoteAddr = tc.remoteAddr
+			if tc.forwarded != "" {
+				r.Header.Set("X-Forwarded-Proto", tc.forwarded)
+			}
+			if tc.tls {
+				r.TLS = &tls.ConnectionState{}
+			}
+			require.Equal(t, tc.expected, accesstoken.RequestURL(r, proxies))
+		})
+	}
+
+	_, err = accesstoken.ParseTrustedProxies([]string{"proxy.local"})
+	require.Error(t, err)
+}
@@ -0,0 +1,75 @@
+package accesstoken
+
+import (
+	"crypto/ed25519"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Format encodes the claims of access tokens into signed tokens and verifies them,
+// so issuing and authenticating tokens does not depend on how they are encoded.
+type Format interface {
+	// Sign encodes claims into a signed token.
+	Sign(claims Claims) (string, error)
+	// Verify checks the signature of token and returns its claims. Checking that
+	// they are still valid is left to the caller.
+	Verify(token string) (*Claims, error)
+}
+
+// KeyPublisher is implemented by the formats signing tokens with a key pair. Its
+// public keys let other services verify tokens without sharing a secret.
+type KeyPublisher interface {
+	PublicKeys() []JWK
+}
+
+// jwtFormat encodes tokens as JWTs signed with a single method.
+type jwtFormat struct {
+	method       jwt.SigningMethod
+	signingKey   any
+	verifyingKey any
+	keyID        string
+}
+
+// NewJWTFormat returns the JWT format, signing tokens with HS256 and key.
+func NewJWTFormat(key []byte) Format {
+	return jwtFormat{method: jwt.SigningMethodHS256, signingKey: key, verifyingKey: key}
+}
+
+// NewEd25519JWTFormat returns the JWT format, signing tokens with EdDSA and key.
+// Tokens name the key in their kid header, its thumbprint.
+func NewEd25519JWTFormat(key ed25519.PrivateKey) Format {
+	public := key.Public().(ed25519.PublicKey)
+	return jwtFormat{
+		method:       jwt.SigningMethodEdDSA,
+		signingKey:   key,
+		verifyingKey: public,
+		keyID:        Ed25519JWK(public, "").KeyID,
+	}
+}
+
+func (f jwtFormat) Sign(claims Claims) (string, error) {
+	token := jwt.NewWithClaims(f.method, claims)
+	if f.keyID != "" {
+		token.Header["kid"] = f.keyID
+	}
+	return token.SignedString(f.signingKey)
+}
+
+func (f jwtFormat) Verify(token string) (*Claims, error) {
+	var claims Claims
+	_, err := jwt.ParseWithClaims(token, &claims, func(*jwt.Token) (any, error) {
+		return f.verifyingKey, nil
+	}, jwt.WithValidMethods([]string{f.method.Alg()}), jwt.WithoutClaimsValidation())
+	if err != nil {
+		return nil, err
+	}
+	return &claims, nil
+}
+
+func (f jwtFormat) PublicKeys() []JWK {
+	public, ok := f.verifyingKey.(ed25519.PublicKey)
+	if !ok {
+		return nil
+	}
+	return []JWK{Ed25519JWK(public, f.method.Alg())}
+}
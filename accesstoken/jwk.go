@@ -0,0 +1,143 @@
+package accesstoken
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// MinRSAKeyBits is the smallest RSA public key accepted, in JWKs as in the
+// credentials of service accounts.
+const MinRSAKeyBits = 2048
+
+// JWK is a public JSON Web Key verifying access tokens. Alg is empty for the keys of
+// PASETOs, whose version fixes the algorithm.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Curve     string `json:"crv"`
+	X         string `json:"x"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// Ed25519JWK returns the JWK of an Ed25519 public key, identified by its thumbprint.
+func Ed25519JWK(key ed25519.PublicKey, alg string) JWK {
+	jwk := JWK{
+		KeyType:   "OKP",
+		Curve:     "Ed25519",
+		X:         base64.RawURLEncoding.EncodeToString(key),
+		Use:       "sig",
+		Algorithm: alg,
+	}
+	_, jwk.KeyID, _ = ParseJWK(map[string]any{"kty": jwk.KeyType, "crv": jwk.Curve, "x": jwk.X})
+	return jwk
+}
+
+// ParseJWK returns the public key of a JSON Web Key and its thumbprint as in RFC 7638,
+// the SHA-256 of its required members in lexicographic order.
+func ParseJWK(jwk map[string]any) (crypto.PublicKey, string, error) {
+	member := func(name string) string {
+		s, _ := jwk[name].(string)
+		return s
+	}
+	number := func(name string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(member(name))
+		if err != nil || len(b) == 0 {
+			return nil, fmt.Errorf("invalid JWK member %s", name)
+		}
+		return new(big.Int).SetBytes(b), nil
+	}
+
+	if _, private := jwk["d"]; private {
+		return nil, "", errors.New("JWK must not contain a private key")
+	}
+
+	var (
+		key     crypto.PublicKey
+		members any
+	)
+	switch member("kty") {
+	case "RSA":
+		n, err := number("n")
+		if err != nil {
+			return nil, "", err
+		}
+		if n.BitLen() < MinRSAKeyBits {
+			return nil, "", fmt.Errorf("RSA keys must have at least %d bits", MinRSAKeyBits)
+		}
+		e, err := number("e")
+		if err != nil || !e.IsInt64() {
+			return nil, "", errors.New("invalid JWK member e")
+		}
+		key = &rsa.PublicKey{N: n, E: int(e.Int64())}
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{member("e"), "RSA", member("n")}
+	case "EC":
+		var curve elliptic.Curve
+		switch member("crv") {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, "", errors.New("unsupported JWK curve")
+		}
+		x, err := number("x")
+		if err != nil {
+			return nil, "", err
+		}
+		y, err := number("y")
+		if err != nil {
+			return nil, "", err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, "", errors.New("JWK point is not on its curve")
+		}
+		key = &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{member("crv"), "EC", member("x"), member("y")}
+	case "OKP":
+		x, err := base64.RawURLEncoding.DecodeString(member("x"))
+		if member("crv") != "Ed25519" || err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, "", errors.New("unsupported JWK key")
+		}
+		key = ed25519.PublicKey(x)
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{"Ed25519", "OKP", member("x")}
+	default:
+		return nil, "", errors.New("unsupported JWK key type")
+	}
+
+	canonical, err := json.Marshal(members)
+	if err != nil {
+		return nil, "", err
+	}
+	sum := sha256.Sum256(canonical)
+	return key, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
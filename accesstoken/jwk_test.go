@@ -0,0 +1,55 @@
+package accesstoken_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"testing"
+
+	"github.com/ryanpujo/melius/accesstoken"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseJWK(t *testing.T) {
+	// The example key of RFC 7638, section 3.1.
+	rfc7638 := map[string]any{
+		"kty": "RSA",
+		"n": "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECP" +
+			"ebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY" +
+			"368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0f" +
+			"M4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+		"e":   "AQAB",
+		"alg": "RS256",
+		"kid": "2011-04-29",
+	}
+	key, thumbprint, err := accesstoken.ParseJWK(rfc7638)
+	require.NoError(t, err)
+	require.IsType(t, &rsa.PublicKey{}, key)
+	require.Equal(t, "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs", thumbprint)
+
+	public, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	jwk := accesstoken.Ed25519JWK(public, "EdDSA")
+	key, thumbprint, err = accesstoken.ParseJWK(map[string]any{"kty": jwk.KeyType, "crv": jwk.Curve, "x": jwk.X})
+	require.NoError(t, err)
+	require.Equal(t, public, key)
+	require.Equal(t, jwk.KeyID, thumbprint)
+
+	small, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+
+	tableTest := map[string]map[string]any{
+		"private key":      {"kty": "OKP", "crv": "Ed25519", "x": jwk.X, "d": "secret"},
+		"unknown key type": {"kty": "oct", "k": "secret"},
+		"unknown curve":    {"kty": "EC", "crv": "P-192", "x": "AQ", "y": "AQ"},
+		"point off curve":  {"kty": "EC", "crv": "P-256", "x": "AQ", "y": "AQ"},
+		"small RSA key":    {"kty": "RSA", "n": base64.RawURLEncoding.EncodeToString(small.N.Bytes()), "e": "AQAB"},
+	}
+	for name, jwk := range tableTest {
+		t.Run(name, func(t *testing.T) {
+			_, _, err := accesstoken.ParseJWK(jwk)
+			require.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package accesstoken
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// pasetoHeader starts every v4.public PASETO. The version and purpose fix the
+// algorithm to Ed25519, so unlike JWTs there is no algorithm to negotiate.
+const pasetoHeader = "v4.public."
+
+// pasetoDates are the registered claims PASETO encodes as RFC 3339 dates,
+// where JWT uses numeric dates.
+var pasetoDates = []string{"exp", "nbf", "iat"}
+
+// ErrPASETOInvalid is returned when a PASETO is malformed or its signature is invalid.
+var ErrPASETOInvalid = errors.New("invalid PASETO")
+
+// pasetoFormat encodes tokens as v4.public PASETOs.
+type pasetoFormat struct {
+	private ed25519.PrivateKey
+	public  ed25519.PublicKey
+}
+
+// NewPASETOFormat returns the PASETO v4.public format, signing tokens with key.
+func NewPASETOFormat(key ed25519.PrivateKey) Format {
+	return pasetoFormat{private: key, public: key.Public().(ed25519.PublicKey)}
+}
+
+// NewPASETOVerifier returns the PASETO v4.public format verifying tokens with key.
+// It cannot sign tokens.
+func NewPASETOVerifier(key ed25519.PublicKey) Format {
+	return pasetoFormat{public: key}
+}
+
+func (f pasetoFormat) Sign(claims Claims) (string, error) {
+	if f.private == nil {
+		return "", errors.New("cannot sign PASETOs without a private key")
+	}
+	payload, err := encodePASETOClaims(claims)
+	if err != nil {
+		return "", err
+	}
+	signature := ed25519.Sign(f.private, pae([]byte(pasetoHeader), payload, nil, nil))
+	return pasetoHeader + base64.RawURLEncoding.EncodeToString(append(payload, signature...)), nil
+}
+
+func (f pasetoFormat) Verify(token string) (*Claims, error) {
+	body, ok := strings.CutPrefix(token, pasetoHeader)
+	if !ok {
+		return nil, fmt.Errorf("%w: not a v4.public token", ErrPASETOInvalid)
+	}
+	body, encodedFooter, _ := strings.Cut(body, ".")
+
+	signed, err := base64.RawURLEncoding.DecodeString(body)
+	if err != nil || len(signed) < ed25519.SignatureSize {
+		return nil, fmt.Errorf("%w: malformed payload", ErrPASETOInvalid)
+	}
+	footer, err := base64.RawURLEncoding.DecodeString(encodedFooter)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed footer", ErrPASETOInvalid)
+	}
+
+	payload, signature := signed[:len(signed)-ed25519.SignatureSize], signed[len(signed)-ed25519.SignatureSize:]
+	if !ed25519.Verify(f.public, pae([]byte(pasetoHeader), payload, footer, nil), signature) {
+		return nil, fmt.Errorf("%w: signature is invalid", ErrPASETOInvalid)
+	}
+	return decodePASETOClaims(payload)
+}
+
+func (f pasetoFormat) PublicKeys() []JWK {
+	return []JWK{Ed25519JWK(f.public, "")}
+}
+
+// pae is the pre-authentication encoding of PASETO, which prefixes the pieces with
+// their count and each piece with its length, so different pieces never sign alike.
+func pae(pieces ...[]byte) []byte {
+	le64 := func(b []byte, n int) []byte {
+		return binary.LittleEndian.AppendUint64(b, uint64(n)&^(1<<63))
+	}
+
+	out := le64(nil, len(pieces))
+	for _, piece := range pieces {
+		out = le64(out, len(piece))
+		out = append(out, piece...)
+	}
+	return out
+}
+
+// encodePASETOClaims encodes claims as the JSON payload of a PASETO.
+func encodePASETOClaims(claims Claims) ([]byte, error) {
+	encoded, err := json.Marshal(claims)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(encoded, &fields); err != nil {
+		return nil, err
+	}
+
+	for _, name := range pasetoDates {
+		if raw, ok := fields[name]; ok {
+			var date jwt.NumericDate
+			if err := json.Unmarshal(raw, &date); err != nil {
+				return nil, err
+			}
+			fields[name], _ = json.Marshal(date.UTC().Format(time.RFC3339))
+		}
+	}
+	return json.Marshal(fields)
+}
+
+// decodePASETOClaims decodes the JSON payload of a PASETO into claims.
+func decodePASETOClaims(payload []byte) (*Claims, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return nil, fmt.Errorf("%w: malformed claims", ErrPASETOInvalid)
+	}
+
+	for _, name := range pasetoDates {
+		if raw, ok := fields[name]; ok {
+			var date time.Time
+			if err := json.Unmarshal(raw, &date); err != nil {
+				return nil, fmt.Errorf("%w: malformed %s claim", ErrPASETOInvalid, name)
+			}
+			fields[name], _ = json.Marshal(jwt.NewNumericDate(date))
+		}
+	}
+
+	decoded, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	var claims Claims
+	if err := json.Unmarshal(decoded, &claims); err != nil {
+		return nil, fmt.Errorf("%w: malformed claims", ErrPASETOInvalid)
+	}
+	return &claims, nil
+}
@@ -0,0 +1,58 @@
+package accesstoken_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/ryanpujo/melius/accesstoken"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPASETOFormat(t *testing.T) {
+	// Test vectors 4-S-1 and 4-S-2 of the PASETO specification.
+	key, _ := hex.DecodeString("b4cbfb43df4ce210727d953e4a713307fa19bb7d9f85041438d9e11b942a3774" +
+		"1eb9dbbbbc047c03fd70604e0071f0987e16b28b757225c11f00415d0e20b1a2")
+	format := accesstoken.NewPASETOFormat(ed25519.PrivateKey(key))
+
+	for _, token := range []string{
+		"v4.public.eyJkYXRhIjoidGhpcyBpcyBhIHNpZ25lZCBtZXNzYWdlIiwiZXhwIjoiMjAyMi0wMS0wMVQwMDowMDowMCswMDowMCJ9" +
+			"bg_XBBzds8lTZShVlwwKSgeKpLT3yukTw6JUz3W4h_ExsQV-P0V54zemZDcAxFaSeef1QlXEFtkqxT1ciiQEDA",
+		"v4.public.eyJkYXRhIjoidGhpcyBpcyBhIHNpZ25lZCBtZXNzYWdlIiwiZXhwIjoiMjAyMi0wMS0wMVQwMDowMDowMCswMDowMCJ9" +
+			"v3Jt8mx_TdM2ceTGoqwrh4yDFn0XsHvvV_D0DtwQxVrJEBMl0F2caAdgnpKlt4p7xBnx1HcO-SPo8FPp214HDw" +
+			".eyJraWQiOiJ6VmhNaVBCUDlmUmYyc25FY1Q3Z0ZUaW9lQTlDT2NOeTlEZmdMMVc2MGhhTiJ9",
+	} {
+		claims, err := format.Verify(token)
+		require.NoError(t, err)
+		require.True(t, claims.ExpiresAt.Equal(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)))
+	}
+
+	claims := accesstoken.NewClaims(1, "ryanpujo")
+	claims.Roles = []string{"admin"}
+	claims.Bind("thumbprint")
+	claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(time.Minute).Truncate(time.Second))
+	token, err := format.Sign(claims)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(token, "v4.public."))
+
+	verified, err := format.Verify(token)
+	require.NoError(t, err)
+	require.Equal(t, claims, *verified)
+
+	_, err = format.Verify(token[:len(token)-2] + "AA")
+	require.ErrorIs(t, err, accesstoken.ErrPASETOInvalid)
+
+	_, other, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	_, err = accesstoken.NewPASETOFormat(other).Verify(token)
+	require.ErrorIs(t, err, accesstoken.ErrPASETOInvalid)
+
+	jwtToken, err := accesstoken.NewJWTFormat([]byte("key")).Sign(claims)
+	require.NoError(t, err)
+	_, err = format.Verify(jwtToken)
+	require.ErrorIs(t, err, accesstoken.ErrPASETOInvalid)
+}
@@ -2,28 +2,40 @@ package application
 
 import (
 	"fmt"
+	"net"
 	"net/http"
 	"time"
 
 	"github.com/ryanpujo/melius/config"
+	"google.golang.org/grpc"
 )
 
 // Application represents the server configuration.
 type Application struct {
 	Port    int          // Port on which the server will run
 	Handler http.Handler // HTTP handler (e.g., routes)
+	// GRPC is the gRPC API, served on GRPCPort alongside the HTTP server when both are set.
+	GRPC     *grpc.Server
+	GRPCPort int
+	// ExtAuthz is the gRPC server of the Envoy external authorization service,
+	// served on ExtAuthzPort alongside the HTTP server when both are set.
+	ExtAuthz     *grpc.Server
+	ExtAuthzPort int
 }
 
 // NewApp initializes a new Application with the given handler.
 func NewApp(handler http.Handler) *Application {
 	conf := config.Config()
 	return &Application{
-		Port:    conf.Port,
-		Handler: handler,
+		Port:         conf.Port,
+		Handler:      handler,
+		GRPCPort:     conf.GRPCPort,
+		ExtAuthzPort: conf.ExtAuthzPort,
 	}
 }
 
-// Serve starts the HTTP server with defined timeouts.
+// Serve starts the HTTP server with defined timeouts, and the gRPC servers that are
+// enabled. It returns when any of them stops.
 func (app *Application) Serve() error {
 	server := http.Server{
 		Addr:              fmt.Sprintf(":%d", app.Port),
@@ -34,6 +46,33 @@ func (app *Application) Serve() error {
 		IdleTimeout:       30 * time.Second,
 	}
 
+	errs := make(chan error, 3)
+	for _, s := range []struct {
+		name   string
+		server *grpc.Server
+		port   int
+	}{
+		{"gRPC", app.GRPC, app.GRPCPort},
+		{"ext_authz", app.ExtAuthz, app.ExtAuthzPort},
+	} {
+		if s.server == nil || s.port == 0 {
+			continue
+		}
+		listener, err := net.Listen("tcp", fmt.Sprintf(":%d", s.port))
+		if err != nil {
+			return err
+		}
+		defer s.server.Stop()
+
+		fmt.Printf("%s server is running on port %d\n", s.name, s.port)
+		go func() {
+			errs <- s.server.Serve(listener)
+		}()
+	}
+
 	fmt.Printf("Server is running on port %d\n", app.Port)
-	return server.ListenAndServe()
+	go func() {
+		errs <- server.ListenAndServe()
+	}()
+	return <-errs
 }
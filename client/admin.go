@@ -0,0 +1,257 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// The administration endpoints require the admin role and a recent authentication, or
+// an API key granted the admin scope. Changing roles and policies, impersonating and
+// erasing users always require a recent authentication, API keys cannot do them.
+
+// Attributes returns the definitions of the user attributes.
+func (c *Client) Attributes(ctx context.Context) ([]AttributeDefinition, error) {
+	var defs []AttributeDefinition
+	if _, err := c.call(ctx, request{method: http.MethodGet, path: "/admin/attributes", auth: true}, &defs); err != nil {
+		return nil, err
+	}
+	return defs, nil
+}
+
+// DefineAttribute creates or replaces the definition of the user attribute name.
+func (c *Client) DefineAttribute(ctx context.Context, name string, payload AttributeDefinitionPayload) (*AttributeDefinition, error) {
+	var def AttributeDefinition
+	req := request{method: http.MethodPut, path: "/admin/attributes/" + url.PathEscape(name), body: payload, auth: true}
+	if _, err := c.call(ctx, req, &def); err != nil {
+		return nil, err
+	}
+	return &def, nil
+}
+
+// DeleteAttribute deletes the definition of the user attribute name.
+func (c *Client) DeleteAttribute(ctx context.Context, name string) error {
+	_, err := c.call(ctx, request{method: http.MethodDelete, path: "/admin/attributes/" + url.PathEscape(name), auth: true}, nil)
+	return err
+}
+
+// Policies returns the authorization policies.
+func (c *Client) Policies(ctx context.Context) ([]Policy, error) {
+	var policies []Policy
+	if _, err := c.call(ctx, request{method: http.MethodGet, path: "/admin/policies", auth: true}, &policies); err != nil {
+		return nil, err
+	}
+	return policies, nil
+}
+
+// DefinePolicy creates or replaces the authorization policy name.
+func (c *Client) DefinePolicy(ctx context.Context, name string, payload PolicyPayload) (*Policy, error) {
+	var policy Policy
+	req := request{method: http.MethodPut, path: "/admin/policies/" + url.PathEscape(name), body: payload, auth: true}
+	if _, err := c.call(ctx, req, &policy); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// DeletePolicy deletes the authorization policy name.
+func (c *Client) DeletePolicy(ctx context.Context, name string) error {
+	_, err := c.call(ctx, request{method: http.MethodDelete, path: "/admin/policies/" + url.PathEscape(name), auth: true}, nil)
+	return err
+}
+
+// User returns a user.
+func (c *Client) User(ctx context.Context, id uint) (*User, error) {
+	var user User
+	if _, err := c.call(ctx, request{method: http.MethodGet, path: userPath(id), auth: true}, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// SetAttributes merges changes into the attributes of a user. An attribute set to nil is removed.
+func (c *Client) SetAttributes(ctx context.Context, id uint, changes map[string]any) (*User, error) {
+	var user User
+	req := request{method: http.MethodPatch, path: userPath(id) + "/attributes", body: changes, auth: true}
+	if _, err := c.call(ctx, req, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// AssignRole grants role to a user.
+func (c *Client) AssignRole(ctx context.Context, id uint, role string) error {
+	_, err := c.call(ctx, request{method: http.MethodPut, path: userPath(id) + "/roles/" + url.PathEscape(role), auth: true}, nil)
+	return err
+}
+
+// RevokeRole takes role away from a user.
+func (c *Client) RevokeRole(ctx context.Context, id uint, role string) error {
+	_, err := c.call(ctx, request{method: http.MethodDelete, path: userPath(id) + "/roles/" + url.PathEscape(role), auth: true}, nil)
+	return err
+}
+
+// Export returns the export of the personal data of a user.
+func (c *Client) Export(ctx context.Context, id uint) (*DataExport, error) {
+	var export DataExport
+	if err := c.do(ctx, request{method: http.MethodGet, path: userPath(id) + "/export", auth: true}, &export); err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+// Erase erases the account of a user.
+func (c *Client) Erase(ctx context.Context, id uint) error {
+	_, err := c.call(ctx, request{method: http.MethodPost, path: userPath(id) + "/erase", auth: true}, nil)
+	return err
+}
+
+// Impersonate returns a token for acting as a user. Unlike the tokens of logins, the
+// client does not use it; a separate client can, with SetToken.
+func (c *Client) Impersonate(ctx context.Context, id uint, payload ImpersonatePayload) (string, error) {
+	res, err := c.call(ctx, request{method: http.MethodPost, path: userPath(id) + "/impersonate", body: payload, auth: true}, nil)
+	if err != nil {
+		return "", err
+	}
+	return res.Token, nil
+}
+
+// AuditLog returns a page of the audit log filtered by query.
+func (c *Client) AuditLog(ctx context.Context, query AuditQuery) (*AuditPage, error) {
+	values := url.Values{}
+	if query.ActorID != nil {
+		values.Set("actor", strconv.FormatUint(uint64(*query.ActorID), 10))
+	}
+	if query.SubjectID != nil {
+		values.Set("subject", strconv.FormatUint(uint64(*query.SubjectID), 10))
+	}
+	if query.Action != "" {
+		values.Set("action", query.Action)
+	}
+	if query.Outcome != "" {
+		values.Set("outcome", query.Outcome)
+	}
+	if query.Since != nil {
+		values.Set("since", query.Since.Format(time.RFC3339))
+	}
+	if query.Until != nil {
+		values.Set("until", query.Until.Format(time.RFC3339))
+	}
+	if query.Cursor != 0 {
+		values.Set("cursor", strconv.FormatUint(query.Cursor, 10))
+	}
+	if query.Limit != 0 {
+		values.Set("limit", strconv.Itoa(query.Limit))
+	}
+
+	var page AuditPage
+	if _, err := c.call(ctx, request{method: http.MethodGet, path: "/admin/audit", query: values, auth: true}, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// VerifyAuditLog checks the hash chain of the whole audit log.
+func (c *Client) VerifyAuditLog(ctx context.Context) (*AuditVerification, error) {
+	var result AuditVerification
+	if _, err := c.call(ctx, request{method: http.MethodGet, path: "/admin/audit/verify", auth: true}, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ServiceAccounts returns the service accounts.
+func (c *Client) ServiceAccounts(ctx context.Context) ([]ServiceAccount, error) {
+	var accounts []ServiceAccount
+	if _, err := c.call(ctx, request{method: http.MethodGet, path: "/admin/service-accounts", auth: true}, &accounts); err != nil {
+		return nil, err
+	}
+	return accounts, nil
+}
+
+// CreateServiceAccount creates a service account.
+func (c *Client) CreateServiceAccount(ctx context.Context, payload ServiceAccountPayload) (*ServiceAccount, error) {
+	var account ServiceAccount
+	if _, err := c.call(ctx, request{method: http.MethodPost, path: "/admin/service-accounts", body: payload, auth: true}, &account); err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// ServiceAccount returns a service account.
+func (c *Client) ServiceAccount(ctx context.Context, id uint) (*ServiceAccount, error) {
+	var account ServiceAccount
+	if _, err := c.call(ctx, request{method: http.MethodGet, path: serviceAccountPath(id), auth: true}, &account); err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// UpdateServiceAccount updates a service account.
+func (c *Client) UpdateServiceAccount(ctx context.Context, id uint, payload UpdateServiceAccountPayload) (*ServiceAccount, error) {
+	var account ServiceAccount
+	req := request{method: http.MethodPatch, path: serviceAccountPath(id), body: payload, auth: true}
+	if _, err := c.call(ctx, req, &account); err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// DeleteServiceAccount deletes a service account.
+func (c *Client) DeleteServiceAccount(ctx context.Context, id uint) error {
+	_, err := c.call(ctx, request{method: http.MethodDelete, path: serviceAccountPath(id), auth: true}, nil)
+	return err
+}
+
+// AssignServiceAccountRole grants role to a service account.
+func (c *Client) AssignServiceAccountRole(ctx context.Context, id uint, role string) error {
+	req := request{method: http.MethodPut, path: serviceAccountPath(id) + "/roles/" + url.PathEscape(role), auth: true}
+	_, err := c.call(ctx, req, nil)
+	return err
+}
+
+// RevokeServiceAccountRole takes role away from a service account.
+func (c *Client) RevokeServiceAccountRole(ctx context.Context, id uint, role string) error {
+	req := request{method: http.MethodDelete, path: serviceAccountPath(id) + "/roles/" + url.PathEscape(role), auth: true}
+	_, err := c.call(ctx, req, nil)
+	return err
+}
+
+// ServiceAccountCredentials returns the credentials of a service account.
+func (c *Client) ServiceAccountCredentials(ctx context.Context, id uint) ([]ServiceAccountCredential, error) {
+	var credentials []ServiceAccountCredential
+	req := request{method: http.MethodGet, path: serviceAccountPath(id) + "/credentials", auth: true}
+	if _, err := c.call(ctx, req, &credentials); err != nil {
+		return nil, err
+	}
+	return credentials, nil
+}
+
+// CreateServiceAccountCredential creates a credential of a service account. A client
+// secret is only returned here.
+func (c *Client) CreateServiceAccountCredential(ctx context.Context, id uint, payload ServiceAccountCredentialPayload) (*CreatedServiceAccountCredential, error) {
+	var credential CreatedServiceAccountCredential
+	req := request{method: http.MethodPost, path: serviceAccountPath(id) + "/credentials", body: payload, auth: true}
+	if _, err := c.call(ctx, req, &credential); err != nil {
+		return nil, err
+	}
+	return &credential, nil
+}
+
+// DeleteServiceAccountCredential deletes a credential of a service account.
+func (c *Client) DeleteServiceAccountCredential(ctx context.Context, id uint, credentialID string) error {
+	req := request{method: http.MethodDelete, path: serviceAccountPath(id) + "/credentials/" + url.PathEscape(credentialID), auth: true}
+	_, err := c.call(ctx, req, nil)
+	return err
+}
+
+func userPath(id uint) string {
+	return fmt.Sprintf("/admin/users/%d", id)
+}
+
+func serviceAccountPath(id uint) string {
+	return fmt.Sprintf("/admin/service-accounts/%d", id)
+}
@@ -0,0 +1,142 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+)
+
+// Register creates a user and returns their ID.
+func (c *Client) Register(ctx context.Context, payload UserPayload) (uint, error) {
+	res, err := c.call(ctx, request{method: http.MethodPost, path: "/regis", body: payload}, nil)
+	if err != nil {
+		return 0, err
+	}
+	return res.ID, nil
+}
+
+// Login authenticates a user and returns their access token, which the client uses
+// from then on. Logins held for step-up verification fail with a *StepUpRequiredError.
+func (c *Client) Login(ctx context.Context, payload LoginPayload) (string, error) {
+	token, err := c.login(ctx, payload)
+	if err != nil {
+		return "", err
+	}
+	c.SetToken(token)
+	return token, nil
+}
+
+func (c *Client) login(ctx context.Context, payload LoginPayload) (string, error) {
+	res, err := c.call(ctx, request{method: http.MethodPost, path: "/login", body: payload}, nil)
+	var apiErr *Error
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusUnauthorized && len(apiErr.data) > 0 {
+		var stepUp StepUpRequiredError
+		if json.Unmarshal(apiErr.data, &stepUp) == nil && stepUp.ChallengeID != "" {
+			return "", &stepUp
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	return res.Token, nil
+}
+
+// VerifyLogin completes a login held for step-up verification with the code emailed
+// to the user, and returns their access token, which the client uses from then on.
+func (c *Client) VerifyLogin(ctx context.Context, payload VerifyLoginPayload) (string, error) {
+	res, err := c.call(ctx, request{method: http.MethodPost, path: "/login/verify", body: payload}, nil)
+	if err != nil {
+		return "", err
+	}
+	c.SetToken(res.Token)
+	return res.Token, nil
+}
+
+// Refresh returns a new access token for the session of the current one, which the
+// client uses from then on. Session tokens about to expire are refreshed without it.
+func (c *Client) Refresh(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token == "" {
+		return "", ErrNoCredentials
+	}
+	token, err := c.refresh(ctx, c.token)
+	if err != nil {
+		return "", err
+	}
+	c.setToken(token)
+	return token, nil
+}
+
+// Restore reopens a closed account within its retention window.
+func (c *Client) Restore(ctx context.Context, payload LoginPayload) error {
+	_, err := c.call(ctx, request{method: http.MethodPost, path: "/restore", body: payload}, nil)
+	return err
+}
+
+// Token requests a token from the OAuth token endpoint.
+func (c *Client) Token(ctx context.Context, req TokenRequest) (*TokenResponse, error) {
+	form := url.Values{}
+	for name, value := range map[string]string{
+		"grant_type":            req.GrantType,
+		"client_id":             req.ClientID,
+		"client_secret":         req.ClientSecret,
+		"client_assertion_type": req.ClientAssertionType,
+		"client_assertion":      req.ClientAssertion,
+		"subject_token":         req.SubjectToken,
+		"subject_token_type":    req.SubjectTokenType,
+		"requested_token_type":  req.RequestedTokenType,
+		"audience":              req.Audience,
+		"scope":                 req.Scope,
+		"device_code":           req.DeviceCode,
+	} {
+		if value != "" {
+			form.Set(name, value)
+		}
+	}
+
+	var res TokenResponse
+	if err := c.do(ctx, request{method: http.MethodPost, path: "/oauth/token", body: form, idempotent: true}, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// AuthorizeDevice starts the device authorization grant, returning the user code for
+// the user to approve and the device code to poll the token endpoint with.
+func (c *Client) AuthorizeDevice(ctx context.Context, req DeviceAuthorizationRequest) (*DeviceAuthorizationResponse, error) {
+	form := url.Values{"client_id": {req.ClientID}}
+	if req.Scope != "" {
+		form.Set("scope", req.Scope)
+	}
+
+	var res DeviceAuthorizationResponse
+	if err := c.do(ctx, request{method: http.MethodPost, path: "/oauth/device_authorization", body: form}, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Keys returns the public keys verifying the access tokens of melius, empty when
+// they are signed with a shared secret.
+func (c *Client) Keys(ctx context.Context) (*JWKS, error) {
+	var keys JWKS
+	if err := c.do(ctx, request{method: http.MethodGet, path: "/.well-known/jwks.json"}, &keys); err != nil {
+		return nil, err
+	}
+	return &keys, nil
+}
+
+// Check asks whether the authenticated principal may act on resource by the
+// authorization policy. A denial is a decision, not an error.
+func (c *Client) Check(ctx context.Context, policy string, resource map[string]any) (*AuthzDecision, error) {
+	var decision AuthzDecision
+	req := request{method: http.MethodPost, path: "/authz/check", body: AuthzCheckPayload{Policy: policy, Resource: resource}, auth: true}
+	if _, err := c.call(ctx, req, &decision); err != nil {
+		return nil, err
+	}
+	return &decision, nil
+}
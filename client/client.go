@@ -0,0 +1,342 @@
+// Package client is a Go client of the melius HTTP API, for services and tools that
+// register and authenticate users or administer melius.
+//
+//	c, err := client.New("https://auth.example.com", client.Options{
+//		Credentials: client.ClientCredentials{ClientID: "7", ClientSecret: secret},
+//	})
+//	user, err := c.User(ctx, 42)
+//
+// Requests of the protected endpoints carry the access token of the client, obtained
+// from its Credentials and obtained again when it is rejected. Tokens of user sessions
+// are refreshed before they expire, others are obtained again from the Credentials.
+// Failed requests return an *Error, which matches the errors of this package with
+// errors.Is.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMaxRetries is how many times failed requests are retried by default.
+	DefaultMaxRetries = 3
+	// DefaultBackoff is how long the first retry waits by default. Each retry waits
+	// twice as long as the previous one, up to maxBackoff.
+	DefaultBackoff = 200 * time.Millisecond
+	maxBackoff     = 5 * time.Second
+	// refreshSkew is how long before it expires the access token is refreshed or
+	// obtained again, so requests do not reach melius with a token expiring on the way.
+	refreshSkew = 30 * time.Second
+)
+
+// Options configures a Client.
+type Options struct {
+	// HTTPClient sends the requests, a client with a 10 second timeout and a cookie jar
+	// when nil. The jar keeps the device cookie melius sets at login, so logging in again
+	// is recognized as coming from the same device rather than asking for a step-up.
+	HTTPClient *http.Client
+	// Credentials obtain the access tokens of the protected endpoints. Without them,
+	// the token of the last Login, VerifyLogin or Reauthenticate is used.
+	Credentials Credentials
+	// MaxRetries is how many times requests failing with a server error or a network
+	// error are retried, DefaultMaxRetries when zero. Negative disables retries.
+	MaxRetries int
+	// Backoff is how long the first retry waits, DefaultBackoff when zero.
+	Backoff time.Duration
+	// UserAgent identifies the client to melius, which records it with sessions.
+	UserAgent string
+}
+
+// Client calls the melius HTTP API. It is safe for concurrent use.
+type Client struct {
+	baseURL     *url.URL
+	httpClient  *http.Client
+	credentials Credentials
+	maxRetries  int
+	backoff     time.Duration
+	userAgent   string
+
+	mu     sync.Mutex
+	token  string
+	claims tokenClaims
+}
+
+// New returns a Client of the melius API served at baseURL.
+func New(baseURL string, opts Options) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("client: invalid base URL %q", baseURL)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+
+	if opts.HTTPClient == nil {
+		jar, err := cookiejar.New(nil)
+		if err != nil {
+			return nil, fmt.Errorf("client: %w", err)
+		}
+		opts.HTTPClient = &http.Client{Timeout: 10 * time.Second, Jar: jar}
+	}
+	switch {
+	case opts.MaxRetries == 0:
+		opts.MaxRetries = DefaultMaxRetries
+	case opts.MaxRetries < 0:
+		opts.MaxRetries = 0
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = DefaultBackoff
+	}
+
+	return &Client{
+		baseURL:     u,
+		httpClient:  opts.HTTPClient,
+		credentials: opts.Credentials,
+		maxRetries:  opts.MaxRetries,
+		backoff:     opts.Backoff,
+		userAgent:   opts.UserAgent,
+	}, nil
+}
+
+// SetToken makes the client authenticate with token, until it obtains another one.
+func (c *Client) SetToken(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.setToken(token)
+}
+
+func (c *Client) setToken(token string) {
+	c.token, c.claims = token, parseToken(token)
+}
+
+// AccessToken returns the access token of the client, obtaining one from its
+// credentials if it has none or it is about to expire.
+func (c *Client) AccessToken(ctx context.Context) (string, error) {
+	return c.accessToken(ctx, "")
+}
+
+// accessToken returns the current access token. A token equal to rejected was refused
+// by melius and is obtained again from the credentials, unless another request already did.
+// Session tokens about to expire are refreshed, keeping their session.
+func (c *Client) accessToken(ctx context.Context, rejected string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stale := c.token == "" || c.token == rejected ||
+		!c.claims.ExpiresAt.IsZero() && time.Until(c.claims.ExpiresAt) < refreshSkew
+	if !stale {
+		return c.token, nil
+	}
+	if c.token != rejected && c.claims.SessionID != "" {
+		if token, err := c.refresh(ctx, c.token); err == nil {
+			c.setToken(token)
+			return token, nil
+		}
+	}
+	if c.credentials == nil {
+		if c.token == "" {
+			return "", ErrNoCredentials
+		}
+		return c.token, nil
+	}
+
+	token, err := c.credentials.Authenticate(ctx, c)
+	if err != nil {
+		return "", fmt.Errorf("failed to obtain access token: %w", err)
+	}
+	c.setToken(token)
+	return token, nil
+}
+
+// refresh returns a new token for the session of token from the refresh endpoint.
+// It sends the request itself, as do would ask accessToken for a token.
+func (c *Client) refresh(ctx context.Context, token string) (string, error) {
+	res, err := c.send(ctx, request{method: http.MethodPost, path: "/auth/refresh"}, token)
+	if err != nil {
+		return "", err
+	}
+	if res.StatusCode >= http.StatusBadRequest {
+		return "", decodeError(res)
+	}
+	defer res.Body.Close()
+
+	var body response
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("failed to decode response: %w", err)
+	}
+	if body.Token == "" {
+		return "", errors.New("response has no token")
+	}
+	return body.Token, nil
+}
+
+// request is a request of the API.
+type request struct {
+	method string
+	path   string
+	query  url.Values
+	// body is encoded as JSON, or sent form encoded when it is url.Values.
+	body any
+	// auth authenticates the request with the access token.
+	auth bool
+	// idempotent marks POST requests retried like GET, PUT and DELETE requests,
+	// as repeating them has no further effect.
+	idempotent bool
+}
+
+// do sends req and decodes the JSON body of a successful response into out, unless
+// it is nil. Requests rejected for their access token are sent again once with a new
+// token obtained from the credentials.
+func (c *Client) do(ctx context.Context, req request, out any) error {
+	var token string
+	if req.auth {
+		var err error
+		if token, err = c.accessToken(ctx, ""); err != nil {
+			return err
+		}
+	}
+
+	res, err := c.send(ctx, req, token)
+	if err != nil {
+		return err
+	}
+	if req.auth && res.StatusCode == http.StatusUnauthorized && c.credentials != nil {
+		// Challenges such as a required reauthentication are not met by another token.
+		if apiErr := decodeError(res); apiErr.Code != "" {
+			return apiErr
+		}
+		if token, err = c.accessToken(ctx, token); err != nil {
+			return err
+		}
+		if res, err = c.send(ctx, req, token); err != nil {
+			return err
+		}
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= http.StatusBadRequest {
+		return decodeError(res)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// send sends req, retrying it with backoff while it fails with a server error or a
+// network error, if it is idempotent. The response body must be closed.
+func (c *Client) send(ctx context.Context, req request, token string) (*http.Response, error) {
+	retries := 0
+	if req.idempotent || req.method == http.MethodGet || req.method == http.MethodPut || req.method == http.MethodDelete {
+		retries = c.maxRetries
+	}
+
+	for attempt := 0; ; attempt++ {
+		httpReq, err := c.newRequest(ctx, req, token)
+		if err != nil {
+			return nil, err
+		}
+		res, err := c.httpClient.Do(httpReq)
+		if attempt == retries || err == nil && res.StatusCode < http.StatusInternalServerError {
+			if err != nil {
+				return nil, fmt.Errorf("failed to send request: %w", err)
+			}
+			return res, nil
+		}
+		if err == nil {
+			io.Copy(io.Discard, res.Body)
+			res.Body.Close()
+		}
+
+		// Jitter keeps clients failing together from retrying together.
+		wait := min(c.backoff<<attempt, maxBackoff)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(rand.N(wait) + wait/2):
+		}
+	}
+}
+
+func (c *Client) newRequest(ctx context.Context, req request, token string) (*http.Request, error) {
+	u := c.baseURL.JoinPath(req.path)
+	u.RawQuery = req.query.Encode()
+
+	var (
+		body        io.Reader
+		contentType string
+	)
+	switch b := req.body.(type) {
+	case nil:
+	case url.Values:
+		body, contentType = strings.NewReader(b.Encode()), "application/x-www-form-urlencoded"
+	default:
+		encoded, err := json.Marshal(b)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode request: %w", err)
+		}
+		body, contentType = bytes.NewReader(encoded), "application/json"
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		httpReq.Header.Set("Content-Type", contentType)
+	}
+	if token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+token)
+	}
+	if c.userAgent != "" {
+		httpReq.Header.Set("User-Agent", c.userAgent)
+	}
+	return httpReq, nil
+}
+
+// response is the envelope of the responses of the API, utilities.Response on the server.
+type response struct {
+	ID      uint            `json:"id,omitempty"`
+	Token   string          `json:"token,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"`
+	Message string          `json:"message,omitempty"`
+}
+
+// data decodes the data of the envelope into out.
+func (r *response) data(out any) error {
+	if len(r.Data) == 0 {
+		return errors.New("response has no data")
+	}
+	if err := json.Unmarshal(r.Data, out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// call sends req and decodes the data of its response envelope into out, unless it is nil.
+func (c *Client) call(ctx context.Context, req request, out any) (*response, error) {
+	var res response
+	if err := c.do(ctx, req, &res); err != nil {
+		return nil, err
+	}
+	if out != nil {
+		if err := res.data(out); err != nil {
+			return nil, err
+		}
+	}
+	return &res, nil
+}
@@ -0,0 +1,276 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/ryanpujo/melius/client"
+	"github.com/ryanpujo/melius/client/clienttest"
+	"github.com/ryanpujo/melius/internal/adapter"
+	"github.com/ryanpujo/melius/internal/controllers"
+	"github.com/ryanpujo/melius/internal/jwttoken"
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/ryanpujo/melius/internal/requestinfo"
+	"github.com/ryanpujo/melius/internal/route"
+	"github.com/ryanpujo/melius/internal/services"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// CredentialServiceMock stubs the credential service. Methods the tests do not
+// expect fall through to the nil interface and panic.
+type CredentialServiceMock struct {
+	mock.Mock
+	services.CredentialInterface
+}
+
+func (csm *CredentialServiceMock) Write(ctx context.Context, payload models.UserPayload) (uint, error) {
+	args := csm.Called(payload)
+	return args.Get(0).(uint), args.Error(1)
+}
+
+func (csm *CredentialServiceMock) Login(ctx context.Context, payload *models.LoginPayload) (string, error) {
+	args := csm.Called(payload.Login())
+	return args.String(0), args.Error(1)
+}
+
+func (csm *CredentialServiceMock) VerifyLogin(ctx context.Context, payload models.VerifyLoginPayload) (string, error) {
+	args := csm.Called(payload)
+	return args.String(0), args.Error(1)
+}
+
+// UserServiceMock stubs the user service like CredentialServiceMock.
+type UserServiceMock struct {
+	mock.Mock
+	services.UserInterface
+}
+
+func (usm *UserServiceMock) Profile(ctx context.Context, id uint) (*models.User, error) {
+	args := usm.Called(id)
+	return args.Get(0).(*models.User), args.Error(1)
+}
+
+func (csm *CredentialServiceMock) Refresh(ctx context.Context, identity jwttoken.Identity) (string, error) {
+	args := csm.Called(identity.SessionID)
+	return args.String(0), args.Error(1)
+}
+
+// newHandler returns the routes of melius served by controllers of the stubbed services.
+func newHandler(credService *CredentialServiceMock, userService *UserServiceMock) http.Handler {
+	gin.SetMode(gin.TestMode)
+	return route.SetupRoutes(&adapter.Adapter{
+		CredentialController: controllers.NewCredentialController(credService, nil),
+		UserController:       controllers.NewUserController(userService),
+		TokenController:      controllers.NewTokenController(nil, nil, jwttoken.NewReplayCache()),
+		ReauthMaxAge:         time.Minute,
+	})
+}
+
+// newToken issues a token of user 1, changed by modify.
+func newToken(t *testing.T, modify func(claims *jwttoken.Claims)) string {
+	claims := jwttoken.NewClaims(1, "ryanpujo")
+	if modify != nil {
+		modify(&claims)
+	}
+	token, err := jwttoken.GenerateToken(claims)
+	require.NoError(t, err)
+	return token
+}
+
+func TestContract(t *testing.T) {
+	credService, userService := new(CredentialServiceMock), new(UserServiceMock)
+	c := clienttest.NewClient(t, newHandler(credService, userService), client.Options{})
+	ctx := context.Background()
+
+	payload := client.UserPayload{
+		FirstName: "ryan",
+		LastName:  "pujo",
+		CredentialPayload: client.CredentialPayload{
+			Email:    "ryan@example.com",
+			Username: "ryanpujo",
+			Password: "secret",
+		},
+	}
+	credService.On("Write", payload).Return(uint(1), nil).Once()
+	id, err := c.Register(ctx, payload)
+	require.NoError(t, err)
+	require.Equal(t, uint(1), id)
+
+	payload.CredentialPayload.Email = "not an email"
+	_, err = c.Register(ctx, payload)
+	require.ErrorIs(t, err, client.ErrBadRequest)
+	var apiErr *client.Error
+	require.ErrorAs(t, err, &apiErr)
+	require.Equal(t, "Validation error", apiErr.Message)
+	require.NotEmpty(t, apiErr.Detail)
+
+	_, err = c.Me(ctx)
+	require.ErrorIs(t, err, client.ErrNoCredentials)
+
+	token := newToken(t, nil)
+	credService.On("Login", "ryanpujo").Return(token, nil).Once()
+	login, err := c.Login(ctx, client.LoginPayload{Identifier: "ryanpujo", Password: "secret"})
+	require.NoError(t, err)
+	require.Equal(t, token, login)
+
+	user := &models.User{ID: 1, FirstName: "ryan", Credential: models.Credential{Username: "ryanpujo"}}
+	userService.On("Profile", uint(1)).Return(user, nil).Once()
+	me, err := c.Me(ctx)
+	require.NoError(t, err)
+	require.Equal(t, user, me)
+
+	// The token has no authentication time, so the user must authenticate again.
+	err = c.CloseAccount(ctx, client.CloseAccountPayload{Password: "secret"})
+	require.ErrorIs(t, err, client.ErrReauthenticationRequired)
+	require.ErrorIs(t, err, client.ErrUnauthorized)
+
+	expiresAt := time.Now().Add(10 * time.Minute).UTC().Truncate(time.Second)
+	credService.On("Login", "pujo").Return("", &services.StepUpRequiredError{ChallengeID: "challenge", ExpiresAt: expiresAt}).Once()
+	_, err = c.Login(ctx, client.LoginPayload{Identifier: "pujo", Password: "secret"})
+	var stepUp *client.StepUpRequiredError
+	require.ErrorAs(t, err, &stepUp)
+	require.Equal(t, "challenge", stepUp.ChallengeID)
+	require.True(t, expiresAt.Equal(stepUp.ExpiresAt))
+
+	verify := client.VerifyLoginPayload{ChallengeID: "challenge", Code: "123456"}
+	credService.On("VerifyLogin", verify).Return(token, nil).Once()
+	_, err = c.VerifyLogin(ctx, verify)
+	require.NoError(t, err)
+
+	_, err = c.Token(ctx, client.TokenRequest{GrantType: "password"})
+	require.ErrorIs(t, err, client.ErrBadRequest)
+	require.ErrorAs(t, err, &apiErr)
+	require.Equal(t, models.OAuthUnsupportedGrantType, apiErr.Code)
+
+	credService.AssertExpectations(t)
+	userService.AssertExpectations(t)
+}
+
+func TestTokenRefresh(t *testing.T) {
+	credService, userService := new(CredentialServiceMock), new(UserServiceMock)
+	c := clienttest.NewClient(t, newHandler(credService, userService), client.Options{
+		Credentials: client.Password{Identifier: "ryanpujo", Password: "secret"},
+	})
+	ctx := context.Background()
+	user := &models.User{ID: 1}
+	userService.On("Profile", uint(1)).Return(user, nil)
+
+	// The first request logs in.
+	credService.On("Login", "ryanpujo").Return(newToken(t, nil), nil).Once()
+	_, err := c.Me(ctx)
+	require.NoError(t, err)
+	_, err = c.Me(ctx)
+	require.NoError(t, err)
+
+	// Tokens about to expire are replaced before they are sent, by refreshing their
+	// session when they have one.
+	expiring := func(sessionID string) string {
+		return newToken(t, func(claims *jwttoken.Claims) {
+			claims.SessionID = sessionID
+			claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(10 * time.Second))
+		})
+	}
+	refreshed := newToken(t, func(claims *jwttoken.Claims) { claims.SessionID = "sid" })
+	c.SetToken(expiring("sid"))
+	credService.On("Refresh", "sid").Return(refreshed, nil).Once()
+	_, err = c.Me(ctx)
+	require.NoError(t, err)
+	token, err := c.AccessToken(ctx)
+	require.NoError(t, err)
+	require.Equal(t, refreshed, token)
+
+	c.SetToken(expiring(""))
+	credService.On("Login", "ryanpujo").Return(newToken(t, nil), nil).Once()
+	_, err = c.Me(ctx)
+	require.NoError(t, err)
+
+	// Sessions that can no longer be refreshed are opened again.
+	c.SetToken(expiring("ended"))
+	credService.On("Refresh", "ended").Return("", errors.New("session revoked")).Once()
+	credService.On("Login", "ryanpujo").Return(newToken(t, nil), nil).Once()
+	_, err = c.Me(ctx)
+	require.NoError(t, err)
+
+	// Rejected tokens are replaced and the request sent again.
+	valid, other := newToken(t, nil), newToken(t, nil)
+	forged := valid[:strings.LastIndex(valid, ".")] + other[strings.LastIndex(other, "."):]
+	c.SetToken(forged)
+	credService.On("Login", "ryanpujo").Return(valid, nil).Once()
+	_, err = c.Me(ctx)
+	require.NoError(t, err)
+	token, err = c.AccessToken(ctx)
+	require.NoError(t, err)
+	require.Equal(t, valid, token)
+
+	// Credentials that are no longer accepted fail the request.
+	c.SetToken(forged)
+	credService.On("Login", "ryanpujo").Return("", services.ErrLoginBlocked).Once()
+	_, err = c.Me(ctx)
+	require.ErrorIs(t, err, client.ErrForbidden)
+
+	credService.AssertExpectations(t)
+}
+
+func TestDeviceCookie(t *testing.T) {
+	credService, userService := new(CredentialServiceMock), new(UserServiceMock)
+	var devices []string
+	handler := newHandler(credService, userService)
+	c := clienttest.NewClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			cookie, _ := r.Cookie(requestinfo.DeviceCookie)
+			devices = append(devices, cookie.String())
+		}
+		handler.ServeHTTP(w, r)
+	}), client.Options{})
+	ctx := context.Background()
+
+	// Logging in again comes from the device melius assigned at the first login.
+	credService.On("Login", "ryanpujo").Return(newToken(t, nil), nil).Twice()
+	_, err := c.Login(ctx, client.LoginPayload{Identifier: "ryanpujo", Password: "secret"})
+	require.NoError(t, err)
+	_, err = c.Login(ctx, client.LoginPayload{Identifier: "ryanpujo", Password: "secret"})
+	require.NoError(t, err)
+	require.Len(t, devices, 2)
+	require.Empty(t, devices[0])
+	require.Contains(t, devices[1], requestinfo.DeviceCookie+"=")
+	credService.AssertExpectations(t)
+}
+
+func TestRetry(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`{"keys":[]}`))
+	}))
+	defer server.Close()
+
+	c, err := client.New(server.URL, client.Options{Backoff: time.Millisecond})
+	require.NoError(t, err)
+	_, err = c.Keys(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, int32(3), calls.Load())
+
+	// Requests that may have taken effect are not retried.
+	calls.Store(0)
+	_, err = c.Register(context.Background(), client.UserPayload{})
+	require.ErrorIs(t, err, client.ErrServer)
+	require.Equal(t, int32(1), calls.Load())
+
+	c, err = client.New(server.URL, client.Options{Backoff: time.Millisecond, MaxRetries: 1})
+	require.NoError(t, err)
+	calls.Store(0)
+	_, err = c.Keys(context.Background())
+	require.ErrorIs(t, err, client.ErrServer)
+	require.Equal(t, int32(2), calls.Load())
+}
@@ -0,0 +1,40 @@
+// Package clienttest serves a melius API in-process, for contract tests of the client
+// against the handler the server runs, or against a fake of it outside melius.
+//
+//	handler := route.SetupRoutes(registry.NewRegistry(db).NewAppControllers())
+//	c := clienttest.NewClient(t, handler, client.Options{})
+//
+// Within melius, the routes may also be built from controllers of stubbed services.
+package clienttest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ryanpujo/melius/client"
+)
+
+// NewServer serves handler until the test ends, and returns its URL.
+func NewServer(t testing.TB, handler http.Handler) string {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+// NewClient serves handler like NewServer and returns a client of it. Failed requests
+// are not retried unless opts ask for it, so tests see server errors at once.
+func NewClient(t testing.TB, handler http.Handler, opts client.Options) *client.Client {
+	t.Helper()
+	if opts.MaxRetries == 0 {
+		opts.MaxRetries = -1
+	}
+
+	c, err := client.New(NewServer(t, handler), opts)
+	if err != nil {
+		t.Fatalf("clienttest: %v", err)
+	}
+	return c
+}
@@ -0,0 +1,98 @@
+package client
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// Credentials obtain access tokens for a Client, when it has none or its token is
+// about to expire or was rejected.
+type Credentials interface {
+	Authenticate(ctx context.Context, c *Client) (string, error)
+}
+
+// Password logs in as a user. Logins held for step-up verification fail with a
+// *StepUpRequiredError, which an unattended client cannot complete.
+type Password struct {
+	// Identifier is the username or email address of the user.
+	Identifier string
+	Password   string
+}
+
+func (p Password) Authenticate(ctx context.Context, c *Client) (string, error) {
+	return c.login(ctx, LoginPayload{Identifier: p.Identifier, Password: p.Password})
+}
+
+// ClientCredentials obtain tokens of a service account with the client credentials grant.
+type ClientCredentials struct {
+	// ClientID is the ID of the service account.
+	ClientID     string
+	ClientSecret string
+	// Scope limits the tokens to the space separated scopes, unless it is empty.
+	Scope string
+}
+
+func (cc ClientCredentials) Authenticate(ctx context.Context, c *Client) (string, error) {
+	res, err := c.Token(ctx, TokenRequest{
+		GrantType:    GrantClientCredentials,
+		ClientID:     cc.ClientID,
+		ClientSecret: cc.ClientSecret,
+		Scope:        cc.Scope,
+	})
+	if err != nil {
+		return "", err
+	}
+	return res.AccessToken, nil
+}
+
+// tokenClaims are the claims of an access token the client relies on.
+type tokenClaims struct {
+	// ExpiresAt is the zero time when the client cannot tell.
+	ExpiresAt time.Time
+	// SessionID is the session of the tokens of users, which can be refreshed.
+	SessionID string
+}
+
+// parseToken returns the claims of the JWT or v4.public PASETO token, without
+// verifying it, or zero claims when it cannot tell.
+func parseToken(token string) tokenClaims {
+	var payload []byte
+	if body, ok := strings.CutPrefix(token, "v4.public."); ok {
+		body, _, _ = strings.Cut(body, ".")
+		signed, err := base64.RawURLEncoding.DecodeString(body)
+		if err != nil || len(signed) < ed25519.SignatureSize {
+			return tokenClaims{}
+		}
+		payload = signed[:len(signed)-ed25519.SignatureSize]
+	} else {
+		parts := strings.Split(token, ".")
+		if len(parts) != 3 {
+			return tokenClaims{}
+		}
+		var err error
+		if payload, err = base64.RawURLEncoding.DecodeString(parts[1]); err != nil {
+			return tokenClaims{}
+		}
+	}
+
+	// JWTs have numeric dates, PASETOs RFC 3339 dates.
+	var claims struct {
+		Exp any    `json:"exp"`
+		Sid string `json:"sid"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return tokenClaims{}
+	}
+	parsed := tokenClaims{SessionID: claims.Sid}
+	switch exp := claims.Exp.(type) {
+	case float64:
+		parsed.ExpiresAt = time.Unix(int64(exp), 0)
+	case string:
+		parsed.ExpiresAt, _ = time.Parse(time.RFC3339, exp)
+	}
+	return parsed
+}
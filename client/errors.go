@@ -0,0 +1,164 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNoCredentials is returned for requests of protected endpoints by clients
+	// without credentials that did not log in.
+	ErrNoCredentials = errors.New("client: no access token, log in or configure credentials")
+
+	// ErrBadRequest matches errors of requests melius refused as invalid.
+	ErrBadRequest = errors.New("bad request")
+	// ErrUnauthorized matches errors of requests without a valid access token or credentials.
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrForbidden matches errors of requests not allowed to the caller.
+	ErrForbidden = errors.New("forbidden")
+	// ErrNotFound matches errors of requests of missing resources.
+	ErrNotFound = errors.New("not found")
+	// ErrConflict matches errors of requests conflicting with the state of a resource.
+	ErrConflict = errors.New("conflict")
+	// ErrServer matches errors of requests melius failed to serve.
+	ErrServer = errors.New("server error")
+
+	// ErrReauthenticationRequired matches errors of sensitive requests of users who did
+	// not authenticate recently or strongly enough. See Client.Reauthenticate.
+	ErrReauthenticationRequired = errors.New("reauthentication required")
+	// ErrInvalidGrant matches errors of the token endpoint refusing a grant, such as an
+	// expired device code or a subject token that cannot be exchanged.
+	ErrInvalidGrant = errors.New("invalid grant")
+	// ErrAuthorizationPending matches errors of devices polling for a token the user
+	// did not decide on yet.
+	ErrAuthorizationPending = errors.New("authorization pending")
+	// ErrSlowDown matches errors of devices polling for a token too often.
+	ErrSlowDown = errors.New("slow down")
+	// ErrAccessDenied matches errors of devices polling for a token the user denied.
+	ErrAccessDenied = errors.New("access denied")
+	// ErrExpiredToken matches errors of devices polling with an expired device code.
+	ErrExpiredToken = errors.New("expired token")
+)
+
+// statusErrors map the status codes of responses to the errors they match.
+var statusErrors = map[int]error{
+	http.StatusBadRequest:   ErrBadRequest,
+	http.StatusUnauthorized: ErrUnauthorized,
+	http.StatusForbidden:    ErrForbidden,
+	http.StatusNotFound:     ErrNotFound,
+	http.StatusConflict:     ErrConflict,
+}
+
+// codeErrors map the error codes of responses to the errors they match. The codes
+// are those of the OAuth endpoints and of WWW-Authenticate challenges.
+var codeErrors = map[string]error{
+	"insufficient_user_authentication": ErrReauthenticationRequired,
+	"invalid_grant":                    ErrInvalidGrant,
+	"authorization_pending":            ErrAuthorizationPending,
+	"slow_down":                        ErrSlowDown,
+	"access_denied":                    ErrAccessDenied,
+	"expired_token":                    ErrExpiredToken,
+}
+
+// Error is the error response of a failed request.
+type Error struct {
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int
+	// Code is the error code of OAuth responses and authentication challenges, empty otherwise.
+	Code string
+	// Message describes the failure.
+	Message string
+	// Detail is the cause of the failure, if melius tells it.
+	Detail string
+
+	// data is the data of the response envelope, which some failures carry.
+	data json.RawMessage
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("melius: %d", e.StatusCode)
+	if e.Code != "" {
+		msg += " " + e.Code
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	return msg
+}
+
+// Is matches e with the errors of this package for its status code and error code.
+func (e *Error) Is(target error) bool {
+	if e.StatusCode >= http.StatusInternalServerError {
+		return target == ErrServer
+	}
+	return statusErrors[e.StatusCode] == target || e.Code != "" && codeErrors[e.Code] == target
+}
+
+// StepUpRequiredError is returned by Login for a login melius holds until it is
+// confirmed with the code emailed to the user. See Client.VerifyLogin.
+type StepUpRequiredError struct {
+	ChallengeID string    `json:"challenge_id"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+func (e *StepUpRequiredError) Error() string {
+	return "melius: additional verification required"
+}
+
+// errorBody holds the members of the three shapes of error responses: the envelope
+// of most endpoints, the OAuth errors and the errors of the authentication middleware.
+type errorBody struct {
+	Message     string          `json:"message"`
+	Err         string          `json:"err"`
+	Data        json.RawMessage `json:"data"`
+	Error       string          `json:"error"`
+	Description string          `json:"error_description"`
+}
+
+// decodeError returns the error of a failed response, and closes its body.
+func decodeError(res *http.Response) *Error {
+	defer res.Body.Close()
+
+	apiErr := &Error{StatusCode: res.StatusCode, Code: challengeCode(res.Header.Get("WWW-Authenticate"))}
+	var body errorBody
+	if err := json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(&body); err != nil {
+		apiErr.Message = http.StatusText(res.StatusCode)
+		return apiErr
+	}
+
+	switch {
+	case body.Message != "" || body.Err != "":
+		apiErr.Message, apiErr.Detail, apiErr.data = body.Message, body.Err, body.Data
+	case apiErr.Code == "" && isCode(body.Error):
+		apiErr.Code, apiErr.Message = body.Error, body.Description
+	default:
+		apiErr.Message = body.Error
+	}
+	return apiErr
+}
+
+// isCode reports whether s is an OAuth error code rather than a message, as the
+// authentication middleware and the OAuth endpoints share the error member.
+func isCode(s string) bool {
+	return s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return (r < 'a' || r > 'z') && r != '_'
+	}) < 0
+}
+
+// challengeCode returns the error parameter of a WWW-Authenticate challenge.
+func challengeCode(challenge string) string {
+	_, rest, ok := strings.Cut(challenge, `error="`)
+	if !ok {
+		return ""
+	}
+	code, _, _ := strings.Cut(rest, `"`)
+	return code
+}
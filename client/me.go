@@ -0,0 +1,190 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// Logout ends the session of the access token and forgets the token.
+func (c *Client) Logout(ctx context.Context) error {
+	if _, err := c.call(ctx, request{method: http.MethodPost, path: "/auth/logout", auth: true}, nil); err != nil {
+		return err
+	}
+	c.SetToken("")
+	return nil
+}
+
+// Me returns the logged-in user.
+func (c *Client) Me(ctx context.Context) (*User, error) {
+	var user User
+	if _, err := c.call(ctx, request{method: http.MethodGet, path: "/auth/me", auth: true}, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// UpdateMe updates the profile of the logged-in user.
+func (c *Client) UpdateMe(ctx context.Context, payload UpdateUserPayload) (*User, error) {
+	var user User
+	if _, err := c.call(ctx, request{method: http.MethodPatch, path: "/auth/me", body: payload, auth: true}, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// CloseAccount closes the account of the logged-in user, who may restore it within
+// the retention window. It requires a recent authentication. Every session of the
+// account is ended and its API keys are revoked.
+func (c *Client) CloseAccount(ctx context.Context, payload CloseAccountPayload) error {
+	_, err := c.call(ctx, request{method: http.MethodDelete, path: "/auth/me", body: payload, auth: true}, nil)
+	return err
+}
+
+// Reauthenticate confirms the password of the logged-in user and returns a token for
+// the current session with a fresh authentication time, which the client uses from then on.
+func (c *Client) Reauthenticate(ctx context.Context, payload ReauthPayload) (string, error) {
+	res, err := c.call(ctx, request{method: http.MethodPost, path: "/auth/me/reauth", body: payload, auth: true}, nil)
+	if err != nil {
+		return "", err
+	}
+	c.SetToken(res.Token)
+	return res.Token, nil
+}
+
+// ChangePassword changes the password of the logged-in user. It requires a recent authentication.
+func (c *Client) ChangePassword(ctx context.Context, payload ChangePasswordPayload) error {
+	_, err := c.call(ctx, request{method: http.MethodPost, path: "/auth/me/password", body: payload, auth: true}, nil)
+	return err
+}
+
+// ChangeEmail requests a change of the email address of the logged-in user, confirmed
+// with ConfirmEmail. It requires a recent authentication.
+func (c *Client) ChangeEmail(ctx context.Context, payload ChangeEmailPayload) error {
+	_, err := c.call(ctx, request{method: http.MethodPost, path: "/auth/me/email", body: payload, auth: true}, nil)
+	return err
+}
+
+// ConfirmEmail confirms the change of email address with the code sent to the new address.
+func (c *Client) ConfirmEmail(ctx context.Context, payload ConfirmEmailPayload) error {
+	_, err := c.call(ctx, request{method: http.MethodPost, path: "/auth/me/email/confirm", body: payload, auth: true}, nil)
+	return err
+}
+
+// ChangeUsername changes the username of the logged-in user. It requires a recent authentication.
+func (c *Client) ChangeUsername(ctx context.Context, payload ChangeUsernamePayload) (*User, error) {
+	var user User
+	if _, err := c.call(ctx, request{method: http.MethodPost, path: "/auth/me/username", body: payload, auth: true}, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// History returns the changes of the username and email address of the logged-in user.
+func (c *Client) History(ctx context.Context) ([]IdentifierChange, error) {
+	var history []IdentifierChange
+	if _, err := c.call(ctx, request{method: http.MethodGet, path: "/auth/me/history", auth: true}, &history); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// ExportMe returns the export of the personal data of the logged-in user.
+func (c *Client) ExportMe(ctx context.Context) (*DataExport, error) {
+	var export DataExport
+	if err := c.do(ctx, request{method: http.MethodGet, path: "/auth/me/export", auth: true}, &export); err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+// EraseMe erases the account of the logged-in user. It requires a recent authentication.
+func (c *Client) EraseMe(ctx context.Context, payload ErasePayload) error {
+	_, err := c.call(ctx, request{method: http.MethodPost, path: "/auth/me/erase", body: payload, auth: true}, nil)
+	return err
+}
+
+// Sessions returns the active sessions of the logged-in user.
+func (c *Client) Sessions(ctx context.Context) ([]Session, error) {
+	var sessions []Session
+	if _, err := c.call(ctx, request{method: http.MethodGet, path: "/auth/me/sessions", auth: true}, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// RevokeSession revokes a session of the logged-in user.
+func (c *Client) RevokeSession(ctx context.Context, id string) error {
+	_, err := c.call(ctx, request{method: http.MethodDelete, path: "/auth/me/sessions/" + url.PathEscape(id), auth: true}, nil)
+	return err
+}
+
+// Logins returns the recent logins of the logged-in user, including ended sessions.
+func (c *Client) Logins(ctx context.Context) ([]Session, error) {
+	var sessions []Session
+	if _, err := c.call(ctx, request{method: http.MethodGet, path: "/auth/me/logins", auth: true}, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// CreateAPIKey creates an API key of the logged-in user. The key itself is only
+// returned here. It requires a recent authentication.
+func (c *Client) CreateAPIKey(ctx context.Context, payload APIKeyPayload) (*CreatedAPIKey, error) {
+	var key CreatedAPIKey
+	if _, err := c.call(ctx, request{method: http.MethodPost, path: "/auth/me/api-keys", body: payload, auth: true}, &key); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// APIKeys returns the API keys of the logged-in user.
+func (c *Client) APIKeys(ctx context.Context) ([]APIKey, error) {
+	var keys []APIKey
+	if _, err := c.call(ctx, request{method: http.MethodGet, path: "/auth/me/api-keys", auth: true}, &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// APIKey returns an API key of the logged-in user.
+func (c *Client) APIKey(ctx context.Context, id string) (*APIKey, error) {
+	var key APIKey
+	if _, err := c.call(ctx, request{method: http.MethodGet, path: "/auth/me/api-keys/" + url.PathEscape(id), auth: true}, &key); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// UpdateAPIKey updates an API key of the logged-in user. It requires a recent authentication.
+func (c *Client) UpdateAPIKey(ctx context.Context, id string, payload UpdateAPIKeyPayload) (*APIKey, error) {
+	var key APIKey
+	if _, err := c.call(ctx, request{method: http.MethodPatch, path: "/auth/me/api-keys/" + url.PathEscape(id), body: payload, auth: true}, &key); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// DeleteAPIKey deletes an API key of the logged-in user.
+func (c *Client) DeleteAPIKey(ctx context.Context, id string) error {
+	_, err := c.call(ctx, request{method: http.MethodDelete, path: "/auth/me/api-keys/" + url.PathEscape(id), auth: true}, nil)
+	return err
+}
+
+// LookupDevice returns the pending device authorization of a user code, for the
+// logged-in user to review before deciding. It requires a recent authentication.
+func (c *Client) LookupDevice(ctx context.Context, userCode string) (*DeviceAuthorization, error) {
+	var authorization DeviceAuthorization
+	req := request{method: http.MethodGet, path: "/auth/me/device", query: url.Values{"user_code": {userCode}}, auth: true}
+	if _, err := c.call(ctx, req, &authorization); err != nil {
+		return nil, err
+	}
+	return &authorization, nil
+}
+
+// DecideDevice approves or denies the device authorization of a user code for the logged-in user.
+// It requires a recent authentication.
+func (c *Client) DecideDevice(ctx context.Context, payload DeviceDecisionPayload) error {
+	_, err := c.call(ctx, request{method: http.MethodPost, path: "/auth/me/device", body: payload, auth: true}, nil)
+	return err
+}
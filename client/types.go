@@ -0,0 +1,71 @@
+package client
+
+import (
+	"github.com/ryanpujo/melius/accesstoken"
+	"github.com/ryanpujo/melius/internal/models"
+)
+
+// The payloads and resources of the API are those of melius itself, so the client
+// and the server cannot disagree on them.
+type (
+	User                  = models.User
+	UserPayload           = models.UserPayload
+	CredentialPayload     = models.CredentialPayload
+	UpdateUserPayload     = models.UpdateUserPayload
+	LoginPayload          = models.LoginPayload
+	VerifyLoginPayload    = models.VerifyLoginPayload
+	ReauthPayload         = models.ReauthPayload
+	ChangePasswordPayload = models.ChangePasswordPayload
+	ChangeEmailPayload    = models.ChangeEmailPayload
+	ConfirmEmailPayload   = models.ConfirmEmailPayload
+	ChangeUsernamePayload = models.ChangeUsernamePayload
+	CloseAccountPayload   = models.CloseAccountPayload
+	ErasePayload          = models.ErasePayload
+	ImpersonatePayload    = models.ImpersonatePayload
+	IdentifierChange      = models.IdentifierChange
+	DataExport            = models.DataExport
+	Session               = models.Session
+
+	APIKey              = models.APIKey
+	CreatedAPIKey       = models.CreatedAPIKey
+	APIKeyPayload       = models.APIKeyPayload
+	UpdateAPIKeyPayload = models.UpdateAPIKeyPayload
+
+	AttributeDefinition        = models.AttributeDefinition
+	AttributeDefinitionPayload = models.AttributeDefinitionPayload
+	AuditEvent                 = models.AuditEvent
+	AuditQuery                 = models.AuditQuery
+	AuditPage                  = models.AuditPage
+	AuditVerification          = models.AuditVerification
+	Policy                     = models.Policy
+	PolicyPayload              = models.PolicyPayload
+	AuthzCheckPayload          = models.AuthzCheckPayload
+	AuthzDecision              = models.AuthzDecision
+
+	ServiceAccount                  = models.ServiceAccount
+	ServiceAccountPayload           = models.ServiceAccountPayload
+	UpdateServiceAccountPayload     = models.UpdateServiceAccountPayload
+	ServiceAccountCredential        = models.ServiceAccountCredential
+	ServiceAccountCredentialPayload = models.ServiceAccountCredentialPayload
+	CreatedServiceAccountCredential = models.CreatedServiceAccountCredential
+
+	TokenRequest                = models.TokenRequest
+	TokenResponse               = models.TokenResponse
+	DeviceAuthorization         = models.DeviceAuthorization
+	DeviceAuthorizationRequest  = models.DeviceAuthorizationRequest
+	DeviceAuthorizationResponse = models.DeviceAuthorizationResponse
+	DeviceDecisionPayload       = models.DeviceDecisionPayload
+
+	JWK  = accesstoken.JWK
+	JWKS = accesstoken.JWKS
+)
+
+// Grant types of the token endpoint.
+const (
+	GrantClientCredentials = models.GrantClientCredentials
+	GrantTokenExchange     = models.GrantTokenExchange
+	GrantDeviceCode        = models.GrantDeviceCode
+)
+
+// TokenTypeAccessToken is the token type of the subject tokens of the token exchange grant.
+const TokenTypeAccessToken = models.TokenTypeAccessToken
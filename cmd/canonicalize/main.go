@@ -0,0 +1,192 @@
+// Command canonicalize rewrites existing usernames and emails to the canonical form
+// used by the identifier package. It reports accounts whose identifiers collide once
+// canonicalized and only writes when run with -apply and no collision exists.
+//
+// It also reports the usernames containing '@', which new usernames cannot. They still
+// log in when no email matches them, those matching the email of another account
+// cannot, and their owners should be asked to change them.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/ryanpujo/melius/database"
+	"github.com/ryanpujo/melius/internal/identifier"
+	"github.com/ryanpujo/melius/internal/models"
+)
+
+type credential struct {
+	id       int
+	username string
+	email    string
+}
+
+func main() {
+	apply := flag.Bool("apply", false, "rewrite identifiers when no collision is found")
+	flag.Parse()
+
+	db := database.GetDBConnection()
+	defer db.Close()
+
+	ctx := context.Background()
+
+	creds, err := loadCredentials(ctx, db)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	collisions := findCollisions(creds, func(c credential) string { return identifier.Username(c.username) })
+	collisions = append(collisions, findCollisions(creds, func(c credential) string { return identifier.Email(c.email) })...)
+	if len(collisions) > 0 {
+		for _, collision := range collisions {
+			fmt.Println("collision:", collision)
+		}
+		fmt.Printf("%d collisions found, resolve them before canonicalizing\n", len(collisions))
+		os.Exit(1)
+	}
+
+	for _, legacy := range findLegacyUsernames(creds) {
+		fmt.Println("legacy username:", legacy)
+	}
+
+	fmt.Println("no collisions found")
+	if !*apply {
+		return
+	}
+
+	n, err := rewrite(ctx, db, creds)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("canonicalized %d credentials\n", n)
+}
+
+func loadCredentials(ctx context.Context, db *sql.DB) ([]credential, error) {
+	rows, err := db.QueryContext(ctx, `SELECT id, username, email FROM credentials ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving credentials: %w", err)
+	}
+	defer rows.Close()
+
+	var creds []credential
+	for rows.Next() {
+		var c credential
+		if err := rows.Scan(&c.id, &c.username, &c.email); err != nil {
+			return nil, fmt.Errorf("error scanning credential: %w", err)
+		}
+		creds = append(creds, c)
+	}
+	return creds, rows.Err()
+}
+
+// findCollisions groups credentials by canonical key and describes every group with more than one member.
+func findCollisions(creds []credential, key func(credential) string) []string {
+	groups := map[string][]string{}
+	var order []string
+	for _, c := range creds {
+		k := key(c)
+		if _, ok := groups[k]; !ok {
+			order = append(order, k)
+		}
+		groups[k] = append(groups[k], fmt.Sprintf("#%d %s <%s>", c.id, c.username, c.email))
+	}
+
+	var collisions []string
+	for _, k := range order {
+		if len(groups[k]) > 1 {
+			collisions = append(collisions, fmt.Sprintf("%q: %s", k, strings.Join(groups[k], ", ")))
+		}
+	}
+	return collisions
+}
+
+// findLegacyUsernames describes the credentials whose username contains '@', telling
+// whether the email of another account shadows it at login.
+func findLegacyUsernames(creds []credential) []string {
+	emails := map[string]int{}
+	for _, c := range creds {
+		emails[identifier.Email(c.email)] = c.id
+	}
+
+	var legacy []string
+	for _, c := range creds {
+		if !identifier.IsEmail(c.username) {
+			continue
+		}
+		description := fmt.Sprintf("#%d %s <%s>", c.id, c.username, c.email)
+		if id, ok := emails[identifier.Email(c.username)]; ok && id != c.id {
+			description += fmt.Sprintf(", cannot log in by username, it is the email of #%d", id)
+		}
+		legacy = append(legacy, description)
+	}
+	return legacy
+}
+
+// rewrite stores canonical identifiers in one transaction. Username changes cascade
+// to users and the other tables referencing credentials.username.
+func rewrite(ctx context.Context, db *sql.DB, creds []credential) (int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	n := 0
+	for _, c := range creds {
+		username, email := identifier.Username(c.username), identifier.Email(c.email)
+		if username == c.username && email == c.email {
+			continue
+		}
+		_, err := tx.ExecContext(ctx, `UPDATE credentials SET username = $1, email = $2 WHERE id = $3`, username, email, c.id)
+		if err != nil {
+			return 0, fmt.Errorf("error canonicalizing credential #%d: %w", c.id, err)
+		}
+		n++
+	}
+
+	history := map[string]func(string) string{
+		models.IdentifierUsername: identifier.Username,
+		models.IdentifierEmail:    identifier.Email,
+	}
+	rows, err := tx.QueryContext(ctx, `SELECT id, kind, old_value, new_value FROM identifier_history`)
+	if err != nil {
+		return 0, fmt.Errorf("error retrieving identifier history: %w", err)
+	}
+	type entry struct {
+		id                   int
+		kind, oldVal, newVal string
+	}
+	var entries []entry
+	for rows.Next() {
+		var e entry
+		if err := rows.Scan(&e.id, &e.kind, &e.oldVal, &e.newVal); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("error scanning identifier history: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error retrieving identifier history: %w", err)
+	}
+
+	for _, e := range entries {
+		canonical, ok := history[e.kind]
+		if !ok {
+			continue
+		}
+		_, err := tx.ExecContext(ctx, `UPDATE identifier_history SET old_value = $1, new_value = $2 WHERE id = $3`,
+			canonical(e.oldVal), canonical(e.newVal), e.id)
+		if err != nil {
+			return 0, fmt.Errorf("error canonicalizing identifier history #%d: %w", e.id, err)
+		}
+	}
+
+	return n, tx.Commit()
+}
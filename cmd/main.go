@@ -1,8 +1,12 @@
 package main
 
 import (
+	"context"
+
 	"github.com/ryanpujo/melius/application"
+	"github.com/ryanpujo/melius/config"
 	"github.com/ryanpujo/melius/database"
+	"github.com/ryanpujo/melius/internal/jwttoken"
 	"github.com/ryanpujo/melius/internal/route"
 	"github.com/ryanpujo/melius/registry"
 )
@@ -11,7 +15,31 @@ func main() {
 	db := database.GetDBConnection()
 	defer db.Close()
 	registry := registry.NewRegistry(db)
+
+	// Add the claims configured by templates to every token issued.
+	mapper, err := jwttoken.TemplateClaimMapper(config.Config().ClaimTemplates)
+	if err != nil {
+		panic(err)
+	}
+	jwttoken.RegisterClaimMapper(mapper)
+	if _, err := jwttoken.TrustedProxies(); err != nil {
+		panic(err)
+	}
+
+	// Purge closed accounts in the background once their retention window has passed.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go registry.GetPurgeService().Run(ctx, config.Config().AccountPurgeInterval)
+	// Reload the authorization policies changed through other instances.
+	go registry.GetPolicyService().Run(ctx, config.Config().PolicyReloadInterval)
+
 	app := application.NewApp(route.SetupRoutes(registry.NewAppControllers()))
+	if app.GRPCPort != 0 {
+		app.GRPC = registry.GetGRPCServer()
+	}
+	if app.ExtAuthzPort != 0 {
+		app.ExtAuthz = registry.GetExtAuthzServer()
+	}
 
 	if err := app.Serve(); err != nil {
 		panic(err)
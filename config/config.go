@@ -1,11 +1,113 @@
 package config
 
-import "github.com/spf13/viper"
+import (
+	"time"
+
+	"github.com/spf13/viper"
+)
 
 type Configuration struct {
-	DSN    string `mapstructure:"DSN"`
-	Port   int    `mapstructure:"PORT"`
-	JWTKey string `mapstructure:"JWT_KEY"`
+	DSN          string `mapstructure:"DSN"`
+	Port         int    `mapstructure:"PORT"`
+	JWTKey       string `mapstructure:"JWT_KEY"`
+	SMTPAddr     string `mapstructure:"SMTP_ADDR"`
+	SMTPFrom     string `mapstructure:"SMTP_FROM"`
+	SMTPUsername string `mapstructure:"SMTP_USERNAME"`
+	SMTPPassword string `mapstructure:"SMTP_PASSWORD"`
+	// IdentifierReservation is how long a released username or email stays
+	// reserved for its previous owner.
+	IdentifierReservation time.Duration `mapstructure:"IDENTIFIER_RESERVATION"`
+	// AccountGracePeriod is how long a closed account can be restored by its owner.
+	AccountGracePeriod time.Duration `mapstructure:"ACCOUNT_GRACE_PERIOD"`
+	// AccountRetention is how long a closed account is kept before it is purged.
+	AccountRetention time.Duration `mapstructure:"ACCOUNT_RETENTION"`
+	// AccountPurgeMode is either "delete" or "anonymize".
+	AccountPurgeMode     string        `mapstructure:"ACCOUNT_PURGE_MODE"`
+	AccountPurgeInterval time.Duration `mapstructure:"ACCOUNT_PURGE_INTERVAL"`
+	// RiskStepUpScore and RiskBlockScore are the login risk scores from which a login
+	// must be confirmed with an emailed code, or is refused.
+	RiskStepUpScore int `mapstructure:"RISK_STEP_UP_SCORE"`
+	RiskBlockScore  int `mapstructure:"RISK_BLOCK_SCORE"`
+	// ReauthMaxAge is how long after authenticating a user can perform sensitive operations.
+	ReauthMaxAge time.Duration `mapstructure:"REAUTH_MAX_AGE"`
+	// SessionMaxAge is how long after login a session can be kept alive by refreshing
+	// its tokens, 24 hours when not set. Users log in again after it.
+	SessionMaxAge time.Duration `mapstructure:"SESSION_MAX_AGE"`
+	// AuthCookieEnabled makes login set the access token in an HttpOnly cookie for
+	// browser apps, AuthTransports orders the accepted transports ("header", "cookie")
+	// by precedence when a request carries both.
+	AuthCookieEnabled  bool     `mapstructure:"AUTH_COOKIE_ENABLED"`
+	AuthCookieName     string   `mapstructure:"AUTH_COOKIE_NAME"`
+	AuthCookieSecure   bool     `mapstructure:"AUTH_COOKIE_SECURE"`
+	AuthCookieSameSite string   `mapstructure:"AUTH_COOKIE_SAME_SITE"`
+	AuthTransports     []string `mapstructure:"AUTH_TRANSPORTS"`
+	// Issuer is the public base URL of the service. Client assertions must be
+	// addressed to it or to its token endpoint.
+	Issuer string `mapstructure:"ISSUER"`
+	// TokenExchangeAudiences are the downstream services tokens can be exchanged for.
+	TokenExchangeAudiences []string `mapstructure:"TOKEN_EXCHANGE_AUDIENCES"`
+	// DeviceClients are the public clients, such as CLIs, allowed to use the device
+	// authorization grant. Their users approve them at DeviceVerificationURI, the page
+	// of the application in front of melius where logged-in users enter the user code,
+	// which it approves through GET and POST /auth/me/device. Melius serves no such
+	// page, so devices cannot be authorized until it is configured.
+	DeviceClients         []string `mapstructure:"DEVICE_CLIENTS"`
+	DeviceVerificationURI string   `mapstructure:"DEVICE_VERIFICATION_URI"`
+	// DPoPClients are the clients whose tokens must be bound to a DPoP key, like the
+	// service accounts requiring DPoP.
+	DPoPClients []string `mapstructure:"DPOP_CLIENTS"`
+	// TrustedProxies are the IP addresses or CIDR ranges of the reverse proxies trusted
+	// to tell by X-Forwarded-Proto that they terminated TLS, for the URL DPoP proofs
+	// sign. The header is ignored on the requests of anyone else.
+	TrustedProxies []string `mapstructure:"TRUSTED_PROXIES"`
+	// TokenFormat is the format of access tokens, "jwt" signed with JWTKey or
+	// "paseto" for v4.public tokens signed with PASETOKey, a hex encoded Ed25519 seed.
+	TokenFormat string `mapstructure:"TOKEN_FORMAT"`
+	PASETOKey   string `mapstructure:"PASETO_KEY"`
+	// JWTSigningKey, a hex encoded Ed25519 seed, makes JWTs signed with EdDSA instead
+	// of JWTKey, so other services verify them with the keys published as a JWKS.
+	JWTSigningKey string `mapstructure:"JWT_SIGNING_KEY"`
+	// Audience is the audience of the tokens issued for the API of melius itself, to
+	// which ClientAudiences adds the audiences of the tokens issued to each client.
+	Audience        string              `mapstructure:"AUDIENCE"`
+	ClientAudiences map[string][]string `mapstructure:"CLIENT_AUDIENCES"`
+	// TokenLifetimes overrides the lifetime of access tokens by kind: "user",
+	// "impersonation", "service_account" and "exchange".
+	TokenLifetimes map[string]time.Duration `mapstructure:"TOKEN_LIFETIMES"`
+	// TokenLeeway is the clock skew tolerated when checking the times of tokens.
+	TokenLeeway time.Duration `mapstructure:"TOKEN_LEEWAY"`
+	// ClaimTemplates adds claims to access tokens, by name, from Go templates executed
+	// on the identity of the token. See jwttoken.TemplateClaimMapper.
+	ClaimTemplates map[string]string `mapstructure:"CLAIM_TEMPLATES"`
+	// ForwardAuthHosts protect the apps behind a reverse proxy asking GET /forward-auth,
+	// or Envoy asking the ext_authz server, by the host it forwards. Host "*" applies
+	// to hosts not listed, others are refused.
+	ForwardAuthHosts map[string]ForwardAuthHost `mapstructure:"FORWARD_AUTH_HOSTS"`
+	// ExtAuthzPort is the port of the gRPC external authorization server for Envoy,
+	// which is not started when zero.
+	ExtAuthzPort int `mapstructure:"EXT_AUTHZ_PORT"`
+	// GRPCPort is the port of the gRPC API, which is not started when zero.
+	GRPCPort int `mapstructure:"GRPC_PORT"`
+	// PolicyReloadInterval is how often the authorization policies are reloaded from
+	// the database, picking up the changes made through other instances.
+	PolicyReloadInterval time.Duration `mapstructure:"POLICY_RELOAD_INTERVAL"`
+}
+
+// ForwardAuthHost is how forward auth protects the apps of a host.
+type ForwardAuthHost struct {
+	// LoginURL is where browsers without a valid token are redirected, with the URL
+	// they requested in the rd query parameter. Other clients get 401, as do all when
+	// it is empty. nginx does not pass redirects on, it must handle 401 itself.
+	LoginURL string `mapstructure:"LOGIN_URL"`
+	// Rules are the roles required by paths. The rule of the longest matching path
+	// applies; users with any of its roles pass, any user when it has none.
+	Rules []ForwardAuthRule `mapstructure:"RULES"`
+}
+
+// ForwardAuthRule requires one of Roles for the path Prefix and the paths below it.
+type ForwardAuthRule struct {
+	Prefix string   `mapstructure:"PREFIX"`
+	Roles  []string `mapstructure:"ROLES"`
 }
 
 var config *Configuration
@@ -14,6 +116,7 @@ func readInConfig() {
 	viper.SetConfigName("config")
 	viper.SetConfigType("yaml")
 	viper.AddConfigPath(".")
+	viper.AddConfigPath("..")
 	viper.AddConfigPath("../..")
 
 	if err := viper.ReadInConfig(); err != nil {
@@ -1,7 +1,28 @@
 package adapter
 
-import "github.com/ryanpujo/melius/internal/controllers"
+import (
+	"time"
+
+	"github.com/ryanpujo/melius/internal/controllers"
+	"github.com/ryanpujo/melius/internal/jwttoken"
+)
 
 type Adapter struct {
-	CredentialController *controllers.CredentialController
+	CredentialController          *controllers.CredentialController
+	UserController                *controllers.UserController
+	AttributeController           *controllers.AttributeController
+	PrivacyController             *controllers.PrivacyController
+	AuditController               *controllers.AuditController
+	SessionController             *controllers.SessionController
+	APIKeyController              *controllers.APIKeyController
+	ServiceAccountController      *controllers.ServiceAccountController
+	TokenController               *controllers.TokenController
+	DeviceAuthorizationController *controllers.DeviceAuthorizationController
+	ForwardAuthController         *controllers.ForwardAuthController
+	PolicyController              *controllers.PolicyController
+
+	// AuthOptions configure the authentication middleware of the protected routes.
+	AuthOptions []jwttoken.Option
+	// ReauthMaxAge is how recently users must have authenticated for sensitive routes.
+	ReauthMaxAge time.Duration
 }
@@ -0,0 +1,82 @@
+// Package authz guards routes with the policies of the policy service, deciding by
+// attributes of the principal, the resource and the request rather than by role alone.
+package authz
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ryanpujo/melius/internal/jwttoken"
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/ryanpujo/melius/internal/services"
+)
+
+// Evaluator decides by named policies, see services.PolicyInterface.
+type Evaluator interface {
+	Evaluate(ctx context.Context, name string, principal models.PolicyPrincipal, resource map[string]any) (*models.AuthzDecision, error)
+}
+
+// Resource returns the attributes of the resource a request acts on.
+type Resource func(c *gin.Context) map[string]any
+
+// Principal returns the principal authenticated by JWTAuthMiddleware.
+func Principal(c *gin.Context) models.PolicyPrincipal {
+	principal := models.PolicyPrincipal{
+		Type:     c.GetString(jwttoken.PrincipalKey),
+		ID:       c.GetUint("user_id"),
+		Username: c.GetString("username"),
+		Roles:    c.GetStringSlice("roles"),
+		Scopes:   c.GetStringSlice("scopes"),
+		ClientID: c.GetString("client_id"),
+		ACR:      c.GetString("acr"),
+	}
+	if principal.Type == jwttoken.PrincipalServiceAccount {
+		principal.ID = c.GetUint("service_account_id")
+	}
+	return principal
+}
+
+// Params is a Resource of the path parameters of the route, /documents/:id gives
+// resource.id for instance.
+func Params(c *gin.Context) map[string]any {
+	resource := make(map[string]any, len(c.Params))
+	for _, param := range c.Params {
+		resource[param.Key] = param.Value
+	}
+	return resource
+}
+
+// RequirePolicy rejects requests the policy called name does not allow on the resource
+// returned by resource, which may be nil. Requests are denied while the policy does not
+// exist. It must run after JWTAuthMiddleware.
+func RequirePolicy(evaluator Evaluator, name string, resource Resource) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var attributes map[string]any
+		if resource != nil {
+			attributes = resource(c)
+		}
+
+		ctx, cancel := context.WithTimeout(c, time.Second*1)
+		defer cancel()
+
+		decision, err := evaluator.Evaluate(ctx, name, Principal(c), attributes)
+		switch {
+		case errors.Is(err, services.ErrPolicyNotFound):
+			c.JSON(http.StatusForbidden, gin.H{"error": "Access denied by policy"})
+			c.Abort()
+			return
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to evaluate policy"})
+			c.Abort()
+			return
+		case !decision.Allowed:
+			c.JSON(http.StatusForbidden, gin.H{"error": "Access denied by policy"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
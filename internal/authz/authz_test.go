@@ -0,0 +1,105 @@
+package authz_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ryanpujo/melius/internal/authz"
+	"github.com/ryanpujo/melius/internal/jwttoken"
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/ryanpujo/melius/internal/services"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type EvaluatorMock struct {
+	mock.Mock
+}
+
+func (em *EvaluatorMock) Evaluate(ctx context.Context, name string, principal models.PolicyPrincipal, resource map[string]any) (*models.AuthzDecision, error) {
+	args := em.Called(ctx, name, principal, resource)
+	return args.Get(0).(*models.AuthzDecision), args.Error(1)
+}
+
+func TestRequirePolicy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	principal := models.PolicyPrincipal{
+		Type:     jwttoken.PrincipalUser,
+		ID:       1,
+		Username: "ryanpujo",
+		Roles:    []string{"user"},
+		ACR:      jwttoken.ACRSingleFactor,
+	}
+	resource := map[string]any{"id": "42"}
+
+	tableTest := map[string]struct {
+		arrange func(em *EvaluatorMock)
+		assert  func(t *testing.T, statusCode int)
+	}{
+		"allowed": {
+			arrange: func(em *EvaluatorMock) {
+				em.On("Evaluate", mock.Anything, "documents", principal, resource).
+					Return(&models.AuthzDecision{Policy: "documents", Allowed: true}, nil).Once()
+			},
+			assert: func(t *testing.T, statusCode int) {
+				require.Equal(t, http.StatusOK, statusCode)
+			},
+		},
+		"denied": {
+			arrange: func(em *EvaluatorMock) {
+				em.On("Evaluate", mock.Anything, "documents", principal, resource).
+					Return(&models.AuthzDecision{Policy: "documents"}, nil).Once()
+			},
+			assert: func(t *testing.T, statusCode int) {
+				require.Equal(t, http.StatusForbidden, statusCode)
+			},
+		},
+		"policy not found": {
+			arrange: func(em *EvaluatorMock) {
+				em.On("Evaluate", mock.Anything, "documents", principal, resource).
+					Return((*models.AuthzDecision)(nil), services.ErrPolicyNotFound).Once()
+			},
+			assert: func(t *testing.T, statusCode int) {
+				require.Equal(t, http.StatusForbidden, statusCode)
+			},
+		},
+		"failed to evaluate": {
+			arrange: func(em *EvaluatorMock) {
+				em.On("Evaluate", mock.Anything, "documents", principal, resource).
+					Return((*models.AuthzDecision)(nil), errors.New("failed")).Once()
+			},
+			assert: func(t *testing.T, statusCode int) {
+				require.Equal(t, http.StatusInternalServerError, statusCode)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			em := new(EvaluatorMock)
+			v.arrange(em)
+
+			router := gin.New()
+			router.GET("/documents/:id",
+				func(c *gin.Context) {
+					c.Set(jwttoken.PrincipalKey, jwttoken.PrincipalUser)
+					c.Set("user_id", uint(1))
+					c.Set("username", "ryanpujo")
+					c.Set("roles", []string{"user"})
+					c.Set("acr", jwttoken.ACRSingleFactor)
+				},
+				authz.RequirePolicy(em, "documents", authz.Params),
+				func(c *gin.Context) { c.Status(http.StatusOK) },
+			)
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/documents/42", nil))
+
+			v.assert(t, rec.Code)
+			em.AssertExpectations(t)
+		})
+	}
+}
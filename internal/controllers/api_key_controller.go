@@ -0,0 +1,142 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/ryanpujo/melius/internal/services"
+	"github.com/ryanpujo/melius/internal/utilities"
+)
+
+// APIKeyController lets users manage the API keys of their account.
+type APIKeyController struct {
+	apiKeyService services.APIKeyInterface
+}
+
+// NewAPIKeyController initializes a new APIKeyController with the provided API key service.
+func NewAPIKeyController(apiKeyService services.APIKeyInterface) *APIKeyController {
+	return &APIKeyController{
+		apiKeyService: apiKeyService,
+	}
+}
+
+// Create generates an API key for the logged-in user. The key is only returned in this response.
+func (kc *APIKeyController) Create(c *gin.Context) {
+	var payload models.APIKeyPayload
+
+	// Bind and validate JSON payload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, utilities.Response{
+			Message: "Validation error",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c, time.Second*1)
+	defer cancel()
+
+	key, err := kc.apiKeyService.Create(ctx, c.GetUint("user_id"), payload)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utilities.Response{
+			Message: "Failed to create API key",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, utilities.Response{
+		Message: "API key created successfully",
+		Data:    key,
+	})
+}
+
+// List returns the API keys of the logged-in user.
+func (kc *APIKeyController) List(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, time.Second*1)
+	defer cancel()
+
+	keys, err := kc.apiKeyService.List(ctx, c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utilities.Response{
+			Message: "Failed to list API keys",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, utilities.Response{
+		Data: keys,
+	})
+}
+
+// Get returns the API key identified in the path.
+func (kc *APIKeyController) Get(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, time.Second*1)
+	defer cancel()
+
+	key, err := kc.apiKeyService.Get(ctx, c.GetUint("user_id"), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, utilities.Response{
+			Message: "API key not found",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, utilities.Response{
+		Data: key,
+	})
+}
+
+// Update renames the API key identified in the path and replaces its scopes.
+func (kc *APIKeyController) Update(c *gin.Context) {
+	var payload models.UpdateAPIKeyPayload
+
+	// Bind and validate JSON payload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, utilities.Response{
+			Message: "Validation error",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c, time.Second*1)
+	defer cancel()
+
+	key, err := kc.apiKeyService.Update(ctx, c.GetUint("user_id"), c.Param("id"), payload)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utilities.Response{
+			Message: "Failed to update API key",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, utilities.Response{
+		Message: "API key updated successfully",
+		Data:    key,
+	})
+}
+
+// Delete revokes the API key identified in the path. It stops working immediately.
+func (kc *APIKeyController) Delete(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, time.Second*1)
+	defer cancel()
+
+	if err := kc.apiKeyService.Delete(ctx, c.GetUint("user_id"), c.Param("id")); err != nil {
+		c.JSON(http.StatusNotFound, utilities.Response{
+			Message: "Failed to delete API key",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, utilities.Response{
+		Message: "API key deleted successfully",
+	})
+}
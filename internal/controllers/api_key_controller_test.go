@@ -0,0 +1,299 @@
+package controllers_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ryanpujo/melius/internal/jwttoken"
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/ryanpujo/melius/internal/utilities"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// API keys accepted by the authenticator of the test handler.
+const (
+	readKey  = models.APIKeyPrefix + "read"
+	writeKey = models.APIKeyPrefix + "write"
+	adminKey = models.APIKeyPrefix + "admin"
+	// adminWriteKey is granted every scope.
+	adminWriteKey = models.APIKeyPrefix + "admin-write"
+)
+
+type APIKeyServiceMock struct {
+	mock.Mock
+}
+
+func (aksm *APIKeyServiceMock) Create(ctx context.Context, userID uint, payload models.APIKeyPayload) (*models.CreatedAPIKey, error) {
+	args := aksm.Called(ctx, userID, payload)
+	return args.Get(0).(*models.CreatedAPIKey), args.Error(1)
+}
+
+func (aksm *APIKeyServiceMock) List(ctx context.Context, userID uint) ([]models.APIKey, error) {
+	args := aksm.Called(ctx, userID)
+	return args.Get(0).([]models.APIKey), args.Error(1)
+}
+
+func (aksm *APIKeyServiceMock) Get(ctx context.Context, userID uint, id string) (*models.APIKey, error) {
+	args := aksm.Called(ctx, userID, id)
+	return args.Get(0).(*models.APIKey), args.Error(1)
+}
+
+func (aksm *APIKeyServiceMock) Update(ctx context.Context, userID uint, id string, payload models.UpdateAPIKeyPayload) (*models.APIKey, error) {
+	args := aksm.Called(ctx, userID, id, payload)
+	return args.Get(0).(*models.APIKey), args.Error(1)
+}
+
+func (aksm *APIKeyServiceMock) Delete(ctx context.Context, userID uint, id string) error {
+	args := aksm.Called(ctx, userID, id)
+	return args.Error(0)
+}
+
+func (aksm *APIKeyServiceMock) Authenticate(ctx context.Context, key string) (*jwttoken.Principal, error) {
+	args := aksm.Called(ctx, key)
+	return args.Get(0).(*jwttoken.Principal), args.Error(1)
+}
+
+func testAPIKeys(ctx context.Context, key string) (*jwttoken.Principal, error) {
+	principal := &jwttoken.Principal{UserID: 1, Username: "ryanpujo", KeyID: "key"}
+	switch key {
+	case readKey:
+		principal.Scopes = []string{models.ScopeRead}
+	case writeKey:
+		principal.Scopes = []string{models.ScopeRead, models.ScopeWrite}
+	case adminKey:
+		principal.Roles = []string{models.RoleAdmin}
+		principal.Scopes = []string{models.ScopeAdmin, models.ScopeRead}
+	case adminWriteKey:
+		principal.Roles = []string{models.RoleAdmin}
+		principal.Scopes = []string{models.ScopeAdmin, models.ScopeRead, models.ScopeWrite}
+	default:
+		return nil, errors.New("invalid API key")
+	}
+	return principal, nil
+}
+
+func TestAPIKeys(t *testing.T) {
+	payload := models.APIKeyPayload{Name: "ci", Scopes: []string{models.ScopeRead}}
+	validJson, _ := json.Marshal(payload)
+	invalidJson, _ := json.Marshal(models.APIKeyPayload{Name: "ci", Scopes: []string{"everything"}})
+	update := models.UpdateAPIKeyPayload{Name: "deploy", Scopes: []string{models.ScopeWrite}}
+	updateJson, _ := json.Marshal(update)
+
+	tableTest := map[string]struct {
+		method  string
+		target  string
+		json    []byte
+		arrange func()
+		assert  func(t *testing.T, statusCode int, json utilities.Response)
+	}{
+		"create": {
+			method: http.MethodPost,
+			target: "/auth/me/api-keys",
+			json:   validJson,
+			arrange: func() {
+				aksm.On("Create", mock.Anything, uint(1), payload).
+					Return(&models.CreatedAPIKey{APIKey: models.APIKey{ID: "key"}, Key: readKey}, nil).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusCreated, statusCode)
+				require.Equal(t, readKey, json.Data.(map[string]any)["key"])
+			},
+		},
+		"create invalid scope": {
+			method:  http.MethodPost,
+			target:  "/auth/me/api-keys",
+			json:    invalidJson,
+			arrange: func() {},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusBadRequest, statusCode)
+				require.Equal(t, "Validation error", json.Message)
+			},
+		},
+		"create failed": {
+			method: http.MethodPost,
+			target: "/auth/me/api-keys",
+			json:   validJson,
+			arrange: func() {
+				aksm.On("Create", mock.Anything, uint(1), payload).
+					Return((*models.CreatedAPIKey)(nil), errors.New("failed")).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusBadRequest, statusCode)
+			},
+		},
+		"list": {
+			method: http.MethodGet,
+			target: "/auth/me/api-keys",
+			arrange: func() {
+				aksm.On("List", mock.Anything, uint(1)).Return([]models.APIKey{{ID: "key"}}, nil).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusOK, statusCode)
+				require.Len(t, json.Data, 1)
+			},
+		},
+		"get not found": {
+			method: http.MethodGet,
+			target: "/auth/me/api-keys/other",
+			arrange: func() {
+				aksm.On("Get", mock.Anything, uint(1), "other").Return((*models.APIKey)(nil), errors.New("failed")).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusNotFound, statusCode)
+			},
+		},
+		"update": {
+			method: http.MethodPatch,
+			target: "/auth/me/api-keys/key",
+			json:   updateJson,
+			arrange: func() {
+				aksm.On("Update", mock.Anything, uint(1), "key", update).Return(&models.APIKey{ID: "key"}, nil).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusOK, statusCode)
+			},
+		},
+		"delete": {
+			method: http.MethodDelete,
+			target: "/auth/me/api-keys/key",
+			arrange: func() {
+				aksm.On("Delete", mock.Anything, uint(1), "key").Return(nil).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusOK, statusCode)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			req := authorized(t, v.method, v.target, v.json)
+			res := httptest.NewRecorder()
+
+			handler.ServeHTTP(res, req)
+
+			var jsonRes utilities.Response
+
+			json.NewDecoder(res.Body).Decode(&jsonRes)
+
+			v.assert(t, res.Code, jsonRes)
+		})
+	}
+}
+
+func TestAPIKeyAuthentication(t *testing.T) {
+	tableTest := map[string]struct {
+		method  string
+		target  string
+		key     string
+		arrange func()
+		status  int
+	}{
+		"read": {
+			method: http.MethodGet,
+			target: "/auth/me",
+			key:    readKey,
+			arrange: func() {
+				usm.On("Profile", mock.Anything, uint(1)).Return(&me, nil).Once()
+			},
+			status: http.StatusOK,
+		},
+		"write with read scope": {
+			method:  http.MethodDelete,
+			target:  "/auth/me/sessions/other",
+			key:     readKey,
+			arrange: func() {},
+			status:  http.StatusForbidden,
+		},
+		"write": {
+			method: http.MethodDelete,
+			target: "/auth/me/sessions/other",
+			key:    writeKey,
+			arrange: func() {
+				ssm.On("Revoke", mock.Anything, uint(1), "other").Return(nil).Once()
+			},
+			status: http.StatusOK,
+		},
+		"recent authentication": {
+			method:  http.MethodPost,
+			target:  "/auth/me/api-keys",
+			key:     writeKey,
+			arrange: func() {},
+			status:  http.StatusUnauthorized,
+		},
+		"admin scope": {
+			method: http.MethodGet,
+			target: "/admin/attributes",
+			key:    adminKey,
+			arrange: func() {
+				asm.On("List", mock.Anything).Return([]models.AttributeDefinition{}, nil).Once()
+			},
+			status: http.StatusOK,
+		},
+		"admin scope write": {
+			method: http.MethodDelete,
+			target: "/admin/attributes/department",
+			key:    adminWriteKey,
+			arrange: func() {
+				asm.On("Delete", mock.Anything, "department").Return(nil).Once()
+			},
+			status: http.StatusOK,
+		},
+		"admin scope role assignment": {
+			method:  http.MethodPut,
+			target:  "/admin/users/2/roles/admin",
+			key:     adminWriteKey,
+			arrange: func() {},
+			status:  http.StatusUnauthorized,
+		},
+		"admin scope impersonation": {
+			method:  http.MethodPost,
+			target:  "/admin/users/5/impersonate",
+			key:     adminWriteKey,
+			arrange: func() {},
+			status:  http.StatusUnauthorized,
+		},
+		"admin scope erasure": {
+			method:  http.MethodPost,
+			target:  "/admin/users/2/erase",
+			key:     adminWriteKey,
+			arrange: func() {},
+			status:  http.StatusUnauthorized,
+		},
+		"admin without admin scope": {
+			method:  http.MethodGet,
+			target:  "/admin/attributes",
+			key:     readKey,
+			arrange: func() {},
+			status:  http.StatusForbidden,
+		},
+		"unknown key": {
+			method:  http.MethodGet,
+			target:  "/auth/me",
+			key:     models.APIKeyPrefix + "unknown",
+			arrange: func() {},
+			status:  http.StatusUnauthorized,
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			req := httptest.NewRequest(v.method, v.target, nil)
+			req.Header.Set("Authorization", "ApiKey "+v.key)
+			res := httptest.NewRecorder()
+
+			handler.ServeHTTP(res, req)
+
+			require.Equal(t, v.status, res.Code)
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/ryanpujo/melius/internal/services"
+	"github.com/ryanpujo/melius/internal/utilities"
+)
+
+// AttributeController handles the administration of custom user attribute definitions.
+type AttributeController struct {
+	attrService services.AttributeInterface
+}
+
+// NewAttributeController initializes a new AttributeController with the provided attribute service.
+func NewAttributeController(attrService services.AttributeInterface) *AttributeController {
+	return &AttributeController{
+		attrService: attrService,
+	}
+}
+
+// List returns every attribute definition.
+func (ac *AttributeController) List(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, time.Second*1)
+	defer cancel()
+
+	defs, err := ac.attrService.List(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utilities.Response{
+			Message: "Failed to list attributes",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, utilities.Response{
+		Data: defs,
+	})
+}
+
+// Define creates or replaces the attribute definition named in the path.
+func (ac *AttributeController) Define(c *gin.Context) {
+	var payload models.AttributeDefinitionPayload
+
+	// Bind and validate JSON payload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, utilities.Response{
+			Message: "Validation error",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c, time.Second*1)
+	defer cancel()
+
+	def, err := ac.attrService.Define(ctx, c.Param("name"), payload)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utilities.Response{
+			Message: "Failed to define attribute",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, utilities.Response{
+		Data:    def,
+		Message: "Attribute defined successfully",
+	})
+}
+
+// Delete removes the attribute definition named in the path.
+func (ac *AttributeController) Delete(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, time.Second*1)
+	defer cancel()
+
+	if err := ac.attrService.Delete(ctx, c.Param("name")); err != nil {
+		c.JSON(http.StatusBadRequest, utilities.Response{
+			Message: "Failed to delete attribute",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, utilities.Response{
+		Message: "Attribute deleted successfully",
+	})
+}
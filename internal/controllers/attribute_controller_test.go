@@ -0,0 +1,178 @@
+package controllers_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/ryanpujo/melius/internal/utilities"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type AttrServiceMock struct {
+	mock.Mock
+}
+
+func (asm *AttrServiceMock) List(ctx context.Context) ([]models.AttributeDefinition, error) {
+	args := asm.Called(ctx)
+	return args.Get(0).([]models.AttributeDefinition), args.Error(1)
+}
+
+func (asm *AttrServiceMock) Define(ctx context.Context, name string, payload models.AttributeDefinitionPayload) (*models.AttributeDefinition, error) {
+	args := asm.Called(ctx, name, payload)
+	return args.Get(0).(*models.AttributeDefinition), args.Error(1)
+}
+
+func (asm *AttrServiceMock) Delete(ctx context.Context, name string) error {
+	args := asm.Called(ctx, name)
+	return args.Error(0)
+}
+
+func TestListAttributes(t *testing.T) {
+	tableTest := map[string]struct {
+		arrange func()
+		assert  func(t *testing.T, statusCode int, json utilities.Response)
+	}{
+		"success": {
+			arrange: func() {
+				asm.On("List", mock.Anything).Return([]models.AttributeDefinition{{Name: "department"}}, nil).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusOK, statusCode)
+				require.Len(t, json.Data, 1)
+			},
+		},
+		"failed": {
+			arrange: func() {
+				asm.On("List", mock.Anything).Return([]models.AttributeDefinition(nil), errors.New("failed")).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusInternalServerError, statusCode)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			req := authorized(t, http.MethodGet, "/admin/attributes", nil, models.RoleAdmin)
+			res := httptest.NewRecorder()
+
+			handler.ServeHTTP(res, req)
+
+			var jsonRes utilities.Response
+
+			json.NewDecoder(res.Body).Decode(&jsonRes)
+
+			v.assert(t, res.Code, jsonRes)
+		})
+	}
+}
+
+func TestDefineAttribute(t *testing.T) {
+	payload := models.AttributeDefinitionPayload{
+		Type:       models.AttributeString,
+		Visibility: models.VisibilityPublic,
+	}
+	validJson, _ := json.Marshal(payload)
+	invalidJson, _ := json.Marshal(models.AttributeDefinitionPayload{Type: "date", Visibility: models.VisibilityPublic})
+	tableTest := map[string]struct {
+		json    []byte
+		arrange func()
+		assert  func(t *testing.T, statusCode int, json utilities.Response)
+	}{
+		"success": {
+			json: validJson,
+			arrange: func() {
+				asm.On("Define", mock.Anything, "department", payload).
+					Return(&models.AttributeDefinition{Name: "department"}, nil).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusOK, statusCode)
+			},
+		},
+		"failed": {
+			json: validJson,
+			arrange: func() {
+				asm.On("Define", mock.Anything, "department", payload).
+					Return((*models.AttributeDefinition)(nil), errors.New("failed")).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusBadRequest, statusCode)
+				require.Equal(t, "Failed to define attribute", json.Message)
+			},
+		},
+		"validation failed": {
+			json:    invalidJson,
+			arrange: func() {},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusBadRequest, statusCode)
+				require.Equal(t, "Validation error", json.Message)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			req := authorized(t, http.MethodPut, "/admin/attributes/department", v.json, models.RoleAdmin)
+			res := httptest.NewRecorder()
+
+			handler.ServeHTTP(res, req)
+
+			var jsonRes utilities.Response
+
+			json.NewDecoder(res.Body).Decode(&jsonRes)
+
+			v.assert(t, res.Code, jsonRes)
+		})
+	}
+}
+
+func TestDeleteAttribute(t *testing.T) {
+	tableTest := map[string]struct {
+		arrange func()
+		assert  func(t *testing.T, statusCode int, json utilities.Response)
+	}{
+		"success": {
+			arrange: func() {
+				asm.On("Delete", mock.Anything, "department").Return(nil).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusOK, statusCode)
+			},
+		},
+		"failed": {
+			arrange: func() {
+				asm.On("Delete", mock.Anything, "department").Return(errors.New("failed")).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusBadRequest, statusCode)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			req := authorized(t, http.MethodDelete, "/admin/attributes/department", nil, models.RoleAdmin)
+			res := httptest.NewRecorder()
+
+			handler.ServeHTTP(res, req)
+
+			var jsonRes utilities.Response
+
+			json.NewDecoder(res.Body).Decode(&jsonRes)
+
+			v.assert(t, res.Code, jsonRes)
+		})
+	}
+}
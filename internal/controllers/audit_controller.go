@@ -0,0 +1,73 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/ryanpujo/melius/internal/services"
+	"github.com/ryanpujo/melius/internal/utilities"
+)
+
+// AuditController gives administrators access to the audit log.
+type AuditController struct {
+	auditService services.AuditInterface
+}
+
+// NewAuditController initializes a new AuditController with the provided audit service.
+func NewAuditController(auditService services.AuditInterface) *AuditController {
+	return &AuditController{
+		auditService: auditService,
+	}
+}
+
+// List returns a page of audit log entries filtered by the query string.
+func (ac *AuditController) List(c *gin.Context) {
+	var query models.AuditQuery
+
+	// Bind and validate the query string
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, utilities.Response{
+			Message: "Validation error",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c, time.Second*1)
+	defer cancel()
+
+	page, err := ac.auditService.List(ctx, query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utilities.Response{
+			Message: "Failed to list audit log",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, utilities.Response{
+		Data: page,
+	})
+}
+
+// Verify checks the hash chain of the whole audit log.
+func (ac *AuditController) Verify(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, time.Second*30)
+	defer cancel()
+
+	result, err := ac.auditService.Verify(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utilities.Response{
+			Message: "Failed to verify audit log",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, utilities.Response{
+		Data: result,
+	})
+}
@@ -0,0 +1,143 @@
+package controllers_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/ryanpujo/melius/internal/utilities"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type AuditServiceMock struct {
+	mock.Mock
+}
+
+func (ausm *AuditServiceMock) Record(ctx context.Context, event models.AuditEvent) {
+	ausm.Called(ctx, event)
+}
+
+func (ausm *AuditServiceMock) List(ctx context.Context, query models.AuditQuery) (*models.AuditPage, error) {
+	args := ausm.Called(ctx, query)
+	return args.Get(0).(*models.AuditPage), args.Error(1)
+}
+
+func (ausm *AuditServiceMock) Verify(ctx context.Context) (*models.AuditVerification, error) {
+	args := ausm.Called(ctx)
+	return args.Get(0).(*models.AuditVerification), args.Error(1)
+}
+
+func TestListAudit(t *testing.T) {
+	actor := uint(1)
+	tableTest := map[string]struct {
+		target  string
+		roles   []string
+		arrange func()
+		assert  func(t *testing.T, statusCode int, json utilities.Response)
+	}{
+		"success": {
+			target: "/admin/audit?actor=1&action=auth.login&outcome=failure&cursor=10&limit=20",
+			roles:  []string{models.RoleAdmin},
+			arrange: func() {
+				query := models.AuditQuery{
+					ActorID: &actor,
+					Action:  models.AuditLogin,
+					Outcome: models.AuditOutcomeFailure,
+					Cursor:  10,
+					Limit:   20,
+				}
+				ausm.On("List", mock.Anything, query).Return(&models.AuditPage{
+					Events:     []models.AuditEvent{{ID: 9, Action: models.AuditLogin}},
+					NextCursor: 9,
+				}, nil).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusOK, statusCode)
+				require.Equal(t, float64(9), json.Data.(map[string]any)["next_cursor"])
+			},
+		},
+		"invalid outcome": {
+			target:  "/admin/audit?outcome=maybe",
+			roles:   []string{models.RoleAdmin},
+			arrange: func() {},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusBadRequest, statusCode)
+				require.Equal(t, "Validation error", json.Message)
+			},
+		},
+		"failed": {
+			target: "/admin/audit",
+			roles:  []string{models.RoleAdmin},
+			arrange: func() {
+				ausm.On("List", mock.Anything, models.AuditQuery{}).Return((*models.AuditPage)(nil), errors.New("failed")).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusInternalServerError, statusCode)
+			},
+		},
+		"forbidden": {
+			target:  "/admin/audit",
+			arrange: func() {},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusForbidden, statusCode)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			req := authorized(t, http.MethodGet, v.target, nil, v.roles...)
+			res := httptest.NewRecorder()
+
+			handler.ServeHTTP(res, req)
+
+			var jsonRes utilities.Response
+
+			json.NewDecoder(res.Body).Decode(&jsonRes)
+
+			v.assert(t, res.Code, jsonRes)
+		})
+	}
+}
+
+func TestVerifyAudit(t *testing.T) {
+	brokenAt := uint64(3)
+	ausm.On("Verify", mock.Anything).Return(&models.AuditVerification{Checked: 2, BrokenAt: &brokenAt}, nil).Once()
+
+	req := authorized(t, http.MethodGet, "/admin/audit/verify", nil, models.RoleAdmin)
+	res := httptest.NewRecorder()
+
+	handler.ServeHTTP(res, req)
+
+	var jsonRes utilities.Response
+	json.NewDecoder(res.Body).Decode(&jsonRes)
+
+	require.Equal(t, http.StatusOK, res.Code)
+	require.Equal(t, false, jsonRes.Data.(map[string]any)["valid"])
+	require.Equal(t, float64(3), jsonRes.Data.(map[string]any)["broken_at"])
+}
+
+func TestRequestID(t *testing.T) {
+	req := authorized(t, http.MethodGet, "/auth/", nil)
+	req.Header.Set("X-Request-ID", "req-42")
+	res := httptest.NewRecorder()
+
+	handler.ServeHTTP(res, req)
+
+	require.Equal(t, "req-42", res.Header().Get("X-Request-ID"))
+
+	req = authorized(t, http.MethodGet, "/auth/", nil)
+	req.Header.Set("X-Request-ID", "not a valid id")
+	res = httptest.NewRecorder()
+
+	handler.ServeHTTP(res, req)
+
+	require.Len(t, res.Header().Get("X-Request-ID"), 32)
+}
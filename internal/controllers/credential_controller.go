@@ -2,10 +2,13 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/ryanpujo/melius/internal/csrf"
+	"github.com/ryanpujo/melius/internal/jwttoken"
 	"github.com/ryanpujo/melius/internal/models"
 	"github.com/ryanpujo/melius/internal/services"
 	"github.com/ryanpujo/melius/internal/utilities"
@@ -14,12 +17,15 @@ import (
 // CredentialController handles user authentication and registration.
 type CredentialController struct {
 	credService services.CredentialInterface
+	cookie      *jwttoken.Cookie
 }
 
 // NewCredentialController initializes a new CredentialController with the provided credential service.
-func NewCredentialController(credService services.CredentialInterface) *CredentialController {
+// Access tokens are also set in cookie for browser apps, unless it is nil.
+func NewCredentialController(credService services.CredentialInterface, cookie *jwttoken.Cookie) *CredentialController {
 	return &CredentialController{
 		credService: credService,
+		cookie:      cookie,
 	}
 }
 
@@ -80,7 +86,25 @@ func (cc *CredentialController) Login(c *gin.Context) {
 
 	// Call service to authenticate user
 	jwt, err := cc.credService.Login(ctx, &payload)
-	if err != nil {
+	var stepUp *services.StepUpRequiredError
+	switch {
+	case errors.As(err, &stepUp):
+		// The login must be confirmed with the code emailed to the user.
+		c.JSON(http.StatusUnauthorized, utilities.Response{
+			Message: "Additional verification required",
+			Data: gin.H{
+				"challenge_id": stepUp.ChallengeID,
+				"expires_at":   stepUp.ExpiresAt,
+			},
+		})
+		return
+	case errors.Is(err, services.ErrLoginBlocked):
+		c.JSON(http.StatusForbidden, utilities.Response{
+			Message: "Login blocked",
+			Err:     err.Error(),
+		})
+		return
+	case err != nil:
 		c.JSON(http.StatusBadRequest, utilities.Response{
 			Message: "Login failed",
 			Err:     err.Error(),
@@ -89,8 +113,198 @@ func (cc *CredentialController) Login(c *gin.Context) {
 	}
 
 	// Respond with success
+	cc.respondToken(c, "Login successful", jwt)
+}
+
+// VerifyLogin completes a login held for step-up verification with the emailed code.
+func (cc *CredentialController) VerifyLogin(c *gin.Context) {
+	var payload models.VerifyLoginPayload
+
+	// Bind and validate JSON payload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, utilities.Response{
+			Message: "Validation error",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	// Set timeout context
+	ctx, cancel := context.WithTimeout(c, time.Second*1)
+	defer cancel()
+
+	jwt, err := cc.credService.VerifyLogin(ctx, payload)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, utilities.Response{
+			Message: "Verification failed",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	cc.respondToken(c, "Login successful", jwt)
+}
+
+// Reauthenticate confirms the password of the logged-in user and returns a token for
+// the current session with a fresh authentication time.
+func (cc *CredentialController) Reauthenticate(c *gin.Context) {
+	var payload models.ReauthPayload
+
+	// Bind and validate JSON payload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, utilities.Response{
+			Message: "Validation error",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	// Set timeout context
+	ctx, cancel := context.WithTimeout(c, time.Second*1)
+	defer cancel()
+
+	identity := jwttoken.Identity{
+		PrincipalType: jwttoken.PrincipalUser,
+		UserID:        c.GetUint("user_id"),
+		SessionID:     c.GetString("sid"),
+		ACR:           c.GetString("acr"),
+		AMR:           c.GetStringSlice("amr"),
+	}
+	jwt, err := cc.credService.Reauthenticate(ctx, identity, payload)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, utilities.Response{
+			Message: "Reauthentication failed",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	cc.respondRenewedToken(c, "Reauthentication successful", jwt)
+}
+
+// Refresh returns a new access token for the session of the current token, before it
+// expires, without the user logging in again.
+func (cc *CredentialController) Refresh(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, time.Second*1)
+	defer cancel()
+
+	jwt, err := cc.credService.Refresh(ctx, *jwttoken.IdentityOf(c))
+	switch {
+	case errors.Is(err, services.ErrRefreshForbidden):
+		c.JSON(http.StatusForbidden, utilities.Response{
+			Message: "Token cannot be refreshed",
+			Err:     err.Error(),
+		})
+		return
+	case err != nil:
+		c.JSON(http.StatusUnauthorized, utilities.Response{
+			Message: "Refresh failed",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	cc.respondRenewedToken(c, "Token refreshed successfully", jwt)
+}
+
+// Logout ends the current session and clears the cookies of the cookie transport.
+func (cc *CredentialController) Logout(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, time.Second*1)
+	defer cancel()
+
+	// Impersonation tokens are never set in the cookie, which may hold the token of the administrator.
+	if cc.cookie != nil && c.GetUint("actor_id") == 0 {
+		cc.cookie.Clear(c)
+		csrf.Clear(c, cc.cookie)
+	}
+
+	if err := cc.credService.Logout(ctx, c.GetUint("user_id"), c.GetString("sid")); err != nil {
+		c.JSON(http.StatusInternalServerError, utilities.Response{
+			Message: "Failed to log out",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, utilities.Response{
+		Message: "Logged out",
+	})
+}
+
+// Impersonate issues a token to the administrator for acting as the user identified in the path.
+// The token is only returned in the response body, never set in the cookie.
+func (cc *CredentialController) Impersonate(c *gin.Context) {
+	id, ok := paramID(c)
+	if !ok {
+		return
+	}
+
+	var payload models.ImpersonatePayload
+
+	// Bind and validate JSON payload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, utilities.Response{
+			Message: "Validation error",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c, time.Second*1)
+	defer cancel()
+
+	token, err := cc.credService.Impersonate(ctx, c.GetUint("user_id"), id, payload)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, services.ErrImpersonationForbidden) {
+			status = http.StatusForbidden
+		}
+		c.JSON(status, utilities.Response{
+			Message: "Failed to impersonate user",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, utilities.Response{
+		ID:      id,
+		Token:   token,
+		Message: "Impersonation started, log out with the token to end it",
+	})
+}
+
+// respondToken sends the access token of a successful authentication. With the cookie
+// transport enabled it is also set in the cookie, along with a new CSRF token.
+func (cc *CredentialController) respondToken(c *gin.Context, message, token string) {
+	if cc.cookie != nil {
+		ttl := jwttoken.Lifetime(jwttoken.KindUser)
+		cc.cookie.Set(c, token, ttl)
+		if err := csrf.Issue(c, cc.cookie, ttl); err != nil {
+			c.JSON(http.StatusInternalServerError, utilities.Response{
+				Message: "Failed to issue CSRF token",
+				Err:     err.Error(),
+			})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, utilities.Response{
+		Message: message,
+		Token:   token,
+	})
+}
+
+// respondRenewedToken sends a token replacing the one the request was authenticated
+// with. The cookie is only set when that token came from it, clients sending theirs
+// in the Authorization header, DPoP bound or not, are not given a cookie.
+func (cc *CredentialController) respondRenewedToken(c *gin.Context, message, token string) {
+	if jwttoken.IdentityOf(c).Transport == jwttoken.TransportCookie {
+		cc.respondToken(c, message, token)
+		return
+	}
+
 	c.JSON(http.StatusOK, utilities.Response{
-		Message: "Login successful",
-		Token:   jwt,
+		Message: message,
+		Token:   token,
 	})
 }
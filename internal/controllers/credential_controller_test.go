@@ -5,15 +5,22 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"slices"
 	"testing"
+	"time"
 
 	"github.com/ryanpujo/melius/internal/adapter"
 	"github.com/ryanpujo/melius/internal/controllers"
+	"github.com/ryanpujo/melius/internal/csrf"
+	"github.com/ryanpujo/melius/internal/jwttoken"
 	"github.com/ryanpujo/melius/internal/models"
+	"github.com/ryanpujo/melius/internal/requestinfo"
 	"github.com/ryanpujo/melius/internal/route"
+	"github.com/ryanpujo/melius/internal/services"
 	"github.com/ryanpujo/melius/internal/utilities"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
@@ -37,20 +44,109 @@ func (csm *CredServiceMock) Login(ctx context.Context, payload *models.LoginPayl
 	return args.String(0), args.Error(1)
 }
 
+func (csm *CredServiceMock) VerifyLogin(ctx context.Context, payload models.VerifyLoginPayload) (string, error) {
+	args := csm.Called(ctx, payload)
+	return args.String(0), args.Error(1)
+}
+
+func (csm *CredServiceMock) Logout(ctx context.Context, userID uint, sessionID string) error {
+	args := csm.Called(ctx, userID, sessionID)
+	return args.Error(0)
+}
+
+func (csm *CredServiceMock) IssueToken(ctx context.Context, userID uint, clientID, scope, dpopKey string) (string, error) {
+	args := csm.Called(ctx, userID, clientID, scope, dpopKey)
+	return args.String(0), args.Error(1)
+}
+
+func (csm *CredServiceMock) Impersonate(ctx context.Context, actorID, userID uint, payload models.ImpersonatePayload) (string, error) {
+	args := csm.Called(ctx, actorID, userID, payload)
+	return args.String(0), args.Error(1)
+}
+
+func (csm *CredServiceMock) Refresh(ctx context.Context, identity jwttoken.Identity) (string, error) {
+	args := csm.Called(ctx, identity)
+	return args.String(0), args.Error(1)
+}
+
+func (csm *CredServiceMock) Reauthenticate(ctx context.Context, identity jwttoken.Identity, payload models.ReauthPayload) (string, error) {
+	args := csm.Called(ctx, identity, payload)
+	return args.String(0), args.Error(1)
+}
+
 var (
 	csm     *CredServiceMock
+	usm     *UserServiceMock
+	asm     *AttrServiceMock
+	psm     *PrivacyServiceMock
+	ausm    *AuditServiceMock
+	ssm     *SessionServiceMock
+	aksm    *APIKeyServiceMock
+	sasm    *ServiceAccountServiceMock
+	dasm    *DeviceAuthorizationServiceMock
+	fasm    *ForwardAuthServiceMock
+	posm    *PolicyServiceMock
+	adapted adapter.Adapter
 	handler http.Handler
 )
 
 func TestMain(m *testing.M) {
 	csm = new(CredServiceMock)
-	credController := controllers.NewCredentialController(csm)
+	usm = new(UserServiceMock)
+	asm = new(AttrServiceMock)
+	psm = new(PrivacyServiceMock)
+	ausm = new(AuditServiceMock)
+	ssm = new(SessionServiceMock)
+	aksm = new(APIKeyServiceMock)
+	sasm = new(ServiceAccountServiceMock)
+	dasm = new(DeviceAuthorizationServiceMock)
+	fasm = new(ForwardAuthServiceMock)
+	posm = new(PolicyServiceMock)
+	credController := controllers.NewCredentialController(csm, nil)
+	userController := controllers.NewUserController(usm)
+	attrController := controllers.NewAttributeController(asm)
+	privacyController := controllers.NewPrivacyController(psm)
+	auditController := controllers.NewAuditController(ausm)
+	sessionController := controllers.NewSessionController(ssm)
+	apiKeyController := controllers.NewAPIKeyController(aksm)
+	serviceAccountController := controllers.NewServiceAccountController(sasm)
+	tokenController := controllers.NewTokenController(sasm, dasm, jwttoken.NewReplayCache())
+	deviceAuthController := controllers.NewDeviceAuthorizationController(dasm)
+	forwardAuthController := controllers.NewForwardAuthController(fasm)
+	policyController := controllers.NewPolicyController(posm)
 
-	handlerFunc := adapter.Adapter{
-		CredentialController: credController,
+	adapted = adapter.Adapter{
+		CredentialController:          credController,
+		UserController:                userController,
+		AttributeController:           attrController,
+		PrivacyController:             privacyController,
+		AuditController:               auditController,
+		SessionController:             sessionController,
+		APIKeyController:              apiKeyController,
+		ServiceAccountController:      serviceAccountController,
+		TokenController:               tokenController,
+		DeviceAuthorizationController: deviceAuthController,
+		ForwardAuthController:         forwardAuthController,
+		PolicyController:              policyController,
+		AuthOptions: []jwttoken.Option{
+			jwttoken.WithSessionChecker(func(ctx context.Context, userID uint, sid string) error {
+				if sid == revokedSession {
+					return errors.New("session revoked")
+				}
+				return nil
+			}),
+			jwttoken.WithAPIKeys(testAPIKeys),
+			jwttoken.WithServiceAccountChecker(func(ctx context.Context, id uint) error {
+				if id == disabledServiceAccount {
+					return errors.New("service account disabled")
+				}
+				return nil
+			}),
+		},
+		ReauthMaxAge: time.Minute,
 	}
 
-	handler = route.SetupRoutes(&handlerFunc)
+	handler = route.SetupRoutes(&adapted)
 
 	os.Exit(m.Run())
 }
@@ -137,6 +233,10 @@ func TestLogin(t *testing.T) {
 		Password: "okeoke",
 	}
 	jsonStrValid, _ := json.Marshal(loginPayload)
+	identifierJson, _ := json.Marshal(models.LoginPayload{
+		Identifier: "ryanpujo@gmail.com",
+		Password:   "okeoke",
+	})
 	invalidJson, _ := json.Marshal(invalidLoginPayload)
 	tableTest := map[string]struct {
 		json    []byte
@@ -154,6 +254,16 @@ func TestLogin(t *testing.T) {
 				require.NotZero(t, json.Token)
 			},
 		},
+		"success with identifier": {
+			json: identifierJson,
+			arrange: func() {
+				csm.On("Login", mock.Anything, mock.Anything).Return("token", nil).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusOK, statusCode)
+				require.NotZero(t, json.Token)
+			},
+		},
 		"failed": {
 			json: jsonStrValid,
 			arrange: func() {
@@ -166,6 +276,29 @@ func TestLogin(t *testing.T) {
 				require.Equal(t, "Login failed", json.Message)
 			},
 		},
+		"step up required": {
+			json: jsonStrValid,
+			arrange: func() {
+				stepUp := &services.StepUpRequiredError{ChallengeID: "challenge", ExpiresAt: time.Now().Add(time.Minute)}
+				csm.On("Login", mock.Anything, mock.Anything).Return("", stepUp).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusUnauthorized, statusCode)
+				require.Zero(t, json.Token)
+				require.Equal(t, "Additional verification required", json.Message)
+				require.Equal(t, "challenge", json.Data.(map[string]any)["challenge_id"])
+			},
+		},
+		"blocked": {
+			json: jsonStrValid,
+			arrange: func() {
+				csm.On("Login", mock.Anything, mock.Anything).Return("", services.ErrLoginBlocked).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusForbidden, statusCode)
+				require.Equal(t, "Login blocked", json.Message)
+			},
+		},
 		"validation failed": {
 			json:    invalidJson,
 			arrange: func() {},
@@ -193,3 +326,557 @@ func TestLogin(t *testing.T) {
 		})
 	}
 }
+
+func TestVerifyLogin(t *testing.T) {
+	payload := models.VerifyLoginPayload{ChallengeID: "challenge", Code: "123456"}
+	validJson, _ := json.Marshal(payload)
+	invalidJson, _ := json.Marshal(models.VerifyLoginPayload{ChallengeID: "challenge", Code: "12ab"})
+	tableTest := map[string]struct {
+		json    []byte
+		arrange func()
+		assert  func(t *testing.T, statusCode int, json utilities.Response)
+	}{
+		"success": {
+			json: validJson,
+			arrange: func() {
+				csm.On("VerifyLogin", mock.Anything, payload).Return("token", nil).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusOK, statusCode)
+				require.Equal(t, "token", json.Token)
+			},
+		},
+		"invalid code": {
+			json: validJson,
+			arrange: func() {
+				csm.On("VerifyLogin", mock.Anything, payload).Return("", services.ErrChallengeInvalid).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusUnauthorized, statusCode)
+				require.Zero(t, json.Token)
+				require.Equal(t, "Verification failed", json.Message)
+			},
+		},
+		"validation failed": {
+			json:    invalidJson,
+			arrange: func() {},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusBadRequest, statusCode)
+				require.Equal(t, "Validation error", json.Message)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			req := httptest.NewRequest(http.MethodPost, "/login/verify", bytes.NewReader(v.json))
+			res := httptest.NewRecorder()
+
+			handler.ServeHTTP(res, req)
+
+			var jsonRes utilities.Response
+
+			json.NewDecoder(res.Body).Decode(&jsonRes)
+
+			v.assert(t, res.Code, jsonRes)
+		})
+	}
+}
+
+func TestLoginDeviceCookie(t *testing.T) {
+	body, _ := json.Marshal(models.LoginPayload{Username: "ryanpujo", Password: "okeoke"})
+
+	csm.On("Login", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		require.NotZero(t, requestinfo.FromContext(args.Get(0).(context.Context)).DeviceID)
+	}).Return("token", nil).Once()
+	req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewReader(body))
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	require.Equal(t, http.StatusOK, res.Code)
+
+	cookies := res.Result().Cookies()
+	require.Len(t, cookies, 1)
+	require.Equal(t, requestinfo.DeviceCookie, cookies[0].Name)
+	require.True(t, cookies[0].HttpOnly)
+
+	// A client that already has a device cookie keeps it.
+	csm.On("Login", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		require.Equal(t, "known", requestinfo.FromContext(args.Get(0).(context.Context)).DeviceID)
+	}).Return("token", nil).Once()
+	req = httptest.NewRequest(http.MethodPost, "/login", bytes.NewReader(body))
+	req.AddCookie(&http.Cookie{Name: requestinfo.DeviceCookie, Value: "known"})
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	require.Equal(t, http.StatusOK, res.Code)
+	require.Empty(t, res.Result().Cookies())
+}
+
+func TestReauthenticate(t *testing.T) {
+	payload := models.ReauthPayload{Password: "okeoke"}
+	identity := jwttoken.Identity{
+		PrincipalType: jwttoken.PrincipalUser,
+		UserID:        1,
+		SessionID:     currentSession,
+		ACR:           jwttoken.ACRSingleFactor,
+		AMR:           []string{jwttoken.AMRPassword},
+	}
+	validJson, _ := json.Marshal(payload)
+	tableTest := map[string]struct {
+		json    []byte
+		arrange func()
+		assert  func(t *testing.T, statusCode int, json utilities.Response)
+	}{
+		"success": {
+			json: validJson,
+			arrange: func() {
+				csm.On("Reauthenticate", mock.Anything, identity, payload).Return("token", nil).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusOK, statusCode)
+				require.Equal(t, "token", json.Token)
+			},
+		},
+		"wrong password": {
+			json: validJson,
+			arrange: func() {
+				csm.On("Reauthenticate", mock.Anything, identity, payload).Return("", errors.New("failed")).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusUnauthorized, statusCode)
+				require.Equal(t, "Reauthentication failed", json.Message)
+			},
+		},
+		"validation failed": {
+			json:    []byte(`{}`),
+			arrange: func() {},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusBadRequest, statusCode)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			req := authorized(t, http.MethodPost, "/auth/me/reauth", v.json)
+			res := httptest.NewRecorder()
+
+			handler.ServeHTTP(res, req)
+
+			var jsonRes utilities.Response
+
+			json.NewDecoder(res.Body).Decode(&jsonRes)
+
+			v.assert(t, res.Code, jsonRes)
+		})
+	}
+}
+
+func TestRefreshToken(t *testing.T) {
+	session := mock.MatchedBy(func(identity jwttoken.Identity) bool {
+		return identity.UserID == 1 && identity.SessionID == currentSession && identity.ACR == jwttoken.ACRSingleFactor
+	})
+	tableTest := map[string]struct {
+		arrange func()
+		assert  func(t *testing.T, statusCode int, json utilities.Response)
+	}{
+		"success": {
+			arrange: func() {
+				csm.On("Refresh", mock.Anything, session).Return("token", nil).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusOK, statusCode)
+				require.Equal(t, "token", json.Token)
+			},
+		},
+		"forbidden": {
+			arrange: func() {
+				csm.On("Refresh", mock.Anything, session).Return("", services.ErrRefreshForbidden).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusForbidden, statusCode)
+			},
+		},
+		"session ended": {
+			arrange: func() {
+				csm.On("Refresh", mock.Anything, session).Return("", errors.New("failed")).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusUnauthorized, statusCode)
+				require.Equal(t, "Refresh failed", json.Message)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			req := authorized(t, http.MethodPost, "/auth/refresh", nil)
+			res := httptest.NewRecorder()
+
+			handler.ServeHTTP(res, req)
+
+			var jsonRes utilities.Response
+
+			json.NewDecoder(res.Body).Decode(&jsonRes)
+
+			v.assert(t, res.Code, jsonRes)
+		})
+	}
+}
+
+func TestRecentAuthRequired(t *testing.T) {
+	claims := jwttoken.NewClaims(1, "ryanpujo")
+	claims.SessionID = currentSession
+	claims.Authenticated(time.Now().Add(-time.Hour), jwttoken.ACRSingleFactor, jwttoken.AMRPassword)
+	token, err := jwttoken.GenerateToken(claims)
+	require.NoError(t, err)
+
+	for _, target := range []string{"/auth/me/password", "/auth/me/erase"} {
+		req := httptest.NewRequest(http.MethodPost, target, bytes.NewReader([]byte(`{}`)))
+		req.Header.Set("Authorization", "Bearer "+token)
+		res := httptest.NewRecorder()
+
+		handler.ServeHTTP(res, req)
+
+		require.Equal(t, http.StatusUnauthorized, res.Code)
+		require.Contains(t, res.Header().Get("WWW-Authenticate"), `error="insufficient_user_authentication"`)
+		require.Contains(t, res.Header().Get("WWW-Authenticate"), "max_age=60")
+	}
+}
+
+func TestAdminRecentAuthRequired(t *testing.T) {
+	claims := jwttoken.NewClaims(1, "ryanpujo")
+	claims.Roles = []string{models.RoleAdmin}
+	claims.SessionID = currentSession
+	claims.Authenticated(time.Now().Add(-time.Hour), jwttoken.ACRSingleFactor, jwttoken.AMRPassword)
+	token, err := jwttoken.GenerateToken(claims)
+	require.NoError(t, err)
+
+	tableTest := map[string]struct {
+		method string
+		target string
+	}{
+		"read":                 {method: http.MethodGet, target: "/admin/attributes"},
+		"role assignment":      {method: http.MethodPut, target: "/admin/users/2/roles/admin"},
+		"role revocation":      {method: http.MethodDelete, target: "/admin/users/2/roles/admin"},
+		"impersonation":        {method: http.MethodPost, target: "/admin/users/5/impersonate"},
+		"erasure":              {method: http.MethodPost, target: "/admin/users/2/erase"},
+		"policy":               {method: http.MethodPut, target: "/admin/policies/admins"},
+		"service account role": {method: http.MethodPut, target: "/admin/service-accounts/7/roles/admin"},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			req := httptest.NewRequest(v.method, v.target, bytes.NewReader([]byte(`{}`)))
+			req.Header.Set("Authorization", "Bearer "+token)
+			res := httptest.NewRecorder()
+
+			handler.ServeHTTP(res, req)
+
+			require.Equal(t, http.StatusUnauthorized, res.Code)
+			require.Contains(t, res.Header().Get("WWW-Authenticate"), `error="insufficient_user_authentication"`)
+		})
+	}
+}
+
+func TestCookieTransport(t *testing.T) {
+	cookie := &jwttoken.Cookie{Name: "melius_session", Secure: true, SameSite: http.SameSiteStrictMode}
+	cookieAdapted := adapted
+	cookieAdapted.CredentialController = controllers.NewCredentialController(csm, cookie)
+	cookieAdapted.AuthOptions = append(slices.Clone(adapted.AuthOptions), jwttoken.WithCookie(cookie.Name))
+	cookieHandler := route.SetupRoutes(&cookieAdapted)
+
+	claims := jwttoken.NewClaims(1, "ryanpujo")
+	claims.SessionID = currentSession
+	token, err := jwttoken.GenerateToken(claims)
+	require.NoError(t, err)
+
+	cookies := func(res *httptest.ResponseRecorder) map[string]*http.Cookie {
+		byName := map[string]*http.Cookie{}
+		for _, c := range res.Result().Cookies() {
+			byName[c.Name] = c
+		}
+		return byName
+	}
+
+	t.Run("login sets cookies", func(t *testing.T) {
+		body, _ := json.Marshal(models.LoginPayload{Username: "ryanpujo", Password: "okeoke"})
+		csm.On("Login", mock.Anything, mock.Anything).Return(token, nil).Once()
+		req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewReader(body))
+		res := httptest.NewRecorder()
+
+		cookieHandler.ServeHTTP(res, req)
+
+		require.Equal(t, http.StatusOK, res.Code)
+		set := cookies(res)
+		require.Equal(t, token, set["melius_session"].Value)
+		require.True(t, set["melius_session"].HttpOnly)
+		require.True(t, set["melius_session"].Secure)
+		require.Equal(t, http.SameSiteStrictMode, set["melius_session"].SameSite)
+		require.NotZero(t, set[csrf.Cookie].Value)
+		require.False(t, set[csrf.Cookie].HttpOnly)
+		require.Equal(t, set[csrf.Cookie].Value, res.Header().Get(csrf.Header))
+	})
+
+	t.Run("authenticates by cookie", func(t *testing.T) {
+		usm.On("Profile", mock.Anything, uint(1)).Return(&me, nil).Once()
+		req := httptest.NewRequest(http.MethodGet, "/auth/me", nil)
+		req.AddCookie(&http.Cookie{Name: "melius_session", Value: token})
+		res := httptest.NewRecorder()
+
+		cookieHandler.ServeHTTP(res, req)
+
+		require.Equal(t, http.StatusOK, res.Code)
+	})
+
+	t.Run("header takes precedence", func(t *testing.T) {
+		usm.On("Profile", mock.Anything, uint(1)).Return(&me, nil).Once()
+		req := httptest.NewRequest(http.MethodGet, "/auth/me", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.AddCookie(&http.Cookie{Name: "melius_session", Value: "invalid"})
+		res := httptest.NewRecorder()
+
+		cookieHandler.ServeHTTP(res, req)
+
+		require.Equal(t, http.StatusOK, res.Code)
+	})
+
+	t.Run("refresh by header sets no cookie", func(t *testing.T) {
+		csm.On("Refresh", mock.Anything, mock.Anything).Return("refreshed", nil).Once()
+		req := httptest.NewRequest(http.MethodPost, "/auth/refresh", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		res := httptest.NewRecorder()
+
+		cookieHandler.ServeHTTP(res, req)
+
+		require.Equal(t, http.StatusOK, res.Code)
+		require.Empty(t, res.Result().Cookies())
+	})
+
+	t.Run("refresh by cookie replaces it", func(t *testing.T) {
+		csm.On("Refresh", mock.Anything, mock.Anything).Return("refreshed", nil).Once()
+		req := httptest.NewRequest(http.MethodPost, "/auth/refresh", nil)
+		req.AddCookie(&http.Cookie{Name: "melius_session", Value: token})
+		req.AddCookie(&http.Cookie{Name: csrf.Cookie, Value: "csrf"})
+		req.Header.Set(csrf.Header, "csrf")
+		res := httptest.NewRecorder()
+
+		cookieHandler.ServeHTTP(res, req)
+
+		require.Equal(t, http.StatusOK, res.Code)
+		set := cookies(res)
+		require.Equal(t, "refreshed", set["melius_session"].Value)
+		require.NotZero(t, set[csrf.Cookie].Value)
+	})
+
+	t.Run("missing csrf token", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/auth/logout", nil)
+		req.AddCookie(&http.Cookie{Name: "melius_session", Value: token})
+		req.AddCookie(&http.Cookie{Name: csrf.Cookie, Value: "csrf"})
+		res := httptest.NewRecorder()
+
+		cookieHandler.ServeHTTP(res, req)
+
+		require.Equal(t, http.StatusForbidden, res.Code)
+	})
+
+	t.Run("logout clears cookies", func(t *testing.T) {
+		csm.On("Logout", mock.Anything, uint(1), currentSession).Return(nil).Once()
+		req := httptest.NewRequest(http.MethodPost, "/auth/logout", nil)
+		req.AddCookie(&http.Cookie{Name: "melius_session", Value: token})
+		req.AddCookie(&http.Cookie{Name: csrf.Cookie, Value: "csrf"})
+		req.Header.Set(csrf.Header, "csrf")
+		res := httptest.NewRecorder()
+
+		cookieHandler.ServeHTTP(res, req)
+
+		require.Equal(t, http.StatusOK, res.Code)
+		set := cookies(res)
+		require.Negative(t, set["melius_session"].MaxAge)
+		require.Negative(t, set[csrf.Cookie].MaxAge)
+	})
+}
+
+func TestLogout(t *testing.T) {
+	tableTest := map[string]struct {
+		arrange func()
+		assert  func(t *testing.T, statusCode int, json utilities.Response)
+	}{
+		"success": {
+			arrange: func() {
+				csm.On("Logout", mock.Anything, uint(1), currentSession).Return(nil).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusOK, statusCode)
+				require.Equal(t, "Logged out", json.Message)
+			},
+		},
+		"failed": {
+			arrange: func() {
+				csm.On("Logout", mock.Anything, uint(1), currentSession).Return(errors.New("failed")).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusInternalServerError, statusCode)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			// Requests authenticated by the Authorization header need no CSRF token.
+			req := authorized(t, http.MethodPost, "/auth/logout", nil)
+			res := httptest.NewRecorder()
+
+			handler.ServeHTTP(res, req)
+
+			var jsonRes utilities.Response
+
+			json.NewDecoder(res.Body).Decode(&jsonRes)
+
+			v.assert(t, res.Code, jsonRes)
+		})
+	}
+}
+
+// impersonating returns a request made with the token of administrator 2 impersonating user 1.
+func impersonating(t *testing.T, method, target string, body []byte) *http.Request {
+	claims := jwttoken.NewClaims(1, "ryanpujo")
+	claims.SessionID = currentSession
+	claims.Actor = &jwttoken.Actor{Subject: "2", Username: "admin"}
+	token, err := jwttoken.GenerateToken(claims)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(method, target, bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
+
+func TestImpersonate(t *testing.T) {
+	payload := models.ImpersonatePayload{Reason: "ticket 42"}
+	validJson, _ := json.Marshal(payload)
+
+	tableTest := map[string]struct {
+		json    []byte
+		arrange func()
+		assert  func(t *testing.T, statusCode int, json utilities.Response)
+	}{
+		"success": {
+			json: validJson,
+			arrange: func() {
+				csm.On("Impersonate", mock.Anything, uint(1), uint(5), payload).Return("token", nil).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusOK, statusCode)
+				require.Equal(t, "token", json.Token)
+			},
+		},
+		"administrator": {
+			json: validJson,
+			arrange: func() {
+				csm.On("Impersonate", mock.Anything, uint(1), uint(5), payload).
+					Return("", fmt.Errorf("%w: cannot impersonate an administrator", services.ErrImpersonationForbidden)).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusForbidden, statusCode)
+				require.Zero(t, json.Token)
+			},
+		},
+		"reason required": {
+			json:    []byte(`{}`),
+			arrange: func() {},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusBadRequest, statusCode)
+				require.Equal(t, "Validation error", json.Message)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			req := authorized(t, http.MethodPost, "/admin/users/5/impersonate", v.json, models.RoleAdmin)
+			res := httptest.NewRecorder()
+
+			handler.ServeHTTP(res, req)
+
+			var jsonRes utilities.Response
+
+			json.NewDecoder(res.Body).Decode(&jsonRes)
+
+			v.assert(t, res.Code, jsonRes)
+		})
+	}
+}
+
+func TestImpersonationRestrictions(t *testing.T) {
+	password, _ := json.Marshal(models.ChangePasswordPayload{CurrentPassword: "okeoke", NewPassword: "okeoke2"})
+
+	tableTest := map[string]struct {
+		method  string
+		target  string
+		json    []byte
+		arrange func()
+		status  int
+	}{
+		"view profile": {
+			method: http.MethodGet,
+			target: "/auth/me",
+			arrange: func() {
+				usm.On("Profile", mock.Anything, uint(1)).Return(&me, nil).Once()
+			},
+			status: http.StatusOK,
+		},
+		"change password": {
+			method:  http.MethodPost,
+			target:  "/auth/me/password",
+			json:    password,
+			arrange: func() {},
+			status:  http.StatusForbidden,
+		},
+		"reauthenticate": {
+			method:  http.MethodPost,
+			target:  "/auth/me/reauth",
+			json:    []byte(`{"password":"okeoke"}`),
+			arrange: func() {},
+			status:  http.StatusForbidden,
+		},
+		"create api key": {
+			method:  http.MethodPost,
+			target:  "/auth/me/api-keys",
+			json:    []byte(`{"name":"ci","scopes":["read"]}`),
+			arrange: func() {},
+			status:  http.StatusForbidden,
+		},
+		"end": {
+			method: http.MethodPost,
+			target: "/auth/logout",
+			arrange: func() {
+				csm.On("Logout", mock.MatchedBy(func(ctx context.Context) bool {
+					return requestinfo.ActorID(ctx) == 2
+				}), uint(1), currentSession).Return(nil).Once()
+			},
+			status: http.StatusOK,
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			req := impersonating(t, v.method, v.target, v.json)
+			res := httptest.NewRecorder()
+
+			handler.ServeHTTP(res, req)
+
+			require.Equal(t, v.status, res.Code)
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/ryanpujo/melius/internal/services"
+	"github.com/ryanpujo/melius/internal/utilities"
+)
+
+// DeviceAuthorizationController serves the device authorization grant: devices start
+// it at the device authorization endpoint and logged-in users approve their user code.
+type DeviceAuthorizationController struct {
+	deviceAuthService services.DeviceAuthorizationInterface
+}
+
+// NewDeviceAuthorizationController initializes a new DeviceAuthorizationController with the provided service.
+func NewDeviceAuthorizationController(deviceAuthService services.DeviceAuthorizationInterface) *DeviceAuthorizationController {
+	return &DeviceAuthorizationController{
+		deviceAuthService: deviceAuthService,
+	}
+}
+
+// Authorize issues the device and user codes of a device. Like the token endpoint,
+// it takes form encoded requests and answers with RFC 6749 errors.
+func (dc *DeviceAuthorizationController) Authorize(c *gin.Context) {
+	var request models.DeviceAuthorizationRequest
+
+	if err := c.ShouldBind(&request); err != nil {
+		c.JSON(http.StatusBadRequest, &models.OAuthError{Code: models.OAuthInvalidRequest, Description: err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c, time.Second*1)
+	defer cancel()
+
+	res, err := dc.deviceAuthService.Authorize(ctx, request)
+	if err != nil {
+		respondOAuthError(c, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, res)
+}
+
+// Lookup returns the pending device authorization of the user_code query parameter,
+// for the logged-in user to review before deciding.
+func (dc *DeviceAuthorizationController) Lookup(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, time.Second*1)
+	defer cancel()
+
+	authorization, err := dc.deviceAuthService.Lookup(ctx, c.Query("user_code"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, utilities.Response{
+			Message: "Device code not found or expired",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, utilities.Response{
+		Data: authorization,
+	})
+}
+
+// Decide approves or denies the device authorization of a user code for the logged-in user.
+func (dc *DeviceAuthorizationController) Decide(c *gin.Context) {
+	var payload models.DeviceDecisionPayload
+
+	// Bind and validate JSON payload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, utilities.Response{
+			Message: "Validation error",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c, time.Second*1)
+	defer cancel()
+
+	if err := dc.deviceAuthService.Decide(ctx, c.GetUint("user_id"), payload); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrUserCodeInvalid) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, utilities.Response{
+			Message: "Failed to decide device authorization",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	message := "Device denied"
+	if *payload.Approve {
+		message = "Device approved"
+	}
+	c.JSON(http.StatusOK, utilities.Response{
+		Message: message,
+	})
+}
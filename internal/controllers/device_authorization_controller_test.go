@@ -0,0 +1,231 @@
+package controllers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ryanpujo/melius/internal/jwttoken"
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/ryanpujo/melius/internal/services"
+	"github.com/ryanpujo/melius/internal/utilities"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type DeviceAuthorizationServiceMock struct {
+	mock.Mock
+}
+
+func (dasm *DeviceAuthorizationServiceMock) Authorize(
+	ctx context.Context, request models.DeviceAuthorizationRequest,
+) (*models.DeviceAuthorizationResponse, error) {
+	args := dasm.Called(ctx, request)
+	return args.Get(0).(*models.DeviceAuthorizationResponse), args.Error(1)
+}
+
+func (dasm *DeviceAuthorizationServiceMock) Lookup(ctx context.Context, userCode string) (*models.DeviceAuthorization, error) {
+	args := dasm.Called(ctx, userCode)
+	return args.Get(0).(*models.DeviceAuthorization), args.Error(1)
+}
+
+func (dasm *DeviceAuthorizationServiceMock) Decide(ctx context.Context, userID uint, payload models.DeviceDecisionPayload) error {
+	args := dasm.Called(ctx, userID, payload)
+	return args.Error(0)
+}
+
+func (dasm *DeviceAuthorizationServiceMock) Token(ctx context.Context, request models.TokenRequest) (*models.TokenResponse, error) {
+	args := dasm.Called(ctx, request)
+	return args.Get(0).(*models.TokenResponse), args.Error(1)
+}
+
+func TestDeviceAuthorization(t *testing.T) {
+	tableTest := map[string]struct {
+		form    url.Values
+		arrange func()
+		assert  func(t *testing.T, res *httptest.ResponseRecorder)
+	}{
+		"success": {
+			form: url.Values{"client_id": {"melius-cli"}, "scope": {"read"}},
+			arrange: func() {
+				dasm.On("Authorize", mock.Anything, models.DeviceAuthorizationRequest{ClientID: "melius-cli", Scope: "read"}).
+					Return(&models.DeviceAuthorizationResponse{DeviceCode: "device", UserCode: "BCDF-GHJK", Interval: 5}, nil).Once()
+			},
+			assert: func(t *testing.T, res *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, res.Code)
+				require.Equal(t, "no-store", res.Header().Get("Cache-Control"))
+
+				var authorization models.DeviceAuthorizationResponse
+				require.NoError(t, json.NewDecoder(res.Body).Decode(&authorization))
+				require.Equal(t, "BCDF-GHJK", authorization.UserCode)
+			},
+		},
+		"unknown client": {
+			form: url.Values{"client_id": {"other"}},
+			arrange: func() {
+				dasm.On("Authorize", mock.Anything, models.DeviceAuthorizationRequest{ClientID: "other"}).
+					Return((*models.DeviceAuthorizationResponse)(nil), &models.OAuthError{Code: models.OAuthInvalidClient}).Once()
+			},
+			assert: func(t *testing.T, res *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, res.Code)
+			},
+		},
+		"missing client": {
+			form:    url.Values{},
+			arrange: func() {},
+			assert: func(t *testing.T, res *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, res.Code)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			req := httptest.NewRequest(http.MethodPost, "/oauth/device_authorization", strings.NewReader(v.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			res := httptest.NewRecorder()
+
+			handler.ServeHTTP(res, req)
+
+			v.assert(t, res)
+		})
+	}
+}
+
+// deviceRequest returns a request approving a device with the token of user 1, edited by edit.
+func deviceRequest(t *testing.T, body []byte, edit func(claims *jwttoken.Claims)) *http.Request {
+	claims := jwttoken.NewClaims(1, "ryanpujo")
+	claims.SessionID = currentSession
+	claims.Authenticated(time.Now(), jwttoken.ACRSingleFactor, jwttoken.AMRPassword)
+	edit(&claims)
+	token, err := jwttoken.GenerateToken(claims)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/auth/me/device", bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
+
+func TestDeviceDecision(t *testing.T) {
+	approve := true
+	payload := models.DeviceDecisionPayload{UserCode: "BCDF-GHJK", Approve: &approve}
+	validJson, _ := json.Marshal(payload)
+
+	tableTest := map[string]struct {
+		request func(t *testing.T) *http.Request
+		arrange func()
+		status  int
+	}{
+		"lookup": {
+			request: func(t *testing.T) *http.Request {
+				return authorized(t, http.MethodGet, "/auth/me/device?user_code=BCDF-GHJK", nil)
+			},
+			arrange: func() {
+				dasm.On("Lookup", mock.Anything, "BCDF-GHJK").
+					Return(&models.DeviceAuthorization{UserCode: "BCDFGHJK", ClientID: "melius-cli"}, nil).Once()
+			},
+			status: http.StatusOK,
+		},
+		"lookup expired": {
+			request: func(t *testing.T) *http.Request {
+				return authorized(t, http.MethodGet, "/auth/me/device?user_code=BCDF-GHJK", nil)
+			},
+			arrange: func() {
+				dasm.On("Lookup", mock.Anything, "BCDF-GHJK").
+					Return((*models.DeviceAuthorization)(nil), services.ErrUserCodeInvalid).Once()
+			},
+			status: http.StatusNotFound,
+		},
+		"approve": {
+			request: func(t *testing.T) *http.Request {
+				return authorized(t, http.MethodPost, "/auth/me/device", validJson)
+			},
+			arrange: func() {
+				dasm.On("Decide", mock.Anything, uint(1), payload).Return(nil).Once()
+			},
+			status: http.StatusOK,
+		},
+		"approve expired": {
+			request: func(t *testing.T) *http.Request {
+				return authorized(t, http.MethodPost, "/auth/me/device", validJson)
+			},
+			arrange: func() {
+				dasm.On("Decide", mock.Anything, uint(1), payload).Return(services.ErrUserCodeInvalid).Once()
+			},
+			status: http.StatusNotFound,
+		},
+		"missing decision": {
+			request: func(t *testing.T) *http.Request {
+				return authorized(t, http.MethodPost, "/auth/me/device", []byte(`{"user_code":"BCDF-GHJK"}`))
+			},
+			arrange: func() {},
+			status:  http.StatusBadRequest,
+		},
+		"while impersonating": {
+			request: func(t *testing.T) *http.Request {
+				return impersonating(t, http.MethodPost, "/auth/me/device", validJson)
+			},
+			arrange: func() {},
+			status:  http.StatusForbidden,
+		},
+		"with an API key": {
+			request: func(t *testing.T) *http.Request {
+				req := httptest.NewRequest(http.MethodPost, "/auth/me/device", bytes.NewReader(validJson))
+				req.Header.Set("Authorization", "ApiKey "+writeKey)
+				return req
+			},
+			arrange: func() {},
+			status:  http.StatusForbidden,
+		},
+		"with a client token": {
+			request: func(t *testing.T) *http.Request {
+				return deviceRequest(t, validJson, func(claims *jwttoken.Claims) {
+					claims.ClientID = "melius-cli"
+				})
+			},
+			arrange: func() {},
+			status:  http.StatusForbidden,
+		},
+		"with a scoped token": {
+			request: func(t *testing.T) *http.Request {
+				return deviceRequest(t, validJson, func(claims *jwttoken.Claims) {
+					claims.Scope = "read"
+				})
+			},
+			arrange: func() {},
+			status:  http.StatusForbidden,
+		},
+		"without recent authentication": {
+			request: func(t *testing.T) *http.Request {
+				return deviceRequest(t, validJson, func(claims *jwttoken.Claims) {
+					claims.Authenticated(time.Now().Add(-time.Hour), jwttoken.ACRSingleFactor, jwttoken.AMRPassword)
+				})
+			},
+			arrange: func() {},
+			status:  http.StatusUnauthorized,
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			res := httptest.NewRecorder()
+
+			handler.ServeHTTP(res, v.request(t))
+
+			var jsonRes utilities.Response
+			json.NewDecoder(res.Body).Decode(&jsonRes)
+
+			require.Equal(t, v.status, res.Code, jsonRes.Err)
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/ryanpujo/melius/internal/services"
+	"github.com/ryanpujo/melius/internal/utilities"
+)
+
+// ForwardAuthController answers the subrequests of reverse proxies, nginx auth_request
+// or Traefik ForwardAuth, asking whether a request to an app they protect may pass.
+type ForwardAuthController struct {
+	forwardAuthService services.ForwardAuthInterface
+}
+
+// NewForwardAuthController initializes a new ForwardAuthController with the provided forward auth service.
+func NewForwardAuthController(forwardAuthService services.ForwardAuthInterface) *ForwardAuthController {
+	return &ForwardAuthController{
+		forwardAuthService: forwardAuthService,
+	}
+}
+
+// Authorize lets the forwarded request pass with 200 and the identity headers of the
+// principal, along with X-Auth-Actor for impersonation tokens, or refuses it with 403.
+// It must run after JWTAuthMiddleware, refusing DPoP bound tokens with WithoutDPoP:
+// their proofs are signed for the URL of the app, not of forward auth.
+func (fc *ForwardAuthController) Authorize(c *gin.Context) {
+	request := forwardedRequest(c)
+	request.UserID = c.GetUint("user_id")
+	request.Username = c.GetString("username")
+	request.Roles = c.GetStringSlice("roles")
+	request.ActorID = c.GetUint("actor_id")
+
+	ctx, cancel := context.WithTimeout(c, time.Second*1)
+	defer cancel()
+
+	identity, err := fc.forwardAuthService.Authorize(ctx, request)
+	switch {
+	case errors.Is(err, services.ErrForwardAuthHost), errors.Is(err, services.ErrForwardAuthRole),
+		errors.Is(err, services.ErrForwardAuthPath):
+		c.JSON(http.StatusForbidden, utilities.Response{
+			Message: "Access denied",
+			Err:     err.Error(),
+		})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, utilities.Response{
+			Message: "Failed to authorize request",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	c.Header(models.HeaderAuthUser, identity.Username)
+	c.Header(models.HeaderAuthEmail, identity.Email)
+	c.Header(models.HeaderAuthRoles, strings.Join(identity.Roles, ","))
+	if identity.Actor != "" {
+		c.Header(models.HeaderAuthActor, identity.Actor)
+	}
+	c.Status(http.StatusOK)
+}
+
+// Unauthorized answers the forwarded requests JWTAuthMiddleware rejects. Browsers are
+// redirected to the login page of the host, if it has one, other clients get 401.
+func (fc *ForwardAuthController) Unauthorized(c *gin.Context, message string) {
+	if strings.Contains(c.GetHeader("Accept"), "text/html") {
+		if login := fc.forwardAuthService.LoginURL(forwardedRequest(c)); login != "" {
+			c.Redirect(http.StatusFound, login)
+			return
+		}
+	}
+	c.JSON(http.StatusUnauthorized, gin.H{"error": message})
+}
+
+// forwardedRequest returns the request to the app, told by the headers of Traefik,
+// X-Forwarded-Host and X-Forwarded-Uri, or those commonly set for nginx auth_request,
+// X-Original-URL or X-Original-URI.
+func forwardedRequest(c *gin.Context) models.ForwardAuthRequest {
+	request := models.ForwardAuthRequest{
+		Host:  c.GetHeader("X-Forwarded-Host"),
+		Proto: c.GetHeader("X-Forwarded-Proto"),
+		URI:   c.GetHeader("X-Forwarded-Uri"),
+	}
+	if original, err := url.Parse(c.GetHeader("X-Original-URL")); err == nil && original.Host != "" {
+		if request.Host == "" {
+			request.Host = original.Host
+		}
+		if request.Proto == "" {
+			request.Proto = original.Scheme
+		}
+		if request.URI == "" {
+			request.URI = original.RequestURI()
+		}
+	}
+	if request.URI == "" {
+		request.URI = c.GetHeader("X-Original-URI")
+	}
+	if request.Host == "" {
+		request.Host = c.Request.Host
+	}
+	if request.URI == "" {
+		request.URI = "/"
+	}
+	return request
+}
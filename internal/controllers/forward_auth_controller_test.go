@@ -0,0 +1,214 @@
+package controllers_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ryanpujo/melius/internal/jwttoken"
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/ryanpujo/melius/internal/services"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type ForwardAuthServiceMock struct {
+	mock.Mock
+}
+
+func (fasm *ForwardAuthServiceMock) Authorize(ctx context.Context, request models.ForwardAuthRequest) (*models.ForwardAuthIdentity, error) {
+	args := fasm.Called(ctx, request)
+	return args.Get(0).(*models.ForwardAuthIdentity), args.Error(1)
+}
+
+func (fasm *ForwardAuthServiceMock) LoginURL(request models.ForwardAuthRequest) string {
+	args := fasm.Called(request)
+	return args.String(0)
+}
+
+func TestForwardAuth(t *testing.T) {
+	tableTest := map[string]struct {
+		request func(t *testing.T) *http.Request
+		arrange func()
+		assert  func(t *testing.T, res *httptest.ResponseRecorder)
+	}{
+		"traefik": {
+			request: func(t *testing.T) *http.Request {
+				req := authorized(t, http.MethodGet, "/forward-auth", nil, "admin", "staff")
+				req.Header.Set("X-Forwarded-Host", "app.example.com")
+				req.Header.Set("X-Forwarded-Proto", "https")
+				req.Header.Set("X-Forwarded-Uri", "/admin/users")
+				return req
+			},
+			arrange: func() {
+				request := models.ForwardAuthRequest{
+					Host: "app.example.com", Proto: "https", URI: "/admin/users",
+					UserID: 1, Username: "ryanpujo", Roles: []string{"admin", "staff"},
+				}
+				fasm.On("Authorize", mock.Anything, request).
+					Return(&models.ForwardAuthIdentity{Username: "ryanpujo", Email: "ryan@example.com", Roles: []string{"admin", "staff"}}, nil).Once()
+			},
+			assert: func(t *testing.T, res *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, res.Code)
+				require.Equal(t, "ryanpujo", res.Header().Get("X-Auth-User"))
+				require.Equal(t, "ryan@example.com", res.Header().Get("X-Auth-Email"))
+				require.Equal(t, "admin,staff", res.Header().Get("X-Auth-Roles"))
+				require.Empty(t, res.Header().Get("X-Auth-Actor"))
+			},
+		},
+		"impersonation": {
+			request: func(t *testing.T) *http.Request {
+				claims := jwttoken.NewClaims(1, "ryanpujo")
+				claims.SessionID = currentSession
+				claims.Actor = &jwttoken.Actor{Subject: "2", Username: "admin"}
+				token, err := jwttoken.GenerateToken(claims)
+				require.NoError(t, err)
+				req := httptest.NewRequest(http.MethodGet, "/forward-auth", nil)
+				req.Header.Set("Authorization", "Bearer "+token)
+				req.Header.Set("X-Forwarded-Host", "app.example.com")
+				req.Header.Set("X-Forwarded-Uri", "/impersonated")
+				return req
+			},
+			arrange: func() {
+				fasm.On("Authorize", mock.Anything, mock.MatchedBy(func(request models.ForwardAuthRequest) bool {
+					return request.URI == "/impersonated" && request.UserID == 1 && request.ActorID == 2
+				})).Return(&models.ForwardAuthIdentity{Username: "ryanpujo", Actor: "admin"}, nil).Once()
+			},
+			assert: func(t *testing.T, res *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, res.Code)
+				require.Equal(t, "ryanpujo", res.Header().Get("X-Auth-User"))
+				require.Equal(t, "admin", res.Header().Get("X-Auth-Actor"))
+			},
+		},
+		"nginx": {
+			request: func(t *testing.T) *http.Request {
+				req := authorized(t, http.MethodGet, "/forward-auth", nil)
+				req.Header.Set("X-Original-URL", "http://wiki.example.com/pages?id=1")
+				return req
+			},
+			arrange: func() {
+				request := models.ForwardAuthRequest{
+					Host: "wiki.example.com", Proto: "http", URI: "/pages?id=1",
+					UserID: 1, Username: "ryanpujo",
+				}
+				fasm.On("Authorize", mock.Anything, request).
+					Return(&models.ForwardAuthIdentity{Username: "ryanpujo"}, nil).Once()
+			},
+			assert: func(t *testing.T, res *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, res.Code)
+			},
+		},
+		"insufficient role": {
+			request: func(t *testing.T) *http.Request {
+				req := authorized(t, http.MethodGet, "/forward-auth", nil)
+				req.Header.Set("X-Forwarded-Host", "app.example.com")
+				req.Header.Set("X-Forwarded-Uri", "/admin")
+				return req
+			},
+			arrange: func() {
+				fasm.On("Authorize", mock.Anything, mock.MatchedBy(func(request models.ForwardAuthRequest) bool {
+					return request.URI == "/admin"
+				})).Return((*models.ForwardAuthIdentity)(nil), services.ErrForwardAuthRole).Once()
+			},
+			assert: func(t *testing.T, res *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, res.Code)
+				require.Empty(t, res.Header().Get("X-Auth-User"))
+			},
+		},
+		"failure": {
+			request: func(t *testing.T) *http.Request {
+				req := authorized(t, http.MethodGet, "/forward-auth", nil)
+				req.Header.Set("X-Forwarded-Host", "app.example.com")
+				req.Header.Set("X-Forwarded-Uri", "/failure")
+				return req
+			},
+			arrange: func() {
+				fasm.On("Authorize", mock.Anything, mock.MatchedBy(func(request models.ForwardAuthRequest) bool {
+					return request.URI == "/failure"
+				})).Return((*models.ForwardAuthIdentity)(nil), errors.New("db down")).Once()
+			},
+			assert: func(t *testing.T, res *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, res.Code)
+			},
+		},
+		"unauthenticated browser": {
+			request: func(t *testing.T) *http.Request {
+				req := httptest.NewRequest(http.MethodGet, "/forward-auth", nil)
+				req.Header.Set("Accept", "text/html,application/xhtml+xml")
+				req.Header.Set("X-Forwarded-Host", "app.example.com")
+				req.Header.Set("X-Forwarded-Uri", "/orders")
+				return req
+			},
+			arrange: func() {
+				fasm.On("LoginURL", models.ForwardAuthRequest{Host: "app.example.com", URI: "/orders"}).
+					Return("https://auth.example.com/login?rd=https%3A%2F%2Fapp.example.com%2Forders").Once()
+			},
+			assert: func(t *testing.T, res *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusFound, res.Code)
+				require.Equal(t, "https://auth.example.com/login?rd=https%3A%2F%2Fapp.example.com%2Forders", res.Header().Get("Location"))
+			},
+		},
+		"unauthenticated browser without login page": {
+			request: func(t *testing.T) *http.Request {
+				req := httptest.NewRequest(http.MethodGet, "/forward-auth", nil)
+				req.Header.Set("Accept", "text/html")
+				req.Header.Set("X-Forwarded-Host", "wiki.example.com")
+				return req
+			},
+			arrange: func() {
+				fasm.On("LoginURL", models.ForwardAuthRequest{Host: "wiki.example.com", URI: "/"}).Return("").Once()
+			},
+			assert: func(t *testing.T, res *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, res.Code)
+			},
+		},
+		"DPoP bound token": {
+			request: func(t *testing.T) *http.Request {
+				claims := jwttoken.NewClaims(1, "ryanpujo")
+				claims.SessionID = currentSession
+				claims.Bind("thumbprint")
+				token, err := jwttoken.GenerateToken(claims)
+				require.NoError(t, err)
+				req := httptest.NewRequest(http.MethodGet, "/forward-auth", nil)
+				req.Header.Set("Authorization", "DPoP "+token)
+				req.Header.Set("DPoP", "proof")
+				req.Header.Set("X-Forwarded-Host", "app.example.com")
+				req.Header.Set("X-Forwarded-Uri", "/orders")
+				return req
+			},
+			arrange: func() {},
+			assert: func(t *testing.T, res *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, res.Code)
+				require.Contains(t, res.Body.String(), "DPoP bound tokens are not accepted")
+				require.Empty(t, res.Header().Get("X-Auth-User"))
+			},
+		},
+		"unauthenticated client": {
+			request: func(t *testing.T) *http.Request {
+				req := httptest.NewRequest(http.MethodGet, "/forward-auth", nil)
+				req.Header.Set("Accept", "application/json")
+				req.Header.Set("X-Forwarded-Host", "app.example.com")
+				return req
+			},
+			arrange: func() {},
+			assert: func(t *testing.T, res *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, res.Code)
+				require.Empty(t, res.Header().Get("Location"))
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			res := httptest.NewRecorder()
+			handler.ServeHTTP(res, v.request(t))
+
+			v.assert(t, res)
+		})
+	}
+	fasm.AssertExpectations(t)
+}
@@ -0,0 +1,141 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ryanpujo/melius/internal/authz"
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/ryanpujo/melius/internal/services"
+	"github.com/ryanpujo/melius/internal/utilities"
+)
+
+// PolicyController handles the administration of authorization policies and answers
+// the decision requests of apps.
+type PolicyController struct {
+	policyService services.PolicyInterface
+}
+
+// NewPolicyController initializes a new PolicyController with the provided policy service.
+func NewPolicyController(policyService services.PolicyInterface) *PolicyController {
+	return &PolicyController{
+		policyService: policyService,
+	}
+}
+
+// Check decides whether the caller may act on the resource of the payload by the named
+// policy. Denials are decisions too, answered with 200. It must run after JWTAuthMiddleware.
+func (pc *PolicyController) Check(c *gin.Context) {
+	var payload models.AuthzCheckPayload
+
+	// Bind and validate JSON payload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, utilities.Response{
+			Message: "Validation error",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c, time.Second*1)
+	defer cancel()
+
+	decision, err := pc.policyService.Evaluate(ctx, payload.Policy, authz.Principal(c), payload.Resource)
+	switch {
+	case errors.Is(err, services.ErrPolicyNotFound):
+		c.JSON(http.StatusNotFound, utilities.Response{
+			Message: "Policy not found",
+			Err:     err.Error(),
+		})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, utilities.Response{
+			Message: "Failed to evaluate policy",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, utilities.Response{
+		Data: decision,
+	})
+}
+
+// List returns every policy.
+func (pc *PolicyController) List(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, time.Second*1)
+	defer cancel()
+
+	policies, err := pc.policyService.List(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utilities.Response{
+			Message: "Failed to list policies",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, utilities.Response{
+		Data: policies,
+	})
+}
+
+// Define creates or replaces the policy named in the path.
+func (pc *PolicyController) Define(c *gin.Context) {
+	var payload models.PolicyPayload
+
+	// Bind and validate JSON payload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, utilities.Response{
+			Message: "Validation error",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c, time.Second*1)
+	defer cancel()
+
+	policy, err := pc.policyService.Define(ctx, c.Param("name"), payload)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utilities.Response{
+			Message: "Failed to define policy",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, utilities.Response{
+		Data:    policy,
+		Message: "Policy defined successfully",
+	})
+}
+
+// Delete removes the policy named in the path.
+func (pc *PolicyController) Delete(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, time.Second*1)
+	defer cancel()
+
+	err := pc.policyService.Delete(ctx, c.Param("name"))
+	switch {
+	case errors.Is(err, services.ErrPolicyNotFound):
+		c.JSON(http.StatusNotFound, utilities.Response{
+			Message: "Policy not found",
+			Err:     err.Error(),
+		})
+		return
+	case err != nil:
+		c.JSON(http.StatusBadRequest, utilities.Response{
+			Message: "Failed to delete policy",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, utilities.Response{
+		Message: "Policy deleted successfully",
+	})
+}
@@ -0,0 +1,226 @@
+package controllers_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ryanpujo/melius/internal/jwttoken"
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/ryanpujo/melius/internal/services"
+	"github.com/ryanpujo/melius/internal/utilities"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type PolicyServiceMock struct {
+	mock.Mock
+}
+
+func (posm *PolicyServiceMock) List(ctx context.Context) ([]models.Policy, error) {
+	args := posm.Called(ctx)
+	return args.Get(0).([]models.Policy), args.Error(1)
+}
+
+func (posm *PolicyServiceMock) Define(ctx context.Context, name string, payload models.PolicyPayload) (*models.Policy, error) {
+	args := posm.Called(ctx, name, payload)
+	return args.Get(0).(*models.Policy), args.Error(1)
+}
+
+func (posm *PolicyServiceMock) Delete(ctx context.Context, name string) error {
+	args := posm.Called(ctx, name)
+	return args.Error(0)
+}
+
+func (posm *PolicyServiceMock) Evaluate(ctx context.Context, name string, principal models.PolicyPrincipal, resource map[string]any) (*models.AuthzDecision, error) {
+	args := posm.Called(ctx, name, principal, resource)
+	return args.Get(0).(*models.AuthzDecision), args.Error(1)
+}
+
+func TestAuthzCheck(t *testing.T) {
+	principal := models.PolicyPrincipal{
+		Type:     jwttoken.PrincipalUser,
+		ID:       1,
+		Username: "ryanpujo",
+		Roles:    []string{"user"},
+		ACR:      jwttoken.ACRSingleFactor,
+	}
+	resource := map[string]any{"amount": float64(500)}
+	validJson, _ := json.Marshal(models.AuthzCheckPayload{Policy: "sales-only", Resource: resource})
+	invalidJson, _ := json.Marshal(models.AuthzCheckPayload{Resource: resource})
+	tableTest := map[string]struct {
+		json    []byte
+		arrange func()
+		assert  func(t *testing.T, statusCode int, json utilities.Response)
+	}{
+		"allowed": {
+			json: validJson,
+			arrange: func() {
+				posm.On("Evaluate", mock.Anything, "sales-only", principal, resource).
+					Return(&models.AuthzDecision{Policy: "sales-only", Allowed: true}, nil).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusOK, statusCode)
+				require.Equal(t, true, json.Data.(map[string]any)["allowed"])
+			},
+		},
+		"denied": {
+			json: validJson,
+			arrange: func() {
+				posm.On("Evaluate", mock.Anything, "sales-only", principal, resource).
+					Return(&models.AuthzDecision{Policy: "sales-only"}, nil).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusOK, statusCode)
+				require.Equal(t, false, json.Data.(map[string]any)["allowed"])
+			},
+		},
+		"policy not found": {
+			json: validJson,
+			arrange: func() {
+				posm.On("Evaluate", mock.Anything, "sales-only", principal, resource).
+					Return((*models.AuthzDecision)(nil), services.ErrPolicyNotFound).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusNotFound, statusCode)
+			},
+		},
+		"failed": {
+			json: validJson,
+			arrange: func() {
+				posm.On("Evaluate", mock.Anything, "sales-only", principal, resource).
+					Return((*models.AuthzDecision)(nil), errors.New("failed")).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusInternalServerError, statusCode)
+			},
+		},
+		"validation failed": {
+			json:    invalidJson,
+			arrange: func() {},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusBadRequest, statusCode)
+				require.Equal(t, "Validation error", json.Message)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			req := authorized(t, http.MethodPost, "/authz/check", v.json, "user")
+			res := httptest.NewRecorder()
+
+			handler.ServeHTTP(res, req)
+
+			var jsonRes utilities.Response
+
+			json.NewDecoder(res.Body).Decode(&jsonRes)
+
+			v.assert(t, res.Code, jsonRes)
+		})
+	}
+}
+
+func TestDefinePolicy(t *testing.T) {
+	payload := models.PolicyPayload{Expression: `"admin" in principal.roles`}
+	validJson, _ := json.Marshal(payload)
+	invalidJson, _ := json.Marshal(models.PolicyPayload{Description: "no expression"})
+	tableTest := map[string]struct {
+		json    []byte
+		arrange func()
+		assert  func(t *testing.T, statusCode int, json utilities.Response)
+	}{
+		"success": {
+			json: validJson,
+			arrange: func() {
+				posm.On("Define", mock.Anything, "admins", payload).
+					Return(&models.Policy{Name: "admins", Expression: payload.Expression}, nil).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusOK, statusCode)
+			},
+		},
+		"invalid expression": {
+			json: validJson,
+			arrange: func() {
+				posm.On("Define", mock.Anything, "admins", payload).
+					Return((*models.Policy)(nil), services.ErrInvalidPolicy).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusBadRequest, statusCode)
+				require.Equal(t, "Failed to define policy", json.Message)
+			},
+		},
+		"validation failed": {
+			json:    invalidJson,
+			arrange: func() {},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusBadRequest, statusCode)
+				require.Equal(t, "Validation error", json.Message)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			req := authorized(t, http.MethodPut, "/admin/policies/admins", v.json, models.RoleAdmin)
+			res := httptest.NewRecorder()
+
+			handler.ServeHTTP(res, req)
+
+			var jsonRes utilities.Response
+
+			json.NewDecoder(res.Body).Decode(&jsonRes)
+
+			v.assert(t, res.Code, jsonRes)
+		})
+	}
+}
+
+func TestDeletePolicy(t *testing.T) {
+	tableTest := map[string]struct {
+		arrange func()
+		assert  func(t *testing.T, statusCode int, json utilities.Response)
+	}{
+		"success": {
+			arrange: func() {
+				posm.On("Delete", mock.Anything, "admins").Return(nil).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusOK, statusCode)
+			},
+		},
+		"not found": {
+			arrange: func() {
+				posm.On("Delete", mock.Anything, "admins").Return(services.ErrPolicyNotFound).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusNotFound, statusCode)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			req := authorized(t, http.MethodDelete, "/admin/policies/admins", nil, models.RoleAdmin)
+			res := httptest.NewRecorder()
+
+			handler.ServeHTTP(res, req)
+
+			var jsonRes utilities.Response
+
+			json.NewDecoder(res.Body).Decode(&jsonRes)
+
+			v.assert(t, res.Code, jsonRes)
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/ryanpujo/melius/internal/services"
+	"github.com/ryanpujo/melius/internal/utilities"
+)
+
+// PrivacyController handles data subject requests: data exports and erasures.
+type PrivacyController struct {
+	privacyService services.PrivacyInterface
+}
+
+// NewPrivacyController initializes a new PrivacyController with the provided privacy service.
+func NewPrivacyController(privacyService services.PrivacyInterface) *PrivacyController {
+	return &PrivacyController{
+		privacyService: privacyService,
+	}
+}
+
+// ExportMe returns the data export of the logged-in user as a JSON attachment.
+func (pc *PrivacyController) ExportMe(c *gin.Context) {
+	pc.export(c, c.GetUint("user_id"))
+}
+
+// EraseMe erases the account of the logged-in user after checking their password.
+func (pc *PrivacyController) EraseMe(c *gin.Context) {
+	var payload models.ErasePayload
+
+	// Bind and validate JSON payload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, utilities.Response{
+			Message: "Validation error",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c, time.Second*5)
+	defer cancel()
+
+	if err := pc.privacyService.EraseAccount(ctx, c.GetUint("user_id"), payload); err != nil {
+		c.JSON(http.StatusBadRequest, utilities.Response{
+			Message: "Failed to erase account",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, utilities.Response{
+		Message: "Account erased successfully",
+	})
+}
+
+// Export returns the data export of the user identified in the path.
+func (pc *PrivacyController) Export(c *gin.Context) {
+	id, ok := paramID(c)
+	if !ok {
+		return
+	}
+	pc.export(c, id)
+}
+
+// Erase erases the account of the user identified in the path.
+func (pc *PrivacyController) Erase(c *gin.Context) {
+	id, ok := paramID(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c, time.Second*5)
+	defer cancel()
+
+	if err := pc.privacyService.Erase(ctx, id); err != nil {
+		c.JSON(http.StatusBadRequest, utilities.Response{
+			Message: "Failed to erase account",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, utilities.Response{
+		Message: "Account erased successfully",
+	})
+}
+
+func (pc *PrivacyController) export(c *gin.Context, id uint) {
+	ctx, cancel := context.WithTimeout(c, time.Second*5)
+	defer cancel()
+
+	export, err := pc.privacyService.Export(ctx, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utilities.Response{
+			Message: "Failed to export data",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="melius-export-%d.json"`, id))
+	c.JSON(http.StatusOK, export)
+}
@@ -0,0 +1,182 @@
+package controllers_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/ryanpujo/melius/internal/utilities"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type PrivacyServiceMock struct {
+	mock.Mock
+}
+
+func (psm *PrivacyServiceMock) Export(ctx context.Context, id uint) (*models.DataExport, error) {
+	args := psm.Called(ctx, id)
+	return args.Get(0).(*models.DataExport), args.Error(1)
+}
+
+func (psm *PrivacyServiceMock) EraseAccount(ctx context.Context, id uint, payload models.ErasePayload) error {
+	args := psm.Called(ctx, id, payload)
+	return args.Error(0)
+}
+
+func (psm *PrivacyServiceMock) Erase(ctx context.Context, id uint) error {
+	args := psm.Called(ctx, id)
+	return args.Error(0)
+}
+
+func TestExport(t *testing.T) {
+	export := &models.DataExport{
+		UserID:   1,
+		Sections: map[string]any{"account": map[string]any{"username": "ryanpujo"}},
+	}
+	tableTest := map[string]struct {
+		target  string
+		roles   []string
+		arrange func()
+		assert  func(t *testing.T, res *httptest.ResponseRecorder)
+	}{
+		"own data": {
+			target: "/auth/me/export",
+			arrange: func() {
+				psm.On("Export", mock.Anything, uint(1)).Return(export, nil).Once()
+			},
+			assert: func(t *testing.T, res *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, res.Code)
+				require.Equal(t, `attachment; filename="melius-export-1.json"`, res.Header().Get("Content-Disposition"))
+
+				var actual models.DataExport
+				require.NoError(t, json.NewDecoder(res.Body).Decode(&actual))
+				require.Equal(t, uint(1), actual.UserID)
+				require.Contains(t, actual.Sections, "account")
+			},
+		},
+		"failed": {
+			target: "/auth/me/export",
+			arrange: func() {
+				psm.On("Export", mock.Anything, uint(1)).Return((*models.DataExport)(nil), errors.New("failed")).Once()
+			},
+			assert: func(t *testing.T, res *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, res.Code)
+			},
+		},
+		"admin": {
+			target: "/admin/users/7/export",
+			roles:  []string{models.RoleAdmin},
+			arrange: func() {
+				psm.On("Export", mock.Anything, uint(7)).Return(&models.DataExport{UserID: 7}, nil).Once()
+			},
+			assert: func(t *testing.T, res *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, res.Code)
+				require.Equal(t, `attachment; filename="melius-export-7.json"`, res.Header().Get("Content-Disposition"))
+			},
+		},
+		"admin forbidden": {
+			target:  "/admin/users/7/export",
+			arrange: func() {},
+			assert: func(t *testing.T, res *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusForbidden, res.Code)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			req := authorized(t, http.MethodGet, v.target, nil, v.roles...)
+			res := httptest.NewRecorder()
+
+			handler.ServeHTTP(res, req)
+
+			v.assert(t, res)
+		})
+	}
+}
+
+func TestErase(t *testing.T) {
+	payload := models.ErasePayload{Password: "okeoke"}
+	validJson, _ := json.Marshal(payload)
+	tableTest := map[string]struct {
+		target  string
+		json    []byte
+		roles   []string
+		arrange func()
+		assert  func(t *testing.T, statusCode int, json utilities.Response)
+	}{
+		"own account": {
+			target: "/auth/me/erase",
+			json:   validJson,
+			arrange: func() {
+				psm.On("EraseAccount", mock.Anything, uint(1), payload).Return(nil).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusOK, statusCode)
+			},
+		},
+		"wrong password": {
+			target: "/auth/me/erase",
+			json:   validJson,
+			arrange: func() {
+				psm.On("EraseAccount", mock.Anything, uint(1), payload).Return(errors.New("failed")).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusBadRequest, statusCode)
+				require.Equal(t, "Failed to erase account", json.Message)
+			},
+		},
+		"validation failed": {
+			target:  "/auth/me/erase",
+			json:    []byte(`{}`),
+			arrange: func() {},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusBadRequest, statusCode)
+				require.Equal(t, "Validation error", json.Message)
+			},
+		},
+		"admin": {
+			target: "/admin/users/7/erase",
+			roles:  []string{models.RoleAdmin},
+			arrange: func() {
+				psm.On("Erase", mock.Anything, uint(7)).Return(nil).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusOK, statusCode)
+			},
+		},
+		"admin invalid id": {
+			target:  "/admin/users/abc/erase",
+			roles:   []string{models.RoleAdmin},
+			arrange: func() {},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusBadRequest, statusCode)
+				require.Equal(t, "Validation error", json.Message)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			req := authorized(t, http.MethodPost, v.target, v.json, v.roles...)
+			res := httptest.NewRecorder()
+
+			handler.ServeHTTP(res, req)
+
+			var jsonRes utilities.Response
+
+			json.NewDecoder(res.Body).Decode(&jsonRes)
+
+			v.assert(t, res.Code, jsonRes)
+		})
+	}
+}
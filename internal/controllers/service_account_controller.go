@@ -0,0 +1,303 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/ryanpujo/melius/internal/services"
+	"github.com/ryanpujo/melius/internal/utilities"
+)
+
+// ServiceAccountController handles the administration of service accounts.
+type ServiceAccountController struct {
+	serviceAccountService services.ServiceAccountInterface
+}
+
+// NewServiceAccountController initializes a new ServiceAccountController with the provided service account service.
+func NewServiceAccountController(serviceAccountService services.ServiceAccountInterface) *ServiceAccountController {
+	return &ServiceAccountController{
+		serviceAccountService: serviceAccountService,
+	}
+}
+
+// Create creates a service account.
+func (sc *ServiceAccountController) Create(c *gin.Context) {
+	var payload models.ServiceAccountPayload
+
+	// Bind and validate JSON payload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, utilities.Response{
+			Message: "Validation error",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c, time.Second*1)
+	defer cancel()
+
+	account, err := sc.serviceAccountService.Create(ctx, payload)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utilities.Response{
+			Message: "Failed to create service account",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, utilities.Response{
+		ID:      account.ID,
+		Message: "Service account created successfully",
+		Data:    account,
+	})
+}
+
+// List returns every service account.
+func (sc *ServiceAccountController) List(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, time.Second*1)
+	defer cancel()
+
+	accounts, err := sc.serviceAccountService.List(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utilities.Response{
+			Message: "Failed to list service accounts",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, utilities.Response{
+		Data: accounts,
+	})
+}
+
+// Get returns the service account identified in the path.
+func (sc *ServiceAccountController) Get(c *gin.Context) {
+	id, ok := serviceAccountID(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c, time.Second*1)
+	defer cancel()
+
+	account, err := sc.serviceAccountService.Get(ctx, id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, utilities.Response{
+			Message: "Service account not found",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, utilities.Response{
+		Data: account,
+	})
+}
+
+// Update changes the service account identified in the path.
+func (sc *ServiceAccountController) Update(c *gin.Context) {
+	id, ok := serviceAccountID(c)
+	if !ok {
+		return
+	}
+
+	var payload models.UpdateServiceAccountPayload
+
+	// Bind and validate JSON payload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, utilities.Response{
+			Message: "Validation error",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c, time.Second*1)
+	defer cancel()
+
+	account, err := sc.serviceAccountService.Update(ctx, id, payload)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utilities.Response{
+			Message: "Failed to update service account",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, utilities.Response{
+		Message: "Service account updated successfully",
+		Data:    account,
+	})
+}
+
+// Delete removes the service account identified in the path.
+func (sc *ServiceAccountController) Delete(c *gin.Context) {
+	id, ok := serviceAccountID(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c, time.Second*1)
+	defer cancel()
+
+	if err := sc.serviceAccountService.Delete(ctx, id); err != nil {
+		c.JSON(http.StatusNotFound, utilities.Response{
+			Message: "Failed to delete service account",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, utilities.Response{
+		Message: "Service account deleted successfully",
+	})
+}
+
+// AssignRole grants the role in the path to the service account identified in the path.
+func (sc *ServiceAccountController) AssignRole(c *gin.Context) {
+	id, ok := serviceAccountID(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c, time.Second*1)
+	defer cancel()
+
+	if err := sc.serviceAccountService.AssignRole(ctx, id, c.Param("role")); err != nil {
+		c.JSON(http.StatusBadRequest, utilities.Response{
+			Message: "Failed to assign role",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, utilities.Response{
+		Message: "Role assigned successfully",
+	})
+}
+
+// RevokeRole revokes the role in the path from the service account identified in the path.
+func (sc *ServiceAccountController) RevokeRole(c *gin.Context) {
+	id, ok := serviceAccountID(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c, time.Second*1)
+	defer cancel()
+
+	if err := sc.serviceAccountService.RevokeRole(ctx, id, c.Param("role")); err != nil {
+		c.JSON(http.StatusBadRequest, utilities.Response{
+			Message: "Failed to revoke role",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, utilities.Response{
+		Message: "Role revoked successfully",
+	})
+}
+
+// CreateCredential adds a secret or public key to the service account identified in the path.
+// A generated secret is only returned in this response.
+func (sc *ServiceAccountController) CreateCredential(c *gin.Context) {
+	id, ok := serviceAccountID(c)
+	if !ok {
+		return
+	}
+
+	var payload models.ServiceAccountCredentialPayload
+
+	// Bind and validate JSON payload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, utilities.Response{
+			Message: "Validation error",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c, time.Second*1)
+	defer cancel()
+
+	credential, err := sc.serviceAccountService.CreateCredential(ctx, id, payload)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utilities.Response{
+			Message: "Failed to create credential",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, utilities.Response{
+		Message: "Credential created successfully",
+		Data:    credential,
+	})
+}
+
+// ListCredentials returns the credentials of the service account identified in the path.
+func (sc *ServiceAccountController) ListCredentials(c *gin.Context) {
+	id, ok := serviceAccountID(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c, time.Second*1)
+	defer cancel()
+
+	credentials, err := sc.serviceAccountService.ListCredentials(ctx, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utilities.Response{
+			Message: "Failed to list credentials",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, utilities.Response{
+		Data: credentials,
+	})
+}
+
+// DeleteCredential revokes a credential of the service account identified in the path.
+func (sc *ServiceAccountController) DeleteCredential(c *gin.Context) {
+	id, ok := serviceAccountID(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c, time.Second*1)
+	defer cancel()
+
+	if err := sc.serviceAccountService.DeleteCredential(ctx, id, c.Param("credential")); err != nil {
+		c.JSON(http.StatusNotFound, utilities.Response{
+			Message: "Failed to delete credential",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, utilities.Response{
+		Message: "Credential deleted successfully",
+	})
+}
+
+// serviceAccountID parses the service account ID path parameter, responding with a bad
+// request when it is malformed.
+func serviceAccountID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utilities.Response{
+			Message: "Validation error",
+			Err:     "invalid service account id",
+		})
+		return 0, false
+	}
+	return uint(id), true
+}
@@ -0,0 +1,415 @@
+package controllers_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/ryanpujo/melius/internal/jwttoken"
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/ryanpujo/melius/internal/utilities"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// disabledServiceAccount is rejected by the service account checker of the test handler.
+const disabledServiceAccount = 99
+
+type ServiceAccountServiceMock struct {
+	mock.Mock
+}
+
+func (sasm *ServiceAccountServiceMock) Create(ctx context.Context, payload models.ServiceAccountPayload) (*models.ServiceAccount, error) {
+	args := sasm.Called(ctx, payload)
+	return args.Get(0).(*models.ServiceAccount), args.Error(1)
+}
+
+func (sasm *ServiceAccountServiceMock) List(ctx context.Context) ([]models.ServiceAccount, error) {
+	args := sasm.Called(ctx)
+	return args.Get(0).([]models.ServiceAccount), args.Error(1)
+}
+
+func (sasm *ServiceAccountServiceMock) Get(ctx context.Context, id uint) (*models.ServiceAccount, error) {
+	args := sasm.Called(ctx, id)
+	return args.Get(0).(*models.ServiceAccount), args.Error(1)
+}
+
+func (sasm *ServiceAccountServiceMock) Update(ctx context.Context, id uint, payload models.UpdateServiceAccountPayload) (*models.ServiceAccount, error) {
+	args := sasm.Called(ctx, id, payload)
+	return args.Get(0).(*models.ServiceAccount), args.Error(1)
+}
+
+func (sasm *ServiceAccountServiceMock) Delete(ctx context.Context, id uint) error {
+	args := sasm.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (sasm *ServiceAccountServiceMock) AssignRole(ctx context.Context, id uint, role string) error {
+	args := sasm.Called(ctx, id, role)
+	return args.Error(0)
+}
+
+func (sasm *ServiceAccountServiceMock) RevokeRole(ctx context.Context, id uint, role string) error {
+	args := sasm.Called(ctx, id, role)
+	return args.Error(0)
+}
+
+func (sasm *ServiceAccountServiceMock) CreateCredential(
+	ctx context.Context, id uint, payload models.ServiceAccountCredentialPayload,
+) (*models.CreatedServiceAccountCredential, error) {
+	args := sasm.Called(ctx, id, payload)
+	return args.Get(0).(*models.CreatedServiceAccountCredential), args.Error(1)
+}
+
+func (sasm *ServiceAccountServiceMock) ListCredentials(ctx context.Context, id uint) ([]models.ServiceAccountCredential, error) {
+	args := sasm.Called(ctx, id)
+	return args.Get(0).([]models.ServiceAccountCredential), args.Error(1)
+}
+
+func (sasm *ServiceAccountServiceMock) DeleteCredential(ctx context.Context, id uint, credentialID string) error {
+	args := sasm.Called(ctx, id, credentialID)
+	return args.Error(0)
+}
+
+func (sasm *ServiceAccountServiceMock) Exchange(ctx context.Context, request models.TokenRequest) (*models.TokenResponse, error) {
+	args := sasm.Called(ctx, request)
+	return args.Get(0).(*models.TokenResponse), args.Error(1)
+}
+
+func (sasm *ServiceAccountServiceMock) Token(ctx context.Context, request models.TokenRequest) (*models.TokenResponse, error) {
+	args := sasm.Called(ctx, request)
+	return args.Get(0).(*models.TokenResponse), args.Error(1)
+}
+
+func (sasm *ServiceAccountServiceMock) Check(ctx context.Context, id uint) error {
+	args := sasm.Called(ctx, id)
+	return args.Error(0)
+}
+
+// serviceAccountRequest returns a request authenticated with a token of the service account id.
+func serviceAccountRequest(t *testing.T, method, target string, id uint, roles ...string) *http.Request {
+	claims := jwttoken.NewServiceAccountClaims(id, "ci")
+	claims.Roles = roles
+	token, err := jwttoken.GenerateToken(claims)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(method, target, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
+
+func TestServiceAccounts(t *testing.T) {
+	payload := models.ServiceAccountPayload{Name: "ci", Roles: []string{"deployer"}}
+	validJson, _ := json.Marshal(payload)
+	credentialJson, _ := json.Marshal(models.ServiceAccountCredentialPayload{Type: models.ServiceCredentialPublicKey, Name: "ci"})
+
+	tableTest := map[string]struct {
+		method  string
+		target  string
+		json    []byte
+		arrange func()
+		assert  func(t *testing.T, statusCode int, json utilities.Response)
+	}{
+		"create": {
+			method: http.MethodPost,
+			target: "/admin/service-accounts",
+			json:   validJson,
+			arrange: func() {
+				sasm.On("Create", mock.Anything, payload).Return(&models.ServiceAccount{ID: 7, Name: "ci"}, nil).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusCreated, statusCode)
+				require.Equal(t, uint(7), json.ID)
+			},
+		},
+		"get not found": {
+			method: http.MethodGet,
+			target: "/admin/service-accounts/8",
+			arrange: func() {
+				sasm.On("Get", mock.Anything, uint(8)).Return((*models.ServiceAccount)(nil), errors.New("failed")).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusNotFound, statusCode)
+			},
+		},
+		"invalid id": {
+			method:  http.MethodGet,
+			target:  "/admin/service-accounts/ci",
+			arrange: func() {},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusBadRequest, statusCode)
+				require.Equal(t, "invalid service account id", json.Err)
+			},
+		},
+		"assign role": {
+			method: http.MethodPut,
+			target: "/admin/service-accounts/7/roles/deployer",
+			arrange: func() {
+				sasm.On("AssignRole", mock.Anything, uint(7), "deployer").Return(nil).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusOK, statusCode)
+			},
+		},
+		"public key required": {
+			method:  http.MethodPost,
+			target:  "/admin/service-accounts/7/credentials",
+			json:    credentialJson,
+			arrange: func() {},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusBadRequest, statusCode)
+				require.Equal(t, "Validation error", json.Message)
+			},
+		},
+		"delete credential": {
+			method: http.MethodDelete,
+			target: "/admin/service-accounts/7/credentials/abc",
+			arrange: func() {
+				sasm.On("DeleteCredential", mock.Anything, uint(7), "abc").Return(nil).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusOK, statusCode)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			req := authorized(t, v.method, v.target, v.json, models.RoleAdmin)
+			res := httptest.NewRecorder()
+
+			handler.ServeHTTP(res, req)
+
+			var jsonRes utilities.Response
+
+			json.NewDecoder(res.Body).Decode(&jsonRes)
+
+			v.assert(t, res.Code, jsonRes)
+		})
+	}
+}
+
+func TestToken(t *testing.T) {
+	tableTest := map[string]struct {
+		form    url.Values
+		basic   bool
+		dpop    string
+		arrange func()
+		assert  func(t *testing.T, res *httptest.ResponseRecorder)
+	}{
+		"client secret": {
+			form:  url.Values{"grant_type": {models.GrantClientCredentials}},
+			basic: true,
+			arrange: func() {
+				sasm.On("Token", mock.Anything, models.TokenRequest{
+					GrantType:    models.GrantClientCredentials,
+					ClientID:     "7",
+					ClientSecret: "secret",
+				}).Return(&models.TokenResponse{AccessToken: "token", TokenType: "Bearer", ExpiresIn: 900}, nil).Once()
+			},
+			assert: func(t *testing.T, res *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, res.Code)
+				require.Equal(t, "no-store", res.Header().Get("Cache-Control"))
+
+				var token models.TokenResponse
+				require.NoError(t, json.NewDecoder(res.Body).Decode(&token))
+				require.Equal(t, "token", token.AccessToken)
+			},
+		},
+		"invalid client": {
+			form: url.Values{"grant_type": {models.GrantClientCredentials}, "client_id": {"7"}, "client_secret": {"wrong"}},
+			arrange: func() {
+				sasm.On("Token", mock.Anything, models.TokenRequest{
+					GrantType:    models.GrantClientCredentials,
+					ClientID:     "7",
+					ClientSecret: "wrong",
+				}).Return((*models.TokenResponse)(nil), &models.OAuthError{Code: models.OAuthInvalidClient}).Once()
+			},
+			assert: func(t *testing.T, res *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnauthorized, res.Code)
+
+				var oauthErr models.OAuthError
+				require.NoError(t, json.NewDecoder(res.Body).Decode(&oauthErr))
+				require.Equal(t, models.OAuthInvalidClient, oauthErr.Code)
+			},
+		},
+		"token exchange": {
+			form: url.Values{
+				"grant_type":         {models.GrantTokenExchange},
+				"subject_token":      {"user-token"},
+				"subject_token_type": {models.TokenTypeAccessToken},
+				"audience":           {"orders"},
+				"scope":              {"orders:read"},
+			},
+			basic: true,
+			arrange: func() {
+				sasm.On("Exchange", mock.Anything, models.TokenRequest{
+					GrantType:        models.GrantTokenExchange,
+					ClientID:         "7",
+					ClientSecret:     "secret",
+					SubjectToken:     "user-token",
+					SubjectTokenType: models.TokenTypeAccessToken,
+					Audience:         "orders",
+					Scope:            "orders:read",
+				}).Return(&models.TokenResponse{
+					AccessToken:     "exchanged",
+					IssuedTokenType: models.TokenTypeAccessToken,
+					TokenType:       "Bearer",
+					ExpiresIn:       300,
+					Scope:           "orders:read",
+				}, nil).Once()
+			},
+			assert: func(t *testing.T, res *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, res.Code)
+
+				var token models.TokenResponse
+				require.NoError(t, json.NewDecoder(res.Body).Decode(&token))
+				require.Equal(t, "exchanged", token.AccessToken)
+				require.Equal(t, models.TokenTypeAccessToken, token.IssuedTokenType)
+			},
+		},
+		"token exchange for unknown audience": {
+			form: url.Values{
+				"grant_type":         {models.GrantTokenExchange},
+				"subject_token":      {"user-token"},
+				"subject_token_type": {models.TokenTypeAccessToken},
+				"audience":           {"payroll"},
+			},
+			basic: true,
+			arrange: func() {
+				sasm.On("Exchange", mock.Anything, mock.Anything).
+					Return((*models.TokenResponse)(nil), &models.OAuthError{Code: models.OAuthInvalidTarget}).Once()
+			},
+			assert: func(t *testing.T, res *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, res.Code)
+
+				var oauthErr models.OAuthError
+				require.NoError(t, json.NewDecoder(res.Body).Decode(&oauthErr))
+				require.Equal(t, models.OAuthInvalidTarget, oauthErr.Code)
+			},
+		},
+		"device code pending": {
+			form: url.Values{"grant_type": {models.GrantDeviceCode}, "device_code": {"device"}, "client_id": {"melius-cli"}},
+			arrange: func() {
+				dasm.On("Token", mock.Anything, models.TokenRequest{
+					GrantType:  models.GrantDeviceCode,
+					ClientID:   "melius-cli",
+					DeviceCode: "device",
+				}).Return((*models.TokenResponse)(nil), &models.OAuthError{Code: models.OAuthAuthorizationPending}).Once()
+			},
+			assert: func(t *testing.T, res *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, res.Code)
+
+				var oauthErr models.OAuthError
+				require.NoError(t, json.NewDecoder(res.Body).Decode(&oauthErr))
+				require.Equal(t, models.OAuthAuthorizationPending, oauthErr.Code)
+			},
+		},
+		"unsupported grant type": {
+			form:    url.Values{"grant_type": {"password"}},
+			arrange: func() {},
+			assert: func(t *testing.T, res *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, res.Code)
+
+				var oauthErr models.OAuthError
+				require.NoError(t, json.NewDecoder(res.Body).Decode(&oauthErr))
+				require.Equal(t, models.OAuthUnsupportedGrantType, oauthErr.Code)
+			},
+		},
+		"missing grant type": {
+			form:    url.Values{},
+			arrange: func() {},
+			assert: func(t *testing.T, res *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, res.Code)
+			},
+		},
+		"invalid DPoP proof": {
+			form:    url.Values{"grant_type": {models.GrantClientCredentials}},
+			basic:   true,
+			dpop:    "not a proof",
+			arrange: func() {},
+			assert: func(t *testing.T, res *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, res.Code)
+
+				var oauthErr models.OAuthError
+				require.NoError(t, json.NewDecoder(res.Body).Decode(&oauthErr))
+				require.Equal(t, models.OAuthInvalidDPoPProof, oauthErr.Code)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			req := httptest.NewRequest(http.MethodPost, "/oauth/token", strings.NewReader(v.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if v.basic {
+				req.SetBasicAuth("7", "secret")
+			}
+			if v.dpop != "" {
+				req.Header.Set("DPoP", v.dpop)
+			}
+			res := httptest.NewRecorder()
+
+			handler.ServeHTTP(res, req)
+
+			v.assert(t, res)
+		})
+	}
+}
+
+func TestServiceAccountPrincipal(t *testing.T) {
+	tableTest := map[string]struct {
+		req    func(t *testing.T) *http.Request
+		status int
+	}{
+		"protected route": {
+			req: func(t *testing.T) *http.Request {
+				return serviceAccountRequest(t, http.MethodGet, "/auth/", 7)
+			},
+			status: http.StatusOK,
+		},
+		"user route": {
+			req: func(t *testing.T) *http.Request {
+				return serviceAccountRequest(t, http.MethodGet, "/auth/me", 7)
+			},
+			status: http.StatusForbidden,
+		},
+		"admin route": {
+			req: func(t *testing.T) *http.Request {
+				return serviceAccountRequest(t, http.MethodGet, "/admin/service-accounts", 7, models.RoleAdmin)
+			},
+			status: http.StatusForbidden,
+		},
+		"disabled": {
+			req: func(t *testing.T) *http.Request {
+				return serviceAccountRequest(t, http.MethodGet, "/auth/", disabledServiceAccount)
+			},
+			status: http.StatusUnauthorized,
+		},
+		"user on protected route": {
+			req: func(t *testing.T) *http.Request {
+				return authorized(t, http.MethodGet, "/auth/", nil)
+			},
+			status: http.StatusOK,
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			res := httptest.NewRecorder()
+
+			handler.ServeHTTP(res, v.req(t))
+
+			require.Equal(t, v.status, res.Code)
+		})
+	}
+}
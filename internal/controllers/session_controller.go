@@ -0,0 +1,79 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ryanpujo/melius/internal/services"
+	"github.com/ryanpujo/melius/internal/utilities"
+)
+
+// SessionController lets users see where their account is logged in and end sessions.
+type SessionController struct {
+	sessionService services.SessionInterface
+}
+
+// NewSessionController initializes a new SessionController with the provided session service.
+func NewSessionController(sessionService services.SessionInterface) *SessionController {
+	return &SessionController{
+		sessionService: sessionService,
+	}
+}
+
+// Sessions lists the active sessions of the logged-in user, flagging the current one.
+func (sc *SessionController) Sessions(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, time.Second*1)
+	defer cancel()
+
+	sessions, err := sc.sessionService.Sessions(ctx, c.GetUint("user_id"), c.GetString("sid"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utilities.Response{
+			Message: "Failed to list sessions",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, utilities.Response{
+		Data: sessions,
+	})
+}
+
+// Logins returns the login history of the logged-in user.
+func (sc *SessionController) Logins(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, time.Second*1)
+	defer cancel()
+
+	sessions, err := sc.sessionService.Logins(ctx, c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utilities.Response{
+			Message: "Failed to list logins",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, utilities.Response{
+		Data: sessions,
+	})
+}
+
+// Revoke ends the session identified in the path. Its tokens stop working immediately.
+func (sc *SessionController) Revoke(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, time.Second*1)
+	defer cancel()
+
+	if err := sc.sessionService.Revoke(ctx, c.GetUint("user_id"), c.Param("id")); err != nil {
+		c.JSON(http.StatusNotFound, utilities.Response{
+			Message: "Failed to revoke session",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, utilities.Response{
+		Message: "Session revoked successfully",
+	})
+}
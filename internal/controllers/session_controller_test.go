@@ -0,0 +1,182 @@
+package controllers_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ryanpujo/melius/internal/jwttoken"
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/ryanpujo/melius/internal/utilities"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// Session IDs accepted and rejected by the session checker of the test handler.
+const (
+	currentSession = "current"
+	revokedSession = "revoked"
+)
+
+type SessionServiceMock struct {
+	mock.Mock
+}
+
+func (ssm *SessionServiceMock) Sessions(ctx context.Context, userID uint, currentID string) ([]models.Session, error) {
+	args := ssm.Called(ctx, userID, currentID)
+	return args.Get(0).([]models.Session), args.Error(1)
+}
+
+func (ssm *SessionServiceMock) Logins(ctx context.Context, userID uint) ([]models.Session, error) {
+	args := ssm.Called(ctx, userID)
+	return args.Get(0).([]models.Session), args.Error(1)
+}
+
+func (ssm *SessionServiceMock) Revoke(ctx context.Context, userID uint, id string) error {
+	args := ssm.Called(ctx, userID, id)
+	return args.Error(0)
+}
+
+func (ssm *SessionServiceMock) Check(ctx context.Context, userID uint, id string) error {
+	args := ssm.Called(ctx, userID, id)
+	return args.Error(0)
+}
+
+func TestSessions(t *testing.T) {
+	tableTest := map[string]struct {
+		target  string
+		arrange func()
+		assert  func(t *testing.T, statusCode int, json utilities.Response)
+	}{
+		"active sessions": {
+			target: "/auth/me/sessions",
+			arrange: func() {
+				ssm.On("Sessions", mock.Anything, uint(1), currentSession).
+					Return([]models.Session{{ID: currentSession, Current: true}}, nil).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusOK, statusCode)
+				require.Len(t, json.Data, 1)
+			},
+		},
+		"active sessions failed": {
+			target: "/auth/me/sessions",
+			arrange: func() {
+				ssm.On("Sessions", mock.Anything, uint(1), currentSession).
+					Return([]models.Session(nil), errors.New("failed")).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusInternalServerError, statusCode)
+			},
+		},
+		"login history": {
+			target: "/auth/me/logins",
+			arrange: func() {
+				ssm.On("Logins", mock.Anything, uint(1)).
+					Return([]models.Session{{ID: currentSession}, {ID: revokedSession}}, nil).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusOK, statusCode)
+				require.Len(t, json.Data, 2)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			req := authorized(t, http.MethodGet, v.target, nil)
+			res := httptest.NewRecorder()
+
+			handler.ServeHTTP(res, req)
+
+			var jsonRes utilities.Response
+
+			json.NewDecoder(res.Body).Decode(&jsonRes)
+
+			v.assert(t, res.Code, jsonRes)
+		})
+	}
+}
+
+func TestRevokeSession(t *testing.T) {
+	tableTest := map[string]struct {
+		arrange func()
+		assert  func(t *testing.T, statusCode int, json utilities.Response)
+	}{
+		"success": {
+			arrange: func() {
+				ssm.On("Revoke", mock.Anything, uint(1), "other").Return(nil).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusOK, statusCode)
+			},
+		},
+		"not found": {
+			arrange: func() {
+				ssm.On("Revoke", mock.Anything, uint(1), "other").Return(errors.New("not found")).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusNotFound, statusCode)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			req := authorized(t, http.MethodDelete, "/auth/me/sessions/other", nil)
+			res := httptest.NewRecorder()
+
+			handler.ServeHTTP(res, req)
+
+			var jsonRes utilities.Response
+
+			json.NewDecoder(res.Body).Decode(&jsonRes)
+
+			v.assert(t, res.Code, jsonRes)
+		})
+	}
+}
+
+func TestSessionClaim(t *testing.T) {
+	tableTest := map[string]struct {
+		sid      string
+		expected int
+	}{
+		"active session": {
+			sid:      currentSession,
+			expected: http.StatusOK,
+		},
+		"revoked session": {
+			sid:      revokedSession,
+			expected: http.StatusUnauthorized,
+		},
+		"no session": {
+			sid:      "",
+			expected: http.StatusUnauthorized,
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			claims := jwttoken.NewClaims(1, "ryanpujo")
+			claims.SessionID = v.sid
+			token, err := jwttoken.GenerateToken(claims)
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodGet, "/auth/", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			res := httptest.NewRecorder()
+
+			handler.ServeHTTP(res, req)
+
+			require.Equal(t, v.expected, res.Code)
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ryanpujo/melius/internal/jwttoken"
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/ryanpujo/melius/internal/services"
+)
+
+// TokenController serves the OAuth token endpoint, where clients that are not users
+// obtain access tokens and exchange the tokens of users for downstream services,
+// and where devices poll for the tokens of the users who approved them. Its responses follow RFC 6749 rather than utilities.Response.
+type TokenController struct {
+	serviceAccountService services.ServiceAccountInterface
+	deviceAuthService     services.DeviceAuthorizationInterface
+	replay                jwttoken.ReplayCache
+}
+
+// NewTokenController initializes a new TokenController with the services of the supported grants.
+func NewTokenController(
+	serviceAccountService services.ServiceAccountInterface,
+	deviceAuthService services.DeviceAuthorizationInterface,
+	replay jwttoken.ReplayCache,
+) *TokenController {
+	return &TokenController{
+		serviceAccountService: serviceAccountService,
+		deviceAuthService:     deviceAuthService,
+		replay:                replay,
+	}
+}
+
+// Token issues an access token for the grant type of the form encoded request.
+// Client secrets may be sent with HTTP Basic authentication. Requests with a DPoP
+// proof get a token bound to the key of the proof.
+func (tc *TokenController) Token(c *gin.Context) {
+	var request models.TokenRequest
+
+	if err := c.ShouldBind(&request); err != nil {
+		c.JSON(http.StatusBadRequest, &models.OAuthError{Code: models.OAuthInvalidRequest, Description: err.Error()})
+		return
+	}
+	if id, secret, ok := c.Request.BasicAuth(); ok {
+		request.ClientID, request.ClientSecret = id, secret
+	}
+	if proof := c.GetHeader("DPoP"); proof != "" {
+		key, err := jwttoken.VerifyDPoPProof(proof, c.Request.Method, jwttoken.RequestURL(c.Request), "", tc.replay)
+		if err != nil {
+			respondOAuthError(c, &models.OAuthError{Code: models.OAuthInvalidDPoPProof, Description: err.Error()})
+			return
+		}
+		request.DPoPKey = key
+	}
+
+	ctx, cancel := context.WithTimeout(c, time.Second*1)
+	defer cancel()
+
+	var (
+		res *models.TokenResponse
+		err error
+	)
+	switch request.GrantType {
+	case models.GrantClientCredentials:
+		res, err = tc.serviceAccountService.Token(ctx, request)
+	case models.GrantTokenExchange:
+		res, err = tc.serviceAccountService.Exchange(ctx, request)
+	case models.GrantDeviceCode:
+		res, err = tc.deviceAuthService.Token(ctx, request)
+	default:
+		err = &models.OAuthError{Code: models.OAuthUnsupportedGrantType}
+	}
+	if err != nil {
+		respondOAuthError(c, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, res)
+}
+
+// respondOAuthError responds with err as an OAuth error. Failed client authentication is
+// answered with 401, other OAuth errors with 400 and unexpected errors with 500.
+func respondOAuthError(c *gin.Context, err error) {
+	var oauthErr *models.OAuthError
+	if !errors.As(err, &oauthErr) {
+		c.JSON(http.StatusInternalServerError, &models.OAuthError{Code: "server_error"})
+		return
+	}
+
+	status := http.StatusBadRequest
+	if oauthErr.Code == models.OAuthInvalidClient {
+		status = http.StatusUnauthorized
+		c.Header("WWW-Authenticate", `Basic realm="token"`)
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(status, oauthErr)
+}
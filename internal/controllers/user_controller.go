@@ -0,0 +1,402 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/ryanpujo/melius/internal/services"
+	"github.com/ryanpujo/melius/internal/utilities"
+)
+
+// UserController handles the self-service endpoints of the logged-in user.
+// Every handler expects JWTAuthMiddleware to have set the user ID in the context.
+type UserController struct {
+	userService services.UserInterface
+}
+
+// NewUserController initializes a new UserController with the provided user service.
+func NewUserController(userService services.UserInterface) *UserController {
+	return &UserController{
+		userService: userService,
+	}
+}
+
+// Me returns the profile of the logged-in user.
+func (uc *UserController) Me(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, time.Second*1)
+	defer cancel()
+
+	user, err := uc.userService.Profile(ctx, c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, utilities.Response{
+			Message: "User not found",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, utilities.Response{
+		Data: user,
+	})
+}
+
+// UpdateMe updates the profile fields of the logged-in user.
+func (uc *UserController) UpdateMe(c *gin.Context) {
+	var payload models.UpdateUserPayload
+
+	// Bind and validate JSON payload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, utilities.Response{
+			Message: "Validation error",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c, time.Second*1)
+	defer cancel()
+
+	user, err := uc.userService.UpdateProfile(ctx, c.GetUint("user_id"), payload)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utilities.Response{
+			Message: "Failed to update profile",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, utilities.Response{
+		Data:    user,
+		Message: "Profile updated successfully",
+	})
+}
+
+// ChangePassword replaces the password of the logged-in user after checking the current one.
+func (uc *UserController) ChangePassword(c *gin.Context) {
+	var payload models.ChangePasswordPayload
+
+	// Bind and validate JSON payload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, utilities.Response{
+			Message: "Validation error",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c, time.Second*1)
+	defer cancel()
+
+	if err := uc.userService.ChangePassword(ctx, c.GetUint("user_id"), payload); err != nil {
+		c.JSON(http.StatusBadRequest, utilities.Response{
+			Message: "Failed to change password",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, utilities.Response{
+		Message: "Password changed successfully",
+	})
+}
+
+// ChangeEmail starts an email change by sending a confirmation token to the new address.
+func (uc *UserController) ChangeEmail(c *gin.Context) {
+	var payload models.ChangeEmailPayload
+
+	// Bind and validate JSON payload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, utilities.Response{
+			Message: "Validation error",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	// Sending mail can be slow, allow more time than a plain query
+	ctx, cancel := context.WithTimeout(c, time.Second*5)
+	defer cancel()
+
+	if err := uc.userService.RequestEmailChange(ctx, c.GetUint("user_id"), payload); err != nil {
+		c.JSON(http.StatusBadRequest, utilities.Response{
+			Message: "Failed to request email change",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, utilities.Response{
+		Message: "Confirmation sent to the new email address",
+	})
+}
+
+// ConfirmEmail applies a pending email change using the token sent to the new address.
+func (uc *UserController) ConfirmEmail(c *gin.Context) {
+	var payload models.ConfirmEmailPayload
+
+	// Bind and validate JSON payload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, utilities.Response{
+			Message: "Validation error",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c, time.Second*1)
+	defer cancel()
+
+	if err := uc.userService.ConfirmEmailChange(ctx, c.GetUint("user_id"), payload); err != nil {
+		c.JSON(http.StatusBadRequest, utilities.Response{
+			Message: "Failed to confirm email change",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, utilities.Response{
+		Message: "Email changed successfully",
+	})
+}
+
+// ChangeUsername renames the logged-in user. Tokens stay valid because they are bound
+// to the user ID rather than the username.
+func (uc *UserController) ChangeUsername(c *gin.Context) {
+	var payload models.ChangeUsernamePayload
+
+	// Bind and validate JSON payload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, utilities.Response{
+			Message: "Validation error",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c, time.Second*1)
+	defer cancel()
+
+	user, err := uc.userService.ChangeUsername(ctx, c.GetUint("user_id"), payload)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utilities.Response{
+			Message: "Failed to change username",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, utilities.Response{
+		Data:    user,
+		Message: "Username changed successfully",
+	})
+}
+
+// History lists the previous usernames and emails of the logged-in user.
+func (uc *UserController) History(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, time.Second*1)
+	defer cancel()
+
+	history, err := uc.userService.History(ctx, c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, utilities.Response{
+			Message: "Failed to retrieve history",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, utilities.Response{
+		Data: history,
+	})
+}
+
+// CloseAccount closes the account of the logged-in user after checking their password.
+func (uc *UserController) CloseAccount(c *gin.Context) {
+	var payload models.CloseAccountPayload
+
+	// Bind and validate JSON payload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, utilities.Response{
+			Message: "Validation error",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c, time.Second*1)
+	defer cancel()
+
+	if err := uc.userService.CloseAccount(ctx, c.GetUint("user_id"), payload); err != nil {
+		c.JSON(http.StatusBadRequest, utilities.Response{
+			Message: "Failed to close account",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, utilities.Response{
+		Message: "Account closed successfully",
+	})
+}
+
+// Restore reopens a closed account during its grace period.
+// It is a public endpoint authenticated by the account credentials.
+func (uc *UserController) Restore(c *gin.Context) {
+	var payload models.LoginPayload
+
+	// Bind and validate JSON payload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, utilities.Response{
+			Message: "Validation error",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c, time.Second*1)
+	defer cancel()
+
+	err := uc.userService.Restore(ctx, &payload)
+	switch {
+	case errors.Is(err, services.ErrLoginBlocked):
+		c.JSON(http.StatusForbidden, utilities.Response{
+			Message: "Restore blocked",
+			Err:     err.Error(),
+		})
+		return
+	case err != nil:
+		c.JSON(http.StatusBadRequest, utilities.Response{
+			Message: "Failed to restore account",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, utilities.Response{
+		Message: "Account restored successfully",
+	})
+}
+
+// User returns the user identified in the path, including admin-only attributes.
+func (uc *UserController) User(c *gin.Context) {
+	id, ok := paramID(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c, time.Second*1)
+	defer cancel()
+
+	user, err := uc.userService.User(ctx, id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, utilities.Response{
+			Message: "User not found",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, utilities.Response{
+		Data: user,
+	})
+}
+
+// SetAttributes changes the attributes of the user identified in the path.
+func (uc *UserController) SetAttributes(c *gin.Context) {
+	id, ok := paramID(c)
+	if !ok {
+		return
+	}
+
+	var payload map[string]any
+
+	// Bind and validate JSON payload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, utilities.Response{
+			Message: "Validation error",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c, time.Second*1)
+	defer cancel()
+
+	user, err := uc.userService.SetAttributes(ctx, id, payload)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utilities.Response{
+			Message: "Failed to update attributes",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, utilities.Response{
+		Data:    user,
+		Message: "Attributes updated successfully",
+	})
+}
+
+// AssignRole grants the role in the path to the user identified in the path.
+func (uc *UserController) AssignRole(c *gin.Context) {
+	id, ok := paramID(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c, time.Second*1)
+	defer cancel()
+
+	if err := uc.userService.AssignRole(ctx, id, c.Param("role")); err != nil {
+		c.JSON(http.StatusBadRequest, utilities.Response{
+			Message: "Failed to assign role",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, utilities.Response{
+		Message: "Role assigned successfully",
+	})
+}
+
+// RevokeRole revokes the role in the path from the user identified in the path.
+func (uc *UserController) RevokeRole(c *gin.Context) {
+	id, ok := paramID(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c, time.Second*1)
+	defer cancel()
+
+	if err := uc.userService.RevokeRole(ctx, id, c.Param("role")); err != nil {
+		c.JSON(http.StatusBadRequest, utilities.Response{
+			Message: "Failed to revoke role",
+			Err:     err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, utilities.Response{
+		Message: "Role revoked successfully",
+	})
+}
+
+// paramID parses the user ID path parameter, responding with a bad request when it is malformed.
+func paramID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, utilities.Response{
+			Message: "Validation error",
+			Err:     "invalid user id",
+		})
+		return 0, false
+	}
+	return uint(id), true
+}
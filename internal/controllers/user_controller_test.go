@@ -0,0 +1,757 @@
+package controllers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ryanpujo/melius/internal/jwttoken"
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/ryanpujo/melius/internal/services"
+	"github.com/ryanpujo/melius/internal/utilities"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type UserServiceMock struct {
+	mock.Mock
+}
+
+func (usm *UserServiceMock) Profile(ctx context.Context, id uint) (*models.User, error) {
+	args := usm.Called(ctx, id)
+	return args.Get(0).(*models.User), args.Error(1)
+}
+
+func (usm *UserServiceMock) UpdateProfile(ctx context.Context, id uint, payload models.UpdateUserPayload) (*models.User, error) {
+	args := usm.Called(ctx, id, payload)
+	return args.Get(0).(*models.User), args.Error(1)
+}
+
+func (usm *UserServiceMock) ChangePassword(ctx context.Context, id uint, payload models.ChangePasswordPayload) error {
+	args := usm.Called(ctx, id, payload)
+	return args.Error(0)
+}
+
+func (usm *UserServiceMock) RequestEmailChange(ctx context.Context, id uint, payload models.ChangeEmailPayload) error {
+	args := usm.Called(ctx, id, payload)
+	return args.Error(0)
+}
+
+func (usm *UserServiceMock) ConfirmEmailChange(ctx context.Context, id uint, payload models.ConfirmEmailPayload) error {
+	args := usm.Called(ctx, id, payload)
+	return args.Error(0)
+}
+
+func (usm *UserServiceMock) ChangeUsername(ctx context.Context, id uint, payload models.ChangeUsernamePayload) (*models.User, error) {
+	args := usm.Called(ctx, id, payload)
+	return args.Get(0).(*models.User), args.Error(1)
+}
+
+func (usm *UserServiceMock) History(ctx context.Context, id uint) ([]models.IdentifierChange, error) {
+	args := usm.Called(ctx, id)
+	return args.Get(0).([]models.IdentifierChange), args.Error(1)
+}
+
+func (usm *UserServiceMock) CloseAccount(ctx context.Context, id uint, payload models.CloseAccountPayload) error {
+	args := usm.Called(ctx, id, payload)
+	return args.Error(0)
+}
+
+func (usm *UserServiceMock) Restore(ctx context.Context, payload *models.LoginPayload) error {
+	args := usm.Called(ctx, payload)
+	return args.Error(0)
+}
+
+func (usm *UserServiceMock) User(ctx context.Context, id uint) (*models.User, error) {
+	args := usm.Called(ctx, id)
+	return args.Get(0).(*models.User), args.Error(1)
+}
+
+func (usm *UserServiceMock) SetAttributes(ctx context.Context, id uint, changes map[string]any) (*models.User, error) {
+	args := usm.Called(ctx, id, changes)
+	return args.Get(0).(*models.User), args.Error(1)
+}
+
+func (usm *UserServiceMock) AssignRole(ctx context.Context, id uint, role string) error {
+	args := usm.Called(ctx, id, role)
+	return args.Error(0)
+}
+
+func (usm *UserServiceMock) RevokeRole(ctx context.Context, id uint, role string) error {
+	args := usm.Called(ctx, id, role)
+	return args.Error(0)
+}
+
+var me = models.User{
+	ID:        1,
+	FirstName: "Ryan",
+	LastName:  "Pujo",
+	Credential: models.Credential{
+		Email:    "ryanpujo@gmail.com",
+		Username: "ryanpujo",
+	},
+}
+
+// authorized builds a request carrying a valid token for user 1.
+func authorized(t *testing.T, method, target string, body []byte, roles ...string) *http.Request {
+	claims := jwttoken.NewClaims(1, "ryanpujo")
+	claims.Roles = roles
+	claims.SessionID = currentSession
+	claims.Authenticated(time.Now(), jwttoken.ACRSingleFactor, jwttoken.AMRPassword)
+	token, err := jwttoken.GenerateToken(claims)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(method, target, bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
+
+func TestMe(t *testing.T) {
+	tableTest := map[string]struct {
+		arrange func()
+		assert  func(t *testing.T, statusCode int, json utilities.Response)
+	}{
+		"success": {
+			arrange: func() {
+				usm.On("Profile", mock.Anything, uint(1)).Return(&me, nil).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusOK, statusCode)
+				require.NotNil(t, json.Data)
+			},
+		},
+		"not found": {
+			arrange: func() {
+				usm.On("Profile", mock.Anything, uint(1)).Return((*models.User)(nil), errors.New("failed")).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusNotFound, statusCode)
+				require.Equal(t, "User not found", json.Message)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			req := authorized(t, http.MethodGet, "/auth/me", nil)
+			res := httptest.NewRecorder()
+
+			handler.ServeHTTP(res, req)
+
+			var jsonRes utilities.Response
+
+			json.NewDecoder(res.Body).Decode(&jsonRes)
+
+			v.assert(t, res.Code, jsonRes)
+		})
+	}
+
+	t.Run("unauthorized", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/auth/me", nil)
+		res := httptest.NewRecorder()
+
+		handler.ServeHTTP(res, req)
+
+		require.Equal(t, http.StatusUnauthorized, res.Code)
+	})
+}
+
+func TestUpdateMe(t *testing.T) {
+	firstName := "Ryan"
+	payload := models.UpdateUserPayload{FirstName: &firstName}
+	validJson, _ := json.Marshal(payload)
+	invalidJson, _ := json.Marshal(map[string]string{"first_name": ""})
+	tableTest := map[string]struct {
+		json    []byte
+		arrange func()
+		assert  func(t *testing.T, statusCode int, json utilities.Response)
+	}{
+		"success": {
+			json: validJson,
+			arrange: func() {
+				usm.On("UpdateProfile", mock.Anything, uint(1), payload).Return(&me, nil).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusOK, statusCode)
+				require.NotNil(t, json.Data)
+			},
+		},
+		"failed": {
+			json: validJson,
+			arrange: func() {
+				usm.On("UpdateProfile", mock.Anything, uint(1), payload).
+					Return((*models.User)(nil), errors.New("failed")).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusBadRequest, statusCode)
+				require.Equal(t, "Failed to update profile", json.Message)
+			},
+		},
+		"validation failed": {
+			json:    invalidJson,
+			arrange: func() {},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusBadRequest, statusCode)
+				require.Equal(t, "Validation error", json.Message)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			req := authorized(t, http.MethodPatch, "/auth/me", v.json)
+			res := httptest.NewRecorder()
+
+			handler.ServeHTTP(res, req)
+
+			var jsonRes utilities.Response
+
+			json.NewDecoder(res.Body).Decode(&jsonRes)
+
+			v.assert(t, res.Code, jsonRes)
+		})
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	payload := models.ChangePasswordPayload{
+		CurrentPassword: "okeoke",
+		NewPassword:     "newpassword",
+	}
+	validJson, _ := json.Marshal(payload)
+	invalidJson, _ := json.Marshal(models.ChangePasswordPayload{NewPassword: "newpassword"})
+	tableTest := map[string]struct {
+		json    []byte
+		arrange func()
+		assert  func(t *testing.T, statusCode int, json utilities.Response)
+	}{
+		"success": {
+			json: validJson,
+			arrange: func() {
+				usm.On("ChangePassword", mock.Anything, uint(1), payload).Return(nil).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusOK, statusCode)
+			},
+		},
+		"failed": {
+			json: validJson,
+			arrange: func() {
+				usm.On("ChangePassword", mock.Anything, uint(1), payload).Return(errors.New("failed")).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusBadRequest, statusCode)
+				require.Equal(t, "Failed to change password", json.Message)
+			},
+		},
+		"validation failed": {
+			json:    invalidJson,
+			arrange: func() {},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusBadRequest, statusCode)
+				require.Equal(t, "Validation error", json.Message)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			req := authorized(t, http.MethodPost, "/auth/me/password", v.json)
+			res := httptest.NewRecorder()
+
+			handler.ServeHTTP(res, req)
+
+			var jsonRes utilities.Response
+
+			json.NewDecoder(res.Body).Decode(&jsonRes)
+
+			v.assert(t, res.Code, jsonRes)
+		})
+	}
+}
+
+func TestChangeEmail(t *testing.T) {
+	payload := models.ChangeEmailPayload{Email: "ryan@pujo.dev"}
+	validJson, _ := json.Marshal(payload)
+	invalidJson, _ := json.Marshal(models.ChangeEmailPayload{Email: "ryanpujo.dev"})
+	tableTest := map[string]struct {
+		json    []byte
+		arrange func()
+		assert  func(t *testing.T, statusCode int, json utilities.Response)
+	}{
+		"success": {
+			json: validJson,
+			arrange: func() {
+				usm.On("RequestEmailChange", mock.Anything, uint(1), payload).Return(nil).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusAccepted, statusCode)
+			},
+		},
+		"failed": {
+			json: validJson,
+			arrange: func() {
+				usm.On("RequestEmailChange", mock.Anything, uint(1), payload).Return(errors.New("failed")).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusBadRequest, statusCode)
+				require.Equal(t, "Failed to request email change", json.Message)
+			},
+		},
+		"validation failed": {
+			json:    invalidJson,
+			arrange: func() {},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusBadRequest, statusCode)
+				require.Equal(t, "Validation error", json.Message)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			req := authorized(t, http.MethodPost, "/auth/me/email", v.json)
+			res := httptest.NewRecorder()
+
+			handler.ServeHTTP(res, req)
+
+			var jsonRes utilities.Response
+
+			json.NewDecoder(res.Body).Decode(&jsonRes)
+
+			v.assert(t, res.Code, jsonRes)
+		})
+	}
+}
+
+func TestConfirmEmail(t *testing.T) {
+	payload := models.ConfirmEmailPayload{Token: "token"}
+	validJson, _ := json.Marshal(payload)
+	tableTest := map[string]struct {
+		arrange func()
+		assert  func(t *testing.T, statusCode int, json utilities.Response)
+	}{
+		"success": {
+			arrange: func() {
+				usm.On("ConfirmEmailChange", mock.Anything, uint(1), payload).Return(nil).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusOK, statusCode)
+			},
+		},
+		"failed": {
+			arrange: func() {
+				usm.On("ConfirmEmailChange", mock.Anything, uint(1), payload).Return(errors.New("failed")).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusBadRequest, statusCode)
+				require.Equal(t, "Failed to confirm email change", json.Message)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			req := authorized(t, http.MethodPost, "/auth/me/email/confirm", validJson)
+			res := httptest.NewRecorder()
+
+			handler.ServeHTTP(res, req)
+
+			var jsonRes utilities.Response
+
+			json.NewDecoder(res.Body).Decode(&jsonRes)
+
+			v.assert(t, res.Code, jsonRes)
+		})
+	}
+}
+
+func TestChangeUsername(t *testing.T) {
+	payload := models.ChangeUsernamePayload{Username: "pujo"}
+	validJson, _ := json.Marshal(payload)
+	invalidJson, _ := json.Marshal(models.ChangeUsernamePayload{})
+	tableTest := map[string]struct {
+		json    []byte
+		arrange func()
+		assert  func(t *testing.T, statusCode int, json utilities.Response)
+	}{
+		"success": {
+			json: validJson,
+			arrange: func() {
+				usm.On("ChangeUsername", mock.Anything, uint(1), payload).Return(&me, nil).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusOK, statusCode)
+				require.NotNil(t, json.Data)
+			},
+		},
+		"failed": {
+			json: validJson,
+			arrange: func() {
+				usm.On("ChangeUsername", mock.Anything, uint(1), payload).
+					Return((*models.User)(nil), errors.New("reserved")).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusBadRequest, statusCode)
+				require.Equal(t, "Failed to change username", json.Message)
+			},
+		},
+		"validation failed": {
+			json:    invalidJson,
+			arrange: func() {},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusBadRequest, statusCode)
+				require.Equal(t, "Validation error", json.Message)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			req := authorized(t, http.MethodPost, "/auth/me/username", v.json)
+			res := httptest.NewRecorder()
+
+			handler.ServeHTTP(res, req)
+
+			var jsonRes utilities.Response
+
+			json.NewDecoder(res.Body).Decode(&jsonRes)
+
+			v.assert(t, res.Code, jsonRes)
+		})
+	}
+}
+
+func TestHistory(t *testing.T) {
+	tableTest := map[string]struct {
+		arrange func()
+		assert  func(t *testing.T, statusCode int, json utilities.Response)
+	}{
+		"success": {
+			arrange: func() {
+				usm.On("History", mock.Anything, uint(1)).Return([]models.IdentifierChange{
+					{Kind: models.IdentifierUsername, OldValue: "ryan", NewValue: "ryanpujo"},
+				}, nil).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusOK, statusCode)
+				require.Len(t, json.Data, 1)
+			},
+		},
+		"failed": {
+			arrange: func() {
+				usm.On("History", mock.Anything, uint(1)).Return([]models.IdentifierChange(nil), errors.New("failed")).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusInternalServerError, statusCode)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			req := authorized(t, http.MethodGet, "/auth/me/history", nil)
+			res := httptest.NewRecorder()
+
+			handler.ServeHTTP(res, req)
+
+			var jsonRes utilities.Response
+
+			json.NewDecoder(res.Body).Decode(&jsonRes)
+
+			v.assert(t, res.Code, jsonRes)
+		})
+	}
+}
+
+func TestCloseAccount(t *testing.T) {
+	payload := models.CloseAccountPayload{Password: "okeoke"}
+	validJson, _ := json.Marshal(payload)
+	invalidJson, _ := json.Marshal(models.CloseAccountPayload{})
+	tableTest := map[string]struct {
+		json    []byte
+		arrange func()
+		assert  func(t *testing.T, statusCode int, json utilities.Response)
+	}{
+		"success": {
+			json: validJson,
+			arrange: func() {
+				usm.On("CloseAccount", mock.Anything, uint(1), payload).Return(nil).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusOK, statusCode)
+			},
+		},
+		"failed": {
+			json: validJson,
+			arrange: func() {
+				usm.On("CloseAccount", mock.Anything, uint(1), payload).Return(errors.New("failed")).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusBadRequest, statusCode)
+				require.Equal(t, "Failed to close account", json.Message)
+			},
+		},
+		"validation failed": {
+			json:    invalidJson,
+			arrange: func() {},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusBadRequest, statusCode)
+				require.Equal(t, "Validation error", json.Message)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			req := authorized(t, http.MethodDelete, "/auth/me", v.json)
+			res := httptest.NewRecorder()
+
+			handler.ServeHTTP(res, req)
+
+			var jsonRes utilities.Response
+
+			json.NewDecoder(res.Body).Decode(&jsonRes)
+
+			v.assert(t, res.Code, jsonRes)
+		})
+	}
+}
+
+func TestRestore(t *testing.T) {
+	validJson, _ := json.Marshal(models.LoginPayload{Identifier: "ryanpujo", Password: "okeoke"})
+	invalidJson, _ := json.Marshal(models.LoginPayload{Password: "okeoke"})
+	tableTest := map[string]struct {
+		json    []byte
+		arrange func()
+		assert  func(t *testing.T, statusCode int, json utilities.Response)
+	}{
+		"success": {
+			json: validJson,
+			arrange: func() {
+				usm.On("Restore", mock.Anything, mock.Anything).Return(nil).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusOK, statusCode)
+			},
+		},
+		"failed": {
+			json: validJson,
+			arrange: func() {
+				usm.On("Restore", mock.Anything, mock.Anything).Return(errors.New("failed")).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusBadRequest, statusCode)
+				require.Equal(t, "Failed to restore account", json.Message)
+			},
+		},
+		"blocked": {
+			json: validJson,
+			arrange: func() {
+				usm.On("Restore", mock.Anything, mock.Anything).Return(services.ErrLoginBlocked).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusForbidden, statusCode)
+				require.Equal(t, "Restore blocked", json.Message)
+			},
+		},
+		"validation failed": {
+			json:    invalidJson,
+			arrange: func() {},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusBadRequest, statusCode)
+				require.Equal(t, "Validation error", json.Message)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			req := httptest.NewRequest(http.MethodPost, "/restore", bytes.NewReader(v.json))
+			res := httptest.NewRecorder()
+
+			handler.ServeHTTP(res, req)
+
+			var jsonRes utilities.Response
+
+			json.NewDecoder(res.Body).Decode(&jsonRes)
+
+			v.assert(t, res.Code, jsonRes)
+		})
+	}
+}
+
+func TestAdminUser(t *testing.T) {
+	tableTest := map[string]struct {
+		target  string
+		roles   []string
+		arrange func()
+		assert  func(t *testing.T, statusCode int, json utilities.Response)
+	}{
+		"success": {
+			target: "/admin/users/2",
+			roles:  []string{models.RoleAdmin},
+			arrange: func() {
+				usm.On("User", mock.Anything, uint(2)).Return(&me, nil).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusOK, statusCode)
+				require.NotNil(t, json.Data)
+			},
+		},
+		"not admin": {
+			target:  "/admin/users/2",
+			arrange: func() {},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusForbidden, statusCode)
+			},
+		},
+		"invalid id": {
+			target:  "/admin/users/abc",
+			roles:   []string{models.RoleAdmin},
+			arrange: func() {},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusBadRequest, statusCode)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			req := authorized(t, http.MethodGet, v.target, nil, v.roles...)
+			res := httptest.NewRecorder()
+
+			handler.ServeHTTP(res, req)
+
+			var jsonRes utilities.Response
+
+			json.NewDecoder(res.Body).Decode(&jsonRes)
+
+			v.assert(t, res.Code, jsonRes)
+		})
+	}
+}
+
+func TestSetAttributes(t *testing.T) {
+	changes := map[string]any{"vip": true}
+	validJson, _ := json.Marshal(changes)
+	tableTest := map[string]struct {
+		arrange func()
+		assert  func(t *testing.T, statusCode int, json utilities.Response)
+	}{
+		"success": {
+			arrange: func() {
+				usm.On("SetAttributes", mock.Anything, uint(2), changes).Return(&me, nil).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusOK, statusCode)
+			},
+		},
+		"failed": {
+			arrange: func() {
+				usm.On("SetAttributes", mock.Anything, uint(2), changes).Return((*models.User)(nil), errors.New("invalid")).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusBadRequest, statusCode)
+				require.Equal(t, "Failed to update attributes", json.Message)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			req := authorized(t, http.MethodPatch, "/admin/users/2/attributes", validJson, models.RoleAdmin)
+			res := httptest.NewRecorder()
+
+			handler.ServeHTTP(res, req)
+
+			var jsonRes utilities.Response
+
+			json.NewDecoder(res.Body).Decode(&jsonRes)
+
+			v.assert(t, res.Code, jsonRes)
+		})
+	}
+}
+
+func TestRoles(t *testing.T) {
+	tableTest := map[string]struct {
+		method  string
+		arrange func()
+		assert  func(t *testing.T, statusCode int, json utilities.Response)
+	}{
+		"assign": {
+			method: http.MethodPut,
+			arrange: func() {
+				usm.On("AssignRole", mock.Anything, uint(2), "support").Return(nil).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusOK, statusCode)
+				require.Equal(t, "Role assigned successfully", json.Message)
+			},
+		},
+		"assign failed": {
+			method: http.MethodPut,
+			arrange: func() {
+				usm.On("AssignRole", mock.Anything, uint(2), "support").Return(errors.New("failed")).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusBadRequest, statusCode)
+			},
+		},
+		"revoke": {
+			method: http.MethodDelete,
+			arrange: func() {
+				usm.On("RevokeRole", mock.Anything, uint(2), "support").Return(nil).Once()
+			},
+			assert: func(t *testing.T, statusCode int, json utilities.Response) {
+				require.Equal(t, http.StatusOK, statusCode)
+				require.Equal(t, "Role revoked successfully", json.Message)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			req := authorized(t, v.method, "/admin/users/2/roles/support", nil, models.RoleAdmin)
+			res := httptest.NewRecorder()
+
+			handler.ServeHTTP(res, req)
+
+			var jsonRes utilities.Response
+
+			json.NewDecoder(res.Body).Decode(&jsonRes)
+
+			v.assert(t, res.Code, jsonRes)
+		})
+	}
+}
@@ -0,0 +1,154 @@
+// Package extauthz implements the external authorization service of Envoy, so the
+// proxies of a mesh can ask melius whether the requests they route may pass. Requests
+// are authenticated like the HTTP routes and checked against the rules of forward auth.
+package extauthz
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	typev3 "github.com/envoyproxy/go-control-plane/envoy/type/v3"
+	"github.com/ryanpujo/melius/internal/jwttoken"
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/ryanpujo/melius/internal/services"
+	rpcstatus "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Server implements the Check API of Envoy's ext_authz filter.
+type Server struct {
+	authv3.UnimplementedAuthorizationServer
+	authenticator      *jwttoken.Authenticator
+	forwardAuthService services.ForwardAuthInterface
+}
+
+// NewServer creates a Server authenticating requests with authenticator and applying
+// the route policies of forwardAuthService.
+func NewServer(authenticator *jwttoken.Authenticator, forwardAuthService services.ForwardAuthInterface) *Server {
+	return &Server{
+		authenticator:      authenticator,
+		forwardAuthService: forwardAuthService,
+	}
+}
+
+// Check allows the request with the X-Auth-User, X-Auth-Email, X-Auth-Roles and
+// X-Auth-Actor headers added for the upstream, replacing any the client sent, or
+// denies it with 401 or 403. Failures are returned as errors, leaving it to the
+// failure_mode_allow of the filter whether the request passes.
+func (s *Server) Check(ctx context.Context, check *authv3.CheckRequest) (*authv3.CheckResponse, error) {
+	attributes := check.GetAttributes().GetRequest().GetHttp()
+	if attributes == nil {
+		return nil, status.Error(codes.InvalidArgument, "missing HTTP request attributes")
+	}
+	r, err := httpRequest(ctx, attributes)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	identity, authErr := s.authenticator.Authenticate(ctx, r)
+	if authErr != nil {
+		return denied(authErr.Status, authErr.Message, authErr.Challenge), nil
+	}
+
+	authorized, err := s.forwardAuthService.Authorize(ctx, models.ForwardAuthRequest{
+		Host:     r.Host,
+		Proto:    attributes.GetScheme(),
+		URI:      r.URL.RequestURI(),
+		UserID:   identity.UserID,
+		Username: identity.Username,
+		Roles:    identity.Roles,
+		ActorID:  identity.ActorID,
+	})
+	switch {
+	case errors.Is(err, services.ErrForwardAuthHost), errors.Is(err, services.ErrForwardAuthRole),
+		errors.Is(err, services.ErrForwardAuthPath):
+		return denied(http.StatusForbidden, err.Error(), ""), nil
+	case err != nil:
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &authv3.CheckResponse{
+		Status: &rpcstatus.Status{Code: int32(codes.OK)},
+		HttpResponse: &authv3.CheckResponse_OkResponse{
+			OkResponse: &authv3.OkHttpResponse{
+				Headers: []*corev3.HeaderValueOption{
+					header(models.HeaderAuthUser, authorized.Username),
+					header(models.HeaderAuthEmail, authorized.Email),
+					header(models.HeaderAuthRoles, strings.Join(authorized.Roles, ",")),
+					header(models.HeaderAuthActor, authorized.Actor),
+				},
+			},
+		},
+	}, nil
+}
+
+// httpRequest rebuilds the request Envoy checks, for the authenticator. Requests
+// Envoy received over TLS are marked as such, as the scheme of the URL DPoP proofs
+// sign. Clients may set X-Forwarded-Proto themselves, so it is not relied on.
+func httpRequest(ctx context.Context, attributes *authv3.AttributeContext_HttpRequest) (*http.Request, error) {
+	target, err := url.ParseRequestURI(attributes.GetPath())
+	if err != nil {
+		return nil, err
+	}
+	r, err := http.NewRequestWithContext(ctx, attributes.GetMethod(), target.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	r.Host = attributes.GetHost()
+	for name, value := range attributes.GetHeaders() {
+		if !strings.HasPrefix(name, ":") {
+			r.Header.Set(name, value)
+		}
+	}
+	// Envoy sends the headers here instead when encode_raw_headers is enabled.
+	for _, h := range attributes.GetHeaderMap().GetHeaders() {
+		if !strings.HasPrefix(h.GetKey(), ":") {
+			r.Header.Add(h.GetKey(), string(h.GetRawValue()))
+		}
+	}
+	if attributes.GetScheme() == "https" {
+		r.TLS = &tls.ConnectionState{}
+	}
+	return r, nil
+}
+
+// denied returns the response denying a request with code, answered to the client
+// with the JSON error body of the HTTP routes.
+func denied(code int, message, challenge string) *authv3.CheckResponse {
+	rpcCode := codes.PermissionDenied
+	if code == http.StatusUnauthorized {
+		rpcCode = codes.Unauthenticated
+	}
+	body, _ := json.Marshal(map[string]string{"error": message})
+
+	headers := []*corev3.HeaderValueOption{header("Content-Type", "application/json")}
+	if challenge != "" {
+		headers = append(headers, header("WWW-Authenticate", challenge))
+	}
+	return &authv3.CheckResponse{
+		Status: &rpcstatus.Status{Code: int32(rpcCode), Message: message},
+		HttpResponse: &authv3.CheckResponse_DeniedResponse{
+			DeniedResponse: &authv3.DeniedHttpResponse{
+				Status:  &typev3.HttpStatus{Code: typev3.StatusCode(code)},
+				Headers: headers,
+				Body:    string(body),
+			},
+		},
+	}
+}
+
+// header returns the option setting the header name, overwriting any value the client sent.
+func header(name, value string) *corev3.HeaderValueOption {
+	return &corev3.HeaderValueOption{
+		Header:       &corev3.HeaderValue{Key: name, Value: value},
+		AppendAction: corev3.HeaderValueOption_OVERWRITE_IF_EXISTS_OR_ADD,
+	}
+}
@@ -0,0 +1,218 @@
+package extauthz_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	"github.com/ryanpujo/melius/internal/extauthz"
+	"github.com/ryanpujo/melius/internal/jwttoken"
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/ryanpujo/melius/internal/services"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type ForwardAuthServiceMock struct {
+	mock.Mock
+}
+
+func (fasm *ForwardAuthServiceMock) Authorize(ctx context.Context, request models.ForwardAuthRequest) (*models.ForwardAuthIdentity, error) {
+	args := fasm.Called(ctx, request)
+	return args.Get(0).(*models.ForwardAuthIdentity), args.Error(1)
+}
+
+func (fasm *ForwardAuthServiceMock) LoginURL(request models.ForwardAuthRequest) string {
+	args := fasm.Called(request)
+	return args.String(0)
+}
+
+const revokedSession = "revoked"
+
+func token(t *testing.T, sid string, roles ...string) string {
+	claims := jwttoken.NewClaims(1, "ryanpujo")
+	claims.Roles = roles
+	claims.SessionID = sid
+	claims.Authenticated(time.Now(), jwttoken.ACRSingleFactor, jwttoken.AMRPassword)
+	token, err := jwttoken.GenerateToken(claims)
+	require.NoError(t, err)
+	return token
+}
+
+func checkRequest(headers map[string]string, path string) *authv3.CheckRequest {
+	return &authv3.CheckRequest{
+		Attributes: &authv3.AttributeContext{
+			Request: &authv3.AttributeContext_Request{
+				Http: &authv3.AttributeContext_HttpRequest{
+					Method:  http.MethodGet,
+					Scheme:  "https",
+					Host:    "orders.mesh.local",
+					Path:    path,
+					Headers: headers,
+				},
+			},
+		},
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tableTest := map[string]struct {
+		request func(t *testing.T) *authv3.CheckRequest
+		arrange func(fasm *ForwardAuthServiceMock)
+		assert  func(t *testing.T, res *authv3.CheckResponse, err error)
+	}{
+		"allowed": {
+			request: func(t *testing.T) *authv3.CheckRequest {
+				return checkRequest(map[string]string{
+					":authority":    "orders.mesh.local",
+					"authorization": "Bearer " + token(t, "current", "admin"),
+					"x-auth-user":   "spoofed",
+					"x-auth-actor":  "spoofed",
+				}, "/orders?page=2")
+			},
+			arrange: func(fasm *ForwardAuthServiceMock) {
+				request := models.ForwardAuthRequest{
+					Host: "orders.mesh.local", Proto: "https", URI: "/orders?page=2",
+					UserID: 1, Username: "ryanpujo", Roles: []string{"admin"},
+				}
+				fasm.On("Authorize", mock.Anything, request).
+					Return(&models.ForwardAuthIdentity{Username: "ryanpujo", Email: "ryan@example.com", Roles: []string{"admin"}}, nil).Once()
+			},
+			assert: func(t *testing.T, res *authv3.CheckResponse, err error) {
+				require.NoError(t, err)
+				require.Equal(t, int32(codes.OK), res.GetStatus().GetCode())
+
+				headers := map[string]string{}
+				for _, h := range res.GetOkResponse().GetHeaders() {
+					headers[h.GetHeader().GetKey()] = h.GetHeader().GetValue()
+				}
+				require.Equal(t, map[string]string{
+					models.HeaderAuthUser:  "ryanpujo",
+					models.HeaderAuthEmail: "ryan@example.com",
+					models.HeaderAuthRoles: "admin",
+					models.HeaderAuthActor: "",
+				}, headers)
+			},
+		},
+		"impersonation": {
+			request: func(t *testing.T) *authv3.CheckRequest {
+				claims := jwttoken.NewClaims(1, "ryanpujo")
+				claims.SessionID = "current"
+				claims.Actor = &jwttoken.Actor{Subject: "2", Username: "admin"}
+				token, err := jwttoken.GenerateToken(claims)
+				require.NoError(t, err)
+				return checkRequest(map[string]string{"authorization": "Bearer " + token}, "/orders")
+			},
+			arrange: func(fasm *ForwardAuthServiceMock) {
+				fasm.On("Authorize", mock.Anything, mock.MatchedBy(func(request models.ForwardAuthRequest) bool {
+					return request.UserID == 1 && request.ActorID == 2
+				})).Return(&models.ForwardAuthIdentity{Username: "ryanpujo", Actor: "admin"}, nil).Once()
+			},
+			assert: func(t *testing.T, res *authv3.CheckResponse, err error) {
+				require.NoError(t, err)
+				require.Equal(t, int32(codes.OK), res.GetStatus().GetCode())
+				headers := map[string]string{}
+				for _, h := range res.GetOkResponse().GetHeaders() {
+					headers[h.GetHeader().GetKey()] = h.GetHeader().GetValue()
+				}
+				require.Equal(t, "admin", headers[models.HeaderAuthActor])
+			},
+		},
+		"missing token": {
+			request: func(t *testing.T) *authv3.CheckRequest {
+				return checkRequest(map[string]string{}, "/orders")
+			},
+			arrange: func(fasm *ForwardAuthServiceMock) {},
+			assert: func(t *testing.T, res *authv3.CheckResponse, err error) {
+				require.NoError(t, err)
+				require.Equal(t, int32(codes.Unauthenticated), res.GetStatus().GetCode())
+				require.Equal(t, int32(http.StatusUnauthorized), int32(res.GetDeniedResponse().GetStatus().GetCode()))
+				require.JSONEq(t, `{"error":"Token is required"}`, res.GetDeniedResponse().GetBody())
+			},
+		},
+		"revoked session": {
+			request: func(t *testing.T) *authv3.CheckRequest {
+				return checkRequest(map[string]string{"authorization": "Bearer " + token(t, revokedSession)}, "/orders")
+			},
+			arrange: func(fasm *ForwardAuthServiceMock) {},
+			assert: func(t *testing.T, res *authv3.CheckResponse, err error) {
+				require.NoError(t, err)
+				require.Equal(t, int32(codes.Unauthenticated), res.GetStatus().GetCode())
+			},
+		},
+		"insufficient role": {
+			request: func(t *testing.T) *authv3.CheckRequest {
+				return checkRequest(map[string]string{"authorization": "Bearer " + token(t, "current")}, "/admin")
+			},
+			arrange: func(fasm *ForwardAuthServiceMock) {
+				fasm.On("Authorize", mock.Anything, mock.Anything).
+					Return((*models.ForwardAuthIdentity)(nil), services.ErrForwardAuthRole).Once()
+			},
+			assert: func(t *testing.T, res *authv3.CheckResponse, err error) {
+				require.NoError(t, err)
+				require.Equal(t, int32(codes.PermissionDenied), res.GetStatus().GetCode())
+				require.Equal(t, int32(http.StatusForbidden), int32(res.GetDeniedResponse().GetStatus().GetCode()))
+			},
+		},
+		"ambiguous path": {
+			request: func(t *testing.T) *authv3.CheckRequest {
+				return checkRequest(map[string]string{"authorization": "Bearer " + token(t, "current")}, "/admin%2Fx")
+			},
+			arrange: func(fasm *ForwardAuthServiceMock) {
+				fasm.On("Authorize", mock.Anything, mock.MatchedBy(func(request models.ForwardAuthRequest) bool {
+					return request.URI == "/admin%2Fx"
+				})).Return((*models.ForwardAuthIdentity)(nil), services.ErrForwardAuthPath).Once()
+			},
+			assert: func(t *testing.T, res *authv3.CheckResponse, err error) {
+				require.NoError(t, err)
+				require.Equal(t, int32(http.StatusForbidden), int32(res.GetDeniedResponse().GetStatus().GetCode()))
+			},
+		},
+		"failure": {
+			request: func(t *testing.T) *authv3.CheckRequest {
+				return checkRequest(map[string]string{"authorization": "Bearer " + token(t, "current")}, "/orders")
+			},
+			arrange: func(fasm *ForwardAuthServiceMock) {
+				fasm.On("Authorize", mock.Anything, mock.Anything).
+					Return((*models.ForwardAuthIdentity)(nil), errors.New("db down")).Once()
+			},
+			assert: func(t *testing.T, res *authv3.CheckResponse, err error) {
+				require.Equal(t, codes.Internal, status.Code(err))
+			},
+		},
+		"missing attributes": {
+			request: func(t *testing.T) *authv3.CheckRequest {
+				return &authv3.CheckRequest{}
+			},
+			arrange: func(fasm *ForwardAuthServiceMock) {},
+			assert: func(t *testing.T, res *authv3.CheckResponse, err error) {
+				require.Equal(t, codes.InvalidArgument, status.Code(err))
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			fasm := new(ForwardAuthServiceMock)
+			server := extauthz.NewServer(jwttoken.NewAuthenticator(
+				jwttoken.WithSessionChecker(func(ctx context.Context, userID uint, sid string) error {
+					if sid == revokedSession {
+						return errors.New("session revoked")
+					}
+					return nil
+				}),
+			), fasm)
+			v.arrange(fasm)
+
+			res, err := server.Check(context.Background(), v.request(t))
+
+			v.assert(t, res, err)
+			fasm.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package grpcapi
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/ryanpujo/melius/internal/jwttoken"
+	"github.com/ryanpujo/melius/internal/requestinfo"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// identityKey is the context key of the Identity of the caller.
+type identityKey struct{}
+
+// IdentityFromContext returns the identity the call was authenticated as, nil for
+// the methods callable without a token.
+func IdentityFromContext(ctx context.Context) *jwttoken.Identity {
+	identity, _ := ctx.Value(identityKey{}).(*jwttoken.Identity)
+	return identity
+}
+
+// Policy tells the auth interceptors how to authenticate the calls of each method.
+type Policy struct {
+	// Public lists the full names of the methods callable without a token.
+	Public []string
+	// ReadOnly lists the methods authenticated like GET requests, which API keys with
+	// the read scope may call. Others need the write scope.
+	ReadOnly []string
+}
+
+// UnaryAuthInterceptor authenticates unary calls like JWTAuthMiddleware authenticates
+// requests, by the token in their authorization metadata, and stores the identity
+// of the caller in their context.
+func UnaryAuthInterceptor(authenticator *jwttoken.Authenticator, policy Policy) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := policy.authenticate(ctx, authenticator, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamAuthInterceptor authenticates streams like UnaryAuthInterceptor.
+func StreamAuthInterceptor(authenticator *jwttoken.Authenticator, policy Policy) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := policy.authenticate(ss.Context(), authenticator, info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// authenticate returns ctx with the identity of the caller of method.
+func (p Policy) authenticate(ctx context.Context, authenticator *jwttoken.Authenticator, method string) (context.Context, error) {
+	if slices.Contains(p.Public, method) {
+		return ctx, nil
+	}
+
+	httpMethod := http.MethodPost
+	if slices.Contains(p.ReadOnly, method) {
+		httpMethod = http.MethodGet
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	identity, err := authenticator.Authenticate(ctx, httpRequest(httpMethod, method, md))
+	if err != nil {
+		code := codes.Unauthenticated
+		if err.Status == http.StatusForbidden {
+			code = codes.PermissionDenied
+		}
+		return nil, status.Error(code, err.Message)
+	}
+	return context.WithValue(ctx, identityKey{}, identity), nil
+}
+
+// httpRequest represents a call for the authenticator, with its metadata as headers.
+func httpRequest(method, path string, md metadata.MD) *http.Request {
+	r := &http.Request{
+		Method: method,
+		URL:    &url.URL{Path: path},
+		Header: http.Header{},
+	}
+	for name, values := range md {
+		if strings.HasPrefix(name, ":") {
+			continue
+		}
+		for _, value := range values {
+			r.Header.Add(name, value)
+		}
+	}
+	if authority := md.Get(":authority"); len(authority) > 0 {
+		r.Host = authority[0]
+	}
+	return r
+}
+
+// UnaryRequestInfoInterceptor records the requestinfo.Info of calls, like
+// requestinfo.Middleware does for HTTP requests, and echoes their request id.
+func UnaryRequestInfoInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		requestID := requestinfo.RequestID(first(md, requestinfo.HeaderRequestID))
+		_ = grpc.SetHeader(ctx, metadata.Pairs(requestinfo.HeaderRequestID, requestID))
+
+		return handler(requestinfo.NewContext(ctx, requestinfo.Info{
+			IP:        peerIP(ctx),
+			UserAgent: first(md, "user-agent"),
+			RequestID: requestID,
+			DeviceID:  first(md, requestinfo.HeaderDeviceID),
+		}), req)
+	}
+}
+
+// first returns the first value of the metadata key, or an empty string.
+func first(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// peerIP returns the IP address of the client of the call.
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+// serverStream carries the context of an authenticated stream.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,249 @@
+// Package grpcapi serves the credential endpoints of the HTTP API over gRPC, for the
+// services of the platform that speak gRPC. Calls are authenticated by interceptors
+// following the rules of jwttoken.JWTAuthMiddleware.
+package grpcapi
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/ryanpujo/melius/internal/jwttoken"
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/ryanpujo/melius/internal/services"
+	meliusv1 "github.com/ryanpujo/melius/proto/melius/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// CredentialPolicy is the authentication policy of the CredentialService methods.
+var CredentialPolicy = Policy{
+	Public: []string{
+		meliusv1.CredentialService_Register_FullMethodName,
+		meliusv1.CredentialService_Login_FullMethodName,
+		meliusv1.CredentialService_VerifyLogin_FullMethodName,
+		meliusv1.CredentialService_ValidateToken_FullMethodName,
+	},
+	ReadOnly: []string{
+		meliusv1.CredentialService_GetUser_FullMethodName,
+	},
+}
+
+// NewServer returns a gRPC server of the CredentialService, authenticating calls with
+// authenticator. Administrators looking up other users must have authenticated
+// within reauthMaxAge, as on the HTTP administration routes.
+func NewServer(
+	credService services.CredentialInterface,
+	authenticator *jwttoken.Authenticator,
+	reauthMaxAge time.Duration,
+	opts ...grpc.ServerOption,
+) *grpc.Server {
+	opts = append(opts,
+		grpc.ChainUnaryInterceptor(UnaryRequestInfoInterceptor(), UnaryAuthInterceptor(authenticator, CredentialPolicy)),
+		grpc.ChainStreamInterceptor(StreamAuthInterceptor(authenticator, CredentialPolicy)),
+	)
+	server := grpc.NewServer(opts...)
+	meliusv1.RegisterCredentialServiceServer(server, NewCredentialServer(credService, authenticator, reauthMaxAge))
+	return server
+}
+
+// CredentialServer implements the CredentialService on the credential service.
+type CredentialServer struct {
+	meliusv1.UnimplementedCredentialServiceServer
+	credService   services.CredentialInterface
+	authenticator *jwttoken.Authenticator
+	reauthMaxAge  time.Duration
+}
+
+// NewCredentialServer initializes a new CredentialServer with the provided credential service.
+func NewCredentialServer(credService services.CredentialInterface, authenticator *jwttoken.Authenticator, reauthMaxAge time.Duration) *CredentialServer {
+	return &CredentialServer{
+		credService:   credService,
+		authenticator: authenticator,
+		reauthMaxAge:  reauthMaxAge,
+	}
+}
+
+// Register creates a user from the payload validated like the one of POST /regis.
+func (cs *CredentialServer) Register(ctx context.Context, req *meliusv1.RegisterRequest) (*meliusv1.RegisterResponse, error) {
+	payload := models.UserPayload{
+		FirstName: req.GetFirstName(),
+		LastName:  req.GetLastName(),
+		CredentialPayload: models.CredentialPayload{
+			Email:    req.GetEmail(),
+			Username: req.GetUsername(),
+			Password: req.GetPassword(),
+		},
+	}
+	if req.GetAttributes() != nil {
+		payload.Attributes = req.GetAttributes().AsMap()
+	}
+	if err := binding.Validator.ValidateStruct(&payload); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "validation error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*1)
+	defer cancel()
+
+	id, err := cs.credService.Write(ctx, payload)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "failed to create user: %v", err)
+	}
+	return &meliusv1.RegisterResponse{Id: uint64(id)}, nil
+}
+
+// Login authenticates the user like POST /login. Logins held for step-up verification
+// return the challenge instead of a token.
+func (cs *CredentialServer) Login(ctx context.Context, req *meliusv1.LoginRequest) (*meliusv1.LoginResponse, error) {
+	payload := models.LoginPayload{Identifier: req.GetIdentifier(), Password: req.GetPassword()}
+	if err := binding.Validator.ValidateStruct(&payload); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "validation error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*1)
+	defer cancel()
+
+	token, err := cs.credService.Login(ctx, &payload)
+	var stepUp *services.StepUpRequiredError
+	switch {
+	case errors.As(err, &stepUp):
+		return &meliusv1.LoginResponse{
+			StepUp: &meliusv1.StepUp{
+				ChallengeId: stepUp.ChallengeID,
+				ExpiresAt:   timestamppb.New(stepUp.ExpiresAt),
+			},
+		}, nil
+	case errors.Is(err, services.ErrLoginBlocked):
+		return nil, status.Errorf(codes.PermissionDenied, "login blocked: %v", err)
+	case errors.Is(err, services.ErrDeviceRequired):
+		return nil, status.Errorf(codes.FailedPrecondition, "login failed: %v", err)
+	case err != nil:
+		return nil, status.Errorf(codes.Unauthenticated, "login failed: %v", err)
+	}
+	return &meliusv1.LoginResponse{AccessToken: token}, nil
+}
+
+// VerifyLogin completes a login held for step-up verification like POST /login/verify.
+// The code must be sent with the device id the login was made with.
+func (cs *CredentialServer) VerifyLogin(ctx context.Context, req *meliusv1.VerifyLoginRequest) (*meliusv1.VerifyLoginResponse, error) {
+	payload := models.VerifyLoginPayload{ChallengeID: req.GetChallengeId(), Code: req.GetCode()}
+	if err := binding.Validator.ValidateStruct(&payload); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "validation error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*1)
+	defer cancel()
+
+	token, err := cs.credService.VerifyLogin(ctx, payload)
+	if err != nil {
+		return nil, status.Errorf(codes.Unauthenticated, "verification failed: %v", err)
+	}
+	return &meliusv1.VerifyLoginResponse{AccessToken: token}, nil
+}
+
+// RefreshToken returns a new token for the session of the caller.
+func (cs *CredentialServer) RefreshToken(ctx context.Context, req *meliusv1.RefreshTokenRequest) (*meliusv1.RefreshTokenResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Second*1)
+	defer cancel()
+
+	token, err := cs.credService.Refresh(ctx, *IdentityFromContext(ctx))
+	switch {
+	case errors.Is(err, services.ErrRefreshForbidden):
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	case err != nil:
+		return nil, status.Errorf(codes.Unauthenticated, "refresh failed: %v", err)
+	}
+	return &meliusv1.RefreshTokenResponse{AccessToken: token}, nil
+}
+
+// GetUser returns the caller, or another user to administrators who authenticated recently.
+func (cs *CredentialServer) GetUser(ctx context.Context, req *meliusv1.GetUserRequest) (*meliusv1.GetUserResponse, error) {
+	identity := IdentityFromContext(ctx)
+	if identity.PrincipalType != jwttoken.PrincipalUser {
+		return nil, status.Error(codes.PermissionDenied, "principal type not allowed")
+	}
+
+	self := req.GetUsername() == "" || req.GetUsername() == identity.Username
+	if !self {
+		if !slices.Contains(identity.Roles, models.RoleAdmin) {
+			return nil, status.Error(codes.PermissionDenied, "insufficient role")
+		}
+		if identity.AuthTime.IsZero() || time.Since(identity.AuthTime) > cs.reauthMaxAge {
+			return nil, status.Error(codes.Unauthenticated, "recent authentication required")
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*1)
+	defer cancel()
+
+	username := req.GetUsername()
+	if self {
+		username = identity.Username
+	}
+	user, err := cs.credService.FindByUsername(ctx, username)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, status.Error(codes.NotFound, "user not found")
+	case err != nil:
+		return nil, status.Errorf(codes.Internal, "failed to get user: %v", err)
+	}
+	// The username of tokens is informational, it may have been given up since.
+	if self && user.ID != identity.UserID {
+		return nil, status.Error(codes.FailedPrecondition, "username of the token changed, refresh the token")
+	}
+
+	attributes, err := structpb.NewStruct(user.Attributes)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to get user: %v", err)
+	}
+	return &meliusv1.GetUserResponse{
+		User: &meliusv1.User{
+			Id:         uint64(user.ID),
+			FirstName:  user.FirstName,
+			LastName:   user.LastName,
+			Email:      user.Credential.Email,
+			Username:   user.Credential.Username,
+			Roles:      user.Roles,
+			Attributes: attributes,
+		},
+	}, nil
+}
+
+// ValidateToken authenticates the token like a bearer token sent to a read-only route.
+func (cs *CredentialServer) ValidateToken(ctx context.Context, req *meliusv1.ValidateTokenRequest) (*meliusv1.ValidateTokenResponse, error) {
+	if req.GetToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, "token is required")
+	}
+
+	r := httpRequest(http.MethodGet, meliusv1.CredentialService_ValidateToken_FullMethodName, nil)
+	r.Header.Set("Authorization", "Bearer "+req.GetToken())
+	identity, authErr := cs.authenticator.Authenticate(ctx, r)
+	if authErr != nil {
+		return &meliusv1.ValidateTokenResponse{Reason: authErr.Message}, nil
+	}
+
+	principal := &meliusv1.Principal{
+		Type:             identity.PrincipalType,
+		UserId:           uint64(identity.UserID),
+		ServiceAccountId: uint64(identity.ServiceAccountID),
+		Username:         identity.Username,
+		Roles:            identity.Roles,
+		SessionId:        identity.SessionID,
+		Acr:              identity.ACR,
+		Amr:              identity.AMR,
+		ActorId:          uint64(identity.ActorID),
+		ClientId:         identity.ClientID,
+		Scopes:           identity.Scopes,
+	}
+	if !identity.AuthTime.IsZero() {
+		principal.AuthTime = timestamppb.New(identity.AuthTime)
+	}
+	return &meliusv1.ValidateTokenResponse{Valid: true, Principal: principal}, nil
+}
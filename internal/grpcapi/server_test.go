@@ -0,0 +1,389 @@
+package grpcapi_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ryanpujo/melius/internal/grpcapi"
+	"github.com/ryanpujo/melius/internal/jwttoken"
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/ryanpujo/melius/internal/requestinfo"
+	"github.com/ryanpujo/melius/internal/services"
+	meliusv1 "github.com/ryanpujo/melius/proto/melius/v1"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// CredServiceMock stubs the credential service. Methods the tests do not expect
+// fall through to the nil interface and panic.
+type CredServiceMock struct {
+	mock.Mock
+	services.CredentialInterface
+}
+
+func (csm *CredServiceMock) Write(ctx context.Context, payload models.UserPayload) (uint, error) {
+	args := csm.Called(ctx, payload)
+	return args.Get(0).(uint), args.Error(1)
+}
+
+func (csm *CredServiceMock) Login(ctx context.Context, payload *models.LoginPayload) (string, error) {
+	args := csm.Called(ctx, payload.Login())
+	return args.String(0), args.Error(1)
+}
+
+func (csm *CredServiceMock) VerifyLogin(ctx context.Context, payload models.VerifyLoginPayload) (string, error) {
+	args := csm.Called(ctx, payload)
+	return args.String(0), args.Error(1)
+}
+
+func (csm *CredServiceMock) FindByUsername(ctx context.Context, username string) (*models.User, error) {
+	args := csm.Called(ctx, username)
+	return args.Get(0).(*models.User), args.Error(1)
+}
+
+func (csm *CredServiceMock) Refresh(ctx context.Context, identity jwttoken.Identity) (string, error) {
+	args := csm.Called(ctx, identity)
+	return args.String(0), args.Error(1)
+}
+
+// newClient serves the gRPC API in memory until the test ends and returns a client of it.
+func newClient(t *testing.T, csm *CredServiceMock) meliusv1.CredentialServiceClient {
+	listener := bufconn.Listen(1 << 20)
+	server := grpcapi.NewServer(csm, jwttoken.NewAuthenticator(), time.Minute)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return meliusv1.NewCredentialServiceClient(conn)
+}
+
+// withToken returns ctx sending a token of user 1, authenticated authAge ago.
+func withToken(t *testing.T, ctx context.Context, authAge time.Duration, roles ...string) context.Context {
+	claims := jwttoken.NewClaims(1, "ryanpujo")
+	claims.Roles = roles
+	claims.SessionID = "current"
+	claims.Authenticated(time.Now().Add(-authAge), jwttoken.ACRSingleFactor, jwttoken.AMRPassword)
+	token, err := jwttoken.GenerateToken(claims)
+	require.NoError(t, err)
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+}
+
+func TestRegister(t *testing.T) {
+	csm := new(CredServiceMock)
+	client := newClient(t, csm)
+
+	req := &meliusv1.RegisterRequest{
+		FirstName: "ryan",
+		LastName:  "pujo",
+		Email:     "ryan@example.com",
+		Username:  "ryanpujo",
+		Password:  "secret",
+	}
+	csm.On("Write", mock.Anything, mock.MatchedBy(func(payload models.UserPayload) bool {
+		return payload.CredentialPayload.Username == "ryanpujo" && payload.Attributes == nil
+	})).Return(uint(1), nil).Once()
+
+	var header metadata.MD
+	res, err := client.Register(context.Background(), req, grpc.Header(&header))
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), res.GetId())
+	require.Len(t, header.Get(requestinfo.HeaderRequestID), 1)
+
+	req.Email = "not an email"
+	_, err = client.Register(context.Background(), req)
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	csm.AssertExpectations(t)
+}
+
+func TestLogin(t *testing.T) {
+	expiresAt := time.Now().Add(10 * time.Minute).UTC().Truncate(time.Second)
+	tableTest := map[string]struct {
+		arrange func(csm *CredServiceMock)
+		assert  func(t *testing.T, res *meliusv1.LoginResponse, err error)
+	}{
+		"success": {
+			arrange: func(csm *CredServiceMock) {
+				csm.On("Login", mock.Anything, "ryanpujo").Return("token", nil).Once()
+			},
+			assert: func(t *testing.T, res *meliusv1.LoginResponse, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "token", res.GetAccessToken())
+				require.Nil(t, res.GetStepUp())
+			},
+		},
+		"step-up": {
+			arrange: func(csm *CredServiceMock) {
+				csm.On("Login", mock.Anything, "ryanpujo").
+					Return("", &services.StepUpRequiredError{ChallengeID: "challenge", ExpiresAt: expiresAt}).Once()
+			},
+			assert: func(t *testing.T, res *meliusv1.LoginResponse, err error) {
+				require.NoError(t, err)
+				require.Empty(t, res.GetAccessToken())
+				require.Equal(t, "challenge", res.GetStepUp().GetChallengeId())
+				require.True(t, expiresAt.Equal(res.GetStepUp().GetExpiresAt().AsTime()))
+			},
+		},
+		"blocked": {
+			arrange: func(csm *CredServiceMock) {
+				csm.On("Login", mock.Anything, "ryanpujo").Return("", services.ErrLoginBlocked).Once()
+			},
+			assert: func(t *testing.T, res *meliusv1.LoginResponse, err error) {
+				require.Equal(t, codes.PermissionDenied, status.Code(err))
+			},
+		},
+		"no device": {
+			arrange: func(csm *CredServiceMock) {
+				csm.On("Login", mock.Anything, "ryanpujo").Return("", services.ErrDeviceRequired).Once()
+			},
+			assert: func(t *testing.T, res *meliusv1.LoginResponse, err error) {
+				require.Equal(t, codes.FailedPrecondition, status.Code(err))
+			},
+		},
+		"wrong password": {
+			arrange: func(csm *CredServiceMock) {
+				csm.On("Login", mock.Anything, "ryanpujo").Return("", fmt.Errorf("authentication failed")).Once()
+			},
+			assert: func(t *testing.T, res *meliusv1.LoginResponse, err error) {
+				require.Equal(t, codes.Unauthenticated, status.Code(err))
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			csm := new(CredServiceMock)
+			client := newClient(t, csm)
+			v.arrange(csm)
+
+			res, err := client.Login(context.Background(), &meliusv1.LoginRequest{Identifier: "ryanpujo", Password: "secret"})
+
+			v.assert(t, res, err)
+			csm.AssertExpectations(t)
+		})
+	}
+}
+
+func TestLoginDevice(t *testing.T) {
+	csm := new(CredServiceMock)
+	client := newClient(t, csm)
+	csm.On("Login", mock.MatchedBy(func(ctx context.Context) bool {
+		return requestinfo.FromContext(ctx).DeviceID == "device"
+	}), "ryanpujo").Return("token", nil).Once()
+
+	// The device id of callers is recognized like the device cookie of browsers.
+	ctx := metadata.AppendToOutgoingContext(context.Background(), requestinfo.HeaderDeviceID, "device")
+	res, err := client.Login(ctx, &meliusv1.LoginRequest{Identifier: "ryanpujo", Password: "secret"})
+	require.NoError(t, err)
+	require.Equal(t, "token", res.GetAccessToken())
+	csm.AssertExpectations(t)
+}
+
+func TestVerifyLogin(t *testing.T) {
+	payload := models.VerifyLoginPayload{ChallengeID: "challenge", Code: "123456"}
+	tableTest := map[string]struct {
+		req     *meliusv1.VerifyLoginRequest
+		arrange func(csm *CredServiceMock)
+		assert  func(t *testing.T, res *meliusv1.VerifyLoginResponse, err error)
+	}{
+		"success": {
+			req: &meliusv1.VerifyLoginRequest{ChallengeId: "challenge", Code: "123456"},
+			arrange: func(csm *CredServiceMock) {
+				csm.On("VerifyLogin", mock.MatchedBy(func(ctx context.Context) bool {
+					return requestinfo.FromContext(ctx).DeviceID == "device"
+				}), payload).Return("token", nil).Once()
+			},
+			assert: func(t *testing.T, res *meliusv1.VerifyLoginResponse, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "token", res.GetAccessToken())
+			},
+		},
+		"invalid code": {
+			req:     &meliusv1.VerifyLoginRequest{ChallengeId: "challenge", Code: "12345x"},
+			arrange: func(csm *CredServiceMock) {},
+			assert: func(t *testing.T, res *meliusv1.VerifyLoginResponse, err error) {
+				require.Equal(t, codes.InvalidArgument, status.Code(err))
+			},
+		},
+		"wrong code": {
+			req: &meliusv1.VerifyLoginRequest{ChallengeId: "challenge", Code: "123456"},
+			arrange: func(csm *CredServiceMock) {
+				csm.On("VerifyLogin", mock.Anything, payload).Return("", services.ErrChallengeInvalid).Once()
+			},
+			assert: func(t *testing.T, res *meliusv1.VerifyLoginResponse, err error) {
+				require.Equal(t, codes.Unauthenticated, status.Code(err))
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			csm := new(CredServiceMock)
+			client := newClient(t, csm)
+			v.arrange(csm)
+
+			ctx := metadata.AppendToOutgoingContext(context.Background(), requestinfo.HeaderDeviceID, "device")
+			res, err := client.VerifyLogin(ctx, v.req)
+
+			v.assert(t, res, err)
+			csm.AssertExpectations(t)
+		})
+	}
+}
+
+func TestGetUser(t *testing.T) {
+	user := &models.User{
+		ID:         1,
+		FirstName:  "ryan",
+		Roles:      []string{models.RoleAdmin},
+		Attributes: map[string]any{"department": "sales"},
+		Credential: models.Credential{Username: "ryanpujo", Email: "ryan@example.com"},
+	}
+	tableTest := map[string]struct {
+		ctx     func(t *testing.T) context.Context
+		req     *meliusv1.GetUserRequest
+		arrange func(csm *CredServiceMock)
+		assert  func(t *testing.T, res *meliusv1.GetUserResponse, err error)
+	}{
+		"self": {
+			ctx: func(t *testing.T) context.Context { return withToken(t, context.Background(), time.Hour) },
+			req: &meliusv1.GetUserRequest{},
+			arrange: func(csm *CredServiceMock) {
+				csm.On("FindByUsername", mock.Anything, "ryanpujo").Return(user, nil).Once()
+			},
+			assert: func(t *testing.T, res *meliusv1.GetUserResponse, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "ryan@example.com", res.GetUser().GetEmail())
+				require.Equal(t, "sales", res.GetUser().GetAttributes().AsMap()["department"])
+			},
+		},
+		"username changed": {
+			ctx: func(t *testing.T) context.Context { return withToken(t, context.Background(), time.Hour) },
+			req: &meliusv1.GetUserRequest{},
+			arrange: func(csm *CredServiceMock) {
+				csm.On("FindByUsername", mock.Anything, "ryanpujo").Return(&models.User{ID: 2}, nil).Once()
+			},
+			assert: func(t *testing.T, res *meliusv1.GetUserResponse, err error) {
+				require.Equal(t, codes.FailedPrecondition, status.Code(err))
+			},
+		},
+		"unauthenticated": {
+			ctx:     func(t *testing.T) context.Context { return context.Background() },
+			req:     &meliusv1.GetUserRequest{},
+			arrange: func(csm *CredServiceMock) {},
+			assert: func(t *testing.T, res *meliusv1.GetUserResponse, err error) {
+				require.Equal(t, codes.Unauthenticated, status.Code(err))
+			},
+		},
+		"other user": {
+			ctx:     func(t *testing.T) context.Context { return withToken(t, context.Background(), 0) },
+			req:     &meliusv1.GetUserRequest{Username: "pujo"},
+			arrange: func(csm *CredServiceMock) {},
+			assert: func(t *testing.T, res *meliusv1.GetUserResponse, err error) {
+				require.Equal(t, codes.PermissionDenied, status.Code(err))
+			},
+		},
+		"admin": {
+			ctx: func(t *testing.T) context.Context {
+				return withToken(t, context.Background(), 0, models.RoleAdmin)
+			},
+			req: &meliusv1.GetUserRequest{Username: "pujo"},
+			arrange: func(csm *CredServiceMock) {
+				csm.On("FindByUsername", mock.Anything, "pujo").Return((*models.User)(nil), fmt.Errorf("not found: %w", sql.ErrNoRows)).Once()
+			},
+			assert: func(t *testing.T, res *meliusv1.GetUserResponse, err error) {
+				require.Equal(t, codes.NotFound, status.Code(err))
+			},
+		},
+		"admin without recent authentication": {
+			ctx: func(t *testing.T) context.Context {
+				return withToken(t, context.Background(), time.Hour, models.RoleAdmin)
+			},
+			req:     &meliusv1.GetUserRequest{Username: "pujo"},
+			arrange: func(csm *CredServiceMock) {},
+			assert: func(t *testing.T, res *meliusv1.GetUserResponse, err error) {
+				require.Equal(t, codes.Unauthenticated, status.Code(err))
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			csm := new(CredServiceMock)
+			client := newClient(t, csm)
+			v.arrange(csm)
+
+			res, err := client.GetUser(v.ctx(t), v.req)
+
+			v.assert(t, res, err)
+			csm.AssertExpectations(t)
+		})
+	}
+}
+
+func TestRefreshToken(t *testing.T) {
+	csm := new(CredServiceMock)
+	client := newClient(t, csm)
+
+	csm.On("Refresh", mock.Anything, mock.MatchedBy(func(identity jwttoken.Identity) bool {
+		return identity.UserID == 1 && identity.SessionID == "current" && identity.ACR == jwttoken.ACRSingleFactor
+	})).Return("refreshed", nil).Once()
+	res, err := client.RefreshToken(withToken(t, context.Background(), 0), &meliusv1.RefreshTokenRequest{})
+	require.NoError(t, err)
+	require.Equal(t, "refreshed", res.GetAccessToken())
+
+	csm.On("Refresh", mock.Anything, mock.Anything).Return("", services.ErrRefreshForbidden).Once()
+	_, err = client.RefreshToken(withToken(t, context.Background(), 0), &meliusv1.RefreshTokenRequest{})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = client.RefreshToken(context.Background(), &meliusv1.RefreshTokenRequest{})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	csm.AssertExpectations(t)
+}
+
+func TestValidateToken(t *testing.T) {
+	client := newClient(t, new(CredServiceMock))
+
+	claims := jwttoken.NewClaims(1, "ryanpujo")
+	claims.Roles = []string{"staff"}
+	claims.Scope = "read"
+	claims.Authenticated(time.Now(), jwttoken.ACRSingleFactor, jwttoken.AMRPassword)
+	token, err := jwttoken.GenerateToken(claims)
+	require.NoError(t, err)
+
+	res, err := client.ValidateToken(context.Background(), &meliusv1.ValidateTokenRequest{Token: token})
+	require.NoError(t, err)
+	require.True(t, res.GetValid())
+	require.Equal(t, jwttoken.PrincipalUser, res.GetPrincipal().GetType())
+	require.Equal(t, uint64(1), res.GetPrincipal().GetUserId())
+	require.Equal(t, []string{"staff"}, res.GetPrincipal().GetRoles())
+	require.Equal(t, []string{"read"}, res.GetPrincipal().GetScopes())
+	require.NotNil(t, res.GetPrincipal().GetAuthTime())
+
+	res, err = client.ValidateToken(context.Background(), &meliusv1.ValidateTokenRequest{Token: token + "x"})
+	require.NoError(t, err)
+	require.False(t, res.GetValid())
+	require.NotEmpty(t, res.GetReason())
+	require.Nil(t, res.GetPrincipal())
+
+	_, err = client.ValidateToken(context.Background(), &meliusv1.ValidateTokenRequest{})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
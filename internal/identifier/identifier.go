@@ -0,0 +1,47 @@
+// Package identifier canonicalizes the usernames and emails users log in with,
+// so that identifiers differing only in case or Unicode representation map to
+// the same account.
+package identifier
+
+import (
+	"strings"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+var folder = cases.Fold()
+
+// Username returns the canonical form of a username:
+// NFKC normalized, case folded and trimmed of surrounding whitespace.
+func Username(username string) string {
+	s := norm.NFKC.String(strings.TrimSpace(username))
+	// Folding can produce a denormalized string, normalize once more.
+	return norm.NFKC.String(folder.String(s))
+}
+
+// Email returns the canonical form of an email address.
+// The local part is NFKC normalized and case folded, the domain is converted to its
+// lower case ASCII (punycode) form. Addresses that cannot be split into a local part
+// and a domain are canonicalized like usernames.
+func Email(email string) string {
+	s := norm.NFKC.String(strings.TrimSpace(email))
+	at := strings.LastIndex(s, "@")
+	if at <= 0 || at == len(s)-1 {
+		return Username(s)
+	}
+
+	local := norm.NFKC.String(folder.String(s[:at]))
+	domain := strings.TrimSuffix(s[at+1:], ".")
+	if ascii, err := idna.Lookup.ToASCII(domain); err == nil {
+		domain = ascii
+	}
+	return local + "@" + strings.ToLower(domain)
+}
+
+// IsEmail reports whether a login identifier should be treated as an email address.
+// Usernames cannot contain '@', so the presence of one is enough.
+func IsEmail(s string) bool {
+	return strings.Contains(s, "@")
+}
@@ -0,0 +1,58 @@
+package identifier_test
+
+import (
+	"testing"
+
+	"github.com/ryanpujo/melius/internal/identifier"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsername(t *testing.T) {
+	tableTest := map[string]struct {
+		input    string
+		expected string
+	}{
+		"lower case":       {input: "ryanpujo", expected: "ryanpujo"},
+		"mixed case":       {input: "RyanPujo", expected: "ryanpujo"},
+		"whitespace":       {input: "  ryan ", expected: "ryan"},
+		"full width":       {input: "ｒｙａｎ", expected: "ryan"},
+		"ligature":         {input: "ﬁle", expected: "file"},
+		"sharp s folds":    {input: "STRASSE", expected: "strasse"},
+		"composed accents": {input: "José", expected: "josé"},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			require.Equal(t, v.expected, identifier.Username(v.input))
+		})
+	}
+}
+
+func TestEmail(t *testing.T) {
+	tableTest := map[string]struct {
+		input    string
+		expected string
+	}{
+		"lower case":      {input: "ryanpujo@gmail.com", expected: "ryanpujo@gmail.com"},
+		"mixed case":      {input: "RyanPujo@GMail.Com", expected: "ryanpujo@gmail.com"},
+		"whitespace":      {input: " ryan@pujo.dev ", expected: "ryan@pujo.dev"},
+		"trailing dot":    {input: "ryan@pujo.dev.", expected: "ryan@pujo.dev"},
+		"unicode domain":  {input: "ryan@Bücher.de", expected: "ryan@xn--bcher-kva.de"},
+		"sub address":     {input: "Ryan+Tag@pujo.dev", expected: "ryan+tag@pujo.dev"},
+		"missing domain":  {input: "Ryan@", expected: "ryan@"},
+		"not an address":  {input: "RYAN", expected: "ryan"},
+		"full width at":   {input: "ryan＠pujo.dev", expected: "ryan@pujo.dev"},
+		"multiple at use": {input: "\"a@b\"@Pujo.dev", expected: "\"a@b\"@pujo.dev"},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			require.Equal(t, v.expected, identifier.Email(v.input))
+		})
+	}
+}
+
+func TestIsEmail(t *testing.T) {
+	require.True(t, identifier.IsEmail("ryan@pujo.dev"))
+	require.False(t, identifier.IsEmail("ryanpujo"))
+}
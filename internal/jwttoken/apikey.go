@@ -0,0 +1,85 @@
+package jwttoken
+
+import (
+	"context"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ryanpujo/melius/internal/models"
+)
+
+// TransportAPIKey is the Authorization header with the ApiKey scheme.
+const TransportAPIKey = "api_key"
+
+// Principal is the identity an API key authenticates as.
+type Principal struct {
+	UserID   uint
+	Username string
+	Roles    []string
+	Scopes   []string
+	KeyID    string
+}
+
+// APIKeyAuthenticator returns the principal of an API key, or an error when the
+// key is unknown, expired or its owner can no longer log in.
+type APIKeyAuthenticator func(ctx context.Context, key string) (*Principal, error)
+
+// WithAPIKeys makes JWTAuthMiddleware also accept API keys sent as
+// "Authorization: ApiKey <key>". Safe requests need the read scope, others the write scope.
+func WithAPIKeys(authenticate APIKeyAuthenticator) Option {
+	return func(o *options) {
+		o.apiKeys = authenticate
+	}
+}
+
+// UnlessAPIKeyScope runs next except for requests authenticated with an API key granted
+// scope, which pass. API keys carry no authentication time, the user authenticated
+// recently to grant the scope instead, so next is typically RequireRecentAuth.
+// It must run after JWTAuthMiddleware.
+func UnlessAPIKeyScope(scope string, next gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString(TransportKey) == TransportAPIKey && slices.Contains(c.GetStringSlice("scopes"), scope) {
+			c.Next()
+			return
+		}
+		next(c)
+	}
+}
+
+// authenticateKey returns the identity of the API key of r, populated like a token
+// would. API keys carry no session and no authentication time, so they cannot be used
+// on routes requiring a recent authentication, but for UnlessAPIKeyScope.
+func (o *options) authenticateKey(ctx context.Context, r *http.Request, key string) (*Identity, *AuthError) {
+	principal, err := o.apiKeys(ctx, key)
+	if err != nil {
+		return nil, unauthenticated("Invalid API key")
+	}
+
+	scope := models.ScopeWrite
+	if SafeMethod(r.Method) {
+		scope = models.ScopeRead
+	}
+	if !slices.Contains(principal.Scopes, scope) {
+		return nil, &AuthError{Status: http.StatusForbidden, Message: "Insufficient scope"}
+	}
+
+	return &Identity{
+		PrincipalType: PrincipalUser,
+		UserID:        principal.UserID,
+		Username:      principal.Username,
+		Roles:         principal.Roles,
+		Scopes:        principal.Scopes,
+		APIKeyID:      principal.KeyID,
+		Transport:     TransportAPIKey,
+	}, nil
+}
+
+// SafeMethod reports whether an HTTP method is safe, that is read-only.
+func SafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package jwttoken
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Transports carrying access tokens to the API.
+const (
+	// TransportHeader is the Authorization header with the Bearer scheme.
+	TransportHeader = "header"
+	// TransportCookie is the HttpOnly cookie set at login for browser apps.
+	TransportCookie = "cookie"
+)
+
+// TransportKey is the context key of the transport the token of the request came in.
+const TransportKey = "token_transport"
+
+// Cookie configures the cookie transport of access tokens.
+type Cookie struct {
+	Name     string
+	Secure   bool
+	SameSite http.SameSite
+}
+
+// Set stores the access token in the cookie for maxAge.
+func (ck *Cookie) Set(c *gin.Context, token string, maxAge time.Duration) {
+	c.SetSameSite(ck.SameSite)
+	c.SetCookie(ck.Name, token, int(maxAge.Seconds()), "/", "", ck.Secure, true)
+}
+
+// Clear removes the cookie from the browser.
+func (ck *Cookie) Clear(c *gin.Context) {
+	c.SetSameSite(ck.SameSite)
+	c.SetCookie(ck.Name, "", -1, "/", "", ck.Secure, true)
+}
+
+// ParseSameSite returns the SameSite mode named s, one of "strict", "lax" or "none".
+// Any other value falls back to lax.
+func ParseSameSite(s string) http.SameSite {
+	switch strings.ToLower(s) {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteLaxMode
+	}
+}
+
+// WithCookie makes JWTAuthMiddleware also accept tokens from the cookie name.
+// Transports lists the accepted transports by precedence, the first one present
+// on a request is used; it defaults to the header before the cookie.
+func WithCookie(name string, transports ...string) Option {
+	return func(o *options) {
+		o.cookie = name
+		if len(transports) > 0 {
+			o.transports = transports
+		} else {
+			o.transports = []string{TransportHeader, TransportCookie}
+		}
+	}
+}
+
+// tokenFromRequest returns the token of the request and the transport it came in.
+func (o *options) tokenFromRequest(r *http.Request) (string, string) {
+	for _, transport := range o.transports {
+		switch transport {
+		case TransportHeader:
+			if authHeader := r.Header.Get("Authorization"); authHeader != "" {
+				if key, ok := strings.CutPrefix(authHeader, "ApiKey "); ok && o.apiKeys != nil {
+					return strings.TrimSpace(key), TransportAPIKey
+				}
+				if token, ok := strings.CutPrefix(authHeader, "DPoP "); ok {
+					return strings.TrimSpace(token), TransportDPoP
+				}
+				tokenString, _ := strings.CutPrefix(authHeader, "Bearer")
+				return strings.TrimSpace(tokenString), TransportHeader
+			}
+		case TransportCookie:
+			if cookie, err := r.Cookie(o.cookie); err == nil && cookie.Value != "" {
+				return cookie.Value, TransportCookie
+			}
+		}
+	}
+	return "", ""
+}
@@ -0,0 +1,62 @@
+package jwttoken
+
+import (
+	"net/http"
+
+	"github.com/ryanpujo/melius/accesstoken"
+	"github.com/ryanpujo/melius/config"
+)
+
+// TransportDPoP is the Authorization header with the DPoP scheme, carrying a
+// sender-constrained token along with a DPoP proof header.
+const TransportDPoP = "dpop"
+
+// DPoPProofMaxAge is how old a DPoP proof may be. Its jti is remembered as long.
+const DPoPProofMaxAge = accesstoken.DPoPProofMaxAge
+
+// Confirmation is the cnf claim binding sender-constrained tokens to a key.
+type Confirmation = accesstoken.Confirmation
+
+// ReplayCache remembers the jti of DPoP proofs and client assertions so each is used only once.
+type ReplayCache = accesstoken.ReplayCache
+
+// NewReplayCache returns a ReplayCache kept in memory.
+func NewReplayCache() ReplayCache {
+	return accesstoken.NewReplayCache()
+}
+
+// WithReplayCache makes JWTAuthMiddleware remember the DPoP proofs it accepted in cache,
+// which should be shared by every middleware of the service.
+func WithReplayCache(cache ReplayCache) Option {
+	return func(o *options) {
+		o.replay = cache
+	}
+}
+
+// WithoutDPoP makes JWTAuthMiddleware refuse the tokens bound to a DPoP key, for routes
+// answering about requests made to another URL, which their DPoP proofs are signed for.
+func WithoutDPoP() Option {
+	return func(o *options) {
+		o.noDPoP = true
+	}
+}
+
+// VerifyDPoPProof verifies the DPoP proof sent with a request of method to rawURL, as
+// accesstoken.VerifyDPoPProof does, and returns the thumbprint of its public key.
+func VerifyDPoPProof(proof, method, rawURL, accessToken string, replay ReplayCache) (string, error) {
+	return accesstoken.VerifyDPoPProof(proof, method, rawURL, accessToken, replay)
+}
+
+// TrustedProxies returns the reverse proxies of TRUSTED_PROXIES, or an error when
+// one of them is invalid.
+func TrustedProxies() (accesstoken.TrustedProxies, error) {
+	return accesstoken.ParseTrustedProxies(config.Config().TrustedProxies)
+}
+
+// RequestURL returns the URL the client addressed with r, as signed in the htu of DPoP
+// proofs. X-Forwarded-Proto is honoured only on the requests of TrustedProxies, and
+// of none when they are invalid.
+func RequestURL(r *http.Request) string {
+	proxies, _ := TrustedProxies()
+	return accesstoken.RequestURL(r, proxies)
+}
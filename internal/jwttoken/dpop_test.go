@@ -0,0 +1,167 @@
+package jwttoken_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/ryanpujo/melius/internal/jwttoken"
+	"github.com/stretchr/testify/require"
+)
+
+// dpopKey is an Ed25519 key signing DPoP proofs.
+type dpopKey struct {
+	private ed25519.PrivateKey
+	x       string
+}
+
+func newDPoPKey(t *testing.T) dpopKey {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	return dpopKey{private: private, x: base64.RawURLEncoding.EncodeToString(public)}
+}
+
+// thumbprint computes the RFC 7638 thumbprint of the key.
+func (k dpopKey) thumbprint() string {
+	canonical, _ := json.Marshal(map[string]string{"crv": "Ed25519", "kty": "OKP", "x": k.x})
+	sum := sha256.Sum256(canonical)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// proof signs a DPoP proof for a request of method to htu carrying accessToken.
+func (k dpopKey) proof(t *testing.T, jti, method, htu, accessToken string) string {
+	claims := jwt.MapClaims{"jti": jti, "htm": method, "htu": htu, "iat": time.Now().Unix()}
+	if accessToken != "" {
+		sum := sha256.Sum256([]byte(accessToken))
+		claims["ath"] = base64.RawURLEncoding.EncodeToString(sum[:])
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	token.Header["typ"] = "dpop+jwt"
+	token.Header["jwk"] = map[string]string{"kty": "OKP", "crv": "Ed25519", "x": k.x}
+	proof, err := token.SignedString(k.private)
+	require.NoError(t, err)
+	return proof
+}
+
+func TestVerifyDPoPProof(t *testing.T) {
+	key := newDPoPKey(t)
+	replay := jwttoken.NewReplayCache()
+
+	jkt, err := jwttoken.VerifyDPoPProof(key.proof(t, "1", http.MethodPost, "https://melius.test/oauth/token?x=1", ""),
+		http.MethodPost, "https://melius.test/oauth/token", "", replay)
+	require.NoError(t, err)
+	require.Equal(t, key.thumbprint(), jkt)
+
+	_, err = jwttoken.VerifyDPoPProof(key.proof(t, "1", http.MethodPost, "https://melius.test/oauth/token", ""),
+		http.MethodPost, "https://melius.test/oauth/token", "", replay)
+	require.ErrorContains(t, err, "already used")
+
+	_, err = jwttoken.VerifyDPoPProof(key.proof(t, "2", http.MethodGet, "https://melius.test/oauth/token", ""),
+		http.MethodPost, "https://melius.test/oauth/token", "", replay)
+	require.ErrorContains(t, err, "another method")
+
+	_, err = jwttoken.VerifyDPoPProof("not a proof", http.MethodPost, "https://melius.test/oauth/token", "", replay)
+	require.Error(t, err)
+}
+
+func TestDPoP(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	key, other := newDPoPKey(t), newDPoPKey(t)
+
+	bound := jwttoken.NewClaims(1, "ryanpujo")
+	bound.Bind(key.thumbprint())
+	boundToken, err := jwttoken.GenerateToken(bound)
+	require.NoError(t, err)
+	bearerToken, err := jwttoken.GenerateToken(jwttoken.NewClaims(1, "ryanpujo"))
+	require.NoError(t, err)
+
+	const htu = "http://example.com/"
+	replayed := key.proof(t, "replayed", http.MethodGet, htu, boundToken)
+
+	var jkt string
+	router := gin.New()
+	router.GET("/", jwttoken.JWTAuthMiddleware(jwttoken.WithReplayCache(jwttoken.NewReplayCache())), func(c *gin.Context) {
+		jkt = jwttoken.IdentityOf(c).JKT
+		c.Status(http.StatusOK)
+	})
+	serve := func(authorization, proof string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", authorization)
+		if proof != "" {
+			req.Header.Set("DPoP", proof)
+		}
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		return res
+	}
+	require.Equal(t, http.StatusOK, serve("DPoP "+boundToken, replayed).Code)
+	require.Equal(t, key.thumbprint(), jkt)
+
+	tableTest := map[string]struct {
+		authorization string
+		proof         string
+		status        int
+	}{
+		"bound token with proof": {
+			authorization: "DPoP " + boundToken,
+			proof:         key.proof(t, "fresh", http.MethodGet, htu, boundToken),
+			status:        http.StatusOK,
+		},
+		"replayed proof": {
+			authorization: "DPoP " + boundToken,
+			proof:         replayed,
+			status:        http.StatusUnauthorized,
+		},
+		"bound token as bearer": {
+			authorization: "Bearer " + boundToken,
+			status:        http.StatusUnauthorized,
+		},
+		"bound token without proof": {
+			authorization: "DPoP " + boundToken,
+			status:        http.StatusUnauthorized,
+		},
+		"proof of another key": {
+			authorization: "DPoP " + boundToken,
+			proof:         other.proof(t, "other", http.MethodGet, htu, boundToken),
+			status:        http.StatusUnauthorized,
+		},
+		"proof for another token": {
+			authorization: "DPoP " + boundToken,
+			proof:         key.proof(t, "ath", http.MethodGet, htu, bearerToken),
+			status:        http.StatusUnauthorized,
+		},
+		"proof for another URL": {
+			authorization: "DPoP " + boundToken,
+			proof:         key.proof(t, "htu", http.MethodGet, "http://example.com/admin", boundToken),
+			status:        http.StatusUnauthorized,
+		},
+		"unbound token with DPoP scheme": {
+			authorization: "DPoP " + bearerToken,
+			proof:         key.proof(t, "unbound", http.MethodGet, htu, bearerToken),
+			status:        http.StatusUnauthorized,
+		},
+		"unbound token as bearer": {
+			authorization: "Bearer " + bearerToken,
+			status:        http.StatusOK,
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			res := serve(v.authorization, v.proof)
+
+			require.Equal(t, v.status, res.Code)
+			if v.status == http.StatusUnauthorized {
+				require.Contains(t, res.Header().Get("WWW-Authenticate"), "invalid_dpop_proof")
+			}
+		})
+	}
+}
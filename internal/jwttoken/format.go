@@ -0,0 +1,76 @@
+package jwttoken
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/ryanpujo/melius/accesstoken"
+	"github.com/ryanpujo/melius/config"
+)
+
+// Formats of access tokens, selected by the TOKEN_FORMAT setting.
+const (
+	FormatJWT    = "jwt"
+	FormatPASETO = "paseto"
+)
+
+// Format encodes the claims of access tokens into signed tokens and verifies them.
+type Format = accesstoken.Format
+
+// KeyPublisher is implemented by the formats signing tokens with a key pair.
+type KeyPublisher = accesstoken.KeyPublisher
+
+// ErrPASETOInvalid is returned when a PASETO is malformed or its signature is invalid.
+var ErrPASETOInvalid = accesstoken.ErrPASETOInvalid
+
+// TokenFormat returns the format of access tokens selected by the configuration,
+// JWT unless PASETO is selected. JWTs are signed with EdDSA when a JWT signing key
+// is configured, with HS256 and the JWT key otherwise. Changing the format or its
+// keys invalidates the tokens already issued.
+func TokenFormat() (Format, error) {
+	conf := config.Config()
+	switch conf.TokenFormat {
+	case "", FormatJWT:
+		if conf.JWTSigningKey == "" {
+			return NewJWTFormat([]byte(conf.JWTKey)), nil
+		}
+		key, err := ed25519Key(conf.JWTSigningKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JWT signing key: %w", err)
+		}
+		return NewEd25519JWTFormat(key), nil
+	case FormatPASETO:
+		key, err := ed25519Key(conf.PASETOKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PASETO key: %w", err)
+		}
+		return NewPASETOFormat(key), nil
+	}
+	return nil, fmt.Errorf("unknown token format %q", conf.TokenFormat)
+}
+
+// ed25519Key returns the Ed25519 private key of a hex encoded seed.
+func ed25519Key(seed string) (ed25519.PrivateKey, error) {
+	b, err := hex.DecodeString(seed)
+	if err != nil || len(b) != ed25519.SeedSize {
+		return nil, errors.New("must be a hex encoded Ed25519 seed")
+	}
+	return ed25519.NewKeyFromSeed(b), nil
+}
+
+// NewJWTFormat returns the JWT format, signing tokens with HS256 and key.
+func NewJWTFormat(key []byte) Format {
+	return accesstoken.NewJWTFormat(key)
+}
+
+// NewEd25519JWTFormat returns the JWT format, signing tokens with EdDSA and key.
+func NewEd25519JWTFormat(key ed25519.PrivateKey) Format {
+	return accesstoken.NewEd25519JWTFormat(key)
+}
+
+// NewPASETOFormat returns the PASETO v4.public format, signing tokens with key.
+func NewPASETOFormat(key ed25519.PrivateKey) Format {
+	return accesstoken.NewPASETOFormat(key)
+}
@@ -0,0 +1,118 @@
+package jwttoken_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/ryanpujo/melius/config"
+	"github.com/ryanpujo/melius/internal/jwttoken"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenFormat(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	conf := config.Config()
+	defer func(format string) { conf.TokenFormat = format }(conf.TokenFormat)
+
+	router := gin.New()
+	router.GET("/", jwttoken.JWTAuthMiddleware(), func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString("username"))
+	})
+	serve := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		return res
+	}
+
+	conf.TokenFormat = jwttoken.FormatJWT
+	jwtToken, err := jwttoken.GenerateToken(jwttoken.NewClaims(1, "ryanpujo"))
+	require.NoError(t, err)
+
+	conf.TokenFormat = jwttoken.FormatPASETO
+	pasetoToken, err := jwttoken.GenerateToken(jwttoken.NewClaims(1, "ryanpujo"))
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(pasetoToken, "v4.public."))
+
+	res := serve(pasetoToken)
+	require.Equal(t, http.StatusOK, res.Code)
+	require.Equal(t, "ryanpujo", res.Body.String())
+	require.Equal(t, http.StatusUnauthorized, serve(jwtToken).Code)
+
+	expired := jwttoken.NewClaims(1, "ryanpujo")
+	expired.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+	expiredToken, err := jwttoken.GenerateToken(expired)
+	require.NoError(t, err)
+	_, err = jwttoken.Parse(expiredToken)
+	require.ErrorIs(t, err, jwttoken.ErrTokenExpired)
+
+	conf.TokenFormat = jwttoken.FormatJWT
+	require.Equal(t, http.StatusOK, serve(jwtToken).Code)
+	require.Equal(t, http.StatusUnauthorized, serve(pasetoToken).Code)
+
+	conf.TokenFormat = "xml"
+	_, err = jwttoken.GenerateToken(jwttoken.NewClaims(1, "ryanpujo"))
+	require.Error(t, err)
+}
+
+func TestJWKS(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	conf := config.Config()
+	defer func(format, key string) { conf.TokenFormat, conf.JWTSigningKey = format, key }(conf.TokenFormat, conf.JWTSigningKey)
+
+	router := gin.New()
+	router.GET("/.well-known/jwks.json", jwttoken.JWKSHandler())
+	keys := func() []map[string]any {
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+		require.Equal(t, http.StatusOK, res.Code)
+		require.Equal(t, "public, max-age=300", res.Header().Get("Cache-Control"))
+		var set struct {
+			Keys []map[string]any `json:"keys"`
+		}
+		require.NoError(t, json.Unmarshal(res.Body.Bytes(), &set))
+		return set.Keys
+	}
+
+	conf.TokenFormat, conf.JWTSigningKey = jwttoken.FormatJWT, ""
+	require.Empty(t, keys())
+
+	seed := make([]byte, ed25519.SeedSize)
+	_, err := rand.Read(seed)
+	require.NoError(t, err)
+	conf.JWTSigningKey = hex.EncodeToString(seed)
+	published := keys()
+	require.Len(t, published, 1)
+	require.Equal(t, "EdDSA", published[0]["alg"])
+	key, thumbprint, err := jwttoken.ParseJWK(published[0])
+	require.NoError(t, err)
+	require.Equal(t, ed25519.NewKeyFromSeed(seed).Public(), key)
+	require.Equal(t, thumbprint, published[0]["kid"])
+
+	token, err := jwttoken.GenerateToken(jwttoken.NewClaims(1, "ryanpujo"))
+	require.NoError(t, err)
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, &jwttoken.Claims{})
+	require.NoError(t, err)
+	require.Equal(t, "EdDSA", parsed.Method.Alg())
+	require.Equal(t, thumbprint, parsed.Header["kid"])
+	claims, err := jwttoken.Parse(token)
+	require.NoError(t, err)
+	require.Equal(t, "ryanpujo", claims.Username)
+
+	conf.TokenFormat = jwttoken.FormatPASETO
+	published = keys()
+	require.Len(t, published, 1)
+	require.NotContains(t, published[0], "alg")
+	_, err = jwttoken.Parse(token)
+	require.Error(t, err)
+}
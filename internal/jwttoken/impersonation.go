@@ -0,0 +1,26 @@
+package jwttoken
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ryanpujo/melius/accesstoken"
+)
+
+// Actor is the act claim of RFC 8693, the party acting on behalf of the subject of
+// a token. Actors may themselves act for another party, forming a chain.
+type Actor = accesstoken.Actor
+
+// RejectImpersonation rejects requests made with a token carrying an actor, for
+// operations an administrator must not perform on behalf of a user.
+// It must run after JWTAuthMiddleware.
+func RejectImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetUint("actor_id") != 0 {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not allowed while impersonating"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
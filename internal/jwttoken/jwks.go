@@ -0,0 +1,48 @@
+package jwttoken
+
+import (
+	"crypto"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ryanpujo/melius/accesstoken"
+)
+
+// JWK is a public JSON Web Key verifying access tokens.
+type JWK = accesstoken.JWK
+
+// JWKS is a JSON Web Key Set.
+type JWKS = accesstoken.JWKS
+
+// PublicKeys returns the public keys verifying the access tokens of the configured
+// format, none when they are signed with a shared secret.
+func PublicKeys() (JWKS, error) {
+	format, err := TokenFormat()
+	if err != nil {
+		return JWKS{}, err
+	}
+	keys := JWKS{Keys: []JWK{}}
+	if publisher, ok := format.(KeyPublisher); ok {
+		keys.Keys = append(keys.Keys, publisher.PublicKeys()...)
+	}
+	return keys, nil
+}
+
+// JWKSHandler serves the public keys verifying access tokens as a JSON Web Key Set,
+// for other services to verify tokens. They may cache the keys for a few minutes.
+func JWKSHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		keys, err := PublicKeys()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load keys"})
+			return
+		}
+		c.Header("Cache-Control", "public, max-age=300")
+		c.JSON(http.StatusOK, keys)
+	}
+}
+
+// ParseJWK returns the public key of a JSON Web Key and its thumbprint as in RFC 7638.
+func ParseJWK(jwk map[string]any) (crypto.PublicKey, string, error) {
+	return accesstoken.ParseJWK(jwk)
+}
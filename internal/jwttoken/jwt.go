@@ -1,56 +1,544 @@
 package jwttoken
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/ryanpujo/melius/accesstoken"
 	"github.com/ryanpujo/melius/config"
+	"github.com/ryanpujo/melius/internal/utilities"
 )
 
-func GenerateJWT(username string) (string, error) {
-	claims := jwt.MapClaims{
-		"username": username,
-		"exp":      time.Now().Add(15 * time.Minute).Unix(), // Short expiration time
+// AccessTokenTTL is the default lifetime of access tokens.
+const AccessTokenTTL = 15 * time.Minute
+
+// Authentication context class references, in increasing order of assurance.
+const (
+	// ACRSingleFactor is the level of a login with a password only.
+	ACRSingleFactor = "1"
+	// ACRMultiFactor is the level of a login confirmed with a second factor.
+	ACRMultiFactor = "2"
+)
+
+// acrLevels orders the known authentication context classes by assurance.
+var acrLevels = []string{ACRSingleFactor, ACRMultiFactor}
+
+// StrongerACR returns whichever of a and b is the higher known level of assurance.
+func StrongerACR(a, b string) string {
+	if slices.Index(acrLevels, a) > slices.Index(acrLevels, b) {
+		return a
+	}
+	return b
+}
+
+// Authentication methods references, as registered by RFC 8176.
+const (
+	AMRPassword    = "pwd"
+	AMROTP         = "otp"
+	AMRMultiFactor = "mfa"
+)
+
+// Claims are the claims carried by access tokens.
+type Claims = accesstoken.Claims
+
+// NewClaims returns the claims of an access token for the given user.
+func NewClaims(userID uint, username string) Claims {
+	return accesstoken.NewClaims(userID, username)
+}
+
+// GenerateToken signs claims into an access token of the configured format. The
+// registered claims left empty are set: the configured issuer, the audience of melius
+// and of the client of the token, a unique ID and the issue time, from which the
+// token is valid for the lifetime of its kind. The claim mappers then add their claims.
+func GenerateToken(claims Claims) (string, error) {
+	conf := config.Config()
+	if claims.Issuer == "" {
+		claims.Issuer = conf.Issuer
+	}
+	if len(claims.Audience) == 0 {
+		claims.Audience = audiences(claims.ClientID)
+	}
+	if claims.ID == "" {
+		id, err := utilities.RandomToken(16)
+		if err != nil {
+			return "", err
+		}
+		claims.ID = id
+	}
+	if claims.IssuedAt == nil {
+		claims.IssuedAt = jwt.NewNumericDate(time.Now())
+	}
+	if claims.NotBefore == nil {
+		claims.NotBefore = claims.IssuedAt
+	}
+	if claims.ExpiresAt == nil {
+		claims.ExpiresAt = jwt.NewNumericDate(claims.IssuedAt.Add(Lifetime(kind(&claims))))
+	}
+	if err := mapClaims(&claims); err != nil {
+		return "", err
+	}
+
+	format, err := TokenFormat()
+	if err != nil {
+		return "", err
+	}
+	return format.Sign(claims)
+}
+
+// audiences returns the audience of the tokens issued to the client clientID,
+// the audience of melius followed by the audiences configured for the client.
+func audiences(clientID string) jwt.ClaimStrings {
+	conf := config.Config()
+	var audience jwt.ClaimStrings
+	if conf.Audience != "" {
+		audience = append(audience, conf.Audience)
+	}
+	if clientID != "" {
+		audience = append(audience, conf.ClientAudiences[clientID]...)
+	}
+	return audience
+}
+
+var (
+	// ErrTokenExpired is returned by Parse for tokens past their expiry.
+	ErrTokenExpired = errors.New("Token expired")
+	// ErrTokenNotValidYet is returned by Parse for tokens used before their nbf or iat.
+	ErrTokenNotValidYet = errors.New("Token not valid yet")
+	// ErrTokenIssuer is returned by Parse for tokens of another issuer.
+	ErrTokenIssuer = errors.New("Token issued by another issuer")
+	// ErrTokenIncomplete is returned by Parse for tokens without an exp or iat.
+	ErrTokenIncomplete = errors.New("Token lacks registered claims")
+)
+
+// Parse verifies the signature of an access token of the configured format and
+// returns its claims, once their issuer and times are checked. Times are checked
+// with the configured leeway, tolerating clocks that are slightly apart.
+func Parse(tokenString string) (*Claims, error) {
+	format, err := TokenFormat()
+	if err != nil {
+		return nil, err
+	}
+	claims, err := format.Verify(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	conf := config.Config()
+	now := time.Now()
+	switch {
+	case claims.Issuer != conf.Issuer:
+		return nil, ErrTokenIssuer
+	case claims.ExpiresAt == nil || claims.IssuedAt == nil:
+		return nil, ErrTokenIncomplete
+	case claims.ExpiresAt.Before(now.Add(-conf.TokenLeeway)):
+		return nil, ErrTokenExpired
+	case claims.IssuedAt.After(now.Add(conf.TokenLeeway)),
+		claims.NotBefore != nil && claims.NotBefore.After(now.Add(conf.TokenLeeway)):
+		return nil, ErrTokenNotValidYet
+	}
+	return claims, nil
+}
+
+// SessionChecker returns an error when the session sid of the user is no longer active.
+type SessionChecker func(ctx context.Context, userID uint, sid string) error
+
+// Option configures JWTAuthMiddleware.
+type Option func(*options)
+
+type options struct {
+	checkSession SessionChecker
+	cookie       string
+	transports   []string
+	apiKeys      APIKeyAuthenticator
+	audience     string
+	replay       ReplayCache
+	noDPoP       bool
+	unauthorized func(c *gin.Context, message string)
+
+	checkServiceAccount ServiceAccountChecker
+}
+
+// WithSessionChecker makes JWTAuthMiddleware reject tokens without a session and
+// tokens whose session is no longer active, so revoking a session takes effect immediately.
+func WithSessionChecker(check SessionChecker) Option {
+	return func(o *options) {
+		o.checkSession = check
+	}
+}
+
+// WithAudience makes JWTAuthMiddleware accept the tokens exchanged for audience, the
+// name of a downstream service, instead of the tokens of melius, which carry the
+// configured audience, or none when it is not configured.
+func WithAudience(audience string) Option {
+	return func(o *options) {
+		o.audience = audience
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+}
 
-	return token.SignedString([]byte(config.Config().JWTKey))
+// WithUnauthorizedHandler makes JWTAuthMiddleware answer the requests it rejects
+// with handler instead of 401, such as to redirect browsers to a login page.
+// The request is aborted after handler returns.
+func WithUnauthorizedHandler(handler func(c *gin.Context, message string)) Option {
+	return func(o *options) {
+		o.unauthorized = handler
+	}
 }
 
-func JWTAuthMiddleware() gin.HandlerFunc {
+// reject aborts a request that could not be authenticated or is not allowed.
+func (o *options) reject(c *gin.Context, err *AuthError) {
+	if err.Challenge != "" {
+		c.Header("WWW-Authenticate", err.Challenge)
+	}
+	switch {
+	case err.Status == http.StatusForbidden:
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Message})
+	case o.unauthorized != nil:
+		o.unauthorized(c, err.Message)
+	default:
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Message})
+	}
+	c.Abort()
+}
+
+// JWTAuthMiddleware authenticates requests by their bearer token, or their cookie when
+// enabled with WithCookie, and stores the user_id, username, roles, sid, auth_time, acr
+// and amr of the token in the context, along with the transport it came in and the type
+// of principal. Tokens of service accounts store service_account_id, username and roles.
+// Impersonation tokens also store the actor_id of the impersonating administrator,
+// tokens issued to a client its client_id, and limited tokens their scopes. The whole
+// identity is returned by IdentityOf.
+// Tokens bound to a key with the cnf claim must be sent with the DPoP scheme along
+// with a DPoP proof signed by that key.
+func JWTAuthMiddleware(opts ...Option) gin.HandlerFunc {
+	a := NewAuthenticator(opts...)
+
 	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token is required"})
-			c.Abort()
+		identity, err := a.Authenticate(c, c.Request)
+		if err != nil {
+			a.reject(c, err)
 			return
 		}
-		tokenString, _ := strings.CutPrefix(authHeader, "Bearer")
+		identity.set(c)
+		c.Next()
+	}
+}
+
+// Authenticator authenticates requests by the rules of JWTAuthMiddleware, for servers
+// other than the gin routes, such as the Envoy external authorization server.
+type Authenticator struct {
+	options
+}
 
-		token, err := jwt.Parse(strings.TrimSpace(tokenString), func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, jwt.ErrSignatureInvalid
-			}
-			return []byte(config.Config().JWTKey), nil
-		})
+// NewAuthenticator returns an Authenticator configured like JWTAuthMiddleware by opts.
+func NewAuthenticator(opts ...Option) *Authenticator {
+	a := &Authenticator{options{transports: []string{TransportHeader}}}
+	for _, opt := range opts {
+		opt(&a.options)
+	}
+	if a.replay == nil {
+		a.replay = NewReplayCache()
+	}
+	if a.audience == "" {
+		a.audience = config.Config().Audience
+	}
+	return a
+}
+
+// Identity is the principal a request authenticated as, the values JWTAuthMiddleware
+// stores in the context.
+type Identity struct {
+	// PrincipalType tells whether UserID or ServiceAccountID is set.
+	PrincipalType    string
+	UserID           uint
+	ServiceAccountID uint
+	Username         string
+	Roles            []string
+	SessionID        string
+	AuthTime         time.Time
+	ACR              string
+	AMR              []string
+	// ActorID is the administrator impersonating the user, zero otherwise.
+	ActorID  uint
+	ClientID string
+	// Scopes is empty for tokens not limited to scopes.
+	Scopes   []string
+	APIKeyID string
+	// JKT is the thumbprint of the DPoP key the token is bound to, empty otherwise.
+	JKT       string
+	Transport string
+}
+
+// AuthError is why Authenticate rejected a request.
+type AuthError struct {
+	// Status is 401, or 403 for principals not allowed to make the request.
+	Status  int
+	Message string
+	// Challenge is the WWW-Authenticate header to answer with, if any.
+	Challenge string
+}
+
+func (e *AuthError) Error() string {
+	return e.Message
+}
+
+// unauthenticated returns the AuthError of a request that could not be authenticated.
+func unauthenticated(message string) *AuthError {
+	return &AuthError{Status: http.StatusUnauthorized, Message: message}
+}
+
+// Authenticate authenticates r by its token or API key and returns its principal.
+func (a *Authenticator) Authenticate(ctx context.Context, r *http.Request) (*Identity, *AuthError) {
+	tokenString, transport := a.tokenFromRequest(r)
+	if tokenString == "" {
+		return nil, unauthenticated("Token is required")
+	}
+	if transport == TransportAPIKey {
+		return a.authenticateKey(ctx, r, tokenString)
+	}
+
+	claims, err := Parse(tokenString)
+	if err != nil {
+		return nil, unauthenticated(err.Error())
+	}
+
+	if !a.acceptsAudience(claims.Audience) {
+		return nil, unauthenticated("Token not intended for this service")
+	}
 
-		if err != nil || !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	if err := a.checkProof(r, tokenString, transport, claims); err != nil {
+		authErr := unauthenticated(err.Error())
+		authErr.Challenge = fmt.Sprintf(`DPoP error="invalid_dpop_proof", error_description=%q`, err.Error())
+		return nil, authErr
+	}
+
+	userID, err := strconv.ParseUint(claims.Subject, 10, 64)
+	if err != nil {
+		return nil, unauthenticated("Invalid token subject")
+	}
+
+	if claims.PrincipalType == PrincipalServiceAccount {
+		return a.authenticateServiceAccount(ctx, uint(userID), *claims, transport)
+	}
+
+	var actorID uint64
+	if impersonator := claims.Actor.Impersonator(); impersonator != nil {
+		if actorID, err = strconv.ParseUint(impersonator.Subject, 10, 64); err != nil {
+			return nil, unauthenticated("Invalid token actor")
+		}
+	}
+
+	if a.checkSession != nil {
+		if claims.SessionID == "" {
+			return nil, unauthenticated("Session is required")
+		}
+		if err := a.checkSession(ctx, uint(userID), claims.SessionID); err != nil {
+			return nil, unauthenticated("Session is no longer active")
+		}
+	}
+
+	identity := &Identity{
+		PrincipalType: PrincipalUser,
+		UserID:        uint(userID),
+		Username:      claims.Username,
+		Roles:         claims.Roles,
+		SessionID:     claims.SessionID,
+		ACR:           claims.ACR,
+		AMR:           claims.AMR,
+		ActorID:       uint(actorID),
+		ClientID:      claims.ClientID,
+		Scopes:        strings.Fields(claims.Scope),
+		Transport:     transport,
+	}
+	if claims.AuthTime != nil {
+		identity.AuthTime = claims.AuthTime.Time
+	}
+	if claims.Confirmation != nil {
+		identity.JKT = claims.Confirmation.JKT
+	}
+	return identity, nil
+}
+
+// authenticateServiceAccount returns the identity of the token of a service account.
+// Service accounts have no session, their tokens are checked against the account instead.
+func (o *options) authenticateServiceAccount(ctx context.Context, id uint, claims Claims, transport string) (*Identity, *AuthError) {
+	if o.checkServiceAccount != nil {
+		if err := o.checkServiceAccount(ctx, id); err != nil {
+			return nil, unauthenticated("Service account is no longer active")
+		}
+	}
+
+	return &Identity{
+		PrincipalType:    PrincipalServiceAccount,
+		ServiceAccountID: id,
+		Username:         claims.Username,
+		Roles:            claims.Roles,
+		Transport:        transport,
+	}, nil
+}
+
+// IdentityKey is the context key of the *Identity the request was authenticated as.
+const IdentityKey = "identity"
+
+// IdentityOf returns the identity JWTAuthMiddleware authenticated the request as, nil
+// when it did not run.
+func IdentityOf(c *gin.Context) *Identity {
+	identity, _ := c.Value(IdentityKey).(*Identity)
+	return identity
+}
+
+// set stores the identity in the context as documented by JWTAuthMiddleware.
+func (id *Identity) set(c *gin.Context) {
+	c.Set(IdentityKey, id)
+	if id.PrincipalType == PrincipalServiceAccount {
+		c.Set("service_account_id", id.ServiceAccountID)
+	} else {
+		c.Set("user_id", id.UserID)
+		c.Set("sid", id.SessionID)
+	}
+	c.Set("username", id.Username)
+	c.Set("roles", id.Roles)
+	if id.PrincipalType == PrincipalUser && id.Transport != TransportAPIKey {
+		if !id.AuthTime.IsZero() {
+			c.Set("auth_time", id.AuthTime)
+		}
+		c.Set("acr", id.ACR)
+		c.Set("amr", id.AMR)
+	}
+	if id.ActorID != 0 {
+		c.Set("actor_id", id.ActorID)
+	}
+	if id.ClientID != "" {
+		c.Set("client_id", id.ClientID)
+	}
+	if len(id.Scopes) > 0 {
+		c.Set("scopes", id.Scopes)
+	}
+	if id.APIKeyID != "" {
+		c.Set("api_key_id", id.APIKeyID)
+	}
+	c.Set(PrincipalKey, id.PrincipalType)
+	c.Set(TransportKey, id.Transport)
+}
+
+// checkProof verifies that tokens bound to a key come with a DPoP proof signed by it,
+// and that tokens sent with the DPoP scheme are bound to a key.
+func (o *options) checkProof(r *http.Request, token, transport string, claims *Claims) error {
+	if o.noDPoP && (transport == TransportDPoP || claims.Confirmation != nil) {
+		return errors.New("DPoP bound tokens are not accepted")
+	}
+	if transport != TransportDPoP {
+		if claims.Confirmation != nil {
+			return errors.New("DPoP proof required")
+		}
+		return nil
+	}
+	if claims.Confirmation == nil {
+		return errors.New("Token is not bound to a key")
+	}
+
+	jkt, err := VerifyDPoPProof(r.Header.Get("DPoP"), r.Method, RequestURL(r), token, o.replay)
+	if err != nil {
+		return err
+	}
+	if jkt != claims.Confirmation.JKT {
+		return errors.New("DPoP proof signed by another key")
+	}
+	return nil
+}
+
+// acceptsAudience reports whether a token with the given audience is meant for the middleware.
+func (o *options) acceptsAudience(audience jwt.ClaimStrings) bool {
+	if o.audience == "" {
+		return len(audience) == 0
+	}
+	return slices.Contains(audience, o.audience)
+}
+
+// RequireRole rejects requests whose token does not grant role.
+// It must run after JWTAuthMiddleware.
+func RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !slices.Contains(c.GetStringSlice("roles"), role) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient role"})
 			c.Abort()
 			return
 		}
+		c.Next()
+	}
+}
 
-		claims, _ := token.Claims.(jwt.MapClaims)
-		if exp, ok := claims["exp"].(float64); ok && int64(exp) < time.Now().Unix() {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token expired"})
+// RequireScope rejects requests whose token is limited to scopes not including scope.
+// Tokens without a scope are not limited. It must run after JWTAuthMiddleware.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if scopes, limited := c.Get("scopes"); limited && !slices.Contains(scopes.([]string), scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient scope"})
 			c.Abort()
 			return
 		}
+		c.Next()
+	}
+}
 
-		c.Set("username", claims["username"])
+// RequireSessionToken rejects requests not made with a session token of the user, such
+// as API keys and tokens issued to a client or limited to scopes, for operations that
+// would grant more than they were given. It must run after JWTAuthMiddleware.
+func RequireSessionToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, scoped := c.Get("scopes")
+		if c.GetString(TransportKey) == TransportAPIKey || c.GetString("sid") == "" ||
+			c.GetString("client_id") != "" || scoped {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Session token required"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireRecentAuth rejects requests whose user did not authenticate within maxAge,
+// so sensitive operations cannot be performed with a long-lived session alone.
+// It must run after JWTAuthMiddleware.
+func RequireRecentAuth(maxAge time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authTime := c.GetTime("auth_time")
+		if authTime.IsZero() || time.Since(authTime) > maxAge {
+			insufficientAuthentication(c, "Recent authentication required",
+				fmt.Sprintf("max_age=%d", int(maxAge.Seconds())))
+			return
+		}
 		c.Next()
 	}
 }
+
+// RequireACR rejects requests whose token was not issued at the authentication
+// context class level or a higher one. It must run after JWTAuthMiddleware.
+func RequireACR(level string) gin.HandlerFunc {
+	required := slices.Index(acrLevels, level)
+	return func(c *gin.Context) {
+		if required < 0 || slices.Index(acrLevels, c.GetString("acr")) < required {
+			insufficientAuthentication(c, "Stronger authentication required",
+				fmt.Sprintf("acr_values=%q", level))
+			return
+		}
+		c.Next()
+	}
+}
+
+// insufficientAuthentication aborts with the step-up challenge of RFC 9470,
+// telling the client how the user must authenticate again.
+func insufficientAuthentication(c *gin.Context, message, param string) {
+	c.Header("WWW-Authenticate", fmt.Sprintf(
+		`Bearer error="insufficient_user_authentication", error_description=%q, %s`, message, param,
+	))
+	c.JSON(http.StatusUnauthorized, gin.H{"error": message})
+	c.Abort()
+}
@@ -0,0 +1,235 @@
+package jwttoken_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/ryanpujo/melius/internal/jwttoken"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthenticationLevel(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	auth := jwttoken.JWTAuthMiddleware()
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	router.GET("/recent", auth, jwttoken.RequireRecentAuth(5*time.Minute), ok)
+	router.GET("/mfa", auth, jwttoken.RequireACR(jwttoken.ACRMultiFactor), ok)
+
+	tableTest := map[string]struct {
+		target   string
+		authTime time.Time
+		acr      string
+		status   int
+		header   string
+	}{
+		"recent": {
+			target:   "/recent",
+			authTime: time.Now().Add(-time.Minute),
+			acr:      jwttoken.ACRSingleFactor,
+			status:   http.StatusOK,
+		},
+		"stale": {
+			target:   "/recent",
+			authTime: time.Now().Add(-time.Hour),
+			acr:      jwttoken.ACRSingleFactor,
+			status:   http.StatusUnauthorized,
+			header:   "max_age=300",
+		},
+		"no auth time": {
+			target: "/recent",
+			status: http.StatusUnauthorized,
+			header: "max_age=300",
+		},
+		"multi-factor": {
+			target:   "/mfa",
+			authTime: time.Now(),
+			acr:      jwttoken.ACRMultiFactor,
+			status:   http.StatusOK,
+		},
+		"single factor": {
+			target:   "/mfa",
+			authTime: time.Now(),
+			acr:      jwttoken.ACRSingleFactor,
+			status:   http.StatusUnauthorized,
+			header:   `acr_values="2"`,
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			claims := jwttoken.NewClaims(1, "ryanpujo")
+			if !v.authTime.IsZero() {
+				claims.Authenticated(v.authTime, v.acr, jwttoken.AMRPassword)
+			}
+			token, err := jwttoken.GenerateToken(claims)
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodGet, v.target, nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			res := httptest.NewRecorder()
+
+			router.ServeHTTP(res, req)
+
+			require.Equal(t, v.status, res.Code)
+			if v.header != "" {
+				require.Contains(t, res.Header().Get("WWW-Authenticate"), `error="insufficient_user_authentication"`)
+				require.Contains(t, res.Header().Get("WWW-Authenticate"), v.header)
+			}
+		})
+	}
+}
+
+func TestTransports(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	token, err := jwttoken.GenerateToken(jwttoken.NewClaims(1, "ryanpujo"))
+	require.NoError(t, err)
+
+	tableTest := map[string]struct {
+		opts      []jwttoken.Option
+		header    string
+		cookie    string
+		status    int
+		transport string
+	}{
+		"header only by default": {
+			cookie: token,
+			status: http.StatusUnauthorized,
+		},
+		"cookie": {
+			opts:      []jwttoken.Option{jwttoken.WithCookie("session")},
+			cookie:    token,
+			status:    http.StatusOK,
+			transport: jwttoken.TransportCookie,
+		},
+		"header before cookie": {
+			opts:      []jwttoken.Option{jwttoken.WithCookie("session")},
+			header:    token,
+			cookie:    "invalid",
+			status:    http.StatusOK,
+			transport: jwttoken.TransportHeader,
+		},
+		"cookie before header": {
+			opts:      []jwttoken.Option{jwttoken.WithCookie("session", jwttoken.TransportCookie, jwttoken.TransportHeader)},
+			header:    "invalid",
+			cookie:    token,
+			status:    http.StatusOK,
+			transport: jwttoken.TransportCookie,
+		},
+		"cookie only": {
+			opts:   []jwttoken.Option{jwttoken.WithCookie("session", jwttoken.TransportCookie)},
+			header: token,
+			status: http.StatusUnauthorized,
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			var transport string
+			router := gin.New()
+			router.GET("/", jwttoken.JWTAuthMiddleware(v.opts...), func(c *gin.Context) {
+				transport = c.GetString(jwttoken.TransportKey)
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if v.header != "" {
+				req.Header.Set("Authorization", "Bearer "+v.header)
+			}
+			if v.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: "session", Value: v.cookie})
+			}
+			res := httptest.NewRecorder()
+
+			router.ServeHTTP(res, req)
+
+			require.Equal(t, v.status, res.Code)
+			require.Equal(t, v.transport, transport)
+		})
+	}
+}
+
+func TestAudience(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	exchanged := jwttoken.NewClaims(1, "ryanpujo")
+	exchanged.Audience = jwt.ClaimStrings{"orders"}
+	exchanged.Scope = "orders:read"
+	exchanged.ClientID = "7"
+	exchanged.Actor = &jwttoken.Actor{
+		Subject:       "7",
+		PrincipalType: jwttoken.PrincipalServiceAccount,
+		Actor:         &jwttoken.Actor{Subject: "2"},
+	}
+
+	tableTest := map[string]struct {
+		opts   []jwttoken.Option
+		claims jwttoken.Claims
+		scope  string
+		status int
+	}{
+		"melius token": {
+			claims: jwttoken.NewClaims(1, "ryanpujo"),
+			status: http.StatusOK,
+		},
+		"exchanged token at melius": {
+			claims: exchanged,
+			status: http.StatusUnauthorized,
+		},
+		"exchanged token at its audience": {
+			opts:   []jwttoken.Option{jwttoken.WithAudience("orders")},
+			claims: exchanged,
+			scope:  "orders:read",
+			status: http.StatusOK,
+		},
+		"exchanged token at another audience": {
+			opts:   []jwttoken.Option{jwttoken.WithAudience("billing")},
+			claims: exchanged,
+			status: http.StatusUnauthorized,
+		},
+		"melius token at a downstream service": {
+			opts:   []jwttoken.Option{jwttoken.WithAudience("orders")},
+			claims: jwttoken.NewClaims(1, "ryanpujo"),
+			status: http.StatusUnauthorized,
+		},
+		"insufficient scope": {
+			opts:   []jwttoken.Option{jwttoken.WithAudience("orders")},
+			claims: exchanged,
+			scope:  "orders:write",
+			status: http.StatusForbidden,
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			var actorID uint
+			var clientID string
+			router := gin.New()
+			handlers := []gin.HandlerFunc{jwttoken.JWTAuthMiddleware(v.opts...)}
+			if v.scope != "" {
+				handlers = append(handlers, jwttoken.RequireScope(v.scope))
+			}
+			router.GET("/", append(handlers, func(c *gin.Context) {
+				actorID, clientID = c.GetUint("actor_id"), c.GetString("client_id")
+				c.Status(http.StatusOK)
+			})...)
+
+			token, err := jwttoken.GenerateToken(v.claims)
+			require.NoError(t, err)
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			res := httptest.NewRecorder()
+
+			router.ServeHTTP(res, req)
+
+			require.Equal(t, v.status, res.Code)
+			if v.status == http.StatusOK && v.claims.Actor != nil {
+				require.Equal(t, uint(2), actorID)
+				require.Equal(t, "7", clientID)
+			}
+		})
+	}
+}
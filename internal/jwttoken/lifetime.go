@@ -0,0 +1,48 @@
+package jwttoken
+
+import (
+	"time"
+
+	"github.com/ryanpujo/melius/config"
+)
+
+// Kinds of access tokens, whose lifetimes can be configured by TOKEN_LIFETIMES.
+const (
+	KindUser           = "user"
+	KindImpersonation  = "impersonation"
+	KindServiceAccount = "service_account"
+	KindExchange       = "exchange"
+)
+
+// defaultLifetimes are the lifetimes of the kinds of tokens when not configured.
+// Impersonation and exchanged tokens cannot be renewed and live shorter.
+var defaultLifetimes = map[string]time.Duration{
+	KindUser:           AccessTokenTTL,
+	KindImpersonation:  10 * time.Minute,
+	KindServiceAccount: AccessTokenTTL,
+	KindExchange:       5 * time.Minute,
+}
+
+// Lifetime returns the lifetime of tokens of kind, as configured or by default.
+func Lifetime(kind string) time.Duration {
+	if ttl := config.Config().TokenLifetimes[kind]; ttl > 0 {
+		return ttl
+	}
+	if ttl, ok := defaultLifetimes[kind]; ok {
+		return ttl
+	}
+	return AccessTokenTTL
+}
+
+// kind returns the kind of the token with the claims c.
+func kind(c *Claims) string {
+	switch {
+	case c.PrincipalType == PrincipalServiceAccount:
+		return KindServiceAccount
+	case c.Actor != nil && c.Actor.PrincipalType == PrincipalServiceAccount:
+		return KindExchange
+	case c.Actor != nil:
+		return KindImpersonation
+	}
+	return KindUser
+}
@@ -0,0 +1,98 @@
+package jwttoken
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"text/template"
+)
+
+// ClaimMapper returns claims to add to a token about to be signed, derived from its
+// claims, such as the claims a downstream service expects. Added claims never replace
+// the claims of melius.
+type ClaimMapper func(claims Claims) (map[string]any, error)
+
+var claimMappers []ClaimMapper
+
+// RegisterClaimMapper runs mapper on every token issued from then on. It is meant to
+// be called at startup, before any token is issued.
+func RegisterClaimMapper(mapper ClaimMapper) {
+	claimMappers = append(claimMappers, mapper)
+}
+
+// mapClaims adds the claims of the registered mappers to the Extra claims.
+func mapClaims(claims *Claims) error {
+	for _, mapper := range claimMappers {
+		extra, err := mapper(*claims)
+		if err != nil {
+			return fmt.Errorf("failed to map claims: %w", err)
+		}
+		if len(extra) == 0 {
+			continue
+		}
+		if claims.Extra == nil {
+			claims.Extra = map[string]any{}
+		}
+		maps.Copy(claims.Extra, extra)
+	}
+	return nil
+}
+
+// claimTemplateData is what claim templates are executed on.
+type claimTemplateData struct {
+	Subject    string
+	Username   string
+	Roles      []string
+	Attributes map[string]string
+	Scope      string
+}
+
+// HasRole reports whether the token grants role.
+func (d claimTemplateData) HasRole(role string) bool {
+	return slices.Contains(d.Roles, role)
+}
+
+// TemplateClaimMapper returns a ClaimMapper adding a string claim for each template,
+// by name. Templates are executed on the identity of the token and may use .Subject,
+// .Username, .Roles, .Attributes, .Scope, .HasRole and join, as in
+// {{ .Attributes.department }} or {{ if .HasRole "admin" }}staff{{ end }}.
+// Claims whose template renders empty are left out.
+func TemplateClaimMapper(templates map[string]string) (ClaimMapper, error) {
+	parsed := make(map[string]*template.Template, len(templates))
+	for name, text := range templates {
+		tmpl, err := template.New(name).
+			Option("missingkey=zero").
+			Funcs(template.FuncMap{"join": strings.Join}).
+			Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template of claim %s: %w", name, err)
+		}
+		parsed[name] = tmpl
+	}
+
+	return func(claims Claims) (map[string]any, error) {
+		data := claimTemplateData{
+			Subject:    claims.Subject,
+			Username:   claims.Username,
+			Roles:      claims.Roles,
+			Attributes: make(map[string]string, len(claims.Attributes)),
+			Scope:      claims.Scope,
+		}
+		for name, value := range claims.Attributes {
+			data.Attributes[name] = fmt.Sprint(value)
+		}
+
+		extra := map[string]any{}
+		for name, tmpl := range parsed {
+			var value strings.Builder
+			if err := tmpl.Execute(&value, data); err != nil {
+				return nil, fmt.Errorf("claim %s: %w", name, err)
+			}
+			if value.Len() > 0 {
+				extra[name] = value.String()
+			}
+		}
+		return extra, nil
+	}, nil
+}
@@ -0,0 +1,122 @@
+package jwttoken_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/ryanpujo/melius/config"
+	"github.com/ryanpujo/melius/internal/jwttoken"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegisteredClaims(t *testing.T) {
+	conf := config.Config()
+	defer func(audiences map[string][]string, lifetimes map[string]time.Duration) {
+		conf.ClientAudiences, conf.TokenLifetimes = audiences, lifetimes
+	}(conf.ClientAudiences, conf.TokenLifetimes)
+	conf.ClientAudiences = map[string][]string{"7": {"orders"}}
+	conf.TokenLifetimes = map[string]time.Duration{jwttoken.KindServiceAccount: time.Hour}
+
+	token, err := jwttoken.GenerateToken(jwttoken.NewClaims(1, "ryanpujo"))
+	require.NoError(t, err)
+	claims, err := jwttoken.Parse(token)
+	require.NoError(t, err)
+	require.Equal(t, conf.Issuer, claims.Issuer)
+	require.Equal(t, jwt.ClaimStrings{conf.Audience}, claims.Audience)
+	require.NotEmpty(t, claims.ID)
+	require.Equal(t, claims.IssuedAt, claims.NotBefore)
+	require.Equal(t, jwttoken.AccessTokenTTL, claims.ExpiresAt.Sub(claims.IssuedAt.Time))
+
+	robot := jwttoken.NewServiceAccountClaims(7, "ci")
+	robot.ClientID = "7"
+	token, err = jwttoken.GenerateToken(robot)
+	require.NoError(t, err)
+	claims, err = jwttoken.Parse(token)
+	require.NoError(t, err)
+	require.Equal(t, jwt.ClaimStrings{conf.Audience, "orders"}, claims.Audience)
+	require.Equal(t, time.Hour, claims.ExpiresAt.Sub(claims.IssuedAt.Time))
+
+	tableTest := map[string]struct {
+		claims func(claims *jwttoken.Claims)
+		err    error
+	}{
+		"within leeway": {
+			claims: func(claims *jwttoken.Claims) {
+				claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-conf.TokenLeeway / 2))
+			},
+		},
+		"expired": {
+			claims: func(claims *jwttoken.Claims) {
+				claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-conf.TokenLeeway - time.Minute))
+			},
+			err: jwttoken.ErrTokenExpired,
+		},
+		"issued in the future": {
+			claims: func(claims *jwttoken.Claims) {
+				claims.IssuedAt = jwt.NewNumericDate(time.Now().Add(conf.TokenLeeway + time.Minute))
+			},
+			err: jwttoken.ErrTokenNotValidYet,
+		},
+		"not valid yet": {
+			claims: func(claims *jwttoken.Claims) {
+				claims.NotBefore = jwt.NewNumericDate(time.Now().Add(conf.TokenLeeway + time.Minute))
+			},
+			err: jwttoken.ErrTokenNotValidYet,
+		},
+		"another issuer": {
+			claims: func(claims *jwttoken.Claims) {
+				claims.Issuer = "https://elsewhere.example"
+			},
+			err: jwttoken.ErrTokenIssuer,
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			claims := jwttoken.NewClaims(1, "ryanpujo")
+			v.claims(&claims)
+			token, err := jwttoken.GenerateToken(claims)
+			require.NoError(t, err)
+
+			_, err = jwttoken.Parse(token)
+			if v.err == nil {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorIs(t, err, v.err)
+		})
+	}
+}
+
+func TestClaimMapping(t *testing.T) {
+	_, err := jwttoken.TemplateClaimMapper(map[string]string{"broken": "{{ .Attributes"})
+	require.Error(t, err)
+
+	mapper, err := jwttoken.TemplateClaimMapper(map[string]string{
+		"department": "{{ .Attributes.department }}",
+		"staff":      `{{ if .HasRole "admin" }}yes{{ end }}`,
+		"groups":     `{{ join .Roles "," }}`,
+		"username":   "overridden",
+	})
+	require.NoError(t, err)
+	jwttoken.RegisterClaimMapper(mapper)
+
+	claims := jwttoken.NewClaims(1, "ryanpujo")
+	claims.Roles = []string{"admin", "support"}
+	claims.Attributes = map[string]any{"department": "sales"}
+	token, err := jwttoken.GenerateToken(claims)
+	require.NoError(t, err)
+
+	parsed, err := jwttoken.Parse(token)
+	require.NoError(t, err)
+	require.Equal(t, "ryanpujo", parsed.Username)
+	require.Equal(t, map[string]any{"department": "sales", "staff": "yes", "groups": "admin,support"}, parsed.Extra)
+
+	// Claims whose template renders empty are left out.
+	token, err = jwttoken.GenerateToken(jwttoken.NewClaims(2, "jane"))
+	require.NoError(t, err)
+	parsed, err = jwttoken.Parse(token)
+	require.NoError(t, err)
+	require.Nil(t, parsed.Extra)
+}
@@ -0,0 +1,49 @@
+package jwttoken
+
+import (
+	"context"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ryanpujo/melius/accesstoken"
+)
+
+// PrincipalKey is the context key of the type of principal making the request.
+const PrincipalKey = "principal_type"
+
+// Types of principals. Users are people, service accounts are machines. Requests of
+// service accounts carry service_account_id in the context instead of user_id.
+const (
+	PrincipalUser           = accesstoken.PrincipalUser
+	PrincipalServiceAccount = accesstoken.PrincipalServiceAccount
+)
+
+// ServiceAccountChecker returns an error when the service account can no longer authenticate.
+type ServiceAccountChecker func(ctx context.Context, id uint) error
+
+// WithServiceAccountChecker makes JWTAuthMiddleware reject the tokens of service accounts
+// that were disabled or deleted, so it takes effect before the tokens expire.
+func WithServiceAccountChecker(check ServiceAccountChecker) Option {
+	return func(o *options) {
+		o.checkServiceAccount = check
+	}
+}
+
+// NewServiceAccountClaims returns the claims of an access token for the given service account.
+func NewServiceAccountClaims(id uint, name string) Claims {
+	return accesstoken.NewServiceAccountClaims(id, name)
+}
+
+// RequirePrincipal rejects requests whose principal is not of one of the given types.
+// It must run after JWTAuthMiddleware.
+func RequirePrincipal(types ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !slices.Contains(types, c.GetString(PrincipalKey)) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Principal type not allowed"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,78 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"strings"
+
+	"github.com/ryanpujo/melius/config"
+)
+
+// Message is a plain-text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends email messages.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// NewMailer returns an SMTP mailer when SMTP_ADDR is configured,
+// otherwise a mailer that only writes messages to the log.
+func NewMailer() Mailer {
+	conf := config.Config()
+	if conf.SMTPAddr == "" {
+		return LogMailer{}
+	}
+	return &SMTPMailer{
+		Addr:     conf.SMTPAddr,
+		From:     conf.SMTPFrom,
+		Username: conf.SMTPUsername,
+		Password: conf.SMTPPassword,
+	}
+}
+
+// LogMailer writes messages to the standard logger. It is meant for local development.
+type LogMailer struct{}
+
+func (LogMailer) Send(ctx context.Context, msg Message) error {
+	log.Printf("mail to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// SMTPMailer delivers messages through an SMTP relay.
+type SMTPMailer struct {
+	Addr     string
+	From     string
+	Username string
+	Password string
+}
+
+func (sm *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	var auth smtp.Auth
+	if sm.Username != "" {
+		host, _, err := net.SplitHostPort(sm.Addr)
+		if err != nil {
+			return fmt.Errorf("invalid smtp address: %w", err)
+		}
+		auth = smtp.PlainAuth("", sm.Username, sm.Password, host)
+	}
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "From: %s\r\n", sm.From)
+	fmt.Fprintf(&body, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&body, "Subject: %s\r\n", msg.Subject)
+	body.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	body.WriteString(msg.Body)
+
+	if err := smtp.SendMail(sm.Addr, auth, sm.From, []string{msg.To}, []byte(body.String())); err != nil {
+		return fmt.Errorf("failed to send mail: %w", err)
+	}
+	return nil
+}
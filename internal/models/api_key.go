@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// APIKeyPrefix starts every API key so leaked keys are easy to recognize and scan for.
+const APIKeyPrefix = "mlk_"
+
+// API key scopes. Read allows safe requests, write allows state-changing requests
+// and admin lets the key act with the admin role of its owner.
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+	ScopeAdmin = "admin"
+)
+
+// APIKey is a long-lived credential a user creates for scripts and integrations.
+// Only a hash of the key is stored, the key itself is shown once at creation.
+type APIKey struct {
+	ID         string     `json:"id"`
+	UserID     uint       `json:"-"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Hash       string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// CreatedAPIKey is a newly created API key along with its secret value.
+type CreatedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+type APIKeyPayload struct {
+	Name      string     `json:"name" binding:"required,max=100"`
+	Scopes    []string   `json:"scopes" binding:"required,min=1,dive,oneof=read write admin"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type UpdateAPIKeyPayload struct {
+	Name   string   `json:"name" binding:"required,max=100"`
+	Scopes []string `json:"scopes" binding:"required,min=1,dive,oneof=read write admin"`
+}
@@ -0,0 +1,36 @@
+package models
+
+// Attribute value types.
+const (
+	AttributeString  = "string"
+	AttributeNumber  = "number"
+	AttributeBoolean = "boolean"
+)
+
+// Attribute visibilities.
+// Public attributes may be shown to anyone and can be issued as token claims,
+// private attributes are only shown to the user and administrators, and
+// admin-only attributes are only shown to and set by administrators.
+const (
+	VisibilityPublic  = "public"
+	VisibilityPrivate = "private"
+	VisibilityAdmin   = "admin"
+)
+
+// AttributeDefinition describes a custom user attribute defined by an administrator.
+type AttributeDefinition struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	Required   bool   `json:"required"`
+	Pattern    string `json:"pattern,omitempty"`
+	Visibility string `json:"visibility"`
+	Claim      bool   `json:"claim"`
+}
+
+type AttributeDefinitionPayload struct {
+	Type       string `json:"type" binding:"required,oneof=string number boolean"`
+	Required   bool   `json:"required"`
+	Pattern    string `json:"pattern"`
+	Visibility string `json:"visibility" binding:"required,oneof=public private admin"`
+	Claim      bool   `json:"claim"`
+}
@@ -0,0 +1,155 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// Audit actions.
+const (
+	AuditRegister        = "user.register"
+	AuditLogin           = "auth.login"
+	AuditLoginChallenge  = "auth.login.challenge"
+	AuditReauthenticate  = "auth.reauthenticate"
+	AuditLogout          = "auth.logout"
+	AuditPasswordChange  = "user.password.change"
+	AuditEmailChange     = "user.email.change"
+	AuditUsernameChange  = "user.username.change"
+	AuditAccountClose    = "user.account.close"
+	AuditAccountRestore  = "user.account.restore"
+	AuditAccountErase    = "user.account.erase"
+	AuditSessionRevoke   = "user.session.revoke"
+	AuditAPIKeyCreate    = "user.apikey.create"
+	AuditAPIKeyUpdate    = "user.apikey.update"
+	AuditAPIKeyDelete    = "user.apikey.delete"
+	AuditAttributesSet   = "admin.user.attributes.set"
+	AuditRoleAssign      = "admin.user.role.assign"
+	AuditRoleRevoke      = "admin.user.role.revoke"
+	AuditAttributeDefine = "admin.attribute.define"
+	AuditAttributeDelete = "admin.attribute.delete"
+	AuditPolicyDefine    = "admin.policy.define"
+	AuditPolicyDelete    = "admin.policy.delete"
+
+	AuditServiceAccountCreate           = "admin.service_account.create"
+	AuditServiceAccountUpdate           = "admin.service_account.update"
+	AuditServiceAccountDelete           = "admin.service_account.delete"
+	AuditServiceAccountRoleAssign       = "admin.service_account.role.assign"
+	AuditServiceAccountRoleRevoke       = "admin.service_account.role.revoke"
+	AuditServiceAccountCredentialCreate = "admin.service_account.credential.create"
+	AuditServiceAccountCredentialDelete = "admin.service_account.credential.delete"
+	AuditServiceAccountToken            = "auth.service_account.token"
+
+	AuditImpersonationStart = "admin.impersonation.start"
+	AuditImpersonationEnd   = "admin.impersonation.end"
+
+	AuditTokenExchange = "auth.token.exchange"
+
+	AuditDeviceApprove = "auth.device.approve"
+	AuditDeviceDeny    = "auth.device.deny"
+	AuditDeviceToken   = "auth.device.token"
+)
+
+// Audit outcomes.
+const (
+	AuditOutcomeSuccess = "success"
+	AuditOutcomeFailure = "failure"
+)
+
+// Separators of the fields covered by the audit hashes.
+const (
+	auditFieldSeparator    = "\x1f"
+	auditPersonalSeparator = "\x1e"
+)
+
+// AuditEvent is an entry of the append-only audit log.
+//
+// Entries form a hash chain: Hash covers every field of the entry and the Hash of the
+// previous entry, so altering or removing an entry breaks the chain from there on.
+// IP and UserAgent are personal data and may be erased; the chain covers them through
+// PersonalDigest, a salted digest that stays verifiable once the fields and salt are gone.
+type AuditEvent struct {
+	ID             uint64         `json:"id"`
+	OccurredAt     time.Time      `json:"occurred_at"`
+	ActorID        *uint          `json:"actor_id,omitempty"`
+	SubjectID      *uint          `json:"subject_id,omitempty"`
+	Action         string         `json:"action"`
+	Outcome        string         `json:"outcome"`
+	IP             *string        `json:"ip,omitempty"`
+	UserAgent      *string        `json:"user_agent,omitempty"`
+	RequestID      string         `json:"request_id,omitempty"`
+	Details        map[string]any `json:"details,omitempty"`
+	Salt           *string        `json:"-"`
+	PersonalDigest string         `json:"personal_digest"`
+	PrevHash       string         `json:"prev_hash"`
+	Hash           string         `json:"hash"`
+}
+
+// AuditPersonalDigest returns the digest of the personal fields of an entry.
+func AuditPersonalDigest(salt, ip, userAgent string) string {
+	sum := sha256.Sum256([]byte(salt + auditPersonalSeparator + ip + auditPersonalSeparator + userAgent))
+	return hex.EncodeToString(sum[:])
+}
+
+// ChainHash computes the hash of the entry chained to PrevHash.
+func (e *AuditEvent) ChainHash() string {
+	details := e.Details
+	if details == nil {
+		details = map[string]any{}
+	}
+	encoded, _ := json.Marshal(details)
+
+	fields := []string{
+		e.PrevHash,
+		e.OccurredAt.UTC().Format(time.RFC3339),
+		optionalID(e.ActorID),
+		optionalID(e.SubjectID),
+		e.Action,
+		e.Outcome,
+		e.RequestID,
+		string(encoded),
+		e.PersonalDigest,
+	}
+
+	h := sha256.New()
+	for _, field := range fields {
+		h.Write([]byte(field))
+		h.Write([]byte(auditFieldSeparator))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func optionalID(id *uint) string {
+	if id == nil {
+		return ""
+	}
+	return strconv.FormatUint(uint64(*id), 10)
+}
+
+// AuditQuery filters the audit log. Results are returned newest first; Cursor is the
+// NextCursor of the previous page.
+type AuditQuery struct {
+	ActorID   *uint      `form:"actor"`
+	SubjectID *uint      `form:"subject"`
+	Action    string     `form:"action"`
+	Outcome   string     `form:"outcome" binding:"omitempty,oneof=success failure"`
+	Since     *time.Time `form:"since" time_format:"2006-01-02T15:04:05Z07:00"`
+	Until     *time.Time `form:"until" time_format:"2006-01-02T15:04:05Z07:00"`
+	Cursor    uint64     `form:"cursor"`
+	Limit     int        `form:"limit" binding:"omitempty,min=1,max=500"`
+}
+
+// AuditPage is one page of audit log entries.
+type AuditPage struct {
+	Events     []AuditEvent `json:"events"`
+	NextCursor uint64       `json:"next_cursor,omitempty"`
+}
+
+// AuditVerification reports the result of checking the hash chain of the audit log.
+type AuditVerification struct {
+	Checked  int     `json:"checked"`
+	Valid    bool    `json:"valid"`
+	BrokenAt *uint64 `json:"broken_at,omitempty"`
+}
@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 type Credential struct {
 	Email    string `json:"email"`
 	Username string `json:"username"`
@@ -8,6 +10,51 @@ type Credential struct {
 
 type CredentialPayload struct {
 	Email    string `json:"email" binding:"email,required"`
-	Username string `json:"username" binding:"required"`
+	Username string `json:"username" binding:"required,excludes=@"`
 	Password string `json:"password" binding:"required"`
 }
+
+type ChangePasswordPayload struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+type ChangeEmailPayload struct {
+	Email string `json:"email" binding:"email,required"`
+}
+
+type ConfirmEmailPayload struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type CloseAccountPayload struct {
+	Password string `json:"password" binding:"required"`
+}
+
+type ChangeUsernamePayload struct {
+	Username string `json:"username" binding:"required,max=100,excludes=@"`
+}
+
+// EmailChange is a pending email change waiting to be confirmed from the new address.
+type EmailChange struct {
+	UserID    uint
+	NewEmail  string
+	TokenHash string
+	ExpiresAt time.Time
+}
+
+// Identifier kinds tracked in the identifier history.
+const (
+	IdentifierUsername = "username"
+	IdentifierEmail    = "email"
+)
+
+// IdentifierChange records a previous username or email of a user.
+// The old value cannot be claimed by another account until ReservedUntil.
+type IdentifierChange struct {
+	Kind          string    `json:"kind"`
+	OldValue      string    `json:"old_value"`
+	NewValue      string    `json:"new_value"`
+	ChangedAt     time.Time `json:"changed_at"`
+	ReservedUntil time.Time `json:"reserved_until"`
+}
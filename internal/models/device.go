@@ -0,0 +1,61 @@
+package models
+
+import "time"
+
+// Device is a browser or client a user has logged in from. Devices are recognized by
+// a long-lived random cookie, only a hash of the cookie value is stored.
+type Device struct {
+	UserID    uint      `json:"-"`
+	Hash      string    `json:"-"`
+	Name      string    `json:"name"`
+	Family    string    `json:"family"`
+	LastIP    string    `json:"last_ip"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// Risk decisions for a login with valid credentials.
+const (
+	RiskAllow  = "allow"
+	RiskStepUp = "step_up"
+	RiskBlock  = "block"
+)
+
+// Risk factors contributing to the score of a login.
+const (
+	RiskNewDevice      = "new_device"
+	RiskUnusualHour    = "unusual_hour"
+	RiskRapidIPChange  = "rapid_ip_change"
+	RiskFailedAttempts = "failed_attempts"
+)
+
+// RiskAssessment is the outcome of scoring a login.
+type RiskAssessment struct {
+	Score     int      `json:"score"`
+	Factors   []string `json:"factors"`
+	Decision  string   `json:"decision"`
+	NewDevice bool     `json:"-"`
+}
+
+// Add records a risk factor and its weight.
+func (r *RiskAssessment) Add(factor string, score int) {
+	r.Factors = append(r.Factors, factor)
+	r.Score += score
+}
+
+// LoginChallenge holds a login that must be confirmed with a one-time code
+// sent to the email address of the user.
+type LoginChallenge struct {
+	ID         string
+	UserID     uint
+	CodeHash   string
+	DeviceHash string
+	ExpiresAt  time.Time
+	Attempts   int
+}
+
+// VerifyLoginPayload completes a login held for step-up verification.
+type VerifyLoginPayload struct {
+	ChallengeID string `json:"challenge_id" binding:"required"`
+	Code        string `json:"code" binding:"required,len=6,numeric"`
+}
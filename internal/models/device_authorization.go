@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+// Statuses of a device authorization.
+const (
+	DeviceAuthorizationPending  = "pending"
+	DeviceAuthorizationApproved = "approved"
+	DeviceAuthorizationDenied   = "denied"
+)
+
+// DeviceAuthorization is a request of a device without a browser, such as a CLI, to
+// obtain a token for the user who approves its user code. The device polls with its
+// device code, of which only a hash is stored, until the user decides.
+type DeviceAuthorization struct {
+	DeviceCodeHash string     `json:"-"`
+	UserCode       string     `json:"user_code"`
+	ClientID       string     `json:"client_id"`
+	Scope          string     `json:"scope,omitempty"`
+	Status         string     `json:"status"`
+	UserID         *uint      `json:"-"`
+	Interval       int        `json:"-"`
+	CreatedAt      time.Time  `json:"created_at"`
+	ExpiresAt      time.Time  `json:"expires_at"`
+	LastPolledAt   *time.Time `json:"-"`
+}
+
+// DeviceAuthorizationRequest is a request of the device authorization endpoint, sent form encoded.
+type DeviceAuthorizationRequest struct {
+	ClientID string `form:"client_id" binding:"required"`
+	Scope    string `form:"scope"`
+}
+
+// DeviceAuthorizationResponse tells the device the codes to poll with and to show the user.
+type DeviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// DeviceDecisionPayload approves or denies the device authorization of a user code.
+type DeviceDecisionPayload struct {
+	UserCode string `json:"user_code" binding:"required"`
+	Approve  *bool  `json:"approve" binding:"required"`
+}
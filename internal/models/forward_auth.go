@@ -0,0 +1,35 @@
+package models
+
+// Headers carrying the identity of the principal to the apps behind the reverse proxy.
+const (
+	HeaderAuthUser  = "X-Auth-User"
+	HeaderAuthEmail = "X-Auth-Email"
+	HeaderAuthRoles = "X-Auth-Roles"
+	// HeaderAuthActor is the username of the administrator impersonating the user,
+	// sent only for impersonation tokens.
+	HeaderAuthActor = "X-Auth-Actor"
+)
+
+// ForwardAuthRequest is a request a reverse proxy asks forward auth about, made by an
+// authenticated principal to an app behind the proxy.
+type ForwardAuthRequest struct {
+	// Host, Proto and URI locate the request to the app, as forwarded by the proxy.
+	Host  string
+	Proto string
+	URI   string
+	// UserID is zero for service accounts.
+	UserID   uint
+	Username string
+	Roles    []string
+	// ActorID is the administrator impersonating the user, zero otherwise.
+	ActorID uint
+}
+
+// ForwardAuthIdentity is the identity the reverse proxy passes on to the app.
+type ForwardAuthIdentity struct {
+	Username string
+	Email    string
+	Roles    []string
+	// Actor is the username of the administrator impersonating the user, if any.
+	Actor string
+}
@@ -1,6 +1,18 @@
 package models
 
+// LoginPayload identifies the account by either Identifier or Username.
+// Identifier accepts a username or an email address; Username is kept for
+// clients that predate email login.
 type LoginPayload struct {
-	Username string `json:"username" binding:"required"`
-	Password string `json:"password" binding:"required"`
+	Identifier string `json:"identifier" binding:"required_without=Username"`
+	Username   string `json:"username" binding:"required_without=Identifier"`
+	Password   string `json:"password" binding:"required"`
+}
+
+// Login returns the identifier the user logs in with.
+func (lp *LoginPayload) Login() string {
+	if lp.Identifier != "" {
+		return lp.Identifier
+	}
+	return lp.Username
 }
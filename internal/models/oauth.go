@@ -0,0 +1,80 @@
+package models
+
+// Grant types accepted by the token endpoint.
+const (
+	GrantClientCredentials = "client_credentials"
+	GrantTokenExchange     = "urn:ietf:params:oauth:grant-type:token-exchange"
+	GrantDeviceCode        = "urn:ietf:params:oauth:grant-type:device_code"
+)
+
+// TokenTypeAccessToken is the token type identifier of RFC 8693 for access tokens,
+// the only type of token exchanged.
+const TokenTypeAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+
+// ClientAssertionJWTBearer is the client assertion type of RFC 7523, a JWT signed by the client.
+const ClientAssertionJWTBearer = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+// OAuth error codes of RFC 6749.
+const (
+	OAuthInvalidRequest       = "invalid_request"
+	OAuthInvalidClient        = "invalid_client"
+	OAuthInvalidGrant         = "invalid_grant"
+	OAuthUnsupportedGrantType = "unsupported_grant_type"
+	OAuthInvalidScope         = "invalid_scope"
+	OAuthInvalidTarget        = "invalid_target"
+	OAuthAccessDenied         = "access_denied"
+)
+
+// OAuthInvalidDPoPProof is the error code of RFC 9449 for an invalid DPoP proof.
+const OAuthInvalidDPoPProof = "invalid_dpop_proof"
+
+// OAuth error codes of RFC 8628, answering the polling of a device.
+const (
+	OAuthAuthorizationPending = "authorization_pending"
+	OAuthSlowDown             = "slow_down"
+	OAuthExpiredToken         = "expired_token"
+)
+
+// TokenRequest is a request of the OAuth token endpoint, sent form encoded.
+// Clients authenticate with ClientSecret, which may also be sent with HTTP Basic
+// authentication, or with a ClientAssertion. The subject token, audience and
+// scope parameters belong to the token exchange grant, the device code to the
+// device authorization grant.
+type TokenRequest struct {
+	GrantType           string `form:"grant_type" binding:"required"`
+	ClientID            string `form:"client_id"`
+	ClientSecret        string `form:"client_secret"`
+	ClientAssertionType string `form:"client_assertion_type"`
+	ClientAssertion     string `form:"client_assertion"`
+	SubjectToken        string `form:"subject_token"`
+	SubjectTokenType    string `form:"subject_token_type"`
+	RequestedTokenType  string `form:"requested_token_type"`
+	Audience            string `form:"audience"`
+	Scope               string `form:"scope"`
+	DeviceCode          string `form:"device_code"`
+	// DPoPKey is the thumbprint of the key of the verified DPoP proof of the request,
+	// to which the issued token is bound.
+	DPoPKey string `form:"-"`
+}
+
+// TokenResponse is the successful response of the token endpoint.
+type TokenResponse struct {
+	AccessToken     string `json:"access_token"`
+	IssuedTokenType string `json:"issued_token_type,omitempty"`
+	TokenType       string `json:"token_type"`
+	ExpiresIn       int    `json:"expires_in"`
+	Scope           string `json:"scope,omitempty"`
+}
+
+// OAuthError is the error response of the token endpoint.
+type OAuthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e *OAuthError) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+	return e.Code + ": " + e.Description
+}
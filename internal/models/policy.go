@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// Policy is a named authorization rule, a CEL expression evaluating to whether the
+// principal may act on the resource in the environment of the request. Expressions
+// refer to them as principal, resource and env.
+type Policy struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Expression  string    `json:"expression"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type PolicyPayload struct {
+	Description string `json:"description"`
+	Expression  string `json:"expression" binding:"required,max=10000"`
+}
+
+// PolicyPrincipal is the principal a policy is evaluated for. ID is the user ID, or
+// the service account ID for service accounts.
+type PolicyPrincipal struct {
+	Type     string
+	ID       uint
+	Username string
+	Roles    []string
+	// Scopes is empty for principals not limited to scopes.
+	Scopes   []string
+	ClientID string
+	ACR      string
+}
+
+// AuthzCheckPayload asks whether the caller may act on the resource by the named policy.
+type AuthzCheckPayload struct {
+	Policy   string         `json:"policy" binding:"required"`
+	Resource map[string]any `json:"resource"`
+}
+
+// AuthzDecision is the outcome of evaluating a policy. Reason tells why an expression
+// failed to evaluate, which denies.
+type AuthzDecision struct {
+	Policy  string `json:"policy"`
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason,omitempty"`
+}
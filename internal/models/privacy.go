@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// AccountRecord is everything stored about a user in the users and credentials tables,
+// apart from the password hash.
+type AccountRecord struct {
+	ID                  uint           `json:"id"`
+	FirstName           string         `json:"first_name"`
+	LastName            string         `json:"last_name"`
+	Username            string         `json:"username"`
+	Email               string         `json:"email"`
+	Roles               []string       `json:"roles"`
+	Attributes          map[string]any `json:"attributes"`
+	CreatedAt           *time.Time     `json:"created_at"`
+	UpdatedAt           *time.Time     `json:"updated_at"`
+	CredentialCreatedAt *time.Time     `json:"credential_created_at"`
+	CredentialUpdatedAt *time.Time     `json:"credential_updated_at"`
+}
+
+// PendingEmailChange is an email change that has been requested but not confirmed yet.
+type PendingEmailChange struct {
+	NewEmail  string     `json:"new_email"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	CreatedAt *time.Time `json:"created_at"`
+}
+
+// DataExport is the machine-readable archive of the personal data held about a user.
+// Every data source contributes one named section.
+type DataExport struct {
+	UserID      uint           `json:"user_id"`
+	GeneratedAt time.Time      `json:"generated_at"`
+	Sections    map[string]any `json:"sections"`
+}
+
+// ErasePayload confirms the erasure of the caller's own account.
+type ErasePayload struct {
+	Password string `json:"password" binding:"required"`
+}
@@ -0,0 +1,77 @@
+package models
+
+import "time"
+
+// ServiceAccountSecretPrefix starts every service account secret so leaked secrets are easy
+// to recognize and scan for.
+const ServiceAccountSecretPrefix = "mls_"
+
+// Types of the credentials of service accounts.
+const (
+	// ServiceCredentialSecret is a client secret sent with the token request.
+	ServiceCredentialSecret = "secret"
+	// ServiceCredentialPublicKey is the public half of a key pair. The service account
+	// authenticates with a JWT signed by the private key, which never leaves it.
+	ServiceCredentialPublicKey = "public_key"
+)
+
+// ServiceAccount is a non-human principal, used by machines and automation. It belongs to
+// the deployment rather than to a user, so it keeps working when its creator leaves.
+// Service accounts have no password, they authenticate with their credentials.
+// RequireDPoP makes every token of the account sender-constrained with DPoP.
+type ServiceAccount struct {
+	ID          uint      `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Roles       []string  `json:"roles"`
+	Disabled    bool      `json:"disabled"`
+	RequireDPoP bool      `json:"require_dpop"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// ServiceAccountCredential is a secret or public key a service account authenticates with.
+// Only a hash of secrets is stored, the secret itself is shown once at creation.
+type ServiceAccountCredential struct {
+	ID               string     `json:"id"`
+	ServiceAccountID uint       `json:"service_account_id"`
+	Type             string     `json:"type"`
+	Name             string     `json:"name"`
+	SecretHash       string     `json:"-"`
+	PublicKey        string     `json:"public_key,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+	ExpiresAt        *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt       *time.Time `json:"last_used_at,omitempty"`
+}
+
+// CreatedServiceAccountCredential is a newly created credential along with its secret,
+// empty for public keys.
+type CreatedServiceAccountCredential struct {
+	ServiceAccountCredential
+	Secret string `json:"secret,omitempty"`
+}
+
+type ServiceAccountPayload struct {
+	Name        string   `json:"name" binding:"required,max=100"`
+	Description string   `json:"description" binding:"max=500"`
+	Roles       []string `json:"roles" binding:"dive,required,max=50"`
+	RequireDPoP bool     `json:"require_dpop"`
+}
+
+// UpdateServiceAccountPayload holds the fields of a service account an administrator may
+// change. Nil fields are left untouched.
+type UpdateServiceAccountPayload struct {
+	Name        *string `json:"name" binding:"omitempty,min=1,max=100"`
+	Description *string `json:"description" binding:"omitempty,max=500"`
+	Disabled    *bool   `json:"disabled"`
+	RequireDPoP *bool   `json:"require_dpop"`
+}
+
+// ServiceAccountCredentialPayload creates a credential. PublicKey is a PEM encoded RSA,
+// ECDSA or Ed25519 public key and is required for public key credentials.
+type ServiceAccountCredentialPayload struct {
+	Type      string     `json:"type" binding:"required,oneof=secret public_key"`
+	Name      string     `json:"name" binding:"required,max=100"`
+	PublicKey string     `json:"public_key" binding:"required_if=Type public_key"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// Session is a login of a user on a device. Access tokens carry the session ID
+// as their sid claim and stop working as soon as the session is revoked.
+type Session struct {
+	ID         string     `json:"id"`
+	UserID     uint       `json:"-"`
+	Device     string     `json:"device"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	// ActorID is the administrator who opened the session by impersonating the user.
+	ActorID *uint `json:"actor_id,omitempty"`
+	Current bool  `json:"current,omitempty"`
+}
+
+// ReauthPayload confirms the password of the logged-in user to refresh the
+// authentication time of the current session.
+type ReauthPayload struct {
+	Password string `json:"password" binding:"required"`
+}
+
+// ImpersonatePayload records why an administrator impersonates a user, for the audit log.
+type ImpersonatePayload struct {
+	Reason string `json:"reason" binding:"required,max=500"`
+}
@@ -1,14 +1,32 @@
 package models
 
+import "time"
+
 type User struct {
-	ID         uint       `json:"id,omitempty"`
-	FirstName  string     `json:"first_name"`
-	LastName   string     `json:"last_name"`
-	Credential Credential `json:"credential"`
+	ID         uint           `json:"id,omitempty"`
+	FirstName  string         `json:"first_name"`
+	LastName   string         `json:"last_name"`
+	Roles      []string       `json:"roles,omitempty"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+	DeletedAt  *time.Time     `json:"deleted_at,omitempty"`
+	Credential Credential     `json:"credential"`
 }
 
 type UserPayload struct {
 	FirstName         string            `json:"first_name" binding:"required"`
 	LastName          string            `json:"last_name" binding:"required"`
+	Attributes        map[string]any    `json:"attributes"`
 	CredentialPayload CredentialPayload `json:"credential" binding:"required"`
 }
+
+// UpdateUserPayload holds the profile fields a user may change on their own account.
+// Nil fields are left untouched. Attributes are merged into the existing ones,
+// an attribute set to null is removed.
+type UpdateUserPayload struct {
+	FirstName  *string        `json:"first_name" binding:"omitempty,min=1,max=100"`
+	LastName   *string        `json:"last_name" binding:"omitempty,min=1,max=100"`
+	Attributes map[string]any `json:"attributes"`
+}
+
+// RoleAdmin is the role granting access to the administration endpoints.
+const RoleAdmin = "admin"
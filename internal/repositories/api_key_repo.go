@@ -0,0 +1,195 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ryanpujo/melius/internal/models"
+)
+
+// APIKeyInterface stores the API keys of users.
+type APIKeyInterface interface {
+	Create(ctx context.Context, key models.APIKey) error
+	List(ctx context.Context, userID uint) ([]models.APIKey, error)
+	Find(ctx context.Context, userID uint, id string) (*models.APIKey, error)
+	FindByHash(ctx context.Context, hash string) (*models.APIKey, error)
+	Update(ctx context.Context, userID uint, id string, payload models.UpdateAPIKeyPayload) error
+	Touch(ctx context.Context, id string) error
+	Delete(ctx context.Context, userID uint, id string) error
+	DeleteAll(ctx context.Context, userID uint) error
+}
+
+type APIKeyRepo struct {
+	dB *sql.DB
+}
+
+func NewAPIKeyRepo(db *sql.DB) *APIKeyRepo {
+	return &APIKeyRepo{
+		dB: db,
+	}
+}
+
+const selectAPIKey = `
+	SELECT id, user_id, name, prefix, key_hash, scopes, created_at, expires_at, last_used_at
+	FROM api_keys
+`
+
+// Create stores a new API key. Scopes are stored space separated.
+func (kr *APIKeyRepo) Create(ctx context.Context, key models.APIKey) error {
+	query := `
+		INSERT INTO api_keys (id, user_id, name, prefix, key_hash, scopes, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+
+	var expiresAt any
+	if key.ExpiresAt != nil {
+		expiresAt = key.ExpiresAt.Format(time.RFC3339)
+	}
+
+	_, err := kr.dB.ExecContext(ctx, query,
+		key.ID,
+		key.UserID,
+		key.Name,
+		key.Prefix,
+		key.Hash,
+		strings.Join(key.Scopes, " "),
+		key.CreatedAt.Format(time.RFC3339),
+		expiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("error creating api key: %w", err)
+	}
+	return nil
+}
+
+// List returns the API keys of the user, newest first.
+func (kr *APIKeyRepo) List(ctx context.Context, userID uint) ([]models.APIKey, error) {
+	query := selectAPIKey + `
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+	`
+
+	rows, err := kr.dB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving api keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+	return keys, rows.Err()
+}
+
+// Find retrieves the API key id of the user.
+func (kr *APIKeyRepo) Find(ctx context.Context, userID uint, id string) (*models.APIKey, error) {
+	query := selectAPIKey + `
+		WHERE id = $1 AND user_id = $2
+	`
+
+	return scanAPIKey(kr.dB.QueryRowContext(ctx, query, id, userID))
+}
+
+// FindByHash retrieves the API key with the given hash.
+func (kr *APIKeyRepo) FindByHash(ctx context.Context, hash string) (*models.APIKey, error) {
+	query := selectAPIKey + `
+		WHERE key_hash = $1
+	`
+
+	return scanAPIKey(kr.dB.QueryRowContext(ctx, query, hash))
+}
+
+// Update renames the API key id of the user and replaces its scopes.
+func (kr *APIKeyRepo) Update(ctx context.Context, userID uint, id string, payload models.UpdateAPIKeyPayload) error {
+	query := `
+		UPDATE api_keys SET name = $1, scopes = $2
+		WHERE id = $3 AND user_id = $4
+	`
+
+	res, err := kr.dB.ExecContext(ctx, query, payload.Name, strings.Join(payload.Scopes, " "), id, userID)
+	if err != nil {
+		return fmt.Errorf("error updating api key: %w", err)
+	}
+	return expectAPIKey(res, id)
+}
+
+// Touch records that the API key was just used.
+func (kr *APIKeyRepo) Touch(ctx context.Context, id string) error {
+	query := `
+		UPDATE api_keys SET last_used_at = $1 WHERE id = $2
+	`
+
+	if _, err := kr.dB.ExecContext(ctx, query, time.Now().Format(time.RFC3339), id); err != nil {
+		return fmt.Errorf("error updating api key: %w", err)
+	}
+	return nil
+}
+
+// Delete revokes the API key id of the user.
+func (kr *APIKeyRepo) Delete(ctx context.Context, userID uint, id string) error {
+	query := `
+		DELETE FROM api_keys WHERE id = $1 AND user_id = $2
+	`
+
+	res, err := kr.dB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return fmt.Errorf("error deleting api key: %w", err)
+	}
+	return expectAPIKey(res, id)
+}
+
+// DeleteAll revokes every API key of the user.
+func (kr *APIKeyRepo) DeleteAll(ctx context.Context, userID uint) error {
+	query := `
+		DELETE FROM api_keys WHERE user_id = $1
+	`
+
+	if _, err := kr.dB.ExecContext(ctx, query, userID); err != nil {
+		return fmt.Errorf("error deleting api keys: %w", err)
+	}
+	return nil
+}
+
+func scanAPIKey(row interface{ Scan(dest ...any) error }) (*models.APIKey, error) {
+	var key models.APIKey
+	var scopes string
+
+	err := row.Scan(
+		&key.ID,
+		&key.UserID,
+		&key.Name,
+		&key.Prefix,
+		&key.Hash,
+		&scopes,
+		&key.CreatedAt,
+		&key.ExpiresAt,
+		&key.LastUsedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("api key not found: %w", err)
+		}
+		return nil, fmt.Errorf("error scanning api key: %w", err)
+	}
+	key.Scopes = strings.Fields(scopes)
+	return &key, nil
+}
+
+func expectAPIKey(res sql.Result, id string) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("api key '%s' not found: %w", id, sql.ErrNoRows)
+	}
+	return nil
+}
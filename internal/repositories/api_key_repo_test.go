@@ -0,0 +1,227 @@
+package repositories_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/stretchr/testify/require"
+)
+
+var apiKeyColumns = []string{
+	"id", "user_id", "name", "prefix", "key_hash", "scopes", "created_at", "expires_at", "last_used_at",
+}
+
+func TestCreateAPIKey(t *testing.T) {
+	now := time.Now()
+	key := models.APIKey{
+		ID:        "abc",
+		UserID:    1,
+		Name:      "ci",
+		Prefix:    "mlk_abc",
+		Hash:      "hash",
+		Scopes:    []string{"read", "write"},
+		CreatedAt: now,
+	}
+
+	mock.ExpectExec("INSERT INTO api_keys").
+		WithArgs("abc", uint(1), "ci", "mlk_abc", "hash", "read write", now.Format(time.RFC3339), nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := apiKeyRepo.Create(context.Background(), key)
+
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestFindAPIKey(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	expected := &models.APIKey{
+		ID:        "abc",
+		UserID:    1,
+		Name:      "ci",
+		Prefix:    "mlk_abc",
+		Hash:      "hash",
+		Scopes:    []string{"read", "write"},
+		CreatedAt: now,
+		ExpiresAt: &now,
+	}
+	tableTest := map[string]struct {
+		arrange func()
+		act     func() (*models.APIKey, error)
+		assert  func(t *testing.T, key *models.APIKey, err error)
+	}{
+		"by id": {
+			arrange: func() {
+				mock.ExpectQuery("FROM api_keys\\s+WHERE id = \\$1 AND user_id = \\$2").
+					WithArgs("abc", 1).
+					WillReturnRows(sqlmock.NewRows(apiKeyColumns).
+						AddRow("abc", 1, "ci", "mlk_abc", "hash", "read write", now, now, nil))
+			},
+			act: func() (*models.APIKey, error) {
+				return apiKeyRepo.Find(context.Background(), 1, "abc")
+			},
+			assert: func(t *testing.T, key *models.APIKey, err error) {
+				require.NoError(t, err)
+				require.Equal(t, expected, key)
+			},
+		},
+		"by hash": {
+			arrange: func() {
+				mock.ExpectQuery("FROM api_keys\\s+WHERE key_hash = \\$1").
+					WithArgs("hash").
+					WillReturnRows(sqlmock.NewRows(apiKeyColumns).
+						AddRow("abc", 1, "ci", "mlk_abc", "hash", "read write", now, now, nil))
+			},
+			act: func() (*models.APIKey, error) {
+				return apiKeyRepo.FindByHash(context.Background(), "hash")
+			},
+			assert: func(t *testing.T, key *models.APIKey, err error) {
+				require.NoError(t, err)
+				require.Equal(t, expected, key)
+			},
+		},
+		"not found": {
+			arrange: func() {
+				mock.ExpectQuery("FROM api_keys\\s+WHERE key_hash = \\$1").
+					WithArgs("hash").
+					WillReturnError(sql.ErrNoRows)
+			},
+			act: func() (*models.APIKey, error) {
+				return apiKeyRepo.FindByHash(context.Background(), "hash")
+			},
+			assert: func(t *testing.T, key *models.APIKey, err error) {
+				require.ErrorIs(t, err, sql.ErrNoRows)
+				require.Nil(t, key)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			key, err := v.act()
+
+			v.assert(t, key, err)
+			require.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestListAPIKeys(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	mock.ExpectQuery("FROM api_keys\\s+WHERE user_id = \\$1").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(apiKeyColumns).
+			AddRow("abc", 1, "ci", "mlk_abc", "hash", "read", now, nil, now))
+
+	keys, err := apiKeyRepo.List(context.Background(), 1)
+
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	require.Equal(t, []string{"read"}, keys[0].Scopes)
+	require.Equal(t, now, *keys[0].LastUsedAt)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAPIKeyUpdates(t *testing.T) {
+	tableTest := map[string]struct {
+		arrange func()
+		act     func() error
+		assert  func(t *testing.T, err error)
+	}{
+		"update": {
+			arrange: func() {
+				mock.ExpectExec("UPDATE api_keys SET name = \\$1, scopes = \\$2").
+					WithArgs("ci", "read", "abc", 1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			act: func() error {
+				return apiKeyRepo.Update(context.Background(), 1, "abc", models.UpdateAPIKeyPayload{Name: "ci", Scopes: []string{"read"}})
+			},
+			assert: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		"update other user's key": {
+			arrange: func() {
+				mock.ExpectExec("UPDATE api_keys SET name = \\$1, scopes = \\$2").
+					WithArgs("ci", "read", "abc", 2).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			act: func() error {
+				return apiKeyRepo.Update(context.Background(), 2, "abc", models.UpdateAPIKeyPayload{Name: "ci", Scopes: []string{"read"}})
+			},
+			assert: func(t *testing.T, err error) {
+				require.ErrorIs(t, err, sql.ErrNoRows)
+			},
+		},
+		"touch": {
+			arrange: func() {
+				mock.ExpectExec("UPDATE api_keys SET last_used_at = \\$1").
+					WithArgs(sqlmock.AnyArg(), "abc").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			act: func() error {
+				return apiKeyRepo.Touch(context.Background(), "abc")
+			},
+			assert: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		"delete": {
+			arrange: func() {
+				mock.ExpectExec("DELETE FROM api_keys WHERE id = \\$1 AND user_id = \\$2").
+					WithArgs("abc", 1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			act: func() error {
+				return apiKeyRepo.Delete(context.Background(), 1, "abc")
+			},
+			assert: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		"delete missing": {
+			arrange: func() {
+				mock.ExpectExec("DELETE FROM api_keys WHERE id = \\$1 AND user_id = \\$2").
+					WithArgs("abc", 1).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			act: func() error {
+				return apiKeyRepo.Delete(context.Background(), 1, "abc")
+			},
+			assert: func(t *testing.T, err error) {
+				require.ErrorIs(t, err, sql.ErrNoRows)
+			},
+		},
+		"delete all": {
+			arrange: func() {
+				mock.ExpectExec("DELETE FROM api_keys WHERE user_id = \\$1").
+					WithArgs(1).
+					WillReturnResult(sqlmock.NewResult(0, 3))
+			},
+			act: func() error {
+				return apiKeyRepo.DeleteAll(context.Background(), 1)
+			},
+			assert: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			err := v.act()
+
+			v.assert(t, err)
+			require.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
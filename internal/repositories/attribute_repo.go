@@ -0,0 +1,105 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/ryanpujo/melius/internal/models"
+)
+
+type AttributeInterface interface {
+	List(ctx context.Context) ([]models.AttributeDefinition, error)
+	Upsert(ctx context.Context, def models.AttributeDefinition) error
+	Delete(ctx context.Context, name string) error
+}
+
+type AttributeRepo struct {
+	dB *sql.DB
+}
+
+func NewAttributeRepo(db *sql.DB) *AttributeRepo {
+	return &AttributeRepo{
+		dB: db,
+	}
+}
+
+// List returns every attribute definition ordered by name.
+func (ar *AttributeRepo) List(ctx context.Context) ([]models.AttributeDefinition, error) {
+	query := `
+		SELECT name, type, required, pattern, visibility, claim
+		FROM attribute_definitions
+		ORDER BY name
+	`
+
+	rows, err := ar.dB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving attribute definitions: %w", err)
+	}
+	defer rows.Close()
+
+	defs := []models.AttributeDefinition{}
+	for rows.Next() {
+		var def models.AttributeDefinition
+		if err := rows.Scan(
+			&def.Name,
+			&def.Type,
+			&def.Required,
+			&def.Pattern,
+			&def.Visibility,
+			&def.Claim,
+		); err != nil {
+			return nil, fmt.Errorf("error scanning attribute definition: %w", err)
+		}
+		defs = append(defs, def)
+	}
+	return defs, rows.Err()
+}
+
+// Upsert creates the attribute definition or replaces the one with the same name.
+func (ar *AttributeRepo) Upsert(ctx context.Context, def models.AttributeDefinition) error {
+	query := `
+		INSERT INTO attribute_definitions (name, type, required, pattern, visibility, claim, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (name) DO UPDATE
+		SET type = EXCLUDED.type, required = EXCLUDED.required, pattern = EXCLUDED.pattern,
+			visibility = EXCLUDED.visibility, claim = EXCLUDED.claim, updated_at = EXCLUDED.updated_at
+	`
+
+	_, err := ar.dB.ExecContext(ctx, query,
+		def.Name,
+		def.Type,
+		def.Required,
+		def.Pattern,
+		def.Visibility,
+		def.Claim,
+		time.Now().Format(time.RFC3339),
+		time.Now().Format(time.RFC3339),
+	)
+	if err != nil {
+		return fmt.Errorf("error saving attribute definition: %w", err)
+	}
+	return nil
+}
+
+// Delete removes the attribute definition. Values already stored on users are kept
+// but are no longer validated or returned.
+func (ar *AttributeRepo) Delete(ctx context.Context, name string) error {
+	query := `
+		DELETE FROM attribute_definitions WHERE name = $1
+	`
+
+	res, err := ar.dB.ExecContext(ctx, query, name)
+	if err != nil {
+		return fmt.Errorf("error deleting attribute definition: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("attribute '%s' not found: %w", name, sql.ErrNoRows)
+	}
+	return nil
+}
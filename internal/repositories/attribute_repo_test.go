@@ -0,0 +1,148 @@
+package repositories_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/stretchr/testify/require"
+)
+
+var attributeDef = models.AttributeDefinition{
+	Name:       "department",
+	Type:       models.AttributeString,
+	Required:   true,
+	Pattern:    "[a-z]+",
+	Visibility: models.VisibilityPublic,
+	Claim:      true,
+}
+
+func TestListAttributes(t *testing.T) {
+	tableTest := map[string]struct {
+		arrange func()
+		assert  func(t *testing.T, defs []models.AttributeDefinition, err error)
+	}{
+		"success": {
+			arrange: func() {
+				rows := sqlmock.NewRows([]string{"name", "type", "required", "pattern", "visibility", "claim"}).
+					AddRow(attributeDef.Name, attributeDef.Type, attributeDef.Required, attributeDef.Pattern,
+						attributeDef.Visibility, attributeDef.Claim)
+
+				mock.ExpectQuery("FROM attribute_definitions").WillReturnRows(rows)
+			},
+			assert: func(t *testing.T, defs []models.AttributeDefinition, err error) {
+				require.NoError(t, err)
+				require.Equal(t, []models.AttributeDefinition{attributeDef}, defs)
+			},
+		},
+		"query failed": {
+			arrange: func() {
+				mock.ExpectQuery("FROM attribute_definitions").WillReturnError(errors.New("failed"))
+			},
+			assert: func(t *testing.T, defs []models.AttributeDefinition, err error) {
+				require.Error(t, err)
+				require.Nil(t, defs)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			defs, err := attributeRepo.List(context.Background())
+
+			v.assert(t, defs, err)
+			err = mock.ExpectationsWereMet()
+			if err != nil {
+				t.Errorf("Unmet expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestUpsertAttribute(t *testing.T) {
+	tableTest := map[string]struct {
+		arrange func()
+		assert  func(t *testing.T, err error)
+	}{
+		"success": {
+			arrange: func() {
+				mock.ExpectExec("INSERT INTO attribute_definitions").
+					WithArgs(attributeDef.Name, attributeDef.Type, attributeDef.Required, attributeDef.Pattern,
+						attributeDef.Visibility, attributeDef.Claim, sqlmock.AnyArg(), sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			assert: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		"failed": {
+			arrange: func() {
+				mock.ExpectExec("INSERT INTO attribute_definitions").WillReturnError(errors.New("failed"))
+			},
+			assert: func(t *testing.T, err error) {
+				require.Error(t, err)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			err := attributeRepo.Upsert(context.Background(), attributeDef)
+
+			v.assert(t, err)
+			err = mock.ExpectationsWereMet()
+			if err != nil {
+				t.Errorf("Unmet expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestDeleteAttribute(t *testing.T) {
+	tableTest := map[string]struct {
+		arrange func()
+		assert  func(t *testing.T, err error)
+	}{
+		"success": {
+			arrange: func() {
+				mock.ExpectExec("DELETE FROM attribute_definitions").
+					WithArgs("department").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			assert: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		"not found": {
+			arrange: func() {
+				mock.ExpectExec("DELETE FROM attribute_definitions").
+					WithArgs("department").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			assert: func(t *testing.T, err error) {
+				require.ErrorIs(t, err, sql.ErrNoRows)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			err := attributeRepo.Delete(context.Background(), "department")
+
+			v.assert(t, err)
+			err = mock.ExpectationsWereMet()
+			if err != nil {
+				t.Errorf("Unmet expectations: %v", err)
+			}
+		})
+	}
+}
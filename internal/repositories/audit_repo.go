@@ -0,0 +1,240 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ryanpujo/melius/internal/models"
+)
+
+// AuditInterface stores the append-only audit log.
+type AuditInterface interface {
+	Append(ctx context.Context, event *models.AuditEvent) error
+	List(ctx context.Context, query models.AuditQuery) ([]models.AuditEvent, error)
+	Range(ctx context.Context, afterID uint64, limit int) ([]models.AuditEvent, error)
+	ForUser(ctx context.Context, id uint) ([]models.AuditEvent, error)
+	EraseUser(ctx context.Context, id uint) error
+	CountFailures(ctx context.Context, subjectID uint, since time.Time, actions ...string) (int, error)
+}
+
+type AuditRepo struct {
+	dB *sql.DB
+}
+
+func NewAuditRepo(db *sql.DB) *AuditRepo {
+	return &AuditRepo{
+		dB: db,
+	}
+}
+
+const selectAuditEvent = `
+	SELECT id, occurred_at, actor_id, subject_id, action, outcome, ip, user_agent,
+		request_id, details, salt, personal_digest, prev_hash, hash
+	FROM audit_log
+`
+
+// Append chains event to the last entry of the log and stores it, setting its ID,
+// PrevHash and Hash. Appends are serialized so the chain never forks.
+func (ar *AuditRepo) Append(ctx context.Context, event *models.AuditEvent) error {
+	query := `
+		INSERT INTO audit_log (
+			occurred_at, actor_id, subject_id, action, outcome, ip, user_agent,
+			request_id, details, salt, personal_digest, prev_hash, hash
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		RETURNING id
+	`
+
+	details, err := json.Marshal(event.Details)
+	if err != nil {
+		return fmt.Errorf("error encoding details: %w", err)
+	}
+	if event.Details == nil {
+		details = []byte(`{}`)
+	}
+
+	tx, err := ar.dB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext('audit_log'))`); err != nil {
+		return fmt.Errorf("error locking audit log: %w", err)
+	}
+
+	err = tx.QueryRowContext(ctx, `SELECT hash FROM audit_log ORDER BY id DESC LIMIT 1`).Scan(&event.PrevHash)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("error retrieving last audit entry: %w", err)
+	}
+	event.Hash = event.ChainHash()
+
+	err = tx.QueryRowContext(ctx, query,
+		event.OccurredAt.UTC().Format(time.RFC3339),
+		event.ActorID,
+		event.SubjectID,
+		event.Action,
+		event.Outcome,
+		event.IP,
+		event.UserAgent,
+		event.RequestID,
+		details,
+		event.Salt,
+		event.PersonalDigest,
+		event.PrevHash,
+		event.Hash,
+	).Scan(&event.ID)
+	if err != nil {
+		return fmt.Errorf("error appending audit entry: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// List returns the entries matching query, newest first.
+func (ar *AuditRepo) List(ctx context.Context, query models.AuditQuery) ([]models.AuditEvent, error) {
+	var (
+		conditions []string
+		args       []any
+	)
+	where := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if query.ActorID != nil {
+		where("actor_id = $%d", *query.ActorID)
+	}
+	if query.SubjectID != nil {
+		where("subject_id = $%d", *query.SubjectID)
+	}
+	if query.Action != "" {
+		where("action = $%d", query.Action)
+	}
+	if query.Outcome != "" {
+		where("outcome = $%d", query.Outcome)
+	}
+	if query.Since != nil {
+		where("occurred_at >= $%d", query.Since.UTC().Format(time.RFC3339))
+	}
+	if query.Until != nil {
+		where("occurred_at < $%d", query.Until.UTC().Format(time.RFC3339))
+	}
+	if query.Cursor > 0 {
+		where("id < $%d", query.Cursor)
+	}
+
+	statement := selectAuditEvent
+	if len(conditions) > 0 {
+		statement += "WHERE " + strings.Join(conditions, " AND ") + "\n"
+	}
+	args = append(args, query.Limit)
+	statement += fmt.Sprintf("ORDER BY id DESC LIMIT $%d", len(args))
+
+	return ar.query(ctx, statement, args...)
+}
+
+// Range returns up to limit entries following afterID, oldest first.
+func (ar *AuditRepo) Range(ctx context.Context, afterID uint64, limit int) ([]models.AuditEvent, error) {
+	return ar.query(ctx, selectAuditEvent+`WHERE id > $1 ORDER BY id LIMIT $2`, afterID, limit)
+}
+
+// ForUser returns every entry the user identified by id is the actor or subject of, oldest first.
+func (ar *AuditRepo) ForUser(ctx context.Context, id uint) ([]models.AuditEvent, error) {
+	return ar.query(ctx, selectAuditEvent+`WHERE actor_id = $1 OR subject_id = $1 ORDER BY id`, id)
+}
+
+// EraseUser removes the personal fields of every entry the user identified by id is the
+// actor or subject of. The entries themselves are kept and their hashes stay valid.
+func (ar *AuditRepo) EraseUser(ctx context.Context, id uint) error {
+	query := `
+		UPDATE audit_log SET ip = NULL, user_agent = NULL, salt = NULL
+		WHERE (actor_id = $1 OR subject_id = $1) AND salt IS NOT NULL
+	`
+
+	if _, err := ar.dB.ExecContext(ctx, query, id); err != nil {
+		return fmt.Errorf("error erasing audit entries: %w", err)
+	}
+	return nil
+}
+
+// CountFailures returns the number of failed entries of any of the actions about the
+// subject since the given time.
+func (ar *AuditRepo) CountFailures(ctx context.Context, subjectID uint, since time.Time, actions ...string) (int, error) {
+	args := []any{subjectID, since.UTC().Format(time.RFC3339)}
+	placeholders := make([]string, len(actions))
+	for i, action := range actions {
+		args = append(args, action)
+		placeholders[i] = fmt.Sprintf("$%d", len(args))
+	}
+	query := `
+		SELECT COUNT(*) FROM audit_log
+		WHERE subject_id = $1 AND outcome = 'failure' AND occurred_at >= $2
+		AND action IN (` + strings.Join(placeholders, ", ") + `)
+	`
+
+	var n int
+
+	err := ar.dB.QueryRowContext(ctx, query, args...).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("error counting audit entries: %w", err)
+	}
+	return n, nil
+}
+
+func (ar *AuditRepo) query(ctx context.Context, query string, args ...any) ([]models.AuditEvent, error) {
+	rows, err := ar.dB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving audit entries: %w", err)
+	}
+	defer rows.Close()
+
+	events := []models.AuditEvent{}
+	for rows.Next() {
+		var (
+			event     models.AuditEvent
+			actorID   sql.NullInt64
+			subjectID sql.NullInt64
+			details   []byte
+		)
+		err := rows.Scan(
+			&event.ID,
+			&event.OccurredAt,
+			&actorID,
+			&subjectID,
+			&event.Action,
+			&event.Outcome,
+			&event.IP,
+			&event.UserAgent,
+			&event.RequestID,
+			&details,
+			&event.Salt,
+			&event.PersonalDigest,
+			&event.PrevHash,
+			&event.Hash,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning audit entry: %w", err)
+		}
+
+		event.ActorID = nullableID(actorID)
+		event.SubjectID = nullableID(subjectID)
+		if err := json.Unmarshal(details, &event.Details); err != nil {
+			return nil, fmt.Errorf("error decoding details: %w", err)
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+func nullableID(id sql.NullInt64) *uint {
+	if !id.Valid {
+		return nil
+	}
+	v := uint(id.Int64)
+	return &v
+}
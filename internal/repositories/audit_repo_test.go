@@ -0,0 +1,151 @@
+package repositories_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/stretchr/testify/require"
+)
+
+var auditColumns = []string{
+	"id", "occurred_at", "actor_id", "subject_id", "action", "outcome", "ip", "user_agent",
+	"request_id", "details", "salt", "personal_digest", "prev_hash", "hash",
+}
+
+func TestAppendAudit(t *testing.T) {
+	subject := uint(1)
+	newEvent := func() *models.AuditEvent {
+		return &models.AuditEvent{
+			OccurredAt:     time.Now().UTC().Truncate(time.Second),
+			SubjectID:      &subject,
+			Action:         models.AuditLogin,
+			Outcome:        models.AuditOutcomeSuccess,
+			PersonalDigest: "digest",
+		}
+	}
+
+	tableTest := map[string]struct {
+		arrange func()
+		assert  func(t *testing.T, event *models.AuditEvent, err error)
+	}{
+		"chained to last entry": {
+			arrange: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec("SELECT pg_advisory_xact_lock").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery("SELECT hash FROM audit_log").
+					WillReturnRows(sqlmock.NewRows([]string{"hash"}).AddRow("previous"))
+				mock.ExpectQuery("INSERT INTO audit_log").
+					WithArgs(
+						sqlmock.AnyArg(), nil, subject, models.AuditLogin, models.AuditOutcomeSuccess, nil, nil,
+						"", []byte(`{}`), nil, "digest", "previous", sqlmock.AnyArg(),
+					).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+				mock.ExpectCommit()
+			},
+			assert: func(t *testing.T, event *models.AuditEvent, err error) {
+				require.NoError(t, err)
+				require.Equal(t, uint64(7), event.ID)
+				require.Equal(t, "previous", event.PrevHash)
+				require.Equal(t, event.ChainHash(), event.Hash)
+			},
+		},
+		"first entry": {
+			arrange: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec("SELECT pg_advisory_xact_lock").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery("SELECT hash FROM audit_log").WillReturnRows(sqlmock.NewRows([]string{"hash"}))
+				mock.ExpectQuery("INSERT INTO audit_log").
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+				mock.ExpectCommit()
+			},
+			assert: func(t *testing.T, event *models.AuditEvent, err error) {
+				require.NoError(t, err)
+				require.Empty(t, event.PrevHash)
+			},
+		},
+		"insert failed": {
+			arrange: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec("SELECT pg_advisory_xact_lock").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery("SELECT hash FROM audit_log").WillReturnRows(sqlmock.NewRows([]string{"hash"}))
+				mock.ExpectQuery("INSERT INTO audit_log").WillReturnError(sql.ErrConnDone)
+				mock.ExpectRollback()
+			},
+			assert: func(t *testing.T, event *models.AuditEvent, err error) {
+				require.ErrorIs(t, err, sql.ErrConnDone)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			event := newEvent()
+			err := auditRepo.Append(context.Background(), event)
+
+			v.assert(t, event, err)
+			err = mock.ExpectationsWereMet()
+			if err != nil {
+				t.Errorf("Unmet expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestListAudit(t *testing.T) {
+	actor := uint(1)
+	occurredAt := time.Now().UTC().Truncate(time.Second)
+
+	row := sqlmock.NewRows(auditColumns).AddRow(
+		9, occurredAt, 1, nil, models.AuditRoleAssign, models.AuditOutcomeSuccess, "203.0.113.7", nil,
+		"req-1", []byte(`{"role":"admin"}`), "salt", "digest", "prev", "hash",
+	)
+	mock.ExpectQuery(`WHERE actor_id = \$1 AND action = \$2 AND id < \$3\s+ORDER BY id DESC LIMIT \$4`).
+		WithArgs(actor, models.AuditRoleAssign, uint64(10), 20).
+		WillReturnRows(row)
+
+	events, err := auditRepo.List(context.Background(), models.AuditQuery{
+		ActorID: &actor,
+		Action:  models.AuditRoleAssign,
+		Cursor:  10,
+		Limit:   20,
+	})
+
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, uint64(9), events[0].ID)
+	require.Equal(t, actor, *events[0].ActorID)
+	require.Nil(t, events[0].SubjectID)
+	require.Equal(t, "203.0.113.7", *events[0].IP)
+	require.Equal(t, map[string]any{"role": "admin"}, events[0].Details)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestEraseAuditUser(t *testing.T) {
+	mock.ExpectExec("UPDATE audit_log SET ip = NULL, user_agent = NULL, salt = NULL").
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	err := auditRepo.EraseUser(context.Background(), 1)
+
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCountAuditFailures(t *testing.T) {
+	since := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM audit_log").
+		WithArgs(1, "2025-01-01T12:00:00Z", models.AuditLogin, models.AuditReauthenticate).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+
+	n, err := auditRepo.CountFailures(context.Background(), 1, since, models.AuditLogin, models.AuditReauthenticate)
+
+	require.NoError(t, err)
+	require.Equal(t, 3, n)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
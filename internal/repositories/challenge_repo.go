@@ -0,0 +1,100 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/ryanpujo/melius/internal/models"
+)
+
+// ChallengeInterface stores logins waiting for step-up verification.
+type ChallengeInterface interface {
+	Create(ctx context.Context, challenge models.LoginChallenge) error
+	Find(ctx context.Context, id string) (*models.LoginChallenge, error)
+	Attempt(ctx context.Context, id string) error
+	Delete(ctx context.Context, id string) error
+}
+
+type ChallengeRepo struct {
+	dB *sql.DB
+}
+
+func NewChallengeRepo(db *sql.DB) *ChallengeRepo {
+	return &ChallengeRepo{
+		dB: db,
+	}
+}
+
+// Create stores a new login challenge.
+func (cr *ChallengeRepo) Create(ctx context.Context, challenge models.LoginChallenge) error {
+	query := `
+		INSERT INTO login_challenges (id, user_id, code_hash, device_hash, expires_at, attempts, created_at)
+		VALUES ($1, $2, $3, $4, $5, 0, $6)
+	`
+
+	_, err := cr.dB.ExecContext(ctx, query,
+		challenge.ID,
+		challenge.UserID,
+		challenge.CodeHash,
+		challenge.DeviceHash,
+		challenge.ExpiresAt.Format(time.RFC3339),
+		time.Now().Format(time.RFC3339),
+	)
+	if err != nil {
+		return fmt.Errorf("error creating login challenge: %w", err)
+	}
+	return nil
+}
+
+// Find retrieves the login challenge identified by id.
+func (cr *ChallengeRepo) Find(ctx context.Context, id string) (*models.LoginChallenge, error) {
+	query := `
+		SELECT id, user_id, code_hash, device_hash, expires_at, attempts
+		FROM login_challenges
+		WHERE id = $1
+	`
+
+	var challenge models.LoginChallenge
+
+	err := cr.dB.QueryRowContext(ctx, query, id).Scan(
+		&challenge.ID,
+		&challenge.UserID,
+		&challenge.CodeHash,
+		&challenge.DeviceHash,
+		&challenge.ExpiresAt,
+		&challenge.Attempts,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("login challenge not found: %w", err)
+		}
+		return nil, fmt.Errorf("error retrieving login challenge: %w", err)
+	}
+	return &challenge, nil
+}
+
+// Attempt counts a wrong code entered for the challenge.
+func (cr *ChallengeRepo) Attempt(ctx context.Context, id string) error {
+	query := `
+		UPDATE login_challenges SET attempts = attempts + 1 WHERE id = $1
+	`
+
+	if _, err := cr.dB.ExecContext(ctx, query, id); err != nil {
+		return fmt.Errorf("error updating login challenge: %w", err)
+	}
+	return nil
+}
+
+// Delete removes the challenge once it is completed or abandoned.
+func (cr *ChallengeRepo) Delete(ctx context.Context, id string) error {
+	query := `
+		DELETE FROM login_challenges WHERE id = $1
+	`
+
+	if _, err := cr.dB.ExecContext(ctx, query, id); err != nil {
+		return fmt.Errorf("error deleting login challenge: %w", err)
+	}
+	return nil
+}
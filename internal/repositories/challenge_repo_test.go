@@ -0,0 +1,111 @@
+package repositories_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoginChallenges(t *testing.T) {
+	expiresAt := time.Now().Add(10 * time.Minute).Truncate(time.Second)
+	tableTest := map[string]struct {
+		arrange func()
+		act     func() error
+		assert  func(t *testing.T, err error)
+	}{
+		"create": {
+			arrange: func() {
+				mock.ExpectExec("INSERT INTO login_challenges").
+					WithArgs("abc", uint(1), "code", "device", expiresAt.Format(time.RFC3339), sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			act: func() error {
+				return challengeRepo.Create(context.Background(), models.LoginChallenge{
+					ID:         "abc",
+					UserID:     1,
+					CodeHash:   "code",
+					DeviceHash: "device",
+					ExpiresAt:  expiresAt,
+				})
+			},
+			assert: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		"find": {
+			arrange: func() {
+				mock.ExpectQuery("FROM login_challenges").
+					WithArgs("abc").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "code_hash", "device_hash", "expires_at", "attempts"}).
+						AddRow("abc", 1, "code", "device", expiresAt, 2))
+			},
+			act: func() error {
+				challenge, err := challengeRepo.Find(context.Background(), "abc")
+				if err == nil && challenge.Attempts != 2 {
+					return errors.New("unexpected attempts")
+				}
+				return err
+			},
+			assert: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		"not found": {
+			arrange: func() {
+				mock.ExpectQuery("FROM login_challenges").
+					WithArgs("abc").
+					WillReturnError(sql.ErrNoRows)
+			},
+			act: func() error {
+				_, err := challengeRepo.Find(context.Background(), "abc")
+				return err
+			},
+			assert: func(t *testing.T, err error) {
+				require.ErrorIs(t, err, sql.ErrNoRows)
+			},
+		},
+		"attempt": {
+			arrange: func() {
+				mock.ExpectExec("UPDATE login_challenges SET attempts = attempts \\+ 1").
+					WithArgs("abc").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			act: func() error {
+				return challengeRepo.Attempt(context.Background(), "abc")
+			},
+			assert: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		"delete": {
+			arrange: func() {
+				mock.ExpectExec("DELETE FROM login_challenges").
+					WithArgs("abc").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			act: func() error {
+				return challengeRepo.Delete(context.Background(), "abc")
+			},
+			assert: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			err := v.act()
+
+			v.assert(t, err)
+			require.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
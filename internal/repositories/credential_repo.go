@@ -3,6 +3,7 @@ package repositories
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"time"
 
@@ -12,6 +13,9 @@ import (
 type CredentialInterface interface {
 	Write(ctx context.Context, payload models.UserPayload) (uint, error)
 	FindByUsername(ctx context.Context, username string) (*models.User, error)
+	FindByEmail(ctx context.Context, email string) (*models.User, error)
+	FindClosed(ctx context.Context, login string) (*models.User, error)
+	IsReserved(ctx context.Context, kind, value string, userID uint) (bool, error)
 }
 
 type CredentialRepo struct {
@@ -35,8 +39,8 @@ func NewCredentialRepo(db *sql.DB) *CredentialRepo {
 //   - An error if the operation fails.
 func (cr *CredentialRepo) Write(ctx context.Context, payload models.UserPayload) (uint, error) {
 	userQuery := `
-		INSERT INTO users (first_name, last_name, username, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5) RETURNING id
+		INSERT INTO users (first_name, last_name, username, attributes, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id
 	`
 
 	credentialQuery := `
@@ -44,6 +48,11 @@ func (cr *CredentialRepo) Write(ctx context.Context, payload models.UserPayload)
 		VALUES ($1, $2, $3, $4, $5) RETURNING username
 	`
 
+	attributes, err := marshalAttributes(payload.Attributes)
+	if err != nil {
+		return 0, err
+	}
+
 	tx, err := cr.dB.Begin()
 	if err != nil {
 		return 0, err
@@ -69,6 +78,7 @@ func (cr *CredentialRepo) Write(ctx context.Context, payload models.UserPayload)
 		payload.FirstName,
 		payload.LastName,
 		username,
+		attributes,
 		time.Now().Format(time.RFC3339),
 		time.Now().Format(time.RFC3339),
 	).Scan(&id)
@@ -79,30 +89,123 @@ func (cr *CredentialRepo) Write(ctx context.Context, payload models.UserPayload)
 	return id, tx.Commit()
 }
 
+// selectUser selects a user together with their credential, roles and attributes.
+// Callers append the WHERE clause and scan the row with scanUser. Closed accounts
+// must be filtered out with u.deleted_at IS NULL unless they are explicitly wanted.
+const selectUser = `
+	SELECT u.id, u.first_name, u.last_name, u.attributes,
+		COALESCE((SELECT json_agg(r.role ORDER BY r.role) FROM user_roles r WHERE r.user_id = u.id), '[]'),
+		u.deleted_at, c.email, c.username, c.password
+	FROM users u
+	JOIN credentials c ON c.username = u.username
+`
+
+// FindByUsername retrieves a user by canonical username.
 func (cr *CredentialRepo) FindByUsername(ctx context.Context, username string) (*models.User, error) {
+	query := selectUser + `WHERE u.deleted_at IS NULL AND u.username = $1`
+
+	user, err := scanUser(cr.dB.QueryRowContext(ctx, query, username))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			// Return a descriptive error if no user is found
+			return nil, fmt.Errorf("user with username '%s' not found: %w", username, err)
+		}
+		// Return other database-related errors
+		return nil, fmt.Errorf("error retrieving user: %w", err)
+	}
+	return user, nil
+}
+
+// FindByEmail retrieves a user by canonical email address.
+func (cr *CredentialRepo) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	query := selectUser + `WHERE u.deleted_at IS NULL AND c.email = $1`
+
+	user, err := scanUser(cr.dB.QueryRowContext(ctx, query, email))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("user with email '%s' not found: %w", email, err)
+		}
+		return nil, fmt.Errorf("error retrieving user: %w", err)
+	}
+	return user, nil
+}
+
+// FindClosed retrieves a closed, not yet purged, account by canonical username or email.
+func (cr *CredentialRepo) FindClosed(ctx context.Context, login string) (*models.User, error) {
+	query := selectUser + `
+		WHERE u.deleted_at IS NOT NULL AND u.purged_at IS NULL AND (c.username = $1 OR c.email = $1)
+	`
+
+	user, err := scanUser(cr.dB.QueryRowContext(ctx, query, login))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("closed account '%s' not found: %w", login, err)
+		}
+		return nil, fmt.Errorf("error retrieving user: %w", err)
+	}
+	return user, nil
+}
+
+// IsReserved reports whether value was recently released by another user and is still
+// within its reservation period. Reservations held by userID itself are ignored, so a
+// user can take back their own previous username or email.
+func (cr *CredentialRepo) IsReserved(ctx context.Context, kind, value string, userID uint) (bool, error) {
 	query := `
-		SELECT u.first_name, u.last_name, c.email, c.username, c.password
-		FROM users u
-		JOIN credentials c ON c.username = u.username
-		WHERE u.username = $1
+		SELECT EXISTS (
+			SELECT 1 FROM identifier_history
+			WHERE kind = $1 AND old_value = $2 AND reserved_until > $3 AND user_id <> $4
+		)
 	`
 
-	var user models.User
+	var reserved bool
 
-	err := cr.dB.QueryRowContext(ctx, query, username).Scan(
+	err := cr.dB.QueryRowContext(ctx, query, kind, value, time.Now().Format(time.RFC3339), userID).Scan(&reserved)
+	if err != nil {
+		return false, fmt.Errorf("error checking reservation: %w", err)
+	}
+	return reserved, nil
+}
+
+// scanUser scans a row produced by selectUser.
+func scanUser(row *sql.Row) (*models.User, error) {
+	var (
+		user       models.User
+		attributes []byte
+		roles      []byte
+	)
+
+	err := row.Scan(
+		&user.ID,
 		&user.FirstName,
 		&user.LastName,
+		&attributes,
+		&roles,
+		&user.DeletedAt,
 		&user.Credential.Email,
 		&user.Credential.Username,
 		&user.Credential.Password,
 	)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			// Return a descriptive error if no user is found
-			return nil, fmt.Errorf("user with username '%s' not found: %w", username, err)
-		}
-		// Return other database-related errors
-		return nil, fmt.Errorf("error retrieving user: %w", err)
+		return nil, err
+	}
+
+	if err := json.Unmarshal(attributes, &user.Attributes); err != nil {
+		return nil, fmt.Errorf("error decoding attributes: %w", err)
+	}
+	if err := json.Unmarshal(roles, &user.Roles); err != nil {
+		return nil, fmt.Errorf("error decoding roles: %w", err)
 	}
 	return &user, nil
 }
+
+// marshalAttributes encodes attributes for a JSONB column, storing an empty object for nil.
+func marshalAttributes(attributes map[string]any) ([]byte, error) {
+	if attributes == nil {
+		attributes = map[string]any{}
+	}
+	b, err := json.Marshal(attributes)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding attributes: %w", err)
+	}
+	return b, nil
+}
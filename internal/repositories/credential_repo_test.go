@@ -7,6 +7,7 @@ import (
 	"log"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/ryanpujo/melius/internal/models"
@@ -15,10 +16,21 @@ import (
 )
 
 var (
-	db                *sql.DB
-	mock              sqlmock.Sqlmock
-	credentialRepo    *repositories.CredentialRepo
-	credentialPayload = models.CredentialPayload{
+	db                 *sql.DB
+	mock               sqlmock.Sqlmock
+	credentialRepo     *repositories.CredentialRepo
+	userRepo           *repositories.UserRepo
+	attributeRepo      *repositories.AttributeRepo
+	privacyRepo        *repositories.PrivacyRepo
+	auditRepo          *repositories.AuditRepo
+	sessionRepo        *repositories.SessionRepo
+	deviceRepo         *repositories.DeviceRepo
+	challengeRepo      *repositories.ChallengeRepo
+	apiKeyRepo         *repositories.APIKeyRepo
+	serviceAccountRepo *repositories.ServiceAccountRepo
+	deviceAuthRepo     *repositories.DeviceAuthorizationRepo
+	policyRepo         *repositories.PolicyRepo
+	credentialPayload  = models.CredentialPayload{
 		Email:    "ryanpujo@gmail.com",
 		Username: "ryanpujo",
 		Password: "okeoke",
@@ -34,10 +46,14 @@ var (
 		CredentialPayload: credentialPayload,
 	}
 	user = models.User{
+		ID:         1,
 		FirstName:  "Ryan",
 		LastName:   "Pujo",
+		Roles:      []string{"admin"},
+		Attributes: map[string]any{"department": "sales"},
 		Credential: *credential,
 	}
+	userColumns = []string{"id", "first_name", "last_name", "attributes", "roles", "deleted_at", "email", "username", "password"}
 )
 
 func TestMain(m *testing.M) {
@@ -49,6 +65,17 @@ func TestMain(m *testing.M) {
 	defer db.Close()
 
 	credentialRepo = repositories.NewCredentialRepo(db)
+	userRepo = repositories.NewUserRepo(db)
+	attributeRepo = repositories.NewAttributeRepo(db)
+	privacyRepo = repositories.NewPrivacyRepo(db)
+	auditRepo = repositories.NewAuditRepo(db)
+	sessionRepo = repositories.NewSessionRepo(db)
+	deviceRepo = repositories.NewDeviceRepo(db)
+	challengeRepo = repositories.NewChallengeRepo(db)
+	apiKeyRepo = repositories.NewAPIKeyRepo(db)
+	serviceAccountRepo = repositories.NewServiceAccountRepo(db)
+	deviceAuthRepo = repositories.NewDeviceAuthorizationRepo(db)
+	policyRepo = repositories.NewPolicyRepo(db)
 
 	os.Exit(m.Run())
 }
@@ -75,6 +102,7 @@ func TestShouldCreateUserAndCredential(t *testing.T) {
 						userPayload.FirstName,
 						userPayload.LastName,
 						userPayload.CredentialPayload.Username,
+						[]byte(`{}`),
 						sqlmock.AnyArg(),
 						sqlmock.AnyArg()).
 					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
@@ -122,6 +150,7 @@ func TestShouldCreateUserAndCredential(t *testing.T) {
 						userPayload.FirstName,
 						userPayload.LastName,
 						userPayload.CredentialPayload.Username,
+						[]byte(`{}`),
 						sqlmock.AnyArg(),
 						sqlmock.AnyArg()).
 					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("dgrg"))
@@ -164,18 +193,13 @@ func TestFindByUsername(t *testing.T) {
 	}{
 		"success": {
 			arrange: func() {
-				row := sqlmock.NewRows([]string{"first_name", "last_name", "email", "username", "password"}).
+				row := sqlmock.NewRows(userColumns).
 					AddRow(
-						user.FirstName, user.LastName, user.Credential.Email, user.Credential.Username,
-						user.Credential.Password,
+						user.ID, user.FirstName, user.LastName, []byte(`{"department":"sales"}`), []byte(`["admin"]`), nil,
+						user.Credential.Email, user.Credential.Username, user.Credential.Password,
 					)
 
-				mock.ExpectQuery(`
-					SELECT u.first_name, u.last_name, c.email, c.username, c.password
-					FROM users u
-					JOIN credentials c ON c.username = u.username
-					WHERE u.username = \$1
-				`).WithArgs(credentialPayload.Username).WillReturnRows(row)
+				mock.ExpectQuery(`WHERE u.deleted_at IS NULL AND u.username = \$1`).WithArgs(credentialPayload.Username).WillReturnRows(row)
 			},
 			assert: func(t *testing.T, actual *models.User, err error) {
 				require.NoError(t, err)
@@ -184,15 +208,10 @@ func TestFindByUsername(t *testing.T) {
 		},
 		"scan failed": {
 			arrange: func() {
-				row := sqlmock.NewRows([]string{"first_name", "last_name", "email", "username", "password"}).
+				row := sqlmock.NewRows(userColumns).
 					RowError(1, errors.New("failed to scan"))
 
-				mock.ExpectQuery(`
-					SELECT u.first_name, u.last_name, c.email, c.username, c.password
-					FROM users u
-					JOIN credentials c ON c.username = u.username
-					WHERE u.username = \$1
-				`).WithArgs(credentialPayload.Username).WillReturnRows(row)
+				mock.ExpectQuery(`WHERE u.deleted_at IS NULL AND u.username = \$1`).WithArgs(credentialPayload.Username).WillReturnRows(row)
 			},
 			assert: func(t *testing.T, actual *models.User, err error) {
 				require.Error(t, err)
@@ -215,3 +234,114 @@ func TestFindByUsername(t *testing.T) {
 		})
 	}
 }
+
+func TestIsReserved(t *testing.T) {
+	tableTest := map[string]struct {
+		arrange func()
+		assert  func(t *testing.T, reserved bool, err error)
+	}{
+		"reserved": {
+			arrange: func() {
+				mock.ExpectQuery("SELECT EXISTS").
+					WithArgs(models.IdentifierUsername, "ryanpujo", sqlmock.AnyArg(), 2).
+					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+			},
+			assert: func(t *testing.T, reserved bool, err error) {
+				require.NoError(t, err)
+				require.True(t, reserved)
+			},
+		},
+		"query failed": {
+			arrange: func() {
+				mock.ExpectQuery("SELECT EXISTS").
+					WithArgs(models.IdentifierUsername, "ryanpujo", sqlmock.AnyArg(), 2).
+					WillReturnError(errors.New("failed"))
+			},
+			assert: func(t *testing.T, reserved bool, err error) {
+				require.Error(t, err)
+				require.False(t, reserved)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			reserved, err := credentialRepo.IsReserved(context.Background(), models.IdentifierUsername, "ryanpujo", 2)
+
+			v.assert(t, reserved, err)
+			err = mock.ExpectationsWereMet()
+			if err != nil {
+				t.Errorf("Unmet expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestFindByEmail(t *testing.T) {
+	tableTest := map[string]struct {
+		arrange func()
+		assert  func(t *testing.T, actual *models.User, err error)
+	}{
+		"success": {
+			arrange: func() {
+				row := sqlmock.NewRows(userColumns).
+					AddRow(
+						user.ID, user.FirstName, user.LastName, []byte(`{"department":"sales"}`), []byte(`["admin"]`), nil,
+						user.Credential.Email, user.Credential.Username, user.Credential.Password,
+					)
+
+				mock.ExpectQuery("WHERE u.deleted_at IS NULL AND c.email = \\$1").WithArgs(credentialPayload.Email).WillReturnRows(row)
+			},
+			assert: func(t *testing.T, actual *models.User, err error) {
+				require.NoError(t, err)
+				require.Equal(t, &user, actual)
+			},
+		},
+		"not found": {
+			arrange: func() {
+				row := sqlmock.NewRows(userColumns)
+
+				mock.ExpectQuery("WHERE u.deleted_at IS NULL AND c.email = \\$1").WithArgs(credentialPayload.Email).WillReturnRows(row)
+			},
+			assert: func(t *testing.T, actual *models.User, err error) {
+				require.ErrorIs(t, err, sql.ErrNoRows)
+				require.Nil(t, actual)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			cred, err := credentialRepo.FindByEmail(context.Background(), credentialPayload.Email)
+
+			v.assert(t, cred, err)
+			err = mock.ExpectationsWereMet()
+			if err != nil {
+				t.Errorf("Unmet expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestFindClosed(t *testing.T) {
+	closedAt := time.Now().Truncate(time.Second)
+	closed := user
+	closed.DeletedAt = &closedAt
+
+	row := sqlmock.NewRows(userColumns).
+		AddRow(
+			user.ID, user.FirstName, user.LastName, []byte(`{"department":"sales"}`), []byte(`["admin"]`), closedAt,
+			user.Credential.Email, user.Credential.Username, user.Credential.Password,
+		)
+	mock.ExpectQuery(`WHERE u.deleted_at IS NOT NULL`).WithArgs(credentialPayload.Username).WillReturnRows(row)
+
+	actual, err := credentialRepo.FindClosed(context.Background(), credentialPayload.Username)
+
+	require.NoError(t, err)
+	require.Equal(t, &closed, actual)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
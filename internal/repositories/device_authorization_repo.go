@@ -0,0 +1,177 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/ryanpujo/melius/internal/models"
+)
+
+// DeviceAuthorizationInterface stores the pending authorizations of the device grant.
+type DeviceAuthorizationInterface interface {
+	Create(ctx context.Context, authorization models.DeviceAuthorization) error
+	FindByUserCode(ctx context.Context, userCode string) (*models.DeviceAuthorization, error)
+	FindByDeviceCode(ctx context.Context, hash string) (*models.DeviceAuthorization, error)
+	Decide(ctx context.Context, userCode string, userID uint, status string) error
+	Poll(ctx context.Context, hash string, interval int) error
+	Delete(ctx context.Context, hash string) error
+	DeleteExpired(ctx context.Context) (int64, error)
+}
+
+type DeviceAuthorizationRepo struct {
+	dB *sql.DB
+}
+
+func NewDeviceAuthorizationRepo(db *sql.DB) *DeviceAuthorizationRepo {
+	return &DeviceAuthorizationRepo{
+		dB: db,
+	}
+}
+
+const selectDeviceAuthorization = `
+	SELECT device_code_hash, user_code, client_id, scope, status, user_id, poll_interval,
+		created_at, expires_at, last_polled_at
+	FROM device_authorizations
+`
+
+// Create stores a new pending device authorization.
+func (dr *DeviceAuthorizationRepo) Create(ctx context.Context, authorization models.DeviceAuthorization) error {
+	query := `
+		INSERT INTO device_authorizations
+			(device_code_hash, user_code, client_id, scope, status, poll_interval, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+
+	_, err := dr.dB.ExecContext(ctx, query,
+		authorization.DeviceCodeHash,
+		authorization.UserCode,
+		authorization.ClientID,
+		authorization.Scope,
+		authorization.Status,
+		authorization.Interval,
+		authorization.CreatedAt.Format(time.RFC3339),
+		authorization.ExpiresAt.Format(time.RFC3339),
+	)
+	if err != nil {
+		return fmt.Errorf("error creating device authorization: %w", err)
+	}
+	return nil
+}
+
+// FindByUserCode retrieves the device authorization shown to the user as userCode.
+func (dr *DeviceAuthorizationRepo) FindByUserCode(ctx context.Context, userCode string) (*models.DeviceAuthorization, error) {
+	query := selectDeviceAuthorization + `
+		WHERE user_code = $1
+	`
+
+	return scanDeviceAuthorization(dr.dB.QueryRowContext(ctx, query, userCode))
+}
+
+// FindByDeviceCode retrieves the device authorization whose device code has the given hash.
+func (dr *DeviceAuthorizationRepo) FindByDeviceCode(ctx context.Context, hash string) (*models.DeviceAuthorization, error) {
+	query := selectDeviceAuthorization + `
+		WHERE device_code_hash = $1
+	`
+
+	return scanDeviceAuthorization(dr.dB.QueryRowContext(ctx, query, hash))
+}
+
+// Decide records the decision of the user on the device authorization of userCode.
+// It returns sql.ErrNoRows when the authorization is unknown, already decided or expired.
+func (dr *DeviceAuthorizationRepo) Decide(ctx context.Context, userCode string, userID uint, status string) error {
+	query := `
+		UPDATE device_authorizations SET status = $1, user_id = $2
+		WHERE user_code = $3 AND status = $4 AND expires_at > $5
+	`
+
+	res, err := dr.dB.ExecContext(ctx, query,
+		status, userID, userCode, models.DeviceAuthorizationPending, time.Now().Format(time.RFC3339),
+	)
+	if err != nil {
+		return fmt.Errorf("error updating device authorization: %w", err)
+	}
+	return expectDeviceAuthorization(res)
+}
+
+// Poll records that the device just polled, and the interval it must now wait between polls.
+func (dr *DeviceAuthorizationRepo) Poll(ctx context.Context, hash string, interval int) error {
+	query := `
+		UPDATE device_authorizations SET last_polled_at = $1, poll_interval = $2
+		WHERE device_code_hash = $3
+	`
+
+	res, err := dr.dB.ExecContext(ctx, query, time.Now().Format(time.RFC3339), interval, hash)
+	if err != nil {
+		return fmt.Errorf("error updating device authorization: %w", err)
+	}
+	return expectDeviceAuthorization(res)
+}
+
+// Delete removes the device authorization once its token was issued or it was denied.
+// It returns sql.ErrNoRows when it was already removed, so a token is issued only once.
+func (dr *DeviceAuthorizationRepo) Delete(ctx context.Context, hash string) error {
+	query := `
+		DELETE FROM device_authorizations WHERE device_code_hash = $1
+	`
+
+	res, err := dr.dB.ExecContext(ctx, query, hash)
+	if err != nil {
+		return fmt.Errorf("error deleting device authorization: %w", err)
+	}
+	return expectDeviceAuthorization(res)
+}
+
+// DeleteExpired removes the device authorizations that expired unused and returns how many.
+func (dr *DeviceAuthorizationRepo) DeleteExpired(ctx context.Context) (int64, error) {
+	query := `
+		DELETE FROM device_authorizations WHERE expires_at <= $1
+	`
+
+	res, err := dr.dB.ExecContext(ctx, query, time.Now().Format(time.RFC3339))
+	if err != nil {
+		return 0, fmt.Errorf("error deleting expired device authorizations: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+func scanDeviceAuthorization(row interface{ Scan(dest ...any) error }) (*models.DeviceAuthorization, error) {
+	var authorization models.DeviceAuthorization
+	var userID sql.NullInt64
+
+	err := row.Scan(
+		&authorization.DeviceCodeHash,
+		&authorization.UserCode,
+		&authorization.ClientID,
+		&authorization.Scope,
+		&authorization.Status,
+		&userID,
+		&authorization.Interval,
+		&authorization.CreatedAt,
+		&authorization.ExpiresAt,
+		&authorization.LastPolledAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("device authorization not found: %w", err)
+		}
+		return nil, fmt.Errorf("error scanning device authorization: %w", err)
+	}
+	if userID.Valid {
+		id := uint(userID.Int64)
+		authorization.UserID = &id
+	}
+	return &authorization, nil
+}
+
+func expectDeviceAuthorization(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("device authorization not found: %w", sql.ErrNoRows)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package repositories_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/stretchr/testify/require"
+)
+
+var deviceAuthorizationColumns = []string{
+	"device_code_hash", "user_code", "client_id", "scope", "status", "user_id", "poll_interval",
+	"created_at", "expires_at", "last_polled_at",
+}
+
+func TestFindDeviceAuthorization(t *testing.T) {
+	now := time.Now()
+
+	tableTest := map[string]struct {
+		arrange func()
+		assert  func(t *testing.T, authorization *models.DeviceAuthorization, err error)
+	}{
+		"approved": {
+			arrange: func() {
+				mock.ExpectQuery("SELECT (.+) FROM device_authorizations").
+					WithArgs("hash").
+					WillReturnRows(sqlmock.NewRows(deviceAuthorizationColumns).
+						AddRow("hash", "BCDFGHJK", "melius-cli", "", models.DeviceAuthorizationApproved, 1, 5, now, now.Add(time.Minute), now))
+			},
+			assert: func(t *testing.T, authorization *models.DeviceAuthorization, err error) {
+				require.NoError(t, err)
+				require.Equal(t, models.DeviceAuthorizationApproved, authorization.Status)
+				require.Equal(t, uint(1), *authorization.UserID)
+				require.Equal(t, 5, authorization.Interval)
+				require.NotNil(t, authorization.LastPolledAt)
+			},
+		},
+		"pending": {
+			arrange: func() {
+				mock.ExpectQuery("SELECT (.+) FROM device_authorizations").
+					WithArgs("hash").
+					WillReturnRows(sqlmock.NewRows(deviceAuthorizationColumns).
+						AddRow("hash", "BCDFGHJK", "melius-cli", "read", models.DeviceAuthorizationPending, nil, 5, now, now.Add(time.Minute), nil))
+			},
+			assert: func(t *testing.T, authorization *models.DeviceAuthorization, err error) {
+				require.NoError(t, err)
+				require.Nil(t, authorization.UserID)
+				require.Nil(t, authorization.LastPolledAt)
+			},
+		},
+		"not found": {
+			arrange: func() {
+				mock.ExpectQuery("SELECT (.+) FROM device_authorizations").
+					WithArgs("hash").
+					WillReturnError(sql.ErrNoRows)
+			},
+			assert: func(t *testing.T, authorization *models.DeviceAuthorization, err error) {
+				require.ErrorIs(t, err, sql.ErrNoRows)
+				require.Nil(t, authorization)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			authorization, err := deviceAuthRepo.FindByDeviceCode(context.Background(), "hash")
+
+			v.assert(t, authorization, err)
+			require.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestDecideDeviceAuthorization(t *testing.T) {
+	mock.ExpectExec("UPDATE device_authorizations SET status = \\$1, user_id = \\$2").
+		WithArgs(models.DeviceAuthorizationApproved, 1, "BCDFGHJK", models.DeviceAuthorizationPending, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	require.NoError(t, deviceAuthRepo.Decide(context.Background(), "BCDFGHJK", 1, models.DeviceAuthorizationApproved))
+
+	mock.ExpectExec("UPDATE device_authorizations SET status = \\$1, user_id = \\$2").
+		WithArgs(models.DeviceAuthorizationDenied, 1, "BCDFGHJK", models.DeviceAuthorizationPending, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	require.ErrorIs(t, deviceAuthRepo.Decide(context.Background(), "BCDFGHJK", 1, models.DeviceAuthorizationDenied), sql.ErrNoRows)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeleteDeviceAuthorization(t *testing.T) {
+	mock.ExpectExec("DELETE FROM device_authorizations WHERE device_code_hash").
+		WithArgs("hash").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	require.ErrorIs(t, deviceAuthRepo.Delete(context.Background(), "hash"), sql.ErrNoRows)
+
+	mock.ExpectExec("DELETE FROM device_authorizations WHERE expires_at").
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	n, err := deviceAuthRepo.DeleteExpired(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, int64(3), n)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,97 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/ryanpujo/melius/internal/models"
+)
+
+// DeviceInterface stores the devices users have logged in from.
+type DeviceInterface interface {
+	List(ctx context.Context, userID uint) ([]models.Device, error)
+	Upsert(ctx context.Context, device models.Device) error
+	DeleteAll(ctx context.Context, userID uint) error
+}
+
+type DeviceRepo struct {
+	dB *sql.DB
+}
+
+func NewDeviceRepo(db *sql.DB) *DeviceRepo {
+	return &DeviceRepo{
+		dB: db,
+	}
+}
+
+// List returns the known devices of the user, most recently seen first.
+func (dr *DeviceRepo) List(ctx context.Context, userID uint) ([]models.Device, error) {
+	query := `
+		SELECT user_id, device_hash, name, family, last_ip, first_seen, last_seen
+		FROM devices
+		WHERE user_id = $1
+		ORDER BY last_seen DESC
+	`
+
+	rows, err := dr.dB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving devices: %w", err)
+	}
+	defer rows.Close()
+
+	devices := []models.Device{}
+	for rows.Next() {
+		var device models.Device
+		err := rows.Scan(
+			&device.UserID,
+			&device.Hash,
+			&device.Name,
+			&device.Family,
+			&device.LastIP,
+			&device.FirstSeen,
+			&device.LastSeen,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning device: %w", err)
+		}
+		devices = append(devices, device)
+	}
+	return devices, rows.Err()
+}
+
+// Upsert records a login from the device, adding it when it is new.
+func (dr *DeviceRepo) Upsert(ctx context.Context, device models.Device) error {
+	query := `
+		INSERT INTO devices (user_id, device_hash, name, family, last_ip, first_seen, last_seen)
+		VALUES ($1, $2, $3, $4, $5, $6, $6)
+		ON CONFLICT (user_id, device_hash)
+		DO UPDATE SET name = EXCLUDED.name, family = EXCLUDED.family, last_ip = EXCLUDED.last_ip, last_seen = EXCLUDED.last_seen
+	`
+
+	_, err := dr.dB.ExecContext(ctx, query,
+		device.UserID,
+		device.Hash,
+		device.Name,
+		device.Family,
+		device.LastIP,
+		device.LastSeen.Format(time.RFC3339),
+	)
+	if err != nil {
+		return fmt.Errorf("error recording device: %w", err)
+	}
+	return nil
+}
+
+// DeleteAll forgets every device of the user.
+func (dr *DeviceRepo) DeleteAll(ctx context.Context, userID uint) error {
+	query := `
+		DELETE FROM devices WHERE user_id = $1
+	`
+
+	if _, err := dr.dB.ExecContext(ctx, query, userID); err != nil {
+		return fmt.Errorf("error deleting devices: %w", err)
+	}
+	return nil
+}
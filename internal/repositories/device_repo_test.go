@@ -0,0 +1,71 @@
+package repositories_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/stretchr/testify/require"
+)
+
+var deviceColumns = []string{
+	"user_id", "device_hash", "name", "family", "last_ip", "first_seen", "last_seen",
+}
+
+func TestListDevices(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	rows := sqlmock.NewRows(deviceColumns).
+		AddRow(1, "hash", "Firefox on Linux", "Firefox", "203.0.113.7", now, now)
+
+	mock.ExpectQuery("FROM devices").
+		WithArgs(1).
+		WillReturnRows(rows)
+
+	devices, err := deviceRepo.List(context.Background(), 1)
+
+	require.NoError(t, err)
+	require.Equal(t, []models.Device{{
+		UserID:    1,
+		Hash:      "hash",
+		Name:      "Firefox on Linux",
+		Family:    "Firefox",
+		LastIP:    "203.0.113.7",
+		FirstSeen: now,
+		LastSeen:  now,
+	}}, devices)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpsertDevice(t *testing.T) {
+	now := time.Now()
+	device := models.Device{
+		UserID:   1,
+		Hash:     "hash",
+		Name:     "Firefox on Linux",
+		Family:   "Firefox",
+		LastIP:   "203.0.113.7",
+		LastSeen: now,
+	}
+
+	mock.ExpectExec("INSERT INTO devices .* ON CONFLICT \\(user_id, device_hash\\)").
+		WithArgs(uint(1), "hash", "Firefox on Linux", "Firefox", "203.0.113.7", now.Format(time.RFC3339)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := deviceRepo.Upsert(context.Background(), device)
+
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeleteDevices(t *testing.T) {
+	mock.ExpectExec("DELETE FROM devices WHERE user_id = \\$1").
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	err := deviceRepo.DeleteAll(context.Background(), 1)
+
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,97 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/ryanpujo/melius/internal/models"
+)
+
+type PolicyInterface interface {
+	List(ctx context.Context) ([]models.Policy, error)
+	Upsert(ctx context.Context, policy models.Policy) error
+	Delete(ctx context.Context, name string) error
+}
+
+type PolicyRepo struct {
+	dB *sql.DB
+}
+
+func NewPolicyRepo(db *sql.DB) *PolicyRepo {
+	return &PolicyRepo{
+		dB: db,
+	}
+}
+
+// List returns every policy ordered by name.
+func (pr *PolicyRepo) List(ctx context.Context) ([]models.Policy, error) {
+	query := `
+		SELECT name, description, expression, updated_at
+		FROM policies
+		ORDER BY name
+	`
+
+	rows, err := pr.dB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving policies: %w", err)
+	}
+	defer rows.Close()
+
+	policies := []models.Policy{}
+	for rows.Next() {
+		var policy models.Policy
+		if err := rows.Scan(
+			&policy.Name,
+			&policy.Description,
+			&policy.Expression,
+			&policy.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("error scanning policy: %w", err)
+		}
+		policies = append(policies, policy)
+	}
+	return policies, rows.Err()
+}
+
+// Upsert creates the policy or replaces the one with the same name.
+func (pr *PolicyRepo) Upsert(ctx context.Context, policy models.Policy) error {
+	query := `
+		INSERT INTO policies (name, description, expression, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $4)
+		ON CONFLICT (name) DO UPDATE
+		SET description = EXCLUDED.description, expression = EXCLUDED.expression, updated_at = EXCLUDED.updated_at
+	`
+
+	_, err := pr.dB.ExecContext(ctx, query,
+		policy.Name,
+		policy.Description,
+		policy.Expression,
+		policy.UpdatedAt.Format(time.RFC3339),
+	)
+	if err != nil {
+		return fmt.Errorf("error saving policy: %w", err)
+	}
+	return nil
+}
+
+// Delete removes the policy. Routes requiring it deny every request from then on.
+func (pr *PolicyRepo) Delete(ctx context.Context, name string) error {
+	query := `
+		DELETE FROM policies WHERE name = $1
+	`
+
+	res, err := pr.dB.ExecContext(ctx, query, name)
+	if err != nil {
+		return fmt.Errorf("error deleting policy: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("policy '%s' not found: %w", name, sql.ErrNoRows)
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package repositories_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/stretchr/testify/require"
+)
+
+var policy = models.Policy{
+	Name:        "business-hours",
+	Description: "sales staff during business hours",
+	Expression:  `principal.attributes.department == "sales" && env.time.getHours("UTC") >= 9`,
+	UpdatedAt:   time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+}
+
+func TestListPolicies(t *testing.T) {
+	tableTest := map[string]struct {
+		arrange func()
+		assert  func(t *testing.T, policies []models.Policy, err error)
+	}{
+		"success": {
+			arrange: func() {
+				rows := sqlmock.NewRows([]string{"name", "description", "expression", "updated_at"}).
+					AddRow(policy.Name, policy.Description, policy.Expression, policy.UpdatedAt)
+
+				mock.ExpectQuery("FROM policies").WillReturnRows(rows)
+			},
+			assert: func(t *testing.T, policies []models.Policy, err error) {
+				require.NoError(t, err)
+				require.Equal(t, []models.Policy{policy}, policies)
+			},
+		},
+		"query failed": {
+			arrange: func() {
+				mock.ExpectQuery("FROM policies").WillReturnError(errors.New("failed"))
+			},
+			assert: func(t *testing.T, policies []models.Policy, err error) {
+				require.Error(t, err)
+				require.Nil(t, policies)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			policies, err := policyRepo.List(context.Background())
+
+			v.assert(t, policies, err)
+			err = mock.ExpectationsWereMet()
+			if err != nil {
+				t.Errorf("Unmet expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestUpsertPolicy(t *testing.T) {
+	tableTest := map[string]struct {
+		arrange func()
+		assert  func(t *testing.T, err error)
+	}{
+		"success": {
+			arrange: func() {
+				mock.ExpectExec("INSERT INTO policies").
+					WithArgs(policy.Name, policy.Description, policy.Expression, policy.UpdatedAt.Format(time.RFC3339)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			assert: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		"failed": {
+			arrange: func() {
+				mock.ExpectExec("INSERT INTO policies").WillReturnError(errors.New("failed"))
+			},
+			assert: func(t *testing.T, err error) {
+				require.Error(t, err)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			err := policyRepo.Upsert(context.Background(), policy)
+
+			v.assert(t, err)
+			err = mock.ExpectationsWereMet()
+			if err != nil {
+				t.Errorf("Unmet expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestDeletePolicy(t *testing.T) {
+	tableTest := map[string]struct {
+		arrange func()
+		assert  func(t *testing.T, err error)
+	}{
+		"success": {
+			arrange: func() {
+				mock.ExpectExec("DELETE FROM policies").
+					WithArgs(policy.Name).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			assert: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		"not found": {
+			arrange: func() {
+				mock.ExpectExec("DELETE FROM policies").
+					WithArgs(policy.Name).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			assert: func(t *testing.T, err error) {
+				require.ErrorIs(t, err, sql.ErrNoRows)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			err := policyRepo.Delete(context.Background(), policy.Name)
+
+			v.assert(t, err)
+			err = mock.ExpectationsWereMet()
+			if err != nil {
+				t.Errorf("Unmet expectations: %v", err)
+			}
+		})
+	}
+}
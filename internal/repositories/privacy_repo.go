@@ -0,0 +1,91 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ryanpujo/melius/internal/models"
+)
+
+// PrivacyInterface reads the raw personal data of a user for data subject requests.
+type PrivacyInterface interface {
+	Account(ctx context.Context, id uint) (*models.AccountRecord, error)
+	PendingEmailChange(ctx context.Context, id uint) (*models.PendingEmailChange, error)
+}
+
+type PrivacyRepo struct {
+	dB *sql.DB
+}
+
+func NewPrivacyRepo(db *sql.DB) *PrivacyRepo {
+	return &PrivacyRepo{
+		dB: db,
+	}
+}
+
+// Account retrieves the account of the user identified by id, including closed accounts
+// that are not purged yet.
+func (pr *PrivacyRepo) Account(ctx context.Context, id uint) (*models.AccountRecord, error) {
+	query := `
+		SELECT u.id, u.first_name, u.last_name, c.username, c.email,
+			COALESCE((SELECT json_agg(r.role ORDER BY r.role) FROM user_roles r WHERE r.user_id = u.id), '[]'),
+			u.attributes, u.created_at, u.updated_at, c.created_at, c.updated_at
+		FROM users u
+		JOIN credentials c ON c.username = u.username
+		WHERE u.id = $1 AND u.purged_at IS NULL
+	`
+
+	var (
+		account    models.AccountRecord
+		roles      []byte
+		attributes []byte
+	)
+
+	err := pr.dB.QueryRowContext(ctx, query, id).Scan(
+		&account.ID,
+		&account.FirstName,
+		&account.LastName,
+		&account.Username,
+		&account.Email,
+		&roles,
+		&attributes,
+		&account.CreatedAt,
+		&account.UpdatedAt,
+		&account.CredentialCreatedAt,
+		&account.CredentialUpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("user with id %d not found: %w", id, err)
+		}
+		return nil, fmt.Errorf("error retrieving account: %w", err)
+	}
+
+	if err := json.Unmarshal(roles, &account.Roles); err != nil {
+		return nil, fmt.Errorf("error decoding roles: %w", err)
+	}
+	if err := json.Unmarshal(attributes, &account.Attributes); err != nil {
+		return nil, fmt.Errorf("error decoding attributes: %w", err)
+	}
+	return &account, nil
+}
+
+// PendingEmailChange retrieves the unconfirmed email change of the user, or nil if there is none.
+func (pr *PrivacyRepo) PendingEmailChange(ctx context.Context, id uint) (*models.PendingEmailChange, error) {
+	query := `
+		SELECT new_email, expires_at, created_at FROM email_changes WHERE user_id = $1
+	`
+
+	var change models.PendingEmailChange
+
+	err := pr.dB.QueryRowContext(ctx, query, id).Scan(&change.NewEmail, &change.ExpiresAt, &change.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error retrieving email change: %w", err)
+	}
+	return &change, nil
+}
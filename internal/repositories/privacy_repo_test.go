@@ -0,0 +1,117 @@
+package repositories_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccount(t *testing.T) {
+	createdAt := time.Now().Truncate(time.Second)
+	columns := []string{
+		"id", "first_name", "last_name", "username", "email", "roles", "attributes",
+		"created_at", "updated_at", "credential_created_at", "credential_updated_at",
+	}
+
+	tableTest := map[string]struct {
+		arrange func()
+		assert  func(t *testing.T, actual *models.AccountRecord, err error)
+	}{
+		"success": {
+			arrange: func() {
+				row := sqlmock.NewRows(columns).AddRow(
+					1, "Ryan", "Pujo", "ryanpujo", "ryanpujo@gmail.com", []byte(`["admin"]`), []byte(`{"department":"sales"}`),
+					createdAt, nil, createdAt, nil,
+				)
+
+				mock.ExpectQuery(`WHERE u.id = \$1 AND u.purged_at IS NULL`).WithArgs(1).WillReturnRows(row)
+			},
+			assert: func(t *testing.T, actual *models.AccountRecord, err error) {
+				require.NoError(t, err)
+				require.Equal(t, &models.AccountRecord{
+					ID:                  1,
+					FirstName:           "Ryan",
+					LastName:            "Pujo",
+					Username:            "ryanpujo",
+					Email:               "ryanpujo@gmail.com",
+					Roles:               []string{"admin"},
+					Attributes:          map[string]any{"department": "sales"},
+					CreatedAt:           &createdAt,
+					CredentialCreatedAt: &createdAt,
+				}, actual)
+			},
+		},
+		"not found": {
+			arrange: func() {
+				mock.ExpectQuery(`WHERE u.id = \$1 AND u.purged_at IS NULL`).WithArgs(1).WillReturnRows(sqlmock.NewRows(columns))
+			},
+			assert: func(t *testing.T, actual *models.AccountRecord, err error) {
+				require.ErrorIs(t, err, sql.ErrNoRows)
+				require.Nil(t, actual)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			actual, err := privacyRepo.Account(context.Background(), 1)
+
+			v.assert(t, actual, err)
+			err = mock.ExpectationsWereMet()
+			if err != nil {
+				t.Errorf("Unmet expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestPendingEmailChange(t *testing.T) {
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	columns := []string{"new_email", "expires_at", "created_at"}
+
+	tableTest := map[string]struct {
+		arrange func()
+		assert  func(t *testing.T, actual *models.PendingEmailChange, err error)
+	}{
+		"pending": {
+			arrange: func() {
+				mock.ExpectQuery("FROM email_changes").WithArgs(1).
+					WillReturnRows(sqlmock.NewRows(columns).AddRow("ryan@pujo.dev", expiresAt, nil))
+			},
+			assert: func(t *testing.T, actual *models.PendingEmailChange, err error) {
+				require.NoError(t, err)
+				require.Equal(t, &models.PendingEmailChange{NewEmail: "ryan@pujo.dev", ExpiresAt: expiresAt}, actual)
+			},
+		},
+		"none": {
+			arrange: func() {
+				mock.ExpectQuery("FROM email_changes").WithArgs(1).WillReturnRows(sqlmock.NewRows(columns))
+			},
+			assert: func(t *testing.T, actual *models.PendingEmailChange, err error) {
+				require.NoError(t, err)
+				require.Nil(t, actual)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			actual, err := privacyRepo.PendingEmailChange(context.Background(), 1)
+
+			v.assert(t, actual, err)
+			err = mock.ExpectationsWereMet()
+			if err != nil {
+				t.Errorf("Unmet expectations: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,349 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ryanpujo/melius/internal/models"
+)
+
+// ServiceAccountInterface stores service accounts, their roles and their credentials.
+type ServiceAccountInterface interface {
+	Create(ctx context.Context, payload models.ServiceAccountPayload) (uint, error)
+	List(ctx context.Context) ([]models.ServiceAccount, error)
+	FindByID(ctx context.Context, id uint) (*models.ServiceAccount, error)
+	Update(ctx context.Context, id uint, payload models.UpdateServiceAccountPayload) error
+	Delete(ctx context.Context, id uint) error
+	AddRole(ctx context.Context, id uint, role string) error
+	RemoveRole(ctx context.Context, id uint, role string) error
+	CreateCredential(ctx context.Context, credential models.ServiceAccountCredential) error
+	ListCredentials(ctx context.Context, id uint) ([]models.ServiceAccountCredential, error)
+	FindCredentialByHash(ctx context.Context, hash string) (*models.ServiceAccountCredential, error)
+	TouchCredential(ctx context.Context, credentialID string) error
+	DeleteCredential(ctx context.Context, id uint, credentialID string) error
+}
+
+type ServiceAccountRepo struct {
+	dB *sql.DB
+}
+
+func NewServiceAccountRepo(db *sql.DB) *ServiceAccountRepo {
+	return &ServiceAccountRepo{
+		dB: db,
+	}
+}
+
+// selectServiceAccount selects a service account together with its roles.
+const selectServiceAccount = `
+	SELECT s.id, s.name, s.description,
+		COALESCE((SELECT json_agg(r.role ORDER BY r.role) FROM service_account_roles r WHERE r.service_account_id = s.id), '[]'),
+		s.disabled, s.require_dpop, s.created_at, s.updated_at
+	FROM service_accounts s
+`
+
+const selectServiceAccountCredential = `
+	SELECT id, service_account_id, type, name, COALESCE(secret_hash, ''), COALESCE(public_key, ''),
+		created_at, expires_at, last_used_at
+	FROM service_account_credentials
+`
+
+// Create inserts a service account and its roles in a transaction and returns its ID.
+func (sr *ServiceAccountRepo) Create(ctx context.Context, payload models.ServiceAccountPayload) (uint, error) {
+	accountQuery := `
+		INSERT INTO service_accounts (name, description, require_dpop, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5) RETURNING id
+	`
+	roleQuery := `
+		INSERT INTO service_account_roles (service_account_id, role) VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`
+
+	tx, err := sr.dB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var id uint
+
+	err = tx.QueryRowContext(ctx, accountQuery,
+		payload.Name,
+		payload.Description,
+		payload.RequireDPoP,
+		time.Now().Format(time.RFC3339),
+		time.Now().Format(time.RFC3339),
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("error creating service account: %w", err)
+	}
+
+	for _, role := range payload.Roles {
+		if _, err := tx.ExecContext(ctx, roleQuery, id, role); err != nil {
+			return 0, fmt.Errorf("error adding role: %w", err)
+		}
+	}
+
+	return id, tx.Commit()
+}
+
+// List returns every service account ordered by name.
+func (sr *ServiceAccountRepo) List(ctx context.Context) ([]models.ServiceAccount, error) {
+	query := selectServiceAccount + `ORDER BY s.name`
+
+	rows, err := sr.dB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving service accounts: %w", err)
+	}
+	defer rows.Close()
+
+	accounts := []models.ServiceAccount{}
+	for rows.Next() {
+		account, err := scanServiceAccount(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning service account: %w", err)
+		}
+		accounts = append(accounts, *account)
+	}
+	return accounts, rows.Err()
+}
+
+// FindByID retrieves the service account identified by id.
+func (sr *ServiceAccountRepo) FindByID(ctx context.Context, id uint) (*models.ServiceAccount, error) {
+	query := selectServiceAccount + `WHERE s.id = $1`
+
+	account, err := scanServiceAccount(sr.dB.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("service account with id '%d' not found: %w", id, err)
+		}
+		return nil, fmt.Errorf("error retrieving service account: %w", err)
+	}
+	return account, nil
+}
+
+// Update changes the fields of the service account identified by id.
+// Nil fields in the payload keep their current value.
+func (sr *ServiceAccountRepo) Update(ctx context.Context, id uint, payload models.UpdateServiceAccountPayload) error {
+	query := `
+		UPDATE service_accounts
+		SET name = COALESCE($1, name), description = COALESCE($2, description),
+			disabled = COALESCE($3, disabled), require_dpop = COALESCE($4, require_dpop), updated_at = $5
+		WHERE id = $6
+	`
+
+	res, err := sr.dB.ExecContext(ctx, query,
+		payload.Name,
+		payload.Description,
+		payload.Disabled,
+		payload.RequireDPoP,
+		time.Now().Format(time.RFC3339),
+		id,
+	)
+	if err != nil {
+		return fmt.Errorf("error updating service account: %w", err)
+	}
+	return expectServiceAccount(res, id)
+}
+
+// Delete removes the service account identified by id along with its roles and credentials.
+func (sr *ServiceAccountRepo) Delete(ctx context.Context, id uint) error {
+	query := `
+		DELETE FROM service_accounts WHERE id = $1
+	`
+
+	res, err := sr.dB.ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("error deleting service account: %w", err)
+	}
+	return expectServiceAccount(res, id)
+}
+
+// AddRole grants role to the service account identified by id. Granting a role twice is a no-op.
+func (sr *ServiceAccountRepo) AddRole(ctx context.Context, id uint, role string) error {
+	query := `
+		INSERT INTO service_account_roles (service_account_id, role) VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`
+
+	if _, err := sr.dB.ExecContext(ctx, query, id, role); err != nil {
+		return fmt.Errorf("error adding role: %w", err)
+	}
+	return nil
+}
+
+// RemoveRole revokes role from the service account identified by id.
+func (sr *ServiceAccountRepo) RemoveRole(ctx context.Context, id uint, role string) error {
+	query := `
+		DELETE FROM service_account_roles WHERE service_account_id = $1 AND role = $2
+	`
+
+	if _, err := sr.dB.ExecContext(ctx, query, id, role); err != nil {
+		return fmt.Errorf("error removing role: %w", err)
+	}
+	return nil
+}
+
+// CreateCredential stores a new credential of a service account.
+func (sr *ServiceAccountRepo) CreateCredential(ctx context.Context, credential models.ServiceAccountCredential) error {
+	query := `
+		INSERT INTO service_account_credentials
+			(id, service_account_id, type, name, secret_hash, public_key, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+
+	var expiresAt any
+	if credential.ExpiresAt != nil {
+		expiresAt = credential.ExpiresAt.Format(time.RFC3339)
+	}
+
+	_, err := sr.dB.ExecContext(ctx, query,
+		credential.ID,
+		credential.ServiceAccountID,
+		credential.Type,
+		credential.Name,
+		nullString(credential.SecretHash),
+		nullString(credential.PublicKey),
+		credential.CreatedAt.Format(time.RFC3339),
+		expiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("error creating service account credential: %w", err)
+	}
+	return nil
+}
+
+// ListCredentials returns the credentials of the service account identified by id, newest first.
+func (sr *ServiceAccountRepo) ListCredentials(ctx context.Context, id uint) ([]models.ServiceAccountCredential, error) {
+	query := selectServiceAccountCredential + `
+		WHERE service_account_id = $1
+		ORDER BY created_at DESC
+	`
+
+	rows, err := sr.dB.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving service account credentials: %w", err)
+	}
+	defer rows.Close()
+
+	credentials := []models.ServiceAccountCredential{}
+	for rows.Next() {
+		credential, err := scanServiceAccountCredential(rows)
+		if err != nil {
+			return nil, err
+		}
+		credentials = append(credentials, *credential)
+	}
+	return credentials, rows.Err()
+}
+
+// FindCredentialByHash retrieves the secret credential with the given hash.
+func (sr *ServiceAccountRepo) FindCredentialByHash(ctx context.Context, hash string) (*models.ServiceAccountCredential, error) {
+	query := selectServiceAccountCredential + `
+		WHERE secret_hash = $1
+	`
+
+	return scanServiceAccountCredential(sr.dB.QueryRowContext(ctx, query, hash))
+}
+
+// TouchCredential records that the credential was just used.
+func (sr *ServiceAccountRepo) TouchCredential(ctx context.Context, credentialID string) error {
+	query := `
+		UPDATE service_account_credentials SET last_used_at = $1 WHERE id = $2
+	`
+
+	if _, err := sr.dB.ExecContext(ctx, query, time.Now().Format(time.RFC3339), credentialID); err != nil {
+		return fmt.Errorf("error updating service account credential: %w", err)
+	}
+	return nil
+}
+
+// DeleteCredential revokes the credential credentialID of the service account identified by id.
+func (sr *ServiceAccountRepo) DeleteCredential(ctx context.Context, id uint, credentialID string) error {
+	query := `
+		DELETE FROM service_account_credentials WHERE id = $1 AND service_account_id = $2
+	`
+
+	res, err := sr.dB.ExecContext(ctx, query, credentialID, id)
+	if err != nil {
+		return fmt.Errorf("error deleting service account credential: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("service account credential '%s' not found: %w", credentialID, sql.ErrNoRows)
+	}
+	return nil
+}
+
+func scanServiceAccount(row interface{ Scan(dest ...any) error }) (*models.ServiceAccount, error) {
+	var (
+		account models.ServiceAccount
+		roles   []byte
+	)
+
+	err := row.Scan(
+		&account.ID,
+		&account.Name,
+		&account.Description,
+		&roles,
+		&account.Disabled,
+		&account.RequireDPoP,
+		&account.CreatedAt,
+		&account.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(roles, &account.Roles); err != nil {
+		return nil, fmt.Errorf("error decoding roles: %w", err)
+	}
+	return &account, nil
+}
+
+func scanServiceAccountCredential(row interface{ Scan(dest ...any) error }) (*models.ServiceAccountCredential, error) {
+	var credential models.ServiceAccountCredential
+
+	err := row.Scan(
+		&credential.ID,
+		&credential.ServiceAccountID,
+		&credential.Type,
+		&credential.Name,
+		&credential.SecretHash,
+		&credential.PublicKey,
+		&credential.CreatedAt,
+		&credential.ExpiresAt,
+		&credential.LastUsedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("service account credential not found: %w", err)
+		}
+		return nil, fmt.Errorf("error scanning service account credential: %w", err)
+	}
+	return &credential, nil
+}
+
+func expectServiceAccount(res sql.Result, id uint) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("service account with id '%d' not found: %w", id, sql.ErrNoRows)
+	}
+	return nil
+}
+
+// nullString stores empty strings as NULL, for unique columns that are only set on some rows.
+func nullString(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
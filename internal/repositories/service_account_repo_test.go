@@ -0,0 +1,154 @@
+package repositories_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	serviceAccountColumns    = []string{"id", "name", "description", "roles", "disabled", "require_dpop", "created_at", "updated_at"}
+	serviceCredentialColumns = []string{
+		"id", "service_account_id", "type", "name", "secret_hash", "public_key", "created_at", "expires_at", "last_used_at",
+	}
+)
+
+func TestCreateServiceAccount(t *testing.T) {
+	payload := models.ServiceAccountPayload{Name: "ci", Description: "deployments", Roles: []string{"deployer", "reader"}, RequireDPoP: true}
+
+	tableTest := map[string]struct {
+		arrange func()
+		assert  func(t *testing.T, id uint, err error)
+	}{
+		"success": {
+			arrange: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery("INSERT INTO service_accounts").
+					WithArgs("ci", "deployments", true, sqlmock.AnyArg(), sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+				mock.ExpectExec("INSERT INTO service_account_roles").
+					WithArgs(1, "deployer").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("INSERT INTO service_account_roles").
+					WithArgs(1, "reader").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			assert: func(t *testing.T, id uint, err error) {
+				require.NoError(t, err)
+				require.Equal(t, uint(1), id)
+			},
+		},
+		"duplicate name": {
+			arrange: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery("INSERT INTO service_accounts").
+					WillReturnError(errors.New("duplicate key"))
+				mock.ExpectRollback()
+			},
+			assert: func(t *testing.T, id uint, err error) {
+				require.Error(t, err)
+				require.Zero(t, id)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			id, err := serviceAccountRepo.Create(context.Background(), payload)
+
+			v.assert(t, id, err)
+			require.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestFindServiceAccount(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+
+	mock.ExpectQuery("FROM service_accounts s WHERE s.id = \\$1").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(serviceAccountColumns).
+			AddRow(1, "ci", "deployments", []byte(`["deployer"]`), false, true, now, now))
+
+	account, err := serviceAccountRepo.FindByID(context.Background(), 1)
+
+	require.NoError(t, err)
+	require.Equal(t, &models.ServiceAccount{
+		ID:          1,
+		Name:        "ci",
+		Description: "deployments",
+		Roles:       []string{"deployer"},
+		RequireDPoP: true,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}, account)
+
+	mock.ExpectQuery("FROM service_accounts s WHERE s.id = \\$1").
+		WithArgs(2).
+		WillReturnError(sql.ErrNoRows)
+
+	_, err = serviceAccountRepo.FindByID(context.Background(), 2)
+
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestServiceAccountCredentials(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	secret := models.ServiceAccountCredential{
+		ID:               "abc",
+		ServiceAccountID: 1,
+		Type:             models.ServiceCredentialSecret,
+		Name:             "ci",
+		SecretHash:       "hash",
+		CreatedAt:        now,
+	}
+
+	// The public key column of a secret credential is left NULL.
+	mock.ExpectExec("INSERT INTO service_account_credentials").
+		WithArgs("abc", uint(1), "secret", "ci", "hash", nil, now.Format(time.RFC3339), nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, serviceAccountRepo.CreateCredential(context.Background(), secret))
+
+	mock.ExpectQuery("FROM service_account_credentials\\s+WHERE secret_hash = \\$1").
+		WithArgs("hash").
+		WillReturnRows(sqlmock.NewRows(serviceCredentialColumns).
+			AddRow("abc", 1, "secret", "ci", "hash", "", now, nil, nil))
+
+	found, err := serviceAccountRepo.FindCredentialByHash(context.Background(), "hash")
+
+	require.NoError(t, err)
+	require.Equal(t, &secret, found)
+
+	mock.ExpectExec("DELETE FROM service_account_credentials").
+		WithArgs("other", 1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err = serviceAccountRepo.DeleteCredential(context.Background(), 1, "other")
+
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateServiceAccount(t *testing.T) {
+	disabled := true
+
+	mock.ExpectExec("UPDATE service_accounts").
+		WithArgs(nil, nil, &disabled, nil, sqlmock.AnyArg(), 1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err := serviceAccountRepo.Update(context.Background(), 1, models.UpdateServiceAccountPayload{Disabled: &disabled})
+
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
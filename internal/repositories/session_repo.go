@@ -0,0 +1,212 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/ryanpujo/melius/internal/models"
+)
+
+// SessionInterface stores the login sessions of users.
+type SessionInterface interface {
+	Create(ctx context.Context, session models.Session) error
+	Active(ctx context.Context, userID uint) ([]models.Session, error)
+	History(ctx context.Context, userID uint, limit int) ([]models.Session, error)
+	FindActive(ctx context.Context, userID uint, id string) (*models.Session, error)
+	Touch(ctx context.Context, userID uint, id string) error
+	Extend(ctx context.Context, userID uint, id string, expiresAt time.Time) error
+	Revoke(ctx context.Context, userID uint, id string) error
+	RevokeAll(ctx context.Context, userID uint) error
+	DeleteAll(ctx context.Context, userID uint) error
+}
+
+type SessionRepo struct {
+	dB *sql.DB
+}
+
+func NewSessionRepo(db *sql.DB) *SessionRepo {
+	return &SessionRepo{
+		dB: db,
+	}
+}
+
+const selectSession = `
+	SELECT id, user_id, device, user_agent, ip, created_at, last_seen_at, expires_at, revoked_at, actor_id
+	FROM sessions
+`
+
+// Create stores a new session.
+func (sr *SessionRepo) Create(ctx context.Context, session models.Session) error {
+	query := `
+		INSERT INTO sessions (id, user_id, device, user_agent, ip, created_at, last_seen_at, expires_at, actor_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $6, $7, $8)
+	`
+
+	_, err := sr.dB.ExecContext(ctx, query,
+		session.ID,
+		session.UserID,
+		session.Device,
+		session.UserAgent,
+		session.IP,
+		session.CreatedAt.Format(time.RFC3339),
+		session.ExpiresAt.Format(time.RFC3339),
+		session.ActorID,
+	)
+	if err != nil {
+		return fmt.Errorf("error creating session: %w", err)
+	}
+	return nil
+}
+
+// Active returns the sessions of the user that are neither revoked nor expired, most recently used first.
+func (sr *SessionRepo) Active(ctx context.Context, userID uint) ([]models.Session, error) {
+	query := selectSession + `
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > $2
+		ORDER BY last_seen_at DESC
+	`
+
+	return sr.query(ctx, query, userID, time.Now().Format(time.RFC3339))
+}
+
+// History returns the last limit sessions of the user, including revoked and expired ones,
+// newest first. A limit of 0 returns every session.
+func (sr *SessionRepo) History(ctx context.Context, userID uint, limit int) ([]models.Session, error) {
+	query := selectSession + `
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+		LIMIT NULLIF($2::int, 0)
+	`
+
+	return sr.query(ctx, query, userID, limit)
+}
+
+// FindActive returns the session id of the user. It returns sql.ErrNoRows when the
+// session does not belong to the user, is revoked or has expired.
+func (sr *SessionRepo) FindActive(ctx context.Context, userID uint, id string) (*models.Session, error) {
+	query := selectSession + `
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL AND expires_at > $3
+	`
+
+	sessions, err := sr.query(ctx, query, id, userID, time.Now().Format(time.RFC3339))
+	if err != nil {
+		return nil, err
+	}
+	if len(sessions) == 0 {
+		return nil, fmt.Errorf("session '%s' not found: %w", id, sql.ErrNoRows)
+	}
+	return &sessions[0], nil
+}
+
+// Touch records that the session was just used. It returns sql.ErrNoRows when the
+// session does not belong to the user, is revoked or has expired.
+func (sr *SessionRepo) Touch(ctx context.Context, userID uint, id string) error {
+	query := `
+		UPDATE sessions SET last_seen_at = $1
+		WHERE id = $2 AND user_id = $3 AND revoked_at IS NULL AND expires_at > $1
+	`
+
+	res, err := sr.dB.ExecContext(ctx, query, time.Now().Format(time.RFC3339), id, userID)
+	if err != nil {
+		return fmt.Errorf("error updating session: %w", err)
+	}
+	return expectSession(res, id)
+}
+
+// Extend moves the expiry of an active session of the user after it was authenticated again.
+// It returns sql.ErrNoRows when the session does not belong to the user, is revoked or has expired.
+func (sr *SessionRepo) Extend(ctx context.Context, userID uint, id string, expiresAt time.Time) error {
+	query := `
+		UPDATE sessions SET last_seen_at = $1, expires_at = $2
+		WHERE id = $3 AND user_id = $4 AND revoked_at IS NULL AND expires_at > $1
+	`
+
+	res, err := sr.dB.ExecContext(ctx, query, time.Now().Format(time.RFC3339), expiresAt.Format(time.RFC3339), id, userID)
+	if err != nil {
+		return fmt.Errorf("error updating session: %w", err)
+	}
+	return expectSession(res, id)
+}
+
+// Revoke ends the session of the user. It returns sql.ErrNoRows when the user
+// has no active session with that id.
+func (sr *SessionRepo) Revoke(ctx context.Context, userID uint, id string) error {
+	query := `
+		UPDATE sessions SET revoked_at = $1
+		WHERE id = $2 AND user_id = $3 AND revoked_at IS NULL
+	`
+
+	res, err := sr.dB.ExecContext(ctx, query, time.Now().Format(time.RFC3339), id, userID)
+	if err != nil {
+		return fmt.Errorf("error revoking session: %w", err)
+	}
+	return expectSession(res, id)
+}
+
+// RevokeAll ends every active session of the user, keeping the login history.
+func (sr *SessionRepo) RevokeAll(ctx context.Context, userID uint) error {
+	query := `
+		UPDATE sessions SET revoked_at = $1
+		WHERE user_id = $2 AND revoked_at IS NULL
+	`
+
+	if _, err := sr.dB.ExecContext(ctx, query, time.Now().Format(time.RFC3339), userID); err != nil {
+		return fmt.Errorf("error revoking sessions: %w", err)
+	}
+	return nil
+}
+
+// DeleteAll removes every session of the user, ending them and erasing the login history.
+func (sr *SessionRepo) DeleteAll(ctx context.Context, userID uint) error {
+	query := `
+		DELETE FROM sessions WHERE user_id = $1
+	`
+
+	if _, err := sr.dB.ExecContext(ctx, query, userID); err != nil {
+		return fmt.Errorf("error deleting sessions: %w", err)
+	}
+	return nil
+}
+
+// expectSession reports sql.ErrNoRows when an update matched no active session.
+func expectSession(res sql.Result, id string) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("session '%s' not found: %w", id, sql.ErrNoRows)
+	}
+	return nil
+}
+
+func (sr *SessionRepo) query(ctx context.Context, query string, args ...any) ([]models.Session, error) {
+	rows, err := sr.dB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []models.Session{}
+	for rows.Next() {
+		var session models.Session
+		err := rows.Scan(
+			&session.ID,
+			&session.UserID,
+			&session.Device,
+			&session.UserAgent,
+			&session.IP,
+			&session.CreatedAt,
+			&session.LastSeenAt,
+			&session.ExpiresAt,
+			&session.RevokedAt,
+			&session.ActorID,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning session: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
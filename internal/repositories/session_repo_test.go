@@ -0,0 +1,204 @@
+package repositories_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/stretchr/testify/require"
+)
+
+var sessionColumns = []string{
+	"id", "user_id", "device", "user_agent", "ip", "created_at", "last_seen_at", "expires_at", "revoked_at", "actor_id",
+}
+
+func TestCreateSession(t *testing.T) {
+	now := time.Now()
+	session := models.Session{
+		ID:        "abc",
+		UserID:    1,
+		Device:    "Firefox on Linux",
+		UserAgent: "Mozilla/5.0",
+		IP:        "203.0.113.7",
+		CreatedAt: now,
+		ExpiresAt: now.Add(15 * time.Minute),
+	}
+
+	mock.ExpectExec("INSERT INTO sessions").
+		WithArgs("abc", uint(1), "Firefox on Linux", "Mozilla/5.0", "203.0.113.7",
+			now.Format(time.RFC3339), session.ExpiresAt.Format(time.RFC3339), nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := sessionRepo.Create(context.Background(), session)
+
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestActiveSessions(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	rows := sqlmock.NewRows(sessionColumns).
+		AddRow("abc", 1, "Firefox on Linux", "Mozilla/5.0", "203.0.113.7", now, now, now.Add(time.Minute), nil, nil)
+
+	mock.ExpectQuery("WHERE user_id = \\$1 AND revoked_at IS NULL AND expires_at > \\$2").
+		WithArgs(1, sqlmock.AnyArg()).
+		WillReturnRows(rows)
+
+	sessions, err := sessionRepo.Active(context.Background(), 1)
+
+	require.NoError(t, err)
+	require.Equal(t, []models.Session{{
+		ID:         "abc",
+		UserID:     1,
+		Device:     "Firefox on Linux",
+		UserAgent:  "Mozilla/5.0",
+		IP:         "203.0.113.7",
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(time.Minute),
+	}}, sessions)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestFindActiveSession(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	query := "WHERE id = \\$1 AND user_id = \\$2 AND revoked_at IS NULL AND expires_at > \\$3"
+
+	mock.ExpectQuery(query).
+		WithArgs("abc", 1, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows(sessionColumns).
+			AddRow("abc", 1, "Firefox on Linux", "Mozilla/5.0", "203.0.113.7", now, now, now.Add(time.Minute), nil, nil))
+
+	session, err := sessionRepo.FindActive(context.Background(), 1, "abc")
+
+	require.NoError(t, err)
+	require.Equal(t, "abc", session.ID)
+	require.Equal(t, now, session.LastSeenAt)
+
+	mock.ExpectQuery(query).
+		WithArgs("abc", 1, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows(sessionColumns))
+
+	session, err = sessionRepo.FindActive(context.Background(), 1, "abc")
+
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	require.Nil(t, session)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSessionUpdates(t *testing.T) {
+	tableTest := map[string]struct {
+		arrange func()
+		act     func() error
+		assert  func(t *testing.T, err error)
+	}{
+		"touch": {
+			arrange: func() {
+				mock.ExpectExec("UPDATE sessions SET last_seen_at").
+					WithArgs(sqlmock.AnyArg(), "abc", 1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			act: func() error {
+				return sessionRepo.Touch(context.Background(), 1, "abc")
+			},
+			assert: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		"touch revoked": {
+			arrange: func() {
+				mock.ExpectExec("UPDATE sessions SET last_seen_at").
+					WithArgs(sqlmock.AnyArg(), "abc", 1).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			act: func() error {
+				return sessionRepo.Touch(context.Background(), 1, "abc")
+			},
+			assert: func(t *testing.T, err error) {
+				require.ErrorIs(t, err, sql.ErrNoRows)
+			},
+		},
+		"extend": {
+			arrange: func() {
+				mock.ExpectExec("UPDATE sessions SET last_seen_at = \\$1, expires_at = \\$2").
+					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), "abc", 1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			act: func() error {
+				return sessionRepo.Extend(context.Background(), 1, "abc", time.Now().Add(time.Minute))
+			},
+			assert: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		"extend revoked": {
+			arrange: func() {
+				mock.ExpectExec("UPDATE sessions SET last_seen_at = \\$1, expires_at = \\$2").
+					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), "abc", 1).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			act: func() error {
+				return sessionRepo.Extend(context.Background(), 1, "abc", time.Now().Add(time.Minute))
+			},
+			assert: func(t *testing.T, err error) {
+				require.ErrorIs(t, err, sql.ErrNoRows)
+			},
+		},
+		"revoke": {
+			arrange: func() {
+				mock.ExpectExec("UPDATE sessions SET revoked_at").
+					WithArgs(sqlmock.AnyArg(), "abc", 1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			act: func() error {
+				return sessionRepo.Revoke(context.Background(), 1, "abc")
+			},
+			assert: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		"revoke all": {
+			arrange: func() {
+				mock.ExpectExec("UPDATE sessions SET revoked_at = \\$1\\s+WHERE user_id = \\$2 AND revoked_at IS NULL").
+					WithArgs(sqlmock.AnyArg(), 1).
+					WillReturnResult(sqlmock.NewResult(0, 3))
+			},
+			act: func() error {
+				return sessionRepo.RevokeAll(context.Background(), 1)
+			},
+			assert: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		"revoke other user's session": {
+			arrange: func() {
+				mock.ExpectExec("UPDATE sessions SET revoked_at").
+					WithArgs(sqlmock.AnyArg(), "abc", 2).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			act: func() error {
+				return sessionRepo.Revoke(context.Background(), 2, "abc")
+			},
+			assert: func(t *testing.T, err error) {
+				require.ErrorIs(t, err, sql.ErrNoRows)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			err := v.act()
+
+			v.assert(t, err)
+			err = mock.ExpectationsWereMet()
+			if err != nil {
+				t.Errorf("Unmet expectations: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,427 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/ryanpujo/melius/internal/models"
+)
+
+type UserInterface interface {
+	FindByID(ctx context.Context, id uint) (*models.User, error)
+	Update(ctx context.Context, id uint, payload models.UpdateUserPayload) error
+	UpdatePassword(ctx context.Context, id uint, passwordHash string) error
+	CreateEmailChange(ctx context.Context, change models.EmailChange) error
+	ConfirmEmailChange(ctx context.Context, id uint, tokenHash string, reservedUntil time.Time) (string, error)
+	ChangeUsername(ctx context.Context, id uint, username string, reservedUntil time.Time) error
+	History(ctx context.Context, id uint) ([]models.IdentifierChange, error)
+	AddRole(ctx context.Context, id uint, role string) error
+	RemoveRole(ctx context.Context, id uint, role string) error
+	Close(ctx context.Context, id uint) error
+	Restore(ctx context.Context, id uint, closedAfter time.Time) error
+	ListPurgeable(ctx context.Context, closedBefore time.Time) ([]uint, error)
+	Delete(ctx context.Context, id uint) error
+	Anonymize(ctx context.Context, id uint) error
+}
+
+type UserRepo struct {
+	dB *sql.DB
+}
+
+func NewUserRepo(db *sql.DB) *UserRepo {
+	return &UserRepo{
+		dB: db,
+	}
+}
+
+// FindByID retrieves a user and their credential by the immutable user ID.
+func (ur *UserRepo) FindByID(ctx context.Context, id uint) (*models.User, error) {
+	query := selectUser + `WHERE u.deleted_at IS NULL AND u.id = $1`
+
+	user, err := scanUser(ur.dB.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("user with id '%d' not found: %w", id, err)
+		}
+		return nil, fmt.Errorf("error retrieving user: %w", err)
+	}
+	return user, nil
+}
+
+// Update changes the profile fields of the user identified by id.
+// Nil fields in the payload keep their current value. Non-nil attributes replace
+// the stored attributes as a whole, merging is up to the caller.
+func (ur *UserRepo) Update(ctx context.Context, id uint, payload models.UpdateUserPayload) error {
+	query := `
+		UPDATE users
+		SET first_name = COALESCE($1, first_name), last_name = COALESCE($2, last_name),
+			attributes = COALESCE($3, attributes), updated_at = $4
+		WHERE id = $5
+	`
+
+	// A nil interface, unlike a nil slice, is sent as NULL and keeps the stored attributes.
+	var attributes any
+	if payload.Attributes != nil {
+		b, err := marshalAttributes(payload.Attributes)
+		if err != nil {
+			return err
+		}
+		attributes = b
+	}
+
+	res, err := ur.dB.ExecContext(ctx, query,
+		payload.FirstName,
+		payload.LastName,
+		attributes,
+		time.Now().Format(time.RFC3339),
+		id,
+	)
+	if err != nil {
+		return fmt.Errorf("error updating user: %w", err)
+	}
+	return expectAffected(res, id)
+}
+
+// UpdatePassword replaces the stored password hash of the user identified by id.
+func (ur *UserRepo) UpdatePassword(ctx context.Context, id uint, passwordHash string) error {
+	query := `
+		UPDATE credentials SET password = $1, updated_at = $2
+		WHERE username = (SELECT username FROM users WHERE id = $3)
+	`
+
+	res, err := ur.dB.ExecContext(ctx, query, passwordHash, time.Now().Format(time.RFC3339), id)
+	if err != nil {
+		return fmt.Errorf("error updating password: %w", err)
+	}
+	return expectAffected(res, id)
+}
+
+// CreateEmailChange stores a pending email change. A user has at most one pending change,
+// so a new request replaces the previous one.
+func (ur *UserRepo) CreateEmailChange(ctx context.Context, change models.EmailChange) error {
+	query := `
+		INSERT INTO email_changes (user_id, new_email, token_hash, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id) DO UPDATE
+		SET new_email = EXCLUDED.new_email, token_hash = EXCLUDED.token_hash,
+			expires_at = EXCLUDED.expires_at, created_at = EXCLUDED.created_at
+	`
+
+	_, err := ur.dB.ExecContext(ctx, query,
+		change.UserID,
+		change.NewEmail,
+		change.TokenHash,
+		change.ExpiresAt.Format(time.RFC3339),
+		time.Now().Format(time.RFC3339),
+	)
+	if err != nil {
+		return fmt.Errorf("error creating email change: %w", err)
+	}
+	return nil
+}
+
+// ConfirmEmailChange consumes the pending email change matching tokenHash, applies
+// the new address to the credential and records the old address in the identifier
+// history. All steps run in one transaction.
+// Returns the new email address.
+func (ur *UserRepo) ConfirmEmailChange(ctx context.Context, id uint, tokenHash string, reservedUntil time.Time) (string, error) {
+	consumeQuery := `
+		DELETE FROM email_changes
+		WHERE user_id = $1 AND token_hash = $2 AND expires_at > $3
+		RETURNING new_email
+	`
+
+	currentQuery := `
+		SELECT c.email FROM credentials c
+		JOIN users u ON u.username = c.username
+		WHERE u.id = $1
+		FOR UPDATE
+	`
+
+	updateQuery := `
+		UPDATE credentials SET email = $1, updated_at = $2
+		WHERE username = (SELECT username FROM users WHERE id = $3)
+	`
+
+	tx, err := ur.dB.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var email string
+
+	err = tx.QueryRowContext(ctx, consumeQuery, id, tokenHash, time.Now().Format(time.RFC3339)).Scan(&email)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", fmt.Errorf("email change token is invalid or expired: %w", err)
+		}
+		return "", fmt.Errorf("error retrieving email change: %w", err)
+	}
+
+	var oldEmail string
+
+	if err = tx.QueryRowContext(ctx, currentQuery, id).Scan(&oldEmail); err != nil {
+		return "", fmt.Errorf("error retrieving current email: %w", err)
+	}
+
+	if _, err = tx.ExecContext(ctx, updateQuery, email, time.Now().Format(time.RFC3339), id); err != nil {
+		return "", fmt.Errorf("error updating email: %w", err)
+	}
+
+	if err = recordIdentifierChange(ctx, tx, id, models.IdentifierEmail, oldEmail, email, reservedUntil); err != nil {
+		return "", err
+	}
+
+	return email, tx.Commit()
+}
+
+// ChangeUsername renames the credential of the user identified by id. The new username
+// cascades to every table referencing credentials.username, and the old one is recorded
+// in the identifier history. All steps run in one transaction.
+func (ur *UserRepo) ChangeUsername(ctx context.Context, id uint, username string, reservedUntil time.Time) error {
+	currentQuery := `
+		SELECT username FROM users WHERE id = $1 FOR UPDATE
+	`
+
+	renameQuery := `
+		UPDATE credentials SET username = $1, updated_at = $2 WHERE username = $3
+	`
+
+	tx, err := ur.dB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var oldUsername string
+
+	if err = tx.QueryRowContext(ctx, currentQuery, id).Scan(&oldUsername); err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("user with id '%d' not found: %w", id, err)
+		}
+		return fmt.Errorf("error retrieving username: %w", err)
+	}
+
+	if _, err = tx.ExecContext(ctx, renameQuery, username, time.Now().Format(time.RFC3339), oldUsername); err != nil {
+		return fmt.Errorf("error changing username: %w", err)
+	}
+
+	if err = recordIdentifierChange(ctx, tx, id, models.IdentifierUsername, oldUsername, username, reservedUntil); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// History lists the previous usernames and emails of the user identified by id, newest first.
+func (ur *UserRepo) History(ctx context.Context, id uint) ([]models.IdentifierChange, error) {
+	query := `
+		SELECT kind, old_value, new_value, changed_at, reserved_until
+		FROM identifier_history
+		WHERE user_id = $1
+		ORDER BY changed_at DESC
+	`
+
+	rows, err := ur.dB.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving identifier history: %w", err)
+	}
+	defer rows.Close()
+
+	history := []models.IdentifierChange{}
+	for rows.Next() {
+		var change models.IdentifierChange
+		if err := rows.Scan(
+			&change.Kind,
+			&change.OldValue,
+			&change.NewValue,
+			&change.ChangedAt,
+			&change.ReservedUntil,
+		); err != nil {
+			return nil, fmt.Errorf("error scanning identifier history: %w", err)
+		}
+		history = append(history, change)
+	}
+	return history, rows.Err()
+}
+
+// AddRole grants role to the user identified by id. Granting a role twice is a no-op.
+func (ur *UserRepo) AddRole(ctx context.Context, id uint, role string) error {
+	query := `
+		INSERT INTO user_roles (user_id, role) VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`
+
+	if _, err := ur.dB.ExecContext(ctx, query, id, role); err != nil {
+		return fmt.Errorf("error adding role: %w", err)
+	}
+	return nil
+}
+
+// RemoveRole revokes role from the user identified by id.
+func (ur *UserRepo) RemoveRole(ctx context.Context, id uint, role string) error {
+	query := `
+		DELETE FROM user_roles WHERE user_id = $1 AND role = $2
+	`
+
+	if _, err := ur.dB.ExecContext(ctx, query, id, role); err != nil {
+		return fmt.Errorf("error removing role: %w", err)
+	}
+	return nil
+}
+
+// Close marks the account of the user identified by id as deleted.
+// The account disappears from every lookup but its data is kept until purged.
+func (ur *UserRepo) Close(ctx context.Context, id uint) error {
+	query := `
+		UPDATE users SET deleted_at = $1 WHERE id = $2 AND deleted_at IS NULL
+	`
+
+	res, err := ur.dB.ExecContext(ctx, query, time.Now().Format(time.RFC3339), id)
+	if err != nil {
+		return fmt.Errorf("error closing account: %w", err)
+	}
+	return expectAffected(res, id)
+}
+
+// Restore reopens the account of the user identified by id if it was closed after closedAfter.
+func (ur *UserRepo) Restore(ctx context.Context, id uint, closedAfter time.Time) error {
+	query := `
+		UPDATE users SET deleted_at = NULL
+		WHERE id = $1 AND deleted_at > $2 AND purged_at IS NULL
+	`
+
+	res, err := ur.dB.ExecContext(ctx, query, id, closedAfter.Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("error restoring account: %w", err)
+	}
+	return expectAffected(res, id)
+}
+
+// ListPurgeable returns the IDs of accounts closed before closedBefore that are not purged yet.
+func (ur *UserRepo) ListPurgeable(ctx context.Context, closedBefore time.Time) ([]uint, error) {
+	query := `
+		SELECT id FROM users
+		WHERE deleted_at < $1 AND purged_at IS NULL
+		ORDER BY id
+	`
+
+	rows, err := ur.dB.QueryContext(ctx, query, closedBefore.Format(time.RFC3339))
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving purgeable accounts: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []uint
+	for rows.Next() {
+		var id uint
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("error scanning purgeable account: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// Delete permanently removes the user identified by id. Deleting the credential
+// cascades to the user and every row referencing it.
+func (ur *UserRepo) Delete(ctx context.Context, id uint) error {
+	query := `
+		DELETE FROM credentials WHERE username = (SELECT username FROM users WHERE id = $1)
+	`
+
+	res, err := ur.dB.ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("error deleting user: %w", err)
+	}
+	return expectAffected(res, id)
+}
+
+// Anonymize replaces the personal data of the user identified by id with placeholders
+// while keeping the rows, so records referencing the user ID stay intact. The account
+// is marked as deleted and purged and can no longer be used or restored.
+func (ur *UserRepo) Anonymize(ctx context.Context, id uint) error {
+	credentialQuery := `
+		UPDATE credentials SET username = $1, email = $2, password = '', updated_at = $3
+		WHERE username = (SELECT username FROM users WHERE id = $4)
+	`
+
+	userQuery := `
+		UPDATE users
+		SET first_name = '', last_name = '', attributes = '{}',
+			deleted_at = COALESCE(deleted_at, $1), purged_at = $1, updated_at = $1
+		WHERE id = $2
+	`
+
+	cleanupQueries := []string{
+		`DELETE FROM email_changes WHERE user_id = $1`,
+		`DELETE FROM identifier_history WHERE user_id = $1`,
+		`DELETE FROM user_roles WHERE user_id = $1`,
+	}
+
+	tx, err := ur.dB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().Format(time.RFC3339)
+	placeholder := fmt.Sprintf("deleted-%d", id)
+
+	// The username change cascades to users.username.
+	res, err := tx.ExecContext(ctx, credentialQuery, placeholder, placeholder+"@invalid", now, id)
+	if err != nil {
+		return fmt.Errorf("error anonymizing credential: %w", err)
+	}
+	if err = expectAffected(res, id); err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, userQuery, now, id); err != nil {
+		return fmt.Errorf("error anonymizing user: %w", err)
+	}
+
+	for _, query := range cleanupQueries {
+		if _, err = tx.ExecContext(ctx, query, id); err != nil {
+			return fmt.Errorf("error anonymizing user: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// recordIdentifierChange appends an entry to the identifier history inside tx.
+func recordIdentifierChange(ctx context.Context, tx *sql.Tx, id uint, kind, oldValue, newValue string, reservedUntil time.Time) error {
+	query := `
+		INSERT INTO identifier_history (user_id, kind, old_value, new_value, changed_at, reserved_until)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+
+	_, err := tx.ExecContext(ctx, query,
+		id,
+		kind,
+		oldValue,
+		newValue,
+		time.Now().Format(time.RFC3339),
+		reservedUntil.Format(time.RFC3339),
+	)
+	if err != nil {
+		return fmt.Errorf("error recording identifier history: %w", err)
+	}
+	return nil
+}
+
+// expectAffected reports sql.ErrNoRows when an update matched no row for the user id.
+func expectAffected(res sql.Result, id uint) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("user with id '%d' not found: %w", id, sql.ErrNoRows)
+	}
+	return nil
+}
@@ -0,0 +1,608 @@
+package repositories_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindByID(t *testing.T) {
+	tableTest := map[string]struct {
+		arrange func()
+		assert  func(t *testing.T, actual *models.User, err error)
+	}{
+		"success": {
+			arrange: func() {
+				row := sqlmock.NewRows(userColumns).
+					AddRow(
+						user.ID, user.FirstName, user.LastName, []byte(`{"department":"sales"}`), []byte(`["admin"]`), nil,
+						user.Credential.Email, user.Credential.Username, user.Credential.Password,
+					)
+
+				mock.ExpectQuery(`WHERE u.deleted_at IS NULL AND u.id = \$1`).WithArgs(1).WillReturnRows(row)
+			},
+			assert: func(t *testing.T, actual *models.User, err error) {
+				require.NoError(t, err)
+				require.Equal(t, &user, actual)
+			},
+		},
+		"not found": {
+			arrange: func() {
+				row := sqlmock.NewRows(userColumns)
+
+				mock.ExpectQuery(`WHERE u.deleted_at IS NULL AND u.id = \$1`).WithArgs(1).WillReturnRows(row)
+			},
+			assert: func(t *testing.T, actual *models.User, err error) {
+				require.ErrorIs(t, err, sql.ErrNoRows)
+				require.Nil(t, actual)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			actual, err := userRepo.FindByID(context.Background(), 1)
+
+			v.assert(t, actual, err)
+			err = mock.ExpectationsWereMet()
+			if err != nil {
+				t.Errorf("Unmet expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestUpdateUser(t *testing.T) {
+	firstName := "Ryan"
+	payload := models.UpdateUserPayload{FirstName: &firstName}
+	tableTest := map[string]struct {
+		arrange func()
+		assert  func(t *testing.T, err error)
+	}{
+		"success": {
+			arrange: func() {
+				mock.ExpectExec("UPDATE users").
+					WithArgs(firstName, nil, nil, sqlmock.AnyArg(), 1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			assert: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		"not found": {
+			arrange: func() {
+				mock.ExpectExec("UPDATE users").
+					WithArgs(firstName, nil, nil, sqlmock.AnyArg(), 1).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			assert: func(t *testing.T, err error) {
+				require.Error(t, err)
+			},
+		},
+		"exec failed": {
+			arrange: func() {
+				mock.ExpectExec("UPDATE users").
+					WithArgs(firstName, nil, nil, sqlmock.AnyArg(), 1).
+					WillReturnError(errors.New("failed"))
+			},
+			assert: func(t *testing.T, err error) {
+				require.Error(t, err)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			err := userRepo.Update(context.Background(), 1, payload)
+
+			v.assert(t, err)
+			err = mock.ExpectationsWereMet()
+			if err != nil {
+				t.Errorf("Unmet expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestUpdatePassword(t *testing.T) {
+	tableTest := map[string]struct {
+		arrange func()
+		assert  func(t *testing.T, err error)
+	}{
+		"success": {
+			arrange: func() {
+				mock.ExpectExec("UPDATE credentials SET password").
+					WithArgs("hashed", sqlmock.AnyArg(), 1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			assert: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		"not found": {
+			arrange: func() {
+				mock.ExpectExec("UPDATE credentials SET password").
+					WithArgs("hashed", sqlmock.AnyArg(), 1).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			assert: func(t *testing.T, err error) {
+				require.Error(t, err)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			err := userRepo.UpdatePassword(context.Background(), 1, "hashed")
+
+			v.assert(t, err)
+			err = mock.ExpectationsWereMet()
+			if err != nil {
+				t.Errorf("Unmet expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestCreateEmailChange(t *testing.T) {
+	change := models.EmailChange{
+		UserID:    1,
+		NewEmail:  "ryan@pujo.dev",
+		TokenHash: "hash",
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+	tableTest := map[string]struct {
+		arrange func()
+		assert  func(t *testing.T, err error)
+	}{
+		"success": {
+			arrange: func() {
+				mock.ExpectExec("INSERT INTO email_changes").
+					WithArgs(change.UserID, change.NewEmail, change.TokenHash, sqlmock.AnyArg(), sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+			},
+			assert: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		"failed": {
+			arrange: func() {
+				mock.ExpectExec("INSERT INTO email_changes").
+					WithArgs(change.UserID, change.NewEmail, change.TokenHash, sqlmock.AnyArg(), sqlmock.AnyArg()).
+					WillReturnError(errors.New("failed"))
+			},
+			assert: func(t *testing.T, err error) {
+				require.Error(t, err)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			err := userRepo.CreateEmailChange(context.Background(), change)
+
+			v.assert(t, err)
+			err = mock.ExpectationsWereMet()
+			if err != nil {
+				t.Errorf("Unmet expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestConfirmEmailChange(t *testing.T) {
+	tableTest := map[string]struct {
+		arrange func()
+		assert  func(t *testing.T, email string, err error)
+	}{
+		"success": {
+			arrange: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery("DELETE FROM email_changes").
+					WithArgs(1, "hash", sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows([]string{"new_email"}).AddRow("ryan@pujo.dev"))
+				mock.ExpectQuery("SELECT c.email FROM credentials").
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"email"}).AddRow("ryanpujo@gmail.com"))
+				mock.ExpectExec("UPDATE credentials SET email").
+					WithArgs("ryan@pujo.dev", sqlmock.AnyArg(), 1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("INSERT INTO identifier_history").
+					WithArgs(1, models.IdentifierEmail, "ryanpujo@gmail.com", "ryan@pujo.dev", sqlmock.AnyArg(), sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+			},
+			assert: func(t *testing.T, email string, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "ryan@pujo.dev", email)
+			},
+		},
+		"invalid token": {
+			arrange: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery("DELETE FROM email_changes").
+					WithArgs(1, "hash", sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows([]string{"new_email"}))
+				mock.ExpectRollback()
+			},
+			assert: func(t *testing.T, email string, err error) {
+				require.Error(t, err)
+				require.Zero(t, email)
+			},
+		},
+		"rollback on update failure": {
+			arrange: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery("DELETE FROM email_changes").
+					WithArgs(1, "hash", sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows([]string{"new_email"}).AddRow("ryan@pujo.dev"))
+				mock.ExpectQuery("SELECT c.email FROM credentials").
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"email"}).AddRow("ryanpujo@gmail.com"))
+				mock.ExpectExec("UPDATE credentials SET email").
+					WithArgs("ryan@pujo.dev", sqlmock.AnyArg(), 1).
+					WillReturnError(errors.New("duplicate email"))
+				mock.ExpectRollback()
+			},
+			assert: func(t *testing.T, email string, err error) {
+				require.Error(t, err)
+				require.Zero(t, email)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			email, err := userRepo.ConfirmEmailChange(context.Background(), 1, "hash", time.Now().Add(time.Hour))
+
+			v.assert(t, email, err)
+			err = mock.ExpectationsWereMet()
+			if err != nil {
+				t.Errorf("Unmet expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestChangeUsername(t *testing.T) {
+	tableTest := map[string]struct {
+		arrange func()
+		assert  func(t *testing.T, err error)
+	}{
+		"success": {
+			arrange: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT username FROM users").
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"username"}).AddRow("ryanpujo"))
+				mock.ExpectExec("UPDATE credentials SET username").
+					WithArgs("pujo", sqlmock.AnyArg(), "ryanpujo").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("INSERT INTO identifier_history").
+					WithArgs(1, models.IdentifierUsername, "ryanpujo", "pujo", sqlmock.AnyArg(), sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+			},
+			assert: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		"rollback on rename failure": {
+			arrange: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT username FROM users").
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"username"}).AddRow("ryanpujo"))
+				mock.ExpectExec("UPDATE credentials SET username").
+					WithArgs("pujo", sqlmock.AnyArg(), "ryanpujo").
+					WillReturnError(errors.New("duplicate username"))
+				mock.ExpectRollback()
+			},
+			assert: func(t *testing.T, err error) {
+				require.Error(t, err)
+			},
+		},
+		"user not found": {
+			arrange: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT username FROM users").
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"username"}))
+				mock.ExpectRollback()
+			},
+			assert: func(t *testing.T, err error) {
+				require.ErrorIs(t, err, sql.ErrNoRows)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			err := userRepo.ChangeUsername(context.Background(), 1, "pujo", time.Now().Add(time.Hour))
+
+			v.assert(t, err)
+			err = mock.ExpectationsWereMet()
+			if err != nil {
+				t.Errorf("Unmet expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestHistory(t *testing.T) {
+	now := time.Now()
+	tableTest := map[string]struct {
+		arrange func()
+		assert  func(t *testing.T, history []models.IdentifierChange, err error)
+	}{
+		"success": {
+			arrange: func() {
+				rows := sqlmock.NewRows([]string{"kind", "old_value", "new_value", "changed_at", "reserved_until"}).
+					AddRow(models.IdentifierUsername, "ryan", "ryanpujo", now, now.Add(time.Hour))
+
+				mock.ExpectQuery("SELECT kind, old_value").WithArgs(1).WillReturnRows(rows)
+			},
+			assert: func(t *testing.T, history []models.IdentifierChange, err error) {
+				require.NoError(t, err)
+				require.Len(t, history, 1)
+				require.Equal(t, "ryan", history[0].OldValue)
+			},
+		},
+		"query failed": {
+			arrange: func() {
+				mock.ExpectQuery("SELECT kind, old_value").WithArgs(1).WillReturnError(errors.New("failed"))
+			},
+			assert: func(t *testing.T, history []models.IdentifierChange, err error) {
+				require.Error(t, err)
+				require.Nil(t, history)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			history, err := userRepo.History(context.Background(), 1)
+
+			v.assert(t, history, err)
+			err = mock.ExpectationsWereMet()
+			if err != nil {
+				t.Errorf("Unmet expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestUpdateUserAttributes(t *testing.T) {
+	mock.ExpectExec("UPDATE users").
+		WithArgs(nil, nil, []byte(`{"department":"sales"}`), sqlmock.AnyArg(), 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := userRepo.Update(context.Background(), 1, models.UpdateUserPayload{
+		Attributes: map[string]any{"department": "sales"},
+	})
+
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRoles(t *testing.T) {
+	tableTest := map[string]struct {
+		arrange func()
+		act     func() error
+		assert  func(t *testing.T, err error)
+	}{
+		"add": {
+			arrange: func() {
+				mock.ExpectExec("INSERT INTO user_roles").
+					WithArgs(1, models.RoleAdmin).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			act: func() error {
+				return userRepo.AddRole(context.Background(), 1, models.RoleAdmin)
+			},
+			assert: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		"add failed": {
+			arrange: func() {
+				mock.ExpectExec("INSERT INTO user_roles").
+					WithArgs(1, models.RoleAdmin).
+					WillReturnError(errors.New("failed"))
+			},
+			act: func() error {
+				return userRepo.AddRole(context.Background(), 1, models.RoleAdmin)
+			},
+			assert: func(t *testing.T, err error) {
+				require.Error(t, err)
+			},
+		},
+		"remove": {
+			arrange: func() {
+				mock.ExpectExec("DELETE FROM user_roles").
+					WithArgs(1, models.RoleAdmin).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			act: func() error {
+				return userRepo.RemoveRole(context.Background(), 1, models.RoleAdmin)
+			},
+			assert: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			err := v.act()
+
+			v.assert(t, err)
+			err = mock.ExpectationsWereMet()
+			if err != nil {
+				t.Errorf("Unmet expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestAccountClosure(t *testing.T) {
+	closedAfter := time.Now().Add(-time.Hour)
+
+	tableTest := map[string]struct {
+		arrange func()
+		act     func() error
+		assert  func(t *testing.T, err error)
+	}{
+		"close": {
+			arrange: func() {
+				mock.ExpectExec("UPDATE users SET deleted_at").
+					WithArgs(sqlmock.AnyArg(), 1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			act: func() error {
+				return userRepo.Close(context.Background(), 1)
+			},
+			assert: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		"close already closed": {
+			arrange: func() {
+				mock.ExpectExec("UPDATE users SET deleted_at").
+					WithArgs(sqlmock.AnyArg(), 1).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			act: func() error {
+				return userRepo.Close(context.Background(), 1)
+			},
+			assert: func(t *testing.T, err error) {
+				require.ErrorIs(t, err, sql.ErrNoRows)
+			},
+		},
+		"restore": {
+			arrange: func() {
+				mock.ExpectExec("UPDATE users SET deleted_at = NULL").
+					WithArgs(1, closedAfter.Format(time.RFC3339)).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			act: func() error {
+				return userRepo.Restore(context.Background(), 1, closedAfter)
+			},
+			assert: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		"restore after grace period": {
+			arrange: func() {
+				mock.ExpectExec("UPDATE users SET deleted_at = NULL").
+					WithArgs(1, closedAfter.Format(time.RFC3339)).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			act: func() error {
+				return userRepo.Restore(context.Background(), 1, closedAfter)
+			},
+			assert: func(t *testing.T, err error) {
+				require.ErrorIs(t, err, sql.ErrNoRows)
+			},
+		},
+		"delete": {
+			arrange: func() {
+				mock.ExpectExec("DELETE FROM credentials").
+					WithArgs(1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			act: func() error {
+				return userRepo.Delete(context.Background(), 1)
+			},
+			assert: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		"anonymize": {
+			arrange: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec("UPDATE credentials SET username").
+					WithArgs("deleted-1", "deleted-1@invalid", sqlmock.AnyArg(), 1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("UPDATE users").
+					WithArgs(sqlmock.AnyArg(), 1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("DELETE FROM email_changes").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec("DELETE FROM identifier_history").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectExec("DELETE FROM user_roles").WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			act: func() error {
+				return userRepo.Anonymize(context.Background(), 1)
+			},
+			assert: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		"anonymize missing user": {
+			arrange: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec("UPDATE credentials SET username").
+					WithArgs("deleted-1", "deleted-1@invalid", sqlmock.AnyArg(), 1).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
+			},
+			act: func() error {
+				return userRepo.Anonymize(context.Background(), 1)
+			},
+			assert: func(t *testing.T, err error) {
+				require.ErrorIs(t, err, sql.ErrNoRows)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			err := v.act()
+
+			v.assert(t, err)
+			err = mock.ExpectationsWereMet()
+			if err != nil {
+				t.Errorf("Unmet expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestListPurgeable(t *testing.T) {
+	closedBefore := time.Now().Add(-time.Hour)
+
+	mock.ExpectQuery("SELECT id FROM users").
+		WithArgs(closedBefore.Format(time.RFC3339)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(3))
+
+	ids, err := userRepo.ListPurgeable(context.Background(), closedBefore)
+
+	require.NoError(t, err)
+	require.Equal(t, []uint{1, 3}, ids)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
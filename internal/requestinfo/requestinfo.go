@@ -0,0 +1,113 @@
+// Package requestinfo makes details of the HTTP request available to services,
+// which only receive a context.
+package requestinfo
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ryanpujo/melius/internal/utilities"
+)
+
+// HeaderRequestID carries the request id, it is accepted from clients and echoed back.
+const HeaderRequestID = "X-Request-ID"
+
+// HeaderDeviceID carries the device id of clients without cookies, like gRPC callers.
+const HeaderDeviceID = "X-Device-ID"
+
+// DeviceCookie is the long-lived cookie identifying the device of a browser.
+const DeviceCookie = "melius_device"
+
+// deviceCookieMaxAge is the lifetime of the device cookie in seconds, about two years.
+const deviceCookieMaxAge = 2 * 365 * 24 * 60 * 60
+
+// key is the gin context key of the Info. gin.Context resolves string keys of
+// context.Value through its own keys, so the Info reaches any context derived from it.
+const key = "request_info"
+
+// contextKey is the key of an Info attached with NewContext.
+type contextKey struct{}
+
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// Info describes the request a service call is made for.
+type Info struct {
+	IP        string
+	UserAgent string
+	RequestID string
+	// DeviceID is the value of the device cookie, or of the HeaderDeviceID metadata of
+	// gRPC calls, empty when the client sent none.
+	DeviceID string
+}
+
+// Middleware records the Info of every request and assigns a request id
+// unless the client sent a valid one.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := RequestID(c.GetHeader(HeaderRequestID))
+
+		deviceID, _ := c.Cookie(DeviceCookie)
+		c.Set(key, Info{
+			IP:        c.ClientIP(),
+			UserAgent: c.Request.UserAgent(),
+			RequestID: requestID,
+			DeviceID:  deviceID,
+		})
+		c.Header(HeaderRequestID, requestID)
+		c.Next()
+	}
+}
+
+// RequestID returns the request id sent by a client, or a new one when it is not valid.
+func RequestID(sent string) string {
+	if validRequestID.MatchString(sent) {
+		return sent
+	}
+	id, _ := utilities.RandomToken(16)
+	return id
+}
+
+// AssignDevice gives clients without a device cookie a new one. It must run after Middleware
+// and is only used on the login routes, where devices are recognized.
+func AssignDevice() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		info, _ := c.Value(key).(Info)
+		if info.DeviceID == "" {
+			info.DeviceID, _ = utilities.RandomToken(32)
+			c.Set(key, info)
+			c.SetSameSite(http.SameSiteLaxMode)
+			c.SetCookie(DeviceCookie, info.DeviceID, deviceCookieMaxAge, "/", "", c.Request.TLS != nil, true)
+		}
+		c.Next()
+	}
+}
+
+// NewContext returns a copy of ctx carrying info, it takes precedence over the Info
+// recorded by Middleware.
+func NewContext(ctx context.Context, info Info) context.Context {
+	return context.WithValue(ctx, contextKey{}, info)
+}
+
+// FromContext returns the Info of the request ctx belongs to,
+// or the zero Info outside of a request.
+func FromContext(ctx context.Context) Info {
+	if info, ok := ctx.Value(contextKey{}).(Info); ok {
+		return info
+	}
+	info, _ := ctx.Value(key).(Info)
+	return info
+}
+
+// UserID returns the ID of the authenticated user making the request, or 0.
+func UserID(ctx context.Context) uint {
+	id, _ := ctx.Value("user_id").(uint)
+	return id
+}
+
+// ActorID returns the ID of the administrator impersonating the user making the request, or 0.
+func ActorID(ctx context.Context) uint {
+	id, _ := ctx.Value("actor_id").(uint)
+	return id
+}
@@ -2,24 +2,112 @@ package route
 
 import (
 	"net/http"
+	"slices"
 
 	"github.com/gin-gonic/gin"
 	"github.com/ryanpujo/melius/internal/adapter"
+	"github.com/ryanpujo/melius/internal/csrf"
 	"github.com/ryanpujo/melius/internal/jwttoken"
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/ryanpujo/melius/internal/requestinfo"
 )
 
 // SetupRoutes initializes and returns a Gin engine with defined routes.
 func SetupRoutes(handlers *adapter.Adapter) *gin.Engine {
 	router := gin.Default()
+	router.Use(requestinfo.Middleware())
+
 	protected := router.Group("/auth")
-	protected.Use(jwttoken.JWTAuthMiddleware())
+	protected.Use(jwttoken.JWTAuthMiddleware(handlers.AuthOptions...), csrf.Middleware())
 	// Define a simple GET route
 	protected.GET("/", func(ctx *gin.Context) {
 		ctx.String(http.StatusOK, "Hello, World!")
 	})
+	// Service accounts are not people, they have no account, session or password to manage.
+	userOnly := jwttoken.RequirePrincipal(jwttoken.PrincipalUser)
+	protected.POST("/logout", userOnly, handlers.CredentialController.Logout)
+	protected.POST("/refresh", userOnly, handlers.CredentialController.Refresh)
+
+	// Sensitive operations require the user to have authenticated recently.
+	recentAuth := jwttoken.RequireRecentAuth(handlers.ReauthMaxAge)
+	// Administrators impersonating a user cannot change their credentials or account.
+	noImpersonation := jwttoken.RejectImpersonation()
+
+	me := protected.Group("/me", userOnly)
+	me.GET("", handlers.UserController.Me)
+	me.PATCH("", handlers.UserController.UpdateMe)
+	me.DELETE("", noImpersonation, recentAuth, handlers.UserController.CloseAccount)
+	me.POST("/reauth", noImpersonation, handlers.CredentialController.Reauthenticate)
+	me.POST("/password", noImpersonation, recentAuth, handlers.UserController.ChangePassword)
+	me.POST("/email", noImpersonation, recentAuth, handlers.UserController.ChangeEmail)
+	me.POST("/email/confirm", noImpersonation, handlers.UserController.ConfirmEmail)
+	me.POST("/username", noImpersonation, recentAuth, handlers.UserController.ChangeUsername)
+	me.GET("/history", handlers.UserController.History)
+	me.GET("/export", handlers.PrivacyController.ExportMe)
+	me.POST("/erase", noImpersonation, recentAuth, handlers.PrivacyController.EraseMe)
+	me.GET("/sessions", handlers.SessionController.Sessions)
+	me.DELETE("/sessions/:id", handlers.SessionController.Revoke)
+	me.GET("/logins", handlers.SessionController.Logins)
+	me.POST("/api-keys", noImpersonation, recentAuth, handlers.APIKeyController.Create)
+	me.GET("/api-keys", handlers.APIKeyController.List)
+	me.GET("/api-keys/:id", handlers.APIKeyController.Get)
+	me.PATCH("/api-keys/:id", noImpersonation, recentAuth, handlers.APIKeyController.Update)
+	me.DELETE("/api-keys/:id", noImpersonation, handlers.APIKeyController.Delete)
+	// Approving a device issues it a session token, so only a session may do it.
+	sessionOnly := jwttoken.RequireSessionToken()
+	me.GET("/device", noImpersonation, sessionOnly, recentAuth, handlers.DeviceAuthorizationController.Lookup)
+	me.POST("/device", noImpersonation, sessionOnly, recentAuth, handlers.DeviceAuthorizationController.Decide)
+
+	// API keys granted the admin scope, on a recent authentication, administer without one.
+	// Granting privileges, impersonating and erasing always require a recent authentication,
+	// which API keys cannot have however they are scoped.
+	adminAuth := jwttoken.UnlessAPIKeyScope(models.ScopeAdmin, recentAuth)
+
+	admin := router.Group("/admin")
+	admin.Use(jwttoken.JWTAuthMiddleware(handlers.AuthOptions...), csrf.Middleware(), userOnly, jwttoken.RequireRole(models.RoleAdmin), adminAuth)
+	admin.GET("/attributes", handlers.AttributeController.List)
+	admin.PUT("/attributes/:name", handlers.AttributeController.Define)
+	admin.DELETE("/attributes/:name", handlers.AttributeController.Delete)
+	admin.GET("/policies", handlers.PolicyController.List)
+	admin.PUT("/policies/:name", recentAuth, handlers.PolicyController.Define)
+	admin.DELETE("/policies/:name", recentAuth, handlers.PolicyController.Delete)
+	admin.GET("/users/:id", handlers.UserController.User)
+	admin.PATCH("/users/:id/attributes", handlers.UserController.SetAttributes)
+	admin.PUT("/users/:id/roles/:role", recentAuth, handlers.UserController.AssignRole)
+	admin.DELETE("/users/:id/roles/:role", recentAuth, handlers.UserController.RevokeRole)
+	admin.GET("/users/:id/export", handlers.PrivacyController.Export)
+	admin.POST("/users/:id/erase", recentAuth, handlers.PrivacyController.Erase)
+	admin.POST("/users/:id/impersonate", recentAuth, handlers.CredentialController.Impersonate)
+	admin.GET("/audit", handlers.AuditController.List)
+	admin.GET("/audit/verify", handlers.AuditController.Verify)
+	admin.GET("/service-accounts", handlers.ServiceAccountController.List)
+	admin.POST("/service-accounts", handlers.ServiceAccountController.Create)
+	admin.GET("/service-accounts/:id", handlers.ServiceAccountController.Get)
+	admin.PATCH("/service-accounts/:id", handlers.ServiceAccountController.Update)
+	admin.DELETE("/service-accounts/:id", handlers.ServiceAccountController.Delete)
+	admin.PUT("/service-accounts/:id/roles/:role", recentAuth, handlers.ServiceAccountController.AssignRole)
+	admin.DELETE("/service-accounts/:id/roles/:role", recentAuth, handlers.ServiceAccountController.RevokeRole)
+	admin.GET("/service-accounts/:id/credentials", handlers.ServiceAccountController.ListCredentials)
+	admin.POST("/service-accounts/:id/credentials", handlers.ServiceAccountController.CreateCredential)
+	admin.DELETE("/service-accounts/:id/credentials/:credential", handlers.ServiceAccountController.DeleteCredential)
 
 	router.POST("/regis", handlers.CredentialController.Write)
-	router.POST("/login", handlers.CredentialController.Login)
+	router.POST("/login", requestinfo.AssignDevice(), handlers.CredentialController.Login)
+	router.POST("/login/verify", requestinfo.AssignDevice(), handlers.CredentialController.VerifyLogin)
+	router.POST("/restore", handlers.UserController.Restore)
+	router.POST("/oauth/token", handlers.TokenController.Token)
+	router.POST("/oauth/device_authorization", handlers.DeviceAuthorizationController.Authorize)
+	router.GET("/.well-known/jwks.json", jwttoken.JWKSHandler())
+
+	// Apps ask whether the caller may act on a resource by a policy.
+	router.POST("/authz/check", jwttoken.JWTAuthMiddleware(handlers.AuthOptions...), csrf.Middleware(), handlers.PolicyController.Check)
+
+	// Reverse proxies ask whether requests to the apps they protect may pass.
+	// DPoP proofs sign the URL of the app, which forward auth only knows from headers
+	// it cannot verify, so tokens bound to a key are refused.
+	forwardAuth := append(slices.Clone(handlers.AuthOptions),
+		jwttoken.WithUnauthorizedHandler(handlers.ForwardAuthController.Unauthorized), jwttoken.WithoutDPoP())
+	router.GET("/forward-auth", jwttoken.JWTAuthMiddleware(forwardAuth...), handlers.ForwardAuthController.Authorize)
 
 	return router
 }
@@ -0,0 +1,225 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ryanpujo/melius/internal/jwttoken"
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/ryanpujo/melius/internal/repositories"
+	"github.com/ryanpujo/melius/internal/utilities"
+)
+
+// apiKeyTouchInterval limits how often the last use of an API key is written.
+const apiKeyTouchInterval = time.Minute
+
+var (
+	ErrScopeNotAllowed = errors.New("scope not allowed")
+	ErrInvalidExpiry   = errors.New("expiry must be in the future")
+	ErrAPIKeyInvalid   = errors.New("invalid api key")
+)
+
+// APIKeyInterface manages the API keys of users and authenticates requests made with them.
+type APIKeyInterface interface {
+	Create(ctx context.Context, userID uint, payload models.APIKeyPayload) (*models.CreatedAPIKey, error)
+	List(ctx context.Context, userID uint) ([]models.APIKey, error)
+	Get(ctx context.Context, userID uint, id string) (*models.APIKey, error)
+	Update(ctx context.Context, userID uint, id string, payload models.UpdateAPIKeyPayload) (*models.APIKey, error)
+	Delete(ctx context.Context, userID uint, id string) error
+	Authenticate(ctx context.Context, key string) (*jwttoken.Principal, error)
+}
+
+// APIKeyService implements the APIKeyInterface.
+type APIKeyService struct {
+	apiKeyRepo repositories.APIKeyInterface
+	userRepo   repositories.UserInterface
+	auditor    Auditor
+}
+
+// NewAPIKeyService creates a new instance of APIKeyService.
+func NewAPIKeyService(apiKeyRepo repositories.APIKeyInterface, userRepo repositories.UserInterface, auditor Auditor) *APIKeyService {
+	return &APIKeyService{
+		apiKeyRepo: apiKeyRepo,
+		userRepo:   userRepo,
+		auditor:    auditor,
+	}
+}
+
+// Create generates a new API key for the user. The returned key is the only time
+// its value is available, only its hash is stored.
+func (ks *APIKeyService) Create(ctx context.Context, userID uint, payload models.APIKeyPayload) (_ *models.CreatedAPIKey, err error) {
+	var id string
+	defer func() {
+		audit(ctx, ks.auditor, models.AuditAPIKeyCreate, userID, err, map[string]any{"key_id": id, "scopes": payload.Scopes})
+	}()
+
+	if err := ks.checkScopes(ctx, userID, payload.Scopes); err != nil {
+		return nil, err
+	}
+	if payload.ExpiresAt != nil && !payload.ExpiresAt.After(time.Now()) {
+		return nil, ErrInvalidExpiry
+	}
+
+	id, err = utilities.RandomToken(8)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate api key: %w", err)
+	}
+	secret, err := utilities.RandomToken(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate api key: %w", err)
+	}
+
+	// The key embeds its id after the prefix, so the prefix shown in listings identifies it.
+	prefix := models.APIKeyPrefix + id
+	value := prefix + "_" + secret
+	key := models.APIKey{
+		ID:        id,
+		UserID:    userID,
+		Name:      payload.Name,
+		Prefix:    prefix,
+		Hash:      utilities.HashToken(value),
+		Scopes:    normalizeScopes(payload.Scopes),
+		CreatedAt: time.Now(),
+		ExpiresAt: payload.ExpiresAt,
+	}
+	if err := ks.apiKeyRepo.Create(ctx, key); err != nil {
+		return nil, fmt.Errorf("failed to create api key: %w", err)
+	}
+	return &models.CreatedAPIKey{APIKey: key, Key: value}, nil
+}
+
+// List returns the API keys of the user.
+func (ks *APIKeyService) List(ctx context.Context, userID uint) ([]models.APIKey, error) {
+	keys, err := ks.apiKeyRepo.List(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list api keys: %w", err)
+	}
+	return keys, nil
+}
+
+// Get returns the API key id of the user.
+func (ks *APIKeyService) Get(ctx context.Context, userID uint, id string) (*models.APIKey, error) {
+	key, err := ks.apiKeyRepo.Find(ctx, userID, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find api key: %w", err)
+	}
+	return key, nil
+}
+
+// Update renames the API key id of the user and replaces its scopes.
+func (ks *APIKeyService) Update(ctx context.Context, userID uint, id string, payload models.UpdateAPIKeyPayload) (_ *models.APIKey, err error) {
+	defer func() {
+		audit(ctx, ks.auditor, models.AuditAPIKeyUpdate, userID, err, map[string]any{"key_id": id, "scopes": payload.Scopes})
+	}()
+
+	if err := ks.checkScopes(ctx, userID, payload.Scopes); err != nil {
+		return nil, err
+	}
+
+	payload.Scopes = normalizeScopes(payload.Scopes)
+	if err := ks.apiKeyRepo.Update(ctx, userID, id, payload); err != nil {
+		return nil, fmt.Errorf("failed to update api key: %w", err)
+	}
+	return ks.Get(ctx, userID, id)
+}
+
+// Delete revokes the API key id of the user.
+func (ks *APIKeyService) Delete(ctx context.Context, userID uint, id string) error {
+	err := ks.apiKeyRepo.Delete(ctx, userID, id)
+	audit(ctx, ks.auditor, models.AuditAPIKeyDelete, userID, err, map[string]any{"key_id": id})
+	if err != nil {
+		return fmt.Errorf("failed to delete api key: %w", err)
+	}
+	return nil
+}
+
+// Authenticate returns the principal of a valid API key. The admin role of the owner
+// is only carried by keys with the admin scope.
+func (ks *APIKeyService) Authenticate(ctx context.Context, value string) (*jwttoken.Principal, error) {
+	if !strings.HasPrefix(value, models.APIKeyPrefix) {
+		return nil, ErrAPIKeyInvalid
+	}
+
+	key, err := ks.apiKeyRepo.FindByHash(ctx, utilities.HashToken(value))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrAPIKeyInvalid, err)
+	}
+	if key.ExpiresAt != nil && !key.ExpiresAt.After(time.Now()) {
+		return nil, ErrAPIKeyInvalid
+	}
+
+	// Keys of closed accounts stop working with the account.
+	user, err := ks.userRepo.FindByID(ctx, key.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrAPIKeyInvalid, err)
+	}
+
+	if key.LastUsedAt == nil || time.Since(*key.LastUsedAt) > apiKeyTouchInterval {
+		if err := ks.apiKeyRepo.Touch(ctx, key.ID); err != nil {
+			log.Printf("api keys: %v", err)
+		}
+	}
+
+	roles := user.Roles
+	if !slices.Contains(key.Scopes, models.ScopeAdmin) {
+		roles = slices.DeleteFunc(slices.Clone(roles), func(role string) bool {
+			return role == models.RoleAdmin
+		})
+	}
+
+	return &jwttoken.Principal{
+		UserID:   user.ID,
+		Username: user.Credential.Username,
+		Roles:    roles,
+		Scopes:   key.Scopes,
+		KeyID:    key.ID,
+	}, nil
+}
+
+// checkScopes rejects the admin scope for users who are not administrators.
+func (ks *APIKeyService) checkScopes(ctx context.Context, userID uint, scopes []string) error {
+	if !slices.Contains(scopes, models.ScopeAdmin) {
+		return nil
+	}
+	user, err := ks.userRepo.FindByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to find user: %w", err)
+	}
+	if !slices.Contains(user.Roles, models.RoleAdmin) {
+		return fmt.Errorf("%s: %w", models.ScopeAdmin, ErrScopeNotAllowed)
+	}
+	return nil
+}
+
+func normalizeScopes(scopes []string) []string {
+	return slices.Compact(slices.Sorted(slices.Values(scopes)))
+}
+
+// apiKeySource exposes the API keys of a user to data subject requests.
+type apiKeySource struct {
+	apiKeyRepo repositories.APIKeyInterface
+}
+
+// NewAPIKeySource returns the DataSource of the API keys. Erasing it revokes every key.
+func NewAPIKeySource(apiKeyRepo repositories.APIKeyInterface) DataSource {
+	return &apiKeySource{
+		apiKeyRepo: apiKeyRepo,
+	}
+}
+
+func (s *apiKeySource) Name() string {
+	return "api_keys"
+}
+
+func (s *apiKeySource) Export(ctx context.Context, id uint) (any, error) {
+	return s.apiKeyRepo.List(ctx, id)
+}
+
+func (s *apiKeySource) Erase(ctx context.Context, id uint) error {
+	return s.apiKeyRepo.DeleteAll(ctx, id)
+}
@@ -0,0 +1,256 @@
+package services_test
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/ryanpujo/melius/internal/services"
+	"github.com/ryanpujo/melius/internal/utilities"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type APIKeyRepoMock struct {
+	mock.Mock
+}
+
+func (krm *APIKeyRepoMock) Create(ctx context.Context, key models.APIKey) error {
+	args := krm.Called(ctx, key)
+	return args.Error(0)
+}
+
+func (krm *APIKeyRepoMock) List(ctx context.Context, userID uint) ([]models.APIKey, error) {
+	args := krm.Called(ctx, userID)
+	return args.Get(0).([]models.APIKey), args.Error(1)
+}
+
+func (krm *APIKeyRepoMock) Find(ctx context.Context, userID uint, id string) (*models.APIKey, error) {
+	args := krm.Called(ctx, userID, id)
+	return args.Get(0).(*models.APIKey), args.Error(1)
+}
+
+func (krm *APIKeyRepoMock) FindByHash(ctx context.Context, hash string) (*models.APIKey, error) {
+	args := krm.Called(ctx, hash)
+	return args.Get(0).(*models.APIKey), args.Error(1)
+}
+
+func (krm *APIKeyRepoMock) Update(ctx context.Context, userID uint, id string, payload models.UpdateAPIKeyPayload) error {
+	args := krm.Called(ctx, userID, id, payload)
+	return args.Error(0)
+}
+
+func (krm *APIKeyRepoMock) Touch(ctx context.Context, id string) error {
+	args := krm.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (krm *APIKeyRepoMock) Delete(ctx context.Context, userID uint, id string) error {
+	args := krm.Called(ctx, userID, id)
+	return args.Error(0)
+}
+
+func (krm *APIKeyRepoMock) DeleteAll(ctx context.Context, userID uint) error {
+	args := krm.Called(ctx, userID)
+	return args.Error(0)
+}
+
+func TestCreateAPIKey(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	admin := user
+	admin.Roles = []string{models.RoleAdmin}
+
+	tableTest := map[string]struct {
+		payload models.APIKeyPayload
+		arrange func(krm *APIKeyRepoMock, urm *UserRepoMock)
+		assert  func(t *testing.T, key *models.CreatedAPIKey, err error)
+	}{
+		"success": {
+			payload: models.APIKeyPayload{Name: "ci", Scopes: []string{"write", "read", "read"}},
+			arrange: func(krm *APIKeyRepoMock, urm *UserRepoMock) {
+				krm.On("Create", mock.Anything, mock.Anything).Return(nil).Once()
+			},
+			assert: func(t *testing.T, key *models.CreatedAPIKey, err error) {
+				require.NoError(t, err)
+				require.True(t, strings.HasPrefix(key.Key, key.Prefix+"_"))
+				require.True(t, strings.HasPrefix(key.Prefix, models.APIKeyPrefix))
+				require.Equal(t, utilities.HashToken(key.Key), key.Hash)
+				require.Equal(t, []string{"read", "write"}, key.Scopes)
+				event := aud.last()
+				require.Equal(t, models.AuditAPIKeyCreate, event.Action)
+				require.Equal(t, key.ID, event.Details["key_id"])
+			},
+		},
+		"admin scope": {
+			payload: models.APIKeyPayload{Name: "ops", Scopes: []string{"read", "admin"}},
+			arrange: func(krm *APIKeyRepoMock, urm *UserRepoMock) {
+				urm.On("FindByID", mock.Anything, uint(1)).Return(&admin, nil).Once()
+				krm.On("Create", mock.Anything, mock.Anything).Return(nil).Once()
+			},
+			assert: func(t *testing.T, key *models.CreatedAPIKey, err error) {
+				require.NoError(t, err)
+				require.Equal(t, []string{"admin", "read"}, key.Scopes)
+			},
+		},
+		"admin scope without role": {
+			payload: models.APIKeyPayload{Name: "ops", Scopes: []string{"admin"}},
+			arrange: func(krm *APIKeyRepoMock, urm *UserRepoMock) {
+				urm.On("FindByID", mock.Anything, uint(1)).Return(&user, nil).Once()
+			},
+			assert: func(t *testing.T, key *models.CreatedAPIKey, err error) {
+				require.ErrorIs(t, err, services.ErrScopeNotAllowed)
+				require.Equal(t, models.AuditOutcomeFailure, aud.last().Outcome)
+			},
+		},
+		"expired": {
+			payload: models.APIKeyPayload{Name: "ci", Scopes: []string{"read"}, ExpiresAt: &past},
+			arrange: func(krm *APIKeyRepoMock, urm *UserRepoMock) {},
+			assert: func(t *testing.T, key *models.CreatedAPIKey, err error) {
+				require.ErrorIs(t, err, services.ErrInvalidExpiry)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			krm := new(APIKeyRepoMock)
+			urm := new(UserRepoMock)
+			apiKeyService := services.NewAPIKeyService(krm, urm, aud)
+			v.arrange(krm, urm)
+
+			key, err := apiKeyService.Create(context.Background(), 1, v.payload)
+
+			v.assert(t, key, err)
+			krm.AssertExpectations(t)
+		})
+	}
+}
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	const value = models.APIKeyPrefix + "abc_secret"
+	recently := time.Now().Add(-time.Second)
+	past := time.Now().Add(-time.Hour)
+	admin := user
+	admin.Roles = []string{models.RoleAdmin, "editor"}
+
+	tableTest := map[string]struct {
+		value   string
+		arrange func(krm *APIKeyRepoMock, urm *UserRepoMock)
+		assert  func(t *testing.T, krm *APIKeyRepoMock, roles []string, err error)
+	}{
+		"success": {
+			value: value,
+			arrange: func(krm *APIKeyRepoMock, urm *UserRepoMock) {
+				krm.On("FindByHash", mock.Anything, utilities.HashToken(value)).
+					Return(&models.APIKey{ID: "abc", UserID: 1, Scopes: []string{"read"}}, nil).Once()
+				urm.On("FindByID", mock.Anything, uint(1)).Return(&admin, nil).Once()
+				krm.On("Touch", mock.Anything, "abc").Return(nil).Once()
+			},
+			assert: func(t *testing.T, krm *APIKeyRepoMock, roles []string, err error) {
+				require.NoError(t, err)
+				// The key has no admin scope, so the admin role is dropped.
+				require.Equal(t, []string{"editor"}, roles)
+				krm.AssertExpectations(t)
+			},
+		},
+		"admin scope": {
+			value: value,
+			arrange: func(krm *APIKeyRepoMock, urm *UserRepoMock) {
+				krm.On("FindByHash", mock.Anything, utilities.HashToken(value)).
+					Return(&models.APIKey{ID: "abc", UserID: 1, Scopes: []string{"admin", "read"}, LastUsedAt: &recently}, nil).Once()
+				urm.On("FindByID", mock.Anything, uint(1)).Return(&admin, nil).Once()
+			},
+			assert: func(t *testing.T, krm *APIKeyRepoMock, roles []string, err error) {
+				require.NoError(t, err)
+				require.Equal(t, admin.Roles, roles)
+				// Used a second ago, the last use is not written again.
+				krm.AssertNotCalled(t, "Touch", mock.Anything, mock.Anything)
+			},
+		},
+		"wrong prefix": {
+			value:   "abc_secret",
+			arrange: func(krm *APIKeyRepoMock, urm *UserRepoMock) {},
+			assert: func(t *testing.T, krm *APIKeyRepoMock, roles []string, err error) {
+				require.ErrorIs(t, err, services.ErrAPIKeyInvalid)
+			},
+		},
+		"unknown": {
+			value: value,
+			arrange: func(krm *APIKeyRepoMock, urm *UserRepoMock) {
+				krm.On("FindByHash", mock.Anything, utilities.HashToken(value)).
+					Return((*models.APIKey)(nil), sql.ErrNoRows).Once()
+			},
+			assert: func(t *testing.T, krm *APIKeyRepoMock, roles []string, err error) {
+				require.ErrorIs(t, err, services.ErrAPIKeyInvalid)
+			},
+		},
+		"expired": {
+			value: value,
+			arrange: func(krm *APIKeyRepoMock, urm *UserRepoMock) {
+				krm.On("FindByHash", mock.Anything, utilities.HashToken(value)).
+					Return(&models.APIKey{ID: "abc", UserID: 1, ExpiresAt: &past}, nil).Once()
+			},
+			assert: func(t *testing.T, krm *APIKeyRepoMock, roles []string, err error) {
+				require.ErrorIs(t, err, services.ErrAPIKeyInvalid)
+			},
+		},
+		"closed account": {
+			value: value,
+			arrange: func(krm *APIKeyRepoMock, urm *UserRepoMock) {
+				krm.On("FindByHash", mock.Anything, utilities.HashToken(value)).
+					Return(&models.APIKey{ID: "abc", UserID: 1}, nil).Once()
+				urm.On("FindByID", mock.Anything, uint(1)).Return((*models.User)(nil), sql.ErrNoRows).Once()
+			},
+			assert: func(t *testing.T, krm *APIKeyRepoMock, roles []string, err error) {
+				require.ErrorIs(t, err, services.ErrAPIKeyInvalid)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			krm := new(APIKeyRepoMock)
+			urm := new(UserRepoMock)
+			apiKeyService := services.NewAPIKeyService(krm, urm, aud)
+			v.arrange(krm, urm)
+
+			principal, err := apiKeyService.Authenticate(context.Background(), v.value)
+
+			var roles []string
+			if principal != nil {
+				require.Equal(t, uint(1), principal.UserID)
+				require.Equal(t, "abc", principal.KeyID)
+				roles = principal.Roles
+			}
+			v.assert(t, krm, roles, err)
+		})
+	}
+}
+
+func TestUpdateAndDeleteAPIKey(t *testing.T) {
+	krm := new(APIKeyRepoMock)
+	apiKeyService := services.NewAPIKeyService(krm, urm, aud)
+	payload := models.UpdateAPIKeyPayload{Name: "ci", Scopes: []string{"write", "read"}}
+	normalized := models.UpdateAPIKeyPayload{Name: "ci", Scopes: []string{"read", "write"}}
+
+	krm.On("Update", mock.Anything, uint(1), "abc", normalized).Return(nil).Once()
+	krm.On("Find", mock.Anything, uint(1), "abc").Return(&models.APIKey{ID: "abc", Scopes: normalized.Scopes}, nil).Once()
+
+	key, err := apiKeyService.Update(context.Background(), 1, "abc", payload)
+
+	require.NoError(t, err)
+	require.Equal(t, normalized.Scopes, key.Scopes)
+	require.Equal(t, models.AuditAPIKeyUpdate, aud.last().Action)
+
+	krm.On("Delete", mock.Anything, uint(1), "abc").Return(sql.ErrNoRows).Once()
+
+	err = apiKeyService.Delete(context.Background(), 1, "abc")
+
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	event := aud.last()
+	require.Equal(t, models.AuditAPIKeyDelete, event.Action)
+	require.Equal(t, models.AuditOutcomeFailure, event.Outcome)
+}
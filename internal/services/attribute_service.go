@@ -0,0 +1,203 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/ryanpujo/melius/internal/repositories"
+)
+
+var ErrInvalidAttribute = errors.New("invalid attribute")
+
+var attributeName = regexp.MustCompile(`^[a-z][a-z0-9_]{0,99}$`)
+
+// AttributeInterface defines the administration of custom user attribute definitions.
+type AttributeInterface interface {
+	List(ctx context.Context) ([]models.AttributeDefinition, error)
+	Define(ctx context.Context, name string, payload models.AttributeDefinitionPayload) (*models.AttributeDefinition, error)
+	Delete(ctx context.Context, name string) error
+}
+
+// AttributeService implements the AttributeInterface.
+type AttributeService struct {
+	attrRepo repositories.AttributeInterface
+	auditor  Auditor
+}
+
+// NewAttributeService creates a new instance of AttributeService.
+func NewAttributeService(attrRepo repositories.AttributeInterface, auditor Auditor) *AttributeService {
+	return &AttributeService{
+		attrRepo: attrRepo,
+		auditor:  auditor,
+	}
+}
+
+// List returns every attribute definition.
+func (as *AttributeService) List(ctx context.Context) ([]models.AttributeDefinition, error) {
+	defs, err := as.attrRepo.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list attributes: %w", err)
+	}
+	return defs, nil
+}
+
+// Define creates or replaces the definition of the attribute called name.
+func (as *AttributeService) Define(ctx context.Context, name string, payload models.AttributeDefinitionPayload) (_ *models.AttributeDefinition, err error) {
+	defer func() {
+		audit(ctx, as.auditor, models.AuditAttributeDefine, 0, err, map[string]any{"name": name})
+	}()
+
+	if !attributeName.MatchString(name) {
+		return nil, fmt.Errorf("%w: name must be lower case letters, digits and underscores", ErrInvalidAttribute)
+	}
+	if payload.Pattern != "" {
+		if payload.Type != models.AttributeString {
+			return nil, fmt.Errorf("%w: pattern only applies to string attributes", ErrInvalidAttribute)
+		}
+		if _, err := regexp.Compile(payload.Pattern); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidAttribute, err)
+		}
+	}
+	// Tokens are presented to other services, so only public attributes may become claims.
+	if payload.Claim && payload.Visibility != models.VisibilityPublic {
+		return nil, fmt.Errorf("%w: only public attributes can be token claims", ErrInvalidAttribute)
+	}
+
+	def := models.AttributeDefinition{
+		Name:       name,
+		Type:       payload.Type,
+		Required:   payload.Required,
+		Pattern:    payload.Pattern,
+		Visibility: payload.Visibility,
+		Claim:      payload.Claim,
+	}
+	if err := as.attrRepo.Upsert(ctx, def); err != nil {
+		return nil, fmt.Errorf("failed to define attribute: %w", err)
+	}
+	return &def, nil
+}
+
+// Delete removes the definition of the attribute called name.
+func (as *AttributeService) Delete(ctx context.Context, name string) error {
+	err := as.attrRepo.Delete(ctx, name)
+	audit(ctx, as.auditor, models.AuditAttributeDelete, 0, err, map[string]any{"name": name})
+	if err != nil {
+		return fmt.Errorf("failed to delete attribute: %w", err)
+	}
+	return nil
+}
+
+// validateAttributes checks changes against the attribute definitions and checks that
+// attributes, the values after the changes are applied, hold every required attribute.
+// Admin-only attributes can only be changed, and are only required, when admin is set.
+func validateAttributes(defs []models.AttributeDefinition, attributes, changes map[string]any, admin bool) error {
+	byName := make(map[string]models.AttributeDefinition, len(defs))
+	for _, def := range defs {
+		byName[def.Name] = def
+	}
+
+	for name, value := range changes {
+		def, ok := byName[name]
+		if !ok {
+			return fmt.Errorf("%w: unknown attribute '%s'", ErrInvalidAttribute, name)
+		}
+		if def.Visibility == models.VisibilityAdmin && !admin {
+			return fmt.Errorf("%w: attribute '%s' can only be set by an administrator", ErrInvalidAttribute, name)
+		}
+		if value == nil {
+			continue
+		}
+		if err := checkAttributeValue(def, value); err != nil {
+			return err
+		}
+	}
+
+	for _, def := range defs {
+		if !def.Required || (def.Visibility == models.VisibilityAdmin && !admin) {
+			continue
+		}
+		if value, ok := attributes[def.Name]; !ok || value == nil {
+			return fmt.Errorf("%w: attribute '%s' is required", ErrInvalidAttribute, def.Name)
+		}
+	}
+	return nil
+}
+
+// checkAttributeValue checks the type of value and, for strings, that the whole value matches the pattern.
+func checkAttributeValue(def models.AttributeDefinition, value any) error {
+	switch def.Type {
+	case models.AttributeString:
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%w: attribute '%s' must be a string", ErrInvalidAttribute, def.Name)
+		}
+		if def.Pattern != "" {
+			matched, err := regexp.MatchString("^(?:"+def.Pattern+")$", s)
+			if err != nil || !matched {
+				return fmt.Errorf("%w: attribute '%s' does not match '%s'", ErrInvalidAttribute, def.Name, def.Pattern)
+			}
+		}
+	case models.AttributeNumber:
+		switch value.(type) {
+		case float64, float32, int, int32, int64, uint, uint32, uint64:
+		default:
+			return fmt.Errorf("%w: attribute '%s' must be a number", ErrInvalidAttribute, def.Name)
+		}
+	case models.AttributeBoolean:
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%w: attribute '%s' must be a boolean", ErrInvalidAttribute, def.Name)
+		}
+	}
+	return nil
+}
+
+// mergeAttributes applies changes to a copy of attributes. A nil change removes the attribute.
+func mergeAttributes(attributes, changes map[string]any) map[string]any {
+	merged := maps.Clone(attributes)
+	if merged == nil {
+		merged = map[string]any{}
+	}
+	for name, value := range changes {
+		if value == nil {
+			delete(merged, name)
+			continue
+		}
+		merged[name] = value
+	}
+	return merged
+}
+
+// visibleAttributes returns the defined attributes a user may see.
+// Admin-only attributes are dropped unless admin is set.
+func visibleAttributes(defs []models.AttributeDefinition, attributes map[string]any, admin bool) map[string]any {
+	visible := map[string]any{}
+	for _, def := range defs {
+		value, ok := attributes[def.Name]
+		if !ok || (def.Visibility == models.VisibilityAdmin && !admin) {
+			continue
+		}
+		visible[def.Name] = value
+	}
+	return visible
+}
+
+// claimAttributes returns the attributes to issue as token claims.
+func claimAttributes(defs []models.AttributeDefinition, attributes map[string]any) map[string]any {
+	claims := map[string]any{}
+	for _, def := range defs {
+		if value, ok := attributes[def.Name]; ok && def.Claim {
+			claims[def.Name] = value
+		}
+	}
+	return claims
+}
+
+// attributeNames returns the sorted names of the attributes in changes.
+func attributeNames(changes map[string]any) []string {
+	return slices.Sorted(maps.Keys(changes))
+}
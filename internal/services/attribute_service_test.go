@@ -0,0 +1,223 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/ryanpujo/melius/internal/services"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type AttrRepoMock struct {
+	mock.Mock
+}
+
+func (arm *AttrRepoMock) List(ctx context.Context) ([]models.AttributeDefinition, error) {
+	args := arm.Called(ctx)
+	return args.Get(0).([]models.AttributeDefinition), args.Error(1)
+}
+
+func (arm *AttrRepoMock) Upsert(ctx context.Context, def models.AttributeDefinition) error {
+	args := arm.Called(ctx, def)
+	return args.Error(0)
+}
+
+func (arm *AttrRepoMock) Delete(ctx context.Context, name string) error {
+	args := arm.Called(ctx, name)
+	return args.Error(0)
+}
+
+var attributeDefs = []models.AttributeDefinition{
+	{Name: "department", Type: models.AttributeString, Required: true, Pattern: "[a-z]+", Visibility: models.VisibilityPublic, Claim: true},
+	{Name: "age", Type: models.AttributeNumber, Visibility: models.VisibilityPrivate},
+	{Name: "vip", Type: models.AttributeBoolean, Required: true, Visibility: models.VisibilityAdmin},
+}
+
+func TestDefineAttribute(t *testing.T) {
+	tableTest := map[string]struct {
+		name    string
+		payload models.AttributeDefinitionPayload
+		arrange func()
+		assert  func(t *testing.T, def *models.AttributeDefinition, err error)
+	}{
+		"success": {
+			name:    "department",
+			payload: models.AttributeDefinitionPayload{Type: models.AttributeString, Pattern: "[a-z]+", Visibility: models.VisibilityPublic, Claim: true},
+			arrange: func() {
+				arm.On("Upsert", mock.Anything, mock.Anything).Return(nil).Once()
+			},
+			assert: func(t *testing.T, def *models.AttributeDefinition, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "department", def.Name)
+			},
+		},
+		"invalid name": {
+			name:    "Department!",
+			payload: models.AttributeDefinitionPayload{Type: models.AttributeString, Visibility: models.VisibilityPublic},
+			arrange: func() {},
+			assert: func(t *testing.T, def *models.AttributeDefinition, err error) {
+				require.ErrorIs(t, err, services.ErrInvalidAttribute)
+				require.Nil(t, def)
+			},
+		},
+		"invalid pattern": {
+			name:    "department",
+			payload: models.AttributeDefinitionPayload{Type: models.AttributeString, Pattern: "[a-z", Visibility: models.VisibilityPublic},
+			arrange: func() {},
+			assert: func(t *testing.T, def *models.AttributeDefinition, err error) {
+				require.ErrorIs(t, err, services.ErrInvalidAttribute)
+			},
+		},
+		"pattern on number": {
+			name:    "age",
+			payload: models.AttributeDefinitionPayload{Type: models.AttributeNumber, Pattern: "[0-9]+", Visibility: models.VisibilityPublic},
+			arrange: func() {},
+			assert: func(t *testing.T, def *models.AttributeDefinition, err error) {
+				require.ErrorIs(t, err, services.ErrInvalidAttribute)
+			},
+		},
+		"private claim": {
+			name:    "age",
+			payload: models.AttributeDefinitionPayload{Type: models.AttributeNumber, Visibility: models.VisibilityPrivate, Claim: true},
+			arrange: func() {},
+			assert: func(t *testing.T, def *models.AttributeDefinition, err error) {
+				require.ErrorIs(t, err, services.ErrInvalidAttribute)
+			},
+		},
+		"failed to save": {
+			name:    "department",
+			payload: models.AttributeDefinitionPayload{Type: models.AttributeString, Visibility: models.VisibilityPublic},
+			arrange: func() {
+				arm.On("Upsert", mock.Anything, mock.Anything).Return(errors.New("failed")).Once()
+			},
+			assert: func(t *testing.T, def *models.AttributeDefinition, err error) {
+				require.Error(t, err)
+				require.Nil(t, def)
+			},
+		},
+	}
+
+	attrService := services.NewAttributeService(arm, aud)
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			def, err := attrService.Define(context.Background(), v.name, v.payload)
+
+			v.assert(t, def, err)
+		})
+	}
+}
+
+func TestWriteUserAttributes(t *testing.T) {
+	tableTest := map[string]struct {
+		attributes map[string]any
+		assert     func(t *testing.T, id uint, err error)
+	}{
+		"valid": {
+			attributes: map[string]any{"department": "sales", "age": float64(30)},
+			assert: func(t *testing.T, id uint, err error) {
+				require.NoError(t, err)
+				require.Equal(t, uint(1), id)
+			},
+		},
+		"missing required": {
+			attributes: map[string]any{"age": float64(30)},
+			assert: func(t *testing.T, id uint, err error) {
+				require.ErrorIs(t, err, services.ErrInvalidAttribute)
+			},
+		},
+		"unknown attribute": {
+			attributes: map[string]any{"department": "sales", "shoe_size": float64(42)},
+			assert: func(t *testing.T, id uint, err error) {
+				require.ErrorIs(t, err, services.ErrInvalidAttribute)
+			},
+		},
+		"wrong type": {
+			attributes: map[string]any{"department": "sales", "age": "thirty"},
+			assert: func(t *testing.T, id uint, err error) {
+				require.ErrorIs(t, err, services.ErrInvalidAttribute)
+			},
+		},
+		"pattern mismatch": {
+			attributes: map[string]any{"department": "Sales 1"},
+			assert: func(t *testing.T, id uint, err error) {
+				require.ErrorIs(t, err, services.ErrInvalidAttribute)
+			},
+		},
+		"admin only": {
+			attributes: map[string]any{"department": "sales", "vip": true},
+			assert: func(t *testing.T, id uint, err error) {
+				require.ErrorIs(t, err, services.ErrInvalidAttribute)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			crm.On("IsReserved", mock.Anything, mock.Anything, mock.Anything, uint(0)).Return(false, nil).Twice()
+			arm.On("List", mock.Anything).Return(attributeDefs, nil).Once()
+			crm.On("Write", mock.Anything, mock.Anything).Return(1, nil).Maybe().Once()
+
+			payload := userPayload
+			payload.Attributes = v.attributes
+			id, err := credService.Write(context.Background(), payload)
+
+			v.assert(t, id, err)
+		})
+	}
+	crm.ExpectedCalls = nil
+}
+
+func TestUpdateProfileAttributes(t *testing.T) {
+	stored := user
+	stored.Attributes = map[string]any{"department": "sales", "age": float64(30), "vip": true}
+
+	tableTest := map[string]struct {
+		changes map[string]any
+		assert  func(t *testing.T, actual *models.User, err error)
+	}{
+		"merge": {
+			changes: map[string]any{"age": nil, "department": "support"},
+			assert: func(t *testing.T, actual *models.User, err error) {
+				require.NoError(t, err)
+				// Admin-only attributes are hidden from the user.
+				require.NotContains(t, actual.Attributes, "vip")
+			},
+		},
+		"remove required": {
+			changes: map[string]any{"department": nil},
+			assert: func(t *testing.T, actual *models.User, err error) {
+				require.ErrorIs(t, err, services.ErrInvalidAttribute)
+			},
+		},
+		"set admin only": {
+			changes: map[string]any{"vip": false},
+			assert: func(t *testing.T, actual *models.User, err error) {
+				require.ErrorIs(t, err, services.ErrInvalidAttribute)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			urm.On("FindByID", mock.Anything, uint(1)).Return(&stored, nil).Once()
+			arm.On("List", mock.Anything).Return(attributeDefs, nil).Once()
+			urm.On("Update", mock.Anything, uint(1), models.UpdateUserPayload{
+				Attributes: map[string]any{"department": "support", "vip": true},
+			}).Return(nil).Maybe().Once()
+			urm.On("FindByID", mock.Anything, uint(1)).Return(&stored, nil).Maybe().Once()
+			arm.On("List", mock.Anything).Return(attributeDefs, nil).Maybe().Once()
+
+			actual, err := userService.UpdateProfile(context.Background(), 1, models.UpdateUserPayload{Attributes: v.changes})
+
+			v.assert(t, actual, err)
+
+			urm.ExpectedCalls = nil
+			arm.ExpectedCalls = nil
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/ryanpujo/melius/internal/repositories"
+	"github.com/ryanpujo/melius/internal/requestinfo"
+	"github.com/ryanpujo/melius/internal/utilities"
+)
+
+// Auditor records security-relevant events in the audit log.
+type Auditor interface {
+	// Record completes event with the time and details of the request found in ctx and
+	// appends it to the log. Failures are logged, they never fail the audited operation.
+	Record(ctx context.Context, event models.AuditEvent)
+}
+
+// AuditInterface gives administrators access to the audit log.
+type AuditInterface interface {
+	Auditor
+	List(ctx context.Context, query models.AuditQuery) (*models.AuditPage, error)
+	Verify(ctx context.Context) (*models.AuditVerification, error)
+}
+
+const (
+	// auditPageSize is the number of entries listed when the query sets no limit.
+	auditPageSize = 50
+	// auditVerifyBatch is the number of entries read at once while verifying the chain.
+	auditVerifyBatch = 500
+)
+
+// AuditService implements the AuditInterface.
+type AuditService struct {
+	auditRepo repositories.AuditInterface
+}
+
+// NewAuditService creates a new instance of AuditService.
+func NewAuditService(auditRepo repositories.AuditInterface) *AuditService {
+	return &AuditService{
+		auditRepo: auditRepo,
+	}
+}
+
+// Record appends event to the audit log. The actor defaults to the authenticated user,
+// or to the administrator impersonating them.
+func (as *AuditService) Record(ctx context.Context, event models.AuditEvent) {
+	info := requestinfo.FromContext(ctx)
+	if event.ActorID == nil {
+		if id := requestinfo.ActorID(ctx); id != 0 {
+			event.ActorID = &id
+		} else if id := requestinfo.UserID(ctx); id != 0 {
+			event.ActorID = &id
+		}
+	}
+
+	salt, err := utilities.RandomToken(16)
+	if err != nil {
+		log.Printf("failed to record audit event %s: %v", event.Action, err)
+		return
+	}
+
+	event.OccurredAt = time.Now().UTC().Truncate(time.Second)
+	event.RequestID = info.RequestID
+	event.IP = optionalString(info.IP)
+	event.UserAgent = optionalString(info.UserAgent)
+	event.Salt = &salt
+	event.PersonalDigest = models.AuditPersonalDigest(salt, info.IP, info.UserAgent)
+
+	// The entry is written even when the request is cancelled right after the operation.
+	if err := as.auditRepo.Append(context.WithoutCancel(ctx), &event); err != nil {
+		log.Printf("failed to record audit event %s: %v", event.Action, err)
+	}
+}
+
+// List returns a page of the entries matching query, newest first.
+func (as *AuditService) List(ctx context.Context, query models.AuditQuery) (*models.AuditPage, error) {
+	if query.Limit == 0 {
+		query.Limit = auditPageSize
+	}
+
+	events, err := as.auditRepo.List(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit log: %w", err)
+	}
+
+	page := &models.AuditPage{Events: events}
+	if len(events) == query.Limit {
+		page.NextCursor = events[len(events)-1].ID
+	}
+	return page, nil
+}
+
+// Verify walks the whole audit log and checks the hash chain. It stops at the first
+// entry that was altered, or whose predecessor was altered or removed.
+func (as *AuditService) Verify(ctx context.Context) (*models.AuditVerification, error) {
+	result := &models.AuditVerification{Valid: true}
+
+	var (
+		afterID  uint64
+		prevHash string
+	)
+	for {
+		events, err := as.auditRepo.Range(ctx, afterID, auditVerifyBatch)
+		if err != nil {
+			return nil, fmt.Errorf("failed to verify audit log: %w", err)
+		}
+
+		for _, event := range events {
+			if !validAuditEvent(event, prevHash) {
+				id := event.ID
+				result.Valid = false
+				result.BrokenAt = &id
+				return result, nil
+			}
+			result.Checked++
+			prevHash = event.Hash
+			afterID = event.ID
+		}
+
+		if len(events) < auditVerifyBatch {
+			return result, nil
+		}
+	}
+}
+
+// validAuditEvent reports whether event follows the entry hashed prevHash and is unaltered.
+// The personal fields can only be checked until they are erased together with the salt.
+func validAuditEvent(event models.AuditEvent, prevHash string) bool {
+	if event.PrevHash != prevHash || event.ChainHash() != event.Hash {
+		return false
+	}
+	if event.Salt == nil {
+		return true
+	}
+
+	var ip, userAgent string
+	if event.IP != nil {
+		ip = *event.IP
+	}
+	if event.UserAgent != nil {
+		userAgent = *event.UserAgent
+	}
+	return models.AuditPersonalDigest(*event.Salt, ip, userAgent) == event.PersonalDigest
+}
+
+// audit records the outcome of action performed on the user identified by subject.
+// A subject of 0 means the action does not concern a known user.
+func audit(ctx context.Context, auditor Auditor, action string, subject uint, err error, details map[string]any) {
+	event := models.AuditEvent{
+		Action:  action,
+		Outcome: models.AuditOutcomeSuccess,
+		Details: details,
+	}
+	if err != nil {
+		event.Outcome = models.AuditOutcomeFailure
+	}
+	if subject != 0 {
+		event.SubjectID = &subject
+	}
+	auditor.Record(ctx, event)
+}
+
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// auditSource exposes the audit entries of a user to data subject requests.
+type auditSource struct {
+	auditRepo repositories.AuditInterface
+}
+
+// NewAuditSource returns the DataSource of the audit log. Erasing it keeps the entries
+// and only removes their personal fields, so the log stays complete and verifiable.
+func NewAuditSource(auditRepo repositories.AuditInterface) DataSource {
+	return &auditSource{
+		auditRepo: auditRepo,
+	}
+}
+
+func (s *auditSource) Name() string {
+	return "audit_log"
+}
+
+func (s *auditSource) Export(ctx context.Context, id uint) (any, error) {
+	return s.auditRepo.ForUser(ctx, id)
+}
+
+func (s *auditSource) Erase(ctx context.Context, id uint) error {
+	return s.auditRepo.EraseUser(ctx, id)
+}
@@ -0,0 +1,253 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/ryanpujo/melius/internal/requestinfo"
+	"github.com/ryanpujo/melius/internal/services"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// AuditorStub keeps the recorded events in memory.
+type AuditorStub struct {
+	mu     sync.Mutex
+	events []models.AuditEvent
+}
+
+func (as *AuditorStub) Record(ctx context.Context, event models.AuditEvent) {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	as.events = append(as.events, event)
+}
+
+func (as *AuditorStub) last() models.AuditEvent {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	return as.events[len(as.events)-1]
+}
+
+type AuditRepoMock struct {
+	mock.Mock
+}
+
+func (arm *AuditRepoMock) Append(ctx context.Context, event *models.AuditEvent) error {
+	args := arm.Called(ctx, event)
+	return args.Error(0)
+}
+
+func (arm *AuditRepoMock) List(ctx context.Context, query models.AuditQuery) ([]models.AuditEvent, error) {
+	args := arm.Called(ctx, query)
+	return args.Get(0).([]models.AuditEvent), args.Error(1)
+}
+
+func (arm *AuditRepoMock) Range(ctx context.Context, afterID uint64, limit int) ([]models.AuditEvent, error) {
+	args := arm.Called(ctx, afterID, limit)
+	return args.Get(0).([]models.AuditEvent), args.Error(1)
+}
+
+func (arm *AuditRepoMock) ForUser(ctx context.Context, id uint) ([]models.AuditEvent, error) {
+	args := arm.Called(ctx, id)
+	return args.Get(0).([]models.AuditEvent), args.Error(1)
+}
+
+func (arm *AuditRepoMock) EraseUser(ctx context.Context, id uint) error {
+	args := arm.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (arm *AuditRepoMock) CountFailures(ctx context.Context, subjectID uint, since time.Time, actions ...string) (int, error) {
+	args := arm.Called(ctx, subjectID, since, actions)
+	return args.Int(0), args.Error(1)
+}
+
+// chain links events the way the repository does on append.
+func chain(events []models.AuditEvent) []models.AuditEvent {
+	prev := ""
+	for i := range events {
+		events[i].ID = uint64(i + 1)
+		events[i].PrevHash = prev
+		events[i].Hash = events[i].ChainHash()
+		prev = events[i].Hash
+	}
+	return events
+}
+
+func TestRecord(t *testing.T) {
+	auditRepo := new(AuditRepoMock)
+	auditService := services.NewAuditService(auditRepo)
+
+	ctx := requestinfo.NewContext(context.Background(), requestinfo.Info{
+		IP:        "203.0.113.7",
+		UserAgent: "curl/8.0",
+		RequestID: "req-1",
+	})
+	subject := uint(1)
+
+	auditRepo.On("Append", mock.Anything, mock.MatchedBy(func(event *models.AuditEvent) bool {
+		return event.Action == models.AuditLogin &&
+			event.RequestID == "req-1" &&
+			*event.IP == "203.0.113.7" &&
+			event.PersonalDigest == models.AuditPersonalDigest(*event.Salt, "203.0.113.7", "curl/8.0") &&
+			!event.OccurredAt.IsZero()
+	})).Return(nil).Once()
+
+	auditService.Record(ctx, models.AuditEvent{
+		SubjectID: &subject,
+		Action:    models.AuditLogin,
+		Outcome:   models.AuditOutcomeSuccess,
+	})
+
+	auditRepo.AssertExpectations(t)
+}
+
+func TestListAudit(t *testing.T) {
+	auditRepo := new(AuditRepoMock)
+	auditService := services.NewAuditService(auditRepo)
+
+	tableTest := map[string]struct {
+		query   models.AuditQuery
+		arrange func()
+		assert  func(t *testing.T, page *models.AuditPage, err error)
+	}{
+		"full page": {
+			query: models.AuditQuery{Limit: 2},
+			arrange: func() {
+				auditRepo.On("List", mock.Anything, models.AuditQuery{Limit: 2}).
+					Return([]models.AuditEvent{{ID: 9}, {ID: 8}}, nil).Once()
+			},
+			assert: func(t *testing.T, page *models.AuditPage, err error) {
+				require.NoError(t, err)
+				require.Equal(t, uint64(8), page.NextCursor)
+			},
+		},
+		"last page": {
+			arrange: func() {
+				auditRepo.On("List", mock.Anything, models.AuditQuery{Limit: 50}).
+					Return([]models.AuditEvent{{ID: 1}}, nil).Once()
+			},
+			assert: func(t *testing.T, page *models.AuditPage, err error) {
+				require.NoError(t, err)
+				require.Zero(t, page.NextCursor)
+				require.Len(t, page.Events, 1)
+			},
+		},
+		"failed": {
+			query: models.AuditQuery{Limit: 2},
+			arrange: func() {
+				auditRepo.On("List", mock.Anything, models.AuditQuery{Limit: 2}).
+					Return([]models.AuditEvent(nil), errors.New("failed")).Once()
+			},
+			assert: func(t *testing.T, page *models.AuditPage, err error) {
+				require.Error(t, err)
+				require.Nil(t, page)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			page, err := auditService.List(context.Background(), v.query)
+
+			v.assert(t, page, err)
+		})
+	}
+}
+
+func TestVerifyAudit(t *testing.T) {
+	salt := "salt"
+	ip := "203.0.113.7"
+	events := func() []models.AuditEvent {
+		return chain([]models.AuditEvent{
+			{Action: models.AuditRegister, Outcome: models.AuditOutcomeSuccess, Salt: &salt, IP: &ip,
+				PersonalDigest: models.AuditPersonalDigest(salt, ip, "")},
+			{Action: models.AuditLogin, Outcome: models.AuditOutcomeFailure, PersonalDigest: "erased"},
+			{Action: models.AuditLogin, Outcome: models.AuditOutcomeSuccess, Details: map[string]any{"n": 1}},
+		})
+	}
+
+	tableTest := map[string]struct {
+		events func() []models.AuditEvent
+		assert func(t *testing.T, result *models.AuditVerification)
+	}{
+		"valid": {
+			events: events,
+			assert: func(t *testing.T, result *models.AuditVerification) {
+				require.True(t, result.Valid)
+				require.Equal(t, 3, result.Checked)
+			},
+		},
+		"altered entry": {
+			events: func() []models.AuditEvent {
+				e := events()
+				e[1].Outcome = models.AuditOutcomeSuccess
+				return e
+			},
+			assert: func(t *testing.T, result *models.AuditVerification) {
+				require.False(t, result.Valid)
+				require.Equal(t, uint64(2), *result.BrokenAt)
+			},
+		},
+		"removed entry": {
+			events: func() []models.AuditEvent {
+				e := events()
+				return []models.AuditEvent{e[0], e[2]}
+			},
+			assert: func(t *testing.T, result *models.AuditVerification) {
+				require.False(t, result.Valid)
+				require.Equal(t, uint64(3), *result.BrokenAt)
+			},
+		},
+		"altered personal field": {
+			events: func() []models.AuditEvent {
+				e := events()
+				forged := "198.51.100.1"
+				e[0].IP = &forged
+				return e
+			},
+			assert: func(t *testing.T, result *models.AuditVerification) {
+				require.False(t, result.Valid)
+				require.Equal(t, uint64(1), *result.BrokenAt)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			auditRepo := new(AuditRepoMock)
+			auditService := services.NewAuditService(auditRepo)
+			auditRepo.On("Range", mock.Anything, uint64(0), mock.Anything).Return(v.events(), nil).Once()
+
+			result, err := auditService.Verify(context.Background())
+
+			require.NoError(t, err)
+			v.assert(t, result)
+		})
+	}
+}
+
+func TestRecordImpersonation(t *testing.T) {
+	auditRepo := new(AuditRepoMock)
+	auditService := services.NewAuditService(auditRepo)
+
+	// While impersonating, events are attributed to the administrator rather than the user.
+	ctx := context.WithValue(context.WithValue(context.Background(), "user_id", uint(1)), "actor_id", uint(2))
+
+	auditRepo.On("Append", mock.Anything, mock.MatchedBy(func(event *models.AuditEvent) bool {
+		return event.ActorID != nil && *event.ActorID == 2
+	})).Return(nil).Once()
+
+	auditService.Record(ctx, models.AuditEvent{
+		Action:  models.AuditSessionRevoke,
+		Outcome: models.AuditOutcomeSuccess,
+	})
+
+	auditRepo.AssertExpectations(t)
+}
@@ -2,7 +2,9 @@ package services_test
 
 import (
 	"context"
+	"database/sql"
 	"errors"
+	"fmt"
 	"os"
 	"testing"
 
@@ -26,9 +28,32 @@ func (crm *CredRepoMock) FindByUsername(ctx context.Context, username string) (*
 	return args.Get(0).(*models.User), args.Error(1)
 }
 
+func (crm *CredRepoMock) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	args := crm.Called(ctx, email)
+	return args.Get(0).(*models.User), args.Error(1)
+}
+
+func (crm *CredRepoMock) FindClosed(ctx context.Context, login string) (*models.User, error) {
+	args := crm.Called(ctx, login)
+	return args.Get(0).(*models.User), args.Error(1)
+}
+
+func (crm *CredRepoMock) IsReserved(ctx context.Context, kind, value string, userID uint) (bool, error) {
+	args := crm.Called(ctx, kind, value, userID)
+	return args.Bool(0), args.Error(1)
+}
+
 var (
 	credService       services.CredentialService
+	userService       *services.UserService
 	crm               *CredRepoMock
+	urm               *UserRepoMock
+	arm               *AttrRepoMock
+	mm                *MailerMock
+	aud               *AuditorStub
+	srm               *SessionRepoMock
+	lgm               *LoginGuardMock
+	krm               *APIKeyRepoMock
 	hashFunc          = services.HashPassword
 	compareFunc       = services.CompareHashAndPassword
 	credentialPayload = models.CredentialPayload{
@@ -48,6 +73,7 @@ var (
 		CredentialPayload: credentialPayload,
 	}
 	user = models.User{
+		ID:         1,
 		FirstName:  "Ryan",
 		LastName:   "Pujo",
 		Credential: credential,
@@ -56,7 +82,15 @@ var (
 
 func TestMain(m *testing.M) {
 	crm = new(CredRepoMock)
-	credService = *services.NewCredentialService(crm)
+	urm = new(UserRepoMock)
+	mm = new(MailerMock)
+	arm = new(AttrRepoMock)
+	aud = new(AuditorStub)
+	srm = new(SessionRepoMock)
+	lgm = new(LoginGuardMock)
+	krm = new(APIKeyRepoMock)
+	credService = *services.NewCredentialService(crm, urm, arm, srm, lgm, aud)
+	userService = services.NewUserService(crm, urm, arm, srm, krm, lgm, mm, aud)
 	os.Exit(m.Run())
 }
 
@@ -68,6 +102,8 @@ func TestWriteUser(t *testing.T) {
 	}{
 		"success": {
 			arrange: func() {
+				crm.On("IsReserved", mock.Anything, mock.Anything, mock.Anything, uint(0)).Return(false, nil).Twice()
+				arm.On("List", mock.Anything).Return([]models.AttributeDefinition{}, nil).Once()
 				crm.On("Write", mock.Anything, mock.Anything).Return(1, nil).Once()
 			},
 			assert: func(t *testing.T, id uint, err error) {
@@ -78,6 +114,8 @@ func TestWriteUser(t *testing.T) {
 		},
 		"failed": {
 			arrange: func() {
+				crm.On("IsReserved", mock.Anything, mock.Anything, mock.Anything, uint(0)).Return(false, nil).Twice()
+				arm.On("List", mock.Anything).Return([]models.AttributeDefinition{}, nil).Once()
 				crm.On("Write", mock.Anything, mock.Anything).Return(0, errors.New("failed")).Once()
 			},
 			assert: func(t *testing.T, id uint, err error) {
@@ -88,6 +126,8 @@ func TestWriteUser(t *testing.T) {
 		},
 		"bcrypt failed": {
 			arrange: func() {
+				crm.On("IsReserved", mock.Anything, mock.Anything, mock.Anything, uint(0)).Return(false, nil).Twice()
+				arm.On("List", mock.Anything).Return([]models.AttributeDefinition{}, nil).Once()
 				services.HashPassword = func(password string) (string, error) {
 					return "", errors.New("failed to hash")
 				}
@@ -100,13 +140,44 @@ func TestWriteUser(t *testing.T) {
 				services.HashPassword = hashFunc
 			},
 		},
+		"canonical identifiers": {
+			arrange: func() {
+				crm.On("IsReserved", mock.Anything, mock.Anything, mock.Anything, uint(0)).Return(false, nil).Twice()
+				arm.On("List", mock.Anything).Return([]models.AttributeDefinition{}, nil).Once()
+				crm.On("Write", mock.Anything, mock.MatchedBy(func(payload models.UserPayload) bool {
+					return payload.CredentialPayload.Username == "ryanpujo" &&
+						payload.CredentialPayload.Email == "ryanpujo@gmail.com"
+				})).Return(1, nil).Once()
+			},
+			assert: func(t *testing.T, id uint, err error) {
+				require.NoError(t, err)
+				require.Equal(t, uint(1), id)
+			},
+			teardown: func() {},
+		},
+		"username reserved": {
+			arrange: func() {
+				crm.On("IsReserved", mock.Anything, models.IdentifierUsername, "ryanpujo", uint(0)).Return(true, nil).Once()
+			},
+			assert: func(t *testing.T, id uint, err error) {
+				require.ErrorIs(t, err, services.ErrIdentifierReserved)
+				require.Zero(t, id)
+			},
+			teardown: func() {},
+		},
 	}
 
 	for key, v := range tableTest {
 		t.Run(key, func(t *testing.T) {
 			v.arrange()
 
-			id, err := credService.Write(context.Background(), userPayload)
+			payload := userPayload
+			if key == "canonical identifiers" {
+				payload.CredentialPayload.Username = "RyanPujo"
+				payload.CredentialPayload.Email = " RyanPujo@GMAIL.com"
+			}
+
+			id, err := credService.Write(context.Background(), payload)
 
 			v.assert(t, id, err)
 
@@ -152,6 +223,10 @@ func TestLogin(t *testing.T) {
 		"success": {
 			arrange: func() {
 				crm.On("FindByUsername", mock.Anything, mock.Anything).Return(&user, nil).Once()
+				arm.On("List", mock.Anything).Return([]models.AttributeDefinition{}, nil).Once()
+				srm.On("Create", mock.Anything, mock.Anything).Return(nil).Once()
+				lgm.On("Check", mock.Anything, &user).Return(allowed, nil).Once()
+				lgm.On("Succeeded", mock.Anything, &user).Once()
 				services.CompareHashAndPassword = func(hash, plain string) error {
 					return nil
 				}
@@ -159,6 +234,10 @@ func TestLogin(t *testing.T) {
 			assert: func(t *testing.T, jwt string, err error) {
 				require.NoError(t, err)
 				require.NotZero(t, jwt)
+				event := aud.last()
+				require.Equal(t, models.AuditLogin, event.Action)
+				require.Equal(t, models.AuditOutcomeSuccess, event.Outcome)
+				require.Equal(t, uint(1), *event.SubjectID)
 			},
 			teardown: func() {
 				services.CompareHashAndPassword = compareFunc
@@ -172,6 +251,9 @@ func TestLogin(t *testing.T) {
 			assert: func(t *testing.T, jwt string, err error) {
 				require.Error(t, err)
 				require.Zero(t, jwt)
+				event := aud.last()
+				require.Equal(t, models.AuditOutcomeFailure, event.Outcome)
+				require.Nil(t, event.SubjectID)
 			},
 			teardown: func() {},
 		},
@@ -185,6 +267,9 @@ func TestLogin(t *testing.T) {
 			assert: func(t *testing.T, jwt string, err error) {
 				require.Error(t, err)
 				require.Zero(t, jwt)
+				event := aud.last()
+				require.Equal(t, models.AuditOutcomeFailure, event.Outcome)
+				require.Equal(t, uint(1), *event.SubjectID)
 			},
 			teardown: func() {
 				services.CompareHashAndPassword = compareFunc
@@ -208,3 +293,79 @@ func TestLogin(t *testing.T) {
 		})
 	}
 }
+
+func TestLoginByEmail(t *testing.T) {
+	tableTest := map[string]struct {
+		arrange  func()
+		assert   func(t *testing.T, jwt string, err error)
+		teardown func()
+	}{
+		"success": {
+			arrange: func() {
+				crm.On("FindByEmail", mock.Anything, "ryanpujo@gmail.com").Return(&user, nil).Once()
+				arm.On("List", mock.Anything).Return([]models.AttributeDefinition{}, nil).Once()
+				srm.On("Create", mock.Anything, mock.Anything).Return(nil).Once()
+				lgm.On("Check", mock.Anything, &user).Return(allowed, nil).Once()
+				lgm.On("Succeeded", mock.Anything, &user).Once()
+				services.CompareHashAndPassword = func(hash, plain string) error {
+					return nil
+				}
+			},
+			assert: func(t *testing.T, jwt string, err error) {
+				require.NoError(t, err)
+				require.NotZero(t, jwt)
+			},
+			teardown: func() {
+				services.CompareHashAndPassword = compareFunc
+			},
+		},
+		"legacy username": {
+			arrange: func() {
+				crm.On("FindByEmail", mock.Anything, "ryanpujo@gmail.com").
+					Return((*models.User)(nil), fmt.Errorf("not found: %w", sql.ErrNoRows)).Once()
+				crm.On("FindByUsername", mock.Anything, "ryanpujo@gmail.com").Return(&user, nil).Once()
+				arm.On("List", mock.Anything).Return([]models.AttributeDefinition{}, nil).Once()
+				srm.On("Create", mock.Anything, mock.Anything).Return(nil).Once()
+				lgm.On("Check", mock.Anything, &user).Return(allowed, nil).Once()
+				lgm.On("Succeeded", mock.Anything, &user).Once()
+				services.CompareHashAndPassword = func(hash, plain string) error {
+					return nil
+				}
+			},
+			assert: func(t *testing.T, jwt string, err error) {
+				require.NoError(t, err)
+				require.NotZero(t, jwt)
+			},
+			teardown: func() {
+				services.CompareHashAndPassword = compareFunc
+			},
+		},
+		"email not found": {
+			arrange: func() {
+				crm.On("FindByEmail", mock.Anything, "ryanpujo@gmail.com").
+					Return((*models.User)(nil), errors.New("failed")).Once()
+			},
+			assert: func(t *testing.T, jwt string, err error) {
+				require.Error(t, err)
+				require.Zero(t, jwt)
+			},
+			teardown: func() {},
+		},
+	}
+
+	loginPayload := models.LoginPayload{
+		Identifier: "RyanPujo@Gmail.com",
+		Password:   "okeoke",
+	}
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			jwt, err := credService.Login(context.Background(), &loginPayload)
+
+			v.assert(t, jwt, err)
+
+			v.teardown()
+		})
+	}
+}
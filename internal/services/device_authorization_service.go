@@ -0,0 +1,262 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ryanpujo/melius/config"
+	"github.com/ryanpujo/melius/internal/jwttoken"
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/ryanpujo/melius/internal/repositories"
+	"github.com/ryanpujo/melius/internal/utilities"
+)
+
+const (
+	// DeviceCodeTTL is how long a device has to get its user code approved.
+	DeviceCodeTTL = 10 * time.Minute
+
+	// DevicePollInterval is the minimum number of seconds between two polls of a device,
+	// raised by devicePollSlowDown every time the device polls too fast.
+	DevicePollInterval = 5
+	devicePollSlowDown = 5
+
+	// userCodeAlphabet leaves out vowels, so codes do not spell words, and characters
+	// that are easily confused, as recommended by RFC 8628.
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLength   = 8
+)
+
+var ErrUserCodeInvalid = errors.New("invalid or expired user code")
+
+// ErrDeviceVerificationURIUnset is returned when devices are authorized while no page
+// was configured for their users to enter the user code at.
+var ErrDeviceVerificationURIUnset = errors.New("DEVICE_VERIFICATION_URI is not configured")
+
+// TokenIssuer issues the tokens of users authenticated by another grant than their password.
+type TokenIssuer interface {
+	IssueToken(ctx context.Context, userID uint, clientID, scope, dpopKey string) (string, error)
+}
+
+// DeviceAuthorizationInterface implements the device authorization grant of RFC 8628.
+type DeviceAuthorizationInterface interface {
+	Authorize(ctx context.Context, request models.DeviceAuthorizationRequest) (*models.DeviceAuthorizationResponse, error)
+	Lookup(ctx context.Context, userCode string) (*models.DeviceAuthorization, error)
+	Decide(ctx context.Context, userID uint, payload models.DeviceDecisionPayload) error
+	Token(ctx context.Context, request models.TokenRequest) (*models.TokenResponse, error)
+}
+
+// DeviceAuthorizationService implements the DeviceAuthorizationInterface.
+type DeviceAuthorizationService struct {
+	deviceAuthRepo repositories.DeviceAuthorizationInterface
+	issuer         TokenIssuer
+	auditor        Auditor
+}
+
+// NewDeviceAuthorizationService creates a new instance of DeviceAuthorizationService.
+func NewDeviceAuthorizationService(
+	deviceAuthRepo repositories.DeviceAuthorizationInterface,
+	issuer TokenIssuer,
+	auditor Auditor,
+) *DeviceAuthorizationService {
+	return &DeviceAuthorizationService{
+		deviceAuthRepo: deviceAuthRepo,
+		issuer:         issuer,
+		auditor:        auditor,
+	}
+}
+
+// Authorize starts the authorization of a device. The device shows the user code and
+// verification URI to its user, then polls the token endpoint with the device code.
+// Authorizations that expired unused are removed along the way.
+func (ds *DeviceAuthorizationService) Authorize(
+	ctx context.Context, request models.DeviceAuthorizationRequest,
+) (*models.DeviceAuthorizationResponse, error) {
+	if !slices.Contains(config.Config().DeviceClients, request.ClientID) {
+		return nil, &models.OAuthError{Code: models.OAuthInvalidClient, Description: "unknown client"}
+	}
+	verificationURI := config.Config().DeviceVerificationURI
+	if verificationURI == "" {
+		return nil, fmt.Errorf("failed to authorize device: %w", ErrDeviceVerificationURIUnset)
+	}
+
+	if _, err := ds.deviceAuthRepo.DeleteExpired(ctx); err != nil {
+		log.Printf("device authorizations: %v", err)
+	}
+
+	deviceCode, err := utilities.RandomToken(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to authorize device: %w", err)
+	}
+	userCode, err := newUserCode()
+	if err != nil {
+		return nil, fmt.Errorf("failed to authorize device: %w", err)
+	}
+
+	now := time.Now()
+	authorization := models.DeviceAuthorization{
+		DeviceCodeHash: utilities.HashToken(deviceCode),
+		UserCode:       userCode,
+		ClientID:       request.ClientID,
+		Scope:          strings.Join(strings.Fields(request.Scope), " "),
+		Status:         models.DeviceAuthorizationPending,
+		Interval:       DevicePollInterval,
+		CreatedAt:      now,
+		ExpiresAt:      now.Add(DeviceCodeTTL),
+	}
+	if err := ds.deviceAuthRepo.Create(ctx, authorization); err != nil {
+		return nil, fmt.Errorf("failed to authorize device: %w", err)
+	}
+
+	return &models.DeviceAuthorizationResponse{
+		DeviceCode:              deviceCode,
+		UserCode:                formatUserCode(userCode),
+		VerificationURI:         verificationURI,
+		VerificationURIComplete: verificationURI + "?user_code=" + url.QueryEscape(formatUserCode(userCode)),
+		ExpiresIn:               int(DeviceCodeTTL.Seconds()),
+		Interval:                DevicePollInterval,
+	}, nil
+}
+
+// Lookup returns the pending device authorization of userCode, so the user can check
+// which client asks for access before deciding.
+func (ds *DeviceAuthorizationService) Lookup(ctx context.Context, userCode string) (*models.DeviceAuthorization, error) {
+	authorization, err := ds.deviceAuthRepo.FindByUserCode(ctx, normalizeUserCode(userCode))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUserCodeInvalid, err)
+	}
+	if authorization.Status != models.DeviceAuthorizationPending || !authorization.ExpiresAt.After(time.Now()) {
+		return nil, ErrUserCodeInvalid
+	}
+	return authorization, nil
+}
+
+// Decide approves or denies the device authorization of the user code on behalf of the user.
+func (ds *DeviceAuthorizationService) Decide(ctx context.Context, userID uint, payload models.DeviceDecisionPayload) (err error) {
+	action, status := models.AuditDeviceDeny, models.DeviceAuthorizationDenied
+	if *payload.Approve {
+		action, status = models.AuditDeviceApprove, models.DeviceAuthorizationApproved
+	}
+
+	authorization, err := ds.Lookup(ctx, payload.UserCode)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		audit(ctx, ds.auditor, action, userID, err, map[string]any{"client_id": authorization.ClientID})
+	}()
+
+	if err := ds.deviceAuthRepo.Decide(ctx, authorization.UserCode, userID, status); err != nil {
+		return fmt.Errorf("%w: %w", ErrUserCodeInvalid, err)
+	}
+	return nil
+}
+
+// Token answers a device polling with the device code grant. Until the user decides it
+// answers authorization_pending, or slow_down when the device polls faster than its
+// interval, which is then raised. Once approved the token is issued only once. Clients
+// requiring DPoP must send a proof with every poll.
+func (ds *DeviceAuthorizationService) Token(ctx context.Context, request models.TokenRequest) (_ *models.TokenResponse, err error) {
+	hash := utilities.HashToken(request.DeviceCode)
+	authorization, err := ds.deviceAuthRepo.FindByDeviceCode(ctx, hash)
+	if err != nil || authorization.ClientID != request.ClientID {
+		return nil, &models.OAuthError{Code: models.OAuthInvalidGrant, Description: "unknown device code"}
+	}
+	if request.DPoPKey == "" && requiresDPoP(request.ClientID) {
+		return nil, &models.OAuthError{Code: models.OAuthInvalidDPoPProof, Description: ErrDPoPRequired.Error()}
+	}
+
+	now := time.Now()
+	if !authorization.ExpiresAt.After(now) {
+		if err := ds.deviceAuthRepo.Delete(ctx, hash); err != nil {
+			log.Printf("device authorizations: %v", err)
+		}
+		return nil, &models.OAuthError{Code: models.OAuthExpiredToken}
+	}
+
+	interval := authorization.Interval
+	tooFast := authorization.LastPolledAt != nil &&
+		now.Sub(*authorization.LastPolledAt) < time.Duration(interval)*time.Second
+	if tooFast {
+		interval += devicePollSlowDown
+	}
+	if err := ds.deviceAuthRepo.Poll(ctx, hash, interval); err != nil {
+		return nil, fmt.Errorf("failed to poll device authorization: %w", err)
+	}
+	if tooFast {
+		return nil, &models.OAuthError{Code: models.OAuthSlowDown}
+	}
+
+	switch authorization.Status {
+	case models.DeviceAuthorizationPending:
+		return nil, &models.OAuthError{Code: models.OAuthAuthorizationPending}
+	case models.DeviceAuthorizationDenied:
+		if err := ds.deviceAuthRepo.Delete(ctx, hash); err != nil {
+			log.Printf("device authorizations: %v", err)
+		}
+		return nil, &models.OAuthError{Code: models.OAuthAccessDenied}
+	}
+
+	userID := *authorization.UserID
+	defer func() {
+		audit(ctx, ds.auditor, models.AuditDeviceToken, userID, err, map[string]any{"client_id": authorization.ClientID})
+	}()
+
+	// Deleting first makes concurrent polls race for a single token.
+	if err := ds.deviceAuthRepo.Delete(ctx, hash); err != nil {
+		return nil, &models.OAuthError{Code: models.OAuthInvalidGrant, Description: "device code already used"}
+	}
+
+	token, err := ds.issuer.IssueToken(ctx, userID, authorization.ClientID, authorization.Scope, request.DPoPKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to issue device token: %w", err)
+	}
+
+	tokenType := "Bearer"
+	if request.DPoPKey != "" {
+		tokenType = "DPoP"
+	}
+	return &models.TokenResponse{
+		AccessToken: token,
+		TokenType:   tokenType,
+		ExpiresIn:   int(jwttoken.Lifetime(jwttoken.KindUser).Seconds()),
+		Scope:       authorization.Scope,
+	}, nil
+}
+
+// newUserCode generates a random user code of userCodeLength characters of userCodeAlphabet.
+func newUserCode() (string, error) {
+	max := big.NewInt(int64(len(userCodeAlphabet)))
+	code := make([]byte, userCodeLength)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = userCodeAlphabet[n.Int64()]
+	}
+	return string(code), nil
+}
+
+// formatUserCode splits a user code in two halves for readability, as in BCDF-GHJK.
+func formatUserCode(code string) string {
+	return code[:len(code)/2] + "-" + code[len(code)/2:]
+}
+
+// normalizeUserCode undoes the formatting users may have typed, such as dashes,
+// spaces and lowercase letters.
+func normalizeUserCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(code))
+}
@@ -0,0 +1,362 @@
+package services_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ryanpujo/melius/config"
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/ryanpujo/melius/internal/services"
+	"github.com/ryanpujo/melius/internal/utilities"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type DeviceAuthorizationRepoMock struct {
+	mock.Mock
+}
+
+func (dam *DeviceAuthorizationRepoMock) Create(ctx context.Context, authorization models.DeviceAuthorization) error {
+	args := dam.Called(ctx, authorization)
+	return args.Error(0)
+}
+
+func (dam *DeviceAuthorizationRepoMock) FindByUserCode(ctx context.Context, userCode string) (*models.DeviceAuthorization, error) {
+	args := dam.Called(ctx, userCode)
+	return args.Get(0).(*models.DeviceAuthorization), args.Error(1)
+}
+
+func (dam *DeviceAuthorizationRepoMock) FindByDeviceCode(ctx context.Context, hash string) (*models.DeviceAuthorization, error) {
+	args := dam.Called(ctx, hash)
+	return args.Get(0).(*models.DeviceAuthorization), args.Error(1)
+}
+
+func (dam *DeviceAuthorizationRepoMock) Decide(ctx context.Context, userCode string, userID uint, status string) error {
+	args := dam.Called(ctx, userCode, userID, status)
+	return args.Error(0)
+}
+
+func (dam *DeviceAuthorizationRepoMock) Poll(ctx context.Context, hash string, interval int) error {
+	args := dam.Called(ctx, hash, interval)
+	return args.Error(0)
+}
+
+func (dam *DeviceAuthorizationRepoMock) Delete(ctx context.Context, hash string) error {
+	args := dam.Called(ctx, hash)
+	return args.Error(0)
+}
+
+func (dam *DeviceAuthorizationRepoMock) DeleteExpired(ctx context.Context) (int64, error) {
+	args := dam.Called(ctx)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+type TokenIssuerMock struct {
+	mock.Mock
+}
+
+func (tim *TokenIssuerMock) IssueToken(ctx context.Context, userID uint, clientID, scope, dpopKey string) (string, error) {
+	args := tim.Called(ctx, userID, clientID, scope, dpopKey)
+	return args.String(0), args.Error(1)
+}
+
+func TestAuthorizeDevice(t *testing.T) {
+	conf := config.Config()
+	conf.DeviceClients = []string{"melius-cli"}
+	conf.DeviceVerificationURI = "https://app.melius.test/device"
+	t.Cleanup(func() { conf.DeviceVerificationURI = "" })
+
+	t.Run("success", func(t *testing.T) {
+		dam := new(DeviceAuthorizationRepoMock)
+		deviceAuthService := services.NewDeviceAuthorizationService(dam, new(TokenIssuerMock), aud)
+
+		var stored models.DeviceAuthorization
+		dam.On("DeleteExpired", mock.Anything).Return(int64(2), nil).Once()
+		dam.On("Create", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			stored = args.Get(1).(models.DeviceAuthorization)
+		}).Return(nil).Once()
+
+		res, err := deviceAuthService.Authorize(context.Background(), models.DeviceAuthorizationRequest{ClientID: "melius-cli", Scope: " read  write "})
+		require.NoError(t, err)
+		require.Equal(t, utilities.HashToken(res.DeviceCode), stored.DeviceCodeHash)
+		require.Equal(t, "read write", stored.Scope)
+		require.Equal(t, models.DeviceAuthorizationPending, stored.Status)
+		require.Len(t, stored.UserCode, 8)
+		require.Equal(t, stored.UserCode[:4]+"-"+stored.UserCode[4:], res.UserCode)
+		require.Equal(t, "https://app.melius.test/device", res.VerificationURI)
+		require.Equal(t, res.VerificationURI+"?user_code="+res.UserCode, res.VerificationURIComplete)
+		require.Equal(t, services.DevicePollInterval, res.Interval)
+		dam.AssertExpectations(t)
+	})
+
+	t.Run("unknown client", func(t *testing.T) {
+		dam := new(DeviceAuthorizationRepoMock)
+		deviceAuthService := services.NewDeviceAuthorizationService(dam, new(TokenIssuerMock), aud)
+
+		res, err := deviceAuthService.Authorize(context.Background(), models.DeviceAuthorizationRequest{ClientID: "other"})
+		var oauthErr *models.OAuthError
+		require.ErrorAs(t, err, &oauthErr)
+		require.Equal(t, models.OAuthInvalidClient, oauthErr.Code)
+		require.Nil(t, res)
+		dam.AssertExpectations(t)
+	})
+
+	t.Run("verification URI not configured", func(t *testing.T) {
+		conf.DeviceVerificationURI = ""
+		defer func() { conf.DeviceVerificationURI = "https://app.melius.test/device" }()
+		dam := new(DeviceAuthorizationRepoMock)
+		deviceAuthService := services.NewDeviceAuthorizationService(dam, new(TokenIssuerMock), aud)
+
+		res, err := deviceAuthService.Authorize(context.Background(), models.DeviceAuthorizationRequest{ClientID: "melius-cli"})
+		require.ErrorIs(t, err, services.ErrDeviceVerificationURIUnset)
+		require.Nil(t, res)
+		dam.AssertExpectations(t)
+	})
+}
+
+func TestDecideDevice(t *testing.T) {
+	approve, deny := true, false
+	pending := &models.DeviceAuthorization{
+		UserCode:  "BCDFGHJK",
+		ClientID:  "melius-cli",
+		Status:    models.DeviceAuthorizationPending,
+		ExpiresAt: time.Now().Add(time.Minute),
+	}
+	expired := *pending
+	expired.ExpiresAt = time.Now().Add(-time.Minute)
+
+	tableTest := map[string]struct {
+		payload models.DeviceDecisionPayload
+		arrange func(dam *DeviceAuthorizationRepoMock)
+		assert  func(t *testing.T, err error)
+	}{
+		"approve": {
+			payload: models.DeviceDecisionPayload{UserCode: "bcdf-ghjk", Approve: &approve},
+			arrange: func(dam *DeviceAuthorizationRepoMock) {
+				dam.On("FindByUserCode", mock.Anything, "BCDFGHJK").Return(pending, nil).Once()
+				dam.On("Decide", mock.Anything, "BCDFGHJK", uint(1), models.DeviceAuthorizationApproved).Return(nil).Once()
+			},
+			assert: func(t *testing.T, err error) {
+				require.NoError(t, err)
+				event := aud.last()
+				require.Equal(t, models.AuditDeviceApprove, event.Action)
+				require.Equal(t, "melius-cli", event.Details["client_id"])
+			},
+		},
+		"deny": {
+			payload: models.DeviceDecisionPayload{UserCode: "BCDF GHJK", Approve: &deny},
+			arrange: func(dam *DeviceAuthorizationRepoMock) {
+				dam.On("FindByUserCode", mock.Anything, "BCDFGHJK").Return(pending, nil).Once()
+				dam.On("Decide", mock.Anything, "BCDFGHJK", uint(1), models.DeviceAuthorizationDenied).Return(nil).Once()
+			},
+			assert: func(t *testing.T, err error) {
+				require.NoError(t, err)
+				require.Equal(t, models.AuditDeviceDeny, aud.last().Action)
+			},
+		},
+		"expired": {
+			payload: models.DeviceDecisionPayload{UserCode: "BCDF-GHJK", Approve: &approve},
+			arrange: func(dam *DeviceAuthorizationRepoMock) {
+				dam.On("FindByUserCode", mock.Anything, "BCDFGHJK").Return(&expired, nil).Once()
+			},
+			assert: func(t *testing.T, err error) {
+				require.ErrorIs(t, err, services.ErrUserCodeInvalid)
+			},
+		},
+		"decided concurrently": {
+			payload: models.DeviceDecisionPayload{UserCode: "BCDF-GHJK", Approve: &approve},
+			arrange: func(dam *DeviceAuthorizationRepoMock) {
+				dam.On("FindByUserCode", mock.Anything, "BCDFGHJK").Return(pending, nil).Once()
+				dam.On("Decide", mock.Anything, "BCDFGHJK", uint(1), models.DeviceAuthorizationApproved).Return(sql.ErrNoRows).Once()
+			},
+			assert: func(t *testing.T, err error) {
+				require.ErrorIs(t, err, services.ErrUserCodeInvalid)
+				require.Equal(t, models.AuditOutcomeFailure, aud.last().Outcome)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			dam := new(DeviceAuthorizationRepoMock)
+			deviceAuthService := services.NewDeviceAuthorizationService(dam, new(TokenIssuerMock), aud)
+			v.arrange(dam)
+
+			err := deviceAuthService.Decide(context.Background(), 1, v.payload)
+
+			v.assert(t, err)
+			dam.AssertExpectations(t)
+		})
+	}
+}
+
+func TestDeviceToken(t *testing.T) {
+	const deviceCode = "device-code"
+	hash := utilities.HashToken(deviceCode)
+	request := models.TokenRequest{GrantType: models.GrantDeviceCode, DeviceCode: deviceCode, ClientID: "melius-cli"}
+	userID := uint(1)
+	authorization := func(status string, lastPolled time.Duration) *models.DeviceAuthorization {
+		authorization := &models.DeviceAuthorization{
+			DeviceCodeHash: hash,
+			ClientID:       "melius-cli",
+			Scope:          "read",
+			Status:         status,
+			Interval:       services.DevicePollInterval,
+			ExpiresAt:      time.Now().Add(time.Minute),
+		}
+		if status != models.DeviceAuthorizationPending {
+			authorization.UserID = &userID
+		}
+		if lastPolled != 0 {
+			polledAt := time.Now().Add(-lastPolled)
+			authorization.LastPolledAt = &polledAt
+		}
+		return authorization
+	}
+	oauthError := func(code string) func(t *testing.T, res *models.TokenResponse, err error) {
+		return func(t *testing.T, res *models.TokenResponse, err error) {
+			var oauthErr *models.OAuthError
+			require.ErrorAs(t, err, &oauthErr)
+			require.Equal(t, code, oauthErr.Code)
+			require.Nil(t, res)
+		}
+	}
+
+	tableTest := map[string]struct {
+		request models.TokenRequest
+		arrange func(dam *DeviceAuthorizationRepoMock, tim *TokenIssuerMock)
+		assert  func(t *testing.T, res *models.TokenResponse, err error)
+	}{
+		"approved": {
+			request: request,
+			arrange: func(dam *DeviceAuthorizationRepoMock, tim *TokenIssuerMock) {
+				dam.On("FindByDeviceCode", mock.Anything, hash).Return(authorization(models.DeviceAuthorizationApproved, time.Minute), nil).Once()
+				dam.On("Poll", mock.Anything, hash, services.DevicePollInterval).Return(nil).Once()
+				dam.On("Delete", mock.Anything, hash).Return(nil).Once()
+				tim.On("IssueToken", mock.Anything, uint(1), "melius-cli", "read", "").Return("token", nil).Once()
+			},
+			assert: func(t *testing.T, res *models.TokenResponse, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "token", res.AccessToken)
+				require.Equal(t, "read", res.Scope)
+				require.Equal(t, models.AuditDeviceToken, aud.last().Action)
+			},
+		},
+		"already used": {
+			request: request,
+			arrange: func(dam *DeviceAuthorizationRepoMock, tim *TokenIssuerMock) {
+				dam.On("FindByDeviceCode", mock.Anything, hash).Return(authorization(models.DeviceAuthorizationApproved, 0), nil).Once()
+				dam.On("Poll", mock.Anything, hash, services.DevicePollInterval).Return(nil).Once()
+				dam.On("Delete", mock.Anything, hash).Return(sql.ErrNoRows).Once()
+			},
+			assert: oauthError(models.OAuthInvalidGrant),
+		},
+		"pending": {
+			request: request,
+			arrange: func(dam *DeviceAuthorizationRepoMock, tim *TokenIssuerMock) {
+				dam.On("FindByDeviceCode", mock.Anything, hash).Return(authorization(models.DeviceAuthorizationPending, time.Minute), nil).Once()
+				dam.On("Poll", mock.Anything, hash, services.DevicePollInterval).Return(nil).Once()
+			},
+			assert: oauthError(models.OAuthAuthorizationPending),
+		},
+		"polling too fast": {
+			request: request,
+			arrange: func(dam *DeviceAuthorizationRepoMock, tim *TokenIssuerMock) {
+				dam.On("FindByDeviceCode", mock.Anything, hash).Return(authorization(models.DeviceAuthorizationApproved, time.Second), nil).Once()
+				dam.On("Poll", mock.Anything, hash, services.DevicePollInterval+5).Return(nil).Once()
+			},
+			assert: oauthError(models.OAuthSlowDown),
+		},
+		"denied": {
+			request: request,
+			arrange: func(dam *DeviceAuthorizationRepoMock, tim *TokenIssuerMock) {
+				dam.On("FindByDeviceCode", mock.Anything, hash).Return(authorization(models.DeviceAuthorizationDenied, 0), nil).Once()
+				dam.On("Poll", mock.Anything, hash, services.DevicePollInterval).Return(nil).Once()
+				dam.On("Delete", mock.Anything, hash).Return(nil).Once()
+			},
+			assert: oauthError(models.OAuthAccessDenied),
+		},
+		"expired": {
+			request: request,
+			arrange: func(dam *DeviceAuthorizationRepoMock, tim *TokenIssuerMock) {
+				expired := authorization(models.DeviceAuthorizationPending, 0)
+				expired.ExpiresAt = time.Now().Add(-time.Second)
+				dam.On("FindByDeviceCode", mock.Anything, hash).Return(expired, nil).Once()
+				dam.On("Delete", mock.Anything, hash).Return(nil).Once()
+			},
+			assert: oauthError(models.OAuthExpiredToken),
+		},
+		"another client": {
+			request: models.TokenRequest{GrantType: models.GrantDeviceCode, DeviceCode: deviceCode, ClientID: "other"},
+			arrange: func(dam *DeviceAuthorizationRepoMock, tim *TokenIssuerMock) {
+				dam.On("FindByDeviceCode", mock.Anything, hash).Return(authorization(models.DeviceAuthorizationApproved, 0), nil).Once()
+			},
+			assert: oauthError(models.OAuthInvalidGrant),
+		},
+		"unknown device code": {
+			request: request,
+			arrange: func(dam *DeviceAuthorizationRepoMock, tim *TokenIssuerMock) {
+				dam.On("FindByDeviceCode", mock.Anything, hash).Return((*models.DeviceAuthorization)(nil), errors.New("not found")).Once()
+			},
+			assert: oauthError(models.OAuthInvalidGrant),
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			dam := new(DeviceAuthorizationRepoMock)
+			tim := new(TokenIssuerMock)
+			deviceAuthService := services.NewDeviceAuthorizationService(dam, tim, aud)
+			v.arrange(dam, tim)
+
+			res, err := deviceAuthService.Token(context.Background(), v.request)
+
+			v.assert(t, res, err)
+			dam.AssertExpectations(t)
+			tim.AssertExpectations(t)
+		})
+	}
+}
+
+func TestDeviceTokenRequiresDPoP(t *testing.T) {
+	config.Config().DPoPClients = []string{"melius-cli"}
+	defer func() { config.Config().DPoPClients = nil }()
+
+	const deviceCode = "device-code"
+	hash := utilities.HashToken(deviceCode)
+	userID := uint(1)
+	dam := new(DeviceAuthorizationRepoMock)
+	tim := new(TokenIssuerMock)
+	deviceAuthService := services.NewDeviceAuthorizationService(dam, tim, aud)
+	dam.On("FindByDeviceCode", mock.Anything, hash).Return(&models.DeviceAuthorization{
+		DeviceCodeHash: hash,
+		ClientID:       "melius-cli",
+		Scope:          "read",
+		Status:         models.DeviceAuthorizationApproved,
+		UserID:         &userID,
+		Interval:       services.DevicePollInterval,
+		ExpiresAt:      time.Now().Add(time.Minute),
+	}, nil).Twice()
+
+	// Without a proof the device code is left for a poll with one.
+	_, err := deviceAuthService.Token(context.Background(), models.TokenRequest{
+		GrantType: models.GrantDeviceCode, DeviceCode: deviceCode, ClientID: "melius-cli",
+	})
+	var oauthErr *models.OAuthError
+	require.ErrorAs(t, err, &oauthErr)
+	require.Equal(t, models.OAuthInvalidDPoPProof, oauthErr.Code)
+
+	dam.On("Poll", mock.Anything, hash, services.DevicePollInterval).Return(nil).Once()
+	dam.On("Delete", mock.Anything, hash).Return(nil).Once()
+	tim.On("IssueToken", mock.Anything, uint(1), "melius-cli", "read", "thumbprint").Return("token", nil).Once()
+	res, err := deviceAuthService.Token(context.Background(), models.TokenRequest{
+		GrantType: models.GrantDeviceCode, DeviceCode: deviceCode, ClientID: "melius-cli", DPoPKey: "thumbprint",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "DPoP", res.TokenType)
+	dam.AssertExpectations(t)
+	tim.AssertExpectations(t)
+}
@@ -0,0 +1,180 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ryanpujo/melius/config"
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/ryanpujo/melius/internal/repositories"
+)
+
+var (
+	ErrForwardAuthHost = errors.New("host is not protected by forward auth")
+	ErrForwardAuthRole = errors.New("insufficient role for this path")
+	ErrForwardAuthPath = errors.New("ambiguous request path")
+)
+
+// ForwardAuthInterface decides for reverse proxies whether requests to the apps they
+// protect may pass, by the rules of config.ForwardAuthHosts.
+type ForwardAuthInterface interface {
+	// Authorize returns the identity to pass on to the app, or ErrForwardAuthHost,
+	// ErrForwardAuthRole or ErrForwardAuthPath when the request may not pass.
+	Authorize(ctx context.Context, request models.ForwardAuthRequest) (*models.ForwardAuthIdentity, error)
+	// LoginURL returns where to redirect a browser that is not authenticated, empty
+	// when the host has no login page.
+	LoginURL(request models.ForwardAuthRequest) string
+}
+
+// ForwardAuthService implements the ForwardAuthInterface.
+type ForwardAuthService struct {
+	userRepo repositories.UserInterface
+}
+
+// NewForwardAuthService creates a new instance of ForwardAuthService.
+func NewForwardAuthService(userRepo repositories.UserInterface) *ForwardAuthService {
+	return &ForwardAuthService{
+		userRepo: userRepo,
+	}
+}
+
+// Authorize checks the roles of the principal against the rule of the path, and looks
+// up the email address of users, which tokens do not carry, and the username of the
+// administrator impersonating them, so apps can tell who really acts. Paths are matched
+// decoded and cleaned, as the app will route them.
+func (fs *ForwardAuthService) Authorize(ctx context.Context, request models.ForwardAuthRequest) (*models.ForwardAuthIdentity, error) {
+	_, host, ok := forwardAuthHost(request.Host)
+	if !ok {
+		return nil, ErrForwardAuthHost
+	}
+
+	path, ok := forwardAuthPath(request.URI)
+	if !ok {
+		return nil, ErrForwardAuthPath
+	}
+	if rule := forwardAuthRule(host.Rules, path); rule != nil && len(rule.Roles) > 0 &&
+		!slices.ContainsFunc(rule.Roles, func(role string) bool { return slices.Contains(request.Roles, role) }) {
+		return nil, ErrForwardAuthRole
+	}
+
+	identity := &models.ForwardAuthIdentity{
+		Username: request.Username,
+		Roles:    request.Roles,
+	}
+	if request.UserID != 0 {
+		user, err := fs.userRepo.FindByID(ctx, request.UserID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find user: %w", err)
+		}
+		identity.Email = user.Credential.Email
+	}
+	if request.ActorID != 0 {
+		actor, err := fs.userRepo.FindByID(ctx, request.ActorID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find actor: %w", err)
+		}
+		identity.Actor = actor.Credential.Username
+	}
+	return identity, nil
+}
+
+// LoginURL returns the login page of the host, told in its rd query parameter the URL
+// to return to after login. The URL is on the configured name of the host: hosts only
+// matching "*" are not returned to, as any host would match and the login page would
+// then redirect browsers wherever the request claimed to go.
+func (fs *ForwardAuthService) LoginURL(request models.ForwardAuthRequest) string {
+	name, host, ok := forwardAuthHost(request.Host)
+	if !ok || host.LoginURL == "" {
+		return ""
+	}
+	login, err := url.Parse(host.LoginURL)
+	if err != nil {
+		return ""
+	}
+
+	if name != "*" {
+		query := login.Query()
+		query.Set("rd", returnURL(name, request))
+		login.RawQuery = query.Encode()
+	}
+	return login.String()
+}
+
+// returnURL returns the URL of request on the host configured as name, keeping the port
+// of the request when name has none. The scheme is https unless the proxy told http,
+// and URIs not starting with a slash are replaced, so they cannot change the host.
+func returnURL(name string, request models.ForwardAuthRequest) string {
+	proto := "https"
+	if request.Proto == "http" {
+		proto = "http"
+	}
+	host := name
+	if _, port, err := net.SplitHostPort(request.Host); err == nil && !strings.Contains(name, ":") {
+		if _, err := strconv.ParseUint(port, 10, 16); err == nil {
+			host = net.JoinHostPort(name, port)
+		}
+	}
+	uri := request.URI
+	if !strings.HasPrefix(uri, "/") {
+		uri = "/"
+	}
+	return proto + "://" + host + uri
+}
+
+// forwardAuthHost returns the configuration of host, with or without its port, and the
+// name it is configured under, or the configuration of "*" when it is not listed.
+func forwardAuthHost(host string) (string, config.ForwardAuthHost, bool) {
+	hosts := config.Config().ForwardAuthHosts
+	host = strings.ToLower(host)
+	if conf, ok := hosts[host]; ok {
+		return host, conf, true
+	}
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		if conf, ok := hosts[name]; ok {
+			return name, conf, true
+		}
+	}
+	conf, ok := hosts["*"]
+	return "*", conf, ok
+}
+
+// forwardAuthPath returns the path of uri percent-decoded and cleaned of duplicate
+// slashes and dot segments, so /%61dmin, //admin and /x/../admin all match /admin.
+// Paths apps may read differently are refused: with encoded slashes or backslashes,
+// encoded twice, with backslashes or control characters.
+func forwardAuthPath(uri string) (string, bool) {
+	raw, _, _ := strings.Cut(uri, "?")
+	raw, _, _ = strings.Cut(raw, "#")
+	if lower := strings.ToLower(raw); strings.Contains(lower, "%2f") || strings.Contains(lower, "%5c") {
+		return "", false
+	}
+	decoded, err := url.PathUnescape(raw)
+	if err != nil || strings.ContainsAny(decoded, "%\\") ||
+		strings.ContainsFunc(decoded, func(r rune) bool { return r < 0x20 || r == 0x7f }) {
+		return "", false
+	}
+	return path.Clean("/" + decoded), true
+}
+
+// forwardAuthRule returns the rule with the longest prefix matching path, whole
+// segments only, so /admin matches /admin/users but not /administrators.
+func forwardAuthRule(rules []config.ForwardAuthRule, path string) *config.ForwardAuthRule {
+	var match *config.ForwardAuthRule
+	for i, rule := range rules {
+		prefix := strings.TrimSuffix(rule.Prefix, "/")
+		if path != prefix && !strings.HasPrefix(path, prefix+"/") {
+			continue
+		}
+		if match == nil || len(prefix) > len(strings.TrimSuffix(match.Prefix, "/")) {
+			match = &rules[i]
+		}
+	}
+	return match
+}
@@ -0,0 +1,211 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ryanpujo/melius/config"
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/ryanpujo/melius/internal/services"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func forwardAuthHosts(t *testing.T, hosts map[string]config.ForwardAuthHost) {
+	conf := config.Config()
+	prev := conf.ForwardAuthHosts
+	conf.ForwardAuthHosts = hosts
+	t.Cleanup(func() {
+		conf.ForwardAuthHosts = prev
+	})
+}
+
+func TestForwardAuthorize(t *testing.T) {
+	forwardAuthHosts(t, map[string]config.ForwardAuthHost{
+		"app.example.com": {
+			LoginURL: "https://auth.example.com/login",
+			Rules: []config.ForwardAuthRule{
+				{Prefix: "/", Roles: nil},
+				{Prefix: "/admin/", Roles: []string{"admin"}},
+				{Prefix: "/admin/reports", Roles: []string{"admin", "auditor"}},
+			},
+		},
+		"*": {Rules: []config.ForwardAuthRule{{Prefix: "/", Roles: []string{"staff"}}}},
+	})
+
+	tableTest := map[string]struct {
+		request models.ForwardAuthRequest
+		arrange func(urm *UserRepoMock)
+		assert  func(t *testing.T, identity *models.ForwardAuthIdentity, err error)
+	}{
+		"public path": {
+			request: models.ForwardAuthRequest{Host: "app.example.com", URI: "/orders?page=2", UserID: 1, Username: "ryanpujo"},
+			arrange: func(urm *UserRepoMock) {
+				urm.On("FindByID", mock.Anything, uint(1)).
+					Return(&models.User{ID: 1, Credential: models.Credential{Email: "ryan@example.com"}}, nil).Once()
+			},
+			assert: func(t *testing.T, identity *models.ForwardAuthIdentity, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "ryanpujo", identity.Username)
+				require.Equal(t, "ryan@example.com", identity.Email)
+			},
+		},
+		"role required": {
+			request: models.ForwardAuthRequest{Host: "app.example.com", URI: "/admin", UserID: 1, Roles: []string{"auditor"}},
+			arrange: func(urm *UserRepoMock) {},
+			assert: func(t *testing.T, identity *models.ForwardAuthIdentity, err error) {
+				require.ErrorIs(t, err, services.ErrForwardAuthRole)
+				require.Nil(t, identity)
+			},
+		},
+		"longest prefix": {
+			request: models.ForwardAuthRequest{Host: "app.example.com", URI: "/admin/reports/2024", Username: "reports", Roles: []string{"auditor"}},
+			arrange: func(urm *UserRepoMock) {},
+			assert: func(t *testing.T, identity *models.ForwardAuthIdentity, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "reports", identity.Username)
+				require.Empty(t, identity.Email)
+			},
+		},
+		"whole segments": {
+			request: models.ForwardAuthRequest{Host: "app.example.com:8443", URI: "/administrators", Username: "reports"},
+			arrange: func(urm *UserRepoMock) {},
+			assert: func(t *testing.T, identity *models.ForwardAuthIdentity, err error) {
+				require.NoError(t, err)
+			},
+		},
+		"duplicate slashes": {
+			request: models.ForwardAuthRequest{Host: "app.example.com", URI: "//admin/x", UserID: 1},
+			arrange: func(urm *UserRepoMock) {},
+			assert: func(t *testing.T, identity *models.ForwardAuthIdentity, err error) {
+				require.ErrorIs(t, err, services.ErrForwardAuthRole)
+			},
+		},
+		"encoded segment": {
+			request: models.ForwardAuthRequest{Host: "app.example.com", URI: "/%61dmin/x", UserID: 1},
+			arrange: func(urm *UserRepoMock) {},
+			assert: func(t *testing.T, identity *models.ForwardAuthIdentity, err error) {
+				require.ErrorIs(t, err, services.ErrForwardAuthRole)
+			},
+		},
+		"dot segments": {
+			request: models.ForwardAuthRequest{Host: "app.example.com", URI: "/x/../admin", UserID: 1},
+			arrange: func(urm *UserRepoMock) {},
+			assert: func(t *testing.T, identity *models.ForwardAuthIdentity, err error) {
+				require.ErrorIs(t, err, services.ErrForwardAuthRole)
+			},
+		},
+		"encoded dot segments": {
+			request: models.ForwardAuthRequest{Host: "app.example.com", URI: "/x/%2e%2e/admin/", UserID: 1},
+			arrange: func(urm *UserRepoMock) {},
+			assert: func(t *testing.T, identity *models.ForwardAuthIdentity, err error) {
+				require.ErrorIs(t, err, services.ErrForwardAuthRole)
+			},
+		},
+		"encoded slash": {
+			request: models.ForwardAuthRequest{Host: "app.example.com", URI: "/admin%2Fx", UserID: 1},
+			arrange: func(urm *UserRepoMock) {},
+			assert: func(t *testing.T, identity *models.ForwardAuthIdentity, err error) {
+				require.ErrorIs(t, err, services.ErrForwardAuthPath)
+			},
+		},
+		"encoded twice": {
+			request: models.ForwardAuthRequest{Host: "app.example.com", URI: "/%2561dmin/x", UserID: 1},
+			arrange: func(urm *UserRepoMock) {},
+			assert: func(t *testing.T, identity *models.ForwardAuthIdentity, err error) {
+				require.ErrorIs(t, err, services.ErrForwardAuthPath)
+			},
+		},
+		"backslash": {
+			request: models.ForwardAuthRequest{Host: "app.example.com", URI: "/admin\\x", UserID: 1},
+			arrange: func(urm *UserRepoMock) {},
+			assert: func(t *testing.T, identity *models.ForwardAuthIdentity, err error) {
+				require.ErrorIs(t, err, services.ErrForwardAuthPath)
+			},
+		},
+		"invalid encoding": {
+			request: models.ForwardAuthRequest{Host: "app.example.com", URI: "/admin/%zz", UserID: 1},
+			arrange: func(urm *UserRepoMock) {},
+			assert: func(t *testing.T, identity *models.ForwardAuthIdentity, err error) {
+				require.ErrorIs(t, err, services.ErrForwardAuthPath)
+			},
+		},
+		"other host": {
+			request: models.ForwardAuthRequest{Host: "wiki.example.com", URI: "/", Username: "reports"},
+			arrange: func(urm *UserRepoMock) {},
+			assert: func(t *testing.T, identity *models.ForwardAuthIdentity, err error) {
+				require.ErrorIs(t, err, services.ErrForwardAuthRole)
+			},
+		},
+		"impersonation": {
+			request: models.ForwardAuthRequest{Host: "app.example.com", URI: "/", UserID: 1, Username: "ryanpujo", ActorID: 2},
+			arrange: func(urm *UserRepoMock) {
+				urm.On("FindByID", mock.Anything, uint(1)).
+					Return(&models.User{ID: 1, Credential: models.Credential{Email: "ryan@example.com"}}, nil).Once()
+				urm.On("FindByID", mock.Anything, uint(2)).
+					Return(&models.User{ID: 2, Credential: models.Credential{Username: "admin"}}, nil).Once()
+			},
+			assert: func(t *testing.T, identity *models.ForwardAuthIdentity, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "ryanpujo", identity.Username)
+				require.Equal(t, "admin", identity.Actor)
+			},
+		},
+		"user lookup fails": {
+			request: models.ForwardAuthRequest{Host: "app.example.com", URI: "/", UserID: 1},
+			arrange: func(urm *UserRepoMock) {
+				urm.On("FindByID", mock.Anything, uint(1)).Return((*models.User)(nil), errors.New("db down")).Once()
+			},
+			assert: func(t *testing.T, identity *models.ForwardAuthIdentity, err error) {
+				require.Error(t, err)
+				require.Nil(t, identity)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			urm := new(UserRepoMock)
+			forwardAuthService := services.NewForwardAuthService(urm)
+			v.arrange(urm)
+
+			identity, err := forwardAuthService.Authorize(context.Background(), v.request)
+
+			v.assert(t, identity, err)
+			urm.AssertExpectations(t)
+		})
+	}
+
+	t.Run("unknown host", func(t *testing.T) {
+		forwardAuthHosts(t, map[string]config.ForwardAuthHost{"app.example.com": {}})
+		forwardAuthService := services.NewForwardAuthService(new(UserRepoMock))
+
+		_, err := forwardAuthService.Authorize(context.Background(), models.ForwardAuthRequest{Host: "wiki.example.com", URI: "/"})
+		require.ErrorIs(t, err, services.ErrForwardAuthHost)
+	})
+}
+
+func TestForwardAuthLoginURL(t *testing.T) {
+	forwardAuthHosts(t, map[string]config.ForwardAuthHost{
+		"app.example.com":  {LoginURL: "https://auth.example.com/login?theme=dark"},
+		"wiki.example.com": {},
+		"*":                {LoginURL: "https://auth.example.com/login"},
+	})
+	forwardAuthService := services.NewForwardAuthService(new(UserRepoMock))
+
+	login := forwardAuthService.LoginURL(models.ForwardAuthRequest{Host: "app.example.com", URI: "/orders?page=2"})
+	require.Equal(t, "https://auth.example.com/login?rd=https%3A%2F%2Fapp.example.com%2Forders%3Fpage%3D2&theme=dark", login)
+
+	login = forwardAuthService.LoginURL(models.ForwardAuthRequest{Host: "app.example.com", Proto: "http", URI: "/"})
+	require.Equal(t, "https://auth.example.com/login?rd=http%3A%2F%2Fapp.example.com%2F&theme=dark", login)
+
+	login = forwardAuthService.LoginURL(models.ForwardAuthRequest{Host: "APP.example.com:8443", Proto: "javascript", URI: "@evil.test/"})
+	require.Equal(t, "https://auth.example.com/login?rd=https%3A%2F%2Fapp.example.com%3A8443%2F&theme=dark", login)
+
+	require.Empty(t, forwardAuthService.LoginURL(models.ForwardAuthRequest{Host: "wiki.example.com", URI: "/"}))
+
+	// Any host matches "*", the login page must not send browsers back to it.
+	login = forwardAuthService.LoginURL(models.ForwardAuthRequest{Host: "evil.test", URI: "/"})
+	require.Equal(t, "https://auth.example.com/login", login)
+}
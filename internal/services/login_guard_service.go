@@ -0,0 +1,393 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"slices"
+	"time"
+
+	"github.com/ryanpujo/melius/config"
+	"github.com/ryanpujo/melius/internal/mailer"
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/ryanpujo/melius/internal/repositories"
+	"github.com/ryanpujo/melius/internal/requestinfo"
+	"github.com/ryanpujo/melius/internal/useragent"
+	"github.com/ryanpujo/melius/internal/utilities"
+)
+
+// Weights of the risk factors of a login.
+const (
+	riskNewDevice      = 40
+	riskUnusualHour    = 15
+	riskRapidIPChange  = 20
+	riskFailedAttempt  = 10
+	riskFailedAttempts = 50
+)
+
+const (
+	// LoginChallengeTTL is how long the code of a step-up challenge stays valid.
+	LoginChallengeTTL = 10 * time.Minute
+
+	// LoginChallengeAttempts is the number of wrong codes after which a challenge is discarded.
+	LoginChallengeAttempts = 5
+
+	// usualHourSessions is the number of past sessions needed before login hours are compared.
+	usualHourSessions = 5
+
+	// usualHourWindow is the distance in hours from a past login for an hour to be usual.
+	usualHourWindow = 2
+
+	// rapidIPChangeWindow is the age below which a session from another address is suspicious.
+	rapidIPChangeWindow = time.Hour
+
+	// failedAttemptsWindow is the period over which failed logins are counted.
+	failedAttemptsWindow = time.Hour
+
+	// failedAttemptsMin is the number of recent failed logins from which they add to the score.
+	failedAttemptsMin = 3
+
+	// passwordAttemptsMax is the number of recent failed attempts from which passwords are
+	// no longer checked outside of login, so a stolen token or a closed account cannot be
+	// used to guess the password.
+	passwordAttemptsMax = 5
+)
+
+var (
+	ErrLoginBlocked     = errors.New("login blocked")
+	ErrChallengeInvalid = errors.New("invalid or expired login challenge")
+	ErrDeviceRequired   = errors.New("login verification requires a device id")
+)
+
+// StepUpRequiredError is returned for a login that must be confirmed with the one-time code
+// sent to the email address of the user.
+type StepUpRequiredError struct {
+	ChallengeID string
+	ExpiresAt   time.Time
+}
+
+func (e *StepUpRequiredError) Error() string {
+	return "additional verification required"
+}
+
+// LoginGuard scores logins with valid credentials and keeps track of the devices of users.
+type LoginGuard interface {
+	Check(ctx context.Context, user *models.User) (*models.RiskAssessment, error)
+	Verify(ctx context.Context, payload models.VerifyLoginPayload) (*models.User, error)
+	Succeeded(ctx context.Context, user *models.User)
+	CheckPassword(ctx context.Context, userID uint) error
+}
+
+// LoginGuardService implements the LoginGuard.
+type LoginGuardService struct {
+	userRepo      repositories.UserInterface
+	deviceRepo    repositories.DeviceInterface
+	challengeRepo repositories.ChallengeInterface
+	sessionRepo   repositories.SessionInterface
+	auditRepo     repositories.AuditInterface
+	mailer        mailer.Mailer
+}
+
+// NewLoginGuardService creates a new instance of LoginGuardService.
+func NewLoginGuardService(
+	userRepo repositories.UserInterface,
+	deviceRepo repositories.DeviceInterface,
+	challengeRepo repositories.ChallengeInterface,
+	sessionRepo repositories.SessionInterface,
+	auditRepo repositories.AuditInterface,
+	m mailer.Mailer,
+) *LoginGuardService {
+	return &LoginGuardService{
+		userRepo:      userRepo,
+		deviceRepo:    deviceRepo,
+		challengeRepo: challengeRepo,
+		sessionRepo:   sessionRepo,
+		auditRepo:     auditRepo,
+		mailer:        m,
+	}
+}
+
+// Check scores the login of the user. Above the configured thresholds it returns
+// ErrLoginBlocked, or a *StepUpRequiredError after emailing a one-time code to the user.
+// Logins to verify from clients sending no device id return ErrDeviceRequired, the
+// code could not be tied to the device entering it.
+func (lg *LoginGuardService) Check(ctx context.Context, user *models.User) (*models.RiskAssessment, error) {
+	risk, err := lg.Assess(ctx, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to assess login: %w", err)
+	}
+
+	switch risk.Decision {
+	case models.RiskBlock:
+		return risk, ErrLoginBlocked
+	case models.RiskStepUp:
+		if requestinfo.FromContext(ctx).DeviceID == "" {
+			return risk, ErrDeviceRequired
+		}
+		challenge, err := lg.challenge(ctx, user)
+		if err != nil {
+			return risk, err
+		}
+		return risk, &StepUpRequiredError{ChallengeID: challenge.ID, ExpiresAt: challenge.ExpiresAt}
+	}
+	return risk, nil
+}
+
+// Assess computes the risk score of a login of the user from the device making the request.
+func (lg *LoginGuardService) Assess(ctx context.Context, userID uint) (*models.RiskAssessment, error) {
+	info := requestinfo.FromContext(ctx)
+	now := time.Now().UTC()
+	risk := &models.RiskAssessment{Factors: []string{}}
+
+	devices, err := lg.deviceRepo.List(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	// The first device of an account is trusted, there is nothing to compare it to. Clients
+	// sending no device id are unknown devices.
+	if len(devices) > 0 && !knownDevice(devices, deviceHash(info.DeviceID)) {
+		risk.NewDevice = true
+		risk.Add(models.RiskNewDevice, riskNewDevice)
+	}
+
+	sessions, err := lg.sessionRepo.History(ctx, userID, LoginHistorySize)
+	if err != nil {
+		return nil, err
+	}
+	// Sessions opened by impersonating administrators say nothing about the habits of the user.
+	sessions = slices.DeleteFunc(sessions, func(session models.Session) bool {
+		return session.ActorID != nil
+	})
+	if len(sessions) >= usualHourSessions && !usualHour(sessions, now.Hour()) {
+		risk.Add(models.RiskUnusualHour, riskUnusualHour)
+	}
+	if len(sessions) > 0 {
+		last := sessions[0]
+		if last.IP != "" && info.IP != "" && last.IP != info.IP && now.Sub(last.CreatedAt) < rapidIPChangeWindow {
+			risk.Add(models.RiskRapidIPChange, riskRapidIPChange)
+		}
+	}
+
+	failures, err := lg.failures(ctx, userID, now)
+	if err != nil {
+		return nil, err
+	}
+	if failures >= failedAttemptsMin {
+		risk.Add(models.RiskFailedAttempts, min(failures*riskFailedAttempt, riskFailedAttempts))
+	}
+
+	conf := config.Config()
+	switch {
+	case conf.RiskBlockScore > 0 && risk.Score >= conf.RiskBlockScore:
+		risk.Decision = models.RiskBlock
+	case conf.RiskStepUpScore > 0 && risk.Score >= conf.RiskStepUpScore:
+		risk.Decision = models.RiskStepUp
+	default:
+		risk.Decision = models.RiskAllow
+	}
+	return risk, nil
+}
+
+// CheckPassword returns ErrLoginBlocked when the password of the user was entered wrong
+// too often recently, at login, when reauthenticating or when restoring the account.
+// It is called before the password is compared.
+func (lg *LoginGuardService) CheckPassword(ctx context.Context, userID uint) error {
+	failures, err := lg.failures(ctx, userID, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to check password attempts: %w", err)
+	}
+	if failures >= passwordAttemptsMax {
+		return ErrLoginBlocked
+	}
+	return nil
+}
+
+// failures returns the number of failed logins, reauthentications and account restores
+// of the user within failedAttemptsWindow.
+func (lg *LoginGuardService) failures(ctx context.Context, userID uint, now time.Time) (int, error) {
+	return lg.auditRepo.CountFailures(ctx, userID, now.Add(-failedAttemptsWindow),
+		models.AuditLogin, models.AuditReauthenticate, models.AuditAccountRestore)
+}
+
+// Verify completes a login held for step-up verification and returns the user.
+// The code must be entered from the device the login was started on.
+func (lg *LoginGuardService) Verify(ctx context.Context, payload models.VerifyLoginPayload) (*models.User, error) {
+	challenge, err := lg.challengeRepo.Find(ctx, payload.ChallengeID)
+	if err != nil {
+		return nil, ErrChallengeInvalid
+	}
+
+	if time.Now().After(challenge.ExpiresAt) || challenge.Attempts >= LoginChallengeAttempts ||
+		challenge.DeviceHash == "" || challenge.DeviceHash != deviceHash(requestinfo.FromContext(ctx).DeviceID) {
+		return nil, ErrChallengeInvalid
+	}
+
+	if subtle.ConstantTimeCompare([]byte(challenge.CodeHash), []byte(utilities.HashToken(payload.Code))) != 1 {
+		if err := lg.challengeRepo.Attempt(ctx, challenge.ID); err != nil {
+			return nil, fmt.Errorf("failed to verify login: %w", err)
+		}
+		return nil, ErrChallengeInvalid
+	}
+
+	if err := lg.challengeRepo.Delete(ctx, challenge.ID); err != nil {
+		return nil, fmt.Errorf("failed to verify login: %w", err)
+	}
+
+	user, err := lg.userRepo.FindByID(ctx, challenge.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify login: %w", err)
+	}
+	return user, nil
+}
+
+// Succeeded records the device of a completed login. Users are notified by email
+// when a device they have not used before logs in to their account, including
+// clients sending no device id, which cannot be recorded.
+func (lg *LoginGuardService) Succeeded(ctx context.Context, user *models.User) {
+	info := requestinfo.FromContext(ctx)
+
+	devices, err := lg.deviceRepo.List(ctx, user.ID)
+	if err != nil {
+		log.Printf("login guard: %v", err)
+		return
+	}
+
+	hash := deviceHash(info.DeviceID)
+	now := time.Now()
+	device := models.Device{
+		UserID:   user.ID,
+		Hash:     hash,
+		Name:     useragent.Describe(info.UserAgent),
+		Family:   useragent.Family(info.UserAgent),
+		LastIP:   info.IP,
+		LastSeen: now,
+	}
+	if hash != "" {
+		if err := lg.deviceRepo.Upsert(ctx, device); err != nil {
+			log.Printf("login guard: %v", err)
+			return
+		}
+	}
+
+	if len(devices) == 0 || knownDevice(devices, hash) {
+		return
+	}
+	err = lg.mailer.Send(ctx, mailer.Message{
+		To:      user.Credential.Email,
+		Subject: "New sign-in to your account",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nYour account was signed in to from a new device:\n\n%s\nIP address: %s\nTime: %s\n\nIf this was not you, change your password and end the session from your account settings.\n",
+			user.FirstName, device.Name, device.LastIP, now.UTC().Format(time.RFC1123),
+		),
+	})
+	if err != nil {
+		log.Printf("login guard: failed to send new device notification: %v", err)
+	}
+}
+
+// challenge holds the login of the user and emails the one-time code confirming it.
+func (lg *LoginGuardService) challenge(ctx context.Context, user *models.User) (*models.LoginChallenge, error) {
+	id, err := utilities.RandomToken(16)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+	code, err := oneTimeCode()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate code: %w", err)
+	}
+
+	challenge := models.LoginChallenge{
+		ID:         id,
+		UserID:     user.ID,
+		CodeHash:   utilities.HashToken(code),
+		DeviceHash: deviceHash(requestinfo.FromContext(ctx).DeviceID),
+		ExpiresAt:  time.Now().Add(LoginChallengeTTL),
+	}
+	if err := lg.challengeRepo.Create(ctx, challenge); err != nil {
+		return nil, fmt.Errorf("failed to create login challenge: %w", err)
+	}
+
+	err = lg.mailer.Send(ctx, mailer.Message{
+		To:      user.Credential.Email,
+		Subject: "Confirm your sign-in",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nWe noticed an unusual sign-in to your account. Use the following code to confirm it was you:\n\n%s\n\nThe code expires in %s.\n",
+			user.FirstName, code, LoginChallengeTTL,
+		),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to send login challenge: %w", err)
+	}
+	return &challenge, nil
+}
+
+// deviceHash returns the stored form of a device cookie, empty when the client has none.
+func deviceHash(deviceID string) string {
+	if deviceID == "" {
+		return ""
+	}
+	return utilities.HashToken(deviceID)
+}
+
+func knownDevice(devices []models.Device, hash string) bool {
+	if hash == "" {
+		return false
+	}
+	for _, device := range devices {
+		if device.Hash == hash {
+			return true
+		}
+	}
+	return false
+}
+
+// usualHour reports whether a past session started within usualHourWindow hours of hour, in UTC.
+func usualHour(sessions []models.Session, hour int) bool {
+	for _, session := range sessions {
+		d := session.CreatedAt.UTC().Hour() - hour
+		if d < 0 {
+			d = -d
+		}
+		if min(d, 24-d) <= usualHourWindow {
+			return true
+		}
+	}
+	return false
+}
+
+// oneTimeCode returns a random six digit code.
+func oneTimeCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// deviceSource exposes the known devices of a user to data subject requests.
+type deviceSource struct {
+	deviceRepo repositories.DeviceInterface
+}
+
+// NewDeviceSource returns the DataSource of the devices users have logged in from.
+func NewDeviceSource(deviceRepo repositories.DeviceInterface) DataSource {
+	return &deviceSource{
+		deviceRepo: deviceRepo,
+	}
+}
+
+func (s *deviceSource) Name() string {
+	return "devices"
+}
+
+func (s *deviceSource) Export(ctx context.Context, id uint) (any, error) {
+	return s.deviceRepo.List(ctx, id)
+}
+
+func (s *deviceSource) Erase(ctx context.Context, id uint) error {
+	return s.deviceRepo.DeleteAll(ctx, id)
+}
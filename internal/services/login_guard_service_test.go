@@ -0,0 +1,542 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/ryanpujo/melius/config"
+	"github.com/ryanpujo/melius/internal/mailer"
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/ryanpujo/melius/internal/requestinfo"
+	"github.com/ryanpujo/melius/internal/services"
+	"github.com/ryanpujo/melius/internal/utilities"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type LoginGuardMock struct {
+	mock.Mock
+}
+
+func (lgm *LoginGuardMock) Check(ctx context.Context, user *models.User) (*models.RiskAssessment, error) {
+	args := lgm.Called(ctx, user)
+	return args.Get(0).(*models.RiskAssessment), args.Error(1)
+}
+
+func (lgm *LoginGuardMock) Verify(ctx context.Context, payload models.VerifyLoginPayload) (*models.User, error) {
+	args := lgm.Called(ctx, payload)
+	return args.Get(0).(*models.User), args.Error(1)
+}
+
+func (lgm *LoginGuardMock) Succeeded(ctx context.Context, user *models.User) {
+	lgm.Called(ctx, user)
+}
+
+func (lgm *LoginGuardMock) CheckPassword(ctx context.Context, userID uint) error {
+	args := lgm.Called(ctx, userID)
+	return args.Error(0)
+}
+
+type DeviceRepoMock struct {
+	mock.Mock
+}
+
+func (drm *DeviceRepoMock) List(ctx context.Context, userID uint) ([]models.Device, error) {
+	args := drm.Called(ctx, userID)
+	return args.Get(0).([]models.Device), args.Error(1)
+}
+
+func (drm *DeviceRepoMock) Upsert(ctx context.Context, device models.Device) error {
+	args := drm.Called(ctx, device)
+	return args.Error(0)
+}
+
+func (drm *DeviceRepoMock) DeleteAll(ctx context.Context, userID uint) error {
+	args := drm.Called(ctx, userID)
+	return args.Error(0)
+}
+
+type ChallengeRepoMock struct {
+	mock.Mock
+}
+
+func (chrm *ChallengeRepoMock) Create(ctx context.Context, challenge models.LoginChallenge) error {
+	args := chrm.Called(ctx, challenge)
+	return args.Error(0)
+}
+
+func (chrm *ChallengeRepoMock) Find(ctx context.Context, id string) (*models.LoginChallenge, error) {
+	args := chrm.Called(ctx, id)
+	return args.Get(0).(*models.LoginChallenge), args.Error(1)
+}
+
+func (chrm *ChallengeRepoMock) Attempt(ctx context.Context, id string) error {
+	args := chrm.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (chrm *ChallengeRepoMock) Delete(ctx context.Context, id string) error {
+	args := chrm.Called(ctx, id)
+	return args.Error(0)
+}
+
+const deviceID = "device-cookie"
+
+// allowed is the assessment of a login without risk factors.
+var allowed = &models.RiskAssessment{Factors: []string{}, Decision: models.RiskAllow}
+
+func guardContext() context.Context {
+	return requestinfo.NewContext(context.Background(), requestinfo.Info{
+		IP:        "203.0.113.7",
+		UserAgent: "Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0",
+		DeviceID:  deviceID,
+	})
+}
+
+func riskThresholds(t *testing.T, stepUp, block int) {
+	conf := config.Config()
+	prevStepUp, prevBlock := conf.RiskStepUpScore, conf.RiskBlockScore
+	conf.RiskStepUpScore, conf.RiskBlockScore = stepUp, block
+	t.Cleanup(func() {
+		conf.RiskStepUpScore, conf.RiskBlockScore = prevStepUp, prevBlock
+	})
+}
+
+func TestAssess(t *testing.T) {
+	riskThresholds(t, 40, 90)
+	now := time.Now().UTC()
+	known := []models.Device{{Hash: utilities.HashToken(deviceID)}}
+	other := []models.Device{{Hash: utilities.HashToken("other")}}
+
+	// Sessions twelve hours away from now, the current hour is unusual for them.
+	away := make([]models.Session, 5)
+	for i := range away {
+		away[i] = models.Session{IP: "203.0.113.7", CreatedAt: now.Add(-12*time.Hour).AddDate(0, 0, -i)}
+	}
+
+	tableTest := map[string]struct {
+		devices  []models.Device
+		sessions []models.Session
+		noDevice bool
+		failures int
+		score    int
+		factors  []string
+		decision string
+	}{
+		"first device": {
+			devices:  []models.Device{},
+			sessions: []models.Session{},
+			factors:  []string{},
+			decision: models.RiskAllow,
+		},
+		"known device": {
+			devices:  known,
+			sessions: []models.Session{{IP: "203.0.113.7", CreatedAt: now.Add(-time.Minute)}},
+			factors:  []string{},
+			decision: models.RiskAllow,
+		},
+		"new device": {
+			devices:  other,
+			sessions: []models.Session{},
+			score:    40,
+			factors:  []string{models.RiskNewDevice},
+			decision: models.RiskStepUp,
+		},
+		"no device": {
+			devices:  known,
+			sessions: []models.Session{},
+			noDevice: true,
+			score:    40,
+			factors:  []string{models.RiskNewDevice},
+			decision: models.RiskStepUp,
+		},
+		"unusual hour": {
+			devices:  known,
+			sessions: away,
+			score:    15,
+			factors:  []string{models.RiskUnusualHour},
+			decision: models.RiskAllow,
+		},
+		"rapid ip change": {
+			devices:  known,
+			sessions: []models.Session{{IP: "198.51.100.1", CreatedAt: now.Add(-10 * time.Minute)}},
+			score:    20,
+			factors:  []string{models.RiskRapidIPChange},
+			decision: models.RiskAllow,
+		},
+		"failed attempts": {
+			devices:  known,
+			sessions: []models.Session{},
+			failures: 4,
+			score:    40,
+			factors:  []string{models.RiskFailedAttempts},
+			decision: models.RiskStepUp,
+		},
+		"blocked": {
+			devices:  other,
+			sessions: []models.Session{{IP: "198.51.100.1", CreatedAt: now.Add(-10 * time.Minute)}},
+			failures: 12,
+			score:    110,
+			factors:  []string{models.RiskNewDevice, models.RiskRapidIPChange, models.RiskFailedAttempts},
+			decision: models.RiskBlock,
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			drm := new(DeviceRepoMock)
+			srm := new(SessionRepoMock)
+			auditRepo := new(AuditRepoMock)
+			guard := services.NewLoginGuardService(urm, drm, new(ChallengeRepoMock), srm, auditRepo, mm)
+
+			drm.On("List", mock.Anything, uint(1)).Return(v.devices, nil).Once()
+			srm.On("History", mock.Anything, uint(1), services.LoginHistorySize).Return(v.sessions, nil).Once()
+			auditRepo.On("CountFailures", mock.Anything, uint(1), mock.Anything, []string{models.AuditLogin, models.AuditReauthenticate, models.AuditAccountRestore}).Return(v.failures, nil).Once()
+
+			ctx := guardContext()
+			if v.noDevice {
+				ctx = requestinfo.NewContext(context.Background(), requestinfo.Info{IP: "203.0.113.7"})
+			}
+			risk, err := guard.Assess(ctx, 1)
+			require.NoError(t, err)
+			require.Equal(t, v.score, risk.Score)
+			require.Equal(t, v.factors, risk.Factors)
+			require.Equal(t, v.decision, risk.Decision)
+		})
+	}
+}
+
+func TestGuardCheck(t *testing.T) {
+	riskThresholds(t, 40, 90)
+
+	drm := new(DeviceRepoMock)
+	srm := new(SessionRepoMock)
+	chrm := new(ChallengeRepoMock)
+	auditRepo := new(AuditRepoMock)
+	mm := new(MailerMock)
+	guard := services.NewLoginGuardService(urm, drm, chrm, srm, auditRepo, mm)
+
+	var challenge models.LoginChallenge
+	var msg mailer.Message
+	drm.On("List", mock.Anything, uint(1)).Return([]models.Device{{Hash: "other"}}, nil).Once()
+	srm.On("History", mock.Anything, uint(1), services.LoginHistorySize).Return([]models.Session{}, nil).Once()
+	auditRepo.On("CountFailures", mock.Anything, uint(1), mock.Anything, []string{models.AuditLogin, models.AuditReauthenticate, models.AuditAccountRestore}).Return(0, nil).Once()
+	chrm.On("Create", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		challenge = args.Get(1).(models.LoginChallenge)
+	}).Return(nil).Once()
+	mm.On("Send", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		msg = args.Get(1).(mailer.Message)
+	}).Return(nil).Once()
+
+	risk, err := guard.Check(guardContext(), &user)
+
+	var stepUp *services.StepUpRequiredError
+	require.ErrorAs(t, err, &stepUp)
+	require.Equal(t, challenge.ID, stepUp.ChallengeID)
+	require.Equal(t, models.RiskStepUp, risk.Decision)
+	require.Equal(t, uint(1), challenge.UserID)
+	require.Equal(t, utilities.HashToken(deviceID), challenge.DeviceHash)
+	require.Equal(t, user.Credential.Email, msg.To)
+	code := regexp.MustCompile(`\b\d{6}\b`).FindString(msg.Body)
+	require.Equal(t, challenge.CodeHash, utilities.HashToken(code))
+}
+
+func TestGuardCheckWithoutDevice(t *testing.T) {
+	riskThresholds(t, 40, 90)
+
+	drm := new(DeviceRepoMock)
+	srm := new(SessionRepoMock)
+	chrm := new(ChallengeRepoMock)
+	auditRepo := new(AuditRepoMock)
+	mm := new(MailerMock)
+	guard := services.NewLoginGuardService(urm, drm, chrm, srm, auditRepo, mm)
+
+	drm.On("List", mock.Anything, uint(1)).Return([]models.Device{{Hash: "other"}}, nil).Once()
+	srm.On("History", mock.Anything, uint(1), services.LoginHistorySize).Return([]models.Session{}, nil).Once()
+	auditRepo.On("CountFailures", mock.Anything, uint(1), mock.Anything, []string{models.AuditLogin, models.AuditReauthenticate, models.AuditAccountRestore}).Return(0, nil).Once()
+
+	// The code could never be entered from the device the login was started on.
+	risk, err := guard.Check(requestinfo.NewContext(context.Background(), requestinfo.Info{IP: "203.0.113.7"}), &user)
+
+	require.ErrorIs(t, err, services.ErrDeviceRequired)
+	require.Equal(t, models.RiskStepUp, risk.Decision)
+	chrm.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	mm.AssertNotCalled(t, "Send", mock.Anything, mock.Anything)
+}
+
+func TestGuardCheckPassword(t *testing.T) {
+	tableTest := map[string]struct {
+		failures int
+		assert   func(t *testing.T, err error)
+	}{
+		"allowed": {
+			failures: 4,
+			assert: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		"too many failures": {
+			failures: 5,
+			assert: func(t *testing.T, err error) {
+				require.ErrorIs(t, err, services.ErrLoginBlocked)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			auditRepo := new(AuditRepoMock)
+			guard := services.NewLoginGuardService(urm, new(DeviceRepoMock), new(ChallengeRepoMock), new(SessionRepoMock), auditRepo, mm)
+			auditRepo.On("CountFailures", mock.Anything, uint(1), mock.Anything, []string{models.AuditLogin, models.AuditReauthenticate, models.AuditAccountRestore}).Return(v.failures, nil).Once()
+
+			err := guard.CheckPassword(context.Background(), 1)
+
+			v.assert(t, err)
+			auditRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestGuardVerify(t *testing.T) {
+	code := "123456"
+	valid := models.LoginChallenge{
+		ID:         "challenge",
+		UserID:     1,
+		CodeHash:   utilities.HashToken(code),
+		DeviceHash: utilities.HashToken(deviceID),
+		ExpiresAt:  time.Now().Add(time.Minute),
+	}
+	expired := valid
+	expired.ExpiresAt = time.Now().Add(-time.Minute)
+	otherDevice := valid
+	otherDevice.DeviceHash = utilities.HashToken("other")
+	exhausted := valid
+	exhausted.Attempts = services.LoginChallengeAttempts
+	noDevice := valid
+	noDevice.DeviceHash = ""
+
+	tableTest := map[string]struct {
+		code     string
+		noDevice bool
+		arrange  func(chrm *ChallengeRepoMock, urm *UserRepoMock)
+		assert   func(t *testing.T, user *models.User, err error)
+	}{
+		"success": {
+			code: code,
+			arrange: func(chrm *ChallengeRepoMock, urm *UserRepoMock) {
+				chrm.On("Find", mock.Anything, "challenge").Return(&valid, nil).Once()
+				chrm.On("Delete", mock.Anything, "challenge").Return(nil).Once()
+				urm.On("FindByID", mock.Anything, uint(1)).Return(&user, nil).Once()
+			},
+			assert: func(t *testing.T, u *models.User, err error) {
+				require.NoError(t, err)
+				require.Equal(t, user.ID, u.ID)
+			},
+		},
+		"wrong code": {
+			code: "654321",
+			arrange: func(chrm *ChallengeRepoMock, urm *UserRepoMock) {
+				chrm.On("Find", mock.Anything, "challenge").Return(&valid, nil).Once()
+				chrm.On("Attempt", mock.Anything, "challenge").Return(nil).Once()
+			},
+			assert: func(t *testing.T, u *models.User, err error) {
+				require.ErrorIs(t, err, services.ErrChallengeInvalid)
+				require.Nil(t, u)
+			},
+		},
+		"not found": {
+			code: code,
+			arrange: func(chrm *ChallengeRepoMock, urm *UserRepoMock) {
+				chrm.On("Find", mock.Anything, "challenge").Return((*models.LoginChallenge)(nil), errors.New("not found")).Once()
+			},
+			assert: func(t *testing.T, u *models.User, err error) {
+				require.ErrorIs(t, err, services.ErrChallengeInvalid)
+			},
+		},
+		"expired": {
+			code: code,
+			arrange: func(chrm *ChallengeRepoMock, urm *UserRepoMock) {
+				chrm.On("Find", mock.Anything, "challenge").Return(&expired, nil).Once()
+			},
+			assert: func(t *testing.T, u *models.User, err error) {
+				require.ErrorIs(t, err, services.ErrChallengeInvalid)
+			},
+		},
+		"other device": {
+			code: code,
+			arrange: func(chrm *ChallengeRepoMock, urm *UserRepoMock) {
+				chrm.On("Find", mock.Anything, "challenge").Return(&otherDevice, nil).Once()
+			},
+			assert: func(t *testing.T, u *models.User, err error) {
+				require.ErrorIs(t, err, services.ErrChallengeInvalid)
+			},
+		},
+		"no device": {
+			code:     code,
+			noDevice: true,
+			arrange: func(chrm *ChallengeRepoMock, urm *UserRepoMock) {
+				chrm.On("Find", mock.Anything, "challenge").Return(&noDevice, nil).Once()
+			},
+			assert: func(t *testing.T, u *models.User, err error) {
+				require.ErrorIs(t, err, services.ErrChallengeInvalid)
+			},
+		},
+		"too many attempts": {
+			code: code,
+			arrange: func(chrm *ChallengeRepoMock, urm *UserRepoMock) {
+				chrm.On("Find", mock.Anything, "challenge").Return(&exhausted, nil).Once()
+			},
+			assert: func(t *testing.T, u *models.User, err error) {
+				require.ErrorIs(t, err, services.ErrChallengeInvalid)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			chrm := new(ChallengeRepoMock)
+			urm := new(UserRepoMock)
+			guard := services.NewLoginGuardService(urm, new(DeviceRepoMock), chrm, new(SessionRepoMock), new(AuditRepoMock), mm)
+			v.arrange(chrm, urm)
+
+			ctx := guardContext()
+			if v.noDevice {
+				ctx = requestinfo.NewContext(context.Background(), requestinfo.Info{IP: "203.0.113.7"})
+			}
+			u, err := guard.Verify(ctx, models.VerifyLoginPayload{ChallengeID: "challenge", Code: v.code})
+
+			v.assert(t, u, err)
+			chrm.AssertExpectations(t)
+		})
+	}
+}
+
+func TestGuardSucceeded(t *testing.T) {
+	tableTest := map[string]struct {
+		devices  []models.Device
+		noDevice bool
+		notify   bool
+	}{
+		"first device": {
+			devices: []models.Device{},
+		},
+		"known device": {
+			devices: []models.Device{{Hash: utilities.HashToken(deviceID)}},
+		},
+		"new device": {
+			devices: []models.Device{{Hash: utilities.HashToken("other")}},
+			notify:  true,
+		},
+		"no device": {
+			devices:  []models.Device{{Hash: utilities.HashToken(deviceID)}},
+			noDevice: true,
+			notify:   true,
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			drm := new(DeviceRepoMock)
+			mm := new(MailerMock)
+			guard := services.NewLoginGuardService(urm, drm, new(ChallengeRepoMock), new(SessionRepoMock), new(AuditRepoMock), mm)
+
+			var device models.Device
+			drm.On("List", mock.Anything, uint(1)).Return(v.devices, nil).Once()
+			if v.notify {
+				mm.On("Send", mock.Anything, mock.Anything).Return(nil).Once()
+			}
+			if v.noDevice {
+				guard.Succeeded(requestinfo.NewContext(context.Background(), requestinfo.Info{IP: "203.0.113.7"}), &user)
+
+				drm.AssertNotCalled(t, "Upsert", mock.Anything, mock.Anything)
+				mm.AssertExpectations(t)
+				return
+			}
+			drm.On("Upsert", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+				device = args.Get(1).(models.Device)
+			}).Return(nil).Once()
+
+			guard.Succeeded(guardContext(), &user)
+
+			require.Equal(t, utilities.HashToken(deviceID), device.Hash)
+			require.Equal(t, "Firefox on Linux", device.Name)
+			require.Equal(t, "203.0.113.7", device.LastIP)
+			mm.AssertExpectations(t)
+			if !v.notify {
+				mm.AssertNotCalled(t, "Send", mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestLoginRisk(t *testing.T) {
+	services.CompareHashAndPassword = func(hash, plain string) error {
+		return nil
+	}
+	defer func() { services.CompareHashAndPassword = compareFunc }()
+	payload := models.LoginPayload{Username: "ryanpujo", Password: "okeoke"}
+
+	t.Run("step up", func(t *testing.T) {
+		stepUp := &services.StepUpRequiredError{ChallengeID: "challenge"}
+		risk := &models.RiskAssessment{Score: 40, Factors: []string{models.RiskNewDevice}, Decision: models.RiskStepUp}
+		crm.On("FindByUsername", mock.Anything, "ryanpujo").Return(&user, nil).Once()
+		lgm.On("Check", mock.Anything, &user).Return(risk, stepUp).Once()
+
+		token, err := credService.Login(context.Background(), &payload)
+
+		require.ErrorIs(t, err, stepUp)
+		require.Zero(t, token)
+		event := aud.last()
+		require.Equal(t, models.AuditLoginChallenge, event.Action)
+		require.Equal(t, models.AuditOutcomeSuccess, event.Outcome)
+		require.Equal(t, 40, event.Details["risk_score"])
+	})
+
+	t.Run("blocked", func(t *testing.T) {
+		risk := &models.RiskAssessment{Score: 100, Decision: models.RiskBlock}
+		crm.On("FindByUsername", mock.Anything, "ryanpujo").Return(&user, nil).Once()
+		lgm.On("Check", mock.Anything, &user).Return(risk, services.ErrLoginBlocked).Once()
+
+		_, err := credService.Login(context.Background(), &payload)
+
+		require.ErrorIs(t, err, services.ErrLoginBlocked)
+		event := aud.last()
+		require.Equal(t, models.AuditLogin, event.Action)
+		require.Equal(t, models.AuditOutcomeFailure, event.Outcome)
+		require.Equal(t, models.RiskBlock, event.Details["risk_decision"])
+	})
+}
+
+func TestVerifyLogin(t *testing.T) {
+	verifyPayload := models.VerifyLoginPayload{ChallengeID: "challenge", Code: "123456"}
+
+	t.Run("success", func(t *testing.T) {
+		lgm.On("Verify", mock.Anything, verifyPayload).Return(&user, nil).Once()
+		arm.On("List", mock.Anything).Return([]models.AttributeDefinition{}, nil).Once()
+		srm.On("Create", mock.Anything, mock.Anything).Return(nil).Once()
+		lgm.On("Succeeded", mock.Anything, &user).Once()
+
+		token, err := credService.VerifyLogin(context.Background(), verifyPayload)
+
+		require.NoError(t, err)
+		require.NotZero(t, token)
+		event := aud.last()
+		require.Equal(t, models.AuditLogin, event.Action)
+		require.Equal(t, models.AuditOutcomeSuccess, event.Outcome)
+	})
+
+	t.Run("invalid code", func(t *testing.T) {
+		lgm.On("Verify", mock.Anything, verifyPayload).Return((*models.User)(nil), services.ErrChallengeInvalid).Once()
+
+		token, err := credService.VerifyLogin(context.Background(), verifyPayload)
+
+		require.ErrorIs(t, err, services.ErrChallengeInvalid)
+		require.Zero(t, token)
+		event := aud.last()
+		require.Equal(t, models.AuditLoginChallenge, event.Action)
+		require.Equal(t, models.AuditOutcomeFailure, event.Outcome)
+	})
+}
@@ -0,0 +1,325 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/ryanpujo/melius/internal/jwttoken"
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/ryanpujo/melius/internal/repositories"
+	"github.com/ryanpujo/melius/internal/requestinfo"
+)
+
+var (
+	ErrInvalidPolicy  = errors.New("invalid policy")
+	ErrPolicyNotFound = errors.New("policy not found")
+)
+
+var policyName = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,99}$`)
+
+// policyCostLimit bounds the work of a single evaluation, so a costly expression
+// cannot stall the requests of the routes requiring it.
+const policyCostLimit = 100000
+
+// policyEnv is the CEL environment of policies. Expressions see the principal, the
+// resource sent by the caller and the environment of the request as maps.
+var policyEnv = sync.OnceValues(func() (*cel.Env, error) {
+	return cel.NewEnv(
+		cel.Variable("principal", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("resource", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("env", cel.MapType(cel.StringType, cel.DynType)),
+		cel.CrossTypeNumericComparisons(true),
+	)
+})
+
+// PolicyInterface defines the administration and evaluation of authorization policies.
+type PolicyInterface interface {
+	List(ctx context.Context) ([]models.Policy, error)
+	Define(ctx context.Context, name string, payload models.PolicyPayload) (*models.Policy, error)
+	Delete(ctx context.Context, name string) error
+	// Evaluate decides whether principal may act on resource by the policy called name.
+	// It returns ErrPolicyNotFound when there is no such policy.
+	Evaluate(ctx context.Context, name string, principal models.PolicyPrincipal, resource map[string]any) (*models.AuthzDecision, error)
+}
+
+// PolicySet holds the compiled policies, shared by every PolicyService of the instance.
+// Its generation counts the definitions and deletions made through the instance, so a
+// reload can tell whether one committed while it listed the stored policies.
+type PolicySet struct {
+	mu         sync.RWMutex
+	loaded     bool
+	generation uint64
+	policies   map[string]compiledPolicy
+}
+
+type compiledPolicy struct {
+	expression string
+	program    cel.Program
+}
+
+// NewPolicySet returns an empty PolicySet, filled on the first evaluation.
+func NewPolicySet() *PolicySet {
+	return &PolicySet{policies: map[string]compiledPolicy{}}
+}
+
+func (ps *PolicySet) get(name string) (compiledPolicy, bool, bool) {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+	policy, ok := ps.policies[name]
+	return policy, ok, ps.loaded
+}
+
+func (ps *PolicySet) put(name string, policy compiledPolicy) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.policies[name] = policy
+	ps.generation++
+}
+
+func (ps *PolicySet) remove(name string) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	delete(ps.policies, name)
+	ps.generation++
+}
+
+// snapshot returns the current policies and generation.
+func (ps *PolicySet) snapshot() (map[string]compiledPolicy, uint64) {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+	return ps.policies, ps.generation
+}
+
+// replace replaces the policies with those listed at generation, unless policies were
+// defined or deleted since, which the listing may have missed. It reports whether it did.
+func (ps *PolicySet) replace(policies map[string]compiledPolicy, generation uint64) bool {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if ps.generation != generation {
+		return false
+	}
+	ps.policies = policies
+	ps.loaded = true
+	return true
+}
+
+// PolicyService implements the PolicyInterface.
+type PolicyService struct {
+	policyRepo repositories.PolicyInterface
+	userRepo   repositories.UserInterface
+	auditor    Auditor
+	set        *PolicySet
+}
+
+// NewPolicyService creates a new instance of PolicyService.
+func NewPolicyService(policyRepo repositories.PolicyInterface, userRepo repositories.UserInterface, auditor Auditor, set *PolicySet) *PolicyService {
+	return &PolicyService{
+		policyRepo: policyRepo,
+		userRepo:   userRepo,
+		auditor:    auditor,
+		set:        set,
+	}
+}
+
+// List returns every policy.
+func (ps *PolicyService) List(ctx context.Context) ([]models.Policy, error) {
+	policies, err := ps.policyRepo.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list policies: %w", err)
+	}
+	return policies, nil
+}
+
+// Define creates or replaces the policy called name. The expression must compile to a
+// boolean, it takes effect immediately on this instance and on the next reload on others.
+func (ps *PolicyService) Define(ctx context.Context, name string, payload models.PolicyPayload) (_ *models.Policy, err error) {
+	defer func() {
+		audit(ctx, ps.auditor, models.AuditPolicyDefine, 0, err, map[string]any{"name": name})
+	}()
+
+	if !policyName.MatchString(name) {
+		return nil, fmt.Errorf("%w: name must be lower case letters, digits, dashes and underscores", ErrInvalidPolicy)
+	}
+	program, err := compilePolicy(payload.Expression)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := models.Policy{
+		Name:        name,
+		Description: payload.Description,
+		Expression:  payload.Expression,
+		UpdatedAt:   time.Now().UTC().Truncate(time.Second),
+	}
+	if err := ps.policyRepo.Upsert(ctx, policy); err != nil {
+		return nil, fmt.Errorf("failed to define policy: %w", err)
+	}
+	ps.set.put(name, compiledPolicy{expression: policy.Expression, program: program})
+	return &policy, nil
+}
+
+// Delete removes the policy called name. Routes requiring it deny every request from then on.
+func (ps *PolicyService) Delete(ctx context.Context, name string) error {
+	err := ps.policyRepo.Delete(ctx, name)
+	audit(ctx, ps.auditor, models.AuditPolicyDelete, 0, err, map[string]any{"name": name})
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrPolicyNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete policy: %w", err)
+	}
+	ps.set.remove(name)
+	return nil
+}
+
+// Evaluate decides by the policy called name. Expressions failing to evaluate, on a
+// missing attribute for instance, deny with the reason of the failure.
+func (ps *PolicyService) Evaluate(ctx context.Context, name string, principal models.PolicyPrincipal, resource map[string]any) (*models.AuthzDecision, error) {
+	policy, ok, loaded := ps.set.get(name)
+	if !loaded {
+		if err := ps.Reload(ctx); err != nil {
+			return nil, err
+		}
+		policy, ok, _ = ps.set.get(name)
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: '%s'", ErrPolicyNotFound, name)
+	}
+
+	principalVars, err := ps.principalVars(ctx, principal)
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate policy: %w", err)
+	}
+	if resource == nil {
+		resource = map[string]any{}
+	}
+
+	decision := &models.AuthzDecision{Policy: name}
+	out, _, err := policy.program.ContextEval(ctx, map[string]any{
+		"principal": principalVars,
+		"resource":  resource,
+		"env": map[string]any{
+			"time": time.Now(),
+			"ip":   requestinfo.FromContext(ctx).IP,
+		},
+	})
+	if err != nil {
+		decision.Reason = err.Error()
+		return decision, nil
+	}
+	allowed, ok := out.Value().(bool)
+	if !ok {
+		decision.Reason = "policy did not evaluate to a boolean"
+		return decision, nil
+	}
+	decision.Allowed = allowed
+	return decision, nil
+}
+
+// Reload compiles the stored policies into the shared set, reusing the programs of
+// unchanged expressions. Stored expressions that no longer compile are left out, so
+// they deny, and logged. When a policy is defined or deleted through this instance
+// while the policies are listed, they are listed again, so the change is not undone.
+func (ps *PolicyService) Reload(ctx context.Context) error {
+	for {
+		current, generation := ps.set.snapshot()
+		policies, err := ps.policyRepo.List(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to load policies: %w", err)
+		}
+
+		compiled := make(map[string]compiledPolicy, len(policies))
+		for _, policy := range policies {
+			if existing, ok := current[policy.Name]; ok && existing.expression == policy.Expression {
+				compiled[policy.Name] = existing
+				continue
+			}
+			program, err := compilePolicy(policy.Expression)
+			if err != nil {
+				log.Printf("policy '%s' skipped: %v", policy.Name, err)
+				continue
+			}
+			compiled[policy.Name] = compiledPolicy{expression: policy.Expression, program: program}
+		}
+
+		if ps.set.replace(compiled, generation) {
+			return nil
+		}
+	}
+}
+
+// Run reloads the policies every interval until ctx is done, picking up the changes
+// made through other instances. Policies are not reloaded when interval is not positive.
+func (ps *PolicyService) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		log.Printf("policy reload disabled: interval %v is not positive", interval)
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := ps.Reload(ctx); err != nil {
+				log.Printf("policy reload failed: %v", err)
+			}
+		}
+	}
+}
+
+// principalVars returns the principal as seen by expressions, with the attributes of users.
+func (ps *PolicyService) principalVars(ctx context.Context, principal models.PolicyPrincipal) (map[string]any, error) {
+	vars := map[string]any{
+		"type":       principal.Type,
+		"id":         int64(principal.ID),
+		"username":   principal.Username,
+		"roles":      nonNil(principal.Roles),
+		"scopes":     nonNil(principal.Scopes),
+		"client_id":  principal.ClientID,
+		"acr":        principal.ACR,
+		"attributes": map[string]any{},
+	}
+	if principal.Type == jwttoken.PrincipalUser && principal.ID != 0 {
+		user, err := ps.userRepo.FindByID(ctx, principal.ID)
+		if err != nil {
+			return nil, err
+		}
+		if user.Attributes != nil {
+			vars["attributes"] = user.Attributes
+		}
+	}
+	return vars, nil
+}
+
+// compilePolicy compiles expression into a program, checking it evaluates to a boolean.
+func compilePolicy(expression string) (cel.Program, error) {
+	env, err := policyEnv()
+	if err != nil {
+		return nil, err
+	}
+	ast, issues := env.Compile(expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPolicy, issues.Err())
+	}
+	if out := ast.OutputType(); !out.IsExactType(cel.BoolType) && !out.IsExactType(cel.DynType) {
+		return nil, fmt.Errorf("%w: expression must evaluate to a boolean, not %s", ErrInvalidPolicy, out)
+	}
+	return env.Program(ast, cel.CostLimit(policyCostLimit), cel.InterruptCheckFrequency(100))
+}
+
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
@@ -0,0 +1,306 @@
+package services_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/ryanpujo/melius/internal/jwttoken"
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/ryanpujo/melius/internal/services"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type PolicyRepoMock struct {
+	mock.Mock
+}
+
+func (prm *PolicyRepoMock) List(ctx context.Context) ([]models.Policy, error) {
+	args := prm.Called(ctx)
+	return args.Get(0).([]models.Policy), args.Error(1)
+}
+
+func (prm *PolicyRepoMock) Upsert(ctx context.Context, policy models.Policy) error {
+	args := prm.Called(ctx, policy)
+	return args.Error(0)
+}
+
+func (prm *PolicyRepoMock) Delete(ctx context.Context, name string) error {
+	args := prm.Called(ctx, name)
+	return args.Error(0)
+}
+
+var (
+	salesPolicy = models.Policy{
+		Name:       "sales-only",
+		Expression: `principal.attributes.department == "sales" && resource.amount <= 1000`,
+	}
+	policyPrincipal = models.PolicyPrincipal{
+		Type:     jwttoken.PrincipalUser,
+		ID:       1,
+		Username: "ryanpujo",
+		Roles:    []string{"user"},
+	}
+)
+
+func TestDefinePolicy(t *testing.T) {
+	tableTest := map[string]struct {
+		name    string
+		payload models.PolicyPayload
+		arrange func(prm *PolicyRepoMock)
+		assert  func(t *testing.T, policy *models.Policy, err error)
+	}{
+		"success": {
+			name:    salesPolicy.Name,
+			payload: models.PolicyPayload{Expression: salesPolicy.Expression},
+			arrange: func(prm *PolicyRepoMock) {
+				prm.On("Upsert", mock.Anything, mock.Anything).Return(nil).Once()
+			},
+			assert: func(t *testing.T, policy *models.Policy, err error) {
+				require.NoError(t, err)
+				require.Equal(t, salesPolicy.Name, policy.Name)
+				require.Equal(t, models.AuditPolicyDefine, aud.last().Action)
+			},
+		},
+		"invalid name": {
+			name:    "Sales Only",
+			payload: models.PolicyPayload{Expression: "true"},
+			arrange: func(prm *PolicyRepoMock) {},
+			assert: func(t *testing.T, policy *models.Policy, err error) {
+				require.ErrorIs(t, err, services.ErrInvalidPolicy)
+				require.Nil(t, policy)
+			},
+		},
+		"syntax error": {
+			name:    salesPolicy.Name,
+			payload: models.PolicyPayload{Expression: "principal.roles.exists(r, "},
+			arrange: func(prm *PolicyRepoMock) {},
+			assert: func(t *testing.T, policy *models.Policy, err error) {
+				require.ErrorIs(t, err, services.ErrInvalidPolicy)
+			},
+		},
+		"not a boolean": {
+			name:    salesPolicy.Name,
+			payload: models.PolicyPayload{Expression: "principal.username + 'x'"},
+			arrange: func(prm *PolicyRepoMock) {},
+			assert: func(t *testing.T, policy *models.Policy, err error) {
+				require.ErrorIs(t, err, services.ErrInvalidPolicy)
+			},
+		},
+		"undeclared variable": {
+			name:    salesPolicy.Name,
+			payload: models.PolicyPayload{Expression: "request.path == '/'"},
+			arrange: func(prm *PolicyRepoMock) {},
+			assert: func(t *testing.T, policy *models.Policy, err error) {
+				require.ErrorIs(t, err, services.ErrInvalidPolicy)
+			},
+		},
+		"failed to save": {
+			name:    salesPolicy.Name,
+			payload: models.PolicyPayload{Expression: salesPolicy.Expression},
+			arrange: func(prm *PolicyRepoMock) {
+				prm.On("Upsert", mock.Anything, mock.Anything).Return(errors.New("failed")).Once()
+			},
+			assert: func(t *testing.T, policy *models.Policy, err error) {
+				require.Error(t, err)
+				require.Nil(t, policy)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			prm := new(PolicyRepoMock)
+			v.arrange(prm)
+			policyService := services.NewPolicyService(prm, urm, aud, services.NewPolicySet())
+
+			policy, err := policyService.Define(context.Background(), v.name, v.payload)
+
+			v.assert(t, policy, err)
+			prm.AssertExpectations(t)
+		})
+	}
+}
+
+func TestEvaluatePolicy(t *testing.T) {
+	tableTest := map[string]struct {
+		policy    string
+		principal models.PolicyPrincipal
+		resource  map[string]any
+		arrange   func(prm *PolicyRepoMock)
+		assert    func(t *testing.T, decision *models.AuthzDecision, err error)
+	}{
+		"allowed": {
+			policy:    salesPolicy.Name,
+			principal: policyPrincipal,
+			resource:  map[string]any{"amount": float64(500)},
+			arrange: func(prm *PolicyRepoMock) {
+				prm.On("List", mock.Anything).Return([]models.Policy{salesPolicy}, nil).Once()
+				urm.On("FindByID", mock.Anything, uint(1)).
+					Return(&models.User{ID: 1, Attributes: map[string]any{"department": "sales"}}, nil).Once()
+			},
+			assert: func(t *testing.T, decision *models.AuthzDecision, err error) {
+				require.NoError(t, err)
+				require.True(t, decision.Allowed)
+				require.Empty(t, decision.Reason)
+			},
+		},
+		"denied": {
+			policy:    salesPolicy.Name,
+			principal: policyPrincipal,
+			resource:  map[string]any{"amount": float64(5000)},
+			arrange: func(prm *PolicyRepoMock) {
+				prm.On("List", mock.Anything).Return([]models.Policy{salesPolicy}, nil).Once()
+				urm.On("FindByID", mock.Anything, uint(1)).
+					Return(&models.User{ID: 1, Attributes: map[string]any{"department": "sales"}}, nil).Once()
+			},
+			assert: func(t *testing.T, decision *models.AuthzDecision, err error) {
+				require.NoError(t, err)
+				require.False(t, decision.Allowed)
+			},
+		},
+		"missing attribute": {
+			policy:    salesPolicy.Name,
+			principal: policyPrincipal,
+			resource:  map[string]any{"amount": float64(500)},
+			arrange: func(prm *PolicyRepoMock) {
+				prm.On("List", mock.Anything).Return([]models.Policy{salesPolicy}, nil).Once()
+				urm.On("FindByID", mock.Anything, uint(1)).Return(&models.User{ID: 1}, nil).Once()
+			},
+			assert: func(t *testing.T, decision *models.AuthzDecision, err error) {
+				require.NoError(t, err)
+				require.False(t, decision.Allowed)
+				require.NotEmpty(t, decision.Reason)
+			},
+		},
+		"service account": {
+			policy:    "machines",
+			principal: models.PolicyPrincipal{Type: jwttoken.PrincipalServiceAccount, ID: 7, Scopes: []string{"reports:read"}},
+			arrange: func(prm *PolicyRepoMock) {
+				prm.On("List", mock.Anything).Return([]models.Policy{{
+					Name:       "machines",
+					Expression: `principal.type == "service_account" && "reports:read" in principal.scopes`,
+				}}, nil).Once()
+			},
+			assert: func(t *testing.T, decision *models.AuthzDecision, err error) {
+				require.NoError(t, err)
+				require.True(t, decision.Allowed)
+			},
+		},
+		"stored policy no longer compiles": {
+			policy:    "broken",
+			principal: policyPrincipal,
+			arrange: func(prm *PolicyRepoMock) {
+				prm.On("List", mock.Anything).Return([]models.Policy{{Name: "broken", Expression: "principal."}}, nil).Once()
+			},
+			assert: func(t *testing.T, decision *models.AuthzDecision, err error) {
+				require.ErrorIs(t, err, services.ErrPolicyNotFound)
+			},
+		},
+		"not found": {
+			policy:    "unknown",
+			principal: policyPrincipal,
+			arrange: func(prm *PolicyRepoMock) {
+				prm.On("List", mock.Anything).Return([]models.Policy{salesPolicy}, nil).Once()
+			},
+			assert: func(t *testing.T, decision *models.AuthzDecision, err error) {
+				require.ErrorIs(t, err, services.ErrPolicyNotFound)
+				require.Nil(t, decision)
+			},
+		},
+		"failed to load": {
+			policy:    salesPolicy.Name,
+			principal: policyPrincipal,
+			arrange: func(prm *PolicyRepoMock) {
+				prm.On("List", mock.Anything).Return([]models.Policy(nil), errors.New("failed")).Once()
+			},
+			assert: func(t *testing.T, decision *models.AuthzDecision, err error) {
+				require.Error(t, err)
+				require.Nil(t, decision)
+			},
+		},
+		"user not found": {
+			policy:    salesPolicy.Name,
+			principal: policyPrincipal,
+			arrange: func(prm *PolicyRepoMock) {
+				prm.On("List", mock.Anything).Return([]models.Policy{salesPolicy}, nil).Once()
+				urm.On("FindByID", mock.Anything, uint(1)).Return((*models.User)(nil), sql.ErrNoRows).Once()
+			},
+			assert: func(t *testing.T, decision *models.AuthzDecision, err error) {
+				require.ErrorIs(t, err, sql.ErrNoRows)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			prm := new(PolicyRepoMock)
+			v.arrange(prm)
+			policyService := services.NewPolicyService(prm, urm, aud, services.NewPolicySet())
+
+			decision, err := policyService.Evaluate(context.Background(), v.policy, v.principal, v.resource)
+
+			v.assert(t, decision, err)
+			prm.AssertExpectations(t)
+		})
+	}
+}
+
+func TestPolicySetIsShared(t *testing.T) {
+	prm := new(PolicyRepoMock)
+	prm.On("List", mock.Anything).Return([]models.Policy{}, nil).Once()
+	prm.On("Upsert", mock.Anything, mock.Anything).Return(nil).Once()
+	prm.On("Delete", mock.Anything, "admins").Return(nil).Once()
+	set := services.NewPolicySet()
+	admin := services.NewPolicyService(prm, urm, aud, set)
+	evaluator := services.NewPolicyService(prm, urm, aud, set)
+	principal := models.PolicyPrincipal{Type: jwttoken.PrincipalServiceAccount, Roles: []string{models.RoleAdmin}}
+
+	// Definitions and deletions through one service take effect on the others sharing the set.
+	_, err := evaluator.Evaluate(context.Background(), "admins", principal, nil)
+	require.ErrorIs(t, err, services.ErrPolicyNotFound)
+
+	_, err = admin.Define(context.Background(), "admins", models.PolicyPayload{Expression: fmt.Sprintf("%q in principal.roles", models.RoleAdmin)})
+	require.NoError(t, err)
+	decision, err := evaluator.Evaluate(context.Background(), "admins", principal, nil)
+	require.NoError(t, err)
+	require.True(t, decision.Allowed)
+
+	require.NoError(t, admin.Delete(context.Background(), "admins"))
+	_, err = evaluator.Evaluate(context.Background(), "admins", principal, nil)
+	require.ErrorIs(t, err, services.ErrPolicyNotFound)
+	prm.AssertExpectations(t)
+}
+
+func TestPolicyReloadKeepsConcurrentDefinitions(t *testing.T) {
+	prm := new(PolicyRepoMock)
+	policyService := services.NewPolicyService(prm, urm, aud, services.NewPolicySet())
+	admins := models.Policy{Name: "admins", Expression: fmt.Sprintf("%q in principal.roles", models.RoleAdmin)}
+	principal := models.PolicyPrincipal{Type: jwttoken.PrincipalServiceAccount, Roles: []string{models.RoleAdmin}}
+
+	// The policy is defined while the reload lists the policies, too late to be listed.
+	prm.On("Upsert", mock.Anything, mock.Anything).Return(nil).Once()
+	prm.On("List", mock.Anything).Run(func(mock.Arguments) {
+		_, err := policyService.Define(context.Background(), admins.Name, models.PolicyPayload{Expression: admins.Expression})
+		require.NoError(t, err)
+	}).Return([]models.Policy{}, nil).Once()
+	prm.On("List", mock.Anything).Return([]models.Policy{admins}, nil).Once()
+
+	require.NoError(t, policyService.Reload(context.Background()))
+	decision, err := policyService.Evaluate(context.Background(), admins.Name, principal, nil)
+	require.NoError(t, err)
+	require.True(t, decision.Allowed)
+	prm.AssertExpectations(t)
+}
+
+func TestPolicyRunWithoutInterval(t *testing.T) {
+	policyService := services.NewPolicyService(new(PolicyRepoMock), urm, aud, services.NewPolicySet())
+
+	// A missing interval must not crash the service at startup.
+	require.NotPanics(t, func() {
+		policyService.Run(context.Background(), 0)
+	})
+}
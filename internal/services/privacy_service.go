@@ -0,0 +1,126 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/ryanpujo/melius/internal/repositories"
+	"github.com/ryanpujo/melius/internal/requestinfo"
+)
+
+// DataSource is a store of personal data that takes part in data subject requests.
+// Features keeping data about users register a source with the PrivacyService so
+// exports and erasures stay complete as the schema grows.
+type DataSource interface {
+	// Name is the section of the export holding the data of this source.
+	Name() string
+	// Export returns the data held about the user, it must be JSON serializable.
+	Export(ctx context.Context, id uint) (any, error)
+	// Erase removes or anonymizes the personal data held about the user. Records other
+	// tables rely on, such as audit entries, must be kept and only stripped of personal fields.
+	Erase(ctx context.Context, id uint) error
+}
+
+// PrivacyInterface answers data subject requests: exporting and erasing personal data.
+type PrivacyInterface interface {
+	Export(ctx context.Context, id uint) (*models.DataExport, error)
+	EraseAccount(ctx context.Context, id uint, payload models.ErasePayload) error
+	Erase(ctx context.Context, id uint) error
+}
+
+type PrivacyService struct {
+	userRepo    repositories.UserInterface
+	privacyRepo repositories.PrivacyInterface
+	auditor     Auditor
+	sources     []DataSource
+}
+
+// NewPrivacyService creates a new instance of PrivacyService. The account itself, its
+// identifier history and pending email change are always exported, sources add the rest.
+func NewPrivacyService(
+	userRepo repositories.UserInterface,
+	privacyRepo repositories.PrivacyInterface,
+	auditor Auditor,
+	sources ...DataSource,
+) *PrivacyService {
+	return &PrivacyService{
+		userRepo:    userRepo,
+		privacyRepo: privacyRepo,
+		auditor:     auditor,
+		sources:     sources,
+	}
+}
+
+// Export collects everything stored about the user identified by id.
+func (ps *PrivacyService) Export(ctx context.Context, id uint) (*models.DataExport, error) {
+	account, err := ps.privacyRepo.Account(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export data: %w", err)
+	}
+
+	history, err := ps.userRepo.History(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export data: %w", err)
+	}
+
+	emailChange, err := ps.privacyRepo.PendingEmailChange(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export data: %w", err)
+	}
+
+	export := &models.DataExport{
+		UserID:      id,
+		GeneratedAt: time.Now().UTC(),
+		Sections: map[string]any{
+			"account":            account,
+			"identifier_history": history,
+			"email_change":       emailChange,
+		},
+	}
+
+	for _, source := range ps.sources {
+		data, err := source.Export(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to export %s: %w", source.Name(), err)
+		}
+		export.Sections[source.Name()] = data
+	}
+	return export, nil
+}
+
+// EraseAccount erases the account of the user after checking their password.
+func (ps *PrivacyService) EraseAccount(ctx context.Context, id uint, payload models.ErasePayload) error {
+	user, err := ps.userRepo.FindByID(ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed to find user: %w", err)
+	}
+
+	if err := CompareHashAndPassword(user.Credential.Password, payload.Password); err != nil {
+		return fmt.Errorf("password is incorrect: %w", err)
+	}
+	return ps.Erase(ctx, id)
+}
+
+// Erase anonymizes the personal data of the user identified by id across every source
+// and then the account itself. The user row is kept so records referencing the user ID,
+// such as audit entries, stay intact. The account can no longer be used or restored.
+func (ps *PrivacyService) Erase(ctx context.Context, id uint) (err error) {
+	defer func() {
+		// The client details of the request may belong to the erased user, keep them out of the entry.
+		anonymous := requestinfo.NewContext(ctx, requestinfo.Info{RequestID: requestinfo.FromContext(ctx).RequestID})
+		audit(anonymous, ps.auditor, models.AuditAccountErase, id, err, nil)
+	}()
+
+	for _, source := range ps.sources {
+		if err := source.Erase(ctx, id); err != nil {
+			return fmt.Errorf("failed to erase %s: %w", source.Name(), err)
+		}
+	}
+
+	if err := ps.userRepo.Anonymize(ctx, id); err != nil {
+		return fmt.Errorf("failed to erase account: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/ryanpujo/melius/internal/services"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type PrivacyRepoMock struct {
+	mock.Mock
+}
+
+func (prm *PrivacyRepoMock) Account(ctx context.Context, id uint) (*models.AccountRecord, error) {
+	args := prm.Called(ctx, id)
+	return args.Get(0).(*models.AccountRecord), args.Error(1)
+}
+
+func (prm *PrivacyRepoMock) PendingEmailChange(ctx context.Context, id uint) (*models.PendingEmailChange, error) {
+	args := prm.Called(ctx, id)
+	return args.Get(0).(*models.PendingEmailChange), args.Error(1)
+}
+
+type DataSourceMock struct {
+	mock.Mock
+}
+
+func (dsm *DataSourceMock) Name() string {
+	return "sessions"
+}
+
+func (dsm *DataSourceMock) Export(ctx context.Context, id uint) (any, error) {
+	args := dsm.Called(ctx, id)
+	return args.Get(0), args.Error(1)
+}
+
+func (dsm *DataSourceMock) Erase(ctx context.Context, id uint) error {
+	args := dsm.Called(ctx, id)
+	return args.Error(0)
+}
+
+func TestExport(t *testing.T) {
+	prm := new(PrivacyRepoMock)
+	dsm := new(DataSourceMock)
+	privacyService := services.NewPrivacyService(urm, prm, aud, dsm)
+
+	account := &models.AccountRecord{ID: 1, Username: "ryanpujo", Email: "ryanpujo@gmail.com"}
+	history := []models.IdentifierChange{{Kind: models.IdentifierUsername, OldValue: "ryan", NewValue: "ryanpujo"}}
+
+	tableTest := map[string]struct {
+		arrange func()
+		assert  func(t *testing.T, actual *models.DataExport, err error)
+	}{
+		"success": {
+			arrange: func() {
+				prm.On("Account", mock.Anything, uint(1)).Return(account, nil).Once()
+				urm.On("History", mock.Anything, uint(1)).Return(history, nil).Once()
+				prm.On("PendingEmailChange", mock.Anything, uint(1)).Return((*models.PendingEmailChange)(nil), nil).Once()
+				dsm.On("Export", mock.Anything, uint(1)).Return([]string{"session"}, nil).Once()
+			},
+			assert: func(t *testing.T, actual *models.DataExport, err error) {
+				require.NoError(t, err)
+				require.Equal(t, uint(1), actual.UserID)
+				require.Equal(t, account, actual.Sections["account"])
+				require.Equal(t, history, actual.Sections["identifier_history"])
+				require.Equal(t, []string{"session"}, actual.Sections["sessions"])
+			},
+		},
+		"source failed": {
+			arrange: func() {
+				prm.On("Account", mock.Anything, uint(1)).Return(account, nil).Once()
+				urm.On("History", mock.Anything, uint(1)).Return(history, nil).Once()
+				prm.On("PendingEmailChange", mock.Anything, uint(1)).Return((*models.PendingEmailChange)(nil), nil).Once()
+				dsm.On("Export", mock.Anything, uint(1)).Return(nil, errors.New("failed")).Once()
+			},
+			assert: func(t *testing.T, actual *models.DataExport, err error) {
+				require.Error(t, err)
+				require.Nil(t, actual)
+			},
+		},
+		"not found": {
+			arrange: func() {
+				prm.On("Account", mock.Anything, uint(1)).Return((*models.AccountRecord)(nil), errors.New("not found")).Once()
+			},
+			assert: func(t *testing.T, actual *models.DataExport, err error) {
+				require.Error(t, err)
+				require.Nil(t, actual)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			actual, err := privacyService.Export(context.Background(), 1)
+
+			v.assert(t, actual, err)
+		})
+	}
+}
+
+func TestErase(t *testing.T) {
+	dsm := new(DataSourceMock)
+	privacyService := services.NewPrivacyService(urm, new(PrivacyRepoMock), aud, dsm)
+
+	tableTest := map[string]struct {
+		arrange  func()
+		act      func() error
+		assert   func(t *testing.T, err error)
+		teardown func()
+	}{
+		"admin": {
+			arrange: func() {
+				dsm.On("Erase", mock.Anything, uint(1)).Return(nil).Once()
+				urm.On("Anonymize", mock.Anything, uint(1)).Return(nil).Once()
+			},
+			act: func() error {
+				return privacyService.Erase(context.Background(), 1)
+			},
+			assert: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+			teardown: func() {},
+		},
+		"source failed": {
+			arrange: func() {
+				dsm.On("Erase", mock.Anything, uint(1)).Return(errors.New("failed")).Once()
+			},
+			act: func() error {
+				return privacyService.Erase(context.Background(), 1)
+			},
+			assert: func(t *testing.T, err error) {
+				require.Error(t, err)
+			},
+			teardown: func() {},
+		},
+		"own account": {
+			arrange: func() {
+				urm.On("FindByID", mock.Anything, uint(1)).Return(&user, nil).Once()
+				services.CompareHashAndPassword = func(hash, plain string) error {
+					return nil
+				}
+				dsm.On("Erase", mock.Anything, uint(1)).Return(nil).Once()
+				urm.On("Anonymize", mock.Anything, uint(1)).Return(nil).Once()
+			},
+			act: func() error {
+				return privacyService.EraseAccount(context.Background(), 1, models.ErasePayload{Password: "okeoke"})
+			},
+			assert: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+			teardown: func() {
+				services.CompareHashAndPassword = compareFunc
+			},
+		},
+		"own account wrong password": {
+			arrange: func() {
+				urm.On("FindByID", mock.Anything, uint(1)).Return(&user, nil).Once()
+				services.CompareHashAndPassword = func(hash, plain string) error {
+					return errors.New("wrong password")
+				}
+			},
+			act: func() error {
+				return privacyService.EraseAccount(context.Background(), 1, models.ErasePayload{Password: "wrong"})
+			},
+			assert: func(t *testing.T, err error) {
+				require.Error(t, err)
+			},
+			teardown: func() {
+				services.CompareHashAndPassword = compareFunc
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			err := v.act()
+
+			v.assert(t, err)
+
+			v.teardown()
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ryanpujo/melius/config"
+	"github.com/ryanpujo/melius/internal/repositories"
+)
+
+// Purge modes.
+const (
+	PurgeDelete    = "delete"
+	PurgeAnonymize = "anonymize"
+)
+
+// PurgeService permanently removes closed accounts once their retention window has passed.
+type PurgeService struct {
+	userRepo repositories.UserInterface
+}
+
+// NewPurgeService creates a new instance of PurgeService.
+func NewPurgeService(userRepo repositories.UserInterface) *PurgeService {
+	return &PurgeService{
+		userRepo: userRepo,
+	}
+}
+
+// Purge hard-deletes or anonymizes, depending on the configured mode, every account
+// closed longer than the retention window ago. It returns the number of purged accounts.
+func (ps *PurgeService) Purge(ctx context.Context) (int, error) {
+	conf := config.Config()
+
+	ids, err := ps.userRepo.ListPurgeable(ctx, time.Now().Add(-conf.AccountRetention))
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge accounts: %w", err)
+	}
+
+	purged := 0
+	for _, id := range ids {
+		if conf.AccountPurgeMode == PurgeDelete {
+			err = ps.userRepo.Delete(ctx, id)
+		} else {
+			err = ps.userRepo.Anonymize(ctx, id)
+		}
+		if err != nil {
+			return purged, fmt.Errorf("failed to purge account %d: %w", id, err)
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// Run purges accounts every interval until ctx is done. Accounts are not purged when
+// interval is not positive.
+func (ps *PurgeService) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		log.Printf("account purge disabled: interval %v is not positive", interval)
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := ps.Purge(ctx)
+			if err != nil {
+				log.Printf("account purge failed: %v", err)
+			}
+			if n > 0 {
+				log.Printf("purged %d closed accounts", n)
+			}
+		}
+	}
+}
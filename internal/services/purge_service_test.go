@@ -0,0 +1,80 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ryanpujo/melius/config"
+	"github.com/ryanpujo/melius/internal/services"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPurge(t *testing.T) {
+	conf := config.Config()
+	mode := conf.AccountPurgeMode
+	defer func() { conf.AccountPurgeMode = mode }()
+
+	purgeService := services.NewPurgeService(urm)
+
+	tableTest := map[string]struct {
+		arrange func()
+		assert  func(t *testing.T, n int, err error)
+	}{
+		"anonymize": {
+			arrange: func() {
+				conf.AccountPurgeMode = services.PurgeAnonymize
+				urm.On("ListPurgeable", mock.Anything, mock.AnythingOfType("time.Time")).Return([]uint{1, 2}, nil).Once()
+				urm.On("Anonymize", mock.Anything, uint(1)).Return(nil).Once()
+				urm.On("Anonymize", mock.Anything, uint(2)).Return(nil).Once()
+			},
+			assert: func(t *testing.T, n int, err error) {
+				require.NoError(t, err)
+				require.Equal(t, 2, n)
+			},
+		},
+		"delete": {
+			arrange: func() {
+				conf.AccountPurgeMode = services.PurgeDelete
+				urm.On("ListPurgeable", mock.Anything, mock.AnythingOfType("time.Time")).Return([]uint{1}, nil).Once()
+				urm.On("Delete", mock.Anything, uint(1)).Return(nil).Once()
+			},
+			assert: func(t *testing.T, n int, err error) {
+				require.NoError(t, err)
+				require.Equal(t, 1, n)
+			},
+		},
+		"failed": {
+			arrange: func() {
+				conf.AccountPurgeMode = services.PurgeDelete
+				urm.On("ListPurgeable", mock.Anything, mock.AnythingOfType("time.Time")).Return([]uint{1, 2}, nil).Once()
+				urm.On("Delete", mock.Anything, uint(1)).Return(nil).Once()
+				urm.On("Delete", mock.Anything, uint(2)).Return(errors.New("failed")).Once()
+			},
+			assert: func(t *testing.T, n int, err error) {
+				require.Error(t, err)
+				require.Equal(t, 1, n)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			n, err := purgeService.Purge(context.Background())
+
+			v.assert(t, n, err)
+		})
+	}
+}
+
+func TestPurgeRunWithoutInterval(t *testing.T) {
+	purgeService := services.NewPurgeService(urm)
+
+	// A missing interval must not crash the service at startup.
+	require.NotPanics(t, func() {
+		purgeService.Run(context.Background(), 0)
+	})
+}
@@ -0,0 +1,551 @@
+package services
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/ryanpujo/melius/accesstoken"
+	"github.com/ryanpujo/melius/config"
+	"github.com/ryanpujo/melius/internal/jwttoken"
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/ryanpujo/melius/internal/repositories"
+	"github.com/ryanpujo/melius/internal/utilities"
+)
+
+const (
+	// serviceCredentialTouchInterval limits how often the last use of a credential is written.
+	serviceCredentialTouchInterval = time.Minute
+
+	// clientAssertionMaxAge is the longest lifetime accepted for a client assertion.
+	clientAssertionMaxAge = 5 * time.Minute
+
+	// minRSAKeyBits is the smallest RSA public key accepted as a credential.
+	minRSAKeyBits = accesstoken.MinRSAKeyBits
+)
+
+// clientAssertionMethods are the signing algorithms accepted for client assertions.
+var clientAssertionMethods = []string{
+	"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA",
+}
+
+var (
+	ErrServiceAccountDisabled = errors.New("service account disabled")
+	ErrInvalidPublicKey       = errors.New("invalid public key")
+)
+
+// ServiceAccountInterface manages service accounts and issues their access tokens.
+type ServiceAccountInterface interface {
+	Create(ctx context.Context, payload models.ServiceAccountPayload) (*models.ServiceAccount, error)
+	List(ctx context.Context) ([]models.ServiceAccount, error)
+	Get(ctx context.Context, id uint) (*models.ServiceAccount, error)
+	Update(ctx context.Context, id uint, payload models.UpdateServiceAccountPayload) (*models.ServiceAccount, error)
+	Delete(ctx context.Context, id uint) error
+	AssignRole(ctx context.Context, id uint, role string) error
+	RevokeRole(ctx context.Context, id uint, role string) error
+	CreateCredential(ctx context.Context, id uint, payload models.ServiceAccountCredentialPayload) (*models.CreatedServiceAccountCredential, error)
+	ListCredentials(ctx context.Context, id uint) ([]models.ServiceAccountCredential, error)
+	DeleteCredential(ctx context.Context, id uint, credentialID string) error
+	Token(ctx context.Context, request models.TokenRequest) (*models.TokenResponse, error)
+	Exchange(ctx context.Context, request models.TokenRequest) (*models.TokenResponse, error)
+	Check(ctx context.Context, id uint) error
+}
+
+// ServiceAccountService implements the ServiceAccountInterface.
+type ServiceAccountService struct {
+	serviceAccountRepo repositories.ServiceAccountInterface
+	sessionRepo        repositories.SessionInterface
+	auditor            Auditor
+	replay             jwttoken.ReplayCache
+}
+
+// NewServiceAccountService creates a new instance of ServiceAccountService. Client
+// assertions are remembered in replay so each is used only once.
+func NewServiceAccountService(
+	serviceAccountRepo repositories.ServiceAccountInterface,
+	sessionRepo repositories.SessionInterface,
+	auditor Auditor,
+	replay jwttoken.ReplayCache,
+) *ServiceAccountService {
+	return &ServiceAccountService{
+		serviceAccountRepo: serviceAccountRepo,
+		sessionRepo:        sessionRepo,
+		auditor:            auditor,
+		replay:             replay,
+	}
+}
+
+// Create creates a service account with the given roles.
+func (ss *ServiceAccountService) Create(ctx context.Context, payload models.ServiceAccountPayload) (_ *models.ServiceAccount, err error) {
+	var id uint
+	defer func() {
+		audit(ctx, ss.auditor, models.AuditServiceAccountCreate, 0, err,
+			map[string]any{"service_account_id": id, "name": payload.Name, "roles": payload.Roles})
+	}()
+
+	id, err = ss.serviceAccountRepo.Create(ctx, payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create service account: %w", err)
+	}
+	return ss.Get(ctx, id)
+}
+
+// List returns every service account.
+func (ss *ServiceAccountService) List(ctx context.Context) ([]models.ServiceAccount, error) {
+	accounts, err := ss.serviceAccountRepo.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list service accounts: %w", err)
+	}
+	return accounts, nil
+}
+
+// Get returns the service account identified by id.
+func (ss *ServiceAccountService) Get(ctx context.Context, id uint) (*models.ServiceAccount, error) {
+	account, err := ss.serviceAccountRepo.FindByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find service account: %w", err)
+	}
+	return account, nil
+}
+
+// Update changes the service account identified by id. Disabling it stops its
+// credentials and the tokens already issued to it from working.
+func (ss *ServiceAccountService) Update(ctx context.Context, id uint, payload models.UpdateServiceAccountPayload) (_ *models.ServiceAccount, err error) {
+	defer func() {
+		details := map[string]any{"service_account_id": id}
+		if payload.Disabled != nil {
+			details["disabled"] = *payload.Disabled
+		}
+		if payload.RequireDPoP != nil {
+			details["require_dpop"] = *payload.RequireDPoP
+		}
+		audit(ctx, ss.auditor, models.AuditServiceAccountUpdate, 0, err, details)
+	}()
+
+	if err := ss.serviceAccountRepo.Update(ctx, id, payload); err != nil {
+		return nil, fmt.Errorf("failed to update service account: %w", err)
+	}
+	return ss.Get(ctx, id)
+}
+
+// Delete removes the service account identified by id together with its credentials.
+func (ss *ServiceAccountService) Delete(ctx context.Context, id uint) error {
+	err := ss.serviceAccountRepo.Delete(ctx, id)
+	audit(ctx, ss.auditor, models.AuditServiceAccountDelete, 0, err, map[string]any{"service_account_id": id})
+	if err != nil {
+		return fmt.Errorf("failed to delete service account: %w", err)
+	}
+	return nil
+}
+
+// AssignRole grants role to the service account identified by id.
+func (ss *ServiceAccountService) AssignRole(ctx context.Context, id uint, role string) (err error) {
+	defer func() {
+		audit(ctx, ss.auditor, models.AuditServiceAccountRoleAssign, 0, err,
+			map[string]any{"service_account_id": id, "role": role})
+	}()
+
+	if _, err := ss.Get(ctx, id); err != nil {
+		return err
+	}
+	if err := ss.serviceAccountRepo.AddRole(ctx, id, role); err != nil {
+		return fmt.Errorf("failed to assign role: %w", err)
+	}
+	return nil
+}
+
+// RevokeRole revokes role from the service account identified by id.
+func (ss *ServiceAccountService) RevokeRole(ctx context.Context, id uint, role string) (err error) {
+	defer func() {
+		audit(ctx, ss.auditor, models.AuditServiceAccountRoleRevoke, 0, err,
+			map[string]any{"service_account_id": id, "role": role})
+	}()
+
+	if err := ss.serviceAccountRepo.RemoveRole(ctx, id, role); err != nil {
+		return fmt.Errorf("failed to revoke role: %w", err)
+	}
+	return nil
+}
+
+// CreateCredential adds a credential to the service account identified by id. The secret
+// of a secret credential is only returned here, only its hash is stored.
+func (ss *ServiceAccountService) CreateCredential(
+	ctx context.Context, id uint, payload models.ServiceAccountCredentialPayload,
+) (_ *models.CreatedServiceAccountCredential, err error) {
+	var credentialID string
+	defer func() {
+		audit(ctx, ss.auditor, models.AuditServiceAccountCredentialCreate, 0, err,
+			map[string]any{"service_account_id": id, "credential_id": credentialID, "type": payload.Type})
+	}()
+
+	if payload.ExpiresAt != nil && !payload.ExpiresAt.After(time.Now()) {
+		return nil, ErrInvalidExpiry
+	}
+	if _, err := ss.Get(ctx, id); err != nil {
+		return nil, err
+	}
+
+	credentialID, err = utilities.RandomToken(8)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate credential: %w", err)
+	}
+	created := &models.CreatedServiceAccountCredential{
+		ServiceAccountCredential: models.ServiceAccountCredential{
+			ID:               credentialID,
+			ServiceAccountID: id,
+			Type:             payload.Type,
+			Name:             payload.Name,
+			CreatedAt:        time.Now(),
+			ExpiresAt:        payload.ExpiresAt,
+		},
+	}
+
+	switch payload.Type {
+	case models.ServiceCredentialSecret:
+		secret, err := utilities.RandomToken(32)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate credential: %w", err)
+		}
+		// Like API keys, the secret embeds the credential id after the prefix.
+		created.Secret = models.ServiceAccountSecretPrefix + credentialID + "_" + secret
+		created.SecretHash = utilities.HashToken(created.Secret)
+	case models.ServiceCredentialPublicKey:
+		if _, err := parsePublicKey(payload.PublicKey); err != nil {
+			return nil, err
+		}
+		created.PublicKey = payload.PublicKey
+	}
+
+	if err := ss.serviceAccountRepo.CreateCredential(ctx, created.ServiceAccountCredential); err != nil {
+		return nil, fmt.Errorf("failed to create credential: %w", err)
+	}
+	return created, nil
+}
+
+// ListCredentials returns the credentials of the service account identified by id.
+func (ss *ServiceAccountService) ListCredentials(ctx context.Context, id uint) ([]models.ServiceAccountCredential, error) {
+	credentials, err := ss.serviceAccountRepo.ListCredentials(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list credentials: %w", err)
+	}
+	return credentials, nil
+}
+
+// DeleteCredential revokes a credential of the service account identified by id.
+// Tokens already issued with it stay valid until they expire.
+func (ss *ServiceAccountService) DeleteCredential(ctx context.Context, id uint, credentialID string) error {
+	err := ss.serviceAccountRepo.DeleteCredential(ctx, id, credentialID)
+	audit(ctx, ss.auditor, models.AuditServiceAccountCredentialDelete, 0, err,
+		map[string]any{"service_account_id": id, "credential_id": credentialID})
+	if err != nil {
+		return fmt.Errorf("failed to delete credential: %w", err)
+	}
+	return nil
+}
+
+// Token authenticates a service account with the client credentials grant and issues
+// its access token. Authentication failures are returned as *models.OAuthError.
+func (ss *ServiceAccountService) Token(ctx context.Context, request models.TokenRequest) (_ *models.TokenResponse, err error) {
+	var (
+		account    *models.ServiceAccount
+		credential *models.ServiceAccountCredential
+	)
+	defer func() {
+		details := map[string]any{"client_id": request.ClientID}
+		if credential != nil {
+			details["credential_id"] = credential.ID
+		}
+		audit(ctx, ss.auditor, models.AuditServiceAccountToken, 0, err, details)
+	}()
+
+	account, credential, err = ss.authenticate(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := jwttoken.NewServiceAccountClaims(account.ID, account.Name)
+	claims.Roles = account.Roles
+	claims.ClientID = claims.Subject
+	claims.Bind(request.DPoPKey)
+	token, err := jwttoken.GenerateToken(claims)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	return &models.TokenResponse{
+		AccessToken: token,
+		TokenType:   claims.TokenType(),
+		ExpiresIn:   int(jwttoken.Lifetime(jwttoken.KindServiceAccount).Seconds()),
+	}, nil
+}
+
+// Exchange implements the token exchange grant of RFC 8693. The authenticated service
+// account trades the access token of a user for a token addressed to a downstream
+// audience, limited to at most the scopes and lifetime of the subject token and to
+// the lifetime of exchanged tokens. The service account becomes the actor of the new token,
+// acting for any actor of the subject token. Subject tokens bound to a key are refused,
+// the exchange carries no proof of their possession.
+func (ss *ServiceAccountService) Exchange(ctx context.Context, request models.TokenRequest) (_ *models.TokenResponse, err error) {
+	var userID uint
+	defer func() {
+		audit(ctx, ss.auditor, models.AuditTokenExchange, userID, err, map[string]any{
+			"client_id": request.ClientID,
+			"audience":  request.Audience,
+			"scope":     request.Scope,
+		})
+	}()
+
+	account, _, err := ss.authenticate(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	if request.SubjectTokenType != models.TokenTypeAccessToken {
+		return nil, &models.OAuthError{Code: models.OAuthInvalidRequest, Description: "unsupported subject token type"}
+	}
+	if request.RequestedTokenType != "" && request.RequestedTokenType != models.TokenTypeAccessToken {
+		return nil, &models.OAuthError{Code: models.OAuthInvalidRequest, Description: "unsupported requested token type"}
+	}
+	if request.Audience == "" || !slices.Contains(config.Config().TokenExchangeAudiences, request.Audience) {
+		return nil, &models.OAuthError{Code: models.OAuthInvalidTarget, Description: "unknown audience"}
+	}
+
+	subject, err := jwttoken.Parse(request.SubjectToken)
+	if err != nil {
+		return nil, &models.OAuthError{Code: models.OAuthInvalidGrant, Description: "invalid subject token"}
+	}
+	id, err := strconv.ParseUint(subject.Subject, 10, 64)
+	if err != nil || subject.PrincipalType != "" {
+		return nil, &models.OAuthError{Code: models.OAuthInvalidGrant, Description: "subject token must belong to a user"}
+	}
+	userID = uint(id)
+	if subject.Confirmation != nil {
+		return nil, &models.OAuthError{Code: models.OAuthInvalidGrant, Description: "subject token is bound to a key"}
+	}
+	if subject.SessionID == "" {
+		return nil, &models.OAuthError{Code: models.OAuthInvalidGrant, Description: "session is no longer active"}
+	}
+	if _, err := ss.sessionRepo.FindActive(ctx, userID, subject.SessionID); err != nil {
+		return nil, &models.OAuthError{Code: models.OAuthInvalidGrant, Description: "session is no longer active"}
+	}
+
+	scopes := strings.Fields(request.Scope)
+	if granted := strings.Fields(subject.Scope); len(scopes) == 0 {
+		scopes = granted
+	} else if len(granted) > 0 && slices.ContainsFunc(scopes, func(scope string) bool { return !slices.Contains(granted, scope) }) {
+		return nil, &models.OAuthError{Code: models.OAuthInvalidScope, Description: "scope exceeds the subject token"}
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(jwttoken.Lifetime(jwttoken.KindExchange))
+	if subject.ExpiresAt != nil && subject.ExpiresAt.Before(expiresAt) {
+		expiresAt = subject.ExpiresAt.Time
+	}
+
+	// The new token is issued now under a new ID, and mapped again.
+	claims := *subject
+	claims.ID, claims.NotBefore, claims.Extra = "", nil, nil
+	claims.ClientID = strconv.FormatUint(uint64(account.ID), 10)
+	claims.Audience = jwt.ClaimStrings{request.Audience}
+	claims.Scope = strings.Join(scopes, " ")
+	claims.IssuedAt = jwt.NewNumericDate(now)
+	claims.ExpiresAt = jwt.NewNumericDate(expiresAt)
+	claims.Actor = &jwttoken.Actor{
+		Subject:       strconv.FormatUint(uint64(account.ID), 10),
+		Username:      account.Name,
+		PrincipalType: jwttoken.PrincipalServiceAccount,
+		Actor:         subject.Actor,
+	}
+	// The new token belongs to the calling service, it is bound to its key if any.
+	claims.Bind(request.DPoPKey)
+	token, err := jwttoken.GenerateToken(claims)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	return &models.TokenResponse{
+		AccessToken:     token,
+		IssuedTokenType: models.TokenTypeAccessToken,
+		TokenType:       claims.TokenType(),
+		ExpiresIn:       int(time.Until(expiresAt).Seconds()),
+		Scope:           claims.Scope,
+	}, nil
+}
+
+// Check returns an error when the service account identified by id was deleted or disabled.
+func (ss *ServiceAccountService) Check(ctx context.Context, id uint) error {
+	account, err := ss.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if account.Disabled {
+		return ErrServiceAccountDisabled
+	}
+	return nil
+}
+
+// authenticate authenticates the client of a token request by its secret or its client
+// assertion, and records the use of its credential. Clients requiring DPoP must have sent
+// a proof. Failures are returned as *models.OAuthError.
+func (ss *ServiceAccountService) authenticate(
+	ctx context.Context, request models.TokenRequest,
+) (account *models.ServiceAccount, credential *models.ServiceAccountCredential, err error) {
+	if request.ClientAssertion != "" {
+		account, credential, err = ss.verifyAssertion(ctx, request)
+	} else {
+		account, credential, err = ss.verifySecret(ctx, request)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if credential.ExpiresAt != nil && !credential.ExpiresAt.After(time.Now()) {
+		return nil, credential, &models.OAuthError{Code: models.OAuthInvalidClient, Description: "credential expired"}
+	}
+	if account.Disabled {
+		return nil, credential, &models.OAuthError{Code: models.OAuthInvalidClient, Description: ErrServiceAccountDisabled.Error()}
+	}
+	if account.RequireDPoP && request.DPoPKey == "" {
+		return nil, credential, &models.OAuthError{Code: models.OAuthInvalidDPoPProof, Description: "DPoP proof required"}
+	}
+
+	if credential.LastUsedAt == nil || time.Since(*credential.LastUsedAt) > serviceCredentialTouchInterval {
+		if err := ss.serviceAccountRepo.TouchCredential(ctx, credential.ID); err != nil {
+			log.Printf("service accounts: %v", err)
+		}
+	}
+	return account, credential, nil
+}
+
+// verifySecret authenticates the client by its secret. The client id must be
+// the ID of the service account owning the secret.
+func (ss *ServiceAccountService) verifySecret(
+	ctx context.Context, request models.TokenRequest,
+) (*models.ServiceAccount, *models.ServiceAccountCredential, error) {
+	invalid := &models.OAuthError{Code: models.OAuthInvalidClient, Description: "invalid client credentials"}
+
+	if request.ClientID == "" || !strings.HasPrefix(request.ClientSecret, models.ServiceAccountSecretPrefix) {
+		return nil, nil, invalid
+	}
+
+	credential, err := ss.serviceAccountRepo.FindCredentialByHash(ctx, utilities.HashToken(request.ClientSecret))
+	if err != nil {
+		return nil, nil, invalid
+	}
+	if credential.Type != models.ServiceCredentialSecret ||
+		request.ClientID != strconv.FormatUint(uint64(credential.ServiceAccountID), 10) {
+		return nil, nil, invalid
+	}
+
+	account, err := ss.serviceAccountRepo.FindByID(ctx, credential.ServiceAccountID)
+	if err != nil {
+		return nil, nil, invalid
+	}
+	return account, credential, nil
+}
+
+// verifyAssertion authenticates the client by a JWT signed with the private key of one
+// of its public key credentials, as in RFC 7523. The kid header must be the credential
+// id, the issuer and subject the client id, and the audience the issuer or its token endpoint.
+// Each assertion must have a jti and is accepted only once.
+func (ss *ServiceAccountService) verifyAssertion(
+	ctx context.Context, request models.TokenRequest,
+) (*models.ServiceAccount, *models.ServiceAccountCredential, error) {
+	invalid := func(description string) error {
+		return &models.OAuthError{Code: models.OAuthInvalidClient, Description: description}
+	}
+
+	if request.ClientAssertionType != models.ClientAssertionJWTBearer {
+		return nil, nil, invalid("unsupported client assertion type")
+	}
+
+	var (
+		claims     jwt.RegisteredClaims
+		account    *models.ServiceAccount
+		credential *models.ServiceAccountCredential
+	)
+	parser := jwt.NewParser(jwt.WithValidMethods(clientAssertionMethods), jwt.WithExpirationRequired())
+	_, err := parser.ParseWithClaims(request.ClientAssertion, &claims, func(token *jwt.Token) (any, error) {
+		id, err := strconv.ParseUint(claims.Subject, 10, 64)
+		if err != nil || claims.Issuer != claims.Subject {
+			return nil, errors.New("issuer and subject must be the client id")
+		}
+		if request.ClientID != "" && request.ClientID != claims.Subject {
+			return nil, errors.New("subject does not match the client id")
+		}
+
+		account, err = ss.serviceAccountRepo.FindByID(ctx, uint(id))
+		if err != nil {
+			return nil, errors.New("unknown client")
+		}
+		credentials, err := ss.serviceAccountRepo.ListCredentials(ctx, account.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		kid, _ := token.Header["kid"].(string)
+		i := slices.IndexFunc(credentials, func(c models.ServiceAccountCredential) bool {
+			return c.ID == kid && c.Type == models.ServiceCredentialPublicKey
+		})
+		if i < 0 {
+			return nil, errors.New("unknown key")
+		}
+		credential = &credentials[i]
+		return parsePublicKey(credential.PublicKey)
+	})
+	if err != nil {
+		return nil, nil, invalid(err.Error())
+	}
+
+	if claims.ExpiresAt.After(time.Now().Add(clientAssertionMaxAge)) {
+		return nil, nil, invalid("assertion lifetime too long")
+	}
+	issuer := strings.TrimSuffix(config.Config().Issuer, "/")
+	if !slices.ContainsFunc(claims.Audience, func(aud string) bool {
+		return aud == issuer || aud == issuer+"/oauth/token"
+	}) {
+		return nil, nil, invalid("assertion not intended for this server")
+	}
+	if claims.ID == "" {
+		return nil, nil, invalid("assertion must have a jti")
+	}
+	if ss.replay.Seen("assertion/"+claims.Subject+"/"+claims.ID, claims.ExpiresAt.Time) {
+		return nil, nil, invalid("assertion already used")
+	}
+	return account, credential, nil
+}
+
+// parsePublicKey decodes a PEM encoded RSA, ECDSA or Ed25519 public key.
+func parsePublicKey(data string) (crypto.PublicKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, fmt.Errorf("%w: not PEM encoded", ErrInvalidPublicKey)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPublicKey, err)
+	}
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if k.N.BitLen() < minRSAKeyBits {
+			return nil, fmt.Errorf("%w: RSA keys must have at least %d bits", ErrInvalidPublicKey, minRSAKeyBits)
+		}
+	case *ecdsa.PublicKey, ed25519.PublicKey:
+	default:
+		return nil, fmt.Errorf("%w: unsupported key type %T", ErrInvalidPublicKey, key)
+	}
+	return key, nil
+}
@@ -0,0 +1,610 @@
+package services_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"database/sql"
+	"encoding/pem"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/ryanpujo/melius/config"
+	"github.com/ryanpujo/melius/internal/jwttoken"
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/ryanpujo/melius/internal/services"
+	"github.com/ryanpujo/melius/internal/utilities"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type ServiceAccountRepoMock struct {
+	mock.Mock
+}
+
+func (sam *ServiceAccountRepoMock) Create(ctx context.Context, payload models.ServiceAccountPayload) (uint, error) {
+	args := sam.Called(ctx, payload)
+	return uint(args.Int(0)), args.Error(1)
+}
+
+func (sam *ServiceAccountRepoMock) List(ctx context.Context) ([]models.ServiceAccount, error) {
+	args := sam.Called(ctx)
+	return args.Get(0).([]models.ServiceAccount), args.Error(1)
+}
+
+func (sam *ServiceAccountRepoMock) FindByID(ctx context.Context, id uint) (*models.ServiceAccount, error) {
+	args := sam.Called(ctx, id)
+	return args.Get(0).(*models.ServiceAccount), args.Error(1)
+}
+
+func (sam *ServiceAccountRepoMock) Update(ctx context.Context, id uint, payload models.UpdateServiceAccountPayload) error {
+	args := sam.Called(ctx, id, payload)
+	return args.Error(0)
+}
+
+func (sam *ServiceAccountRepoMock) Delete(ctx context.Context, id uint) error {
+	args := sam.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (sam *ServiceAccountRepoMock) AddRole(ctx context.Context, id uint, role string) error {
+	args := sam.Called(ctx, id, role)
+	return args.Error(0)
+}
+
+func (sam *ServiceAccountRepoMock) RemoveRole(ctx context.Context, id uint, role string) error {
+	args := sam.Called(ctx, id, role)
+	return args.Error(0)
+}
+
+func (sam *ServiceAccountRepoMock) CreateCredential(ctx context.Context, credential models.ServiceAccountCredential) error {
+	args := sam.Called(ctx, credential)
+	return args.Error(0)
+}
+
+func (sam *ServiceAccountRepoMock) ListCredentials(ctx context.Context, id uint) ([]models.ServiceAccountCredential, error) {
+	args := sam.Called(ctx, id)
+	return args.Get(0).([]models.ServiceAccountCredential), args.Error(1)
+}
+
+func (sam *ServiceAccountRepoMock) FindCredentialByHash(ctx context.Context, hash string) (*models.ServiceAccountCredential, error) {
+	args := sam.Called(ctx, hash)
+	return args.Get(0).(*models.ServiceAccountCredential), args.Error(1)
+}
+
+func (sam *ServiceAccountRepoMock) TouchCredential(ctx context.Context, credentialID string) error {
+	args := sam.Called(ctx, credentialID)
+	return args.Error(0)
+}
+
+func (sam *ServiceAccountRepoMock) DeleteCredential(ctx context.Context, id uint, credentialID string) error {
+	args := sam.Called(ctx, id, credentialID)
+	return args.Error(0)
+}
+
+var robot = models.ServiceAccount{ID: 7, Name: "ci", Roles: []string{"deployer"}}
+
+// publicKeyPEM generates an Ed25519 key pair and returns the PEM encoded public key.
+func publicKeyPEM(t *testing.T) (string, ed25519.PrivateKey) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(public)
+	require.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})), private
+}
+
+// assertion signs a client assertion of the service account robot.
+func assertion(t *testing.T, key ed25519.PrivateKey, kid string, audience string, ttl time.Duration) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.RegisteredClaims{
+		Issuer:    "7",
+		Subject:   "7",
+		Audience:  jwt.ClaimStrings{audience},
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+		ID:        "jti",
+	})
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	require.NoError(t, err)
+	return signed
+}
+
+func TestCreateServiceAccountCredential(t *testing.T) {
+	public, _ := publicKeyPEM(t)
+
+	tableTest := map[string]struct {
+		payload models.ServiceAccountCredentialPayload
+		arrange func(sam *ServiceAccountRepoMock)
+		assert  func(t *testing.T, credential *models.CreatedServiceAccountCredential, err error)
+	}{
+		"secret": {
+			payload: models.ServiceAccountCredentialPayload{Type: models.ServiceCredentialSecret, Name: "ci"},
+			arrange: func(sam *ServiceAccountRepoMock) {
+				sam.On("FindByID", mock.Anything, uint(7)).Return(&robot, nil).Once()
+				sam.On("CreateCredential", mock.Anything, mock.Anything).Return(nil).Once()
+			},
+			assert: func(t *testing.T, credential *models.CreatedServiceAccountCredential, err error) {
+				require.NoError(t, err)
+				require.True(t, strings.HasPrefix(credential.Secret, models.ServiceAccountSecretPrefix+credential.ID+"_"))
+				require.Equal(t, utilities.HashToken(credential.Secret), credential.SecretHash)
+				require.Equal(t, models.AuditServiceAccountCredentialCreate, aud.last().Action)
+			},
+		},
+		"public key": {
+			payload: models.ServiceAccountCredentialPayload{Type: models.ServiceCredentialPublicKey, Name: "ci", PublicKey: public},
+			arrange: func(sam *ServiceAccountRepoMock) {
+				sam.On("FindByID", mock.Anything, uint(7)).Return(&robot, nil).Once()
+				sam.On("CreateCredential", mock.Anything, mock.Anything).Return(nil).Once()
+			},
+			assert: func(t *testing.T, credential *models.CreatedServiceAccountCredential, err error) {
+				require.NoError(t, err)
+				require.Empty(t, credential.Secret)
+				require.Equal(t, public, credential.PublicKey)
+			},
+		},
+		"invalid public key": {
+			payload: models.ServiceAccountCredentialPayload{Type: models.ServiceCredentialPublicKey, Name: "ci", PublicKey: "key"},
+			arrange: func(sam *ServiceAccountRepoMock) {
+				sam.On("FindByID", mock.Anything, uint(7)).Return(&robot, nil).Once()
+			},
+			assert: func(t *testing.T, credential *models.CreatedServiceAccountCredential, err error) {
+				require.ErrorIs(t, err, services.ErrInvalidPublicKey)
+				require.Equal(t, models.AuditOutcomeFailure, aud.last().Outcome)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			sam := new(ServiceAccountRepoMock)
+			serviceAccountService := services.NewServiceAccountService(sam, new(SessionRepoMock), aud, jwttoken.NewReplayCache())
+			v.arrange(sam)
+
+			credential, err := serviceAccountService.CreateCredential(context.Background(), 7, v.payload)
+
+			v.assert(t, credential, err)
+			sam.AssertExpectations(t)
+		})
+	}
+}
+
+func TestServiceAccountToken(t *testing.T) {
+	const secret = models.ServiceAccountSecretPrefix + "abc_secret"
+	public, private := publicKeyPEM(t)
+	tokenEndpoint := config.Config().Issuer + "/oauth/token"
+	past := time.Now().Add(-time.Hour)
+	disabled := robot
+	disabled.Disabled = true
+	constrained := robot
+	constrained.RequireDPoP = true
+	secretCredential := &models.ServiceAccountCredential{ID: "abc", ServiceAccountID: 7, Type: models.ServiceCredentialSecret}
+	keyCredentials := []models.ServiceAccountCredential{
+		{ID: "key", ServiceAccountID: 7, Type: models.ServiceCredentialPublicKey, PublicKey: public},
+	}
+
+	tableTest := map[string]struct {
+		request models.TokenRequest
+		arrange func(sam *ServiceAccountRepoMock)
+		assert  func(t *testing.T, res *models.TokenResponse, err error)
+	}{
+		"secret": {
+			request: models.TokenRequest{ClientID: "7", ClientSecret: secret},
+			arrange: func(sam *ServiceAccountRepoMock) {
+				sam.On("FindCredentialByHash", mock.Anything, utilities.HashToken(secret)).Return(secretCredential, nil).Once()
+				sam.On("FindByID", mock.Anything, uint(7)).Return(&robot, nil).Once()
+				sam.On("TouchCredential", mock.Anything, "abc").Return(nil).Once()
+			},
+			assert: func(t *testing.T, res *models.TokenResponse, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "Bearer", res.TokenType)
+
+				var claims jwttoken.Claims
+				_, err = jwt.ParseWithClaims(res.AccessToken, &claims, func(*jwt.Token) (any, error) {
+					return []byte(config.Config().JWTKey), nil
+				})
+				require.NoError(t, err)
+				require.Equal(t, jwttoken.PrincipalServiceAccount, claims.PrincipalType)
+				require.Equal(t, "7", claims.Subject)
+				require.Equal(t, robot.Roles, claims.Roles)
+
+				event := aud.last()
+				require.Equal(t, models.AuditServiceAccountToken, event.Action)
+				require.Equal(t, "abc", event.Details["credential_id"])
+			},
+		},
+		"secret of another account": {
+			request: models.TokenRequest{ClientID: "8", ClientSecret: secret},
+			arrange: func(sam *ServiceAccountRepoMock) {
+				sam.On("FindCredentialByHash", mock.Anything, utilities.HashToken(secret)).Return(secretCredential, nil).Once()
+			},
+			assert: func(t *testing.T, res *models.TokenResponse, err error) {
+				var oauthErr *models.OAuthError
+				require.ErrorAs(t, err, &oauthErr)
+				require.Equal(t, models.OAuthInvalidClient, oauthErr.Code)
+				require.Equal(t, models.AuditOutcomeFailure, aud.last().Outcome)
+			},
+		},
+		"unknown secret": {
+			request: models.TokenRequest{ClientID: "7", ClientSecret: secret},
+			arrange: func(sam *ServiceAccountRepoMock) {
+				sam.On("FindCredentialByHash", mock.Anything, utilities.HashToken(secret)).
+					Return((*models.ServiceAccountCredential)(nil), sql.ErrNoRows).Once()
+			},
+			assert: func(t *testing.T, res *models.TokenResponse, err error) {
+				var oauthErr *models.OAuthError
+				require.ErrorAs(t, err, &oauthErr)
+			},
+		},
+		"expired secret": {
+			request: models.TokenRequest{ClientID: "7", ClientSecret: secret},
+			arrange: func(sam *ServiceAccountRepoMock) {
+				expired := *secretCredential
+				expired.ExpiresAt = &past
+				sam.On("FindCredentialByHash", mock.Anything, utilities.HashToken(secret)).Return(&expired, nil).Once()
+				sam.On("FindByID", mock.Anything, uint(7)).Return(&robot, nil).Once()
+			},
+			assert: func(t *testing.T, res *models.TokenResponse, err error) {
+				var oauthErr *models.OAuthError
+				require.ErrorAs(t, err, &oauthErr)
+				require.Equal(t, "credential expired", oauthErr.Description)
+			},
+		},
+		"disabled": {
+			request: models.TokenRequest{ClientID: "7", ClientSecret: secret},
+			arrange: func(sam *ServiceAccountRepoMock) {
+				sam.On("FindCredentialByHash", mock.Anything, utilities.HashToken(secret)).Return(secretCredential, nil).Once()
+				sam.On("FindByID", mock.Anything, uint(7)).Return(&disabled, nil).Once()
+			},
+			assert: func(t *testing.T, res *models.TokenResponse, err error) {
+				var oauthErr *models.OAuthError
+				require.ErrorAs(t, err, &oauthErr)
+				require.Equal(t, services.ErrServiceAccountDisabled.Error(), oauthErr.Description)
+			},
+		},
+		"DPoP bound": {
+			request: models.TokenRequest{ClientID: "7", ClientSecret: secret, DPoPKey: "thumbprint"},
+			arrange: func(sam *ServiceAccountRepoMock) {
+				sam.On("FindCredentialByHash", mock.Anything, utilities.HashToken(secret)).Return(secretCredential, nil).Once()
+				sam.On("FindByID", mock.Anything, uint(7)).Return(&constrained, nil).Once()
+				sam.On("TouchCredential", mock.Anything, "abc").Return(nil).Once()
+			},
+			assert: func(t *testing.T, res *models.TokenResponse, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "DPoP", res.TokenType)
+
+				claims, err := jwttoken.Parse(res.AccessToken)
+				require.NoError(t, err)
+				require.Equal(t, "thumbprint", claims.Confirmation.JKT)
+			},
+		},
+		"DPoP required": {
+			request: models.TokenRequest{ClientID: "7", ClientSecret: secret},
+			arrange: func(sam *ServiceAccountRepoMock) {
+				sam.On("FindCredentialByHash", mock.Anything, utilities.HashToken(secret)).Return(secretCredential, nil).Once()
+				sam.On("FindByID", mock.Anything, uint(7)).Return(&constrained, nil).Once()
+			},
+			assert: func(t *testing.T, res *models.TokenResponse, err error) {
+				var oauthErr *models.OAuthError
+				require.ErrorAs(t, err, &oauthErr)
+				require.Equal(t, models.OAuthInvalidDPoPProof, oauthErr.Code)
+			},
+		},
+		"assertion": {
+			request: models.TokenRequest{
+				ClientAssertionType: models.ClientAssertionJWTBearer,
+				ClientAssertion:     assertion(t, private, "key", tokenEndpoint, time.Minute),
+			},
+			arrange: func(sam *ServiceAccountRepoMock) {
+				sam.On("FindByID", mock.Anything, uint(7)).Return(&robot, nil).Once()
+				sam.On("ListCredentials", mock.Anything, uint(7)).Return(keyCredentials, nil).Once()
+				sam.On("TouchCredential", mock.Anything, "key").Return(nil).Once()
+			},
+			assert: func(t *testing.T, res *models.TokenResponse, err error) {
+				require.NoError(t, err)
+				require.NotEmpty(t, res.AccessToken)
+			},
+		},
+		"assertion for another server": {
+			request: models.TokenRequest{
+				ClientAssertionType: models.ClientAssertionJWTBearer,
+				ClientAssertion:     assertion(t, private, "key", "https://elsewhere.example", time.Minute),
+			},
+			arrange: func(sam *ServiceAccountRepoMock) {
+				sam.On("FindByID", mock.Anything, uint(7)).Return(&robot, nil).Once()
+				sam.On("ListCredentials", mock.Anything, uint(7)).Return(keyCredentials, nil).Once()
+			},
+			assert: func(t *testing.T, res *models.TokenResponse, err error) {
+				var oauthErr *models.OAuthError
+				require.ErrorAs(t, err, &oauthErr)
+				require.Equal(t, "assertion not intended for this server", oauthErr.Description)
+			},
+		},
+		"long-lived assertion": {
+			request: models.TokenRequest{
+				ClientAssertionType: models.ClientAssertionJWTBearer,
+				ClientAssertion:     assertion(t, private, "key", tokenEndpoint, time.Hour),
+			},
+			arrange: func(sam *ServiceAccountRepoMock) {
+				sam.On("FindByID", mock.Anything, uint(7)).Return(&robot, nil).Once()
+				sam.On("ListCredentials", mock.Anything, uint(7)).Return(keyCredentials, nil).Once()
+			},
+			assert: func(t *testing.T, res *models.TokenResponse, err error) {
+				var oauthErr *models.OAuthError
+				require.ErrorAs(t, err, &oauthErr)
+			},
+		},
+		"assertion signed by another key": {
+			request: models.TokenRequest{
+				ClientAssertionType: models.ClientAssertionJWTBearer,
+				ClientAssertion: func() string {
+					_, other := publicKeyPEM(t)
+					return assertion(t, other, "key", tokenEndpoint, time.Minute)
+				}(),
+			},
+			arrange: func(sam *ServiceAccountRepoMock) {
+				sam.On("FindByID", mock.Anything, uint(7)).Return(&robot, nil).Once()
+				sam.On("ListCredentials", mock.Anything, uint(7)).Return(keyCredentials, nil).Once()
+			},
+			assert: func(t *testing.T, res *models.TokenResponse, err error) {
+				var oauthErr *models.OAuthError
+				require.ErrorAs(t, err, &oauthErr)
+			},
+		},
+		"assertion with unknown key": {
+			request: models.TokenRequest{
+				ClientAssertionType: models.ClientAssertionJWTBearer,
+				ClientAssertion:     assertion(t, private, "other", tokenEndpoint, time.Minute),
+			},
+			arrange: func(sam *ServiceAccountRepoMock) {
+				sam.On("FindByID", mock.Anything, uint(7)).Return(&robot, nil).Once()
+				sam.On("ListCredentials", mock.Anything, uint(7)).Return(keyCredentials, nil).Once()
+			},
+			assert: func(t *testing.T, res *models.TokenResponse, err error) {
+				var oauthErr *models.OAuthError
+				require.ErrorAs(t, err, &oauthErr)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			sam := new(ServiceAccountRepoMock)
+			serviceAccountService := services.NewServiceAccountService(sam, new(SessionRepoMock), aud, jwttoken.NewReplayCache())
+			v.arrange(sam)
+
+			res, err := serviceAccountService.Token(context.Background(), v.request)
+
+			v.assert(t, res, err)
+			sam.AssertExpectations(t)
+		})
+	}
+}
+
+func TestServiceAccountAssertionReplay(t *testing.T) {
+	public, private := publicKeyPEM(t)
+	keyCredentials := []models.ServiceAccountCredential{
+		{ID: "key", ServiceAccountID: 7, Type: models.ServiceCredentialPublicKey, PublicKey: public},
+	}
+	request := models.TokenRequest{
+		ClientAssertionType: models.ClientAssertionJWTBearer,
+		ClientAssertion:     assertion(t, private, "key", config.Config().Issuer+"/oauth/token", time.Minute),
+	}
+	sam := new(ServiceAccountRepoMock)
+	sam.On("FindByID", mock.Anything, uint(7)).Return(&robot, nil).Twice()
+	sam.On("ListCredentials", mock.Anything, uint(7)).Return(keyCredentials, nil).Twice()
+	sam.On("TouchCredential", mock.Anything, "key").Return(nil).Once()
+	serviceAccountService := services.NewServiceAccountService(sam, new(SessionRepoMock), aud, jwttoken.NewReplayCache())
+
+	_, err := serviceAccountService.Token(context.Background(), request)
+	require.NoError(t, err)
+
+	// The same assertion cannot authenticate the client again.
+	_, err = serviceAccountService.Token(context.Background(), request)
+	var oauthErr *models.OAuthError
+	require.ErrorAs(t, err, &oauthErr)
+	require.Equal(t, models.OAuthInvalidClient, oauthErr.Code)
+	require.Equal(t, "assertion already used", oauthErr.Description)
+	sam.AssertExpectations(t)
+}
+
+func TestExchangeToken(t *testing.T) {
+	const secret = models.ServiceAccountSecretPrefix + "abc_secret"
+	secretCredential := &models.ServiceAccountCredential{ID: "abc", ServiceAccountID: 7, Type: models.ServiceCredentialSecret}
+	config.Config().TokenExchangeAudiences = []string{"orders"}
+
+	subjectToken := func(t *testing.T, edit func(claims *jwttoken.Claims)) string {
+		claims := jwttoken.NewClaims(1, "ryanpujo")
+		claims.SessionID = "sid"
+		claims.Roles = []string{models.RoleAdmin}
+		edit(&claims)
+		token, err := jwttoken.GenerateToken(claims)
+		require.NoError(t, err)
+		return token
+	}
+	request := func(subject string, edit func(request *models.TokenRequest)) models.TokenRequest {
+		request := models.TokenRequest{
+			GrantType:        models.GrantTokenExchange,
+			ClientID:         "7",
+			ClientSecret:     secret,
+			SubjectToken:     subject,
+			SubjectTokenType: models.TokenTypeAccessToken,
+			Audience:         "orders",
+			Scope:            "orders:read",
+		}
+		edit(&request)
+		return request
+	}
+	authenticated := func(sam *ServiceAccountRepoMock) {
+		sam.On("FindCredentialByHash", mock.Anything, utilities.HashToken(secret)).Return(secretCredential, nil).Once()
+		sam.On("FindByID", mock.Anything, uint(7)).Return(&robot, nil).Once()
+		sam.On("TouchCredential", mock.Anything, "abc").Return(nil).Once()
+	}
+	oauthError := func(code string) func(t *testing.T, res *models.TokenResponse, err error) {
+		return func(t *testing.T, res *models.TokenResponse, err error) {
+			var oauthErr *models.OAuthError
+			require.ErrorAs(t, err, &oauthErr)
+			require.Equal(t, code, oauthErr.Code)
+			require.Nil(t, res)
+			require.Equal(t, models.AuditOutcomeFailure, aud.last().Outcome)
+		}
+	}
+
+	tableTest := map[string]struct {
+		request models.TokenRequest
+		arrange func(sam *ServiceAccountRepoMock, srm *SessionRepoMock)
+		assert  func(t *testing.T, res *models.TokenResponse, err error)
+	}{
+		"success": {
+			request: request(subjectToken(t, func(claims *jwttoken.Claims) {
+				claims.Actor = &jwttoken.Actor{Subject: "2"}
+			}), func(*models.TokenRequest) {}),
+			arrange: func(sam *ServiceAccountRepoMock, srm *SessionRepoMock) {
+				authenticated(sam)
+				srm.On("FindActive", mock.Anything, uint(1), "sid").Return(&models.Session{ID: "sid", UserID: 1}, nil).Once()
+			},
+			assert: func(t *testing.T, res *models.TokenResponse, err error) {
+				require.NoError(t, err)
+				require.Equal(t, models.TokenTypeAccessToken, res.IssuedTokenType)
+				require.Equal(t, "orders:read", res.Scope)
+				require.LessOrEqual(t, res.ExpiresIn, int(jwttoken.Lifetime(jwttoken.KindExchange).Seconds()))
+
+				claims, err := jwttoken.Parse(res.AccessToken)
+				require.NoError(t, err)
+				require.Equal(t, "1", claims.Subject)
+				require.Equal(t, jwt.ClaimStrings{"orders"}, claims.Audience)
+				require.Equal(t, "7", claims.ClientID)
+				require.Equal(t, "sid", claims.SessionID)
+				require.Equal(t, &jwttoken.Actor{
+					Subject:       "7",
+					Username:      "ci",
+					PrincipalType: jwttoken.PrincipalServiceAccount,
+					Actor:         &jwttoken.Actor{Subject: "2"},
+				}, claims.Actor)
+
+				event := aud.last()
+				require.Equal(t, models.AuditTokenExchange, event.Action)
+				require.Equal(t, uint(1), *event.SubjectID)
+				require.Equal(t, "orders", event.Details["audience"])
+			},
+		},
+		"shorter lived subject token": {
+			request: request(subjectToken(t, func(claims *jwttoken.Claims) {
+				claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(time.Minute))
+			}), func(*models.TokenRequest) {}),
+			arrange: func(sam *ServiceAccountRepoMock, srm *SessionRepoMock) {
+				authenticated(sam)
+				srm.On("FindActive", mock.Anything, uint(1), "sid").Return(&models.Session{ID: "sid", UserID: 1}, nil).Once()
+			},
+			assert: func(t *testing.T, res *models.TokenResponse, err error) {
+				require.NoError(t, err)
+				require.LessOrEqual(t, res.ExpiresIn, 60)
+			},
+		},
+		"scope exceeds subject token": {
+			request: request(subjectToken(t, func(claims *jwttoken.Claims) {
+				claims.Scope = "orders:read"
+			}), func(request *models.TokenRequest) {
+				request.Scope = "orders:read orders:write"
+			}),
+			arrange: func(sam *ServiceAccountRepoMock, srm *SessionRepoMock) {
+				authenticated(sam)
+				srm.On("FindActive", mock.Anything, uint(1), "sid").Return(&models.Session{ID: "sid", UserID: 1}, nil).Once()
+			},
+			assert: oauthError(models.OAuthInvalidScope),
+		},
+		"unknown audience": {
+			request: request(subjectToken(t, func(*jwttoken.Claims) {}), func(request *models.TokenRequest) {
+				request.Audience = "payroll"
+			}),
+			arrange: func(sam *ServiceAccountRepoMock, srm *SessionRepoMock) {
+				authenticated(sam)
+			},
+			assert: oauthError(models.OAuthInvalidTarget),
+		},
+		"unsupported subject token type": {
+			request: request(subjectToken(t, func(*jwttoken.Claims) {}), func(request *models.TokenRequest) {
+				request.SubjectTokenType = "urn:ietf:params:oauth:token-type:id_token"
+			}),
+			arrange: func(sam *ServiceAccountRepoMock, srm *SessionRepoMock) {
+				authenticated(sam)
+			},
+			assert: oauthError(models.OAuthInvalidRequest),
+		},
+		"invalid subject token": {
+			request: request("not-a-token", func(*models.TokenRequest) {}),
+			arrange: func(sam *ServiceAccountRepoMock, srm *SessionRepoMock) {
+				authenticated(sam)
+			},
+			assert: oauthError(models.OAuthInvalidGrant),
+		},
+		"subject token of a service account": {
+			request: request(func() string {
+				token, err := jwttoken.GenerateToken(jwttoken.NewServiceAccountClaims(8, "other"))
+				require.NoError(t, err)
+				return token
+			}(), func(*models.TokenRequest) {}),
+			arrange: func(sam *ServiceAccountRepoMock, srm *SessionRepoMock) {
+				authenticated(sam)
+			},
+			assert: oauthError(models.OAuthInvalidGrant),
+		},
+		"DPoP bound subject token": {
+			request: request(subjectToken(t, func(claims *jwttoken.Claims) {
+				claims.Bind("thumbprint")
+			}), func(*models.TokenRequest) {}),
+			arrange: func(sam *ServiceAccountRepoMock, srm *SessionRepoMock) {
+				authenticated(sam)
+			},
+			assert: oauthError(models.OAuthInvalidGrant),
+		},
+		"revoked session": {
+			request: request(subjectToken(t, func(*jwttoken.Claims) {}), func(*models.TokenRequest) {}),
+			arrange: func(sam *ServiceAccountRepoMock, srm *SessionRepoMock) {
+				authenticated(sam)
+				srm.On("FindActive", mock.Anything, uint(1), "sid").Return((*models.Session)(nil), sql.ErrNoRows).Once()
+			},
+			assert: oauthError(models.OAuthInvalidGrant),
+		},
+		"unauthenticated client": {
+			request: request(subjectToken(t, func(*jwttoken.Claims) {}), func(request *models.TokenRequest) {
+				request.ClientSecret = "wrong"
+			}),
+			arrange: func(sam *ServiceAccountRepoMock, srm *SessionRepoMock) {},
+			assert:  oauthError(models.OAuthInvalidClient),
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			sam := new(ServiceAccountRepoMock)
+			srm := new(SessionRepoMock)
+			serviceAccountService := services.NewServiceAccountService(sam, srm, aud, jwttoken.NewReplayCache())
+			v.arrange(sam, srm)
+
+			res, err := serviceAccountService.Exchange(context.Background(), v.request)
+
+			v.assert(t, res, err)
+			sam.AssertExpectations(t)
+			srm.AssertExpectations(t)
+		})
+	}
+}
+
+func TestCheckServiceAccount(t *testing.T) {
+	sam := new(ServiceAccountRepoMock)
+	serviceAccountService := services.NewServiceAccountService(sam, new(SessionRepoMock), aud, jwttoken.NewReplayCache())
+	disabled := robot
+	disabled.Disabled = true
+
+	sam.On("FindByID", mock.Anything, uint(7)).Return(&robot, nil).Once()
+	require.NoError(t, serviceAccountService.Check(context.Background(), 7))
+
+	sam.On("FindByID", mock.Anything, uint(7)).Return(&disabled, nil).Once()
+	require.ErrorIs(t, serviceAccountService.Check(context.Background(), 7), services.ErrServiceAccountDisabled)
+
+	sam.On("FindByID", mock.Anything, uint(8)).Return((*models.ServiceAccount)(nil), errors.New("not found")).Once()
+	require.Error(t, serviceAccountService.Check(context.Background(), 8))
+}
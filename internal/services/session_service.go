@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/ryanpujo/melius/internal/repositories"
+)
+
+// LoginHistorySize is the number of past sessions listed in the login history.
+const LoginHistorySize = 50
+
+// sessionTouchInterval limits how often the last use of a session is written.
+const sessionTouchInterval = time.Minute
+
+// SessionInterface lets users see and end the sessions of their account.
+type SessionInterface interface {
+	Sessions(ctx context.Context, userID uint, currentID string) ([]models.Session, error)
+	Logins(ctx context.Context, userID uint) ([]models.Session, error)
+	Revoke(ctx context.Context, userID uint, id string) error
+	Check(ctx context.Context, userID uint, id string) error
+}
+
+// SessionService implements the SessionInterface.
+type SessionService struct {
+	sessionRepo repositories.SessionInterface
+	auditor     Auditor
+}
+
+// NewSessionService creates a new instance of SessionService.
+func NewSessionService(sessionRepo repositories.SessionInterface, auditor Auditor) *SessionService {
+	return &SessionService{
+		sessionRepo: sessionRepo,
+		auditor:     auditor,
+	}
+}
+
+// Sessions lists the active sessions of the user and flags the one with currentID.
+func (ss *SessionService) Sessions(ctx context.Context, userID uint, currentID string) ([]models.Session, error) {
+	sessions, err := ss.sessionRepo.Active(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentID
+	}
+	return sessions, nil
+}
+
+// Logins returns the login history of the user, revoked and expired sessions included.
+func (ss *SessionService) Logins(ctx context.Context, userID uint) ([]models.Session, error) {
+	sessions, err := ss.sessionRepo.History(ctx, userID, LoginHistorySize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list logins: %w", err)
+	}
+	return sessions, nil
+}
+
+// Revoke ends the session id of the user. Tokens of the session are rejected from now on.
+func (ss *SessionService) Revoke(ctx context.Context, userID uint, id string) error {
+	err := ss.sessionRepo.Revoke(ctx, userID, id)
+	audit(ctx, ss.auditor, models.AuditSessionRevoke, userID, err, map[string]any{"session": id})
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	return nil
+}
+
+// Check returns an error unless session id of the user is active, and records its use.
+// It is the jwttoken.SessionChecker of the authentication middleware, so it only reads
+// unless the last use recorded is older than sessionTouchInterval.
+func (ss *SessionService) Check(ctx context.Context, userID uint, id string) error {
+	session, err := ss.sessionRepo.FindActive(ctx, userID, id)
+	if err != nil {
+		return fmt.Errorf("session is not active: %w", err)
+	}
+
+	if time.Since(session.LastSeenAt) > sessionTouchInterval {
+		if err := ss.sessionRepo.Touch(ctx, userID, id); err != nil {
+			log.Printf("sessions: %v", err)
+		}
+	}
+	return nil
+}
+
+// sessionSource exposes the sessions of a user to data subject requests.
+type sessionSource struct {
+	sessionRepo repositories.SessionInterface
+}
+
+// NewSessionSource returns the DataSource of the sessions. Erasing it deletes
+// every session, which also logs the user out everywhere.
+func NewSessionSource(sessionRepo repositories.SessionInterface) DataSource {
+	return &sessionSource{
+		sessionRepo: sessionRepo,
+	}
+}
+
+func (s *sessionSource) Name() string {
+	return "sessions"
+}
+
+func (s *sessionSource) Export(ctx context.Context, id uint) (any, error) {
+	return s.sessionRepo.History(ctx, id, 0)
+}
+
+func (s *sessionSource) Erase(ctx context.Context, id uint) error {
+	return s.sessionRepo.DeleteAll(ctx, id)
+}
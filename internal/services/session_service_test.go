@@ -0,0 +1,591 @@
+package services_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/ryanpujo/melius/config"
+	"github.com/ryanpujo/melius/internal/jwttoken"
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/ryanpujo/melius/internal/requestinfo"
+	"github.com/ryanpujo/melius/internal/services"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type SessionRepoMock struct {
+	mock.Mock
+}
+
+func (srm *SessionRepoMock) Create(ctx context.Context, session models.Session) error {
+	args := srm.Called(ctx, session)
+	return args.Error(0)
+}
+
+func (srm *SessionRepoMock) Active(ctx context.Context, userID uint) ([]models.Session, error) {
+	args := srm.Called(ctx, userID)
+	return args.Get(0).([]models.Session), args.Error(1)
+}
+
+func (srm *SessionRepoMock) History(ctx context.Context, userID uint, limit int) ([]models.Session, error) {
+	args := srm.Called(ctx, userID, limit)
+	return args.Get(0).([]models.Session), args.Error(1)
+}
+
+func (srm *SessionRepoMock) FindActive(ctx context.Context, userID uint, id string) (*models.Session, error) {
+	args := srm.Called(ctx, userID, id)
+	return args.Get(0).(*models.Session), args.Error(1)
+}
+
+func (srm *SessionRepoMock) Touch(ctx context.Context, userID uint, id string) error {
+	args := srm.Called(ctx, userID, id)
+	return args.Error(0)
+}
+
+func (srm *SessionRepoMock) Extend(ctx context.Context, userID uint, id string, expiresAt time.Time) error {
+	args := srm.Called(ctx, userID, id, expiresAt)
+	return args.Error(0)
+}
+
+func (srm *SessionRepoMock) Revoke(ctx context.Context, userID uint, id string) error {
+	args := srm.Called(ctx, userID, id)
+	return args.Error(0)
+}
+
+func (srm *SessionRepoMock) RevokeAll(ctx context.Context, userID uint) error {
+	args := srm.Called(ctx, userID)
+	return args.Error(0)
+}
+
+func (srm *SessionRepoMock) DeleteAll(ctx context.Context, userID uint) error {
+	args := srm.Called(ctx, userID)
+	return args.Error(0)
+}
+
+func TestLoginOpensSession(t *testing.T) {
+	ctx := requestinfo.NewContext(context.Background(), requestinfo.Info{
+		IP:        "203.0.113.7",
+		UserAgent: "Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0",
+	})
+
+	var created models.Session
+	crm.On("FindByUsername", mock.Anything, "ryanpujo").Return(&user, nil).Once()
+	arm.On("List", mock.Anything).Return([]models.AttributeDefinition{}, nil).Once()
+	srm.On("Create", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		created = args.Get(1).(models.Session)
+	}).Return(nil).Once()
+	lgm.On("Check", mock.Anything, &user).Return(allowed, nil).Once()
+	lgm.On("Succeeded", mock.Anything, &user).Once()
+	services.CompareHashAndPassword = func(hash, plain string) error {
+		return nil
+	}
+	defer func() { services.CompareHashAndPassword = compareFunc }()
+
+	token, err := credService.Login(ctx, &models.LoginPayload{Username: "ryanpujo", Password: "okeoke"})
+	require.NoError(t, err)
+
+	require.Equal(t, uint(1), created.UserID)
+	require.Equal(t, "Firefox on Linux", created.Device)
+	require.Equal(t, "203.0.113.7", created.IP)
+	require.Equal(t, created.CreatedAt.Add(jwttoken.AccessTokenTTL), created.ExpiresAt)
+
+	var claims jwttoken.Claims
+	_, err = jwt.ParseWithClaims(token, &claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(config.Config().JWTKey), nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, created.ID, claims.SessionID)
+	require.Equal(t, jwttoken.ACRSingleFactor, claims.ACR)
+	require.Equal(t, []string{jwttoken.AMRPassword}, claims.AMR)
+	require.WithinDuration(t, created.CreatedAt, claims.AuthTime.Time, time.Second)
+}
+
+func TestReauthenticate(t *testing.T) {
+	ctx := context.Background()
+	payload := models.ReauthPayload{Password: "okeoke"}
+	singleFactor := jwttoken.Identity{
+		PrincipalType: jwttoken.PrincipalUser,
+		UserID:        1,
+		SessionID:     "current",
+		ACR:           jwttoken.ACRSingleFactor,
+		AMR:           []string{jwttoken.AMRPassword},
+	}
+	multiFactor := singleFactor
+	multiFactor.ACR = jwttoken.ACRMultiFactor
+	multiFactor.AMR = []string{jwttoken.AMROTP}
+	tableTest := map[string]struct {
+		identity jwttoken.Identity
+		arrange  func()
+		assert   func(t *testing.T, token string, err error)
+	}{
+		"success": {
+			identity: singleFactor,
+			arrange: func() {
+				lgm.On("CheckPassword", mock.Anything, uint(1)).Return(nil).Once()
+				urm.On("FindByID", mock.Anything, uint(1)).Return(&user, nil).Once()
+				srm.On("Extend", mock.Anything, uint(1), "current", mock.Anything).Return(nil).Once()
+				arm.On("List", mock.Anything).Return([]models.AttributeDefinition{}, nil).Once()
+			},
+			assert: func(t *testing.T, token string, err error) {
+				require.NoError(t, err)
+
+				var claims jwttoken.Claims
+				_, err = jwt.ParseWithClaims(token, &claims, func(token *jwt.Token) (interface{}, error) {
+					return []byte(config.Config().JWTKey), nil
+				})
+				require.NoError(t, err)
+				require.Equal(t, "1", claims.Subject)
+				require.Equal(t, "current", claims.SessionID)
+				require.Equal(t, jwttoken.ACRSingleFactor, claims.ACR)
+				require.Equal(t, []string{jwttoken.AMRPassword}, claims.AMR)
+				require.WithinDuration(t, time.Now(), claims.AuthTime.Time, time.Second)
+
+				event := aud.last()
+				require.Equal(t, models.AuditReauthenticate, event.Action)
+				require.Equal(t, models.AuditOutcomeSuccess, event.Outcome)
+			},
+		},
+		"keeps the stronger acr": {
+			identity: multiFactor,
+			arrange: func() {
+				lgm.On("CheckPassword", mock.Anything, uint(1)).Return(nil).Once()
+				urm.On("FindByID", mock.Anything, uint(1)).Return(&user, nil).Once()
+				srm.On("Extend", mock.Anything, uint(1), "current", mock.Anything).Return(nil).Once()
+				arm.On("List", mock.Anything).Return([]models.AttributeDefinition{}, nil).Once()
+			},
+			assert: func(t *testing.T, token string, err error) {
+				require.NoError(t, err)
+
+				var claims jwttoken.Claims
+				_, err = jwt.ParseWithClaims(token, &claims, func(token *jwt.Token) (interface{}, error) {
+					return []byte(config.Config().JWTKey), nil
+				})
+				require.NoError(t, err)
+				require.Equal(t, jwttoken.ACRMultiFactor, claims.ACR)
+				require.Equal(t, []string{jwttoken.AMROTP, jwttoken.AMRPassword}, claims.AMR)
+			},
+		},
+		"blocked": {
+			identity: singleFactor,
+			arrange: func() {
+				lgm.On("CheckPassword", mock.Anything, uint(1)).Return(services.ErrLoginBlocked).Once()
+			},
+			assert: func(t *testing.T, token string, err error) {
+				require.ErrorIs(t, err, services.ErrLoginBlocked)
+				require.Zero(t, token)
+				require.Equal(t, models.AuditOutcomeFailure, aud.last().Outcome)
+			},
+		},
+		"wrong password": {
+			identity: singleFactor,
+			arrange: func() {
+				lgm.On("CheckPassword", mock.Anything, uint(1)).Return(nil).Once()
+				urm.On("FindByID", mock.Anything, uint(1)).Return(&user, nil).Once()
+				services.CompareHashAndPassword = func(hash, plain string) error {
+					return errors.New("wrong password")
+				}
+			},
+			assert: func(t *testing.T, token string, err error) {
+				require.Error(t, err)
+				require.Zero(t, token)
+				require.Equal(t, models.AuditOutcomeFailure, aud.last().Outcome)
+			},
+		},
+		"session not active": {
+			identity: singleFactor,
+			arrange: func() {
+				lgm.On("CheckPassword", mock.Anything, uint(1)).Return(nil).Once()
+				urm.On("FindByID", mock.Anything, uint(1)).Return(&user, nil).Once()
+				srm.On("Extend", mock.Anything, uint(1), "current", mock.Anything).Return(sql.ErrNoRows).Once()
+			},
+			assert: func(t *testing.T, token string, err error) {
+				require.ErrorIs(t, err, sql.ErrNoRows)
+				require.Zero(t, token)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			services.CompareHashAndPassword = func(hash, plain string) error {
+				return nil
+			}
+			defer func() { services.CompareHashAndPassword = compareFunc }()
+			v.arrange()
+
+			token, err := credService.Reauthenticate(ctx, v.identity, payload)
+
+			v.assert(t, token, err)
+		})
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	authTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	current := jwttoken.Identity{
+		PrincipalType: jwttoken.PrincipalUser,
+		UserID:        1,
+		SessionID:     "current",
+		AuthTime:      authTime,
+		ACR:           jwttoken.ACRMultiFactor,
+		AMR:           []string{jwttoken.AMRPassword, jwttoken.AMROTP},
+		ClientID:      "melius-cli",
+		Scopes:        []string{"read", "write"},
+	}
+	conf := config.Config()
+	prevMaxAge := conf.SessionMaxAge
+	conf.SessionMaxAge = 24 * time.Hour
+	t.Cleanup(func() { conf.SessionMaxAge = prevMaxAge })
+
+	tableTest := map[string]struct {
+		identity jwttoken.Identity
+		arrange  func()
+		assert   func(t *testing.T, token string, err error)
+	}{
+		"success": {
+			identity: current,
+			arrange: func() {
+				urm.On("FindByID", mock.Anything, uint(1)).Return(&user, nil).Once()
+				srm.On("FindActive", mock.Anything, uint(1), "current").Return(&models.Session{CreatedAt: authTime}, nil).Once()
+				srm.On("Extend", mock.Anything, uint(1), "current", mock.Anything).Return(nil).Once()
+				arm.On("List", mock.Anything).Return([]models.AttributeDefinition{}, nil).Once()
+			},
+			assert: func(t *testing.T, token string, err error) {
+				require.NoError(t, err)
+
+				var claims jwttoken.Claims
+				_, err = jwt.ParseWithClaims(token, &claims, func(token *jwt.Token) (interface{}, error) {
+					return []byte(config.Config().JWTKey), nil
+				})
+				require.NoError(t, err)
+				require.Equal(t, "current", claims.SessionID)
+				require.True(t, authTime.Equal(claims.AuthTime.Time))
+				require.Equal(t, jwttoken.ACRMultiFactor, claims.ACR)
+				require.Equal(t, []string{jwttoken.AMRPassword, jwttoken.AMROTP}, claims.AMR)
+				require.Equal(t, "melius-cli", claims.ClientID)
+				require.Equal(t, "read write", claims.Scope)
+				require.WithinDuration(t, time.Now(), claims.IssuedAt.Time, time.Second)
+			},
+		},
+		"DPoP bound": {
+			identity: func() jwttoken.Identity {
+				identity := current
+				identity.JKT = "thumbprint"
+				return identity
+			}(),
+			arrange: func() {
+				urm.On("FindByID", mock.Anything, uint(1)).Return(&user, nil).Once()
+				srm.On("FindActive", mock.Anything, uint(1), "current").Return(&models.Session{CreatedAt: authTime}, nil).Once()
+				srm.On("Extend", mock.Anything, uint(1), "current", mock.Anything).Return(nil).Once()
+				arm.On("List", mock.Anything).Return([]models.AttributeDefinition{}, nil).Once()
+			},
+			assert: func(t *testing.T, token string, err error) {
+				require.NoError(t, err)
+
+				claims, err := jwttoken.Parse(token)
+				require.NoError(t, err)
+				require.Equal(t, "thumbprint", claims.Confirmation.JKT)
+			},
+		},
+		"near maximum age": {
+			identity: current,
+			arrange: func() {
+				createdAt := time.Now().Add(-24*time.Hour + time.Minute).Truncate(time.Second)
+				urm.On("FindByID", mock.Anything, uint(1)).Return(&user, nil).Once()
+				srm.On("FindActive", mock.Anything, uint(1), "current").Return(&models.Session{CreatedAt: createdAt}, nil).Once()
+				srm.On("Extend", mock.Anything, uint(1), "current", createdAt.Add(24*time.Hour)).Return(nil).Once()
+				arm.On("List", mock.Anything).Return([]models.AttributeDefinition{}, nil).Once()
+			},
+			assert: func(t *testing.T, token string, err error) {
+				require.NoError(t, err)
+
+				// The token ends with the session instead of a full lifetime later.
+				claims, err := jwttoken.Parse(token)
+				require.NoError(t, err)
+				require.WithinDuration(t, time.Now().Add(time.Minute), claims.ExpiresAt.Time, 2*time.Second)
+			},
+		},
+		"session not active": {
+			identity: current,
+			arrange: func() {
+				urm.On("FindByID", mock.Anything, uint(1)).Return(&user, nil).Once()
+				srm.On("FindActive", mock.Anything, uint(1), "current").Return((*models.Session)(nil), sql.ErrNoRows).Once()
+			},
+			assert: func(t *testing.T, token string, err error) {
+				require.ErrorIs(t, err, sql.ErrNoRows)
+				require.Zero(t, token)
+			},
+		},
+		"maximum age": {
+			identity: current,
+			arrange: func() {
+				urm.On("FindByID", mock.Anything, uint(1)).Return(&user, nil).Once()
+				srm.On("FindActive", mock.Anything, uint(1), "current").
+					Return(&models.Session{CreatedAt: time.Now().Add(-24 * time.Hour)}, nil).Once()
+			},
+			assert: func(t *testing.T, token string, err error) {
+				require.ErrorIs(t, err, services.ErrSessionMaxAge)
+				require.Zero(t, token)
+			},
+		},
+		"impersonation": {
+			identity: func() jwttoken.Identity {
+				identity := current
+				identity.ActorID = 2
+				return identity
+			}(),
+			arrange: func() {},
+			assert: func(t *testing.T, token string, err error) {
+				require.ErrorIs(t, err, services.ErrRefreshForbidden)
+			},
+		},
+		"api key": {
+			identity: jwttoken.Identity{PrincipalType: jwttoken.PrincipalUser, UserID: 1, Transport: jwttoken.TransportAPIKey},
+			arrange:  func() {},
+			assert: func(t *testing.T, token string, err error) {
+				require.ErrorIs(t, err, services.ErrRefreshForbidden)
+			},
+		},
+		"service account": {
+			identity: jwttoken.Identity{PrincipalType: jwttoken.PrincipalServiceAccount, ServiceAccountID: 1},
+			arrange:  func() {},
+			assert: func(t *testing.T, token string, err error) {
+				require.ErrorIs(t, err, services.ErrRefreshForbidden)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			token, err := credService.Refresh(context.Background(), v.identity)
+
+			v.assert(t, token, err)
+		})
+	}
+}
+
+func TestSessions(t *testing.T) {
+	srm := new(SessionRepoMock)
+	sessionService := services.NewSessionService(srm, aud)
+
+	srm.On("Active", mock.Anything, uint(1)).Return([]models.Session{{ID: "a"}, {ID: "b"}}, nil).Once()
+
+	sessions, err := sessionService.Sessions(context.Background(), 1, "b")
+
+	require.NoError(t, err)
+	require.False(t, sessions[0].Current)
+	require.True(t, sessions[1].Current)
+}
+
+func TestRevokeSession(t *testing.T) {
+	srm := new(SessionRepoMock)
+	sessionService := services.NewSessionService(srm, aud)
+
+	tableTest := map[string]struct {
+		arrange func()
+		assert  func(t *testing.T, err error)
+	}{
+		"success": {
+			arrange: func() {
+				srm.On("Revoke", mock.Anything, uint(1), "a").Return(nil).Once()
+			},
+			assert: func(t *testing.T, err error) {
+				require.NoError(t, err)
+				event := aud.last()
+				require.Equal(t, models.AuditSessionRevoke, event.Action)
+				require.Equal(t, models.AuditOutcomeSuccess, event.Outcome)
+			},
+		},
+		"not found": {
+			arrange: func() {
+				srm.On("Revoke", mock.Anything, uint(1), "a").Return(sql.ErrNoRows).Once()
+			},
+			assert: func(t *testing.T, err error) {
+				require.ErrorIs(t, err, sql.ErrNoRows)
+				require.Equal(t, models.AuditOutcomeFailure, aud.last().Outcome)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			err := sessionService.Revoke(context.Background(), 1, "a")
+
+			v.assert(t, err)
+		})
+	}
+}
+
+func TestCheckSession(t *testing.T) {
+	srm := new(SessionRepoMock)
+	sessionService := services.NewSessionService(srm, aud)
+
+	srm.On("FindActive", mock.Anything, uint(1), "idle").
+		Return(&models.Session{ID: "idle", UserID: 1, LastSeenAt: time.Now().Add(-time.Hour)}, nil).Once()
+	srm.On("Touch", mock.Anything, uint(1), "idle").Return(nil).Once()
+	srm.On("FindActive", mock.Anything, uint(1), "active").
+		Return(&models.Session{ID: "active", UserID: 1, LastSeenAt: time.Now()}, nil).Once()
+	srm.On("FindActive", mock.Anything, uint(1), "revoked").Return((*models.Session)(nil), sql.ErrNoRows).Once()
+
+	require.NoError(t, sessionService.Check(context.Background(), 1, "idle"))
+	// Sessions used within the last minute are only read.
+	require.NoError(t, sessionService.Check(context.Background(), 1, "active"))
+	require.ErrorIs(t, sessionService.Check(context.Background(), 1, "revoked"), sql.ErrNoRows)
+	srm.AssertExpectations(t)
+	srm.AssertNotCalled(t, "Touch", mock.Anything, uint(1), "active")
+}
+
+func TestLogout(t *testing.T) {
+	srm.On("Revoke", mock.Anything, uint(1), "current").Return(nil).Once()
+
+	err := credService.Logout(context.Background(), 1, "current")
+
+	require.NoError(t, err)
+	event := aud.last()
+	require.Equal(t, models.AuditLogout, event.Action)
+	require.Equal(t, models.AuditOutcomeSuccess, event.Outcome)
+
+	srm.On("Revoke", mock.Anything, uint(1), "current").Return(sql.ErrNoRows).Once()
+
+	err = credService.Logout(context.Background(), 1, "current")
+
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	require.Equal(t, models.AuditOutcomeFailure, aud.last().Outcome)
+}
+
+func TestImpersonate(t *testing.T) {
+	admin := user
+	admin.ID = 2
+	admin.Roles = []string{models.RoleAdmin}
+	payload := models.ImpersonatePayload{Reason: "ticket 42"}
+
+	tableTest := map[string]struct {
+		target  uint
+		arrange func()
+		assert  func(t *testing.T, token string, err error)
+	}{
+		"success": {
+			target: 1,
+			arrange: func() {
+				urm.On("FindByID", mock.Anything, uint(2)).Return(&admin, nil).Once()
+				urm.On("FindByID", mock.Anything, uint(1)).Return(&user, nil).Once()
+				srm.On("Create", mock.Anything, mock.MatchedBy(func(session models.Session) bool {
+					return session.UserID == 1 && session.ActorID != nil && *session.ActorID == 2 &&
+						session.ExpiresAt.Sub(session.CreatedAt) == jwttoken.Lifetime(jwttoken.KindImpersonation)
+				})).Return(nil).Once()
+				arm.On("List", mock.Anything).Return([]models.AttributeDefinition{}, nil).Once()
+			},
+			assert: func(t *testing.T, token string, err error) {
+				require.NoError(t, err)
+
+				var claims jwttoken.Claims
+				_, err = jwt.ParseWithClaims(token, &claims, func(token *jwt.Token) (interface{}, error) {
+					return []byte(config.Config().JWTKey), nil
+				})
+				require.NoError(t, err)
+				require.Equal(t, "1", claims.Subject)
+				require.Equal(t, &jwttoken.Actor{Subject: "2", Username: admin.Credential.Username}, claims.Actor)
+				// Without an auth_time the token cannot pass a recent authentication check.
+				require.Nil(t, claims.AuthTime)
+
+				event := aud.last()
+				require.Equal(t, models.AuditImpersonationStart, event.Action)
+				require.Equal(t, models.AuditOutcomeSuccess, event.Outcome)
+				require.Equal(t, uint(1), *event.SubjectID)
+				require.Equal(t, "ticket 42", event.Details["reason"])
+				require.Equal(t, claims.SessionID, event.Details["session_id"])
+			},
+		},
+		"administrator": {
+			target: 3,
+			arrange: func() {
+				other := admin
+				other.ID = 3
+				urm.On("FindByID", mock.Anything, uint(2)).Return(&admin, nil).Once()
+				urm.On("FindByID", mock.Anything, uint(3)).Return(&other, nil).Once()
+			},
+			assert: func(t *testing.T, token string, err error) {
+				require.ErrorIs(t, err, services.ErrImpersonationForbidden)
+				require.Zero(t, token)
+				require.Equal(t, models.AuditOutcomeFailure, aud.last().Outcome)
+			},
+		},
+		"self": {
+			target:  2,
+			arrange: func() {},
+			assert: func(t *testing.T, token string, err error) {
+				require.ErrorIs(t, err, services.ErrImpersonationForbidden)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			token, err := credService.Impersonate(context.Background(), 2, v.target, payload)
+
+			v.assert(t, token, err)
+		})
+	}
+}
+
+func TestEndImpersonation(t *testing.T) {
+	ctx := context.WithValue(context.Background(), "actor_id", uint(2))
+	srm.On("Revoke", mock.Anything, uint(1), "impersonation").Return(nil).Once()
+
+	err := credService.Logout(ctx, 1, "impersonation")
+
+	require.NoError(t, err)
+	event := aud.last()
+	require.Equal(t, models.AuditImpersonationEnd, event.Action)
+	require.Equal(t, "impersonation", event.Details["session_id"])
+}
+
+func TestIssueToken(t *testing.T) {
+	urm.On("FindByID", mock.Anything, uint(1)).Return(&user, nil).Once()
+	srm.On("Create", mock.Anything, mock.MatchedBy(func(session models.Session) bool {
+		return session.UserID == 1 && session.ActorID == nil
+	})).Return(nil).Once()
+	arm.On("List", mock.Anything).Return([]models.AttributeDefinition{}, nil).Once()
+
+	token, err := credService.IssueToken(context.Background(), 1, "melius-cli", "read", "")
+	require.NoError(t, err)
+
+	claims, err := jwttoken.Parse(token)
+	require.NoError(t, err)
+	require.Equal(t, "1", claims.Subject)
+	require.Equal(t, "read", claims.Scope)
+	require.NotEmpty(t, claims.SessionID)
+	// The user authenticated on another device, sensitive operations need a fresh login.
+	require.Nil(t, claims.AuthTime)
+	require.Nil(t, claims.Confirmation)
+
+	urm.On("FindByID", mock.Anything, uint(1)).Return(&user, nil).Once()
+	srm.On("Create", mock.Anything, mock.Anything).Return(nil).Once()
+	arm.On("List", mock.Anything).Return([]models.AttributeDefinition{}, nil).Once()
+
+	token, err = credService.IssueToken(context.Background(), 1, "", "", "thumbprint")
+	require.NoError(t, err)
+	claims, err = jwttoken.Parse(token)
+	require.NoError(t, err)
+	require.Equal(t, "thumbprint", claims.Confirmation.JKT)
+
+	urm.On("FindByID", mock.Anything, uint(9)).Return((*models.User)(nil), sql.ErrNoRows).Once()
+	_, err = credService.IssueToken(context.Background(), 9, "", "", "")
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	// Clients requiring DPoP get no bearer token.
+	config.Config().DPoPClients = []string{"melius-cli"}
+	defer func() { config.Config().DPoPClients = nil }()
+	_, err = credService.IssueToken(context.Background(), 1, "melius-cli", "read", "")
+	require.ErrorIs(t, err, services.ErrDPoPRequired)
+}
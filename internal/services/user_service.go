@@ -0,0 +1,377 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ryanpujo/melius/config"
+	"github.com/ryanpujo/melius/internal/identifier"
+	"github.com/ryanpujo/melius/internal/mailer"
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/ryanpujo/melius/internal/repositories"
+	"github.com/ryanpujo/melius/internal/utilities"
+)
+
+// EmailChangeTTL is how long an email change confirmation token stays valid.
+const EmailChangeTTL = 24 * time.Hour
+
+var (
+	ErrSameEmail    = errors.New("new email is the same as the current one")
+	ErrSameUsername = errors.New("new username is the same as the current one")
+)
+
+// UserInterface defines the self-service operations a user performs on their own account.
+// Users are identified by their immutable ID, never by username.
+type UserInterface interface {
+	Profile(ctx context.Context, id uint) (*models.User, error)
+	UpdateProfile(ctx context.Context, id uint, payload models.UpdateUserPayload) (*models.User, error)
+	ChangePassword(ctx context.Context, id uint, payload models.ChangePasswordPayload) error
+	RequestEmailChange(ctx context.Context, id uint, payload models.ChangeEmailPayload) error
+	ConfirmEmailChange(ctx context.Context, id uint, payload models.ConfirmEmailPayload) error
+	ChangeUsername(ctx context.Context, id uint, payload models.ChangeUsernamePayload) (*models.User, error)
+	History(ctx context.Context, id uint) ([]models.IdentifierChange, error)
+	CloseAccount(ctx context.Context, id uint, payload models.CloseAccountPayload) error
+	Restore(ctx context.Context, payload *models.LoginPayload) error
+
+	// Administration of other users.
+	User(ctx context.Context, id uint) (*models.User, error)
+	SetAttributes(ctx context.Context, id uint, changes map[string]any) (*models.User, error)
+	AssignRole(ctx context.Context, id uint, role string) error
+	RevokeRole(ctx context.Context, id uint, role string) error
+}
+
+// UserService implements the UserInterface.
+type UserService struct {
+	credRepo    repositories.CredentialInterface
+	userRepo    repositories.UserInterface
+	attrRepo    repositories.AttributeInterface
+	sessionRepo repositories.SessionInterface
+	apiKeyRepo  repositories.APIKeyInterface
+	guard       LoginGuard
+	mailer      mailer.Mailer
+	auditor     Auditor
+}
+
+// NewUserService creates a new instance of UserService.
+func NewUserService(
+	credRepo repositories.CredentialInterface,
+	userRepo repositories.UserInterface,
+	attrRepo repositories.AttributeInterface,
+	sessionRepo repositories.SessionInterface,
+	apiKeyRepo repositories.APIKeyInterface,
+	guard LoginGuard,
+	m mailer.Mailer,
+	auditor Auditor,
+) *UserService {
+	return &UserService{
+		credRepo:    credRepo,
+		userRepo:    userRepo,
+		attrRepo:    attrRepo,
+		sessionRepo: sessionRepo,
+		apiKeyRepo:  apiKeyRepo,
+		guard:       guard,
+		mailer:      m,
+		auditor:     auditor,
+	}
+}
+
+// Profile returns the user identified by id as seen by the user themselves,
+// without admin-only attributes.
+func (us *UserService) Profile(ctx context.Context, id uint) (*models.User, error) {
+	return us.view(ctx, id, false)
+}
+
+// User returns the user identified by id as seen by an administrator.
+func (us *UserService) User(ctx context.Context, id uint) (*models.User, error) {
+	return us.view(ctx, id, true)
+}
+
+// UpdateProfile applies the non-nil fields of payload and returns the updated user.
+// Attribute changes are merged into the stored attributes and validated against the schema.
+func (us *UserService) UpdateProfile(ctx context.Context, id uint, payload models.UpdateUserPayload) (*models.User, error) {
+	if payload.Attributes != nil {
+		merged, err := us.applyAttributes(ctx, id, payload.Attributes, false)
+		if err != nil {
+			return nil, err
+		}
+		payload.Attributes = merged
+	}
+
+	if err := us.userRepo.Update(ctx, id, payload); err != nil {
+		return nil, fmt.Errorf("failed to update profile: %w", err)
+	}
+	return us.Profile(ctx, id)
+}
+
+// SetAttributes changes attributes of the user identified by id on behalf of an
+// administrator, who may also set admin-only attributes.
+func (us *UserService) SetAttributes(ctx context.Context, id uint, changes map[string]any) (_ *models.User, err error) {
+	defer func() {
+		audit(ctx, us.auditor, models.AuditAttributesSet, id, err, map[string]any{"attributes": attributeNames(changes)})
+	}()
+
+	merged, err := us.applyAttributes(ctx, id, changes, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := us.userRepo.Update(ctx, id, models.UpdateUserPayload{Attributes: merged}); err != nil {
+		return nil, fmt.Errorf("failed to update attributes: %w", err)
+	}
+	return us.User(ctx, id)
+}
+
+// AssignRole grants role to the user identified by id.
+func (us *UserService) AssignRole(ctx context.Context, id uint, role string) (err error) {
+	defer func() {
+		audit(ctx, us.auditor, models.AuditRoleAssign, id, err, map[string]any{"role": role})
+	}()
+
+	if _, err := us.find(ctx, id); err != nil {
+		return err
+	}
+	if err := us.userRepo.AddRole(ctx, id, role); err != nil {
+		return fmt.Errorf("failed to assign role: %w", err)
+	}
+	return nil
+}
+
+// RevokeRole revokes role from the user identified by id.
+func (us *UserService) RevokeRole(ctx context.Context, id uint, role string) (err error) {
+	defer func() {
+		audit(ctx, us.auditor, models.AuditRoleRevoke, id, err, map[string]any{"role": role})
+	}()
+
+	if err := us.userRepo.RemoveRole(ctx, id, role); err != nil {
+		return fmt.Errorf("failed to revoke role: %w", err)
+	}
+	return nil
+}
+
+// ChangePassword verifies the current password and stores a hash of the new one.
+func (us *UserService) ChangePassword(ctx context.Context, id uint, payload models.ChangePasswordPayload) (err error) {
+	defer func() {
+		audit(ctx, us.auditor, models.AuditPasswordChange, id, err, nil)
+	}()
+
+	user, err := us.find(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := CompareHashAndPassword(user.Credential.Password, payload.CurrentPassword); err != nil {
+		return fmt.Errorf("current password is incorrect: %w", err)
+	}
+
+	passwordHash, err := HashPassword(payload.NewPassword)
+	if err != nil {
+		return err
+	}
+
+	if err := us.userRepo.UpdatePassword(ctx, id, passwordHash); err != nil {
+		return fmt.Errorf("failed to change password: %w", err)
+	}
+	return nil
+}
+
+// RequestEmailChange stores a pending email change and sends a confirmation token
+// to the new address. The email is only changed once the token is confirmed.
+func (us *UserService) RequestEmailChange(ctx context.Context, id uint, payload models.ChangeEmailPayload) error {
+	user, err := us.find(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	payload.Email = identifier.Email(payload.Email)
+	if user.Credential.Email == payload.Email {
+		return ErrSameEmail
+	}
+	if err := checkReserved(ctx, us.credRepo, models.IdentifierEmail, payload.Email, id); err != nil {
+		return err
+	}
+
+	token, err := utilities.RandomToken(32)
+	if err != nil {
+		return fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	change := models.EmailChange{
+		UserID:    id,
+		NewEmail:  payload.Email,
+		TokenHash: utilities.HashToken(token),
+		ExpiresAt: time.Now().Add(EmailChangeTTL),
+	}
+	if err := us.userRepo.CreateEmailChange(ctx, change); err != nil {
+		return fmt.Errorf("failed to request email change: %w", err)
+	}
+
+	return us.mailer.Send(ctx, mailer.Message{
+		To:      payload.Email,
+		Subject: "Confirm your new email address",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nUse the following token to confirm your new email address:\n\n%s\n\nThe token expires in %s.\n",
+			user.FirstName, token, EmailChangeTTL,
+		),
+	})
+}
+
+// ConfirmEmailChange applies the pending email change matching the token.
+// The previous address stays reserved for the user for the configured period.
+func (us *UserService) ConfirmEmailChange(ctx context.Context, id uint, payload models.ConfirmEmailPayload) error {
+	_, err := us.userRepo.ConfirmEmailChange(ctx, id, utilities.HashToken(payload.Token), reservedUntil())
+	audit(ctx, us.auditor, models.AuditEmailChange, id, err, nil)
+	if err != nil {
+		return fmt.Errorf("failed to confirm email change: %w", err)
+	}
+	return nil
+}
+
+// ChangeUsername renames the user and returns the updated user.
+// The previous username stays reserved for the user for the configured period.
+func (us *UserService) ChangeUsername(ctx context.Context, id uint, payload models.ChangeUsernamePayload) (_ *models.User, err error) {
+	defer func() {
+		audit(ctx, us.auditor, models.AuditUsernameChange, id, err, nil)
+	}()
+
+	user, err := us.find(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	payload.Username = identifier.Username(payload.Username)
+	if user.Credential.Username == payload.Username {
+		return nil, ErrSameUsername
+	}
+	if err := checkReserved(ctx, us.credRepo, models.IdentifierUsername, payload.Username, id); err != nil {
+		return nil, err
+	}
+
+	if err := us.userRepo.ChangeUsername(ctx, id, payload.Username, reservedUntil()); err != nil {
+		return nil, fmt.Errorf("failed to change username: %w", err)
+	}
+	return us.Profile(ctx, id)
+}
+
+// History lists the previous usernames and emails of the user.
+func (us *UserService) History(ctx context.Context, id uint) ([]models.IdentifierChange, error) {
+	history, err := us.userRepo.History(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve history: %w", err)
+	}
+	return history, nil
+}
+
+// CloseAccount verifies the password and closes the account of the user. The account
+// can be restored during the grace period and is purged after the retention window.
+func (us *UserService) CloseAccount(ctx context.Context, id uint, payload models.CloseAccountPayload) (err error) {
+	defer func() {
+		audit(ctx, us.auditor, models.AuditAccountClose, id, err, nil)
+	}()
+
+	user, err := us.find(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := CompareHashAndPassword(user.Credential.Password, payload.Password); err != nil {
+		return fmt.Errorf("password is incorrect: %w", err)
+	}
+
+	if err := us.userRepo.Close(ctx, id); err != nil {
+		return fmt.Errorf("failed to close account: %w", err)
+	}
+
+	// Tokens of the account stop authenticating at once, and its API keys are revoked
+	// for good; restoring the account requires logging in again.
+	if err := us.sessionRepo.RevokeAll(ctx, id); err != nil {
+		return fmt.Errorf("failed to close account: %w", err)
+	}
+	if err := us.apiKeyRepo.DeleteAll(ctx, id); err != nil {
+		return fmt.Errorf("failed to close account: %w", err)
+	}
+	return nil
+}
+
+// Restore reopens a closed account within its grace period after checking the credentials.
+// Like reauthentication, it is refused after too many recent failed attempts.
+func (us *UserService) Restore(ctx context.Context, payload *models.LoginPayload) error {
+	login := payload.Login()
+	if identifier.IsEmail(login) {
+		login = identifier.Email(login)
+	} else {
+		login = identifier.Username(login)
+	}
+
+	user, err := us.credRepo.FindClosed(ctx, login)
+	if err != nil {
+		return fmt.Errorf("failed to restore account: %w", err)
+	}
+
+	if err := us.guard.CheckPassword(ctx, user.ID); err != nil {
+		audit(ctx, us.auditor, models.AuditAccountRestore, user.ID, err, nil)
+		return fmt.Errorf("failed to restore account: %w", err)
+	}
+
+	if err := CompareHashAndPassword(user.Credential.Password, payload.Password); err != nil {
+		audit(ctx, us.auditor, models.AuditAccountRestore, user.ID, err, nil)
+		return fmt.Errorf("failed to restore account: %w", err)
+	}
+
+	closedAfter := time.Now().Add(-config.Config().AccountGracePeriod)
+	err = us.userRepo.Restore(ctx, user.ID, closedAfter)
+	audit(ctx, us.auditor, models.AuditAccountRestore, user.ID, err, nil)
+	if err != nil {
+		return fmt.Errorf("failed to restore account, the grace period may have ended: %w", err)
+	}
+	return nil
+}
+
+// find returns the stored user identified by id with every attribute.
+func (us *UserService) find(ctx context.Context, id uint) (*models.User, error) {
+	user, err := us.userRepo.FindByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find user: %w", err)
+	}
+	return user, nil
+}
+
+// view returns the user identified by id with the attributes visible to the caller.
+func (us *UserService) view(ctx context.Context, id uint, admin bool) (*models.User, error) {
+	user, err := us.find(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	defs, err := us.attrRepo.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find user: %w", err)
+	}
+	user.Attributes = visibleAttributes(defs, user.Attributes, admin)
+	return user, nil
+}
+
+// applyAttributes merges changes into the stored attributes of the user and validates the result.
+func (us *UserService) applyAttributes(ctx context.Context, id uint, changes map[string]any, admin bool) (map[string]any, error) {
+	user, err := us.find(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	defs, err := us.attrRepo.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to validate attributes: %w", err)
+	}
+
+	merged := mergeAttributes(user.Attributes, changes)
+	if err := validateAttributes(defs, merged, changes, admin); err != nil {
+		return nil, err
+	}
+	return merged, nil
+}
+
+// reservedUntil is the end of the reservation period for an identifier released now.
+func reservedUntil() time.Time {
+	return time.Now().Add(config.Config().IdentifierReservation)
+}
@@ -0,0 +1,573 @@
+package services_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ryanpujo/melius/internal/mailer"
+	"github.com/ryanpujo/melius/internal/models"
+	"github.com/ryanpujo/melius/internal/services"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type UserRepoMock struct {
+	mock.Mock
+}
+
+func (urm *UserRepoMock) FindByID(ctx context.Context, id uint) (*models.User, error) {
+	args := urm.Called(ctx, id)
+	return args.Get(0).(*models.User), args.Error(1)
+}
+
+func (urm *UserRepoMock) Update(ctx context.Context, id uint, payload models.UpdateUserPayload) error {
+	args := urm.Called(ctx, id, payload)
+	return args.Error(0)
+}
+
+func (urm *UserRepoMock) UpdatePassword(ctx context.Context, id uint, passwordHash string) error {
+	args := urm.Called(ctx, id, passwordHash)
+	return args.Error(0)
+}
+
+func (urm *UserRepoMock) CreateEmailChange(ctx context.Context, change models.EmailChange) error {
+	args := urm.Called(ctx, change)
+	return args.Error(0)
+}
+
+func (urm *UserRepoMock) ConfirmEmailChange(ctx context.Context, id uint, tokenHash string, reservedUntil time.Time) (string, error) {
+	args := urm.Called(ctx, id, tokenHash, reservedUntil)
+	return args.String(0), args.Error(1)
+}
+
+func (urm *UserRepoMock) ChangeUsername(ctx context.Context, id uint, username string, reservedUntil time.Time) error {
+	args := urm.Called(ctx, id, username, reservedUntil)
+	return args.Error(0)
+}
+
+func (urm *UserRepoMock) AddRole(ctx context.Context, id uint, role string) error {
+	args := urm.Called(ctx, id, role)
+	return args.Error(0)
+}
+
+func (urm *UserRepoMock) RemoveRole(ctx context.Context, id uint, role string) error {
+	args := urm.Called(ctx, id, role)
+	return args.Error(0)
+}
+
+func (urm *UserRepoMock) History(ctx context.Context, id uint) ([]models.IdentifierChange, error) {
+	args := urm.Called(ctx, id)
+	return args.Get(0).([]models.IdentifierChange), args.Error(1)
+}
+
+func (urm *UserRepoMock) Close(ctx context.Context, id uint) error {
+	args := urm.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (urm *UserRepoMock) Restore(ctx context.Context, id uint, closedAfter time.Time) error {
+	args := urm.Called(ctx, id, closedAfter)
+	return args.Error(0)
+}
+
+func (urm *UserRepoMock) ListPurgeable(ctx context.Context, closedBefore time.Time) ([]uint, error) {
+	args := urm.Called(ctx, closedBefore)
+	return args.Get(0).([]uint), args.Error(1)
+}
+
+func (urm *UserRepoMock) Delete(ctx context.Context, id uint) error {
+	args := urm.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (urm *UserRepoMock) Anonymize(ctx context.Context, id uint) error {
+	args := urm.Called(ctx, id)
+	return args.Error(0)
+}
+
+type MailerMock struct {
+	mock.Mock
+}
+
+func (mm *MailerMock) Send(ctx context.Context, msg mailer.Message) error {
+	args := mm.Called(ctx, msg)
+	return args.Error(0)
+}
+
+func TestUpdateProfile(t *testing.T) {
+	lastName := "Pujo"
+	payload := models.UpdateUserPayload{LastName: &lastName}
+	tableTest := map[string]struct {
+		arrange func()
+		assert  func(t *testing.T, actual *models.User, err error)
+	}{
+		"success": {
+			arrange: func() {
+				urm.On("Update", mock.Anything, uint(1), payload).Return(nil).Once()
+				urm.On("FindByID", mock.Anything, uint(1)).Return(&user, nil).Once()
+				arm.On("List", mock.Anything).Return([]models.AttributeDefinition{}, nil).Once()
+			},
+			assert: func(t *testing.T, actual *models.User, err error) {
+				require.NoError(t, err)
+				require.Equal(t, &user, actual)
+			},
+		},
+		"failed": {
+			arrange: func() {
+				urm.On("Update", mock.Anything, uint(1), payload).Return(errors.New("failed")).Once()
+			},
+			assert: func(t *testing.T, actual *models.User, err error) {
+				require.Error(t, err)
+				require.Nil(t, actual)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			actual, err := userService.UpdateProfile(context.Background(), uint(1), payload)
+
+			v.assert(t, actual, err)
+		})
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	payload := models.ChangePasswordPayload{
+		CurrentPassword: "okeoke",
+		NewPassword:     "newpassword",
+	}
+	tableTest := map[string]struct {
+		arrange  func()
+		assert   func(t *testing.T, err error)
+		teardown func()
+	}{
+		"success": {
+			arrange: func() {
+				urm.On("FindByID", mock.Anything, uint(1)).Return(&user, nil).Once()
+				services.CompareHashAndPassword = func(hash, plain string) error {
+					return nil
+				}
+				services.HashPassword = func(password string) (string, error) {
+					return "hashed", nil
+				}
+				urm.On("UpdatePassword", mock.Anything, uint(1), "hashed").Return(nil).Once()
+			},
+			assert: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+			teardown: func() {
+				services.CompareHashAndPassword = compareFunc
+				services.HashPassword = hashFunc
+			},
+		},
+		"wrong current password": {
+			arrange: func() {
+				urm.On("FindByID", mock.Anything, uint(1)).Return(&user, nil).Once()
+				services.CompareHashAndPassword = func(hash, plain string) error {
+					return errors.New("wrong password")
+				}
+			},
+			assert: func(t *testing.T, err error) {
+				require.Error(t, err)
+			},
+			teardown: func() {
+				services.CompareHashAndPassword = compareFunc
+			},
+		},
+		"bcrypt failed": {
+			arrange: func() {
+				urm.On("FindByID", mock.Anything, uint(1)).Return(&user, nil).Once()
+				services.CompareHashAndPassword = func(hash, plain string) error {
+					return nil
+				}
+				services.HashPassword = func(password string) (string, error) {
+					return "", errors.New("failed to hash")
+				}
+			},
+			assert: func(t *testing.T, err error) {
+				require.Error(t, err)
+			},
+			teardown: func() {
+				services.CompareHashAndPassword = compareFunc
+				services.HashPassword = hashFunc
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			err := userService.ChangePassword(context.Background(), uint(1), payload)
+
+			v.assert(t, err)
+
+			v.teardown()
+		})
+	}
+}
+
+func TestRequestEmailChange(t *testing.T) {
+	tableTest := map[string]struct {
+		email   string
+		arrange func()
+		assert  func(t *testing.T, err error)
+	}{
+		"success": {
+			email: "ryan@pujo.dev",
+			arrange: func() {
+				urm.On("FindByID", mock.Anything, uint(1)).Return(&user, nil).Once()
+				crm.On("IsReserved", mock.Anything, models.IdentifierEmail, "ryan@pujo.dev", uint(1)).Return(false, nil).Once()
+				urm.On("CreateEmailChange", mock.Anything, mock.MatchedBy(func(change models.EmailChange) bool {
+					return change.UserID == 1 && change.NewEmail == "ryan@pujo.dev" && change.TokenHash != ""
+				})).Return(nil).Once()
+				mm.On("Send", mock.Anything, mock.MatchedBy(func(msg mailer.Message) bool {
+					return msg.To == "ryan@pujo.dev"
+				})).Return(nil).Once()
+			},
+			assert: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		"same email": {
+			email: user.Credential.Email,
+			arrange: func() {
+				urm.On("FindByID", mock.Anything, uint(1)).Return(&user, nil).Once()
+			},
+			assert: func(t *testing.T, err error) {
+				require.ErrorIs(t, err, services.ErrSameEmail)
+			},
+		},
+		"email reserved": {
+			email: "ryan@pujo.dev",
+			arrange: func() {
+				urm.On("FindByID", mock.Anything, uint(1)).Return(&user, nil).Once()
+				crm.On("IsReserved", mock.Anything, models.IdentifierEmail, "ryan@pujo.dev", uint(1)).Return(true, nil).Once()
+			},
+			assert: func(t *testing.T, err error) {
+				require.ErrorIs(t, err, services.ErrIdentifierReserved)
+			},
+		},
+		"failed to store": {
+			email: "ryan@pujo.dev",
+			arrange: func() {
+				urm.On("FindByID", mock.Anything, uint(1)).Return(&user, nil).Once()
+				crm.On("IsReserved", mock.Anything, models.IdentifierEmail, "ryan@pujo.dev", uint(1)).Return(false, nil).Once()
+				urm.On("CreateEmailChange", mock.Anything, mock.Anything).Return(errors.New("failed")).Once()
+			},
+			assert: func(t *testing.T, err error) {
+				require.Error(t, err)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			err := userService.RequestEmailChange(context.Background(), uint(1), models.ChangeEmailPayload{Email: v.email})
+
+			v.assert(t, err)
+		})
+	}
+}
+
+func TestConfirmEmailChange(t *testing.T) {
+	tableTest := map[string]struct {
+		arrange func()
+		assert  func(t *testing.T, err error)
+	}{
+		"success": {
+			arrange: func() {
+				urm.On("ConfirmEmailChange", mock.Anything, uint(1), mock.Anything, mock.Anything).Return("ryan@pujo.dev", nil).Once()
+			},
+			assert: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+		},
+		"invalid token": {
+			arrange: func() {
+				urm.On("ConfirmEmailChange", mock.Anything, uint(1), mock.Anything, mock.Anything).Return("", errors.New("failed")).Once()
+			},
+			assert: func(t *testing.T, err error) {
+				require.Error(t, err)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			err := userService.ConfirmEmailChange(context.Background(), uint(1), models.ConfirmEmailPayload{Token: "token"})
+
+			v.assert(t, err)
+		})
+	}
+}
+
+func TestChangeUsername(t *testing.T) {
+	tableTest := map[string]struct {
+		username string
+		arrange  func()
+		assert   func(t *testing.T, actual *models.User, err error)
+	}{
+		"success": {
+			username: "pujo",
+			arrange: func() {
+				urm.On("FindByID", mock.Anything, uint(1)).Return(&user, nil).Twice()
+				crm.On("IsReserved", mock.Anything, models.IdentifierUsername, "pujo", uint(1)).Return(false, nil).Once()
+				urm.On("ChangeUsername", mock.Anything, uint(1), "pujo", mock.Anything).Return(nil).Once()
+				arm.On("List", mock.Anything).Return([]models.AttributeDefinition{}, nil).Once()
+			},
+			assert: func(t *testing.T, actual *models.User, err error) {
+				require.NoError(t, err)
+				require.NotNil(t, actual)
+			},
+		},
+		"same username": {
+			username: "ryanpujo",
+			arrange: func() {
+				urm.On("FindByID", mock.Anything, uint(1)).Return(&user, nil).Once()
+			},
+			assert: func(t *testing.T, actual *models.User, err error) {
+				require.ErrorIs(t, err, services.ErrSameUsername)
+				require.Nil(t, actual)
+			},
+		},
+		"username reserved": {
+			username: "pujo",
+			arrange: func() {
+				urm.On("FindByID", mock.Anything, uint(1)).Return(&user, nil).Once()
+				crm.On("IsReserved", mock.Anything, models.IdentifierUsername, "pujo", uint(1)).Return(true, nil).Once()
+			},
+			assert: func(t *testing.T, actual *models.User, err error) {
+				require.ErrorIs(t, err, services.ErrIdentifierReserved)
+				require.Nil(t, actual)
+			},
+		},
+		"rename failed": {
+			username: "pujo",
+			arrange: func() {
+				urm.On("FindByID", mock.Anything, uint(1)).Return(&user, nil).Once()
+				crm.On("IsReserved", mock.Anything, models.IdentifierUsername, "pujo", uint(1)).Return(false, nil).Once()
+				urm.On("ChangeUsername", mock.Anything, uint(1), "pujo", mock.Anything).Return(errors.New("taken")).Once()
+			},
+			assert: func(t *testing.T, actual *models.User, err error) {
+				require.Error(t, err)
+				require.Nil(t, actual)
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			actual, err := userService.ChangeUsername(context.Background(), uint(1), models.ChangeUsernamePayload{Username: v.username})
+
+			v.assert(t, actual, err)
+		})
+	}
+}
+
+func TestCloseAccount(t *testing.T) {
+	payload := models.CloseAccountPayload{Password: "okeoke"}
+	tableTest := map[string]struct {
+		arrange  func()
+		assert   func(t *testing.T, err error)
+		teardown func()
+	}{
+		"success": {
+			arrange: func() {
+				urm.On("FindByID", mock.Anything, uint(1)).Return(&user, nil).Once()
+				services.CompareHashAndPassword = func(hash, plain string) error {
+					return nil
+				}
+				urm.On("Close", mock.Anything, uint(1)).Return(nil).Once()
+				srm.On("RevokeAll", mock.Anything, uint(1)).Return(nil).Once()
+				krm.On("DeleteAll", mock.Anything, uint(1)).Return(nil).Once()
+			},
+			assert: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+			teardown: func() {
+				services.CompareHashAndPassword = compareFunc
+			},
+		},
+		"wrong password": {
+			arrange: func() {
+				urm.On("FindByID", mock.Anything, uint(1)).Return(&user, nil).Once()
+				services.CompareHashAndPassword = func(hash, plain string) error {
+					return errors.New("wrong password")
+				}
+			},
+			assert: func(t *testing.T, err error) {
+				require.Error(t, err)
+			},
+			teardown: func() {
+				services.CompareHashAndPassword = compareFunc
+			},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			err := userService.CloseAccount(context.Background(), uint(1), payload)
+
+			v.assert(t, err)
+
+			v.teardown()
+		})
+	}
+}
+
+// sessionStore keeps the revocation of sessions, so a session checked after
+// RevokeAll is no longer active.
+type sessionStore struct {
+	SessionRepoMock
+	revoked bool
+}
+
+func (ss *sessionStore) FindActive(ctx context.Context, userID uint, id string) (*models.Session, error) {
+	if ss.revoked {
+		return nil, sql.ErrNoRows
+	}
+	return &models.Session{ID: id, UserID: userID, LastSeenAt: time.Now()}, nil
+}
+
+func (ss *sessionStore) RevokeAll(ctx context.Context, userID uint) error {
+	ss.revoked = true
+	return nil
+}
+
+func TestCloseAccountEndsSessions(t *testing.T) {
+	services.CompareHashAndPassword = func(hash, plain string) error {
+		return nil
+	}
+	defer func() { services.CompareHashAndPassword = compareFunc }()
+
+	store := new(sessionStore)
+	krm := new(APIKeyRepoMock)
+	userService := services.NewUserService(crm, urm, arm, store, krm, lgm, mm, aud)
+	sessionService := services.NewSessionService(store, aud)
+	urm.On("FindByID", mock.Anything, uint(1)).Return(&user, nil).Once()
+	urm.On("Close", mock.Anything, uint(1)).Return(nil).Once()
+	krm.On("DeleteAll", mock.Anything, uint(1)).Return(nil).Once()
+
+	require.NoError(t, sessionService.Check(context.Background(), 1, "current"))
+
+	err := userService.CloseAccount(context.Background(), 1, models.CloseAccountPayload{Password: "okeoke"})
+	require.NoError(t, err)
+
+	// The token of the session is refused from now on, and so are the API keys.
+	require.ErrorIs(t, sessionService.Check(context.Background(), 1, "current"), sql.ErrNoRows)
+	krm.AssertExpectations(t)
+}
+
+func TestRestore(t *testing.T) {
+	tableTest := map[string]struct {
+		payload  models.LoginPayload
+		arrange  func()
+		assert   func(t *testing.T, err error)
+		teardown func()
+	}{
+		"success by username": {
+			payload: models.LoginPayload{Identifier: "RyanPujo", Password: "okeoke"},
+			arrange: func() {
+				crm.On("FindClosed", mock.Anything, "ryanpujo").Return(&user, nil).Once()
+				lgm.On("CheckPassword", mock.Anything, uint(1)).Return(nil).Once()
+				services.CompareHashAndPassword = func(hash, plain string) error {
+					return nil
+				}
+				urm.On("Restore", mock.Anything, uint(1), mock.AnythingOfType("time.Time")).Return(nil).Once()
+			},
+			assert: func(t *testing.T, err error) {
+				require.NoError(t, err)
+			},
+			teardown: func() {
+				services.CompareHashAndPassword = compareFunc
+			},
+		},
+		"grace period ended": {
+			payload: models.LoginPayload{Identifier: "Ryanpujo@Gmail.com", Password: "okeoke"},
+			arrange: func() {
+				crm.On("FindClosed", mock.Anything, "ryanpujo@gmail.com").Return(&user, nil).Once()
+				lgm.On("CheckPassword", mock.Anything, uint(1)).Return(nil).Once()
+				services.CompareHashAndPassword = func(hash, plain string) error {
+					return nil
+				}
+				urm.On("Restore", mock.Anything, uint(1), mock.AnythingOfType("time.Time")).Return(sql.ErrNoRows).Once()
+			},
+			assert: func(t *testing.T, err error) {
+				require.ErrorIs(t, err, sql.ErrNoRows)
+			},
+			teardown: func() {
+				services.CompareHashAndPassword = compareFunc
+			},
+		},
+		"wrong password": {
+			payload: models.LoginPayload{Identifier: "ryanpujo", Password: "wrong"},
+			arrange: func() {
+				crm.On("FindClosed", mock.Anything, "ryanpujo").Return(&user, nil).Once()
+				lgm.On("CheckPassword", mock.Anything, uint(1)).Return(nil).Once()
+				services.CompareHashAndPassword = func(hash, plain string) error {
+					return errors.New("wrong password")
+				}
+			},
+			assert: func(t *testing.T, err error) {
+				require.Error(t, err)
+			},
+			teardown: func() {
+				services.CompareHashAndPassword = compareFunc
+			},
+		},
+		"too many failures": {
+			payload: models.LoginPayload{Identifier: "ryanpujo", Password: "okeoke"},
+			arrange: func() {
+				crm.On("FindClosed", mock.Anything, "ryanpujo").Return(&user, nil).Once()
+				lgm.On("CheckPassword", mock.Anything, uint(1)).Return(services.ErrLoginBlocked).Once()
+				services.CompareHashAndPassword = func(hash, plain string) error {
+					panic("password compared after too many failures")
+				}
+			},
+			assert: func(t *testing.T, err error) {
+				require.ErrorIs(t, err, services.ErrLoginBlocked)
+				require.Equal(t, models.AuditAccountRestore, aud.last().Action)
+			},
+			teardown: func() {
+				services.CompareHashAndPassword = compareFunc
+			},
+		},
+		"not closed": {
+			payload: models.LoginPayload{Identifier: "ryanpujo", Password: "okeoke"},
+			arrange: func() {
+				crm.On("FindClosed", mock.Anything, "ryanpujo").Return((*models.User)(nil), sql.ErrNoRows).Once()
+			},
+			assert: func(t *testing.T, err error) {
+				require.ErrorIs(t, err, sql.ErrNoRows)
+			},
+			teardown: func() {},
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			v.arrange()
+
+			err := userService.Restore(context.Background(), &v.payload)
+
+			v.assert(t, err)
+
+			v.teardown()
+		})
+	}
+}
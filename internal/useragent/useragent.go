@@ -0,0 +1,58 @@
+// Package useragent derives a human readable device description from User-Agent headers.
+// It only recognizes the common browsers and platforms, anything else is reported as "Other".
+package useragent
+
+import "strings"
+
+// Other is reported for browsers and platforms that are not recognized.
+const Other = "Other"
+
+// families are checked in order, browsers embedding the name of another one come first.
+var families = []struct{ token, name string }{
+	{"Edg/", "Edge"},
+	{"OPR/", "Opera"},
+	{"Firefox/", "Firefox"},
+	{"Chrome/", "Chrome"},
+	{"Safari/", "Safari"},
+	{"curl/", "curl"},
+	{"Go-http-client/", "Go"},
+	{"okhttp/", "okhttp"},
+}
+
+var platforms = []struct{ token, name string }{
+	{"Android", "Android"},
+	{"iPhone", "iOS"},
+	{"iPad", "iPadOS"},
+	{"Windows", "Windows"},
+	{"Mac OS X", "macOS"},
+	{"CrOS", "ChromeOS"},
+	{"Linux", "Linux"},
+}
+
+// Family returns the browser or client family of ua, such as "Firefox".
+func Family(ua string) string {
+	return match(ua, families)
+}
+
+// Platform returns the operating system of ua, such as "Linux".
+func Platform(ua string) string {
+	return match(ua, platforms)
+}
+
+// Describe returns a short description of the device sending ua, such as "Firefox on Linux".
+func Describe(ua string) string {
+	family, platform := Family(ua), Platform(ua)
+	if platform == Other {
+		return family
+	}
+	return family + " on " + platform
+}
+
+func match(ua string, candidates []struct{ token, name string }) string {
+	for _, c := range candidates {
+		if strings.Contains(ua, c.token) {
+			return c.name
+		}
+	}
+	return Other
+}
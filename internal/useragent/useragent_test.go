@@ -0,0 +1,46 @@
+package useragent_test
+
+import (
+	"testing"
+
+	"github.com/ryanpujo/melius/internal/useragent"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDescribe(t *testing.T) {
+	tableTest := map[string]struct {
+		ua       string
+		expected string
+	}{
+		"firefox on linux": {
+			ua:       "Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0",
+			expected: "Firefox on Linux",
+		},
+		"chrome on android": {
+			ua:       "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Mobile Safari/537.36",
+			expected: "Chrome on Android",
+		},
+		"edge on windows": {
+			ua:       "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36 Edg/126.0.0.0",
+			expected: "Edge on Windows",
+		},
+		"safari on ios": {
+			ua:       "Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1",
+			expected: "Safari on iOS",
+		},
+		"curl": {
+			ua:       "curl/8.5.0",
+			expected: "curl",
+		},
+		"empty": {
+			ua:       "",
+			expected: useragent.Other,
+		},
+	}
+
+	for k, v := range tableTest {
+		t.Run(k, func(t *testing.T) {
+			require.Equal(t, v.expected, useragent.Describe(v.ua))
+		})
+	}
+}
@@ -3,6 +3,7 @@ package utilities
 type Response struct {
 	ID      uint   `json:"id,omitempty"`
 	Token   string `json:"token,omitempty"`
+	Data    any    `json:"data,omitempty"`
 	Err     string `json:"err,omitempty"`
 	Message string `json:"message,omitempty"`
 }
@@ -0,0 +1,5 @@
+// Package meliusv1 holds the messages and gRPC service of the melius API, generated
+// from the definitions in this directory with buf.
+package meliusv1
+
+//go:generate sh -c "cd ../../.. && buf generate"
@@ -0,0 +1,19 @@
+package registry
+
+import (
+	"github.com/ryanpujo/melius/internal/controllers"
+	"github.com/ryanpujo/melius/internal/repositories"
+	"github.com/ryanpujo/melius/internal/services"
+)
+
+func (r *Registry) GetAPIKeyRepo() repositories.APIKeyInterface {
+	return repositories.NewAPIKeyRepo(r.db)
+}
+
+func (r *Registry) GetAPIKeyService() services.APIKeyInterface {
+	return services.NewAPIKeyService(r.GetAPIKeyRepo(), r.GetUserRepo(), r.GetAuditService())
+}
+
+func (r *Registry) GetAPIKeyController() *controllers.APIKeyController {
+	return controllers.NewAPIKeyController(r.GetAPIKeyService())
+}
@@ -0,0 +1,19 @@
+package registry
+
+import (
+	"github.com/ryanpujo/melius/internal/controllers"
+	"github.com/ryanpujo/melius/internal/repositories"
+	"github.com/ryanpujo/melius/internal/services"
+)
+
+func (r *Registry) GetAttributeRepo() repositories.AttributeInterface {
+	return repositories.NewAttributeRepo(r.db)
+}
+
+func (r *Registry) GetAttributeService() services.AttributeInterface {
+	return services.NewAttributeService(r.GetAttributeRepo(), r.GetAuditService())
+}
+
+func (r *Registry) GetAttributeController() *controllers.AttributeController {
+	return controllers.NewAttributeController(r.GetAttributeService())
+}
@@ -0,0 +1,19 @@
+package registry
+
+import (
+	"github.com/ryanpujo/melius/internal/controllers"
+	"github.com/ryanpujo/melius/internal/repositories"
+	"github.com/ryanpujo/melius/internal/services"
+)
+
+func (r *Registry) GetAuditRepo() repositories.AuditInterface {
+	return repositories.NewAuditRepo(r.db)
+}
+
+func (r *Registry) GetAuditService() services.AuditInterface {
+	return services.NewAuditService(r.GetAuditRepo())
+}
+
+func (r *Registry) GetAuditController() *controllers.AuditController {
+	return controllers.NewAuditController(r.GetAuditService())
+}
@@ -11,9 +11,9 @@ func (r *Registry) GetCredentialRepo() repositories.CredentialInterface {
 }
 
 func (r *Registry) GetCredentialService() services.CredentialInterface {
-	return services.NewCredentialService(r.GetCredentialRepo())
+	return services.NewCredentialService(r.GetCredentialRepo(), r.GetUserRepo(), r.GetAttributeRepo(), r.GetSessionRepo(), r.GetLoginGuard(), r.GetAuditService())
 }
 
 func (r *Registry) GetCredentialController() *controllers.CredentialController {
-	return controllers.NewCredentialController(r.GetCredentialService())
+	return controllers.NewCredentialController(r.GetCredentialService(), r.GetAuthCookie())
 }
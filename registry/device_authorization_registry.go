@@ -0,0 +1,19 @@
+package registry
+
+import (
+	"github.com/ryanpujo/melius/internal/controllers"
+	"github.com/ryanpujo/melius/internal/repositories"
+	"github.com/ryanpujo/melius/internal/services"
+)
+
+func (r *Registry) GetDeviceAuthorizationRepo() repositories.DeviceAuthorizationInterface {
+	return repositories.NewDeviceAuthorizationRepo(r.db)
+}
+
+func (r *Registry) GetDeviceAuthorizationService() services.DeviceAuthorizationInterface {
+	return services.NewDeviceAuthorizationService(r.GetDeviceAuthorizationRepo(), r.GetCredentialService(), r.GetAuditService())
+}
+
+func (r *Registry) GetDeviceAuthorizationController() *controllers.DeviceAuthorizationController {
+	return controllers.NewDeviceAuthorizationController(r.GetDeviceAuthorizationService())
+}
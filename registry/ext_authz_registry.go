@@ -0,0 +1,19 @@
+package registry
+
+import (
+	authv3 "github.com/envoyproxy/go-control-plane/envoy/service/auth/v3"
+	"github.com/ryanpujo/melius/internal/extauthz"
+	"github.com/ryanpujo/melius/internal/jwttoken"
+	"google.golang.org/grpc"
+)
+
+// GetExtAuthzServer returns the gRPC server of the Envoy external authorization
+// service, authenticating requests with the options of the HTTP middleware.
+func (r *Registry) GetExtAuthzServer() *grpc.Server {
+	server := grpc.NewServer()
+	authv3.RegisterAuthorizationServer(server, extauthz.NewServer(
+		jwttoken.NewAuthenticator(r.GetAuthOptions()...),
+		r.GetForwardAuthService(),
+	))
+	return server
+}
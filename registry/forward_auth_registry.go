@@ -0,0 +1,14 @@
+package registry
+
+import (
+	"github.com/ryanpujo/melius/internal/controllers"
+	"github.com/ryanpujo/melius/internal/services"
+)
+
+func (r *Registry) GetForwardAuthService() services.ForwardAuthInterface {
+	return services.NewForwardAuthService(r.GetUserRepo())
+}
+
+func (r *Registry) GetForwardAuthController() *controllers.ForwardAuthController {
+	return controllers.NewForwardAuthController(r.GetForwardAuthService())
+}
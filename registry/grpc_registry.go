@@ -0,0 +1,18 @@
+package registry
+
+import (
+	"github.com/ryanpujo/melius/config"
+	"github.com/ryanpujo/melius/internal/grpcapi"
+	"github.com/ryanpujo/melius/internal/jwttoken"
+	"google.golang.org/grpc"
+)
+
+// GetGRPCServer returns the gRPC server of the API, authenticating calls with the
+// options of the HTTP middleware.
+func (r *Registry) GetGRPCServer() *grpc.Server {
+	return grpcapi.NewServer(
+		r.GetCredentialService(),
+		jwttoken.NewAuthenticator(r.GetAuthOptions()...),
+		config.Config().ReauthMaxAge,
+	)
+}
@@ -0,0 +1,25 @@
+package registry
+
+import (
+	"github.com/ryanpujo/melius/internal/repositories"
+	"github.com/ryanpujo/melius/internal/services"
+)
+
+func (r *Registry) GetDeviceRepo() repositories.DeviceInterface {
+	return repositories.NewDeviceRepo(r.db)
+}
+
+func (r *Registry) GetChallengeRepo() repositories.ChallengeInterface {
+	return repositories.NewChallengeRepo(r.db)
+}
+
+func (r *Registry) GetLoginGuard() services.LoginGuard {
+	return services.NewLoginGuardService(
+		r.GetUserRepo(),
+		r.GetDeviceRepo(),
+		r.GetChallengeRepo(),
+		r.GetSessionRepo(),
+		r.GetAuditRepo(),
+		r.GetMailer(),
+	)
+}
@@ -0,0 +1,19 @@
+package registry
+
+import (
+	"github.com/ryanpujo/melius/internal/controllers"
+	"github.com/ryanpujo/melius/internal/repositories"
+	"github.com/ryanpujo/melius/internal/services"
+)
+
+func (r *Registry) GetPolicyRepo() repositories.PolicyInterface {
+	return repositories.NewPolicyRepo(r.db)
+}
+
+func (r *Registry) GetPolicyService() *services.PolicyService {
+	return services.NewPolicyService(r.GetPolicyRepo(), r.GetUserRepo(), r.GetAuditService(), r.policies)
+}
+
+func (r *Registry) GetPolicyController() *controllers.PolicyController {
+	return controllers.NewPolicyController(r.GetPolicyService())
+}
@@ -0,0 +1,29 @@
+package registry
+
+import (
+	"github.com/ryanpujo/melius/internal/controllers"
+	"github.com/ryanpujo/melius/internal/repositories"
+	"github.com/ryanpujo/melius/internal/services"
+)
+
+func (r *Registry) GetPrivacyRepo() repositories.PrivacyInterface {
+	return repositories.NewPrivacyRepo(r.db)
+}
+
+// GetDataSources returns the stores of personal data taking part in exports and erasures.
+func (r *Registry) GetDataSources() []services.DataSource {
+	return []services.DataSource{
+		services.NewAuditSource(r.GetAuditRepo()),
+		services.NewSessionSource(r.GetSessionRepo()),
+		services.NewDeviceSource(r.GetDeviceRepo()),
+		services.NewAPIKeySource(r.GetAPIKeyRepo()),
+	}
+}
+
+func (r *Registry) GetPrivacyService() services.PrivacyInterface {
+	return services.NewPrivacyService(r.GetUserRepo(), r.GetPrivacyRepo(), r.GetAuditService(), r.GetDataSources()...)
+}
+
+func (r *Registry) GetPrivacyController() *controllers.PrivacyController {
+	return controllers.NewPrivacyController(r.GetPrivacyService())
+}
@@ -3,21 +3,41 @@ package registry
 import (
 	"database/sql"
 
+	"github.com/ryanpujo/melius/config"
 	"github.com/ryanpujo/melius/internal/adapter"
+	"github.com/ryanpujo/melius/internal/jwttoken"
+	"github.com/ryanpujo/melius/internal/services"
 )
 
 type Registry struct {
-	db *sql.DB
+	db       *sql.DB
+	replay   jwttoken.ReplayCache
+	policies *services.PolicySet
 }
 
 func NewRegistry(db *sql.DB) *Registry {
 	return &Registry{
-		db: db,
+		db:       db,
+		replay:   jwttoken.NewReplayCache(),
+		policies: services.NewPolicySet(),
 	}
 }
 
 func (r *Registry) NewAppControllers() *adapter.Adapter {
 	return &adapter.Adapter{
-		CredentialController: r.GetCredentialController(),
+		CredentialController:          r.GetCredentialController(),
+		UserController:                r.GetUserController(),
+		AttributeController:           r.GetAttributeController(),
+		PrivacyController:             r.GetPrivacyController(),
+		AuditController:               r.GetAuditController(),
+		SessionController:             r.GetSessionController(),
+		APIKeyController:              r.GetAPIKeyController(),
+		ServiceAccountController:      r.GetServiceAccountController(),
+		TokenController:               r.GetTokenController(),
+		DeviceAuthorizationController: r.GetDeviceAuthorizationController(),
+		ForwardAuthController:         r.GetForwardAuthController(),
+		PolicyController:              r.GetPolicyController(),
+		AuthOptions:                   r.GetAuthOptions(),
+		ReauthMaxAge:                  config.Config().ReauthMaxAge,
 	}
 }
@@ -0,0 +1,23 @@
+package registry
+
+import (
+	"github.com/ryanpujo/melius/internal/controllers"
+	"github.com/ryanpujo/melius/internal/repositories"
+	"github.com/ryanpujo/melius/internal/services"
+)
+
+func (r *Registry) GetServiceAccountRepo() repositories.ServiceAccountInterface {
+	return repositories.NewServiceAccountRepo(r.db)
+}
+
+func (r *Registry) GetServiceAccountService() services.ServiceAccountInterface {
+	return services.NewServiceAccountService(r.GetServiceAccountRepo(), r.GetSessionRepo(), r.GetAuditService(), r.replay)
+}
+
+func (r *Registry) GetServiceAccountController() *controllers.ServiceAccountController {
+	return controllers.NewServiceAccountController(r.GetServiceAccountService())
+}
+
+func (r *Registry) GetTokenController() *controllers.TokenController {
+	return controllers.NewTokenController(r.GetServiceAccountService(), r.GetDeviceAuthorizationService(), r.replay)
+}
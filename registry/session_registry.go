@@ -0,0 +1,48 @@
+package registry
+
+import (
+	"github.com/ryanpujo/melius/config"
+	"github.com/ryanpujo/melius/internal/controllers"
+	"github.com/ryanpujo/melius/internal/jwttoken"
+	"github.com/ryanpujo/melius/internal/repositories"
+	"github.com/ryanpujo/melius/internal/services"
+)
+
+func (r *Registry) GetSessionRepo() repositories.SessionInterface {
+	return repositories.NewSessionRepo(r.db)
+}
+
+func (r *Registry) GetSessionService() services.SessionInterface {
+	return services.NewSessionService(r.GetSessionRepo(), r.GetAuditService())
+}
+
+func (r *Registry) GetSessionController() *controllers.SessionController {
+	return controllers.NewSessionController(r.GetSessionService())
+}
+
+// GetAuthOptions returns the options of the authentication middleware.
+func (r *Registry) GetAuthOptions() []jwttoken.Option {
+	opts := []jwttoken.Option{
+		jwttoken.WithSessionChecker(r.GetSessionService().Check),
+		jwttoken.WithAPIKeys(r.GetAPIKeyService().Authenticate),
+		jwttoken.WithServiceAccountChecker(r.GetServiceAccountService().Check),
+		jwttoken.WithReplayCache(r.replay),
+	}
+	if cookie := r.GetAuthCookie(); cookie != nil {
+		opts = append(opts, jwttoken.WithCookie(cookie.Name, config.Config().AuthTransports...))
+	}
+	return opts
+}
+
+// GetAuthCookie returns the cookie transport of access tokens, nil when it is disabled.
+func (r *Registry) GetAuthCookie() *jwttoken.Cookie {
+	conf := config.Config()
+	if !conf.AuthCookieEnabled {
+		return nil
+	}
+	return &jwttoken.Cookie{
+		Name:     conf.AuthCookieName,
+		Secure:   conf.AuthCookieSecure,
+		SameSite: jwttoken.ParseSameSite(conf.AuthCookieSameSite),
+	}
+}
@@ -0,0 +1,37 @@
+package registry
+
+import (
+	"github.com/ryanpujo/melius/internal/controllers"
+	"github.com/ryanpujo/melius/internal/mailer"
+	"github.com/ryanpujo/melius/internal/repositories"
+	"github.com/ryanpujo/melius/internal/services"
+)
+
+func (r *Registry) GetUserRepo() repositories.UserInterface {
+	return repositories.NewUserRepo(r.db)
+}
+
+func (r *Registry) GetMailer() mailer.Mailer {
+	return mailer.NewMailer()
+}
+
+func (r *Registry) GetUserService() services.UserInterface {
+	return services.NewUserService(
+		r.GetCredentialRepo(),
+		r.GetUserRepo(),
+		r.GetAttributeRepo(),
+		r.GetSessionRepo(),
+		r.GetAPIKeyRepo(),
+		r.GetLoginGuard(),
+		r.GetMailer(),
+		r.GetAuditService(),
+	)
+}
+
+func (r *Registry) GetUserController() *controllers.UserController {
+	return controllers.NewUserController(r.GetUserService())
+}
+
+func (r *Registry) GetPurgeService() *services.PurgeService {
+	return services.NewPurgeService(r.GetUserRepo())
+}
@@ -0,0 +1,32 @@
+-- Lets a username change cascade from credentials to users, keys pending email
+-- changes by the immutable user id and adds the identifier history table.
+-- Pending email changes are short lived and are dropped by this migration.
+
+ALTER TABLE users DROP CONSTRAINT users_username_fkey;
+ALTER TABLE users ADD CONSTRAINT users_username_fkey
+    FOREIGN KEY (username) REFERENCES credentials (username) ON DELETE CASCADE ON UPDATE CASCADE;
+
+DROP TABLE IF EXISTS email_changes;
+
+CREATE TABLE email_changes (
+    id SERIAL PRIMARY KEY,
+    user_id INT UNIQUE NOT NULL,
+    new_email VARCHAR(255) NOT NULL,
+    token_hash TEXT NOT NULL,
+    expires_at timestamp NOT NULL,
+    created_at timestamp,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE identifier_history (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL,
+    kind VARCHAR(20) NOT NULL,
+    old_value VARCHAR(255) NOT NULL,
+    new_value VARCHAR(255) NOT NULL,
+    changed_at timestamp NOT NULL,
+    reserved_until timestamp NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX identifier_history_lookup ON identifier_history (kind, old_value, reserved_until);
@@ -0,0 +1,24 @@
+-- Adds case-insensitive unique indexes on usernames and emails.
+-- Run `go run ./cmd/canonicalize -apply` first: it rewrites existing identifiers to
+-- their canonical form and refuses to do so while collisions exist. The check below
+-- aborts this migration if case-only duplicates are still present.
+
+DO $$
+DECLARE
+    collisions TEXT;
+BEGIN
+    SELECT string_agg(names, '; ') INTO collisions FROM (
+        SELECT string_agg(username, ', ') AS names FROM credentials
+        GROUP BY lower(username) HAVING count(*) > 1
+        UNION ALL
+        SELECT string_agg(email, ', ') AS names FROM credentials
+        GROUP BY lower(email) HAVING count(*) > 1
+    ) c;
+
+    IF collisions IS NOT NULL THEN
+        RAISE EXCEPTION 'identifier collisions must be resolved first: %', collisions;
+    END IF;
+END $$;
+
+CREATE UNIQUE INDEX credentials_username_ci ON credentials (lower(username));
+CREATE UNIQUE INDEX credentials_email_ci ON credentials (lower(email));
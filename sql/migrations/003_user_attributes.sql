@@ -0,0 +1,23 @@
+-- Adds custom user attributes, their admin-defined schema and user roles.
+-- Grant the first administrator manually:
+--   INSERT INTO user_roles (user_id, role) VALUES (<user id>, 'admin');
+
+ALTER TABLE users ADD COLUMN attributes JSONB NOT NULL DEFAULT '{}';
+
+CREATE TABLE user_roles (
+    user_id INT NOT NULL,
+    role VARCHAR(50) NOT NULL,
+    PRIMARY KEY (user_id, role),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE attribute_definitions (
+    name VARCHAR(100) PRIMARY KEY,
+    type VARCHAR(20) NOT NULL,
+    required BOOLEAN NOT NULL DEFAULT FALSE,
+    pattern TEXT NOT NULL DEFAULT '',
+    visibility VARCHAR(20) NOT NULL,
+    claim BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at timestamp,
+    updated_at timestamp
+);
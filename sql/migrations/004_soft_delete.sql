@@ -0,0 +1,7 @@
+-- Adds soft deletion of users. Closed accounts keep their rows until the purger
+-- hard-deletes or anonymizes them after the retention window.
+
+ALTER TABLE users ADD COLUMN deleted_at timestamp;
+ALTER TABLE users ADD COLUMN purged_at timestamp;
+
+CREATE INDEX users_deleted_at ON users (deleted_at) WHERE deleted_at IS NOT NULL AND purged_at IS NULL;
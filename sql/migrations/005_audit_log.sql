@@ -0,0 +1,45 @@
+-- Adds the audit log of security-relevant events.
+
+-- The audit log is append-only. Entries keep actor and subject IDs without foreign keys
+-- so they outlive purged users; only the personal fields can be erased, which the
+-- trigger below enforces.
+CREATE TABLE audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    occurred_at timestamp NOT NULL,
+    actor_id INT,
+    subject_id INT,
+    action VARCHAR(100) NOT NULL,
+    outcome VARCHAR(20) NOT NULL,
+    ip VARCHAR(64),
+    user_agent TEXT,
+    request_id VARCHAR(64) NOT NULL DEFAULT '',
+    details JSONB NOT NULL DEFAULT '{}',
+    salt VARCHAR(64),
+    personal_digest VARCHAR(64) NOT NULL,
+    prev_hash VARCHAR(64) NOT NULL,
+    hash VARCHAR(64) NOT NULL
+);
+
+CREATE INDEX audit_log_actor ON audit_log (actor_id, id);
+CREATE INDEX audit_log_subject ON audit_log (subject_id, id);
+CREATE INDEX audit_log_action ON audit_log (action, id);
+
+CREATE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'UPDATE'
+        AND NEW.ip IS NULL AND NEW.user_agent IS NULL AND NEW.salt IS NULL
+        AND (NEW.id, NEW.occurred_at, NEW.actor_id, NEW.subject_id, NEW.action, NEW.outcome,
+             NEW.request_id, NEW.details, NEW.personal_digest, NEW.prev_hash, NEW.hash)
+            IS NOT DISTINCT FROM
+            (OLD.id, OLD.occurred_at, OLD.actor_id, OLD.subject_id, OLD.action, OLD.outcome,
+             OLD.request_id, OLD.details, OLD.personal_digest, OLD.prev_hash, OLD.hash)
+    THEN
+        RETURN NEW;
+    END IF;
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_append_only
+    BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
@@ -0,0 +1,17 @@
+-- Adds login sessions. Access tokens carry the session id as their sid claim and
+-- are rejected once the session is revoked.
+
+CREATE TABLE sessions (
+    id VARCHAR(64) PRIMARY KEY,
+    user_id INT NOT NULL,
+    device VARCHAR(100) NOT NULL,
+    user_agent TEXT NOT NULL,
+    ip VARCHAR(64) NOT NULL,
+    created_at timestamp NOT NULL,
+    last_seen_at timestamp NOT NULL,
+    expires_at timestamp NOT NULL,
+    revoked_at timestamp,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX sessions_user ON sessions (user_id, created_at);
@@ -0,0 +1,25 @@
+-- Adds the devices users log in from and the logins held for step-up verification.
+-- Devices are recognized by a long-lived cookie, only its hash is stored.
+
+CREATE TABLE devices (
+    user_id INT NOT NULL,
+    device_hash VARCHAR(64) NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    family VARCHAR(50) NOT NULL,
+    last_ip VARCHAR(64) NOT NULL,
+    first_seen timestamp NOT NULL,
+    last_seen timestamp NOT NULL,
+    PRIMARY KEY (user_id, device_hash),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE login_challenges (
+    id VARCHAR(64) PRIMARY KEY,
+    user_id INT NOT NULL,
+    code_hash VARCHAR(64) NOT NULL,
+    device_hash VARCHAR(64) NOT NULL,
+    expires_at timestamp NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    created_at timestamp NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
@@ -0,0 +1,17 @@
+-- Adds API keys. Keys are sent as "Authorization: ApiKey <key>", only their
+-- SHA-256 hash is stored. Scopes are stored space separated.
+
+CREATE TABLE api_keys (
+    id VARCHAR(32) PRIMARY KEY,
+    user_id INT NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    prefix VARCHAR(40) NOT NULL,
+    key_hash VARCHAR(64) NOT NULL UNIQUE,
+    scopes TEXT NOT NULL,
+    created_at timestamp NOT NULL,
+    expires_at timestamp,
+    last_used_at timestamp,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX api_keys_user ON api_keys (user_id, created_at);
@@ -0,0 +1,34 @@
+-- Adds service accounts, non-human principals owned by the deployment rather than a user.
+-- They authenticate at /oauth/token with a client secret, of which only the SHA-256 hash
+-- is stored, or with a JWT signed by the private key of a registered public key.
+
+CREATE TABLE service_accounts (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL UNIQUE,
+    description VARCHAR(500) NOT NULL DEFAULT '',
+    disabled BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at timestamp NOT NULL,
+    updated_at timestamp NOT NULL
+);
+
+CREATE TABLE service_account_roles (
+    service_account_id INT NOT NULL,
+    role VARCHAR(50) NOT NULL,
+    PRIMARY KEY (service_account_id, role),
+    FOREIGN KEY (service_account_id) REFERENCES service_accounts (id) ON DELETE CASCADE
+);
+
+CREATE TABLE service_account_credentials (
+    id VARCHAR(32) PRIMARY KEY,
+    service_account_id INT NOT NULL,
+    type VARCHAR(20) NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    secret_hash VARCHAR(64) UNIQUE,
+    public_key TEXT,
+    created_at timestamp NOT NULL,
+    expires_at timestamp,
+    last_used_at timestamp,
+    FOREIGN KEY (service_account_id) REFERENCES service_accounts (id) ON DELETE CASCADE
+);
+
+CREATE INDEX service_account_credentials_account ON service_account_credentials (service_account_id, created_at);
@@ -0,0 +1,4 @@
+-- Adds impersonation. Sessions opened by an administrator impersonating a user record
+-- the administrator, so the user sees them among their sessions and logins.
+
+ALTER TABLE sessions ADD COLUMN actor_id INT REFERENCES users (id) ON DELETE SET NULL;
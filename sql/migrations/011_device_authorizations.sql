@@ -0,0 +1,19 @@
+-- Adds the device authorization grant of RFC 8628, letting devices without a browser
+-- obtain tokens once a logged-in user approves their user code. Only the SHA-256 hash
+-- of device codes is stored, expired authorizations are removed as new ones are created.
+
+CREATE TABLE device_authorizations (
+    device_code_hash VARCHAR(64) PRIMARY KEY,
+    user_code VARCHAR(8) NOT NULL UNIQUE,
+    client_id VARCHAR(100) NOT NULL,
+    scope VARCHAR(500) NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL,
+    user_id INT,
+    poll_interval INT NOT NULL,
+    created_at timestamp NOT NULL,
+    expires_at timestamp NOT NULL,
+    last_polled_at timestamp,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX device_authorizations_expires_at ON device_authorizations (expires_at);
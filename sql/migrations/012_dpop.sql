@@ -0,0 +1,4 @@
+-- Lets administrators require DPoP from a service account, so every token it
+-- obtains is bound to its key and worthless to anyone who steals it.
+
+ALTER TABLE service_accounts ADD COLUMN require_dpop BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,11 @@
+-- Adds authorization policies, CEL expressions over the principal, the resource and
+-- the environment of a request, evaluated by name. Running instances reload them
+-- periodically, so changes made through one instance reach the others.
+
+CREATE TABLE policies (
+    name VARCHAR(100) PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT '',
+    expression TEXT NOT NULL,
+    created_at timestamp NOT NULL,
+    updated_at timestamp NOT NULL
+);
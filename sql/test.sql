@@ -7,12 +7,217 @@ CREATE TABLE credentials (
     updated_at timestamp
 );
 
+-- Identifiers are stored canonicalized by the application; these indexes guard
+-- against case-only duplicates written by anything else.
+CREATE UNIQUE INDEX credentials_username_ci ON credentials (lower(username));
+CREATE UNIQUE INDEX credentials_email_ci ON credentials (lower(email));
+
 CREATE TABLE users (
     id SERIAL PRIMARY KEY,
     first_name VARCHAR(100) NOT NULL,
     last_name VARCHAR(100) NOT NULL,
     username VARCHAR(100) NOT NULL,
+    attributes JSONB NOT NULL DEFAULT '{}',
     created_at timestamp,
     updated_at timestamp,
-    FOREIGN KEY (username) REFERENCES credentials (username) ON DELETE CASCADE
+    deleted_at timestamp,
+    purged_at timestamp,
+    FOREIGN KEY (username) REFERENCES credentials (username) ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE INDEX users_deleted_at ON users (deleted_at) WHERE deleted_at IS NOT NULL AND purged_at IS NULL;
+
+CREATE TABLE user_roles (
+    user_id INT NOT NULL,
+    role VARCHAR(50) NOT NULL,
+    PRIMARY KEY (user_id, role),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE attribute_definitions (
+    name VARCHAR(100) PRIMARY KEY,
+    type VARCHAR(20) NOT NULL,
+    required BOOLEAN NOT NULL DEFAULT FALSE,
+    pattern TEXT NOT NULL DEFAULT '',
+    visibility VARCHAR(20) NOT NULL,
+    claim BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at timestamp,
+    updated_at timestamp
+);
+
+CREATE TABLE email_changes (
+    id SERIAL PRIMARY KEY,
+    user_id INT UNIQUE NOT NULL,
+    new_email VARCHAR(255) NOT NULL,
+    token_hash TEXT NOT NULL,
+    expires_at timestamp NOT NULL,
+    created_at timestamp,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE identifier_history (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL,
+    kind VARCHAR(20) NOT NULL,
+    old_value VARCHAR(255) NOT NULL,
+    new_value VARCHAR(255) NOT NULL,
+    changed_at timestamp NOT NULL,
+    reserved_until timestamp NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX identifier_history_lookup ON identifier_history (kind, old_value, reserved_until);
+
+-- The audit log is append-only. Entries keep actor and subject IDs without foreign keys
+-- so they outlive purged users; only the personal fields can be erased, which the
+-- trigger below enforces.
+CREATE TABLE audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    occurred_at timestamp NOT NULL,
+    actor_id INT,
+    subject_id INT,
+    action VARCHAR(100) NOT NULL,
+    outcome VARCHAR(20) NOT NULL,
+    ip VARCHAR(64),
+    user_agent TEXT,
+    request_id VARCHAR(64) NOT NULL DEFAULT '',
+    details JSONB NOT NULL DEFAULT '{}',
+    salt VARCHAR(64),
+    personal_digest VARCHAR(64) NOT NULL,
+    prev_hash VARCHAR(64) NOT NULL,
+    hash VARCHAR(64) NOT NULL
+);
+
+CREATE INDEX audit_log_actor ON audit_log (actor_id, id);
+CREATE INDEX audit_log_subject ON audit_log (subject_id, id);
+CREATE INDEX audit_log_action ON audit_log (action, id);
+
+CREATE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'UPDATE'
+        AND NEW.ip IS NULL AND NEW.user_agent IS NULL AND NEW.salt IS NULL
+        AND (NEW.id, NEW.occurred_at, NEW.actor_id, NEW.subject_id, NEW.action, NEW.outcome,
+             NEW.request_id, NEW.details, NEW.personal_digest, NEW.prev_hash, NEW.hash)
+            IS NOT DISTINCT FROM
+            (OLD.id, OLD.occurred_at, OLD.actor_id, OLD.subject_id, OLD.action, OLD.outcome,
+             OLD.request_id, OLD.details, OLD.personal_digest, OLD.prev_hash, OLD.hash)
+    THEN
+        RETURN NEW;
+    END IF;
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_append_only
+    BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+
+CREATE TABLE sessions (
+    id VARCHAR(64) PRIMARY KEY,
+    user_id INT NOT NULL,
+    device VARCHAR(100) NOT NULL,
+    user_agent TEXT NOT NULL,
+    ip VARCHAR(64) NOT NULL,
+    created_at timestamp NOT NULL,
+    last_seen_at timestamp NOT NULL,
+    expires_at timestamp NOT NULL,
+    revoked_at timestamp,
+    actor_id INT REFERENCES users (id) ON DELETE SET NULL,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX sessions_user ON sessions (user_id, created_at);
+
+CREATE TABLE devices (
+    user_id INT NOT NULL,
+    device_hash VARCHAR(64) NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    family VARCHAR(50) NOT NULL,
+    last_ip VARCHAR(64) NOT NULL,
+    first_seen timestamp NOT NULL,
+    last_seen timestamp NOT NULL,
+    PRIMARY KEY (user_id, device_hash),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE login_challenges (
+    id VARCHAR(64) PRIMARY KEY,
+    user_id INT NOT NULL,
+    code_hash VARCHAR(64) NOT NULL,
+    device_hash VARCHAR(64) NOT NULL,
+    expires_at timestamp NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    created_at timestamp NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE api_keys (
+    id VARCHAR(32) PRIMARY KEY,
+    user_id INT NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    prefix VARCHAR(40) NOT NULL,
+    key_hash VARCHAR(64) NOT NULL UNIQUE,
+    scopes TEXT NOT NULL,
+    created_at timestamp NOT NULL,
+    expires_at timestamp,
+    last_used_at timestamp,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX api_keys_user ON api_keys (user_id, created_at);
+
+CREATE TABLE service_accounts (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL UNIQUE,
+    description VARCHAR(500) NOT NULL DEFAULT '',
+    disabled BOOLEAN NOT NULL DEFAULT FALSE,
+    require_dpop BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at timestamp NOT NULL,
+    updated_at timestamp NOT NULL
+);
+
+CREATE TABLE service_account_roles (
+    service_account_id INT NOT NULL,
+    role VARCHAR(50) NOT NULL,
+    PRIMARY KEY (service_account_id, role),
+    FOREIGN KEY (service_account_id) REFERENCES service_accounts (id) ON DELETE CASCADE
+);
+
+CREATE TABLE service_account_credentials (
+    id VARCHAR(32) PRIMARY KEY,
+    service_account_id INT NOT NULL,
+    type VARCHAR(20) NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    secret_hash VARCHAR(64) UNIQUE,
+    public_key TEXT,
+    created_at timestamp NOT NULL,
+    expires_at timestamp,
+    last_used_at timestamp,
+    FOREIGN KEY (service_account_id) REFERENCES service_accounts (id) ON DELETE CASCADE
+);
+
+CREATE INDEX service_account_credentials_account ON service_account_credentials (service_account_id, created_at);
+
+CREATE TABLE device_authorizations (
+    device_code_hash VARCHAR(64) PRIMARY KEY,
+    user_code VARCHAR(8) NOT NULL UNIQUE,
+    client_id VARCHAR(100) NOT NULL,
+    scope VARCHAR(500) NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL,
+    user_id INT,
+    poll_interval INT NOT NULL,
+    created_at timestamp NOT NULL,
+    expires_at timestamp NOT NULL,
+    last_polled_at timestamp,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX device_authorizations_expires_at ON device_authorizations (expires_at);
+
+CREATE TABLE policies (
+    name VARCHAR(100) PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT '',
+    expression TEXT NOT NULL,
+    created_at timestamp NOT NULL,
+    updated_at timestamp NOT NULL
 );
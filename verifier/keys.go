@@ -0,0 +1,141 @@
+package verifier
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ryanpujo/melius/accesstoken"
+)
+
+// keySet caches the public keys melius publishes at its JWKS URL.
+type keySet struct {
+	url    string
+	client *http.Client
+	// minAge is the least age of the keys fetched again for an unknown key.
+	minAge time.Duration
+
+	mu      sync.RWMutex
+	keys    map[string]crypto.PublicKey
+	fetched time.Time
+	// refreshing serializes the refreshes, so concurrent requests for an unknown
+	// key fetch the keys only once.
+	refreshing sync.Mutex
+}
+
+// refresh fetches the keys again, replacing the cached ones. Keys of unsupported
+// types are ignored.
+func (ks *keySet) refresh(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ks.url, nil)
+	if err != nil {
+		return err
+	}
+	res, err := ks.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch keys: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch keys: %s", res.Status)
+	}
+
+	var set struct {
+		Keys []map[string]any `json:"keys"`
+	}
+	if err := json.NewDecoder(io.LimitReader(res.Body, maxKeySetSize)).Decode(&set); err != nil {
+		return fmt.Errorf("failed to decode keys: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		key, thumbprint, err := accesstoken.ParseJWK(jwk)
+		if err != nil {
+			continue
+		}
+		kid, _ := jwk["kid"].(string)
+		if kid == "" {
+			kid = thumbprint
+		}
+		keys[kid] = key
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.keys, ks.fetched = keys, time.Now()
+	return nil
+}
+
+// refreshStale fetches the keys again unless they were fetched less than minAge
+// ago, so tokens naming unknown keys cannot flood melius.
+func (ks *keySet) refreshStale(ctx context.Context) error {
+	ks.refreshing.Lock()
+	defer ks.refreshing.Unlock()
+
+	ks.mu.RLock()
+	fresh := time.Since(ks.fetched) < ks.minAge
+	ks.mu.RUnlock()
+	if fresh {
+		return nil
+	}
+	return ks.refresh(ctx)
+}
+
+// key returns the key identified by kid. Keys are fetched again when kid is unknown,
+// since melius may have rotated its keys.
+func (ks *keySet) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	ks.mu.RLock()
+	key, ok := ks.keys[kid]
+	ks.mu.RUnlock()
+	if ok {
+		return key, nil
+	}
+
+	if err := ks.refreshStale(ctx); err != nil {
+		return nil, err
+	}
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	if key, ok := ks.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key %q", kid)
+}
+
+// ed25519Keys returns the Ed25519 keys, which verify PASETOs.
+func (ks *keySet) ed25519Keys() []ed25519.PublicKey {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	var keys []ed25519.PublicKey
+	for _, key := range ks.keys {
+		if key, ok := key.(ed25519.PublicKey); ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// run refreshes the keys every interval until ctx is done. Failures keep the
+// keys fetched last.
+func (ks *keySet) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := ks.refresh(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("verifier: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package verifier
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Middleware authenticates requests with their access token and stores the principal
+// in their context, retrieved with FromContext. Requests without a valid token are
+// rejected with 401.
+func (v *Verifier) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, err := v.VerifyRequest(r)
+		if err != nil {
+			status, message := challenge(w.Header(), err)
+			writeError(w, status, message)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), principal)))
+	})
+}
+
+// RequireScope rejects with 403 the requests whose token is limited to scopes not
+// including scope. It must wrap handlers behind Middleware.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return require(func(p *Principal) bool { return p.HasScope(scope) }, insufficientScope(scope))
+}
+
+// RequireRole rejects with 403 the requests whose token does not grant role.
+// It must wrap handlers behind Middleware.
+func RequireRole(role string) func(http.Handler) http.Handler {
+	return require(func(p *Principal) bool { return p.HasRole(role) }, "Insufficient role")
+}
+
+func require(allowed func(p *Principal) bool, message string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := FromContext(r.Context())
+			if !ok || !allowed(principal) {
+				writeError(w, http.StatusForbidden, message)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Gin is Middleware for gin. Handlers retrieve the principal with FromContext,
+// passing the *gin.Context.
+func (v *Verifier) Gin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, err := v.VerifyRequest(c.Request)
+		if err != nil {
+			status, message := challenge(c.Writer.Header(), err)
+			c.AbortWithStatusJSON(status, gin.H{"error": message})
+			return
+		}
+		c.Request = c.Request.WithContext(NewContext(c.Request.Context(), principal))
+		c.Next()
+	}
+}
+
+// GinRequireScope is RequireScope for gin. It must run after Gin.
+func GinRequireScope(scope string) gin.HandlerFunc {
+	return ginRequire(func(p *Principal) bool { return p.HasScope(scope) }, insufficientScope(scope))
+}
+
+// GinRequireRole is RequireRole for gin. It must run after Gin.
+func GinRequireRole(role string) gin.HandlerFunc {
+	return ginRequire(func(p *Principal) bool { return p.HasRole(role) }, "Insufficient role")
+}
+
+func ginRequire(allowed func(p *Principal) bool, message string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := FromContext(c)
+		if !ok || !allowed(principal) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": message})
+			return
+		}
+		c.Next()
+	}
+}
+
+// challenge sets the WWW-Authenticate header telling the client why err rejected
+// its request, and returns the status and message of the response.
+func challenge(header http.Header, err error) (int, string) {
+	switch {
+	case errors.Is(err, ErrInvalidProof):
+		header.Set("WWW-Authenticate", fmt.Sprintf(`DPoP error="invalid_dpop_proof", error_description=%q`, err.Error()))
+	case errors.Is(err, ErrInvalidToken):
+		header.Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="invalid_token", error_description=%q`, err.Error()))
+	default:
+		header.Set("WWW-Authenticate", "Bearer")
+	}
+	return http.StatusUnauthorized, err.Error()
+}
+
+func insufficientScope(scope string) string {
+	return fmt.Sprintf("Insufficient scope, %s is required", scope)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
@@ -0,0 +1,100 @@
+package verifier
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ryanpujo/melius/accesstoken"
+)
+
+// Types of principals. Users are people, service accounts are machines.
+const (
+	PrincipalUser           = accesstoken.PrincipalUser
+	PrincipalServiceAccount = accesstoken.PrincipalServiceAccount
+)
+
+// Principal is the user or service account a verified token was issued to.
+type Principal struct {
+	// Type is PrincipalUser or PrincipalServiceAccount.
+	Type string
+	// Subject is the ID of the user or service account.
+	Subject    string
+	Username   string
+	Roles      []string
+	Attributes map[string]any
+	// Scopes limit what the token may be used for, it is not limited when empty.
+	Scopes []string
+	// ClientID is the client the token was issued to, if any.
+	ClientID  string
+	SessionID string
+	// ActorID is the ID of the administrator impersonating the user, if any.
+	ActorID string
+	// AuthTime is when the user last presented their credentials, zero when unknown.
+	AuthTime  time.Time
+	ACR       string
+	AMR       []string
+	ExpiresAt time.Time
+	// Claims are the claims added by the claim mappers of melius.
+	Claims map[string]any
+}
+
+// newPrincipal returns the principal of verified claims.
+func newPrincipal(claims *accesstoken.Claims) *Principal {
+	principal := &Principal{
+		Type:       PrincipalUser,
+		Subject:    claims.Subject,
+		Username:   claims.Username,
+		Roles:      claims.Roles,
+		Attributes: claims.Attributes,
+		Scopes:     strings.Fields(claims.Scope),
+		ClientID:   claims.ClientID,
+		SessionID:  claims.SessionID,
+		ACR:        claims.ACR,
+		AMR:        claims.AMR,
+		Claims:     claims.Extra,
+	}
+	if claims.PrincipalType != "" {
+		principal.Type = claims.PrincipalType
+	}
+	if impersonator := claims.Actor.Impersonator(); impersonator != nil {
+		principal.ActorID = impersonator.Subject
+	}
+	if claims.AuthTime != nil {
+		principal.AuthTime = claims.AuthTime.Time
+	}
+	if claims.ExpiresAt != nil {
+		principal.ExpiresAt = claims.ExpiresAt.Time
+	}
+	return principal
+}
+
+// HasRole reports whether the token grants role.
+func (p *Principal) HasRole(role string) bool {
+	return slices.Contains(p.Roles, role)
+}
+
+// HasScope reports whether the token may be used for scope. Tokens without
+// scopes are not limited.
+func (p *Principal) HasScope(scope string) bool {
+	return len(p.Scopes) == 0 || slices.Contains(p.Scopes, scope)
+}
+
+type principalKey struct{}
+
+// NewContext returns a copy of ctx carrying principal.
+func NewContext(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// FromContext returns the principal of the request ctx belongs to, as stored by the
+// middlewares. ctx may be the context of the request or the *gin.Context handling it.
+func FromContext(ctx context.Context) (*Principal, bool) {
+	if c, ok := ctx.(*gin.Context); ok {
+		ctx = c.Request.Context()
+	}
+	principal, ok := ctx.Value(principalKey{}).(*Principal)
+	return principal, ok
+}
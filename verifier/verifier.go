@@ -0,0 +1,235 @@
+// Package verifier lets services trusting melius verify its access tokens with the
+// public keys melius publishes at /.well-known/jwks.json, rather than a shared secret.
+// Melius must sign its tokens with a key pair, as JWTs with JWT_SIGNING_KEY or as
+// PASETOs.
+//
+//	v, err := verifier.New(ctx, verifier.Options{
+//		JWKSURL:  "https://auth.example.com/.well-known/jwks.json",
+//		Issuer:   "https://auth.example.com",
+//		Audience: "orders",
+//	})
+//	mux.Handle("/orders", v.Middleware(verifier.RequireScope("orders:read")(orders)))
+//
+// Handlers retrieve the authenticated Principal with FromContext.
+package verifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/ryanpujo/melius/accesstoken"
+)
+
+const (
+	// DefaultRefreshInterval is how often keys are fetched again by default.
+	DefaultRefreshInterval = 5 * time.Minute
+	// minRefreshInterval is the least time between two fetches of the keys caused
+	// by tokens naming an unknown key, unless the refresh interval is shorter.
+	minRefreshInterval = 30 * time.Second
+	// maxKeySetSize is the largest key set read from melius.
+	maxKeySetSize = 1 << 20
+)
+
+// signingMethods are the asymmetric algorithms accepted for JWTs. Shared secret
+// algorithms are refused, the public keys must not be usable as secrets.
+var signingMethods = []string{
+	"EdDSA", "RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512",
+}
+
+var (
+	// ErrNoToken is returned for requests without an access token.
+	ErrNoToken = errors.New("token is required")
+	// ErrInvalidToken is returned for tokens that are malformed, signed by an unknown
+	// key, expired, or issued by another issuer or for another audience.
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrInvalidProof is returned for sender-constrained tokens sent without a valid
+	// DPoP proof of the key they are bound to.
+	ErrInvalidProof = errors.New("invalid DPoP proof")
+)
+
+// ReplayCache remembers the DPoP proofs accepted, so each proof is used only once.
+type ReplayCache interface {
+	// Seen reports whether jti was already seen, and remembers it until expiresAt otherwise.
+	Seen(jti string, expiresAt time.Time) bool
+}
+
+// Options configures a Verifier.
+type Options struct {
+	// JWKSURL is where melius publishes its keys, as in https://auth.example.com/.well-known/jwks.json.
+	JWKSURL string
+	// Issuer is the issuer of the accepted tokens, the ISSUER of melius.
+	Issuer string
+	// Audience is the audience of the accepted tokens, usually the name of the service.
+	Audience string
+	// RefreshInterval is how often keys are fetched again, DefaultRefreshInterval when zero.
+	RefreshInterval time.Duration
+	// Leeway is the clock skew tolerated when checking the times of tokens.
+	Leeway time.Duration
+	// HTTPClient fetches the keys, a client with a 10 second timeout when nil.
+	HTTPClient *http.Client
+	// TrustedProxies are the IP addresses or CIDR ranges of the reverse proxies in front
+	// of the service, trusted to tell by X-Forwarded-Proto that they terminated TLS,
+	// for the URL DPoP proofs sign. The header is ignored on other requests.
+	TrustedProxies []string
+	// ReplayCache remembers DPoP proofs, in memory when nil. Instances of a service
+	// behind a load balancer should share it.
+	ReplayCache ReplayCache
+}
+
+// Verifier verifies the access tokens of melius.
+type Verifier struct {
+	keys      *keySet
+	validator *jwt.Validator
+	replay    ReplayCache
+	proxies   accesstoken.TrustedProxies
+}
+
+// New returns a Verifier once it fetched the keys of melius. The keys are refreshed
+// in the background until ctx is done.
+func New(ctx context.Context, opts Options) (*Verifier, error) {
+	if opts.JWKSURL == "" || opts.Issuer == "" || opts.Audience == "" {
+		return nil, errors.New("verifier: JWKSURL, Issuer and Audience are required")
+	}
+	if opts.RefreshInterval <= 0 {
+		opts.RefreshInterval = DefaultRefreshInterval
+	}
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	if opts.ReplayCache == nil {
+		opts.ReplayCache = accesstoken.NewReplayCache()
+	}
+	proxies, err := accesstoken.ParseTrustedProxies(opts.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("verifier: %w", err)
+	}
+
+	v := &Verifier{
+		keys: &keySet{
+			url:    opts.JWKSURL,
+			client: opts.HTTPClient,
+			minAge: min(opts.RefreshInterval, minRefreshInterval),
+		},
+		validator: jwt.NewValidator(
+			jwt.WithIssuer(opts.Issuer),
+			jwt.WithAudience(opts.Audience),
+			jwt.WithLeeway(opts.Leeway),
+			jwt.WithExpirationRequired(),
+			jwt.WithIssuedAt(),
+		),
+		replay:  opts.ReplayCache,
+		proxies: proxies,
+	}
+	if err := v.keys.refresh(ctx); err != nil {
+		return nil, fmt.Errorf("verifier: %w", err)
+	}
+	go v.keys.run(ctx, opts.RefreshInterval)
+	return v, nil
+}
+
+// Verify verifies token and returns the principal it was issued to. Tokens bound
+// to a key must be verified with VerifyRequest, along with their DPoP proof.
+func (v *Verifier) Verify(ctx context.Context, token string) (*Principal, error) {
+	claims, err := v.verify(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Confirmation != nil {
+		return nil, fmt.Errorf("%w: DPoP proof required", ErrInvalidProof)
+	}
+	return newPrincipal(claims), nil
+}
+
+// VerifyRequest verifies the access token of r, sent with the Bearer scheme or with
+// the DPoP scheme along with a DPoP proof, and returns the principal it was issued to.
+func (v *Verifier) VerifyRequest(r *http.Request) (*Principal, error) {
+	scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	dpop := strings.EqualFold(scheme, "DPoP")
+	if token == "" || !dpop && !strings.EqualFold(scheme, "Bearer") {
+		return nil, ErrNoToken
+	}
+
+	claims, err := v.verify(r.Context(), token)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case !dpop && claims.Confirmation != nil:
+		return nil, fmt.Errorf("%w: DPoP proof required", ErrInvalidProof)
+	case dpop && claims.Confirmation == nil:
+		return nil, fmt.Errorf("%w: token is not bound to a key", ErrInvalidProof)
+	case dpop:
+		jkt, err := accesstoken.VerifyDPoPProof(r.Header.Get("DPoP"), r.Method, accesstoken.RequestURL(r, v.proxies), token, v.replay)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidProof, err)
+		}
+		if jkt != claims.Confirmation.JKT {
+			return nil, fmt.Errorf("%w: proof signed by another key", ErrInvalidProof)
+		}
+	}
+	return newPrincipal(claims), nil
+}
+
+// verify checks the signature of token and its registered claims.
+func (v *Verifier) verify(ctx context.Context, token string) (*accesstoken.Claims, error) {
+	var (
+		claims *accesstoken.Claims
+		err    error
+	)
+	if strings.HasPrefix(token, "v4.") {
+		claims, err = v.verifyPASETO(ctx, token)
+	} else {
+		claims, err = v.verifyJWT(ctx, token)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	if err := v.validator.Validate(claims); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	return claims, nil
+}
+
+// verifyJWT verifies a JWT with the key named by its kid header.
+func (v *Verifier) verifyJWT(ctx context.Context, token string) (*accesstoken.Claims, error) {
+	var claims accesstoken.Claims
+	_, err := jwt.ParseWithClaims(token, &claims, func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		return v.keys.key(ctx, kid)
+	}, jwt.WithValidMethods(signingMethods), jwt.WithoutClaimsValidation())
+	if err != nil {
+		return nil, err
+	}
+	return &claims, nil
+}
+
+// verifyPASETO verifies a v4.public PASETO with the Ed25519 keys, which it does not
+// name. The keys are fetched again when none verifies it, as they may have rotated.
+func (v *Verifier) verifyPASETO(ctx context.Context, token string) (*accesstoken.Claims, error) {
+	try := func() (*accesstoken.Claims, error) {
+		err := accesstoken.ErrPASETOInvalid
+		for _, key := range v.keys.ed25519Keys() {
+			var claims *accesstoken.Claims
+			if claims, err = accesstoken.NewPASETOVerifier(key).Verify(token); err == nil {
+				return claims, nil
+			}
+		}
+		return nil, err
+	}
+
+	claims, err := try()
+	if err == nil {
+		return claims, nil
+	}
+	if err := v.keys.refreshStale(ctx); err != nil {
+		return nil, err
+	}
+	return try()
+}
@@ -0,0 +1,273 @@
+package verifier_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/ryanpujo/melius/accesstoken"
+	"github.com/ryanpujo/melius/verifier"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	issuer   = "https://melius.test"
+	audience = "orders"
+)
+
+// testIssuer signs tokens and publishes its keys like melius does.
+type testIssuer struct {
+	mu     sync.Mutex
+	format accesstoken.Format
+	server *httptest.Server
+}
+
+func newTestIssuer(t *testing.T, format func(key ed25519.PrivateKey) accesstoken.Format) *testIssuer {
+	ti := &testIssuer{}
+	ti.rotate(t, format)
+	ti.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ti.mu.Lock()
+		defer ti.mu.Unlock()
+		json.NewEncoder(w).Encode(accesstoken.JWKS{Keys: ti.format.(accesstoken.KeyPublisher).PublicKeys()})
+	}))
+	t.Cleanup(ti.server.Close)
+	return ti
+}
+
+// rotate replaces the key signing tokens.
+func (ti *testIssuer) rotate(t *testing.T, format func(key ed25519.PrivateKey) accesstoken.Format) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	ti.mu.Lock()
+	defer ti.mu.Unlock()
+	ti.format = format(key)
+}
+
+// token signs claims with the registered claims melius sets, changed by modify.
+func (ti *testIssuer) token(t *testing.T, claims accesstoken.Claims, modify func(claims *accesstoken.Claims)) string {
+	now := time.Now()
+	claims.Issuer = issuer
+	claims.Audience = jwt.ClaimStrings{"melius", audience}
+	claims.IssuedAt = jwt.NewNumericDate(now)
+	claims.NotBefore = claims.IssuedAt
+	claims.ExpiresAt = jwt.NewNumericDate(now.Add(time.Minute))
+	if modify != nil {
+		modify(&claims)
+	}
+
+	ti.mu.Lock()
+	defer ti.mu.Unlock()
+	token, err := ti.format.Sign(claims)
+	require.NoError(t, err)
+	return token
+}
+
+// verifier returns a verifier of the tokens of the issuer, fetching its keys again
+// for unknown keys as soon as they are a millisecond old.
+func (ti *testIssuer) verifier(t *testing.T) *verifier.Verifier {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	v, err := verifier.New(ctx, verifier.Options{
+		JWKSURL:         ti.server.URL,
+		Issuer:          issuer,
+		Audience:        audience,
+		RefreshInterval: time.Millisecond,
+	})
+	require.NoError(t, err)
+	return v
+}
+
+func TestVerify(t *testing.T) {
+	for name, format := range map[string]func(key ed25519.PrivateKey) accesstoken.Format{
+		"jwt":    accesstoken.NewEd25519JWTFormat,
+		"paseto": accesstoken.NewPASETOFormat,
+	} {
+		t.Run(name, func(t *testing.T) {
+			ti := newTestIssuer(t, format)
+			v := ti.verifier(t)
+
+			claims := accesstoken.NewClaims(1, "ryanpujo")
+			claims.Roles = []string{"admin"}
+			claims.Scope = "orders:read"
+			claims.ClientID = "7"
+			claims.Extra = map[string]any{"tenant": "acme"}
+			principal, err := v.Verify(context.Background(), ti.token(t, claims, nil))
+			require.NoError(t, err)
+			require.Equal(t, verifier.PrincipalUser, principal.Type)
+			require.Equal(t, "1", principal.Subject)
+			require.Equal(t, "ryanpujo", principal.Username)
+			require.Equal(t, "7", principal.ClientID)
+			require.Equal(t, "acme", principal.Claims["tenant"])
+			require.True(t, principal.HasRole("admin"))
+			require.True(t, principal.HasScope("orders:read"))
+			require.False(t, principal.HasScope("orders:write"))
+
+			robot := accesstoken.NewServiceAccountClaims(7, "ci")
+			principal, err = v.Verify(context.Background(), ti.token(t, robot, nil))
+			require.NoError(t, err)
+			require.Equal(t, verifier.PrincipalServiceAccount, principal.Type)
+
+			ti.rotate(t, format)
+			time.Sleep(2 * time.Millisecond)
+			_, err = v.Verify(context.Background(), ti.token(t, claims, nil))
+			require.NoError(t, err, "keys are fetched again for tokens signed by a new key")
+
+			tableTest := map[string]func(claims *accesstoken.Claims){
+				"other issuer":   func(claims *accesstoken.Claims) { claims.Issuer = "https://evil.test" },
+				"other audience": func(claims *accesstoken.Claims) { claims.Audience = jwt.ClaimStrings{"melius"} },
+				"expired": func(claims *accesstoken.Claims) {
+					claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+				},
+				"without expiry": func(claims *accesstoken.Claims) { claims.ExpiresAt = nil },
+				"DPoP bound":     func(claims *accesstoken.Claims) { claims.Bind("thumbprint") },
+			}
+			for name, modify := range tableTest {
+				t.Run(name, func(t *testing.T) {
+					_, err := v.Verify(context.Background(), ti.token(t, claims, modify))
+					require.Error(t, err)
+				})
+			}
+
+			other := newTestIssuer(t, format)
+			_, err = v.Verify(context.Background(), other.token(t, claims, nil))
+			require.ErrorIs(t, err, verifier.ErrInvalidToken)
+		})
+	}
+}
+
+func TestVerifySymmetric(t *testing.T) {
+	ti := newTestIssuer(t, accesstoken.NewEd25519JWTFormat)
+	v := ti.verifier(t)
+
+	// A token signed with HS256 and the public key as secret must not verify.
+	claims := accesstoken.NewClaims(1, "ryanpujo")
+	claims.Issuer = issuer
+	claims.Audience = jwt.ClaimStrings{audience}
+	claims.IssuedAt = jwt.NewNumericDate(time.Now())
+	claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(time.Minute))
+	public := ti.format.(accesstoken.KeyPublisher).PublicKeys()[0]
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = public.KeyID
+	signed, err := token.SignedString([]byte(public.X))
+	require.NoError(t, err)
+
+	_, err = v.Verify(context.Background(), signed)
+	require.ErrorIs(t, err, verifier.ErrInvalidToken)
+}
+
+func TestNew(t *testing.T) {
+	_, err := verifier.New(context.Background(), verifier.Options{JWKSURL: "http://melius.test"})
+	require.Error(t, err)
+
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	_, err = verifier.New(context.Background(), verifier.Options{JWKSURL: server.URL, Issuer: issuer, Audience: audience})
+	require.Error(t, err)
+}
+
+func TestMiddleware(t *testing.T) {
+	ti := newTestIssuer(t, accesstoken.NewEd25519JWTFormat)
+	v := ti.verifier(t)
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, _ := verifier.FromContext(r.Context())
+		w.Write([]byte(principal.Username))
+	})
+	mux := http.NewServeMux()
+	mux.Handle("/orders", v.Middleware(verifier.RequireScope("orders:read")(ok)))
+	mux.Handle("/admin", v.Middleware(verifier.RequireRole("admin")(ok)))
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(v.Gin())
+	router.GET("/orders", verifier.GinRequireScope("orders:read"), func(c *gin.Context) {
+		principal, _ := verifier.FromContext(c)
+		c.String(http.StatusOK, principal.Username)
+	})
+	router.GET("/admin", verifier.GinRequireRole("admin"), func(c *gin.Context) {
+		principal, _ := verifier.FromContext(c)
+		c.String(http.StatusOK, principal.Username)
+	})
+
+	reader := accesstoken.NewClaims(1, "ryanpujo")
+	reader.Scope = "orders:read"
+	writer := accesstoken.NewClaims(2, "pujo")
+	writer.Scope = "orders:write"
+	writer.Roles = []string{"admin"}
+
+	tableTest := map[string]struct {
+		path          string
+		authorization string
+		status        int
+		challenge     string
+	}{
+		"success": {
+			path:          "/orders",
+			authorization: "Bearer " + ti.token(t, reader, nil),
+			status:        http.StatusOK,
+		},
+		"no token": {
+			path:      "/orders",
+			status:    http.StatusUnauthorized,
+			challenge: "Bearer",
+		},
+		"invalid token": {
+			path:          "/orders",
+			authorization: "Bearer invalid",
+			status:        http.StatusUnauthorized,
+			challenge:     `Bearer error="invalid_token"`,
+		},
+		"DPoP bound": {
+			path: "/orders",
+			authorization: "Bearer " + ti.token(t, reader, func(claims *accesstoken.Claims) {
+				claims.Bind("thumbprint")
+			}),
+			status:    http.StatusUnauthorized,
+			challenge: `DPoP error="invalid_dpop_proof"`,
+		},
+		"insufficient scope": {
+			path:          "/orders",
+			authorization: "Bearer " + ti.token(t, writer, nil),
+			status:        http.StatusForbidden,
+		},
+		"role": {
+			path:          "/admin",
+			authorization: "Bearer " + ti.token(t, writer, nil),
+			status:        http.StatusOK,
+		},
+		"insufficient role": {
+			path:          "/admin",
+			authorization: "Bearer " + ti.token(t, reader, nil),
+			status:        http.StatusForbidden,
+		},
+	}
+
+	for name, test := range tableTest {
+		for handlerName, handler := range map[string]http.Handler{"http": mux, "gin": router} {
+			t.Run(handlerName+" "+name, func(t *testing.T) {
+				req := httptest.NewRequest(http.MethodGet, test.path, nil)
+				if test.authorization != "" {
+					req.Header.Set("Authorization", test.authorization)
+				}
+				res := httptest.NewRecorder()
+				handler.ServeHTTP(res, req)
+
+				require.Equal(t, test.status, res.Code)
+				require.Contains(t, res.Header().Get("WWW-Authenticate"), test.challenge)
+				if test.status != http.StatusOK {
+					var body map[string]string
+					require.NoError(t, json.Unmarshal(res.Body.Bytes(), &body))
+					require.NotEmpty(t, body["error"])
+				}
+			})
+		}
+	}
+}